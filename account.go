@@ -0,0 +1,49 @@
+package pam
+
+import "errors"
+
+// AccountStatus describes the account of the user of a transaction, as
+// validated by AccountStatus.
+type AccountStatus struct {
+	// Valid is whether the account is valid and the user is allowed to
+	// access the service.
+	Valid bool
+	// MustChangePassword is whether the authentication token has expired
+	// or must be changed, with ChangeAuthTok and ChangeExpiredAuthtok,
+	// before the user can access the service.
+	MustChangePassword bool
+	// Expired is whether the account has expired.
+	Expired bool
+	// Warnings are the ErrorMsg and TextInfo messages sent by the modules
+	// during the validation, such as those announcing that the password
+	// expires soon.
+	Warnings []string
+}
+
+// AccountStatus validates the account of the user, as AcctMgmt does, and
+// reports its status. The error is nil if the status describes the result,
+// and is the one of AcctMgmt otherwise, for example if the user is unknown
+// or the access is denied.
+//
+// Valid flags: Silent, DisallowNullAuthtok
+func (t *Transaction) AccountStatus(f Flags) (AccountStatus, error) {
+	var messages []ConversationMessage
+	if t.conversation != nil {
+		prev := t.conversation.messages
+		t.conversation.messages = &messages
+		defer func() { t.conversation.messages = prev }()
+	}
+	err := t.AcctMgmt(f)
+	status := AccountStatus{
+		Valid:              err == nil,
+		MustChangePassword: ShouldChangeAuthTok(err),
+		Expired:            errors.Is(err, ErrAcctExpired),
+	}
+	for _, m := range messages {
+		status.Warnings = append(status.Warnings, m.Message)
+	}
+	if status.Valid || status.MustChangePassword || status.Expired {
+		err = nil
+	}
+	return status, err
+}
@@ -0,0 +1,37 @@
+package pam
+
+import (
+	"os/user"
+	"reflect"
+	"testing"
+)
+
+func TestAccountStatus(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	tx, err := StartConfDir("account-service", u.Username, Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	status, err := tx.AccountStatus(0)
+	if err != nil {
+		t.Fatalf("accountstatus #error: %v", err)
+	}
+	expected := AccountStatus{Valid: true, Warnings: []string{"Your password expires in 3 days"}}
+	if !reflect.DeepEqual(status, expected) {
+		t.Fatalf("accountstatus #error: expected %+v, got %+v", expected, status)
+	}
+
+	tx, err = StartConfDir("permit-service", u.Username, Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	status, err = tx.AccountStatus(0)
+	if err == nil || status.Valid {
+		t.Fatalf("accountstatus #error: expected an invalid account, got %+v", status)
+	}
+}
@@ -0,0 +1,53 @@
+//go:build cgo
+
+package pam
+
+//#include <stdlib.h>
+import "C"
+
+import "unsafe"
+
+// The C memory allocated by the package goes through these functions, so
+// that builds with the pam_debugalloc tag can track it.
+
+func cString(s string) *C.char {
+	p := C.CString(s)
+	trackAlloc(unsafe.Pointer(p), "CString")
+	return p
+}
+
+func cBytes(b []byte) unsafe.Pointer {
+	p := C.CBytes(b)
+	trackAlloc(p, "CBytes")
+	return p
+}
+
+func cMalloc(n C.size_t) unsafe.Pointer {
+	p := C.malloc(n)
+	trackAlloc(p, "malloc")
+	return p
+}
+
+func cCalloc(n, size C.size_t) unsafe.Pointer {
+	p := C.calloc(n, size)
+	trackAlloc(p, "calloc")
+	return p
+}
+
+// cFree frees memory allocated by the package.
+func cFree(p unsafe.Pointer) {
+	trackFree(p)
+	C.free(p)
+}
+
+// cHandOver marks memory allocated by the package that PAM frees, such as
+// the conversation responses.
+func cHandOver(p unsafe.Pointer) {
+	trackFree(p)
+}
+
+// freeForeign frees memory allocated by PAM or by the applications, such as
+// the binary conversation responses.
+func freeForeign(p unsafe.Pointer) {
+	C.free(p)
+}
@@ -0,0 +1,71 @@
+//go:build pam_debugalloc
+
+package pam
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"unsafe"
+)
+
+// allocations are the C allocations of the package not released yet, with
+// where they were made.
+var allocations struct {
+	sync.Mutex
+	live map[unsafe.Pointer]string
+}
+
+func trackAlloc(p unsafe.Pointer, kind string) {
+	if p == nil {
+		return
+	}
+	where := "unknown"
+	if _, file, line, ok := runtime.Caller(2); ok {
+		where = fmt.Sprintf("%s:%d", file, line)
+	}
+	allocations.Lock()
+	defer allocations.Unlock()
+	if allocations.live == nil {
+		allocations.live = map[unsafe.Pointer]string{}
+	}
+	if prev, ok := allocations.live[p]; ok {
+		panic(fmt.Sprintf("pam: %p allocated at %s is still live, allocated again by %s", p, prev, kind))
+	}
+	allocations.live[p] = fmt.Sprintf("%s at %s", kind, where)
+}
+
+func trackFree(p unsafe.Pointer) {
+	if p == nil {
+		return
+	}
+	allocations.Lock()
+	defer allocations.Unlock()
+	if _, ok := allocations.live[p]; !ok {
+		panic(fmt.Sprintf("pam: releasing %p, not allocated by the package or already released", p))
+	}
+	delete(allocations.live, p)
+}
+
+// liveAllocations returns the descriptions of the live allocations.
+func liveAllocations() []string {
+	allocations.Lock()
+	defer allocations.Unlock()
+	var live []string
+	for p, desc := range allocations.live {
+		live = append(live, fmt.Sprintf("%p: %s", p, desc))
+	}
+	sort.Strings(live)
+	return live
+}
+
+// reportAllocations writes the live allocations to the standard error. It
+// is called when transactions are closed, when no allocations are expected
+// but those of the other transactions and of the secure buffers.
+func reportAllocations() {
+	for _, a := range liveAllocations() {
+		fmt.Fprintf(os.Stderr, "pam: live C allocation %s\n", a)
+	}
+}
@@ -0,0 +1,122 @@
+//go:build pam_debugalloc
+
+package pam
+
+import (
+	"errors"
+	"os/user"
+	"testing"
+	"unsafe"
+)
+
+func TestAllocations(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	tx, err := StartConfDir("echo-service", u.Username, Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := tx.SetItem(Tty, "tty1"); err != nil {
+		t.Fatalf("setitem #error: %v", err)
+	}
+	if err := tx.PutEnv("A=B"); err != nil {
+		t.Fatalf("putenv #error: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if v := tx.GetEnv("A"); v != "B" {
+			t.Fatalf("getenv #error: expected B, got %v", v)
+		}
+	}
+	if _, err := tx.converse(conversationMessages[1:]); err != nil {
+		t.Fatalf("converse #error: %v", err)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+	if live := liveAllocations(); len(live) != 0 {
+		t.Fatalf("close #error: live allocations %v", live)
+	}
+
+	p := cString("leak")
+	if live := liveAllocations(); len(live) != 1 {
+		t.Fatalf("cstring #error: expected a live allocation, got %v", live)
+	}
+	cFree(unsafe.Pointer(p))
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("cfree #expected a panic")
+		}
+	}()
+	cFree(unsafe.Pointer(p))
+}
+
+// failingBinaryHandler responds to the binary prompts and fails at the
+// message with index fail.
+type failingBinaryHandler struct {
+	calls int
+	fail  int
+}
+
+func (h *failingBinaryHandler) RespondPAM(s Style, msg string) (string, error) {
+	return h.respond("text")
+}
+
+func (h *failingBinaryHandler) RespondPAMBinary(ptr BinaryPointer) ([]byte, error) {
+	r, err := h.respond("\x01binary\x00data")
+	return []byte(r), err
+}
+
+func (h *failingBinaryHandler) respond(r string) (string, error) {
+	defer func() { h.calls++ }()
+	if h.calls == h.fail {
+		return "", errors.New("failure")
+	}
+	return r, nil
+}
+
+func TestAllocations_ConversationFailure(t *testing.T) {
+	messages := []ConversationMessage{
+		{BinaryPrompt, "binary"},
+		{PromptEchoOff, "Password:"},
+		{PromptEchoOn, "login:"},
+	}
+	handlers := map[string]ConversationHandler{
+		"binary": &failingBinaryHandler{fail: 2},
+		"bytes": BytesConversationFunc(func(s Style, msg []byte) ([]byte, error) {
+			if s == PromptEchoOn {
+				return nil, errors.New("failure")
+			}
+			return []byte("secret"), nil
+		}),
+		"string": ConversationFunc(func(s Style, msg string) (string, error) {
+			if s == PromptEchoOn {
+				return "", errors.New("failure")
+			}
+			return "secret", nil
+		}),
+		"multi": &multiHandler{responses: []string{"secret"}},
+	}
+	for name, handler := range handlers {
+		t.Run(name, func(t *testing.T) {
+			tx := conversationStart(t, handler)
+			msgs := messages
+			if name != "binary" {
+				msgs = messages[1:]
+			}
+			if _, err := tx.converse(msgs); !errors.Is(err, ErrConv) {
+				t.Fatalf("converse #error: expected %v, got %v", ErrConv, err)
+			}
+			if err := tx.Close(); err != nil {
+				t.Fatalf("close #error: %v", err)
+			}
+			if live := liveAllocations(); len(live) != 0 {
+				t.Fatalf("converse #error: live allocations %v", live)
+			}
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package pam
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"slices"
+)
+
+// AppContextEnv is the PAM environment variable holding the AppContext
+// shared by the applications and the cooperating modules, as base64url
+// encoded JSON. Applications exporting the PAM environment to the sessions
+// should leave it out.
+const AppContextEnv = "PAM_GO_CONTEXT"
+
+// The capabilities of the applications known to the modules of this
+// repository.
+const (
+	// CapabilityStructuredPrompts is set by the applications decoding
+	// the structured prompts, see EncodeStructuredPrompt.
+	CapabilityStructuredPrompts = "structured-prompts"
+	// CapabilityChoice is set by the applications answering the binary
+	// choice prompts, see ChoiceHandler.
+	CapabilityChoice = "choice"
+	// CapabilityQRCode is set by the applications displaying the QR codes
+	// sent as text with a monospace font.
+	CapabilityQRCode = "qrcode"
+)
+
+// ClientInfo describes the client an application authenticates.
+type ClientInfo struct {
+	// Application is the name of the application, or of the client
+	// program if the application is a server.
+	Application string `json:"application,omitempty"`
+	// Address is the network address of the client, if remote.
+	Address string `json:"address,omitempty"`
+	// UserAgent is the user agent of the client, such as the one of a
+	// web browser.
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+// AppContext is the structured context an application passes to the
+// modules of the stack through the PAM environment, and that the modules
+// can update in return, such as to pass back values through Values.
+type AppContext struct {
+	// RequestID identifies the request of the application, to correlate
+	// the logs of the modules with its own.
+	RequestID string `json:"request_id,omitempty"`
+	// Client describes the client of the application.
+	Client ClientInfo `json:"client,omitzero"`
+	// Capabilities are the capabilities of the user interface of the
+	// application, such as CapabilityChoice.
+	Capabilities []string `json:"capabilities,omitempty"`
+	// Values are free-form values, named after their module or their
+	// application to avoid conflicts.
+	Values map[string]string `json:"values,omitempty"`
+}
+
+// HasCapability returns whether the application has the capability.
+func (c *AppContext) HasCapability(capability string) bool {
+	return slices.Contains(c.Capabilities, capability)
+}
+
+// SetValue sets a value of Values.
+func (c *AppContext) SetValue(name, value string) {
+	if c.Values == nil {
+		c.Values = map[string]string{}
+	}
+	c.Values[name] = value
+}
+
+// EnvHandle is the PAM environment API of the transactions of the
+// applications and of the modules.
+type EnvHandle interface {
+	PutEnv(nameval string) error
+	GetEnv(name string) string
+}
+
+// GetAppContext returns the context of the PAM environment of h, empty if
+// not set. It fails with ErrBadItem if the variable is malformed.
+func GetAppContext(h EnvHandle) (*AppContext, error) {
+	c := &AppContext{}
+	value := h.GetEnv(AppContextEnv)
+	if value == "" {
+		return c, nil
+	}
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrBadItem, AppContextEnv, err)
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrBadItem, AppContextEnv, err)
+	}
+	return c, nil
+}
+
+// SetAppContext sets the context of the PAM environment of h, removing it
+// if c is nil.
+func SetAppContext(h EnvHandle, c *AppContext) error {
+	if c == nil {
+		return h.PutEnv(AppContextEnv)
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	return h.PutEnv(AppContextEnv + "=" + base64.RawURLEncoding.EncodeToString(data))
+}
+
+// UpdateAppContext calls f with the context of the PAM environment of h,
+// then sets it as modified by f.
+func UpdateAppContext(h EnvHandle, f func(c *AppContext)) error {
+	c, err := GetAppContext(h)
+	if err != nil {
+		return err
+	}
+	f(c)
+	return SetAppContext(h, c)
+}
+
+// AppContext returns the context of the transaction, see GetAppContext.
+func (t *Transaction) AppContext() (*AppContext, error) {
+	return GetAppContext(t)
+}
+
+// SetAppContext sets the context of the transaction, see SetAppContext.
+func (t *Transaction) SetAppContext(c *AppContext) error {
+	return SetAppContext(t, c)
+}
@@ -0,0 +1,90 @@
+package pam
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type envMap map[string]string
+
+func (e envMap) PutEnv(nameval string) error {
+	name, value, ok := strings.Cut(nameval, "=")
+	if !ok {
+		delete(e, name)
+		return nil
+	}
+	e[name] = value
+	return nil
+}
+
+func (e envMap) GetEnv(name string) string {
+	return e[name]
+}
+
+func TestAppContext(t *testing.T) {
+	env := envMap{}
+	if c, err := GetAppContext(env); err != nil || !reflect.DeepEqual(c, &AppContext{}) {
+		t.Fatalf("get #error: expected an empty context, got %+v, %v", c, err)
+	}
+	c := &AppContext{
+		RequestID:    "req-42",
+		Client:       ClientInfo{Application: "webapp", Address: "192.0.2.1", UserAgent: "Firefox"},
+		Capabilities: []string{CapabilityChoice, CapabilityQRCode},
+	}
+	if err := SetAppContext(env, c); err != nil {
+		t.Fatalf("set #error: %v", err)
+	}
+	if strings.ContainsAny(env[AppContextEnv], "={}\"") {
+		t.Fatalf("set #error: unexpected encoding %q", env[AppContextEnv])
+	}
+	got, err := GetAppContext(env)
+	if err != nil || !reflect.DeepEqual(got, c) {
+		t.Fatalf("get #error: expected %+v, got %+v, %v", c, got, err)
+	}
+	if !got.HasCapability(CapabilityChoice) || got.HasCapability(CapabilityStructuredPrompts) {
+		t.Fatalf("capability #error: unexpected capabilities %v", got.Capabilities)
+	}
+
+	if err := UpdateAppContext(env, func(c *AppContext) {
+		c.SetValue("pam_example.method", "otp")
+	}); err != nil {
+		t.Fatalf("update #error: %v", err)
+	}
+	if got, _ := GetAppContext(env); got.RequestID != "req-42" || got.Values["pam_example.method"] != "otp" {
+		t.Fatalf("update #error: unexpected context %+v", got)
+	}
+
+	if err := SetAppContext(env, nil); err != nil {
+		t.Fatalf("set #error: %v", err)
+	}
+	if _, ok := env[AppContextEnv]; ok {
+		t.Fatalf("set #error: expected the variable to be removed")
+	}
+
+	for _, value := range []string{"not base64!", "bm90IGpzb24"} {
+		env[AppContextEnv] = value
+		if _, err := GetAppContext(env); !errors.Is(err, ErrBadItem) {
+			t.Fatalf("get #error: %q: expected %v, got %v", value, ErrBadItem, err)
+		}
+	}
+}
+
+func TestTransaction_AppContext(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	tx, err := StartConfDir("permit-service", "test", Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	c := &AppContext{RequestID: "req-42", Values: map[string]string{"app.session": "1"}}
+	if err := tx.SetAppContext(c); err != nil {
+		t.Fatalf("set #error: %v", err)
+	}
+	if got, err := tx.AppContext(); err != nil || !reflect.DeepEqual(got, c) {
+		t.Fatalf("get #error: expected %+v, got %+v, %v", c, got, err)
+	}
+}
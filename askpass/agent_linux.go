@@ -0,0 +1,191 @@
+package askpass
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/termconv"
+	"golang.org/x/sys/unix"
+)
+
+// AgentDir is the directory the agents of systemd watch for the questions.
+const AgentDir = "/run/systemd/ask-password"
+
+// Agent is a conversation handler asking the password agents of systemd
+// for the responses to the PromptEchoOff messages, as systemd-ask-password
+// does: each question is an ask file of the agent directory, pointing to
+// the datagram socket the agents send the response to, prefixed by "+", or
+// "-" if the user cancels it. Only the responses sent by root or by the
+// user of the process are accepted.
+type Agent struct {
+	// Dir is the agent directory, AgentDir if empty. The prompts are
+	// passed to Fallback if it does not exist, as when systemd is not
+	// running.
+	Dir string
+	// ID identifies the requester of the questions to the agents, such
+	// as "cryptsetup:/dev/sda5", and Icon is the name of their icon.
+	ID, Icon string
+	// AcceptCached lets the agents answer with the passwords they
+	// cached for the previous questions.
+	AcceptCached bool
+	// Timeout is the maximum time waited for the response to each
+	// prompt, none if 0. The prompts timing out fail with
+	// termconv.ErrTimeout.
+	Timeout time.Duration
+	// Fallback handles the other messages, a termconv.Handler if nil.
+	Fallback pam.ConversationHandler
+}
+
+// RespondPAM asks the agents for the responses to the PromptEchoOff
+// messages.
+func (a *Agent) RespondPAM(s pam.Style, msg string) (string, error) {
+	dir := a.Dir
+	if dir == "" {
+		dir = AgentDir
+	}
+	if s != pam.PromptEchoOff {
+		return fallback(a.Fallback).RespondPAM(s, msg)
+	}
+	if _, err := os.Stat(dir); errors.Is(err, os.ErrNotExist) {
+		return fallback(a.Fallback).RespondPAM(s, msg)
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return "", err
+	}
+	suffix := hex.EncodeToString(id)
+	conn, err := listen(filepath.Join(dir, "sck."+suffix))
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(conn.LocalAddr().String())
+	defer conn.Close()
+	if a.Timeout > 0 {
+		if err := conn.SetReadDeadline(time.Now().Add(a.Timeout)); err != nil {
+			return "", err
+		}
+	}
+	ask := filepath.Join(dir, "ask."+suffix)
+	if err := a.writeAsk(ask, conn.LocalAddr().String(), msg); err != nil {
+		return "", err
+	}
+	defer os.Remove(ask)
+	return receive(conn)
+}
+
+// listen binds the datagram socket receiving the responses, with the
+// credentials of their senders.
+func listen(path string) (*net.UnixConn, error) {
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	raw, err := conn.SyscallConn()
+	if err == nil {
+		cerr := raw.Control(func(fd uintptr) {
+			err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_PASSCRED, 1)
+		})
+		err = errors.Join(cerr, err)
+	}
+	if err != nil {
+		conn.Close()
+		os.Remove(path)
+		return nil, err
+	}
+	return conn, nil
+}
+
+// writeAsk writes the ask file of a question, atomically so that the agents
+// never read it partially written.
+func (a *Agent) writeAsk(path, socket, msg string) error {
+	var notAfter int64
+	if a.Timeout > 0 {
+		var ts unix.Timespec
+		if err := unix.ClockGettime(unix.CLOCK_MONOTONIC, &ts); err != nil {
+			return err
+		}
+		notAfter = (time.Duration(ts.Nano()) + a.Timeout).Microseconds()
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), "tmp.")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = fmt.Fprintf(f, "[Ask]\nPID=%d\nSocket=%s\nAcceptCached=%d\nEcho=0\nNotAfter=%d\nMessage=%s\n",
+		os.Getpid(), socket, btoi(a.AcceptCached), notAfter, escape(msg))
+	if err == nil && a.Icon != "" {
+		_, err = fmt.Fprintf(f, "Icon=%s\n", escape(a.Icon))
+	}
+	if err == nil && a.ID != "" {
+		_, err = fmt.Fprintf(f, "Id=%s\n", escape(a.ID))
+	}
+	if err == nil {
+		err = f.Chmod(0o644)
+	}
+	if err = errors.Join(err, f.Close()); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// receive waits for a valid response, ignoring those of the other users.
+func receive(conn *net.UnixConn) (string, error) {
+	buf := make([]byte, 64*1024)
+	oob := make([]byte, unix.CmsgSpace(unix.SizeofUcred))
+	for {
+		n, oobn, _, _, err := conn.ReadMsgUnix(buf, oob)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return "", termconv.ErrTimeout
+		}
+		if err != nil {
+			return "", err
+		}
+		if !trusted(oob[:oobn]) || n == 0 {
+			continue
+		}
+		switch buf[0] {
+		case '+':
+			return string(buf[1:n]), nil
+		case '-':
+			return "", ErrCanceled
+		}
+	}
+}
+
+// trusted returns whether the control messages of a response hold the
+// credentials of root or of the user of the process.
+func trusted(oob []byte) bool {
+	msgs, err := unix.ParseSocketControlMessage(oob)
+	if err != nil {
+		return false
+	}
+	for _, m := range msgs {
+		cred, err := unix.ParseUnixCredentials(&m)
+		if err != nil {
+			continue
+		}
+		return cred.Uid == 0 || int(cred.Uid) == os.Getuid()
+	}
+	return false
+}
+
+// escape escapes the backslashes and the line ends of an ask file value.
+func escape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,85 @@
+package askpass
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/termconv"
+)
+
+// agent answers the first question asked in dir with the response, once,
+// returning its ask file keys.
+func agent(t *testing.T, dir, response string) <-chan map[string]string {
+	t.Helper()
+	ch := make(chan map[string]string, 1)
+	go func() {
+		defer close(ch)
+		for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+			asks, _ := filepath.Glob(filepath.Join(dir, "ask.*"))
+			if len(asks) == 0 {
+				continue
+			}
+			f, err := os.Open(asks[0])
+			if err != nil {
+				return
+			}
+			keys := map[string]string{}
+			for s := bufio.NewScanner(f); s.Scan(); {
+				if k, v, ok := strings.Cut(s.Text(), "="); ok {
+					keys[k] = v
+				}
+			}
+			f.Close()
+			conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: keys["Socket"], Net: "unixgram"})
+			if err != nil {
+				return
+			}
+			conn.Write([]byte(response))
+			conn.Close()
+			ch <- keys
+			return
+		}
+	}()
+	return ch
+}
+
+func TestAgent(t *testing.T) {
+	dir := t.TempDir()
+	a := &Agent{Dir: dir, ID: "test:agent", Timeout: 5 * time.Second, Fallback: prompts}
+	keys := agent(t, dir, "+secret")
+	if resp, err := a.RespondPAM(pam.PromptEchoOff, "Password for\nalice:"); err != nil || resp != "secret" {
+		t.Fatalf("respond #error: unexpected response %q, %v", resp, err)
+	}
+	k := <-keys
+	if k["Message"] != `Password for\nalice:` || k["Id"] != "test:agent" || k["Echo"] != "0" || k["NotAfter"] == "0" {
+		t.Fatalf("ask #error: unexpected keys %v", k)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Fatalf("respond #error: unexpected leftovers %v", entries)
+	}
+
+	agent(t, dir, "-")
+	if _, err := a.RespondPAM(pam.PromptEchoOff, "Password:"); !errors.Is(err, ErrCanceled) {
+		t.Fatalf("respond #error: expected %v, got %v", ErrCanceled, err)
+	}
+
+	a.Timeout = 50 * time.Millisecond
+	if _, err := a.RespondPAM(pam.PromptEchoOff, "Password:"); !errors.Is(err, termconv.ErrTimeout) {
+		t.Fatalf("respond #error: expected %v, got %v", termconv.ErrTimeout, err)
+	}
+
+	if resp, err := a.RespondPAM(pam.TextInfo, "Welcome"); err != nil || resp != "fallback PAM_TEXT_INFO" {
+		t.Fatalf("respond #error: unexpected response %q, %v", resp, err)
+	}
+	a.Dir = filepath.Join(dir, "missing")
+	if resp, err := a.RespondPAM(pam.PromptEchoOff, "Password:"); err != nil || resp != "fallback PAM_PROMPT_ECHO_OFF" {
+		t.Fatalf("respond #error: unexpected response %q, %v", resp, err)
+	}
+}
@@ -0,0 +1,86 @@
+// Package askpass provides the conversation handlers asking for the hidden
+// responses through the password agents of the system rather than through
+// a terminal, for the services that have none, such as the mount helpers
+// and the VPN daemons opening sessions at boot.
+//
+// Agent asks the agents of systemd on Linux, as systemd-ask-password does,
+// and Program runs an external program, as the SSH_ASKPASS one of OpenSSH.
+// Both only answer the PromptEchoOff messages, passing the others and the
+// prompts they cannot ask to a fallback handler, a terminal by default.
+package askpass
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/termconv"
+)
+
+// ErrCanceled is returned when the user cancels a prompt.
+var ErrCanceled = errors.New("canceled by the user")
+
+// ProgramEnv is the environment variable holding the default program of
+// a Program.
+const ProgramEnv = "SSH_ASKPASS"
+
+// Program is a conversation handler running an SSH_ASKPASS-style program
+// for the PromptEchoOff messages: the program gets the message as its
+// argument and writes the response on its standard output, failing if the
+// user cancels the prompt.
+type Program struct {
+	// Path is the program, the value of ProgramEnv if empty. The
+	// prompts are passed to Fallback if neither is set.
+	Path string
+	// Timeout is the maximum time waited for the program, none if 0.
+	// The prompts timing out fail with termconv.ErrTimeout.
+	Timeout time.Duration
+	// Fallback handles the other messages, a termconv.Handler if nil.
+	Fallback pam.ConversationHandler
+}
+
+// RespondPAM runs the program for the PromptEchoOff messages.
+func (p *Program) RespondPAM(s pam.Style, msg string) (string, error) {
+	path := p.Path
+	if path == "" {
+		path = os.Getenv(ProgramEnv)
+	}
+	if s != pam.PromptEchoOff || path == "" {
+		return fallback(p.Fallback).RespondPAM(s, msg)
+	}
+	ctx := context.Background()
+	if p.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.Timeout)
+		defer cancel()
+	}
+	var out bytes.Buffer
+	cmd := exec.CommandContext(ctx, path, msg)
+	cmd.Stdout = &out
+	cmd.Stderr = os.Stderr
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return "", termconv.ErrTimeout
+	}
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return "", ErrCanceled
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(out.String(), "\n"), "\r"), nil
+}
+
+// fallback returns h, or a terminal handler if nil.
+func fallback(h pam.ConversationHandler) pam.ConversationHandler {
+	if h == nil {
+		return &termconv.Handler{}
+	}
+	return h
+}
@@ -0,0 +1,60 @@
+package askpass
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/termconv"
+)
+
+// script writes an executable shell script.
+func script(t *testing.T, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "askpass")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755); err != nil {
+		t.Fatalf("write #error: %v", err)
+	}
+	return path
+}
+
+// prompts answers all the prompts with the style.
+var prompts = pam.ConversationFunc(func(s pam.Style, msg string) (string, error) {
+	return "fallback " + s.String(), nil
+})
+
+func TestProgram(t *testing.T) {
+	if _, err := os.Stat("/bin/sh"); err != nil {
+		t.Skip("/bin/sh is not available")
+	}
+	p := &Program{Path: script(t, `echo "secret for $1"`), Fallback: prompts}
+	if resp, err := p.RespondPAM(pam.PromptEchoOff, "Password:"); err != nil || resp != "secret for Password:" {
+		t.Fatalf("respond #error: unexpected response %q, %v", resp, err)
+	}
+	if resp, err := p.RespondPAM(pam.PromptEchoOn, "login:"); err != nil || resp != "fallback PAM_PROMPT_ECHO_ON" {
+		t.Fatalf("respond #error: unexpected response %q, %v", resp, err)
+	}
+
+	p.Path = script(t, "exit 1")
+	if _, err := p.RespondPAM(pam.PromptEchoOff, "Password:"); !errors.Is(err, ErrCanceled) {
+		t.Fatalf("respond #error: expected %v, got %v", ErrCanceled, err)
+	}
+
+	p.Path, p.Timeout = script(t, "exec sleep 5"), 50*time.Millisecond
+	if _, err := p.RespondPAM(pam.PromptEchoOff, "Password:"); !errors.Is(err, termconv.ErrTimeout) {
+		t.Fatalf("respond #error: expected %v, got %v", termconv.ErrTimeout, err)
+	}
+
+	t.Setenv(ProgramEnv, script(t, "echo env"))
+	p.Path, p.Timeout = "", 0
+	if resp, err := p.RespondPAM(pam.PromptEchoOff, "Password:"); err != nil || resp != "env" {
+		t.Fatalf("respond #error: unexpected response %q, %v", resp, err)
+	}
+	t.Setenv(ProgramEnv, "")
+	if resp, err := p.RespondPAM(pam.PromptEchoOff, "Password:"); err != nil || resp != "fallback PAM_PROMPT_ECHO_OFF" {
+		t.Fatalf("respond #error: unexpected response %q, %v", resp, err)
+	}
+}
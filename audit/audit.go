@@ -0,0 +1,172 @@
+// Package audit records the events of the PAM transactions as structured
+// audit records, written to pluggable sinks such as files, the systemd
+// journal or the Linux audit system.
+//
+// A Logger observes the transactions once enabled:
+//
+//	f, err := audit.OpenFile("/var/log/broker/pam.jsonl")
+//	if err != nil {
+//		return err
+//	}
+//	audit.Enable(audit.NewLogger(f, audit.NewJournal()))
+//
+// The records have a stable schema, identified by their Version.
+package audit
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// Version is the version of the schema of the records. It only changes when
+// existing fields change meaning or are removed.
+const Version = 1
+
+// Record is an audit record of a PAM transaction event.
+type Record struct {
+	// Version is the version of the schema of the record.
+	Version int `json:"version"`
+	// Time is when the PAM call started.
+	Time time.Time `json:"time"`
+	// Event is the kind of event: call_start, start, operation,
+	// conversation_start, conversation, item, call or end.
+	Event string `json:"event"`
+	// Service is the name of the PAM service.
+	Service string `json:"service"`
+	// User is the user of the transaction, if known.
+	User string `json:"user,omitempty"`
+	// Operation is the name of the PAM call, such as authenticate or
+	// open_session.
+	Operation string `json:"operation"`
+	// Flags are the flags of the operation, if any.
+	Flags string `json:"flags,omitempty"`
+	// Item is the name of the item set or retrieved, such as PAM_RHOST,
+	// for the set_item and get_item calls.
+	Item string `json:"item,omitempty"`
+	// Result is success or failure.
+	Result string `json:"result"`
+	// Status is the name of the PAM status of the call, such as
+	// PAM_AUTH_ERR.
+	Status string `json:"status"`
+	// DurationUsec is the duration of the call, in microseconds.
+	DurationUsec int64 `json:"duration_usec"`
+	// Messages are the messages of the conversations, if enabled.
+	Messages []Message `json:"messages,omitempty"`
+}
+
+// Message is a message of a conversation.
+type Message struct {
+	// Style is the name of the style of the message.
+	Style string `json:"style"`
+	// Text is the message, empty for binary prompts.
+	Text string `json:"text,omitempty"`
+}
+
+var eventNames = map[pam.EventKind]string{
+	pam.EventStart:             "start",
+	pam.EventOperation:         "operation",
+	pam.EventConversation:      "conversation",
+	pam.EventEnd:               "end",
+	pam.EventItem:              "item",
+	pam.EventConversationStart: "conversation_start",
+	pam.EventCallStart:         "call_start",
+	pam.EventCall:              "call",
+}
+
+// NewRecord returns the record of an event. The messages of the
+// conversations are only included if messages is set, as they may contain
+// personal data.
+func NewRecord(e pam.Event, messages bool) Record {
+	r := Record{
+		Version:      Version,
+		Time:         e.Time,
+		Event:        eventNames[e.Kind],
+		Service:      e.Service,
+		User:         e.User,
+		Operation:    e.Operation,
+		Result:       "success",
+		Status:       e.Status.String(),
+		DurationUsec: e.Duration.Microseconds(),
+	}
+	if e.Flags != 0 {
+		r.Flags = e.Flags.String()
+	}
+	if e.Operation == "set_item" || e.Operation == "get_item" {
+		r.Item = e.Item.String()
+	}
+	if e.Status != pam.Success {
+		r.Result = "failure"
+	}
+	if messages {
+		for _, m := range e.Messages {
+			r.Messages = append(r.Messages, Message{m.Style.String(), m.Message})
+		}
+	}
+	return r
+}
+
+// Sink writes the audit records. Sinks are used by multiple goroutines at
+// the same time.
+type Sink interface {
+	Write(Record) error
+}
+
+// Logger is a pam.Observer writing the records of the events to its sinks.
+type Logger struct {
+	sinks []Sink
+	// Messages includes the messages of the conversations in the
+	// records.
+	Messages bool
+	// Errors, if not nil, is called with the failures of the sinks, which
+	// are otherwise ignored, as they must not fail the transactions.
+	Errors func(error)
+}
+
+// NewLogger returns a logger writing to the sinks.
+func NewLogger(sinks ...Sink) *Logger {
+	return &Logger{sinks: sinks}
+}
+
+// Observe writes the record of the event to all the sinks.
+func (l *Logger) Observe(e pam.Event) {
+	r := NewRecord(e, l.Messages)
+	var errs []error
+	for _, s := range l.sinks {
+		errs = append(errs, s.Write(r))
+	}
+	if err := errors.Join(errs...); err != nil && l.Errors != nil {
+		l.Errors(err)
+	}
+}
+
+// enabled is the subscription of the logger enabled, if any.
+var enabled struct {
+	mu          sync.Mutex
+	unsubscribe func()
+}
+
+// Enable subscribes the logger to the events of the PAM transactions,
+// replacing the one enabled before, if any. The other observers, such as
+// the metrics collectors, keep observing them.
+func Enable(l *Logger) {
+	enabled.mu.Lock()
+	defer enabled.mu.Unlock()
+	if enabled.unsubscribe != nil {
+		enabled.unsubscribe()
+	}
+	enabled.unsubscribe = pam.Subscribe(l)
+}
+
+// Disable stops observing the PAM transactions with the logger enabled,
+// leaving the other observers.
+func Disable() {
+	enabled.mu.Lock()
+	defer enabled.mu.Unlock()
+	if enabled.unsubscribe != nil {
+		enabled.unsubscribe()
+		enabled.unsubscribe = nil
+	}
+}
@@ -0,0 +1,102 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+var testEvent = pam.Event{
+	Kind:      pam.EventOperation,
+	Time:      time.Unix(0, 0).UTC(),
+	Duration:  1500 * time.Microsecond,
+	Service:   "login",
+	User:      "user",
+	Operation: "authenticate",
+	Flags:     pam.Silent,
+	Status:    pam.ErrAuth,
+	Messages:  []pam.ConversationMessage{{Style: pam.PromptEchoOff, Message: "Password: "}},
+}
+
+func TestNewRecord(t *testing.T) {
+	expected := Record{
+		Version:      Version,
+		Time:         testEvent.Time,
+		Event:        "operation",
+		Service:      "login",
+		User:         "user",
+		Operation:    "authenticate",
+		Flags:        "Silent",
+		Result:       "failure",
+		Status:       "PAM_AUTH_ERR",
+		DurationUsec: 1500,
+	}
+	if r := NewRecord(testEvent, false); !reflect.DeepEqual(r, expected) {
+		t.Fatalf("newrecord #error: expected %+v, got %+v", expected, r)
+	}
+	expected.Messages = []Message{{"PAM_PROMPT_ECHO_OFF", "Password: "}}
+	if r := NewRecord(testEvent, true); !reflect.DeepEqual(r, expected) {
+		t.Fatalf("newrecord #error: expected %+v, got %+v", expected, r)
+	}
+}
+
+type failingSink struct{}
+
+func (failingSink) Write(Record) error {
+	return errors.New("failure")
+}
+
+func TestLogger(t *testing.T) {
+	var b bytes.Buffer
+	l := NewLogger(NewFile(&b), failingSink{})
+	var failed error
+	l.Errors = func(err error) { failed = err }
+	l.Observe(testEvent)
+	if failed == nil {
+		t.Fatalf("observe #expected an error")
+	}
+	var r Record
+	if err := json.Unmarshal(b.Bytes(), &r); err != nil {
+		t.Fatalf("unmarshal #error: %v", err)
+	}
+	if expected := NewRecord(testEvent, false); !reflect.DeepEqual(r, expected) {
+		t.Fatalf("observe #error: expected %+v, got %+v", expected, r)
+	}
+}
+
+func TestEnable(t *testing.T) {
+	if !pam.CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	var starts int
+	pam.SetObserver(pam.ObserverFunc(func(e pam.Event) {
+		if e.Kind == pam.EventStart {
+			starts++
+		}
+	}))
+	defer pam.SetObserver(nil)
+	var b bytes.Buffer
+	Enable(NewLogger(NewFile(&b)))
+	start := func() {
+		tx, err := pam.StartConfDir("permit-service", "", nil, "../test-services")
+		if err != nil {
+			t.Fatalf("start #error: %v", err)
+		}
+		tx.End(0)
+	}
+	start()
+	if starts != 1 || b.Len() == 0 {
+		t.Fatalf("enable #error: expected both observers, got %d starts and %q", starts, b.String())
+	}
+	Disable()
+	b.Reset()
+	start()
+	if starts != 2 || b.Len() != 0 {
+		t.Fatalf("disable #error: expected only the other observer, got %d starts and %q", starts, b.String())
+	}
+}
@@ -0,0 +1,47 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"sync"
+)
+
+// File is a sink writing the records as JSON lines.
+type File struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+	c   io.Closer
+}
+
+// NewFile returns a sink writing the records to w, one JSON object per line.
+func NewFile(w io.Writer) *File {
+	return &File{enc: json.NewEncoder(w)}
+}
+
+// OpenFile returns a sink appending the records to the file at path,
+// created if needed with permissions only allowing its owner to read it.
+func OpenFile(path string) (*File, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	s := NewFile(f)
+	s.c = f
+	return s, nil
+}
+
+// Write writes the record.
+func (f *File) Write(r Record) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.enc.Encode(r)
+}
+
+// Close closes the file opened by OpenFile.
+func (f *File) Close() error {
+	if f.c == nil {
+		return nil
+	}
+	return f.c.Close()
+}
@@ -0,0 +1,84 @@
+package audit
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// journalSocket is the socket of the native protocol of systemd-journald.
+const journalSocket = "/run/systemd/journal/socket"
+
+// Journal is a sink sending the records to the systemd journal, with their
+// fields as PAM_* journal fields.
+type Journal struct {
+	path       string
+	identifier string
+}
+
+// NewJournal returns a sink sending the records to the systemd journal, with
+// the name of the program as identifier.
+func NewJournal() *Journal {
+	return &Journal{path: journalSocket, identifier: filepath.Base(os.Args[0])}
+}
+
+// Write sends the record to the journal.
+func (j *Journal) Write(r Record) error {
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: j.path, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(journalEntry(r, j.identifier))
+	return err
+}
+
+// journalEntry returns the journal entry of the record, in the format of
+// the native protocol.
+func journalEntry(r Record, identifier string) []byte {
+	priority := "6"
+	if r.Result != "success" {
+		priority = "5"
+	}
+	msg := fmt.Sprintf("pam %s %s", r.Operation, r.Result)
+	if r.User != "" {
+		msg = fmt.Sprintf("pam %s %s for %s", r.Operation, r.Result, r.User)
+	}
+	fields := [][2]string{
+		{"MESSAGE", fmt.Sprintf("%s (service=%s status=%s)", msg, r.Service, r.Status)},
+		{"PRIORITY", priority},
+		{"SYSLOG_IDENTIFIER", identifier},
+		{"PAM_VERSION", strconv.Itoa(r.Version)},
+		{"PAM_EVENT", r.Event},
+		{"PAM_SERVICE", r.Service},
+		{"PAM_USER", r.User},
+		{"PAM_OPERATION", r.Operation},
+		{"PAM_FLAGS", r.Flags},
+		{"PAM_RESULT", r.Result},
+		{"PAM_STATUS", r.Status},
+		{"PAM_DURATION_USEC", strconv.FormatInt(r.DurationUsec, 10)},
+	}
+	for _, m := range r.Messages {
+		fields = append(fields, [2]string{"PAM_MESSAGE", m.Style + ": " + m.Text})
+	}
+	var b bytes.Buffer
+	for _, f := range fields {
+		if f[1] == "" {
+			continue
+		}
+		if !strings.Contains(f[1], "\n") {
+			fmt.Fprintf(&b, "%s=%s\n", f[0], f[1])
+			continue
+		}
+		// Values with newlines are sent with their size.
+		b.WriteString(f[0] + "\n")
+		binary.Write(&b, binary.LittleEndian, uint64(len(f[1])))
+		b.WriteString(f[1] + "\n")
+	}
+	return b.Bytes()
+}
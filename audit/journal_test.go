@@ -0,0 +1,41 @@
+package audit
+
+import (
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestJournal(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listen #error: %v", err)
+	}
+	defer conn.Close()
+	j := &Journal{path: path, identifier: "test"}
+	r := NewRecord(testEvent, true)
+	r.Messages[0].Text = "multi\nline"
+	if err := j.Write(r); err != nil {
+		t.Fatalf("write #error: %v", err)
+	}
+	buf := make([]byte, 4096)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatalf("read #error: %v", err)
+	}
+	entry := string(buf[:n])
+	for _, field := range []string{
+		"MESSAGE=pam authenticate failure for user (service=login status=PAM_AUTH_ERR)\n",
+		"PRIORITY=5\n",
+		"SYSLOG_IDENTIFIER=test\n",
+		"PAM_USER=user\n",
+		"PAM_DURATION_USEC=1500\n",
+		"PAM_MESSAGE\n\x1f\x00\x00\x00\x00\x00\x00\x00PAM_PROMPT_ECHO_OFF: multi\nline\n",
+	} {
+		if !strings.Contains(entry, field) {
+			t.Fatalf("write #error: %q not found in %q", field, entry)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+//go:build linux
+
+package audit
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// The Linux audit message types of the PAM operations.
+const (
+	auditUserAuth      = 1100
+	auditUserAcct      = 1101
+	auditCredAcq       = 1103
+	auditCredDisp      = 1104
+	auditUserStart     = 1105
+	auditUserEnd       = 1106
+	auditUserChauthtok = 1108
+	auditCredRefr      = 1110
+)
+
+// LinuxAudit is a sink sending the records of the operations to the Linux
+// audit system, as libpam does, which requires the CAP_AUDIT_WRITE
+// capability. The other records are ignored.
+type LinuxAudit struct {
+	mu  sync.Mutex
+	fd  int
+	seq uint32
+	exe string
+}
+
+// NewLinuxAudit opens the audit netlink socket.
+func NewLinuxAudit() (*LinuxAudit, error) {
+	fd, err := syscall.Socket(syscall.AF_NETLINK, syscall.SOCK_RAW|syscall.SOCK_CLOEXEC, syscall.NETLINK_AUDIT)
+	if err != nil {
+		return nil, fmt.Errorf("audit socket: %w", err)
+	}
+	exe, _ := os.Executable()
+	return &LinuxAudit{fd: fd, exe: exe}, nil
+}
+
+// Write sends the record, if it is the one of an operation.
+func (a *LinuxAudit) Write(r Record) error {
+	typ, op := auditMessageType(r)
+	if typ == 0 {
+		return nil
+	}
+	msg := auditMessage(r, op, a.exe)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.seq++
+	b := make([]byte, syscall.NLMSG_HDRLEN, syscall.NLMSG_HDRLEN+len(msg)+1)
+	binary.NativeEndian.PutUint32(b[0:], uint32(cap(b)))
+	binary.NativeEndian.PutUint16(b[4:], typ)
+	binary.NativeEndian.PutUint16(b[6:], syscall.NLM_F_REQUEST)
+	binary.NativeEndian.PutUint32(b[8:], a.seq)
+	b = append(append(b, msg...), 0)
+	return syscall.Sendto(a.fd, b, 0, &syscall.SockaddrNetlink{Family: syscall.AF_NETLINK})
+}
+
+// Close closes the audit socket.
+func (a *LinuxAudit) Close() error {
+	return syscall.Close(a.fd)
+}
+
+// auditMessageType returns the message type and the libpam operation name
+// of the record, or 0 if it is not the one of an operation.
+func auditMessageType(r Record) (uint16, string) {
+	if r.Event != "operation" {
+		return 0, ""
+	}
+	switch r.Operation {
+	case "authenticate":
+		return auditUserAuth, "PAM:authentication"
+	case "acct_mgmt":
+		return auditUserAcct, "PAM:accounting"
+	case "chauthtok":
+		return auditUserChauthtok, "PAM:chauthtok"
+	case "open_session":
+		return auditUserStart, "PAM:session_open"
+	case "close_session":
+		return auditUserEnd, "PAM:session_close"
+	case "setcred":
+		switch {
+		case strings.Contains(r.Flags, "DeleteCred"):
+			return auditCredDisp, "PAM:setcred"
+		case strings.Contains(r.Flags, "ReinitializeCred"), strings.Contains(r.Flags, "RefreshCred"):
+			return auditCredRefr, "PAM:setcred"
+		}
+		return auditCredAcq, "PAM:setcred"
+	}
+	return 0, ""
+}
+
+// auditMessage returns the text of the audit message of the record.
+func auditMessage(r Record, op, exe string) string {
+	acct := "?"
+	if r.User != "" {
+		acct = auditValue(r.User)
+	}
+	return fmt.Sprintf("op=%s grantors=? acct=%s exe=%s hostname=? addr=? terminal=? res=%s",
+		op, acct, auditValue(exe), r.Result)
+}
+
+// auditValue encodes an untrusted value as the audit system does: quoted,
+// or hex encoded if it contains spaces, quotes or control characters.
+func auditValue(s string) string {
+	for _, c := range []byte(s) {
+		if c <= ' ' || c == '"' || c >= 0x7f {
+			return strings.ToUpper(hex.EncodeToString([]byte(s)))
+		}
+	}
+	return `"` + s + `"`
+}
@@ -0,0 +1,29 @@
+//go:build linux
+
+package audit
+
+import "testing"
+
+func TestAuditMessage(t *testing.T) {
+	r := NewRecord(testEvent, false)
+	typ, op := auditMessageType(r)
+	if typ != auditUserAuth || op != "PAM:authentication" {
+		t.Fatalf("auditmessagetype #error: got %d, %q", typ, op)
+	}
+	expected := `op=PAM:authentication grantors=? acct="user" exe="/usr/bin/broker" hostname=? addr=? terminal=? res=failure`
+	if msg := auditMessage(r, op, "/usr/bin/broker"); msg != expected {
+		t.Fatalf("auditmessage #error: expected %q, got %q", expected, msg)
+	}
+	if v := auditValue("a user"); v != "612075736572" {
+		t.Fatalf("auditvalue #error: got %q", v)
+	}
+
+	r.Event = "start"
+	if typ, _ := auditMessageType(r); typ != 0 {
+		t.Fatalf("auditmessagetype #error: expected no message for start, got %d", typ)
+	}
+	r.Event, r.Operation, r.Flags = "operation", "setcred", "DeleteCred"
+	if typ, _ := auditMessageType(r); typ != auditCredDisp {
+		t.Fatalf("auditmessagetype #error: expected %d, got %d", auditCredDisp, typ)
+	}
+}
@@ -0,0 +1,229 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// RetryPolicy defines how an Authenticator retries the failed
+// authentications.
+type RetryPolicy struct {
+	// Attempts is the maximum number of authentication attempts, 1 if
+	// not set.
+	Attempts int
+	// Delay is the time waited before each new attempt.
+	Delay time.Duration
+	// Retry returns whether an attempt failing with err may be attempted
+	// again. If nil, the attempts failing with ErrAuth or a transient
+	// error are.
+	Retry func(err error) bool
+}
+
+func (p RetryPolicy) retry(err error) bool {
+	if p.Retry != nil {
+		return p.Retry(err)
+	}
+	return errors.Is(err, ErrAuth) || IsTransient(err)
+}
+
+// Authenticator authenticates the users with a PAM service, managing the
+// transactions: it starts them, authenticates and validates the accounts,
+// changing the expired authentication tokens if allowed, and closes them on
+// failure. It covers the common needs of the applications, which can still
+// use the transactions of the logins for the other calls.
+//
+// An Authenticator can be used by multiple goroutines at the same time, as
+// long as its handler can.
+type Authenticator struct {
+	// Service is the name of the PAM service.
+	Service string
+	// ConfDir is the directory of the PAM services, if not the system
+	// one. It requires pam_start_confdir, see StartConfDir.
+	ConfDir string
+	// Handler is the conversation handler of the transactions.
+	Handler ConversationHandler
+	// Flags are the flags of the authentication and of the account
+	// validation, such as Silent. Only Silent is kept for the
+	// authentication token change and the session of the login.
+	Flags Flags
+	// ChangeExpiredAuthtok allows changing the expired authentication
+	// tokens when the account validation requires it. Otherwise, the
+	// authentication fails with the error of the account validation.
+	ChangeExpiredAuthtok bool
+	// Retry is the policy of the failed authentications, which are
+	// attempted again in the same transaction.
+	Retry RetryPolicy
+	// Timeout is the maximum duration of each attempt, if not 0.
+	Timeout time.Duration
+	// Setup, if not nil, is called once a transaction is started, for
+	// example to set its items. The transaction is closed if it fails.
+	Setup func(ctx context.Context, tx *Transaction) error
+	// Failed, if not nil, is called for each failed attempt, with its
+	// number starting from 1, for example to log it.
+	Failed func(ctx context.Context, attempt int, err error)
+}
+
+// Login is a user authenticated by an Authenticator, which owns its
+// transaction until it is closed.
+type Login struct {
+	tx *Transaction
+	// flags are the flags of the credentials and session calls.
+	flags Flags
+	// session is the session opened by OpenSession, if any.
+	session *Session
+}
+
+// Authenticate starts a transaction for user and authenticates them, then
+// validates their account. If user is empty, the PAM stack asks for it.
+//
+// PAM calls can't be interrupted: once ctx is done, the conversations fail,
+// including those whose handlers are blocked waiting for the user, and so do
+// the operations asking for them, see AuthenticateContext.
+func (a *Authenticator) Authenticate(ctx context.Context, user string) (*Login, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var tx *Transaction
+	var err error
+	if a.ConfDir != "" {
+		tx, err = StartConfDir(a.Service, user, a.Handler, a.ConfDir)
+	} else {
+		tx, err = Start(a.Service, user, a.Handler)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if a.Setup != nil {
+		if err := a.Setup(ctx, tx); err != nil {
+			tx.Close()
+			return nil, err
+		}
+	}
+	for attempt := 1; ; attempt++ {
+		err = a.attempt(ctx, tx)
+		if err == nil {
+			return &Login{tx: tx, flags: a.Flags & Silent}, nil
+		}
+		if a.Failed != nil {
+			a.Failed(ctx, attempt, err)
+		}
+		if attempt >= a.Retry.Attempts || !a.Retry.retry(err) || ctx.Err() != nil {
+			break
+		}
+		if err = sleep(ctx, a.Retry.Delay); err != nil {
+			break
+		}
+	}
+	tx.Close()
+	return nil, err
+}
+
+// attempt authenticates the user of the transaction and validates the
+// account.
+func (a *Authenticator) attempt(ctx context.Context, tx *Transaction) error {
+	if a.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, a.Timeout)
+		defer cancel()
+	}
+	defer tx.setContext(ctx)()
+	return authenticate(tx, a.Flags, a.ChangeExpiredAuthtok, func(_ RunStep, err error) error {
+		// Optional modules may have recovered from failed
+		// conversations.
+		if err == nil {
+			err = ctx.Err()
+		}
+		return err
+	})
+}
+
+// authenticate authenticates the user of the transaction and validates
+// their account, changing the authentication token if the account
+// validation requires it and changeExpired is set. after is called with the
+// result of each step, and returns the error failing it.
+func authenticate(tx *Transaction, f Flags, changeExpired bool, after func(RunStep, error) error) error {
+	if err := after(StepAuthenticate, tx.Authenticate(f)); err != nil {
+		return err
+	}
+	err := tx.AcctMgmt(f)
+	if !ShouldChangeAuthTok(err) || !changeExpired {
+		return after(StepAcctMgmt, err)
+	}
+	if err := after(StepAcctMgmt, nil); err != nil {
+		return err
+	}
+	return after(StepChangeAuthTok, tx.ChangeAuthTok(f&Silent|ChangeExpiredAuthtok))
+}
+
+// sleep waits for d, unless ctx is done before.
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// setContext sets the context of the operations of the transaction until
+// the returned function is called: their conversations fail once it is
+// done, and it carries the labels of the profiling hooks.
+func (t *Transaction) setContext(ctx context.Context) (restore func()) {
+	prev, labels := t.conversation.ctx, t.labels
+	t.conversation.ctx, t.labels = ctx, ctx
+	return func() {
+		t.conversation.ctx, t.labels = prev, labels
+	}
+}
+
+// Transaction returns the transaction of the login.
+func (l *Login) Transaction() *Transaction {
+	return l.tx
+}
+
+// User returns the name of the authenticated user, as modules may have
+// changed the one given to Authenticate.
+func (l *Login) User() (string, error) {
+	return l.tx.GetItem(User)
+}
+
+// OpenSession establishes the credentials of the user and opens a session,
+// then reinitializes the credentials, as Transaction.StartSession does.
+// Both are released by Close.
+func (l *Login) OpenSession(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	defer l.tx.setContext(ctx)()
+	return l.openSession(func(_ RunStep, err error) error { return err })
+}
+
+// openSession starts the session of the login, calling after with the
+// result of each step, which returns the error failing it.
+func (l *Login) openSession(after func(RunStep, error) error) (err error) {
+	l.session, err = l.tx.startSession(l.flags, after)
+	return err
+}
+
+// release closes the session and deletes the credentials, if established
+// by OpenSession, leaving the transaction open. Its errors are joined.
+func (l *Login) release() error {
+	s := l.session
+	if s == nil {
+		return nil
+	}
+	l.session = nil
+	return s.Close()
+}
+
+// Close closes the session and deletes the credentials, if established by
+// OpenSession, then closes the transaction. Its errors are joined.
+func (l *Login) Close() error {
+	return errors.Join(l.release(), l.tx.Close())
+}
@@ -0,0 +1,96 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"os/user"
+	"testing"
+)
+
+func testAuthenticator(t *testing.T, service string, handler ConversationHandler) *Authenticator {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	return &Authenticator{
+		Service: service,
+		ConfDir: "test-services",
+		Handler: handler,
+	}
+}
+
+func TestAuthenticator(t *testing.T) {
+	a := testAuthenticator(t, "login-service", Credentials{})
+	var setup bool
+	a.Setup = func(ctx context.Context, tx *Transaction) error {
+		setup = true
+		return tx.SetItem(Tty, "tty1")
+	}
+	u, _ := user.Current()
+	login, err := a.Authenticate(context.Background(), u.Username)
+	if err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if !setup {
+		t.Fatalf("authenticate #error: setup not called")
+	}
+	if name, err := login.User(); err != nil || name != u.Username {
+		t.Fatalf("user #error: expected %v, got %v (%v)", u.Username, name, err)
+	}
+	if tty, _ := login.Transaction().GetItem(Tty); tty != "tty1" {
+		t.Fatalf("getitem #error: expected tty1, got %v", tty)
+	}
+	if err := login.OpenSession(context.Background()); err != nil {
+		t.Fatalf("opensession #error: %v", err)
+	}
+	if err := login.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+	if err := login.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+}
+
+func TestAuthenticator_Retry(t *testing.T) {
+	a := testAuthenticator(t, "deny-service", Credentials{})
+	a.Retry = RetryPolicy{Attempts: 3}
+	var attempts int
+	a.Failed = func(ctx context.Context, attempt int, err error) {
+		attempts = attempt
+	}
+	u, _ := user.Current()
+	if _, err := a.Authenticate(context.Background(), u.Username); !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrAuth, err)
+	}
+	if attempts != 3 {
+		t.Fatalf("authenticate #error: expected 3 attempts, got %d", attempts)
+	}
+
+	a.Retry.Retry = func(error) bool { return false }
+	if _, err := a.Authenticate(context.Background(), u.Username); !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrAuth, err)
+	}
+	if attempts != 1 {
+		t.Fatalf("authenticate #error: expected 1 attempt, got %d", attempts)
+	}
+}
+
+func TestAuthenticator_Context(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := testAuthenticator(t, "echo-service", ConversationFunc(func(s Style, msg string) (string, error) {
+		t.Fatalf("conversation #error: unexpected message %q", msg)
+		return "", nil
+	}))
+	a.Setup = func(context.Context, *Transaction) error {
+		cancel()
+		return nil
+	}
+	u, _ := user.Current()
+	_, err := a.Authenticate(ctx, u.Username)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("authenticate #error: expected %v, got %v", context.Canceled, err)
+	}
+
+	if _, err := a.Authenticate(ctx, u.Username); !errors.Is(err, context.Canceled) {
+		t.Fatalf("authenticate #error: expected %v, got %v", context.Canceled, err)
+	}
+}
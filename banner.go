@@ -0,0 +1,136 @@
+package pam
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultBannerSize is the default maximum size read from each banner file.
+const DefaultBannerSize = 64 * 1024
+
+// BannerOptions defines how ShowBanner reads the files.
+type BannerOptions struct {
+	// MaxSize is the maximum number of bytes read from each file,
+	// DefaultBannerSize if not set. Longer files are truncated.
+	MaxSize int64
+}
+
+// ShowBanner sends the contents of the files at paths as TextInfo messages
+// through conv, one per file, as pam_motd does with the message of the day:
+// session modules can use it with their conversation function. The
+// directories, such as /etc/motd.d, contribute their regular files, in the
+// order of their names. Missing files are skipped.
+//
+// The contents are sanitized before being sent: invalid UTF-8 sequences are
+// replaced and the control characters other than newlines and tabs, such as
+// those of terminal escape sequences, are removed.
+//
+// Nothing is read or sent if f includes Silent. The errors of the files
+// that can't be read are joined and returned once the others are sent.
+func ShowBanner(conv ConversationHandler, f Flags, opts BannerOptions, paths ...string) error {
+	if f&Silent != 0 {
+		return nil
+	}
+	maxSize := opts.MaxSize
+	if maxSize <= 0 {
+		maxSize = DefaultBannerSize
+	}
+	var errs []error
+	for _, path := range bannerFiles(paths) {
+		text, err := readBanner(path, maxSize)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if text == "" {
+			continue
+		}
+		if _, err := conv.RespondPAM(TextInfo, text); err != nil {
+			return errors.Join(append(errs, err)...)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// bannerFiles expands the directories of paths.
+func bannerFiles(paths []string) []string {
+	var files []string
+	for _, path := range paths {
+		entries, err := os.ReadDir(path)
+		if err != nil {
+			// Not a directory, or missing.
+			files = append(files, path)
+			continue
+		}
+		names := make([]string, 0, len(entries))
+		for _, e := range entries {
+			if e.Type().IsRegular() || e.Type()&fs.ModeSymlink != 0 {
+				names = append(names, e.Name())
+			}
+		}
+		slices.Sort(names)
+		for _, name := range names {
+			files = append(files, filepath.Join(path, name))
+		}
+	}
+	return files
+}
+
+// readBanner returns the sanitized contents of the file, up to maxSize
+// bytes.
+func readBanner(path string, maxSize int64) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if info, err := f.Stat(); err != nil {
+		return "", err
+	} else if !info.Mode().IsRegular() {
+		return "", nil
+	}
+	data, err := io.ReadAll(io.LimitReader(f, maxSize))
+	if err != nil {
+		return "", err
+	}
+	return sanitizeBanner(data), nil
+}
+
+// sanitizeBanner returns the text of data that is safe to show in a
+// terminal, without its trailing newlines.
+func sanitizeBanner(data []byte) string {
+	// A truncated file may end with an incomplete sequence.
+	for i := len(data) - 1; i >= 0 && i >= len(data)-utf8.UTFMax; i-- {
+		if utf8.RuneStart(data[i]) {
+			if !utf8.FullRune(data[i:]) {
+				data = data[:i]
+			}
+			break
+		}
+	}
+	var b strings.Builder
+	b.Grow(len(data))
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		data = data[size:]
+		switch {
+		case r == '\n' || r == '\t':
+			b.WriteRune(r)
+		case unicode.IsControl(r):
+		default:
+			// Invalid sequences are written as utf8.RuneError.
+			b.WriteRune(r)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
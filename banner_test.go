@@ -0,0 +1,59 @@
+package pam
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestShowBanner(t *testing.T) {
+	dir := t.TempDir()
+	write := func(name, content string) string {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			t.Fatalf("mkdir #error: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("write #error: %v", err)
+		}
+		return path
+	}
+	motd := write("motd", "Welcome\x1b[31m!\n\n")
+	write("motd.d/20-news", "News\tof the day\n")
+	write("motd.d/10-invalid", "caf\xe9\n")
+	write("motd.d/30-empty", "")
+	long := write("long", "0123456789012345678é")
+
+	var messages []string
+	conv := ConversationFunc(func(s Style, msg string) (string, error) {
+		if s != TextInfo {
+			t.Fatalf("conversation #error: unexpected style %v", s)
+		}
+		messages = append(messages, msg)
+		return "", nil
+	})
+	err := ShowBanner(conv, 0, BannerOptions{MaxSize: 20}, motd,
+		filepath.Join(dir, "missing"), filepath.Join(dir, "motd.d"), long)
+	if err != nil {
+		t.Fatalf("show #error: %v", err)
+	}
+	expected := []string{"Welcome[31m!", "caf�", "News\tof the day", "0123456789012345678"}
+	if !slices.Equal(messages, expected) {
+		t.Fatalf("show #error: expected %q, got %q", expected, messages)
+	}
+
+	messages = nil
+	if err := ShowBanner(conv, Silent, BannerOptions{}, motd); err != nil || messages != nil {
+		t.Fatalf("show #error: expected no messages when silent, got %q, %v", messages, err)
+	}
+
+	errConv := errors.New("conversation failed")
+	err = ShowBanner(ConversationFunc(func(Style, string) (string, error) {
+		return "", errConv
+	}), 0, BannerOptions{}, motd)
+	if !errors.Is(err, errConv) {
+		t.Fatalf("show #error: expected the conversation error, got %v", err)
+	}
+}
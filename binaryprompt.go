@@ -0,0 +1,66 @@
+package pam
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"unsafe"
+)
+
+// The binary prompts of Linux-PAM are opaque to libpam, but the modules and
+// applications using them follow the framing of libpamc: a 4 bytes big
+// endian length, including this 5 bytes header, a control byte telling the
+// kind of message and the data.
+
+// errMalformedBinary is returned for the binary messages whose length
+// doesn't match the framing.
+var errMalformedBinary = errors.New("malformed binary message")
+
+// NewBinaryPrompt returns a binary message of the control byte and the
+// data, framed as those of libpamc, in C memory the caller must free with
+// FreeBinaryPrompt once the conversation is over. It can be passed to the
+// RespondPAMBinary methods in tests.
+func NewBinaryPrompt(control byte, data []byte) (BinaryPointer, error) {
+	if uint64(len(data)) > math.MaxUint32-5 {
+		return nil, fmt.Errorf("binary message of %d bytes too long", len(data))
+	}
+	msg := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(msg, uint32(5+len(data)))
+	msg[4] = control
+	msg = append(msg, data...)
+	defer clear(msg)
+	return BinaryPointer(cBytes(msg)), nil
+}
+
+// FreeBinaryPrompt wipes and frees a binary message returned by
+// NewBinaryPrompt.
+func FreeBinaryPrompt(ptr BinaryPointer) {
+	if ptr == nil {
+		return
+	}
+	freeSecretBytes(unsafe.Pointer(ptr), int(binaryPromptSize(ptr)))
+}
+
+// binaryPromptSize returns the length of the binary message ptr points to,
+// as read from its header.
+func binaryPromptSize(ptr BinaryPointer) uint32 {
+	return binary.BigEndian.Uint32(unsafe.Slice((*byte)(ptr), 4))
+}
+
+// ParseBinaryPointer returns the control byte and a copy of the data of the
+// binary message ptr points to, framed as those of libpamc, such as the
+// prompts received by RespondPAMBinary. The message itself is left to its
+// owner.
+func ParseBinaryPointer(ptr BinaryPointer) (control byte, data []byte, err error) {
+	if ptr == nil {
+		return 0, nil, errMalformedBinary
+	}
+	size := binaryPromptSize(ptr)
+	if size < 5 {
+		return 0, nil, errMalformedBinary
+	}
+	msg := unsafe.Slice((*byte)(ptr), size)
+	return msg[4], bytes.Clone(msg[5:]), nil
+}
@@ -0,0 +1,46 @@
+package pam
+
+import (
+	"bytes"
+	"testing"
+	"unsafe"
+)
+
+func TestBinaryPrompt(t *testing.T) {
+	for _, data := range [][]byte{nil, {}, []byte("data\x00with\xffbytes")} {
+		ptr, err := NewBinaryPrompt(0x42, data)
+		if err != nil {
+			t.Fatalf("newbinaryprompt #error: %v", err)
+		}
+		header := unsafe.Slice((*byte)(ptr), 5)
+		if !bytes.Equal(header[:4], []byte{0, 0, 0, byte(5 + len(data))}) || header[4] != 0x42 {
+			t.Fatalf("newbinaryprompt #error: unexpected header %v", header)
+		}
+		control, parsed, err := ParseBinaryPointer(ptr)
+		FreeBinaryPrompt(ptr)
+		if err != nil || control != 0x42 || !bytes.Equal(parsed, data) {
+			t.Fatalf("parsebinarypointer #error: expected %v, got %v, %v, %v", data, control, parsed, err)
+		}
+	}
+	FreeBinaryPrompt(nil)
+
+	req, err := testChoices.EncodeRequest()
+	if err != nil {
+		t.Fatalf("encode #error: %v", err)
+	}
+	ptr, err := NewBinaryPrompt(req[4], req[5:])
+	if err != nil {
+		t.Fatalf("newbinaryprompt #error: %v", err)
+	}
+	defer FreeBinaryPrompt(ptr)
+	if l, err := DecodeChoiceRequest(ptr); err != nil || len(l.Choices) != len(testChoices.Choices) {
+		t.Fatalf("decode #error: unexpected choice list %v, %v", l, err)
+	}
+
+	short := []byte{0, 0, 0, 4, 'C'}
+	for _, ptr := range []BinaryPointer{nil, BinaryPointer(&short[0])} {
+		if _, _, err := ParseBinaryPointer(ptr); err != errMalformedBinary {
+			t.Fatalf("parsebinarypointer #error: expected %v, got %v", errMalformedBinary, err)
+		}
+	}
+}
@@ -0,0 +1,189 @@
+// Package broker runs PAM transactions in a privileged process on behalf of
+// unprivileged ones, such as the desktop agents unlocking the screen, which
+// can't read the shadow file pam_unix needs nor should link libpam.
+//
+// A Server, run by a privileged daemon, listens on a unix socket and starts
+// a transaction for each Client connection. The Transaction of the client
+// forwards the operations, and the conversations of the modules are
+// forwarded back to its handler. Access is controlled by the permissions of
+// the socket and by the services the server allows.
+//
+// The messages are JSON objects, one by line. The transactions run in the
+// server process, so the sessions they open are those of the server.
+package broker
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/codec"
+)
+
+// DefaultSocket is the default path of the socket of a Server.
+const DefaultSocket = "/run/go-pam-broker.sock"
+
+// request is sent by the clients. The first one of a connection starts its
+// transaction, and the respond ones answer the conversations with Conv, or
+// Error if the handler failed.
+type request struct {
+	Op      string                    `json:"op"`
+	Service string                    `json:"service,omitempty"`
+	User    string                    `json:"user,omitempty"`
+	Flags   pam.Flags                 `json:"flags,omitempty"`
+	Item    pam.Item                  `json:"item,omitempty"`
+	Value   string                    `json:"value,omitempty"`
+	Conv    *codec.StringConvResponse `json:"conv,omitempty"`
+	Error   *codec.Error              `json:"error,omitempty"`
+}
+
+// response is sent by the server, either as the result of a request or, if
+// Conv is set, as a conversation message of the running operation.
+type response struct {
+	Conv  *codec.StringConvRequest `json:"conv,omitempty"`
+	Value string                   `json:"value,omitempty"`
+	Env   map[string]string        `json:"env,omitempty"`
+	Error *codec.Error             `json:"error,omitempty"`
+}
+
+// ErrServiceDenied is the failure of the servers whose clients start or
+// switch to a service they don't allow. The clients get an error matching
+// pam.ErrPermDenied.
+var ErrServiceDenied = fmt.Errorf("%w: service not allowed", pam.ErrPermDenied)
+
+// Server starts the transactions of the Clients connecting to its socket.
+type Server struct {
+	// Services are the PAM services the clients can start. The clients
+	// can't start any if empty.
+	Services []string
+	// ConfDir, if not empty, is the directory of the services, as for
+	// pam.StartConfDir.
+	ConfDir string
+}
+
+// Serve serves the connections accepted by l until it is closed.
+func (s *Server) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go s.serve(conn)
+	}
+}
+
+// session is the transaction of a connection.
+type session struct {
+	dec *json.Decoder
+	enc *json.Encoder
+	tx  *pam.Transaction
+}
+
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	ss := &session{dec: json.NewDecoder(conn), enc: json.NewEncoder(conn)}
+	var req request
+	if err := ss.dec.Decode(&req); err != nil || req.Op != "start" {
+		return
+	}
+	var resp response
+	if err := s.start(ss, req.Service, req.User); err != nil {
+		resp.Error = codec.NewError(err)
+		ss.enc.Encode(&resp)
+		return
+	}
+	defer ss.tx.End(0)
+	if err := ss.enc.Encode(&resp); err != nil {
+		return
+	}
+	for {
+		var req request
+		if err := ss.dec.Decode(&req); err != nil {
+			return
+		}
+		resp := ss.handle(&req)
+		if err := ss.enc.Encode(resp); err != nil || req.Op == "end" {
+			return
+		}
+	}
+}
+
+func (s *Server) start(ss *session, service, user string) error {
+	if !slices.Contains(s.Services, service) {
+		return fmt.Errorf("%w: %q", ErrServiceDenied, service)
+	}
+	var err error
+	if s.ConfDir == "" {
+		ss.tx, err = pam.Start(service, user, ss)
+	} else {
+		ss.tx, err = pam.StartConfDir(service, user, ss, s.ConfDir)
+	}
+	return err
+}
+
+// RespondPAM forwards the conversation message to the client, waiting for
+// its response.
+func (ss *session) RespondPAM(style pam.Style, msg string) (string, error) {
+	conv := codec.NewStringConvRequest(pam.NewStringConvRequest(style, msg))
+	if err := ss.enc.Encode(&response{Conv: &conv}); err != nil {
+		return "", err
+	}
+	var req request
+	if err := ss.dec.Decode(&req); err != nil {
+		return "", err
+	}
+	switch {
+	case req.Op != "respond":
+		return "", fmt.Errorf("unexpected %q request during the conversation", req.Op)
+	case req.Error != nil:
+		return "", req.Error
+	case req.Conv == nil:
+		return "", nil
+	}
+	return req.Conv.Response, nil
+}
+
+func (ss *session) handle(req *request) *response {
+	var resp response
+	var err error
+	switch req.Op {
+	case "authenticate":
+		err = ss.tx.Authenticate(req.Flags)
+	case "setcred":
+		err = ss.tx.SetCred(req.Flags)
+	case "acct_mgmt":
+		err = ss.tx.AcctMgmt(req.Flags)
+	case "chauthtok":
+		err = ss.tx.ChangeAuthTok(req.Flags)
+	case "open_session":
+		err = ss.tx.OpenSession(req.Flags)
+	case "close_session":
+		err = ss.tx.CloseSession(req.Flags)
+	case "set_item":
+		// The clients could otherwise switch to a service not
+		// allowed.
+		if req.Item == pam.Service {
+			err = ErrServiceDenied
+			break
+		}
+		err = ss.tx.SetItem(req.Item, req.Value)
+	case "get_item":
+		resp.Value, err = ss.tx.GetItem(req.Item)
+	case "putenv":
+		err = ss.tx.PutEnv(req.Value)
+	case "getenvlist":
+		resp.Env, err = ss.tx.GetEnvList()
+	case "end":
+		err = ss.tx.End(req.Flags)
+	default:
+		err = fmt.Errorf("unknown operation %q", req.Op)
+	}
+	resp.Error = codec.NewError(err)
+	return &resp
+}
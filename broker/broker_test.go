@@ -0,0 +1,132 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"testing"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/pamtest"
+)
+
+func startServer(t *testing.T) *Client {
+	t.Helper()
+	if !pam.CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	ts := pamtest.NewTestSetup(t)
+	ts.CreateService("login", []pamtest.ServiceLine{
+		{Type: pamtest.Auth, Control: pamtest.Optional, Module: "pam_echo.so", Args: []string{"Hello"}},
+		{Type: pamtest.Auth, Control: pamtest.Required, Module: "pam_permit.so"},
+		{Type: pamtest.Account, Control: pamtest.Required, Module: "pam_permit.so"},
+		{Type: pamtest.Session, Control: pamtest.Required, Module: "pam_permit.so"},
+	})
+	ts.CreateService("deny", []pamtest.ServiceLine{
+		{Type: pamtest.Auth, Control: pamtest.Requisite, Module: "pam_deny.so"},
+	})
+	ts.CreateService("other", []pamtest.ServiceLine{
+		{Type: pamtest.Auth, Control: pamtest.Required, Module: "pam_permit.so"},
+	})
+	path := filepath.Join(t.TempDir(), "broker.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen #error: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	s := &Server{Services: []string{"login", "deny"}, ConfDir: ts.WorkDir()}
+	go s.Serve(l)
+	return &Client{Path: path}
+}
+
+func TestTransaction(t *testing.T) {
+	c := startServer(t)
+	script := pamtest.NewScript(
+		pamtest.Step{Style: pam.TextInfo, Message: pamtest.Exactly("Hello")},
+		pamtest.Step{Style: pam.PromptEchoOn, Response: "alice"},
+	)
+	tx, err := c.Start(context.Background(), "login", "", script)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	if err := tx.SetItem(pam.Tty, "tty1"); err != nil {
+		t.Fatalf("setitem #error: %v", err)
+	}
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := script.Done(); err != nil {
+		t.Fatalf("script #error: %v", err)
+	}
+	for item, expected := range map[pam.Item]string{pam.User: "alice", pam.Tty: "tty1", pam.Service: "login"} {
+		if v, err := tx.GetItem(item); err != nil || v != expected {
+			t.Fatalf("getitem #error: %v: expected %q, got %q, %v", item, expected, v, err)
+		}
+	}
+	if err := tx.SetItem(pam.Service, "other"); !errors.Is(err, pam.ErrPermDenied) {
+		t.Fatalf("setitem #error: expected %v, got %v", pam.ErrPermDenied, err)
+	}
+	if err := tx.AcctMgmt(0); err != nil {
+		t.Fatalf("acctmgmt #error: %v", err)
+	}
+	if err := tx.PutEnv("LANG=C"); err != nil {
+		t.Fatalf("putenv #error: %v", err)
+	}
+	if env, err := tx.GetEnvList(); err != nil || len(env) != 1 || env["LANG"] != "C" {
+		t.Fatalf("getenvlist #error: unexpected environment %v, %v", env, err)
+	}
+	if err := tx.OpenSession(0); err != nil {
+		t.Fatalf("opensession #error: %v", err)
+	}
+	if err := tx.CloseSession(0); err != nil {
+		t.Fatalf("closesession #error: %v", err)
+	}
+	if err := tx.End(pam.DataSilent); err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+	if err := tx.Authenticate(0); !errors.Is(err, pam.ErrTransactionEnded) {
+		t.Fatalf("authenticate #error: expected %v, got %v", pam.ErrTransactionEnded, err)
+	}
+}
+
+func TestTransaction_Errors(t *testing.T) {
+	c := startServer(t)
+	ctx := context.Background()
+	if _, err := c.Start(ctx, "other", "alice", nil); !errors.Is(err, pam.ErrPermDenied) {
+		t.Fatalf("start #error: expected %v, got %v", pam.ErrPermDenied, err)
+	}
+
+	tx, err := c.Start(ctx, "deny", "alice", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	if err := tx.Authenticate(0); !errors.Is(err, pam.ErrAuth) {
+		t.Fatalf("authenticate #error: expected %v, got %v", pam.ErrAuth, err)
+	}
+
+	script := pamtest.NewScript()
+	tx, err = c.Start(ctx, "login", "alice", script)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := tx.ConversationError(); err == nil || err != script.Err() {
+		t.Fatalf("conversation #error: expected %v, got %v", script.Err(), err)
+	}
+	if err := tx.AcctMgmt(0); err != nil || tx.ConversationError() != nil {
+		t.Fatalf("acctmgmt #error: %v, %v", err, tx.ConversationError())
+	}
+
+	if _, err := (&Client{Path: filepath.Join(t.TempDir(), "missing")}).Start(ctx, "login", "", nil); err == nil {
+		t.Fatalf("start #expected an error")
+	}
+}
@@ -0,0 +1,254 @@
+package broker
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/codec"
+)
+
+// Client starts the transactions of a Server. The zero value connects to
+// DefaultSocket.
+type Client struct {
+	// Path is the path of the socket of the server, DefaultSocket if
+	// empty.
+	Path string
+}
+
+func (c *Client) path() string {
+	if c.Path == "" {
+		return DefaultSocket
+	}
+	return c.Path
+}
+
+// Transaction is a transaction run by a Server, with the methods of
+// pam.Transaction it forwards. Its conversations are handled by the
+// handler given to Client.Start, in the client process.
+type Transaction struct {
+	mu      sync.Mutex
+	conn    net.Conn
+	enc     *json.Encoder
+	dec     *json.Decoder
+	handler pam.ConversationHandler
+	convErr error
+	ended   bool
+}
+
+// Start connects to the server and starts a transaction of the service,
+// until ctx is done. The user is asked by the stack if empty. The handler
+// handles the conversations of the transaction, and is never called
+// concurrently.
+func (c *Client) Start(ctx context.Context, service, user string, handler pam.ConversationHandler) (*Transaction, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", c.path())
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		conn.SetDeadline(time.Now())
+	})
+	defer stop()
+	t := &Transaction{
+		conn:    conn,
+		enc:     json.NewEncoder(conn),
+		dec:     json.NewDecoder(bufio.NewReader(conn)),
+		handler: handler,
+	}
+	resp, err := t.roundTrip(&request{Op: "start", Service: service, User: user})
+	if err == nil {
+		err = resp.Error.Err()
+	}
+	if err != nil {
+		conn.Close()
+		return nil, errors.Join(ctx.Err(), err)
+	}
+	return t, nil
+}
+
+// roundTrip sends req to the server, answering its conversation messages
+// until it returns the response. The connection is closed if it fails.
+func (t *Transaction) roundTrip(req *request) (*response, error) {
+	t.convErr = nil
+	if err := t.enc.Encode(req); err != nil {
+		return nil, t.fail(err)
+	}
+	for {
+		var resp response
+		if err := t.dec.Decode(&resp); err != nil {
+			return nil, t.fail(err)
+		}
+		if resp.Conv == nil {
+			return &resp, nil
+		}
+		if err := t.enc.Encode(t.respond(resp.Conv.ConvRequest())); err != nil {
+			return nil, t.fail(err)
+		}
+	}
+}
+
+// respond returns the answer of the handler to the conversation message.
+func (t *Transaction) respond(r pam.StringConvRequest) *request {
+	req := &request{Op: "respond"}
+	if t.handler == nil {
+		req.Error = codec.NewError(pam.ErrConv)
+		return req
+	}
+	resp, err := t.handler.RespondPAM(r.Style(), r.Prompt())
+	if err != nil {
+		t.convErr = err
+		req.Error = codec.NewError(err)
+		return req
+	}
+	conv := codec.NewStringConvResponse(pam.NewStringConvResponse(r.Style(), resp))
+	req.Conv = &conv
+	return req
+}
+
+// fail ends the transaction whose connection failed.
+func (t *Transaction) fail(err error) error {
+	t.ended = true
+	t.conn.Close()
+	return err
+}
+
+// call forwards the operation to the server and returns its error.
+func (t *Transaction) call(req *request) (*response, error) {
+	if !t.mu.TryLock() {
+		return nil, pam.ErrTransactionActive
+	}
+	defer t.mu.Unlock()
+	if t.ended {
+		return nil, pam.ErrTransactionEnded
+	}
+	resp, err := t.roundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	return resp, resp.Error.Err()
+}
+
+func (t *Transaction) operation(op string, f pam.Flags) error {
+	_, err := t.call(&request{Op: op, Flags: f})
+	return err
+}
+
+// Authenticate is used to authenticate the user.
+//
+// Valid flags: Silent, DisallowNullAuthtok
+func (t *Transaction) Authenticate(f pam.Flags) error {
+	return t.operation("authenticate", f)
+}
+
+// SetCred is used to establish, maintain and delete the credentials of a
+// user.
+//
+// Valid flags: EstablishCred, DeleteCred, ReinitializeCred, RefreshCred
+func (t *Transaction) SetCred(f pam.Flags) error {
+	return t.operation("setcred", f)
+}
+
+// AcctMgmt is used to determine if the user's account is valid.
+//
+// Valid flags: Silent, DisallowNullAuthtok
+func (t *Transaction) AcctMgmt(f pam.Flags) error {
+	return t.operation("acct_mgmt", f)
+}
+
+// ChangeAuthTok is used to change the authentication token.
+//
+// Valid flags: Silent, ChangeExpiredAuthtok
+func (t *Transaction) ChangeAuthTok(f pam.Flags) error {
+	return t.operation("chauthtok", f)
+}
+
+// OpenSession sets up a user session for an authenticated user, in the
+// server process.
+//
+// Valid flags: Silent
+func (t *Transaction) OpenSession(f pam.Flags) error {
+	return t.operation("open_session", f)
+}
+
+// CloseSession closes a previously opened session.
+//
+// Valid flags: Silent
+func (t *Transaction) CloseSession(f pam.Flags) error {
+	return t.operation("close_session", f)
+}
+
+// SetItem sets a PAM information item. The Service item can't be set.
+func (t *Transaction) SetItem(i pam.Item, item string) error {
+	_, err := t.call(&request{Op: "set_item", Item: i, Value: item})
+	return err
+}
+
+// GetItem retrieves a PAM information item.
+func (t *Transaction) GetItem(i pam.Item) (string, error) {
+	resp, err := t.call(&request{Op: "get_item", Item: i})
+	if err != nil {
+		return "", err
+	}
+	return resp.Value, nil
+}
+
+// PutEnv adds or changes the value of PAM environment variables.
+//
+// NAME=value will set a variable to a value.
+// NAME= will set a variable to an empty value.
+// NAME (without an "=") will delete a variable.
+func (t *Transaction) PutEnv(nameval string) error {
+	_, err := t.call(&request{Op: "putenv", Value: nameval})
+	return err
+}
+
+// GetEnvList returns a copy of the PAM environment as a map.
+func (t *Transaction) GetEnvList() (map[string]string, error) {
+	resp, err := t.call(&request{Op: "getenvlist"})
+	if err != nil {
+		return nil, err
+	}
+	if resp.Env == nil {
+		return map[string]string{}, nil
+	}
+	return resp.Env, nil
+}
+
+// ConversationError returns the failure of the handler in the last
+// operation, if any, which the server only gets as message. It must not be
+// called while an operation is running.
+func (t *Transaction) ConversationError() error {
+	return t.convErr
+}
+
+// End ends the transaction in the server, calling pam_end with the flags,
+// and closes the connection. Ending a transaction again has no effect, and
+// it returns pam.ErrTransactionActive if an operation is running.
+//
+// Valid flags: DataSilent
+func (t *Transaction) End(f pam.Flags) error {
+	if !t.mu.TryLock() {
+		return pam.ErrTransactionActive
+	}
+	defer t.mu.Unlock()
+	if t.ended {
+		return nil
+	}
+	resp, err := t.roundTrip(&request{Op: "end", Flags: f})
+	if err != nil {
+		return err
+	}
+	t.fail(nil)
+	return resp.Error.Err()
+}
+
+// Close ends the transaction, as End without flags.
+func (t *Transaction) Close() error {
+	return t.End(0)
+}
@@ -0,0 +1,144 @@
+// Package challenge is a small framework for the modules implementing
+// challenge-response flows spanning multiple conversations, such as the
+// enrollment of a token or the pairing of a device: each state of a flow is
+// a step, returning the next state, with its own timeout.
+//
+// Flows can be suspended, for example when a module returns
+// pam.ErrIncomplete to be called again later, and serialized in the data of
+// the module meanwhile, to be resumed where they stopped.
+package challenge
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// State is the name of a state of a flow.
+type State string
+
+// Done is the final state of the successful flows.
+const Done State = "done"
+
+var (
+	// ErrTimeout is returned when a flow or one of its steps took too
+	// long. It matches pam.ErrAuth.
+	ErrTimeout = fmt.Errorf("%w: challenge timed out", pam.ErrAuth)
+	// ErrSuspend is returned by the steps to suspend the flow, which is
+	// then resumed in the same state by the next Run. Run returns
+	// pam.ErrIncomplete.
+	ErrSuspend = errors.New("challenge: flow suspended")
+)
+
+// Step is the handler of a state.
+type Step struct {
+	// Run runs the state, usually sending a challenge through conv and
+	// checking the response, and returns the next state.
+	Run func(ctx context.Context, flow *Flow, conv pam.ConversationHandler) (State, error)
+	// Timeout is the maximum time spent in the state, including the time
+	// the flow is suspended, if not 0.
+	Timeout time.Duration
+}
+
+// Machine defines the states of a flow.
+type Machine struct {
+	// Initial is the first state of the flows.
+	Initial State
+	// Steps are the handlers of the states.
+	Steps map[State]Step
+	// Timeout is the maximum duration of the flows, if not 0.
+	Timeout time.Duration
+	// Now returns the current time, time.Now if not set.
+	Now func() time.Time
+}
+
+// Flow is a flow in progress. Its values are kept across the steps, and it
+// can be serialized with encoding/json or MarshalBinary.
+type Flow struct {
+	State State `json:"state"`
+	// Values are the values set by the steps for the following ones.
+	Values map[string]string `json:"values,omitempty"`
+	// Started is when the flow started.
+	Started time.Time `json:"started"`
+	// Entered is when the flow entered the current state.
+	Entered time.Time `json:"entered"`
+}
+
+func (m *Machine) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+// Start returns a new flow, in the initial state.
+func (m *Machine) Start() *Flow {
+	now := m.now()
+	return &Flow{State: m.Initial, Values: map[string]string{}, Started: now, Entered: now}
+}
+
+// Run runs the steps of the flow until it is done or fails. If a step
+// suspends it, Run returns pam.ErrIncomplete and the flow can be resumed by
+// another call.
+func (m *Machine) Run(ctx context.Context, flow *Flow, conv pam.ConversationHandler) error {
+	if flow.Values == nil {
+		flow.Values = map[string]string{}
+	}
+	for flow.State != Done {
+		step, ok := m.Steps[flow.State]
+		if !ok {
+			return fmt.Errorf("challenge: unknown state %q", flow.State)
+		}
+		deadline, ok := m.deadline(flow, step)
+		if ok && !m.now().Before(deadline) {
+			return ErrTimeout
+		}
+		stepCtx, cancel := ctx, context.CancelFunc(func() {})
+		if ok {
+			stepCtx, cancel = context.WithTimeout(ctx, deadline.Sub(m.now()))
+		}
+		next, err := step.Run(stepCtx, flow, conv)
+		timedOut := errors.Is(stepCtx.Err(), context.DeadlineExceeded) && ctx.Err() == nil
+		cancel()
+		switch {
+		case errors.Is(err, ErrSuspend):
+			return pam.ErrIncomplete
+		case timedOut:
+			return ErrTimeout
+		case err != nil:
+			return err
+		}
+		if next != flow.State {
+			flow.State, flow.Entered = next, m.now()
+		}
+	}
+	return nil
+}
+
+// deadline returns the deadline of the step of the flow, if any.
+func (m *Machine) deadline(flow *Flow, step Step) (time.Time, bool) {
+	var deadline time.Time
+	if m.Timeout > 0 {
+		deadline = flow.Started.Add(m.Timeout)
+	}
+	if step.Timeout > 0 {
+		if d := flow.Entered.Add(step.Timeout); deadline.IsZero() || d.Before(deadline) {
+			deadline = d
+		}
+	}
+	return deadline, !deadline.IsZero()
+}
+
+// MarshalBinary encodes the flow, to be stored as data of the module.
+func (f *Flow) MarshalBinary() ([]byte, error) {
+	return json.Marshal(f)
+}
+
+// UnmarshalBinary decodes a flow encoded by MarshalBinary.
+func (f *Flow) UnmarshalBinary(data []byte) error {
+	return json.Unmarshal(data, f)
+}
@@ -0,0 +1,122 @@
+package challenge
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// pairing is a flow sending a code, waiting for the device to be paired
+// and asking the user to confirm it.
+func pairing(now func() time.Time, paired *bool) *Machine {
+	return &Machine{
+		Initial: "code",
+		Now:     now,
+		Timeout: time.Hour,
+		Steps: map[State]Step{
+			"code": {Run: func(ctx context.Context, f *Flow, conv pam.ConversationHandler) (State, error) {
+				f.Values["code"] = "1234"
+				if _, err := conv.RespondPAM(pam.TextInfo, "Enter 1234 on the device"); err != nil {
+					return "", err
+				}
+				return "wait", nil
+			}},
+			"wait": {Timeout: 5 * time.Minute, Run: func(ctx context.Context, f *Flow, conv pam.ConversationHandler) (State, error) {
+				if !*paired {
+					return "", ErrSuspend
+				}
+				return "confirm", nil
+			}},
+			"confirm": {Run: func(ctx context.Context, f *Flow, conv pam.ConversationHandler) (State, error) {
+				resp, err := conv.RespondPAM(pam.PromptEchoOn, "Confirm code: ")
+				if err != nil {
+					return "", err
+				}
+				if resp != f.Values["code"] {
+					return "", pam.ErrAuth
+				}
+				return Done, nil
+			}},
+		},
+	}
+}
+
+func TestMachine(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	paired := false
+	m := pairing(func() time.Time { return now }, &paired)
+	var msgs []string
+	conv := pam.ConversationFunc(func(s pam.Style, msg string) (string, error) {
+		msgs = append(msgs, msg)
+		return "1234", nil
+	})
+
+	flow := m.Start()
+	if err := m.Run(context.Background(), flow, conv); !errors.Is(err, pam.ErrIncomplete) {
+		t.Fatalf("run #error: %v", err)
+	}
+	if flow.State != "wait" {
+		t.Fatalf("run #error: state %q", flow.State)
+	}
+	data, err := flow.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal #error: %v", err)
+	}
+
+	now = now.Add(time.Minute)
+	paired = true
+	var resumed Flow
+	if err := resumed.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal #error: %v", err)
+	}
+	if err := m.Run(context.Background(), &resumed, conv); err != nil {
+		t.Fatalf("resume #error: %v", err)
+	}
+	if resumed.State != Done || len(msgs) != 2 {
+		t.Fatalf("resume #error: state %q, messages %q", resumed.State, msgs)
+	}
+}
+
+func TestMachineTimeout(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	paired := false
+	m := pairing(func() time.Time { return now }, &paired)
+	conv := pam.ConversationFunc(func(s pam.Style, msg string) (string, error) {
+		return "1234", nil
+	})
+	flow := m.Start()
+	if err := m.Run(context.Background(), flow, conv); !errors.Is(err, pam.ErrIncomplete) {
+		t.Fatalf("run #error: %v", err)
+	}
+	now = now.Add(6 * time.Minute)
+	paired = true
+	if err := m.Run(context.Background(), flow, conv); !errors.Is(err, ErrTimeout) ||
+		!errors.Is(err, pam.ErrAuth) {
+		t.Fatalf("timeout #error: %v", err)
+	}
+}
+
+func TestMachineStepTimeout(t *testing.T) {
+	m := &Machine{
+		Initial: "slow",
+		Steps: map[State]Step{
+			"slow": {Timeout: 10 * time.Millisecond, Run: func(ctx context.Context, f *Flow, conv pam.ConversationHandler) (State, error) {
+				<-ctx.Done()
+				return "", ctx.Err()
+			}},
+		},
+	}
+	if err := m.Run(context.Background(), m.Start(), nil); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("timeout #error: %v", err)
+	}
+}
+
+func TestMachineUnknownState(t *testing.T) {
+	m := &Machine{Initial: "missing"}
+	if err := m.Run(context.Background(), m.Start(), nil); err == nil {
+		t.Fatalf("run #error: expected failure")
+	}
+}
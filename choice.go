@@ -0,0 +1,239 @@
+package pam
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"unsafe"
+)
+
+// The choice lists let the modules ask the users to select one of a few
+// options, such as the authentication method offered by a broker, with a
+// binary prompt the applications can show as a list, falling back to a
+// TextInfo message numbering the choices followed by a prompt for the plain
+// text conversation handlers.
+//
+// The binary messages are framed as those of libpamc: a 4 bytes big endian
+// length, including the header, a control byte and the data. The requests
+// have the ChoiceRequestControl byte and the JSON encoding of a ChoiceList,
+// and the responses the ChoiceResponseControl byte and the value chosen.
+
+// Control bytes of the binary messages of the choice lists.
+const (
+	ChoiceRequestControl  = 'C'
+	ChoiceResponseControl = 'c'
+)
+
+// maxChoiceMessage is the maximum size of the binary messages accepted.
+const maxChoiceMessage = 64 * 1024
+
+// ErrNotChoice is returned when decoding a binary message which is not a
+// choice list.
+var ErrNotChoice = errors.New("not a choice list message")
+
+// ErrInvalidChoice is returned when the response does not select a choice
+// of the list.
+var ErrInvalidChoice = errors.New("invalid choice")
+
+// ChoiceList is a request to select one of its choices.
+type ChoiceList struct {
+	// Title introduces the choices, such as "Select the authentication
+	// method".
+	Title   string         `json:"title,omitempty"`
+	Choices []PromptChoice `json:"choices"`
+	// Prompt is the prompt of the plain text fallback, "Choice [1-N]: "
+	// if empty.
+	Prompt string `json:"prompt,omitempty"`
+}
+
+// ModuleConversation is the conversation of a module with the application,
+// as provided by pamtest.Transaction.
+type ModuleConversation interface {
+	Conversation(Style, string) (string, error)
+	BinaryConversation(BinaryPointer) ([]byte, error)
+}
+
+// Choose asks the user to select one of the choices of l through conv,
+// returning the value of the one selected. The binary prompt is sent first,
+// and the plain text fallback if it fails with ErrConv, as it does with the
+// handlers not supporting it.
+func Choose(conv ModuleConversation, l ChoiceList) (string, error) {
+	req, err := l.EncodeRequest()
+	if err != nil {
+		return "", err
+	}
+	resp, err := conv.BinaryConversation(BinaryPointer(&req[0]))
+	if err == nil {
+		return l.ParseResponse(resp)
+	}
+	if !errors.Is(err, ErrConv) {
+		return "", err
+	}
+	if _, err := conv.Conversation(TextInfo, l.FallbackText()); err != nil {
+		return "", err
+	}
+	r, err := conv.Conversation(PromptEchoOn, l.FallbackPrompt())
+	if err != nil {
+		return "", err
+	}
+	return l.ParseFallback(r)
+}
+
+// EncodeRequest returns the binary message of the request, as sent by the
+// modules.
+func (l ChoiceList) EncodeRequest() ([]byte, error) {
+	if len(l.Choices) == 0 {
+		return nil, errors.New("choice list without choices")
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		return nil, err
+	}
+	return encodeBinaryMessage(ChoiceRequestControl, data)
+}
+
+// FallbackText returns the TextInfo message of the plain text fallback: the
+// title followed by the numbered labels of the choices.
+func (l ChoiceList) FallbackText() string {
+	var b strings.Builder
+	if l.Title != "" {
+		b.WriteString(l.Title + "\n")
+	}
+	for i, c := range l.Choices {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%d. %s", i+1, c.label())
+	}
+	return b.String()
+}
+
+// FallbackPrompt returns the prompt of the plain text fallback.
+func (l ChoiceList) FallbackPrompt() string {
+	if l.Prompt != "" {
+		return l.Prompt
+	}
+	return fmt.Sprintf("Choice [1-%d]: ", len(l.Choices))
+}
+
+// ParseResponse returns the value selected by the binary response of an
+// application.
+func (l ChoiceList) ParseResponse(resp []byte) (string, error) {
+	control, data, err := decodeBinaryMessage(resp)
+	if err != nil {
+		return "", err
+	}
+	if control != ChoiceResponseControl {
+		return "", fmt.Errorf("%w: unexpected control byte %#x", ErrInvalidChoice, control)
+	}
+	value := string(data)
+	for _, c := range l.Choices {
+		if c.Value == value {
+			return value, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidChoice, value)
+}
+
+// ParseFallback returns the value selected by the response to the fallback
+// prompt: the number of a choice, its value or its label, ignoring the
+// case.
+func (l ChoiceList) ParseFallback(resp string) (string, error) {
+	resp = strings.TrimSpace(resp)
+	if n, err := strconv.Atoi(resp); err == nil && n >= 1 && n <= len(l.Choices) {
+		return l.Choices[n-1].Value, nil
+	}
+	for _, c := range l.Choices {
+		if c.Value == resp || strings.EqualFold(c.label(), resp) {
+			return c.Value, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrInvalidChoice, resp)
+}
+
+// label returns the label of the choice, its value if empty.
+func (c PromptChoice) label() string {
+	if c.Label != "" {
+		return c.Label
+	}
+	return c.Value
+}
+
+// DecodeChoiceRequest returns the choice list of the binary message ptr
+// points to, as received by the applications. It returns ErrNotChoice if
+// the message is not a choice list.
+func DecodeChoiceRequest(ptr BinaryPointer) (*ChoiceList, error) {
+	if ptr == nil {
+		return nil, ErrNotChoice
+	}
+	size := binary.BigEndian.Uint32(unsafe.Slice((*byte)(ptr), 4))
+	if size < 5 || size > maxChoiceMessage {
+		return nil, ErrNotChoice
+	}
+	control, data, err := decodeBinaryMessage(unsafe.Slice((*byte)(ptr), size))
+	if err != nil {
+		return nil, err
+	}
+	if control != ChoiceRequestControl {
+		return nil, ErrNotChoice
+	}
+	var l ChoiceList
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("invalid choice list: %w", err)
+	}
+	if len(l.Choices) == 0 {
+		return nil, errors.New("choice list without choices")
+	}
+	return &l, nil
+}
+
+// EncodeChoiceResponse returns the binary response of an application
+// selecting the choice of the value.
+func EncodeChoiceResponse(value string) ([]byte, error) {
+	return encodeBinaryMessage(ChoiceResponseControl, []byte(value))
+}
+
+// ChoiceHandler adds the support of the choice lists to a conversation
+// handler, for the applications showing them as lists.
+type ChoiceHandler struct {
+	ConversationHandler
+	// Choose returns the value of the choice selected by the user.
+	Choose func(ChoiceList) (string, error)
+}
+
+// RespondPAMBinary responds to the binary prompts of the choice lists,
+// failing with the others.
+func (h ChoiceHandler) RespondPAMBinary(ptr BinaryPointer) ([]byte, error) {
+	l, err := DecodeChoiceRequest(ptr)
+	if err != nil {
+		return nil, err
+	}
+	value, err := h.Choose(*l)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeChoiceResponse(value)
+}
+
+// encodeBinaryMessage frames data as a libpamc binary message.
+func encodeBinaryMessage(control byte, data []byte) ([]byte, error) {
+	if len(data)+5 > maxChoiceMessage {
+		return nil, fmt.Errorf("binary message of %d bytes too long", len(data))
+	}
+	msg := make([]byte, 5, 5+len(data))
+	binary.BigEndian.PutUint32(msg, uint32(5+len(data)))
+	msg[4] = control
+	return append(msg, data...), nil
+}
+
+// decodeBinaryMessage returns the control byte and the data of a libpamc
+// binary message.
+func decodeBinaryMessage(msg []byte) (byte, []byte, error) {
+	if len(msg) < 5 || binary.BigEndian.Uint32(msg) != uint32(len(msg)) {
+		return 0, nil, errMalformedBinary
+	}
+	return msg[4], msg[5:], nil
+}
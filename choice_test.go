@@ -0,0 +1,125 @@
+package pam
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+// fakeModule converses with a handler as a module would.
+type fakeModule struct {
+	handler ConversationHandler
+}
+
+func (m fakeModule) Conversation(s Style, msg string) (string, error) {
+	r, err := m.handler.RespondPAM(s, msg)
+	if err != nil {
+		return "", ErrConv
+	}
+	return r, nil
+}
+
+func (m fakeModule) BinaryConversation(ptr BinaryPointer) ([]byte, error) {
+	h, ok := m.handler.(BinaryConversationHandler)
+	if !ok {
+		return nil, ErrConv
+	}
+	r, err := h.RespondPAMBinary(ptr)
+	if err != nil {
+		return nil, ErrConv
+	}
+	return r, nil
+}
+
+var testChoices = ChoiceList{
+	Title: "Select the authentication method",
+	Choices: []PromptChoice{
+		{Value: "password", Label: "Password"},
+		{Value: "totp", Label: "Authenticator app"},
+		{Value: "qr"},
+	},
+}
+
+func TestChoose_Binary(t *testing.T) {
+	var got *ChoiceList
+	h := ChoiceHandler{
+		ConversationHandler: ConversationFunc(func(s Style, msg string) (string, error) {
+			t.Fatalf("choose #error: unexpected message %q", msg)
+			return "", nil
+		}),
+		Choose: func(l ChoiceList) (string, error) {
+			got = &l
+			return "totp", nil
+		},
+	}
+	v, err := Choose(fakeModule{h}, testChoices)
+	if err != nil || v != "totp" {
+		t.Fatalf("choose #error: expected totp, got %q, %v", v, err)
+	}
+	if got.Title != testChoices.Title || !slices.Equal(got.Choices, testChoices.Choices) {
+		t.Fatalf("choose #error: got %+v", got)
+	}
+
+	h.Choose = func(ChoiceList) (string, error) { return "sms", nil }
+	if _, err := Choose(fakeModule{h}, testChoices); !errors.Is(err, ErrInvalidChoice) {
+		t.Fatalf("choose #error: expected %v, got %v", ErrInvalidChoice, err)
+	}
+}
+
+func TestChoose_Fallback(t *testing.T) {
+	for _, tt := range []struct {
+		resp, expected string
+		err            error
+	}{
+		{"2", "totp", nil},
+		{" password ", "password", nil},
+		{"AUTHENTICATOR APP", "totp", nil},
+		{"qr", "qr", nil},
+		{"4", "", ErrInvalidChoice},
+		{"sms", "", ErrInvalidChoice},
+	} {
+		var messages []string
+		conv := ConversationFunc(func(s Style, msg string) (string, error) {
+			messages = append(messages, msg)
+			if s == PromptEchoOn {
+				return tt.resp, nil
+			}
+			return "", nil
+		})
+		v, err := Choose(fakeModule{conv}, testChoices)
+		if v != tt.expected || !errors.Is(err, tt.err) {
+			t.Fatalf("choose #error: %q: expected %q, %v, got %q, %v", tt.resp, tt.expected, tt.err, v, err)
+		}
+		expected := []string{
+			"Select the authentication method\n1. Password\n2. Authenticator app\n3. qr",
+			"Choice [1-3]: ",
+		}
+		if !slices.Equal(messages, expected) {
+			t.Fatalf("choose #error: expected messages %q, got %q", expected, messages)
+		}
+	}
+}
+
+func TestDecodeChoiceRequest(t *testing.T) {
+	req, err := testChoices.EncodeRequest()
+	if err != nil {
+		t.Fatalf("encode #error: %v", err)
+	}
+	if req[4] != ChoiceRequestControl || int(req[3]) != len(req) {
+		t.Fatalf("encode #error: unexpected header % x", req[:5])
+	}
+	other := []byte{0, 0, 0, 6, 'X', 0}
+	if _, err := DecodeChoiceRequest(BinaryPointer(&other[0])); !errors.Is(err, ErrNotChoice) {
+		t.Fatalf("decode #error: expected %v, got %v", ErrNotChoice, err)
+	}
+	short := []byte{0, 0, 0, 1}
+	if _, err := DecodeChoiceRequest(BinaryPointer(&short[0])); !errors.Is(err, ErrNotChoice) {
+		t.Fatalf("decode #error: expected %v, got %v", ErrNotChoice, err)
+	}
+	if _, err := (ChoiceList{}).EncodeRequest(); err == nil {
+		t.Fatalf("encode #error: expected a failure")
+	}
+	if _, err := testChoices.ParseResponse([]byte{0, 0, 0, 9, ChoiceResponseControl, 'q', 'r'}); err == nil {
+		t.Fatalf("parse #error: expected a failure with a wrong length")
+	}
+}
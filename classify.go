@@ -0,0 +1,34 @@
+package pam
+
+import "errors"
+
+// isAny returns whether err matches any of the return types.
+func isAny(err error, targets ...ReturnType) bool {
+	for _, t := range targets {
+		if errors.Is(err, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAuthFailure returns whether err means that the user could not be
+// authenticated or is not allowed, rather than a failure of the system or
+// of the conversation.
+func IsAuthFailure(err error) bool {
+	return isAny(err, ErrAuth, ErrCredInsufficient, ErrUserUnknown,
+		ErrMaxtries, ErrPermDenied)
+}
+
+// IsTransient returns whether the operation that returned err may succeed if
+// called again later.
+func IsTransient(err error) bool {
+	return isAny(err, ErrConvAgain, ErrIncomplete, ErrTryAgain,
+		ErrAuthtokLockBusy)
+}
+
+// ShouldChangeAuthTok returns whether err requires the user to change the
+// authentication token, with ChangeAuthTok and ChangeExpiredAuthtok.
+func ShouldChangeAuthTok(err error) bool {
+	return isAny(err, ErrNewAuthtokReqd, ErrAuthtokExpired)
+}
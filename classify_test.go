@@ -0,0 +1,36 @@
+package pam
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		err                        error
+		auth, transient, changeTok bool
+	}{
+		{nil, false, false, false},
+		{ErrAuth, true, false, false},
+		{fmt.Errorf("login: %w", ErrUserUnknown), true, false, false},
+		{ErrMaxtries, true, false, false},
+		{ErrTryAgain, false, true, false},
+		{ErrConvAgain, false, true, false},
+		{ErrIncomplete, false, true, false},
+		{ErrNewAuthtokReqd, false, false, true},
+		{ErrAuthtokExpired, false, false, true},
+		{ErrSystem, false, false, false},
+		{ErrConv, false, false, false},
+	}
+	for _, tt := range tests {
+		if got := IsAuthFailure(tt.err); got != tt.auth {
+			t.Fatalf("isauthfailure #error: %v: expected %v", tt.err, tt.auth)
+		}
+		if got := IsTransient(tt.err); got != tt.transient {
+			t.Fatalf("istransient #error: %v: expected %v", tt.err, tt.transient)
+		}
+		if got := ShouldChangeAuthTok(tt.err); got != tt.changeTok {
+			t.Fatalf("shouldchangeauthtok #error: %v: expected %v", tt.err, tt.changeTok)
+		}
+	}
+}
@@ -0,0 +1,213 @@
+// login-example is a minimal login program showing the complete sequence
+// of PAM calls an application has to perform to log a user in:
+//
+//	login-example [-service NAME] [-confdir DIR] [-command CMD] [user]
+//
+// It authenticates the user, validates the account, changes the expired
+// authentication tokens if requested by the stack, establishes the user
+// credentials and opens a session, then runs the user shell (or CMD using
+// the shell) with the PAM environment. Once the shell exits, it closes the
+// session and deletes the credentials, in the reverse order. If no user is
+// given, the PAM stack asks for it.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/msteinert/pam"
+	"golang.org/x/term"
+)
+
+// conversation returns a handler using the terminal if stdin is one,
+// disabling echo for the hidden prompts.
+func conversation(stdin io.Reader, stdout, stderr io.Writer) pam.ConversationHandler {
+	input := bufio.NewScanner(stdin)
+	fd := -1
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		fd = int(f.Fd())
+	}
+	return pam.ConversationFunc(func(s pam.Style, msg string) (string, error) {
+		switch s {
+		case pam.PromptEchoOff:
+			fmt.Fprint(stdout, msg)
+			if fd < 0 {
+				break
+			}
+			pw, err := term.ReadPassword(fd)
+			fmt.Fprintln(stdout)
+			return string(pw), err
+		case pam.PromptEchoOn:
+			fmt.Fprint(stdout, msg)
+		case pam.ErrorMsg:
+			fmt.Fprintln(stderr, msg)
+			return "", nil
+		case pam.TextInfo:
+			fmt.Fprintln(stdout, msg)
+			return "", nil
+		default:
+			return "", errors.New("unrecognized message style")
+		}
+		if !input.Scan() {
+			return "", errors.New("no response available")
+		}
+		return input.Text(), nil
+	})
+}
+
+// lookupShell returns the login shell of the user from /etc/passwd.
+func lookupShell(name string) string {
+	f, err := os.Open("/etc/passwd")
+	if err != nil {
+		return "/bin/sh"
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Split(s.Text(), ":")
+		if len(fields) == 7 && fields[0] == name && fields[6] != "" {
+			return fields[6]
+		}
+	}
+	return "/bin/sh"
+}
+
+// shell returns the command running the shell of the user in the PAM
+// environment, with the user privileges.
+func shell(tx *pam.Transaction, name, command string) (*exec.Cmd, error) {
+	u, err := user.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	sh := lookupShell(u.Username)
+	cmd := exec.Command(sh, "-l")
+	if command != "" {
+		cmd = exec.Command(sh, "-c", command)
+	}
+	cmd.Dir = u.HomeDir
+	cmd.Env = []string{
+		"HOME=" + u.HomeDir,
+		"USER=" + u.Username,
+		"LOGNAME=" + u.Username,
+		"SHELL=" + sh,
+		"PATH=/usr/local/bin:/usr/bin:/bin",
+	}
+	if err := tx.ApplyEnv(cmd); err != nil {
+		return nil, err
+	}
+
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	if int(uid) == os.Getuid() {
+		return cmd, nil
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	cred := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	groups, err := u.GroupIds()
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if id, err := strconv.ParseUint(g, 10, 32); err == nil {
+			cred.Groups = append(cred.Groups, uint32(id))
+		}
+	}
+	cmd.SysProcAttr = &syscall.SysProcAttr{Credential: cred}
+	return cmd, nil
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("login-example", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	service := fs.String("service", "login", "PAM service to use")
+	confDir := fs.String("confdir", "", "directory containing the PAM services")
+	command := fs.String("command", "", "command to run instead of the login shell")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: login-example [flags] [user]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+	fail := func(op string, err error) int {
+		fmt.Fprintf(stderr, "%s: %v\n", op, err)
+		return 1
+	}
+
+	handler := conversation(stdin, stdout, stderr)
+	var tx *pam.Transaction
+	var err error
+	if *confDir != "" {
+		tx, err = pam.StartConfDir(*service, fs.Arg(0), handler, *confDir)
+	} else {
+		tx, err = pam.Start(*service, fs.Arg(0), handler)
+	}
+	if err != nil {
+		return fail("start", err)
+	}
+	defer tx.Close()
+	if f, ok := stdin.(*os.File); ok && term.IsTerminal(int(f.Fd())) {
+		if tty, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", f.Fd())); err == nil {
+			if err := tx.SetItem(pam.Tty, tty); err != nil {
+				return fail("set tty", err)
+			}
+		}
+	}
+
+	if err := tx.Authenticate(0); err != nil {
+		return fail("authenticate", err)
+	}
+	if err := tx.AcctMgmt(0); pam.ShouldChangeAuthTok(err) {
+		if err := tx.ChangeAuthTok(pam.ChangeExpiredAuthtok); err != nil {
+			return fail("chauthtok", err)
+		}
+	} else if err != nil {
+		return fail("acct_mgmt", err)
+	}
+	// Modules may have changed the user, so it is read back from PAM.
+	name, err := tx.GetItem(pam.User)
+	if err != nil {
+		return fail("get user", err)
+	}
+
+	session, err := tx.StartSession(0)
+	if err != nil {
+		return fail("start session", err)
+	}
+	defer session.Close()
+
+	cmd, err := shell(tx, name, *command)
+	if err != nil {
+		return fail("shell", err)
+	}
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = stdin, stdout, stderr
+	var exit *exec.ExitError
+	if err := cmd.Run(); errors.As(err, &exit) {
+		return exit.ExitCode()
+	} else if err != nil {
+		return fail("shell", err)
+	}
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"os/user"
+	"strings"
+	"testing"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/pamtest"
+)
+
+func TestRun(t *testing.T) {
+	if !pam.CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	ts := pamtest.NewTestSetup(t)
+	ts.CreateService("login", []pamtest.ServiceLine{
+		{Type: pamtest.Auth, Control: pamtest.Required, Module: "pam_permit.so"},
+		{Type: pamtest.Account, Control: pamtest.Required, Module: "pam_permit.so"},
+		{Type: pamtest.Password, Control: pamtest.Required, Module: "pam_permit.so"},
+		{Type: pamtest.Session, Control: pamtest.Required, Module: "pam_env.so",
+			Args: []string{"readenv=0", "conffile=" + ts.WorkDir() + "/env.conf"}},
+	})
+	ts.CreateService("deny", []pamtest.ServiceLine{
+		{Type: pamtest.Auth, Control: pamtest.Required, Module: "pam_deny.so"},
+	})
+	os.WriteFile(ts.WorkDir()+"/env.conf", []byte("LOGIN_EXAMPLE DEFAULT=session\n"), 0600)
+
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"-confdir", ts.WorkDir(), "-command", `echo "$USER $LOGIN_EXAMPLE"; exit 3`,
+		u.Username}, strings.NewReader(""), &stdout, &stderr)
+	if status != 3 {
+		t.Fatalf("run #error: status %d, %s", status, stderr.String())
+	}
+	if stdout.String() != u.Username+" session\n" {
+		t.Fatalf("run #error: unexpected output %q", stdout.String())
+	}
+
+	stdout.Reset()
+	stderr.Reset()
+	status = run([]string{"-confdir", ts.WorkDir(), "-service", "deny", u.Username},
+		strings.NewReader(""), &stdout, &stderr)
+	if status != 1 || !strings.HasPrefix(stderr.String(), "authenticate: ") {
+		t.Fatalf("run #error: status %d, %q", status, stderr.String())
+	}
+}
@@ -0,0 +1,161 @@
+// pam-env runs a PAM service through authenticate and open_session and
+// prints the resulting PAM environment and items, to debug session
+// environment issues:
+//
+//	pam-env [-confdir DIR] [-credentials FILE] [-json] service [user]
+//
+// The credentials file is a JSON object with "user" and "password" keys,
+// used to answer the PromptEchoOn and PromptEchoOff prompts respectively.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+
+	"github.com/msteinert/pam"
+)
+
+// credentials are used to answer the stack prompts.
+type credentials struct {
+	User     string `json:"user"`
+	Password string `json:"password"`
+}
+
+func (c credentials) RespondPAM(s pam.Style, msg string) (string, error) {
+	switch s {
+	case pam.PromptEchoOn:
+		return c.User, nil
+	case pam.PromptEchoOff:
+		return c.Password, nil
+	case pam.ErrorMsg, pam.TextInfo:
+		return "", nil
+	}
+	return "", errors.New("unrecognized message style")
+}
+
+var items = []struct {
+	name string
+	item pam.Item
+}{
+	{"service", pam.Service},
+	{"user", pam.User},
+	{"tty", pam.Tty},
+	{"rhost", pam.Rhost},
+	{"ruser", pam.Ruser},
+	{"user_prompt", pam.UserPrompt},
+}
+
+// report is the JSON output of pam-env.
+type report struct {
+	Items map[string]string `json:"items"`
+	Env   map[string]string `json:"env"`
+}
+
+func readCredentials(path string) (credentials, error) {
+	var c credentials
+	if path == "" {
+		return c, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	err = json.Unmarshal(data, &c)
+	return c, err
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("pam-env", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	confDir := fs.String("confdir", "", "directory containing the PAM services")
+	credsFile := fs.String("credentials", "", "JSON file with the user and password")
+	jsonOutput := fs.Bool("json", false, "print the results as JSON")
+	noSession := fs.Bool("no-session", false, "don't open a session")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pam-env [flags] service [user]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		fs.Usage()
+		return 2
+	}
+	creds, err := readCredentials(*credsFile)
+	if err != nil {
+		fmt.Fprintf(stderr, "credentials: %v\n", err)
+		return 1
+	}
+	service, user := fs.Arg(0), fs.Arg(1)
+	if user == "" {
+		user = creds.User
+	}
+
+	var tx *pam.Transaction
+	if *confDir != "" {
+		tx, err = pam.StartConfDir(service, user, creds, *confDir)
+	} else {
+		tx, err = pam.Start(service, user, creds)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "start: %v\n", err)
+		return 1
+	}
+	defer tx.Close()
+	if err := tx.Authenticate(0); err != nil {
+		fmt.Fprintf(stderr, "authenticate: %v\n", err)
+		return 1
+	}
+	if !*noSession {
+		if err := tx.OpenSession(0); err != nil {
+			fmt.Fprintf(stderr, "open_session: %v\n", err)
+			return 1
+		}
+		defer tx.CloseSession(0)
+	}
+
+	rep := report{Items: map[string]string{}}
+	for _, i := range items {
+		value, err := tx.GetItem(i.item)
+		if err != nil {
+			fmt.Fprintf(stderr, "get item %s: %v\n", i.name, err)
+			return 1
+		}
+		rep.Items[i.name] = value
+	}
+	if rep.Env, err = tx.GetEnvList(); err != nil {
+		fmt.Fprintf(stderr, "getenvlist: %v\n", err)
+		return 1
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(rep)
+		return 0
+	}
+	fmt.Fprintln(stdout, "# items")
+	for _, i := range items {
+		fmt.Fprintf(stdout, "%s=%s\n", i.name, rep.Items[i.name])
+	}
+	fmt.Fprintln(stdout, "# environment")
+	names := make([]string, 0, len(rep.Env))
+	for name := range rep.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(stdout, "%s=%s\n", name, rep.Env[name])
+	}
+	return 0
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
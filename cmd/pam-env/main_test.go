@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/pamtest"
+)
+
+func confDir(t *testing.T) string {
+	if !pam.CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	ts := pamtest.NewTestSetup(t)
+	envFile := filepath.Join(ts.WorkDir(), "environment")
+	os.WriteFile(envFile, []byte("GO_PAM_TEST=value\n"), 0600)
+	ts.CreateService("env", []pamtest.ServiceLine{
+		{Type: pamtest.Auth, Control: pamtest.Required, Module: "pam_permit.so"},
+		{Type: pamtest.Session, Control: pamtest.Required, Module: "pam_env.so",
+			Args: []string{"readenv=1", "envfile=" + envFile, "user_readenv=0",
+				"conffile=/dev/null"}},
+	})
+	return ts.WorkDir()
+}
+
+func TestRun(t *testing.T) {
+	dir := confDir(t)
+	u, _ := user.Current()
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"-confdir", dir, "env", u.Username}, &stdout, &stderr); status != 0 {
+		t.Fatalf("run #error: status %d, %s", status, stderr.String())
+	}
+	out := stdout.String()
+	if !strings.Contains(out, "service=env\n") || !strings.Contains(out, "user="+u.Username+"\n") {
+		t.Fatalf("run #error: missing items in %q", out)
+	}
+	if !strings.Contains(out, "# environment\nGO_PAM_TEST=value\n") {
+		t.Fatalf("run #error: missing environment in %q", out)
+	}
+}
+
+func TestRun_JSON(t *testing.T) {
+	dir := confDir(t)
+	u, _ := user.Current()
+	creds := filepath.Join(t.TempDir(), "creds.json")
+	os.WriteFile(creds, []byte(`{"user": "`+u.Username+`"}`), 0600)
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"-confdir", dir, "-credentials", creds, "-json", "env"}, &stdout, &stderr); status != 0 {
+		t.Fatalf("run #error: status %d, %s", status, stderr.String())
+	}
+	var rep report
+	if err := json.Unmarshal(stdout.Bytes(), &rep); err != nil {
+		t.Fatalf("json #error: %v", err)
+	}
+	if rep.Items["user"] != u.Username || rep.Env["GO_PAM_TEST"] != "value" {
+		t.Fatalf("run #error: unexpected report %+v", rep)
+	}
+}
+
+func TestRun_Errors(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if status := run(nil, &stdout, &stderr); status != 2 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+	if status := run([]string{"-credentials", "/does/not/exist", "env"}, &stdout, &stderr); status != 1 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+}
@@ -0,0 +1,91 @@
+// pam-lint checks PAM service files for syntax errors, missing modules and
+// common configuration mistakes:
+//
+//	pam-lint [-confdir DIR] [-moduledir DIR]... [-werror] [service...]
+//
+// All the services in the configuration directory are checked unless some
+// are named. It exits with status 1 if errors are found, or if warnings are
+// found and -werror is set.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/msteinert/pam/pamconf"
+)
+
+type dirs []string
+
+func (d *dirs) String() string {
+	return strings.Join(*d, ",")
+}
+
+func (d *dirs) Set(s string) error {
+	*d = append(*d, s)
+	return nil
+}
+
+func run(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("pam-lint", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	confDir := fs.String("confdir", "/etc/pam.d", "directory containing the PAM services")
+	werror := fs.Bool("werror", false, "treat warnings as errors")
+	skipModules := fs.Bool("skip-modules", false, "don't check that modules exist")
+	var moduleDirs dirs
+	fs.Var(&moduleDirs, "moduledir", "directory containing the PAM modules, can be repeated")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pam-lint [flags] [service...]")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+
+	opts := pamconf.LintOptions{ModuleDirs: moduleDirs, SkipModules: *skipModules}
+	var issues []pamconf.Issue
+	if fs.NArg() == 0 {
+		var err error
+		if issues, err = pamconf.LintDir(*confDir, opts); err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	} else {
+		entries, err := os.ReadDir(*confDir)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		opts.Services = map[string]bool{}
+		for _, e := range entries {
+			opts.Services[e.Name()] = !e.IsDir()
+		}
+		for _, service := range fs.Args() {
+			path := filepath.Join(*confDir, service)
+			f, err := os.Open(path)
+			if err != nil {
+				fmt.Fprintln(stderr, err)
+				return 1
+			}
+			issues = append(issues, pamconf.Lint(path, f, opts)...)
+			f.Close()
+		}
+	}
+
+	status := 0
+	for _, i := range issues {
+		fmt.Fprintln(stdout, i)
+		if i.Severity == pamconf.Error || *werror {
+			status = 1
+		}
+	}
+	return status
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "good"), []byte("auth required pam_permit.so\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "warn"), []byte("auth optional pam_permit.so\n"), 0600)
+	os.WriteFile(filepath.Join(dir, "bad"), []byte("auth required\n"), 0600)
+
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"-confdir", dir, "-skip-modules", "good"}, &stdout, &stderr); status != 0 || stdout.Len() != 0 {
+		t.Fatalf("run #error: status %d, %q", status, stdout.String())
+	}
+	if status := run([]string{"-confdir", dir, "-skip-modules", "warn"}, &stdout, &stderr); status != 0 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+	if !strings.Contains(stdout.String(), "no-fallback") {
+		t.Fatalf("run #error: unexpected output %q", stdout.String())
+	}
+	if status := run([]string{"-confdir", dir, "-skip-modules", "-werror", "warn"}, &stdout, &stderr); status != 1 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+	stdout.Reset()
+	if status := run([]string{"-confdir", dir, "-skip-modules"}, &stdout, &stderr); status != 1 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+	if !strings.Contains(stdout.String(), filepath.Join(dir, "bad")+":1: error:") {
+		t.Fatalf("run #error: unexpected output %q", stdout.String())
+	}
+	if status := run([]string{"-confdir", dir, "missing"}, &stdout, &stderr); status != 1 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+}
@@ -0,0 +1,253 @@
+//go:build cgo
+
+// pam-tester runs PAM operations for a service and user, reporting their
+// results. It is meant to debug PAM stacks and modules:
+//
+//	pam-tester [-confdir DIR] [-r RESPONSE]... [-env] [-json] service user operation...
+//
+// Supported operations are authenticate, acct_mgmt, setcred, chauthtok,
+// open_session and close_session; they are run in order until the first
+// failure. Prompts are answered using the -r responses in order, then
+// reading lines from the standard input. With -env, the PAM environment
+// the modules set is printed once the operations ran.
+//
+// The service can be described by -line flags instead, one by line of its
+// file, written into a temporary directory used as -confdir:
+//
+//	pam-tester -line "auth required pam_permit.so" \
+//	    -line "account required pam_permit.so" \
+//	    test alice authenticate acct_mgmt
+//
+// The selftest command runs the health checks of a module written in Go
+// instead, registered with the selftest package, without attempting a login:
+//
+//	pam-tester selftest [-json] module.so
+//
+// The info command prints the build information of such a module, such as
+// its version:
+//
+//	pam-tester info [-json] module.so
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/pamconf"
+)
+
+type operation struct {
+	name string
+	run  func(tx *pam.Transaction, f pam.Flags) error
+	// flags are always passed to the operation.
+	flags pam.Flags
+}
+
+var operations = map[string]operation{
+	"authenticate":  {"authenticate", (*pam.Transaction).Authenticate, 0},
+	"acct_mgmt":     {"acct_mgmt", (*pam.Transaction).AcctMgmt, 0},
+	"setcred":       {"setcred", (*pam.Transaction).SetCred, pam.EstablishCred},
+	"chauthtok":     {"chauthtok", (*pam.Transaction).ChangeAuthTok, 0},
+	"open_session":  {"open_session", (*pam.Transaction).OpenSession, 0},
+	"close_session": {"close_session", (*pam.Transaction).CloseSession, 0},
+}
+
+// message is a conversation message received from the stack.
+type message struct {
+	Style   string `json:"style"`
+	Message string `json:"message"`
+}
+
+// result is the result of an operation.
+type result struct {
+	Operation string `json:"operation"`
+	Success   bool   `json:"success"`
+	Status    string `json:"status"`
+	Error     string `json:"error,omitempty"`
+}
+
+// report is the JSON output of pam-tester.
+type report struct {
+	Service  string    `json:"service"`
+	User     string    `json:"user"`
+	Messages []message `json:"messages"`
+	Results  []result  `json:"results"`
+	Env      []string  `json:"env,omitempty"`
+	Error    string    `json:"error,omitempty"`
+}
+
+type responses []string
+
+func (r *responses) String() string {
+	return strings.Join(*r, ",")
+}
+
+func (r *responses) Set(s string) error {
+	*r = append(*r, s)
+	return nil
+}
+
+// writeService writes the lines of the service into a new temporary
+// directory, returned for pam.StartConfDir, once checked.
+func writeService(service string, lines []string) (string, error) {
+	content := strings.Join(lines, "\n") + "\n"
+	if _, err := pamconf.Parse(strings.NewReader(content)); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp("", "pam-tester-")
+	if err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(dir, service), []byte(content), 0o644); err != nil {
+		os.RemoveAll(dir)
+		return "", err
+	}
+	return dir, nil
+}
+
+var styleNames = map[pam.Style]string{
+	pam.PromptEchoOff: "echo_off",
+	pam.PromptEchoOn:  "echo_on",
+	pam.ErrorMsg:      "error",
+	pam.TextInfo:      "info",
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) > 0 && args[0] == "selftest" {
+		return runSelftest(args[1:], stdout, stderr)
+	}
+	if len(args) > 0 && args[0] == "info" {
+		return runInfo(args[1:], stdout, stderr)
+	}
+	fs := flag.NewFlagSet("pam-tester", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	confDir := fs.String("confdir", "", "directory containing the PAM services")
+	jsonOutput := fs.Bool("json", false, "print the results as JSON")
+	silent := fs.Bool("silent", false, "pass the Silent flag to all the operations")
+	showEnv := fs.Bool("env", false, "print the PAM environment once the operations ran")
+	var rs, lines responses
+	fs.Var(&rs, "r", "response to a prompt, can be repeated")
+	fs.Var(&lines, "line", "line of the service file, instead of -confdir, can be repeated")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pam-tester [flags] service user operation...")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() < 3 || (len(lines) > 0 && *confDir != "") {
+		fs.Usage()
+		return 2
+	}
+	rep := report{Service: fs.Arg(0), User: fs.Arg(1), Messages: []message{}, Results: []result{}}
+	var ops []operation
+	for _, name := range fs.Args()[2:] {
+		op, ok := operations[name]
+		if !ok {
+			fmt.Fprintf(stderr, "unknown operation %q\n", name)
+			return 2
+		}
+		ops = append(ops, op)
+	}
+	if len(lines) > 0 {
+		dir, err := writeService(rep.Service, lines)
+		if err != nil {
+			fmt.Fprintf(stderr, "service: %v\n", err)
+			return 2
+		}
+		defer os.RemoveAll(dir)
+		*confDir = dir
+	}
+
+	input := bufio.NewScanner(stdin)
+	handler := pam.ConversationFunc(func(s pam.Style, msg string) (string, error) {
+		rep.Messages = append(rep.Messages, message{styleNames[s], msg})
+		if !*jsonOutput {
+			fmt.Fprintln(stderr, msg)
+		}
+		if s != pam.PromptEchoOff && s != pam.PromptEchoOn {
+			return "", nil
+		}
+		if len(rs) > 0 {
+			r := rs[0]
+			rs = rs[1:]
+			return r, nil
+		}
+		if !input.Scan() {
+			return "", errors.New("no response available")
+		}
+		return input.Text(), nil
+	})
+
+	var flags pam.Flags
+	if *silent {
+		flags = pam.Silent
+	}
+	status := 0
+	var tx *pam.Transaction
+	var err error
+	if *confDir != "" {
+		tx, err = pam.StartConfDir(rep.Service, rep.User, handler, *confDir)
+	} else {
+		tx, err = pam.Start(rep.Service, rep.User, handler)
+	}
+	if err != nil {
+		rep.Error = err.Error()
+		status = 1
+	} else {
+		defer tx.Close()
+	}
+	for _, op := range ops {
+		if status != 0 {
+			break
+		}
+		err := op.run(tx, flags|op.flags)
+		r := result{Operation: op.name, Success: err == nil, Status: pam.StatusOf(err).String()}
+		if err != nil {
+			r.Error = err.Error()
+			status = 1
+		}
+		rep.Results = append(rep.Results, r)
+	}
+	if *showEnv && tx != nil {
+		env, err := tx.Environ()
+		if err != nil {
+			fmt.Fprintf(stderr, "env: %v\n", err)
+			status = 1
+		}
+		rep.Env = env
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(rep)
+		return status
+	}
+	if rep.Error != "" {
+		fmt.Fprintf(stdout, "start: %s\n", rep.Error)
+	}
+	for _, r := range rep.Results {
+		if r.Success {
+			fmt.Fprintf(stdout, "%s: success\n", r.Operation)
+		} else {
+			fmt.Fprintf(stdout, "%s: %s\n", r.Operation, r.Error)
+		}
+	}
+	for _, e := range rep.Env {
+		fmt.Fprintf(stdout, "env: %s\n", e)
+	}
+	return status
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
@@ -0,0 +1,199 @@
+//go:build cgo
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/pamtest"
+)
+
+func confDir(t *testing.T) string {
+	if !pam.CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	ts := pamtest.NewTestSetup(t)
+	ts.CreateService("permit", []pamtest.ServiceLine{
+		{Type: pamtest.Auth, Control: pamtest.Optional, Module: "pam_echo.so", Args: []string{"Hello"}},
+		{Type: pamtest.Auth, Control: pamtest.Required, Module: "pam_permit.so"},
+		{Type: pamtest.Account, Control: pamtest.Required, Module: "pam_permit.so"},
+	})
+	ts.CreateService("deny", []pamtest.ServiceLine{
+		{Type: pamtest.Auth, Control: pamtest.Required, Module: "pam_deny.so"},
+		{Type: pamtest.Account, Control: pamtest.Required, Module: "pam_permit.so"},
+	})
+	return ts.WorkDir()
+}
+
+func TestRun(t *testing.T) {
+	dir := confDir(t)
+	u, _ := user.Current()
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"-confdir", dir, "permit", u.Username, "authenticate", "acct_mgmt"},
+		strings.NewReader(""), &stdout, &stderr)
+	if status != 0 {
+		t.Fatalf("run #error: status %d, %s", status, stderr.String())
+	}
+	if stdout.String() != "authenticate: success\nacct_mgmt: success\n" {
+		t.Fatalf("run #error: unexpected output %q", stdout.String())
+	}
+	if stderr.String() != "Hello\n" {
+		t.Fatalf("run #error: unexpected messages %q", stderr.String())
+	}
+}
+
+func TestRun_JSON(t *testing.T) {
+	dir := confDir(t)
+	u, _ := user.Current()
+	var stdout, stderr bytes.Buffer
+	status := run([]string{"-confdir", dir, "-json", "deny", u.Username, "authenticate", "acct_mgmt"},
+		strings.NewReader(""), &stdout, &stderr)
+	if status != 1 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+	var rep report
+	if err := json.Unmarshal(stdout.Bytes(), &rep); err != nil {
+		t.Fatalf("json #error: %v", err)
+	}
+	if rep.Service != "deny" || len(rep.Results) != 1 || rep.Results[0].Success || rep.Results[0].Error == "" {
+		t.Fatalf("run #error: unexpected report %+v", rep)
+	}
+}
+
+func TestRun_Lines(t *testing.T) {
+	if !pam.CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	envFile := filepath.Join(t.TempDir(), "environment")
+	os.WriteFile(envFile, []byte("GO_PAM_TEST=value\n"), 0600)
+	u, _ := user.Current()
+	var stdout, stderr bytes.Buffer
+	status := run([]string{
+		"-line", "auth required pam_permit.so",
+		"-line", "session required pam_env.so readenv=1 envfile=" + envFile + " user_readenv=0 conffile=/dev/null",
+		"-env", "test", u.Username, "authenticate", "open_session"},
+		strings.NewReader(""), &stdout, &stderr)
+	if status != 0 {
+		t.Fatalf("run #error: status %d, %s", status, stderr.String())
+	}
+	if stdout.String() != "authenticate: success\nopen_session: success\nenv: GO_PAM_TEST=value\n" {
+		t.Fatalf("run #error: unexpected output %q", stdout.String())
+	}
+
+	stdout.Reset()
+	status = run([]string{"-json", "-line", "auth requisite pam_deny.so", "test", u.Username, "authenticate"},
+		strings.NewReader(""), &stdout, &stderr)
+	if status != 1 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+	var rep report
+	if err := json.Unmarshal(stdout.Bytes(), &rep); err != nil {
+		t.Fatalf("json #error: %v", err)
+	}
+	if len(rep.Results) != 1 || rep.Results[0].Status != pam.ErrAuth.String() || rep.Env != nil {
+		t.Fatalf("run #error: unexpected report %+v", rep)
+	}
+
+	if status := run([]string{"-line", "auth bogus", "test", u.Username, "authenticate"}, nil, &stdout, &stderr); status != 2 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+	if status := run([]string{"-confdir", "/", "-line", "auth required pam_permit.so", "test", u.Username, "authenticate"}, nil, &stdout, &stderr); status != 2 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+}
+
+func TestRun_Usage(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"service"}, nil, &stdout, &stderr); status != 2 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+	if status := run([]string{"service", "user", "unknown"}, nil, &stdout, &stderr); status != 2 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+}
+
+func TestRun_Selftest(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building a module library is slow")
+	}
+	lib := filepath.Join(t.TempDir(), "pam_selftest.so")
+	build := exec.Command("go", "build", "-buildmode=c-shared", "-o", lib, "./testdata/selftest-module")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build #error: %v: %s", err, out)
+	}
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"selftest", lib}, nil, &stdout, &stderr); status != 1 {
+		t.Fatalf("run #error: unexpected status %d, %s", status, stderr.String())
+	}
+	if stdout.String() != "keys: ok\nbackend: connection refused\n" {
+		t.Fatalf("run #error: unexpected output %q", stdout.String())
+	}
+
+	stdout.Reset()
+	if status := run([]string{"selftest", "-json", lib}, nil, &stdout, &stderr); status != 1 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+	var rep selftestReport
+	if err := json.Unmarshal(stdout.Bytes(), &rep); err != nil {
+		t.Fatalf("json #error: %v", err)
+	}
+	if rep.Status != pam.ErrService.String() || len(rep.Results) != 2 || !rep.Results[0].OK || rep.Results[1].OK {
+		t.Fatalf("run #error: unexpected report %+v", rep)
+	}
+}
+
+func TestRun_Info(t *testing.T) {
+	if testing.Short() {
+		t.Skip("building a module library is slow")
+	}
+	lib := filepath.Join(t.TempDir(), "pam_selftest.so")
+	build := exec.Command("go", "build", "-buildmode=c-shared",
+		"-ldflags", "-X github.com/msteinert/pam/selftest.Version=1.2.0",
+		"-o", lib, "./testdata/selftest-module")
+	if out, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("build #error: %v: %s", err, out)
+	}
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"info", lib}, nil, &stdout, &stderr); status != 0 {
+		t.Fatalf("run #error: unexpected status %d, %s", status, stderr.String())
+	}
+	if !strings.HasPrefix(stdout.String(), "version: 1.2.0\npath: github.com/msteinert/pam/cmd/pam-tester/testdata/selftest-module\n") {
+		t.Fatalf("run #error: unexpected output %q", stdout.String())
+	}
+
+	stdout.Reset()
+	if status := run([]string{"info", "-json", lib}, nil, &stdout, &stderr); status != 0 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+	var info moduleInfo
+	if err := json.Unmarshal(stdout.Bytes(), &info); err != nil {
+		t.Fatalf("json #error: %v", err)
+	}
+	if info.Version != "1.2.0" || info.GoVersion == "" {
+		t.Fatalf("run #error: unexpected information %+v", info)
+	}
+	if status := run([]string{"info", "/nonexistent/pam_missing.so"}, nil, &stdout, &stderr); status != 1 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+}
+
+func TestRun_SelftestMissing(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	if status := run([]string{"selftest", "/nonexistent/pam_missing.so"}, nil, &stdout, &stderr); status != 1 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+	if !strings.Contains(stderr.String(), "pam_missing.so") {
+		t.Fatalf("run #error: unexpected error %q", stderr.String())
+	}
+	if status := run([]string{"selftest"}, nil, &stdout, &stderr); status != 2 {
+		t.Fatalf("run #error: unexpected status %d", status)
+	}
+}
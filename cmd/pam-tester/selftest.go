@@ -0,0 +1,222 @@
+package main
+
+/*
+#cgo LDFLAGS: -ldl
+#include <dlfcn.h>
+#include <stdio.h>
+#include <stdlib.h>
+#include <unistd.h>
+
+#define EXPORT_FAILED 255
+
+typedef int (*export_func)(int);
+
+// call_export runs in the process started by callExport, before the Go
+// runtime of pam-tester, so that the module brings the only one. It calls
+// the function PAM_TESTER_EXPORT_NAME of the library PAM_TESTER_EXPORT_PATH,
+// such as pam_go_selftest, with the standard output, and exits with its
+// status, or with EXPORT_FAILED if the library or the function can't be
+// loaded.
+__attribute__((constructor)) static void call_export(void)
+{
+	const char *path = getenv("PAM_TESTER_EXPORT_PATH");
+	const char *name = getenv("PAM_TESTER_EXPORT_NAME");
+	if (path == NULL || name == NULL)
+		return;
+	void *lib = dlopen(path, RTLD_NOW | RTLD_LOCAL);
+	if (lib == NULL) {
+		fprintf(stderr, "%s\n", dlerror());
+		_exit(EXPORT_FAILED);
+	}
+	export_func f = (export_func)dlsym(lib, name);
+	if (f == NULL) {
+		fprintf(stderr, "%s\n", dlerror());
+		_exit(EXPORT_FAILED);
+	}
+	_exit(f(STDOUT_FILENO));
+}
+*/
+import "C"
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// checkResult is the result of a health check of a module, as written by
+// pam_go_selftest.
+type checkResult struct {
+	Name     string        `json:"name"`
+	OK       bool          `json:"ok"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// selftestReport is the JSON output of the selftest command.
+type selftestReport struct {
+	Module  string        `json:"module"`
+	Status  string        `json:"status"`
+	Results []checkResult `json:"results"`
+}
+
+// callExport calls the function name of the module at path, returning its
+// status and what it wrote. The module, built with its own Go runtime, is
+// loaded by call_export in a new pam-tester process, as it can't share one
+// with the runtime of pam-tester.
+func callExport(path, name string) (pam.ReturnType, []byte, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return 0, nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(exe)
+	cmd.Env = append(os.Environ(),
+		"PAM_TESTER_EXPORT_PATH="+path, "PAM_TESTER_EXPORT_NAME="+name)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	err = cmd.Run()
+	var exit *exec.ExitError
+	switch {
+	case errors.As(err, &exit) && exit.ExitCode() == C.EXPORT_FAILED:
+		return 0, nil, errors.New(strings.TrimSpace(stderr.String()))
+	case errors.As(err, &exit) && exit.ExitCode() > 0:
+		return pam.ReturnType(exit.ExitCode()), stdout.Bytes(), nil
+	case err != nil:
+		return 0, nil, err
+	}
+	return pam.Success, stdout.Bytes(), nil
+}
+
+// selftest calls the pam_go_selftest function of the module at path,
+// returning its status and the results of the checks.
+func selftest(path string) (pam.ReturnType, []checkResult, error) {
+	status, out, err := callExport(path, "pam_go_selftest")
+	if err != nil {
+		return 0, nil, err
+	}
+	var results []checkResult
+	scanner := bufio.NewScanner(bytes.NewReader(out))
+	for scanner.Scan() {
+		var res checkResult
+		if err := json.Unmarshal(scanner.Bytes(), &res); err != nil {
+			return 0, nil, fmt.Errorf("invalid result %q: %w", scanner.Text(), err)
+		}
+		results = append(results, res)
+	}
+	return status, results, nil
+}
+
+// runSelftest runs the health checks of a module library.
+func runSelftest(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("pam-tester selftest", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	jsonOutput := fs.Bool("json", false, "print the results as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pam-tester selftest [flags] module.so")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	status, results, err := selftest(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "selftest: %v\n", err)
+		return 1
+	}
+	if *jsonOutput {
+		rep := selftestReport{Module: fs.Arg(0), Status: status.String(), Results: results}
+		if rep.Results == nil {
+			rep.Results = []checkResult{}
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(rep)
+	} else {
+		if status == pam.ErrIgnore {
+			fmt.Fprintln(stdout, "no health checks")
+		}
+		for _, r := range results {
+			if r.OK {
+				fmt.Fprintf(stdout, "%s: ok\n", r.Name)
+			} else {
+				fmt.Fprintf(stdout, "%s: %s\n", r.Name, r.Error)
+			}
+		}
+	}
+	if status != pam.Success && status != pam.ErrIgnore {
+		return 1
+	}
+	return 0
+}
+
+// moduleInfo is the build information of a module, as written by
+// pam_go_module_info.
+type moduleInfo struct {
+	Version   string `json:"version,omitempty"`
+	Path      string `json:"path,omitempty"`
+	GoVersion string `json:"go_version,omitempty"`
+	Revision  string `json:"revision,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// runInfo prints the build information of a module library.
+func runInfo(args []string, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("pam-tester info", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	jsonOutput := fs.Bool("json", false, "print the information as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "usage: pam-tester info [flags] module.so")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	status, out, err := callExport(fs.Arg(0), "pam_go_module_info")
+	if err == nil && status != pam.Success {
+		err = status
+	}
+	var info moduleInfo
+	if err == nil {
+		err = json.Unmarshal(out, &info)
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "info: %v\n", err)
+		return 1
+	}
+	if *jsonOutput {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(info)
+		return 0
+	}
+	fmt.Fprintf(stdout, "version: %s\n", cmp.Or(info.Version, "unknown"))
+	fmt.Fprintf(stdout, "path: %s\n", info.Path)
+	fmt.Fprintf(stdout, "go: %s\n", info.GoVersion)
+	if info.Revision != "" {
+		modified := ""
+		if info.Modified {
+			modified = " (modified)"
+		}
+		fmt.Fprintf(stdout, "revision: %s%s\n", info.Revision, modified)
+	}
+	return 0
+}
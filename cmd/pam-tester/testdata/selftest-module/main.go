@@ -0,0 +1,20 @@
+// A module library registering health checks, built by the tests.
+package main
+
+import "C"
+
+import (
+	"context"
+	"errors"
+
+	"github.com/msteinert/pam/selftest"
+)
+
+func init() {
+	selftest.RegisterFunc("keys", func(context.Context) error { return nil })
+	selftest.RegisterFunc("backend", func(context.Context) error {
+		return errors.New("connection refused")
+	})
+}
+
+func main() {}
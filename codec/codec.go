@@ -0,0 +1,97 @@
+// Package codec serializes the text conversation messages and the errors
+// of PAM, for the applications forwarding the conversations of their
+// transactions to other processes, such as the broker package does.
+//
+// The types have exported fields and JSON tags, so that they can be encoded
+// with encoding/json or encoding/gob as they are. Register registers them
+// with gob, to send them as interface values.
+package codec
+
+import (
+	"encoding/gob"
+	"errors"
+
+	"github.com/msteinert/pam"
+)
+
+// StringConvRequest is the serializable form of a pam.StringConvRequest.
+type StringConvRequest struct {
+	Style  pam.Style `json:"style"`
+	Prompt string    `json:"prompt"`
+}
+
+// NewStringConvRequest returns the serializable form of r.
+func NewStringConvRequest(r pam.StringConvRequest) StringConvRequest {
+	return StringConvRequest{r.Style(), r.Prompt()}
+}
+
+// ConvRequest returns the request r is the serializable form of.
+func (r StringConvRequest) ConvRequest() pam.StringConvRequest {
+	return pam.NewStringConvRequest(r.Style, r.Prompt)
+}
+
+// StringConvResponse is the serializable form of a pam.StringConvResponse.
+type StringConvResponse struct {
+	Style    pam.Style `json:"style"`
+	Response string    `json:"response,omitempty"`
+}
+
+// NewStringConvResponse returns the serializable form of r.
+func NewStringConvResponse(r pam.StringConvResponse) StringConvResponse {
+	return StringConvResponse{r.Style(), r.Response()}
+}
+
+// ConvResponse returns the response r is the serializable form of.
+func (r StringConvResponse) ConvResponse() pam.StringConvResponse {
+	return pam.NewStringConvResponse(r.Style, r.Response)
+}
+
+// Error is the serializable form of an error, keeping its PAM status, if
+// any, so that errors.Is matches the same pam.ReturnType once decoded. The
+// other errors it wraps are only kept as message.
+type Error struct {
+	Status  pam.ReturnType `json:"status,omitempty"`
+	Message string         `json:"message,omitempty"`
+}
+
+// NewError returns the serializable form of err, nil if err is nil.
+func NewError(err error) *Error {
+	if err == nil {
+		return nil
+	}
+	e := &Error{Message: err.Error()}
+	errors.As(err, &e.Status)
+	return e
+}
+
+// Err returns e as error, nil if e is nil, rather than a non-nil error
+// holding a nil *Error.
+func (e *Error) Err() error {
+	if e == nil {
+		return nil
+	}
+	return e
+}
+
+func (e *Error) Error() string {
+	if e.Message == "" && e.Status != pam.Success {
+		return e.Status.Error()
+	}
+	return e.Message
+}
+
+// Unwrap returns the PAM status of the error, if any.
+func (e *Error) Unwrap() error {
+	if e.Status == pam.Success {
+		return nil
+	}
+	return e.Status
+}
+
+// Register registers the types with gob, to encode them as interface
+// values. It can be called more than once.
+func Register() {
+	gob.Register(StringConvRequest{})
+	gob.Register(StringConvResponse{})
+	gob.Register(&Error{})
+}
@@ -0,0 +1,83 @@
+package codec
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func TestJSON(t *testing.T) {
+	req := NewStringConvRequest(pam.NewStringConvRequest(pam.PromptEchoOff, "Password: "))
+	resp := NewStringConvResponse(pam.NewStringConvResponse(pam.PromptEchoOff, "secret"))
+	for _, tc := range []struct {
+		v        any
+		expected string
+	}{
+		{req, `{"style":1,"prompt":"Password: "}`},
+		{resp, `{"style":1,"response":"secret"}`},
+		{NewError(fmt.Errorf("denied: %w", pam.ErrAuth)), `{"status":7,"message":"denied: Authentication failure"}`},
+	} {
+		b, err := json.Marshal(tc.v)
+		if err != nil || string(b) != tc.expected {
+			t.Fatalf("marshal #error: expected %s, got %s, %v", tc.expected, b, err)
+		}
+		decoded := reflect.New(reflect.TypeOf(tc.v))
+		if err := json.Unmarshal(b, decoded.Interface()); err != nil {
+			t.Fatalf("unmarshal #error: %v", err)
+		}
+		if !reflect.DeepEqual(decoded.Elem().Interface(), tc.v) {
+			t.Fatalf("unmarshal #error: expected %+v, got %+v", tc.v, decoded.Elem())
+		}
+	}
+	if r := req.ConvRequest(); r.Style() != pam.PromptEchoOff || r.Prompt() != "Password: " {
+		t.Fatalf("convrequest #error: unexpected request %v", r)
+	}
+	if r := resp.ConvResponse(); r.Style() != pam.PromptEchoOff || r.Response() != "secret" {
+		t.Fatalf("convresponse #error: unexpected response %v", r)
+	}
+}
+
+func TestGob(t *testing.T) {
+	Register()
+	Register()
+	sent := []any{
+		StringConvRequest{pam.TextInfo, "Hello"},
+		StringConvResponse{pam.PromptEchoOn, "alice"},
+		NewError(pam.ErrConv),
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(sent); err != nil {
+		t.Fatalf("encode #error: %v", err)
+	}
+	var received []any
+	if err := gob.NewDecoder(&buf).Decode(&received); err != nil {
+		t.Fatalf("decode #error: %v", err)
+	}
+	if !reflect.DeepEqual(received, sent) {
+		t.Fatalf("decode #error: expected %v, got %v", sent, received)
+	}
+}
+
+func TestError(t *testing.T) {
+	if e := NewError(nil); e != nil || e.Err() != nil {
+		t.Fatalf("newerror #error: unexpected error %v", e)
+	}
+	cause := errors.New("no terminal")
+	err := NewError(&pam.ConvError{Index: -1, Cause: cause, Status: pam.ErrConv}).Err()
+	if !errors.Is(err, pam.ErrConv) || errors.Is(err, cause) {
+		t.Fatalf("newerror #error: unexpected error %v", err)
+	}
+	err = NewError(cause).Err()
+	if err.Error() != cause.Error() || errors.Unwrap(err) != nil {
+		t.Fatalf("newerror #error: unexpected error %v", err)
+	}
+	if err := (&Error{Status: pam.ErrAuth}); err.Error() != pam.ErrAuth.Error() {
+		t.Fatalf("error #error: unexpected message %q", err.Error())
+	}
+}
@@ -0,0 +1,7 @@
+//go:build pam_nostartconfdir
+
+package pam
+
+// noStartConfdir makes the package behave as if pam_start_confdir was not
+// available, to test the code handling its absence.
+const noStartConfdir = true
@@ -0,0 +1,204 @@
+// Package configwatch reloads the configuration files of the modules written
+// in Go, whose processes live as long as the daemons loading them, such as
+// sshd: the changes of the files apply to the following PAM calls without
+// restarting the daemons.
+//
+// A module handler embeds a Watcher and takes the configuration with Config
+// once at the start of each call, so that a call sees a single version of
+// it even if the file changes meanwhile. Config reloads the file itself
+// when it has changed, and Run watches it in the background, with inotify
+// on Linux, for the handlers needing the changes as soon as they happen.
+package configwatch
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Default timings of a Watcher.
+const (
+	DefaultInterval = 2 * time.Second
+	DefaultDebounce = 200 * time.Millisecond
+)
+
+// Watcher holds the configuration loaded from a file, replacing it once the
+// file has changed. Its methods can be used by multiple goroutines at the
+// same time.
+type Watcher[T any] struct {
+	// Path is the path of the file.
+	Path string
+	// Load parses the file at path.
+	Load func(path string) (T, error)
+	// Interval is the minimum time between the checks of the file by
+	// Config, and between those of Run without inotify,
+	// DefaultInterval if 0.
+	Interval time.Duration
+	// Debounce is how long the file must be left unchanged before it is
+	// loaded, so that the files being written are not loaded half way,
+	// DefaultDebounce if 0.
+	Debounce time.Duration
+	// OnError, if not nil, is called with the failures to load the
+	// changed files, the previous configuration being kept.
+	OnError func(error)
+	// Now returns the current time, time.Now if nil.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	current atomic.Pointer[T]
+	stamp   fs.FileInfo
+	checked time.Time
+}
+
+// New returns a watcher of the configuration file at path, loaded with load
+// at once.
+func New[T any](path string, load func(path string) (T, error)) (*Watcher[T], error) {
+	w := &Watcher[T]{Path: path, Load: load}
+	if err := w.Reload(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *Watcher[T]) now() time.Time {
+	if w.Now != nil {
+		return w.Now()
+	}
+	return time.Now()
+}
+
+func (w *Watcher[T]) interval() time.Duration {
+	if w.Interval > 0 {
+		return w.Interval
+	}
+	return DefaultInterval
+}
+
+func (w *Watcher[T]) debounce() time.Duration {
+	if w.Debounce > 0 {
+		return w.Debounce
+	}
+	return DefaultDebounce
+}
+
+// Config returns the current configuration, first reloading the file if it
+// has changed since it was last checked, at most once per Interval. It is
+// the zero value if the file has never been loaded.
+func (w *Watcher[T]) Config() T {
+	w.mu.Lock()
+	if now := w.now(); now.Sub(w.checked) >= w.interval() {
+		w.checked = now
+		w.check(false)
+	}
+	w.mu.Unlock()
+	return w.Value()
+}
+
+// Value returns the current configuration without checking the file.
+func (w *Watcher[T]) Value() T {
+	if p := w.current.Load(); p != nil {
+		return *p
+	}
+	var zero T
+	return zero
+}
+
+// Reload loads the file, even if it has not changed. The previous
+// configuration is kept if it fails.
+func (w *Watcher[T]) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	info, err := os.Stat(w.Path)
+	if err != nil {
+		return err
+	}
+	return w.load(info)
+}
+
+func (w *Watcher[T]) load(info fs.FileInfo) error {
+	// The file is stamped before being read: if it changes meanwhile,
+	// it is loaded again.
+	w.stamp = info
+	c, err := w.Load(w.Path)
+	if err != nil {
+		return err
+	}
+	w.current.Store(&c)
+	return nil
+}
+
+// check loads the file if it has changed and has been left unchanged for
+// Debounce, unless debounced is true, reporting the failures to OnError.
+func (w *Watcher[T]) check(debounced bool) {
+	info, err := os.Stat(w.Path)
+	if errors.Is(err, fs.ErrNotExist) && w.stamp == nil {
+		return
+	}
+	if err == nil && !changed(w.stamp, info) {
+		return
+	}
+	if err == nil && !debounced && w.now().Sub(info.ModTime()) < w.debounce() {
+		// Checked again once written.
+		w.checked = time.Time{}
+		return
+	}
+	if err == nil {
+		err = w.load(info)
+	}
+	if err != nil && w.OnError != nil {
+		w.OnError(err)
+	}
+}
+
+// changed returns whether the file was replaced or modified.
+func changed(old, cur fs.FileInfo) bool {
+	return old == nil || !os.SameFile(old, cur) ||
+		!old.ModTime().Equal(cur.ModTime()) || old.Size() != cur.Size()
+}
+
+// Run watches the file until ctx is done, reloading it once it has changed
+// and Debounce has elapsed without other changes. It uses inotify on Linux,
+// watching the directory of the file so that the files replaced by renaming
+// others are noticed, and checks the file every Interval otherwise.
+func (w *Watcher[T]) Run(ctx context.Context) error {
+	events, stop := notify(filepath.Dir(w.Path), filepath.Base(w.Path))
+	defer stop()
+	poll := w.interval()
+	if events != nil {
+		// The inotify events may still be missed, for example if the
+		// directory is replaced.
+		poll *= 30
+	}
+	ticker := time.NewTicker(poll)
+	defer ticker.Stop()
+	var debounce *time.Timer
+	var fire <-chan time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-events:
+			if debounce == nil {
+				debounce = time.NewTimer(w.debounce())
+				defer debounce.Stop()
+			} else {
+				debounce.Reset(w.debounce())
+			}
+			fire = debounce.C
+		case <-fire:
+			fire = nil
+			w.mu.Lock()
+			w.check(true)
+			w.mu.Unlock()
+		case <-ticker.C:
+			w.mu.Lock()
+			w.check(false)
+			w.mu.Unlock()
+		}
+	}
+}
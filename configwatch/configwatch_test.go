@@ -0,0 +1,117 @@
+package configwatch
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func loadText(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	if strings.HasPrefix(string(data), "bad") {
+		return "", errors.New("bad configuration")
+	}
+	return string(data), nil
+}
+
+func writeFile(t *testing.T, path, data string, mtime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatalf("write #error: %v", err)
+	}
+	if err := os.Chtimes(path, mtime, mtime); err != nil {
+		t.Fatalf("chtimes #error: %v", err)
+	}
+}
+
+func TestWatcher_Config(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "module.conf")
+	now := time.Now().Truncate(time.Second)
+	writeFile(t, path, "one", now)
+	w, err := New(path, loadText)
+	if err != nil {
+		t.Fatalf("new #error: %v", err)
+	}
+	var errs []error
+	w.OnError = func(err error) { errs = append(errs, err) }
+	w.Now = func() time.Time { return now }
+	if c := w.Config(); c != "one" {
+		t.Fatalf("config #error: expected one, got %q", c)
+	}
+
+	// Not checked before Interval.
+	writeFile(t, path, "two", now)
+	if c := w.Config(); c != "one" {
+		t.Fatalf("config #error: expected one, got %q", c)
+	}
+	// Not loaded before Debounce.
+	now = now.Add(DefaultInterval)
+	writeFile(t, path, "three", now)
+	if c := w.Config(); c != "one" {
+		t.Fatalf("config #error: expected one, got %q", c)
+	}
+	now = now.Add(DefaultDebounce)
+	if c := w.Config(); c != "three" {
+		t.Fatalf("config #error: expected three, got %q", c)
+	}
+
+	now = now.Add(DefaultInterval)
+	writeFile(t, path, "bad", now.Add(-time.Second))
+	if c := w.Config(); c != "three" || len(errs) != 1 {
+		t.Fatalf("config #error: expected three and an error, got %q, %v", c, errs)
+	}
+	// The failure is not reported again until the file changes.
+	now = now.Add(DefaultInterval)
+	if c := w.Config(); c != "three" || len(errs) != 1 {
+		t.Fatalf("config #error: expected three and an error, got %q, %v", c, errs)
+	}
+
+	if err := w.Reload(); err == nil {
+		t.Fatalf("reload #error: expected a failure")
+	}
+	if _, err := New(filepath.Join(t.TempDir(), "missing.conf"), loadText); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("new #error: expected %v, got %v", os.ErrNotExist, err)
+	}
+}
+
+func TestWatcher_Run(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "module.conf")
+	writeFile(t, path, "one", time.Now())
+	w, err := New(path, loadText)
+	if err != nil {
+		t.Fatalf("new #error: %v", err)
+	}
+	w.Interval = 50 * time.Millisecond
+	w.Debounce = 10 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- w.Run(ctx) }()
+
+	// Replace the file as the editors do.
+	time.Sleep(20 * time.Millisecond)
+	tmp := filepath.Join(dir, "module.conf.new")
+	writeFile(t, tmp, "two", time.Now().Add(-time.Second))
+	if err := os.Rename(tmp, path); err != nil {
+		t.Fatalf("rename #error: %v", err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for w.Value() != "two" {
+		if time.Now().After(deadline) {
+			t.Fatalf("run #error: expected two, got %q", w.Value())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("run #error: expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux
+
+package configwatch
+
+// notify returns a nil channel, the files being polled.
+func notify(dir, name string) (events <-chan struct{}, stop func()) {
+	return nil, func() {}
+}
@@ -0,0 +1,86 @@
+package pam
+
+import (
+	"context"
+	"errors"
+)
+
+// withContext runs an operation of the transaction with ctx, see
+// setContext. It fails without calling PAM if ctx is already done, recording
+// the failure as an operation failing once its conversation failed does.
+func (t *Transaction) withContext(ctx context.Context, op func() error) error {
+	if err := ctx.Err(); err != nil {
+		convErr := &ConvError{Index: -1, Cause: err, Status: ErrConv}
+		t.setStatus(ErrConv)
+		if t.conversation != nil {
+			t.conversation.err = convErr
+		}
+		return convErr
+	}
+	defer t.setContext(ctx)()
+	return op()
+}
+
+// AuthenticateContext is Authenticate aborting the conversations once ctx
+// is done: those running return at once, failing with ErrConv and the
+// error of ctx as their ConvError, while their handlers keep running in
+// the background until they return, their responses being discarded, and
+// their calls of the transaction failing with ErrTransactionEnded unless it
+// was started WithLockedThread. The following conversations fail as soon as
+// they start.
+//
+// PAM calls can't be interrupted: the operation returns once the modules
+// do, usually failing after their conversations failed, but modules may
+// recover from them, such as optional ones, or be blocked elsewhere.
+// Operations started with ctx already done fail with ErrConv without
+// calling PAM.
+func (t *Transaction) AuthenticateContext(ctx context.Context, f Flags) error {
+	return t.withContext(ctx, func() error { return t.Authenticate(f) })
+}
+
+// SetCredContext is SetCred with a context, see AuthenticateContext.
+func (t *Transaction) SetCredContext(ctx context.Context, f Flags) error {
+	return t.withContext(ctx, func() error { return t.SetCred(f) })
+}
+
+// AcctMgmtContext is AcctMgmt with a context, see AuthenticateContext.
+func (t *Transaction) AcctMgmtContext(ctx context.Context, f Flags) error {
+	return t.withContext(ctx, func() error { return t.AcctMgmt(f) })
+}
+
+// ChangeAuthTokContext is ChangeAuthTok with a context, see
+// AuthenticateContext.
+func (t *Transaction) ChangeAuthTokContext(ctx context.Context, f Flags) error {
+	return t.withContext(ctx, func() error { return t.ChangeAuthTok(f) })
+}
+
+// OpenSessionContext is OpenSession with a context, see
+// AuthenticateContext.
+func (t *Transaction) OpenSessionContext(ctx context.Context, f Flags) error {
+	return t.withContext(ctx, func() error { return t.OpenSession(f) })
+}
+
+// CloseSessionContext is CloseSession with a context, see
+// AuthenticateContext.
+func (t *Transaction) CloseSessionContext(ctx context.Context, f Flags) error {
+	return t.withContext(ctx, func() error { return t.CloseSession(f) })
+}
+
+// ErrInterrupted is the cause of the conversations of the interrupted
+// transactions, see Interrupt.
+var ErrInterrupted = errors.New("pam: transaction interrupted")
+
+// Interrupt fails the running conversation of the transaction, if any, and
+// all the following ones, with ErrConv and ErrInterrupted as their
+// ConvError, for example to cancel a login while the handler waits for the
+// user. The handlers running keep running in the background until they
+// return, their responses being discarded, as for AuthenticateContext. It
+// can be called by any goroutine, more than once.
+//
+// As with AuthenticateContext, the operation returns once the modules do,
+// usually failing after their conversations failed.
+func (t *Transaction) Interrupt() {
+	if t.conversation != nil {
+		t.conversation.interrupt(ErrInterrupted)
+	}
+}
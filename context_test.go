@@ -0,0 +1,243 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/user"
+	"testing"
+	"time"
+)
+
+func TestTransaction_AuthenticateContext(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	release := make(chan struct{})
+	defer close(release)
+	var messages []string
+	blocked := false
+	tx, err := StartConfDir("echo-service", "", ConversationFunc(func(s Style, msg string) (string, error) {
+		if blocked {
+			<-release
+		}
+		messages = append(messages, msg)
+		return "", nil
+	}), "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	u, _ := user.Current()
+	if err := tx.SetItem(User, u.Username); err != nil {
+		t.Fatalf("setitem #error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := tx.AuthenticateContext(ctx, 0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if len(messages) != 1 {
+		t.Fatalf("authenticate #error: unexpected messages %v", messages)
+	}
+
+	blocked = true
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	// pam_echo is optional: the stack recovers from the aborted
+	// conversation.
+	if err := tx.AuthenticateContext(ctx, 0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("authenticate #error: blocked for %v", d)
+	}
+	if err := tx.ConversationError(); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("authenticate #error: expected %v, got %v", context.DeadlineExceeded, err)
+	}
+
+	err = tx.AcctMgmtContext(ctx, 0)
+	if !errors.Is(err, ErrConv) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("acctmgmt #error: expected %v, got %v", ErrConv, err)
+	}
+	if s := tx.Status(); s != ErrConv {
+		t.Fatalf("acctmgmt #error: expected status %v, got %v", ErrConv, s)
+	}
+	if s := ReturnType(tx.endStatus.Load()); s != ErrConv {
+		t.Fatalf("acctmgmt #error: expected end status %v, got %v", ErrConv, s)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := tx.SetCredContext(ctx, EstablishCred); !errors.Is(err, context.Canceled) {
+		t.Fatalf("setcred #error: expected %v, got %v", context.Canceled, err)
+	}
+	if err := tx.ConversationError(); !errors.Is(err, context.Canceled) {
+		t.Fatalf("setcred #error: expected %v, got %v", context.Canceled, err)
+	}
+}
+
+func TestTransaction_Interrupt(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{}, 1)
+	tx, err := StartConfDir("echo-service", "", ConversationFunc(func(s Style, msg string) (string, error) {
+		started <- struct{}{}
+		<-release
+		return "", nil
+	}), "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	u, _ := user.Current()
+	if err := tx.SetItem(User, u.Username); err != nil {
+		t.Fatalf("setitem #error: %v", err)
+	}
+	go func() {
+		<-started
+		tx.Interrupt()
+	}()
+	start := time.Now()
+	// pam_echo is optional: the stack recovers from the interrupted
+	// conversation.
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("authenticate #error: blocked for %v", d)
+	}
+	if err := tx.ConversationError(); !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrInterrupted, err)
+	}
+
+	// The following conversations fail at once.
+	tx.Interrupt()
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if len(started) != 0 {
+		t.Fatalf("authenticate #error: handler called once interrupted")
+	}
+	if err := tx.ConversationError(); !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrInterrupted, err)
+	}
+}
+
+func TestWithConvTimeout(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	release := make(chan struct{})
+	defer close(release)
+	u, _ := user.Current()
+	tx, err := StartWithOptions("echo-service", WithConfDir("test-services"), WithUser(u.Username),
+		WithConvTimeout(50*time.Millisecond),
+		WithConversationHandler(ConversationFunc(func(s Style, msg string) (string, error) {
+			<-release
+			return "", nil
+		})))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	start := time.Now()
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if d := time.Since(start); d > 5*time.Second {
+		t.Fatalf("authenticate #error: blocked for %v", d)
+	}
+	if err := tx.ConversationError(); !errors.Is(err, ErrPromptTimeout) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrPromptTimeout, err)
+	}
+}
+
+func TestWithConvTimeout_LockedThread(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	var tx *Transaction
+	var user string
+	tx, err := StartWithOptions("echo-service", WithConfDir("test-services"), WithUser(u.Username),
+		WithLockedThread(), WithConvTimeout(5*time.Second),
+		WithConversationHandler(ConversationFunc(func(s Style, msg string) (string, error) {
+			var err error
+			user, err = tx.GetItem(User)
+			return "", err
+		})))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	start := time.Now()
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("authenticate #error: blocked for %v", d)
+	}
+	if err := tx.ConversationError(); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if user != u.Username {
+		t.Fatalf("getitem #error: expected %q, got %q", u.Username, user)
+	}
+}
+
+func TestWithConvTimeout_Abandoned(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	release, done := make(chan struct{}), make(chan struct{})
+	calls := func(tx *Transaction) {
+		for i := range 32 {
+			tx.GetEnv(fmt.Sprintf("VAR%d", i))
+		}
+	}
+	var abandonedErr error
+	var tx *Transaction
+	tx, err := StartWithOptions("echo-service", WithConfDir("test-services"), WithUser(u.Username),
+		WithConvTimeout(10*time.Millisecond),
+		WithConversationHandler(ConversationFunc(func(s Style, msg string) (string, error) {
+			defer close(done)
+			<-release
+			// The handler keeps calling the transaction once
+			// abandoned, while the application does too, but its
+			// calls fail.
+			calls(tx)
+			_, abandonedErr = tx.GetItem(User)
+			return "", nil
+		})))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	for i := range 32 {
+		if err := tx.PutEnv(fmt.Sprintf("VAR%d=%d", i, i)); err != nil {
+			t.Fatalf("putenv #error: %v", err)
+		}
+	}
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := tx.ConversationError(); !errors.Is(err, ErrPromptTimeout) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrPromptTimeout, err)
+	}
+	close(release)
+	calls(tx)
+	<-done
+	if !errors.Is(abandonedErr, ErrTransactionEnded) {
+		t.Fatalf("getitem #error: expected %v, got %v", ErrTransactionEnded, abandonedErr)
+	}
+	if _, err := tx.GetItem(User); err != nil {
+		t.Fatalf("getitem #error: %v", err)
+	}
+}
@@ -0,0 +1,195 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+	"unsafe"
+)
+
+// ConversationHandler is an interface for objects that can be used as
+// conversation callbacks during PAM authentication.
+type ConversationHandler interface {
+	// RespondPAM receives a message style and a message string. If the
+	// message Style is PromptEchoOff or PromptEchoOn then the function
+	// should return a response string.
+	RespondPAM(Style, string) (string, error)
+}
+
+// BinaryPointer exposes the type used for the data in a binary conversation
+// it represents a pointer to data that is produced by the module and that
+// must be parsed depending on the protocol in use
+type BinaryPointer unsafe.Pointer
+
+type BinaryConversationHandler interface {
+	ConversationHandler
+	// Respond receives a pointer to the binary message. It's up to the
+	// receiver to parse it according to the protocol specifications.
+	// The function can return a byte array that will passed as pointer back
+	// to the module.
+	RespondPAMBinary(BinaryPointer) ([]byte, error)
+}
+
+// BytesConversationHandler is a conversation handler that receives the
+// messages and returns the responses as bytes, avoiding the allocation of Go
+// strings for each of them. It is preferred over RespondPAM when implemented.
+type BytesConversationHandler interface {
+	ConversationHandler
+	// RespondPAMBytes receives a message style and the message bytes,
+	// which are only valid during the call and must not be modified. The
+	// response is copied, so the handler can reuse or wipe its buffer
+	// once the function returns.
+	RespondPAMBytes(Style, []byte) ([]byte, error)
+}
+
+// ConversationFunc is an adapter to allow the use of ordinary functions as
+// conversation callbacks.
+type ConversationFunc func(Style, string) (string, error)
+
+// RespondPAM is a conversation callback adapter.
+func (f ConversationFunc) RespondPAM(s Style, msg string) (string, error) {
+	return f(s, msg)
+}
+
+// BytesConversationFunc is an adapter to allow the use of ordinary functions
+// as bytes conversation callbacks.
+type BytesConversationFunc func(Style, []byte) ([]byte, error)
+
+// RespondPAM is a conversation callback adapter.
+func (f BytesConversationFunc) RespondPAM(s Style, msg string) (string, error) {
+	r, err := f(s, []byte(msg))
+	return string(r), err
+}
+
+// RespondPAMBytes is a bytes conversation callback adapter.
+func (f BytesConversationFunc) RespondPAMBytes(s Style, msg []byte) ([]byte, error) {
+	return f(s, msg)
+}
+
+// ConversationMessage is a message sent by a module in a conversation.
+type ConversationMessage struct {
+	Style   Style
+	Message string
+}
+
+// ConversationMultiHandler is a conversation handler that receives all the
+// messages sent by a module in a single conversation at once, for example
+// to show them in the same dialog. Conversations including binary prompts
+// are still handled one message at a time.
+type ConversationMultiHandler interface {
+	ConversationHandler
+	// RespondPAMMulti receives the messages and returns one response for
+	// each of them, empty for the messages that are not prompts.
+	RespondPAMMulti([]ConversationMessage) ([]string, error)
+}
+
+// conversation is the state of the conversations of a transaction,
+// referenced by the C conversation callback through a handle.
+type conversation struct {
+	handler ConversationHandler
+	// The optional interfaces of the handler, resolved once rather than
+	// for each message.
+	binary BinaryConversationHandler
+	bytes  BytesConversationHandler
+	multi  ConversationMultiHandler
+	// err is the failure of the last conversation of the current
+	// operation.
+	err *ConvError
+	// state is the state of the transaction.
+	state *transactionState
+	// service is the name of the service of the transaction.
+	service string
+	// id identifies the transaction in the events.
+	id handle
+	// subscribers are the observers of the transaction.
+	subscribers *subscribers
+	// ctx is the context of the running operation, if any: the
+	// conversations fail once it is done.
+	ctx context.Context
+	// messages, if not nil, collects the ErrorMsg and TextInfo messages
+	// of the running operation.
+	messages *[]ConversationMessage
+	// failDelay, if not nil, is called instead of delaying the failed
+	// operations, see SetFailDelayHandler.
+	failDelay func(status ReturnType, delay time.Duration)
+	// interrupted is canceled by Interrupt, failing the conversations
+	// with its cause.
+	interrupted context.Context
+	interrupt   context.CancelCauseFunc
+	// timeout, if not zero, is how long the handler has to respond to
+	// the messages of a conversation, see WithConvTimeout.
+	timeout time.Duration
+	// thread is the locked thread of the transaction, if any, whose
+	// handlers run in the conversation callbacks unless they can be
+	// aborted by a context or a timeout.
+	thread *lockedThread
+	// limits are the limits of the conversations, see WithConvLimits.
+	limits ConvLimits
+}
+
+// newConversation returns the conversation state of a transaction using
+// the handler.
+func newConversation(handler ConversationHandler, state *transactionState, service string) *conversation {
+	conv := &conversation{state: state, service: service}
+	conv.setHandler(handler)
+	conv.interrupted, conv.interrupt = context.WithCancelCause(context.Background())
+	return conv
+}
+
+// setHandler sets the handler of the conversations, resolving its optional
+// interfaces.
+func (conv *conversation) setHandler(handler ConversationHandler) {
+	conv.handler = handler
+	conv.binary, _ = handler.(BinaryConversationHandler)
+	conv.bytes, _ = handler.(BytesConversationHandler)
+	conv.multi, _ = handler.(ConversationMultiHandler)
+}
+
+// reset clears the failure of the previous operation.
+func (conv *conversation) reset() {
+	if conv != nil {
+		conv.err = nil
+	}
+}
+
+// ConvError describes the failure of a conversation. Operations failing
+// after a conversation failed return it, so that errors.Is matches both
+// its Cause and the Status of the operation.
+type ConvError struct {
+	// Index is the index of the failed message in the conversation, or
+	// -1 if the conversation failed as a whole.
+	Index int
+	// Style is the style of the failed message.
+	Style Style
+	// Prompt is the failed message, empty for binary prompts.
+	Prompt string
+	// Cause is the reason of the failure.
+	Cause error
+	// Status is the status of the operation, once it has failed.
+	Status ReturnType
+}
+
+func (e *ConvError) Error() string {
+	msg := "conversation failed"
+	if e.Index >= 0 {
+		msg = fmt.Sprintf("conversation message %d (%v %q) failed", e.Index, e.Style, e.Prompt)
+	}
+	msg = fmt.Sprintf("%s: %v", msg, e.Cause)
+	if e.Status != Success {
+		msg = fmt.Sprintf("%v: %s", e.Status.Error(), msg)
+	}
+	return msg
+}
+
+// Unwrap returns the cause of the failure and the status of the operation.
+func (e *ConvError) Unwrap() []error {
+	if e.Status == Success {
+		return []error{e.Cause}
+	}
+	return []error{e.Cause, e.Status}
+}
+
+// errBinaryUnsupported is the failure of binary prompts sent to handlers
+// not implementing BinaryConversationHandler.
+var errBinaryUnsupported = errors.New("binary prompts are not supported by the handler")
@@ -0,0 +1,48 @@
+//go:build cgo
+
+package pam
+
+//#include <security/pam_appl.h>
+//int call_pam_conv(const struct pam_conv *conv, int num_msg, struct pam_message **msg, struct pam_response **resp);
+import "C"
+
+import "unsafe"
+
+// callConv runs the conversation function of the transaction as a module
+// would, sending the messages of the styles, in C memory, all at once, and
+// returns the responses, in C memory owned by the caller. Applications
+// don't start conversations, PAM does for the modules: this only lets the
+// tests send the conversations the stock modules never start, such as those
+// with multiple or binary messages, as the test files can't use cgo.
+func (t *Transaction) callConv(styles []Style, messages []unsafe.Pointer) ([]unsafe.Pointer, error) {
+	if r, err, ok := diverted2(t.thread, func() ([]unsafe.Pointer, error) { return t.callConv(styles, messages) }); ok {
+		return r, err
+	}
+	if err := t.state.enter(); err != nil {
+		return nil, err
+	}
+	defer t.state.leave()
+	msg := (**C.struct_pam_message)(cCalloc(C.size_t(len(messages)+1),
+		C.size_t(unsafe.Sizeof((*C.struct_pam_message)(nil)))))
+	defer cFree(unsafe.Pointer(msg))
+	msgs := unsafe.Slice(msg, len(messages))
+	for i, m := range messages {
+		msgs[i] = (*C.struct_pam_message)(cCalloc(1, C.sizeof_struct_pam_message))
+		defer cFree(unsafe.Pointer(msgs[i]))
+		msgs[i].msg_style = C.int(styles[i])
+		msgs[i].msg = (*C.char)(m)
+	}
+	var resp *C.struct_pam_response
+	t.conversation.reset()
+	status := C.call_pam_conv(&t.conv, C.int(len(messages)), msg, &resp)
+	if err := t.operationResult(status); err != nil {
+		return nil, err
+	}
+	// The responses are owned by the caller of the conversation.
+	defer freeForeign(unsafe.Pointer(resp))
+	responses := make([]unsafe.Pointer, len(messages))
+	for i, r := range unsafe.Slice(resp, len(messages)) {
+		responses[i] = unsafe.Pointer(r.resp)
+	}
+	return responses, nil
+}
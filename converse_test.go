@@ -0,0 +1,272 @@
+package pam
+
+import (
+	"errors"
+	"os/user"
+	"reflect"
+	"strings"
+	"testing"
+	"unsafe"
+)
+
+// converse runs the conversation function of the transaction as a module
+// would, sending all the messages at once, and returns their responses.
+// The binary messages and their responses hold the framed data.
+func (t *Transaction) converse(messages []ConversationMessage) ([]string, error) {
+	styles := make([]Style, len(messages))
+	ptrs := make([]unsafe.Pointer, len(messages))
+	for i, m := range messages {
+		styles[i] = m.Style
+		msg := []byte(m.Message)
+		if m.Style != BinaryPrompt {
+			msg = append(msg, 0)
+		}
+		ptrs[i] = cBytes(msg)
+		defer cFree(ptrs[i])
+	}
+	resp, err := t.callConv(styles, ptrs)
+	if err != nil {
+		return nil, err
+	}
+	responses := make([]string, len(resp))
+	for i, p := range resp {
+		if p == nil {
+			continue
+		}
+		n := 0
+		if styles[i] == BinaryPrompt {
+			n = int(binaryPromptSize(BinaryPointer(p)))
+		} else {
+			for *(*byte)(unsafe.Add(p, n)) != 0 {
+				n++
+			}
+		}
+		r := unsafe.Slice((*byte)(p), n)
+		responses[i] = string(r)
+		clear(r)
+		freeForeign(p)
+	}
+	return responses, nil
+}
+
+type multiHandler struct {
+	Credentials
+	calls     [][]ConversationMessage
+	responses []string
+}
+
+func (h *multiHandler) RespondPAMMulti(messages []ConversationMessage) ([]string, error) {
+	h.calls = append(h.calls, messages)
+	return h.responses, nil
+}
+
+func conversationStart(t *testing.T, handler ConversationHandler) *Transaction {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	tx, err := StartConfDir("permit-service", u.Username, handler, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	return tx
+}
+
+var conversationMessages = []ConversationMessage{
+	{TextInfo, "Welcome"},
+	{PromptEchoOn, "login:"},
+	{PromptEchoOff, "Password:"},
+}
+
+func TestConversation_Multi(t *testing.T) {
+	h := &multiHandler{responses: []string{"", "user", "secret"}}
+	tx := conversationStart(t, h)
+	r, err := tx.converse(conversationMessages)
+	if err != nil {
+		t.Fatalf("converse #error: %v", err)
+	}
+	if !reflect.DeepEqual(r, h.responses) {
+		t.Fatalf("converse #error: expected %q, got %q", h.responses, r)
+	}
+	if len(h.calls) != 1 || !reflect.DeepEqual(h.calls[0], conversationMessages) {
+		t.Fatalf("converse #error: unexpected calls %v", h.calls)
+	}
+
+	if tx.ConversationError() != nil {
+		t.Fatalf("conversationerror #error: %v", tx.ConversationError())
+	}
+
+	h.responses = h.responses[:2]
+	_, err = tx.converse(conversationMessages)
+	if !errors.Is(err, ErrConv) {
+		t.Fatalf("converse #error: expected %v, got %v", ErrConv, err)
+	}
+	var convErr *ConvError
+	if !errors.As(err, &convErr) || convErr.Index != -1 ||
+		convErr.Cause.Error() != "handler returned 2 responses for 3 messages" {
+		t.Fatalf("converse #error: unexpected error %v", err)
+	}
+	if tx.ConversationError() != err {
+		t.Fatalf("conversationerror #error: unexpected error %v", tx.ConversationError())
+	}
+}
+
+func TestConversation_Invalid(t *testing.T) {
+	failure := errors.New("failure")
+	tx := conversationStart(t, ConversationFunc(func(s Style, msg string) (string, error) {
+		return "", failure
+	}))
+	_, err := tx.converse(conversationMessages)
+	if !errors.Is(err, ErrConv) {
+		t.Fatalf("converse #error: expected %v, got %v", ErrConv, err)
+	}
+	if !errors.Is(tx.ConversationError(), failure) {
+		t.Fatalf("conversationerror #error: expected %v, got %v", failure, tx.ConversationError())
+	}
+	var convErr *ConvError
+	if !errors.As(err, &convErr) || convErr.Index != 0 || convErr.Style != TextInfo ||
+		convErr.Prompt != "Welcome" || convErr.Status != ErrConv {
+		t.Fatalf("converse #error: unexpected error %#v", err)
+	}
+	for _, n := range []int{0, 33} {
+		messages := make([]ConversationMessage, n)
+		for i := range messages {
+			messages[i].Style = TextInfo
+		}
+		_, err = tx.converse(messages)
+		if !errors.Is(err, ErrConv) {
+			t.Fatalf("converse #error: expected %v, got %v", ErrConv, err)
+		}
+		var convErr *ConvError
+		if !errors.As(err, &convErr) ||
+			!strings.HasPrefix(convErr.Cause.Error(), "invalid number of messages") {
+			t.Fatalf("converse #error: unexpected error %v", err)
+		}
+	}
+	if (&Transaction{}).ConversationError() != nil {
+		t.Fatalf("conversationerror #error: unexpected error")
+	}
+}
+
+func TestConversation_Single(t *testing.T) {
+	tx := conversationStart(t, Credentials{User: "user", Password: "secret"})
+	r, err := tx.converse(conversationMessages[1:])
+	if err != nil {
+		t.Fatalf("converse #error: %v", err)
+	}
+	if !reflect.DeepEqual(r, []string{"user", "secret"}) {
+		t.Fatalf("converse #error: unexpected responses %q", r)
+	}
+	_, err = tx.converse(conversationMessages)
+	if !errors.Is(err, ErrConv) {
+		t.Fatalf("converse #error: expected %v, got %v", ErrConv, err)
+	}
+}
+
+func TestConversation_Operation(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	failure := errors.New("failure")
+	tx, err := StartConfDir("succeed-if-user-test", "",
+		ConversationFunc(func(s Style, msg string) (string, error) {
+			return "", failure
+		}), "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	var convErr *ConvError
+	if !errors.As(err, &convErr) {
+		t.Fatalf("authenticate #error: expected a conversation error, got %v", err)
+	}
+	if convErr.Index != 0 || convErr.Style != PromptEchoOn || convErr.Prompt == "" {
+		t.Fatalf("authenticate #error: unexpected message in %v", err)
+	}
+	if !errors.Is(err, failure) || !errors.Is(err, tx.Status()) || tx.Status() == Success {
+		t.Fatalf("authenticate #error: %v does not match its cause and status", err)
+	}
+
+	tx, err = StartConfDir("succeed-if-user-test", "",
+		Credentials{User: "testuser"}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if err != nil || tx.ConversationError() != nil {
+		t.Fatalf("authenticate #error: %v, %v", err, tx.ConversationError())
+	}
+}
+
+func TestConversation_Binary(t *testing.T) {
+	var infos []string
+	tx := conversationStart(t, ChoiceHandler{
+		ConversationHandler: ConversationFunc(func(s Style, msg string) (string, error) {
+			if s == TextInfo {
+				infos = append(infos, msg)
+				return "", nil
+			}
+			return "alice", nil
+		}),
+		Choose: func(l ChoiceList) (string, error) {
+			return l.Choices[1].Value, nil
+		},
+	})
+	req, err := testChoices.EncodeRequest()
+	if err != nil {
+		t.Fatalf("encode #error: %v", err)
+	}
+	r, err := tx.converse([]ConversationMessage{
+		{TextInfo, "Welcome"},
+		{PromptEchoOn, "login:"},
+		{BinaryPrompt, string(req)},
+	})
+	if err != nil {
+		t.Fatalf("converse #error: %v", err)
+	}
+	if len(r) != 3 || r[1] != "alice" || len(infos) != 1 || infos[0] != "Welcome" {
+		t.Fatalf("converse #error: unexpected responses %q, messages %q", r, infos)
+	}
+	if v, err := testChoices.ParseResponse([]byte(r[2])); err != nil || v != "totp" {
+		t.Fatalf("converse #error: expected totp, got %q, %v", v, err)
+	}
+
+	_, err = tx.converse([]ConversationMessage{{BinaryPrompt, "\x00\x00\x00\x10not a choice"}})
+	if !errors.Is(err, ErrConv) || !errors.Is(err, ErrNotChoice) {
+		t.Fatalf("converse #error: expected %v, got %v", ErrNotChoice, err)
+	}
+}
+
+func TestConversation_Radio(t *testing.T) {
+	var question string
+	tx := conversationStart(t, ConversationFunc(func(s Style, msg string) (string, error) {
+		if s != RadioType {
+			return "", errors.New("unexpected style")
+		}
+		question = msg
+		return "yes", nil
+	}))
+	r, err := tx.converse([]ConversationMessage{{RadioType, "Send a push? (yes/no)"}})
+	if err != nil {
+		t.Fatalf("converse #error: %v", err)
+	}
+	if r[0] != "yes" || question != "Send a push? (yes/no)" {
+		t.Fatalf("converse #error: unexpected response %q to %q", r, question)
+	}
+}
+
+func BenchmarkConversation_Multi(b *testing.B) {
+	if !CheckPamHasStartConfdir() {
+		b.Skip("pam_start_confdir is not available")
+	}
+	tx := benchmarkStart(b, "permit-service", ConversationFunc(func(s Style, msg string) (string, error) {
+		return msg, nil
+	}))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tx.converse(conversationMessages); err != nil {
+			b.Fatalf("converse #error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package pam
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"unicode/utf8"
+	"unsafe"
+)
+
+// ErrInvalidResponse is the cause of the ConvErrors of the text responses
+// rejected by the conversation function, see ConvLimits.
+var ErrInvalidResponse = errors.New("invalid response")
+
+// ConvLimits are the limits the conversation function of a transaction
+// enforces on the conversations, see WithConvLimits, failing those going
+// beyond with ErrConv rather than leaving the checks to the handlers. The
+// text responses holding NUL bytes are always rejected, rather than
+// truncated at the first one as the modules would read them.
+type ConvLimits struct {
+	// MaxMessages is the maximum number of messages of a conversation,
+	// no more than PAM_MAX_NUM_MSG, the default.
+	MaxMessages int
+	// MaxResponseLen is the maximum length of the text responses, in
+	// bytes, none if 0.
+	MaxResponseLen int
+	// ValidUTF8 rejects the text responses that are not valid UTF-8.
+	ValidUTF8 bool
+}
+
+// WithConvLimits sets the limits of the conversations of the transaction.
+func WithConvLimits(l ConvLimits) StartOption {
+	return startOptionFunc(func(o *startOptions) {
+		o.convLimits = l
+	})
+}
+
+// checkMessages returns why a conversation of n messages is rejected, if it
+// is.
+func (l ConvLimits) checkMessages(n int) error {
+	if l.MaxMessages > 0 && n > l.MaxMessages {
+		return fmt.Errorf("too many messages: %d, expected at most %d", n, l.MaxMessages)
+	}
+	return nil
+}
+
+// checkResponse returns why the text response r is rejected, if it is.
+func (l ConvLimits) checkResponse(r []byte) error {
+	if i := bytes.IndexByte(r, 0); i >= 0 {
+		return fmt.Errorf("%w: NUL byte at %d", ErrInvalidResponse, i)
+	}
+	if l.MaxResponseLen > 0 && len(r) > l.MaxResponseLen {
+		return fmt.Errorf("%w: %d bytes, expected at most %d", ErrInvalidResponse, len(r), l.MaxResponseLen)
+	}
+	if l.ValidUTF8 && !utf8.Valid(r) {
+		return fmt.Errorf("%w: not valid UTF-8", ErrInvalidResponse)
+	}
+	return nil
+}
+
+// checkResponseString is checkResponse for the responses as strings.
+func (l ConvLimits) checkResponseString(r string) error {
+	return l.checkResponse(unsafe.Slice(unsafe.StringData(r), len(r)))
+}
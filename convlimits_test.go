@@ -0,0 +1,94 @@
+package pam
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestConvLimits(t *testing.T) {
+	for _, tt := range []struct {
+		limits   ConvLimits
+		response string
+		valid    bool
+	}{
+		{ConvLimits{}, "secret", true},
+		{ConvLimits{}, strings.Repeat("x", 4096), true},
+		{ConvLimits{}, "sec\x00ret", false},
+		{ConvLimits{MaxResponseLen: 6}, "secret", true},
+		{ConvLimits{MaxResponseLen: 5}, "secret", false},
+		{ConvLimits{}, "s\xffcret", true},
+		{ConvLimits{ValidUTF8: true}, "s\xffcret", false},
+		{ConvLimits{ValidUTF8: true}, "sécret", true},
+	} {
+		err := tt.limits.checkResponseString(tt.response)
+		if (err == nil) != tt.valid || (err != nil && !errors.Is(err, ErrInvalidResponse)) {
+			t.Fatalf("check #error: %q with %+v: unexpected result %v", tt.response, tt.limits, err)
+		}
+	}
+	if err := (ConvLimits{MaxMessages: 2}).checkMessages(3); err == nil {
+		t.Fatalf("check #error: expected too many messages")
+	}
+	if err := (ConvLimits{}).checkMessages(3); err != nil {
+		t.Fatalf("check #error: %v", err)
+	}
+}
+
+func TestTransaction_ConvLimits(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	response := ""
+	multi := &multiHandler{}
+	handlers := map[string]ConversationHandler{
+		"text": ConversationFunc(func(s Style, msg string) (string, error) {
+			return response, nil
+		}),
+		"bytes": BytesConversationFunc(func(s Style, msg []byte) ([]byte, error) {
+			return []byte(response), nil
+		}),
+		"multi": multi,
+	}
+	for name, h := range handlers {
+		t.Run(name, func(t *testing.T) {
+			tx, err := StartWithOptions("permit-service", WithConfDir("test-services"),
+				WithConversationHandler(h),
+				WithConvLimits(ConvLimits{MaxMessages: 2, MaxResponseLen: 8, ValidUTF8: true}))
+			if err != nil {
+				t.Fatalf("start #error: %v", err)
+			}
+			defer tx.Close()
+			for _, tt := range []struct {
+				response string
+				valid    bool
+			}{
+				{"alice", true},
+				{"al\x00ice", false},
+				{"alice-and-bob", false},
+				{"al\xffce", false},
+			} {
+				response, multi.responses = tt.response, []string{tt.response}
+				r, err := tx.converse([]ConversationMessage{{PromptEchoOn, "login:"}})
+				if tt.valid {
+					if err != nil || r[0] != tt.response {
+						t.Fatalf("converse #error: %q: unexpected response %q, %v", tt.response, r, err)
+					}
+					continue
+				}
+				var convErr *ConvError
+				if !errors.Is(err, ErrConv) || !errors.Is(err, ErrInvalidResponse) ||
+					!errors.As(err, &convErr) || convErr.Index != 0 {
+					t.Fatalf("converse #error: %q: expected %v, got %v", tt.response, ErrInvalidResponse, err)
+				}
+			}
+			response = ""
+			if _, err := tx.converse([]ConversationMessage{
+				{TextInfo, "1"},
+				{TextInfo, "2"},
+				{TextInfo, "3"},
+			}); !errors.Is(err, ErrConv) {
+				t.Fatalf("converse #error: expected %v, got %v", ErrConv, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,47 @@
+package pam
+
+// StringConvRequest is a text message, such as a prompt.
+type StringConvRequest struct {
+	style  Style
+	prompt string
+}
+
+// NewStringConvRequest returns a text message of the style: PromptEchoOff,
+// PromptEchoOn, ErrorMsg, TextInfo or RadioType.
+func NewStringConvRequest(style Style, prompt string) StringConvRequest {
+	return StringConvRequest{style, prompt}
+}
+
+// Style returns the style of the message.
+func (r StringConvRequest) Style() Style {
+	return r.style
+}
+
+// Prompt returns the text of the message.
+func (r StringConvRequest) Prompt() string {
+	return r.prompt
+}
+
+// StringConvResponse is the response to a StringConvRequest.
+type StringConvResponse struct {
+	style    Style
+	response string
+}
+
+// NewStringConvResponse returns the response to a text message of the
+// style, such as the ones forwarded by the applications proxying the
+// conversations of other processes.
+func NewStringConvResponse(style Style, response string) StringConvResponse {
+	return StringConvResponse{style, response}
+}
+
+// Style returns the style of the message.
+func (r StringConvResponse) Style() Style {
+	return r.style
+}
+
+// Response returns the response, empty for the messages without one, such
+// as TextInfo.
+func (r StringConvResponse) Response() string {
+	return r.response
+}
@@ -0,0 +1,175 @@
+package pam
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ConvUI is the user interface of the conversations, as implemented by the
+// graphical and web frontends: UIHandler adapts it to the conversation
+// handlers, so that it doesn't need to know how PAM sends its messages.
+//
+// The methods receive the context of the handler, which is done once the
+// conversation is canceled: they should then return as soon as possible,
+// closing their dialogs.
+type ConvUI interface {
+	// AskSecret asks for a response which is not shown, such as a
+	// password.
+	AskSecret(ctx context.Context, prompt string) (string, error)
+	// AskInput asks for a response which is shown, such as a user name
+	// or the answer to a RadioType question.
+	AskInput(ctx context.Context, prompt string) (string, error)
+	ShowInfo(ctx context.Context, msg string) error
+	ShowError(ctx context.Context, msg string) error
+	// Choice asks to select one of the choices of the list, returning
+	// its value.
+	Choice(ctx context.Context, l ChoiceList) (string, error)
+	// Busy is called with true when PAM is working, between the
+	// conversations, and with false when the user is expected to act,
+	// for example to show a spinner.
+	Busy(busy bool)
+}
+
+// ConvUIBatch is implemented by the user interfaces showing all the
+// messages of a conversation at once, such as in a single dialog, rather
+// than one at a time.
+type ConvUIBatch interface {
+	ConvUI
+	// Ask shows the messages and returns one response for each of them,
+	// empty for those which are not prompts.
+	Ask(ctx context.Context, messages []ConversationMessage) ([]string, error)
+}
+
+// UIHandler is a conversation handler showing the messages with a ConvUI,
+// including the choice lists sent as binary prompts. It must be created
+// with NewUIHandler.
+type UIHandler struct {
+	ui     ConvUI
+	ctx    context.Context
+	cancel context.CancelFunc
+	mu     sync.Mutex
+}
+
+// NewUIHandler returns a conversation handler for ui, whose conversations
+// fail once ctx is done or the handler canceled.
+func NewUIHandler(ctx context.Context, ui ConvUI) *UIHandler {
+	ctx, cancel := context.WithCancel(ctx)
+	return &UIHandler{ui: ui, ctx: ctx, cancel: cancel}
+}
+
+// Cancel cancels the conversations: those in progress and the following
+// ones fail, and so do the PAM operations asking for them. It can be
+// called by any goroutine, such as the one of the Cancel button of the
+// user interface.
+func (h *UIHandler) Cancel() {
+	h.cancel()
+}
+
+// Run runs a PAM operation, such as the Authenticate method of a
+// transaction, telling the user interface it is busy until it returns but
+// while the user is asked for responses.
+func (h *UIHandler) Run(op func() error) error {
+	h.ui.Busy(true)
+	defer h.ui.Busy(false)
+	return op()
+}
+
+// begin starts a conversation, which is serialized with the others, as the
+// user interface may not expect concurrent calls. The function returned
+// ends it.
+func (h *UIHandler) begin() (end func(), err error) {
+	if err := h.ctx.Err(); err != nil {
+		return nil, err
+	}
+	h.mu.Lock()
+	h.ui.Busy(false)
+	return func() {
+		h.ui.Busy(true)
+		h.mu.Unlock()
+	}, nil
+}
+
+// RespondPAM shows a message with the user interface.
+func (h *UIHandler) RespondPAM(s Style, msg string) (string, error) {
+	end, err := h.begin()
+	if err != nil {
+		return "", err
+	}
+	defer end()
+	return h.respond(s, msg)
+}
+
+func (h *UIHandler) respond(s Style, msg string) (string, error) {
+	var r string
+	var err error
+	switch s {
+	case PromptEchoOff:
+		r, err = h.ui.AskSecret(h.ctx, msg)
+	case PromptEchoOn, RadioType:
+		r, err = h.ui.AskInput(h.ctx, msg)
+	case ErrorMsg:
+		err = h.ui.ShowError(h.ctx, msg)
+	case TextInfo:
+		err = h.ui.ShowInfo(h.ctx, msg)
+	default:
+		return "", fmt.Errorf("unexpected message style %v", s)
+	}
+	if err == nil {
+		// The responses given once canceled are not used.
+		err = h.ctx.Err()
+	}
+	if err != nil {
+		return "", err
+	}
+	return r, nil
+}
+
+// RespondPAMMulti shows the messages of a conversation at once if the user
+// interface is a ConvUIBatch, one at a time otherwise.
+func (h *UIHandler) RespondPAMMulti(messages []ConversationMessage) ([]string, error) {
+	end, err := h.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+	if b, ok := h.ui.(ConvUIBatch); ok {
+		r, err := b.Ask(h.ctx, messages)
+		if err == nil {
+			err = h.ctx.Err()
+		}
+		if err != nil {
+			return nil, err
+		}
+		return r, nil
+	}
+	responses := make([]string, len(messages))
+	for i, m := range messages {
+		if responses[i], err = h.respond(m.Style, m.Message); err != nil {
+			return nil, err
+		}
+	}
+	return responses, nil
+}
+
+// RespondPAMBinary asks to select a choice of the choice lists, failing
+// with the other binary prompts.
+func (h *UIHandler) RespondPAMBinary(ptr BinaryPointer) ([]byte, error) {
+	l, err := DecodeChoiceRequest(ptr)
+	if err != nil {
+		return nil, err
+	}
+	end, err := h.begin()
+	if err != nil {
+		return nil, err
+	}
+	defer end()
+	value, err := h.ui.Choice(h.ctx, *l)
+	if err == nil {
+		err = h.ctx.Err()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return EncodeChoiceResponse(value)
+}
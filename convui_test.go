@@ -0,0 +1,129 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// fakeUI records the calls of the handler.
+type fakeUI struct {
+	calls  []string
+	cancel func()
+}
+
+func (u *fakeUI) AskSecret(ctx context.Context, prompt string) (string, error) {
+	u.calls = append(u.calls, "secret "+prompt)
+	return "secret", nil
+}
+
+func (u *fakeUI) AskInput(ctx context.Context, prompt string) (string, error) {
+	u.calls = append(u.calls, "input "+prompt)
+	if u.cancel != nil {
+		u.cancel()
+	}
+	return "user", nil
+}
+
+func (u *fakeUI) ShowInfo(ctx context.Context, msg string) error {
+	u.calls = append(u.calls, "info "+msg)
+	return nil
+}
+
+func (u *fakeUI) ShowError(ctx context.Context, msg string) error {
+	u.calls = append(u.calls, "error "+msg)
+	return nil
+}
+
+func (u *fakeUI) Choice(ctx context.Context, l ChoiceList) (string, error) {
+	u.calls = append(u.calls, "choice "+l.Title)
+	return l.Choices[0].Value, nil
+}
+
+func (u *fakeUI) Busy(busy bool) {
+	if busy {
+		u.calls = append(u.calls, "busy")
+	} else {
+		u.calls = append(u.calls, "idle")
+	}
+}
+
+// fakeBatchUI shows the messages at once.
+type fakeBatchUI struct {
+	fakeUI
+}
+
+func (u *fakeBatchUI) Ask(ctx context.Context, messages []ConversationMessage) ([]string, error) {
+	u.calls = append(u.calls, "ask")
+	return []string{"", "user", "secret"}, nil
+}
+
+func TestUIHandler(t *testing.T) {
+	ui := &fakeUI{}
+	h := NewUIHandler(context.Background(), ui)
+	tx := conversationStart(t, h)
+	defer tx.Close()
+	err := h.Run(func() error {
+		r, err := tx.converse(conversationMessages)
+		if err == nil && !reflect.DeepEqual(r, []string{"", "user", "secret"}) {
+			t.Fatalf("converse #error: unexpected responses %q", r)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("converse #error: %v", err)
+	}
+	expected := []string{"busy", "idle", "info Welcome", "input login:", "secret Password:", "busy", "idle"}
+	if !reflect.DeepEqual(ui.calls, expected) {
+		t.Fatalf("converse #error: expected calls %q, got %q", expected, ui.calls)
+	}
+
+	ui.calls = nil
+	req, _ := testChoices.EncodeRequest()
+	r, err := h.RespondPAMBinary(BinaryPointer(&req[0]))
+	if v, _ := testChoices.ParseResponse(r); err != nil || v != "password" {
+		t.Fatalf("respond #error: got %q, %v", v, err)
+	}
+	expected = []string{"idle", "choice " + testChoices.Title, "busy"}
+	if !reflect.DeepEqual(ui.calls, expected) {
+		t.Fatalf("respond #error: expected calls %q, got %q", expected, ui.calls)
+	}
+	if _, err := h.RespondPAM(BinaryPrompt, ""); err == nil {
+		t.Fatalf("respond #error: expected a failure")
+	}
+}
+
+func TestUIHandler_Batch(t *testing.T) {
+	ui := &fakeBatchUI{}
+	h := NewUIHandler(context.Background(), ui)
+	tx := conversationStart(t, h)
+	defer tx.Close()
+	if _, err := tx.converse(conversationMessages); err != nil {
+		t.Fatalf("converse #error: %v", err)
+	}
+	expected := []string{"idle", "ask", "busy"}
+	if !reflect.DeepEqual(ui.calls, expected) {
+		t.Fatalf("converse #error: expected calls %q, got %q", expected, ui.calls)
+	}
+}
+
+func TestUIHandler_Cancel(t *testing.T) {
+	ui := &fakeUI{}
+	h := NewUIHandler(context.Background(), ui)
+	ui.cancel = h.Cancel
+	tx := conversationStart(t, h)
+	defer tx.Close()
+	_, err := tx.converse(conversationMessages)
+	if !errors.Is(err, ErrConv) || !errors.Is(tx.ConversationError(), context.Canceled) {
+		t.Fatalf("converse #error: expected %v, got %v, %v", context.Canceled, err, tx.ConversationError())
+	}
+	// The secret is not asked once canceled.
+	expected := []string{"idle", "info Welcome", "input login:", "busy"}
+	if !reflect.DeepEqual(ui.calls, expected) {
+		t.Fatalf("converse #error: expected calls %q, got %q", expected, ui.calls)
+	}
+	if _, err := h.RespondPAM(TextInfo, "more"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("respond #error: expected %v, got %v", context.Canceled, err)
+	}
+}
@@ -0,0 +1,262 @@
+// Package credcache lets the modules written in Go avoid prompting the users
+// again within a grace period, as sudo does with its timestamps: Cache keeps
+// the credentials in locked memory within a process, and Timestamps records
+// in per-user files when the users last authenticated, for the processes
+// that can't share memory.
+//
+// The entries are identified by keys, usually made with Key of the user and
+// of where they authenticate from, such as their terminal, so that another
+// terminal of the same user has to authenticate again.
+package credcache
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// DefaultTTL is the default grace period of the entries.
+const DefaultTTL = 5 * time.Minute
+
+// DefaultDir is the default directory of the timestamp files.
+const DefaultDir = "/run/go-pam-timestamps"
+
+// Key returns the key of the entries made of the parts, such as the user
+// name, the terminal and the remote host.
+func Key(parts ...string) string {
+	return strings.Join(parts, "\x00")
+}
+
+// valid returns whether an entry made at t is still valid at now. The
+// entries from the future, after the clock went back, are not.
+func valid(t, now time.Time, ttl time.Duration) bool {
+	return !now.Before(t) && now.Sub(t) < ttl
+}
+
+func ttl(d time.Duration) time.Duration {
+	if d <= 0 {
+		return DefaultTTL
+	}
+	return d
+}
+
+// Cache keeps credentials, such as passwords, in locked memory for a grace
+// period, see pam.SecureBuffer. It can be used by multiple goroutines at
+// the same time.
+type Cache struct {
+	// TTL is the grace period of the entries, DefaultTTL if not set.
+	TTL time.Duration
+	// Now returns the current time, time.Now if not set.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+type entry struct {
+	secret *pam.SecureBuffer
+	time   time.Time
+}
+
+func (c *Cache) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// get returns the valid entry of key, destroying the expired ones.
+func (c *Cache) get(key string, now time.Time) *entry {
+	e := c.entries[key]
+	if e != nil && !valid(e.time, now, ttl(c.TTL)) {
+		e.secret.Destroy()
+		delete(c.entries, key)
+		return nil
+	}
+	return e
+}
+
+// Put stores a copy of secret for key, which is then wiped, replacing the
+// previous entry and starting a new grace period.
+func (c *Cache) Put(key string, secret []byte) error {
+	b, err := pam.NewSecureBufferFrom(secret)
+	if err != nil {
+		return err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	if c.entries == nil {
+		c.entries = map[string]*entry{}
+	}
+	for k := range c.entries {
+		c.get(k, now)
+	}
+	if e := c.entries[key]; e != nil {
+		e.secret.Destroy()
+	}
+	c.entries[key] = &entry{secret: b, time: now}
+	return nil
+}
+
+// Get returns a copy of the secret of key if its grace period is not over,
+// which the caller must destroy, or nil.
+func (c *Cache) Get(key string) (*pam.SecureBuffer, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e := c.get(key, c.now())
+	if e == nil {
+		return nil, nil
+	}
+	b, err := pam.NewSecureBuffer(e.secret.Len())
+	if err != nil {
+		return nil, err
+	}
+	copy(b.Bytes(), e.secret.Bytes())
+	return b, nil
+}
+
+// Valid returns whether key has an entry whose grace period is not over.
+func (c *Cache) Valid(key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.get(key, c.now()) != nil
+}
+
+// Invalidate destroys the entry of key.
+func (c *Cache) Invalidate(key string) {
+	c.InvalidateFunc(func(k string) bool { return k == key })
+}
+
+// InvalidateFunc destroys the entries whose keys match, such as all those
+// of a user.
+func (c *Cache) InvalidateFunc(match func(key string) bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for k, e := range c.entries {
+		if match(k) {
+			e.secret.Destroy()
+			delete(c.entries, k)
+		}
+	}
+}
+
+// Timestamps records when the users authenticated, by key, in a file per
+// user ID of its directory. They never store the credentials. The zero value
+// uses DefaultDir and DefaultTTL.
+type Timestamps struct {
+	// Dir is the directory of the timestamp files, DefaultDir if empty.
+	// It is created if needed, and should be one cleared on boot.
+	Dir string
+	// TTL is the grace period of the timestamps, DefaultTTL if not set.
+	TTL time.Duration
+	// Now returns the current time, time.Now if not set.
+	Now func() time.Time
+}
+
+func (t *Timestamps) now() time.Time {
+	if t.Now != nil {
+		return t.Now()
+	}
+	return time.Now()
+}
+
+func (t *Timestamps) dir() string {
+	if t.Dir == "" {
+		return DefaultDir
+	}
+	return t.Dir
+}
+
+// update calls f with the valid timestamps of uid, with its file locked,
+// and stores those it returns.
+func (t *Timestamps) update(uid int, f func(map[string]time.Time) bool) error {
+	if uid < 0 {
+		return fmt.Errorf("%w: invalid user ID %d", pam.ErrUserUnknown, uid)
+	}
+	if err := os.MkdirAll(t.dir(), 0700); err != nil {
+		return err
+	}
+	path := filepath.Join(t.dir(), strconv.Itoa(uid))
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	// The lock is released when the file is closed.
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	stored := map[string]time.Time{}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return fmt.Errorf("timestamps of %d: %w", uid, err)
+		}
+	}
+	now := t.now()
+	changed := false
+	for k, ts := range stored {
+		if !valid(ts, now, ttl(t.TTL)) {
+			delete(stored, k)
+			changed = true
+		}
+	}
+	if !f(stored) && !changed {
+		return nil
+	}
+	if data, err = json.Marshal(stored); err != nil {
+		return err
+	}
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err = file.WriteAt(data, 0)
+	return err
+}
+
+// Valid returns whether uid authenticated for key within the grace period.
+func (t *Timestamps) Valid(uid int, key string) (bool, error) {
+	var ok bool
+	err := t.update(uid, func(ts map[string]time.Time) bool {
+		_, ok = ts[key]
+		return false
+	})
+	return ok, err
+}
+
+// Update records that uid just authenticated for key.
+func (t *Timestamps) Update(uid int, key string) error {
+	return t.update(uid, func(ts map[string]time.Time) bool {
+		ts[key] = t.now()
+		return true
+	})
+}
+
+// Invalidate removes the timestamp of uid for key.
+func (t *Timestamps) Invalidate(uid int, key string) error {
+	return t.update(uid, func(ts map[string]time.Time) bool {
+		delete(ts, key)
+		return true
+	})
+}
+
+// InvalidateAll removes all the timestamps of uid, as sudo -K does.
+func (t *Timestamps) InvalidateAll(uid int) error {
+	return t.update(uid, func(ts map[string]time.Time) bool {
+		clear(ts)
+		return true
+	})
+}
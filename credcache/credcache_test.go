@@ -0,0 +1,99 @@
+package credcache
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCache(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := &Cache{Now: func() time.Time { return now }}
+	key := Key("alice", "pts/0")
+	secret := []byte("secret")
+	if err := c.Put(key, secret); err != nil {
+		t.Fatalf("put #error: %v", err)
+	}
+	if string(secret) != "\x00\x00\x00\x00\x00\x00" {
+		t.Fatalf("put #error: secret not wiped: %q", secret)
+	}
+
+	now = now.Add(DefaultTTL - time.Second)
+	b, err := c.Get(key)
+	if err != nil || b == nil || string(b.Bytes()) != "secret" {
+		t.Fatalf("get #error: %v, %v", b, err)
+	}
+	b.Destroy()
+	if c.Valid(Key("alice", "pts/1")) {
+		t.Fatalf("valid #error: another key is valid")
+	}
+
+	now = now.Add(time.Second)
+	if b, err := c.Get(key); err != nil || b != nil {
+		t.Fatalf("get #error: expired entry: %v, %v", b, err)
+	}
+
+	c.Put(key, []byte("secret"))
+	c.Put(Key("alice", "pts/1"), []byte("secret"))
+	c.Put(Key("bob", "pts/2"), []byte("secret"))
+	c.Invalidate(key)
+	if c.Valid(key) || !c.Valid(Key("alice", "pts/1")) {
+		t.Fatalf("invalidate #error")
+	}
+	c.InvalidateFunc(func(k string) bool { return strings.HasPrefix(k, Key("alice", "")) })
+	if c.Valid(Key("alice", "pts/1")) || !c.Valid(Key("bob", "pts/2")) {
+		t.Fatalf("invalidate #error: func")
+	}
+
+	// The clock going back invalidates the entries.
+	now = now.Add(-time.Minute)
+	if c.Valid(Key("bob", "pts/2")) {
+		t.Fatalf("valid #error: entry from the future")
+	}
+}
+
+func TestTimestamps(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	ts := &Timestamps{Dir: t.TempDir(), TTL: time.Minute, Now: func() time.Time { return now }}
+	key := Key("pts/0")
+	if ok, err := ts.Valid(1000, key); err != nil || ok {
+		t.Fatalf("valid #error: %v, %v", ok, err)
+	}
+	if err := ts.Update(1000, key); err != nil {
+		t.Fatalf("update #error: %v", err)
+	}
+	if err := ts.Update(1000, Key("pts/1")); err != nil {
+		t.Fatalf("update #error: %v", err)
+	}
+	if ok, err := ts.Valid(1000, key); err != nil || !ok {
+		t.Fatalf("valid #error: %v, %v", ok, err)
+	}
+	if ok, _ := ts.Valid(1001, key); ok {
+		t.Fatalf("valid #error: another user is valid")
+	}
+
+	if err := ts.Invalidate(1000, key); err != nil {
+		t.Fatalf("invalidate #error: %v", err)
+	}
+	if ok, _ := ts.Valid(1000, key); ok {
+		t.Fatalf("invalidate #error: still valid")
+	}
+	if ok, _ := ts.Valid(1000, Key("pts/1")); !ok {
+		t.Fatalf("invalidate #error: other key invalidated")
+	}
+	if err := ts.InvalidateAll(1000); err != nil {
+		t.Fatalf("invalidate all #error: %v", err)
+	}
+	if ok, _ := ts.Valid(1000, Key("pts/1")); ok {
+		t.Fatalf("invalidate all #error: still valid")
+	}
+
+	ts.Update(1000, key)
+	now = now.Add(time.Minute)
+	if ok, _ := ts.Valid(1000, key); ok {
+		t.Fatalf("valid #error: expired timestamp")
+	}
+	if _, err := ts.Valid(-1, key); err == nil {
+		t.Fatalf("valid #error: expected a failure for an invalid user ID")
+	}
+}
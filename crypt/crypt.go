@@ -0,0 +1,86 @@
+// Package crypt verifies passwords against the hashes of crypt(3), as
+// stored in /etc/shadow, without calling the C library: authentication
+// modules written in Go can check the passwords with it, without cgo or
+// external helpers.
+//
+// The supported methods are those of the current distributions: yescrypt
+// ("$y$"), SHA-512 ("$6$"), SHA-256 ("$5$") and bcrypt ("$2b$", "$2a$" and
+// "$2y$"). Locked hashes, starting with "!" or "*", never match.
+package crypt
+
+import (
+	"crypto/subtle"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// ErrMismatch is returned when the password doesn't match the hash.
+	ErrMismatch = errors.New("crypt: password mismatch")
+	// ErrUnsupported is returned for the hashes of unsupported methods
+	// or parameters.
+	ErrUnsupported = errors.New("crypt: unsupported hash")
+	// ErrInvalid is returned for the malformed hashes.
+	ErrInvalid = errors.New("crypt: invalid hash")
+)
+
+// Verify returns nil if password matches hash, ErrMismatch if it doesn't.
+// Empty hashes never match either: whether users without password are
+// allowed, as with the nullok option of pam_unix, is up to the caller.
+func Verify(hash string, password []byte) error {
+	if hash == "" || hash[0] == '!' || hash[0] == '*' {
+		return ErrMismatch
+	}
+	var computed string
+	var err error
+	switch {
+	case strings.HasPrefix(hash, "$y$"):
+		computed, err = yescryptCrypt(password, hash)
+	case strings.HasPrefix(hash, "$6$"):
+		computed, err = shaCrypt(sha512Method, password, hash)
+	case strings.HasPrefix(hash, "$5$"):
+		computed, err = shaCrypt(sha256Method, password, hash)
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"),
+		strings.HasPrefix(hash, "$2y$"):
+		return bcryptVerify(hash, password)
+	default:
+		return ErrUnsupported
+	}
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare([]byte(computed), []byte(hash)) != 1 {
+		return ErrMismatch
+	}
+	return nil
+}
+
+// bcryptVerify verifies the bcrypt hashes, which only use the first 72
+// bytes of the passwords.
+func bcryptVerify(hash string, password []byte) error {
+	if len(password) > 72 {
+		password = password[:72]
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(hash), password)
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return ErrMismatch
+	}
+	return ErrInvalid
+}
+
+// itoa64 is the alphabet of the crypt(3) base64 encoding.
+const itoa64 = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+// atoi64 returns the value of a character of the encoding, or 64 if it is
+// not one.
+func atoi64(c byte) uint32 {
+	if i := strings.IndexByte(itoa64, c); i >= 0 {
+		return uint32(i)
+	}
+	return 64
+}
@@ -0,0 +1,78 @@
+package crypt
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+// The hashes were computed by libxcrypt.
+var hashTests = []struct {
+	hash     string
+	password string
+}{
+	{"$y$j9T$abcdefghijklmnop$3dL1LkYnZM.OVXuVdnnaKVDlLYT92dRwOzDZ5XiVCe.", "secret"},
+	{"$y$j8T$5TZF1qtFUsExuMeC7yiaY0$5HEJLfXfYIOyF1UP5feck/q/u3OWD4CLkzjqs6FeVx7", ""},
+	{"$y$jAT$xyz.$kLcXqAiNV/eVEcaxmxJxpAz0jHOKJC42fr8z9EDWCyC", "pässword"},
+	{"$y$j8T..$abcd$jwjnF8xn40hzIlWUEbOfA2ZSzmSJ9FC1SEUC5OBlmC0", "secret"},
+	{"$y$j8T/.$abcd$T.FoPXwLf5mRZ/KKZrPHdaIieKQQ4O7dXspJI//2GSB", "secret"},
+	{"$y$j9T0..$abcd$iehQEiiN/iGzRTYBct4bEwOuJZ2ZlbONAVFnPvfeGR5", "secret"},
+	{"$y$j7T0/.$abcd$Z9ojuRoOzjK3NUZRiU7OBAPdQr688n9pB/wAE3soi81", "secret"},
+	{"$y$j8T$$saZUIJWHiVtfzLw.qPisaYYejHIl8uSRms4oQeacNeC", "secret"},
+	{"$6$saltsalt$TVLlQcbpFVof5W3Yz4DTP6gRstiNuHwwTt6GLc1E5n0U0aDehy0S5knV8wiOQSpT0Y77vwPZN.Pq.H91p5hVO1", "secret"},
+	{"$6$rounds=1000$longsaltlongsalt$a96HfPqzASVYo4GSMhujxaXG8.pW3KzQ.kXqSqtNJuqKjXzdKFQIiP3SCnP7MyImsGz2pOW8ufrwuyTS8Hie8.", ""},
+	{"$6$rounds=5000$ab$2lDVylRMp48hlYZZFOCx/xnhJEsGPynJ17rt2um9Gb8wX6ygI4uDxg3Bg43pp/Hv397hwWfT8mciHws9eE4sR/", "secret"},
+	{"$6$rounds=1000$ab$LKkTDMS/DBJYODTkgfGi.GHrMycqs.mJK9RJZTUxpRDhlJ3hCKojMcmrQsLa9i2/vxd6Bhv9B5u/5cYuAMKMX0", strings.Repeat("x", 100)},
+	{"$6$$2M9DchxW4txWyTYoZrH9D3VvAAQxBpEezYsLY6Cao.jwzEXpyL9xwip9hiUZX7GqTqe/E/z6iKvZqXUuqniQH.", "secret"},
+	{"$5$saltsalt$mxvvOAsfS.o0SGs/k5pFvrYaXMiO01Vc7xoNZTltoY1", strings.Repeat("a", 64)},
+	{"$5$rounds=12345$q$eqOnaLn1Q2M5tvVFv6JzfYY5AwKtfDdneTqc7NIMTg1", "secret"},
+	{"$2b$05$abcdefghijklmnopqrstuuOQiyCxlgf/oeuTqixKmWdcYUh4Hjl0a", "secret"},
+	{"$2b$04$abcdefghijklmnopqrstuuwurWIdVVT4m5pTArtqnFNM69nySdHj.", strings.Repeat("y", 80)},
+	{"$2y$04$abcdefghijklmnopqrstuu2r9OfJnfCsdneAXAGHnS4UpFFP8WIrW", "secret"},
+}
+
+func TestVerify(t *testing.T) {
+	for _, tt := range hashTests {
+		t.Run(tt.hash[:strings.LastIndexByte(tt.hash, '$')], func(t *testing.T) {
+			if err := Verify(tt.hash, []byte(tt.password)); err != nil {
+				t.Fatalf("verify #error: %v", err)
+			}
+			if err := Verify(tt.hash, []byte("x"+tt.password)); !errors.Is(err, ErrMismatch) {
+				t.Fatalf("verify #error: expected ErrMismatch, got %v", err)
+			}
+		})
+	}
+}
+
+func TestVerify_Errors(t *testing.T) {
+	tests := []struct {
+		hash string
+		err  error
+	}{
+		{"", ErrMismatch},
+		{"!", ErrMismatch},
+		{"*", ErrMismatch},
+		{"!$6$saltsalt$TVLlQcbpFVof5W3Yz4DTP6gRstiNuHwwTt6GLc1E5n0U0aDehy0S5knV8wiOQSpT0Y77vwPZN.Pq.H91p5hVO1", ErrMismatch},
+		{"$1$ab$dslkcXxVH.x8LwW1W/oAB/", ErrUnsupported},
+		{"abJnggxhB/yWI", ErrUnsupported},
+		{"$6$rounds=999$ab$", ErrInvalid},
+		{"$6$rounds=01000$ab$", ErrInvalid},
+		{"$y$j9T$xy$", ErrInvalid},
+		{"$y$j9T", ErrInvalid},
+		{"$y$j7T5.$abcd$", ErrUnsupported},
+		{"$y$.9T$abcd$", ErrUnsupported},
+		{"$y$jRT$abcd$", ErrUnsupported},
+		{"$2b$05$short", ErrInvalid},
+	}
+	for _, tt := range tests {
+		if err := Verify(tt.hash, []byte("secret")); !errors.Is(err, tt.err) {
+			t.Fatalf("verify #error: expected %v for %q, got %v", tt.err, tt.hash, err)
+		}
+	}
+}
+
+func BenchmarkVerify_Yescrypt(b *testing.B) {
+	for b.Loop() {
+		Verify(hashTests[0].hash, []byte(hashTests[0].password))
+	}
+}
@@ -0,0 +1,172 @@
+package crypt
+
+import (
+	"crypto/sha256"
+	"crypto/sha512"
+	"hash"
+	"strconv"
+	"strings"
+)
+
+// shaMethod defines the SHA-256 and SHA-512 based methods, as specified by
+// Ulrich Drepper.
+type shaMethod struct {
+	prefix string
+	new    func() hash.Hash
+	// order is the order of the bytes of the digest in the encoding, by
+	// groups of three.
+	order []int
+}
+
+var sha256Method = shaMethod{
+	prefix: "$5$",
+	new:    sha256.New,
+	order: []int{
+		0, 10, 20, 21, 1, 11, 12, 22, 2, 3, 13, 23, 24, 4, 14,
+		15, 25, 5, 6, 16, 26, 27, 7, 17, 18, 28, 8, 9, 19, 29,
+		-1, 31, 30,
+	},
+}
+
+var sha512Method = shaMethod{
+	prefix: "$6$",
+	new:    sha512.New,
+	order: []int{
+		0, 21, 42, 22, 43, 1, 44, 2, 23, 3, 24, 45, 25, 46, 4,
+		47, 5, 26, 6, 27, 48, 28, 49, 7, 50, 8, 29, 9, 30, 51,
+		31, 52, 10, 53, 11, 32, 12, 33, 54, 34, 55, 13, 56, 14, 35,
+		15, 36, 57, 37, 58, 16, 59, 17, 38, 18, 39, 60, 40, 61, 19,
+		62, 20, 41, -1, -1, 63,
+	},
+}
+
+// SHA-crypt rounds.
+const (
+	shaRoundsDefault = 5000
+	shaRoundsMin     = 1000
+	shaRoundsMax     = 999999999
+)
+
+// shaCrypt computes the hash of password with the method and the
+// parameters of setting.
+func shaCrypt(m shaMethod, password []byte, setting string) (string, error) {
+	s := strings.TrimPrefix(setting, m.prefix)
+	rounds, custom := shaRoundsDefault, false
+	if r, ok := strings.CutPrefix(s, "rounds="); ok {
+		n, rest, ok := strings.Cut(r, "$")
+		if !ok {
+			return "", ErrInvalid
+		}
+		// As libxcrypt, rounds out of range or with leading zeros are
+		// rejected rather than clamped.
+		v, err := strconv.Atoi(n)
+		if err != nil || n[0] == '0' || v < shaRoundsMin || v > shaRoundsMax {
+			return "", ErrInvalid
+		}
+		rounds = v
+		s, custom = rest, true
+	}
+	salt, _, _ := strings.Cut(s, "$")
+	if len(salt) > 16 {
+		salt = salt[:16]
+	}
+
+	h := m.new()
+	size := h.Size()
+	// B = H(password, salt, password)
+	h.Write(password)
+	h.Write([]byte(salt))
+	h.Write(password)
+	b := h.Sum(nil)
+
+	// A = H(password, salt, B repeated for the length of the password,
+	// B or the password for each bit of its length)
+	h.Reset()
+	h.Write(password)
+	h.Write([]byte(salt))
+	n := len(password)
+	for ; n > size; n -= size {
+		h.Write(b)
+	}
+	h.Write(b[:n])
+	for n := len(password); n > 0; n >>= 1 {
+		if n&1 != 0 {
+			h.Write(b)
+		} else {
+			h.Write(password)
+		}
+	}
+	a := h.Sum(nil)
+
+	// P = H(password repeated for its length), repeated for the length
+	// of the password.
+	h.Reset()
+	for range password {
+		h.Write(password)
+	}
+	p := repeat(h.Sum(nil), len(password))
+
+	// S = H(salt repeated 16 + A[0] times), repeated for the length of
+	// the salt.
+	h.Reset()
+	for i := 0; i < 16+int(a[0]); i++ {
+		h.Write([]byte(salt))
+	}
+	ss := repeat(h.Sum(nil), len(salt))
+
+	c := a
+	for i := 0; i < rounds; i++ {
+		h.Reset()
+		if i&1 != 0 {
+			h.Write(p)
+		} else {
+			h.Write(c)
+		}
+		if i%3 != 0 {
+			h.Write(ss)
+		}
+		if i%7 != 0 {
+			h.Write(p)
+		}
+		if i&1 != 0 {
+			h.Write(c)
+		} else {
+			h.Write(p)
+		}
+		c = h.Sum(c[:0])
+	}
+	clear(p)
+
+	var out strings.Builder
+	out.WriteString(m.prefix)
+	if custom {
+		out.WriteString("rounds=" + strconv.Itoa(rounds) + "$")
+	}
+	out.WriteString(salt)
+	out.WriteByte('$')
+	for i := 0; i < len(m.order); i += 3 {
+		var w uint32
+		chars := 4
+		for j, k := range m.order[i : i+3] {
+			if k < 0 {
+				chars--
+				continue
+			}
+			w |= uint32(c[k]) << (16 - 8*j)
+		}
+		for ; chars > 0; chars-- {
+			out.WriteByte(itoa64[w&0x3f])
+			w >>= 6
+		}
+	}
+	return out.String(), nil
+}
+
+// repeat returns b repeated up to n bytes.
+func repeat(b []byte, n int) []byte {
+	r := make([]byte, n)
+	for i := 0; i < n; i += len(b) {
+		copy(r[i:], b)
+	}
+	return r
+}
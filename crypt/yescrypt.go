@@ -0,0 +1,531 @@
+package crypt
+
+import (
+	"crypto/hmac"
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"encoding/binary"
+	"math/bits"
+	"strings"
+)
+
+// yescrypt parameters of the pwxform transformation, the only ones
+// supported by yescrypt 1.x.
+const (
+	pwxSimple = 2
+	pwxGather = 4
+	pwxRounds = 6
+	sWidth    = 8
+	pwxBytes  = pwxGather * pwxSimple * 8
+	pwxWords  = pwxBytes / 4
+	sBytes    = 3 * (1 << sWidth) * pwxSimple * 8
+	sWords    = sBytes / 4
+	sMask     = ((1 << sWidth) - 1) * pwxSimple * 8
+)
+
+// yescrypt flags.
+const (
+	yescryptRW = 0x002
+	// yescryptDefaults are the flags of the RW flavor with the pwxform
+	// parameters above, the only ones supported.
+	yescryptDefaults = 0x0b6
+	yescryptPrehash  = 0x10000000
+)
+
+// yescryptMaxMemory limits the memory used by the hashes, so that a
+// malformed one can't exhaust it.
+const yescryptMaxMemory = 1 << 30
+
+// yescryptCrypt computes the hash of password with the parameters of
+// setting, as the "$y$" method of libxcrypt.
+func yescryptCrypt(password []byte, setting string) (string, error) {
+	src := setting[len("$y$"):]
+	flavor, src, ok := decode64Uint32(src, 0)
+	if !ok {
+		return "", ErrInvalid
+	}
+	var flags uint32
+	if flavor < yescryptRW {
+		flags = flavor
+	} else {
+		flags = yescryptRW + (flavor-yescryptRW)<<2
+	}
+	nLog2, src, ok := decode64Uint32(src, 1)
+	if !ok || nLog2 > 63 {
+		return "", ErrInvalid
+	}
+	r, src, ok := decode64Uint32(src, 1)
+	if !ok {
+		return "", ErrInvalid
+	}
+	p, t := uint32(1), uint32(0)
+	if src != "" && src[0] != '$' {
+		var have, g, nrom uint32
+		if have, src, ok = decode64Uint32(src, 1); !ok {
+			return "", ErrInvalid
+		}
+		for _, param := range []struct {
+			bit uint32
+			v   *uint32
+			min uint32
+		}{{1, &p, 2}, {2, &t, 1}, {4, &g, 1}, {8, &nrom, 1}} {
+			if have&param.bit == 0 {
+				continue
+			}
+			if *param.v, src, ok = decode64Uint32(src, param.min); !ok {
+				return "", ErrInvalid
+			}
+		}
+		if have&^0xf != 0 || have&(4|8) != 0 {
+			// Hash upgrades and ROMs are not supported.
+			return "", ErrUnsupported
+		}
+	}
+	if src == "" || src[0] != '$' {
+		return "", ErrInvalid
+	}
+	saltStr := src[1:]
+	if i := strings.LastIndexByte(saltStr, '$'); i >= 0 {
+		saltStr = saltStr[:i]
+	}
+	salt, ok := decode64(saltStr)
+	if !ok {
+		return "", ErrInvalid
+	}
+
+	if flags != yescryptDefaults {
+		return "", ErrUnsupported
+	}
+	n := uint64(1) << nLog2
+	if r < 1 || p < 1 || n/uint64(p) <= 1 || uint64(r)*uint64(p) >= 1<<30 ||
+		n*uint64(r) > yescryptMaxMemory/128 {
+		return "", ErrUnsupported
+	}
+	hash, err := yescrypt(password, salt, flags, n, r, p, t)
+	if err != nil {
+		return "", err
+	}
+	prefix := setting[:len(setting)-len(src)+1+len(saltStr)]
+	return prefix + "$" + encode64(hash), nil
+}
+
+// yescrypt derives a 32 bytes key from password, prehashing it with
+// smaller parameters when the memory used is large.
+func yescrypt(password, salt []byte, flags uint32, n uint64, r, p, t uint32) ([]byte, error) {
+	if flags&yescryptRW != 0 && n/uint64(p) >= 0x100 && n/uint64(p)*uint64(r) >= 0x20000 {
+		dk, err := yescryptBody(password, salt, flags|yescryptPrehash, n>>6, r, p, 0)
+		if err != nil {
+			return nil, err
+		}
+		defer clear(dk)
+		password = dk
+	}
+	return yescryptBody(password, salt, flags, n, r, p, t)
+}
+
+func hmacSHA256(key, msg []byte) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write(msg)
+	return h.Sum(nil)
+}
+
+// yescryptBody derives a 32 bytes key from password.
+func yescryptBody(password, salt []byte, flags uint32, n uint64, r, p, t uint32) ([]byte, error) {
+	if flags != 0 {
+		key := "yescrypt-prehash"
+		if flags&yescryptPrehash == 0 {
+			key = key[:8]
+		}
+		password = hmacSHA256([]byte(key), password)
+		defer clear(password)
+	}
+	bb, err := pbkdf2.Key(sha256.New, string(password), salt, 1, int(128*r*p))
+	if err != nil {
+		return nil, err
+	}
+	b := make([]uint32, len(bb)/4)
+	for i := range b {
+		b[i] = binary.LittleEndian.Uint32(bb[4*i:])
+	}
+	if flags != 0 {
+		// The prehashed password is updated by smix.
+		copy(password, bb[:32])
+	}
+
+	s := 32 * uint64(r)
+	v := make([]uint32, s*n)
+	xy := make([]uint32, 2*s)
+	if p == 1 || flags&yescryptRW != 0 {
+		smix(b, r, n, p, t, flags, v, xy, password)
+	} else {
+		for i := uint64(0); i < uint64(p); i++ {
+			smix(b[s*i:s*(i+1)], r, n, 1, t, flags, v, xy, nil)
+		}
+	}
+	for i, w := range b {
+		binary.LittleEndian.PutUint32(bb[4*i:], w)
+	}
+	clear(b)
+	clear(v)
+
+	dk, err := pbkdf2.Key(sha256.New, string(password), bb, 1, 32)
+	clear(bb)
+	if err != nil {
+		return nil, err
+	}
+	if flags != 0 && flags&yescryptPrehash == 0 {
+		// The final steps of SCRAM.
+		clientKey := hmacSHA256(dk, []byte("Client Key"))
+		storedKey := sha256.Sum256(clientKey)
+		copy(dk, storedKey[:])
+	}
+	return dk, nil
+}
+
+// pwxformCtx is the state of the pwxform transformation: its S-boxes, as
+// offsets in S, and the write position in S2.
+type pwxformCtx struct {
+	s          []uint32
+	s0, s1, s2 int
+	w          int
+}
+
+// pwxform transforms the block with the S-boxes.
+func (c *pwxformCtx) pwxform(b []uint32) {
+	s, s0, s1, s2, w := c.s, c.s0, c.s1, c.s2, c.w
+	for i := 0; i < pwxRounds; i++ {
+		for j := 0; j < pwxGather; j++ {
+			x := b[j*2*pwxSimple : (j+1)*2*pwxSimple]
+			p0 := s0 + int(x[0]&sMask)/4
+			p1 := s1 + int(x[1]&sMask)/4
+			for k := 0; k < pwxSimple; k++ {
+				v := uint64(x[2*k+1]) * uint64(x[2*k])
+				v += uint64(s[p0+2*k+1])<<32 | uint64(s[p0+2*k])
+				v ^= uint64(s[p1+2*k+1])<<32 | uint64(s[p1+2*k])
+				x[2*k], x[2*k+1] = uint32(v), uint32(v>>32)
+				if i != 0 && i != pwxRounds-1 {
+					s[s2+2*w], s[s2+2*w+1] = uint32(v), uint32(v>>32)
+					w++
+				}
+			}
+		}
+	}
+	c.s0, c.s1, c.s2 = s2, s0, s1
+	c.w = w & ((1<<sWidth)*pwxSimple - 1)
+}
+
+// salsa20 applies the Salsa20 core with the given number of rounds to the
+// block, whose words are in the SIMD shuffled order of yescrypt.
+func salsa20(b []uint32, rounds int) {
+	var x [16]uint32
+	for i := range 16 {
+		x[i*5%16] = b[i]
+	}
+	for i := 0; i < rounds; i += 2 {
+		x[4] ^= bits.RotateLeft32(x[0]+x[12], 7)
+		x[8] ^= bits.RotateLeft32(x[4]+x[0], 9)
+		x[12] ^= bits.RotateLeft32(x[8]+x[4], 13)
+		x[0] ^= bits.RotateLeft32(x[12]+x[8], 18)
+		x[9] ^= bits.RotateLeft32(x[5]+x[1], 7)
+		x[13] ^= bits.RotateLeft32(x[9]+x[5], 9)
+		x[1] ^= bits.RotateLeft32(x[13]+x[9], 13)
+		x[5] ^= bits.RotateLeft32(x[1]+x[13], 18)
+		x[14] ^= bits.RotateLeft32(x[10]+x[6], 7)
+		x[2] ^= bits.RotateLeft32(x[14]+x[10], 9)
+		x[6] ^= bits.RotateLeft32(x[2]+x[14], 13)
+		x[10] ^= bits.RotateLeft32(x[6]+x[2], 18)
+		x[3] ^= bits.RotateLeft32(x[15]+x[11], 7)
+		x[7] ^= bits.RotateLeft32(x[3]+x[15], 9)
+		x[11] ^= bits.RotateLeft32(x[7]+x[3], 13)
+		x[15] ^= bits.RotateLeft32(x[11]+x[7], 18)
+
+		x[1] ^= bits.RotateLeft32(x[0]+x[3], 7)
+		x[2] ^= bits.RotateLeft32(x[1]+x[0], 9)
+		x[3] ^= bits.RotateLeft32(x[2]+x[1], 13)
+		x[0] ^= bits.RotateLeft32(x[3]+x[2], 18)
+		x[6] ^= bits.RotateLeft32(x[5]+x[4], 7)
+		x[7] ^= bits.RotateLeft32(x[6]+x[5], 9)
+		x[4] ^= bits.RotateLeft32(x[7]+x[6], 13)
+		x[5] ^= bits.RotateLeft32(x[4]+x[7], 18)
+		x[11] ^= bits.RotateLeft32(x[10]+x[9], 7)
+		x[8] ^= bits.RotateLeft32(x[11]+x[10], 9)
+		x[9] ^= bits.RotateLeft32(x[8]+x[11], 13)
+		x[10] ^= bits.RotateLeft32(x[9]+x[8], 18)
+		x[12] ^= bits.RotateLeft32(x[15]+x[14], 7)
+		x[13] ^= bits.RotateLeft32(x[12]+x[15], 9)
+		x[14] ^= bits.RotateLeft32(x[13]+x[12], 13)
+		x[15] ^= bits.RotateLeft32(x[14]+x[13], 18)
+	}
+	for i := range 16 {
+		b[i] += x[i*5%16]
+	}
+}
+
+func blkxor(dst, src []uint32) {
+	for i := range dst {
+		dst[i] ^= src[i]
+	}
+}
+
+// blockmixSalsa8 computes BlockMix with Salsa20/8, as scrypt does, using y
+// as temporary space.
+func blockmixSalsa8(b, y []uint32, r uint32) {
+	var x [16]uint32
+	copy(x[:], b[(2*r-1)*16:])
+	for i := uint32(0); i < 2*r; i++ {
+		blkxor(x[:], b[i*16:(i+1)*16])
+		salsa20(x[:], 8)
+		copy(y[i*16:], x[:])
+	}
+	for i := uint32(0); i < r; i++ {
+		copy(b[i*16:(i+1)*16], y[(2*i)*16:])
+		copy(b[(i+r)*16:(i+r+1)*16], y[(2*i+1)*16:])
+	}
+}
+
+// blockmixPwxform computes BlockMix with pwxform.
+func blockmixPwxform(b []uint32, ctx *pwxformCtx, r uint32) {
+	var x [pwxWords]uint32
+	r1 := 128 * r / pwxBytes
+	copy(x[:], b[(r1-1)*pwxWords:])
+	for i := uint32(0); i < r1; i++ {
+		if r1 > 1 {
+			blkxor(x[:], b[i*pwxWords:(i+1)*pwxWords])
+		}
+		ctx.pwxform(x[:])
+		copy(b[i*pwxWords:], x[:])
+	}
+	i := (r1 - 1) * pwxBytes / 64
+	salsa20(b[i*16:(i+1)*16], 2)
+	for i++; i < 2*r; i++ {
+		blkxor(b[i*16:(i+1)*16], b[(i-1)*16:i*16])
+		salsa20(b[i*16:(i+1)*16], 2)
+	}
+}
+
+func blockmix(x, y []uint32, r uint32, ctx *pwxformCtx) {
+	if ctx != nil {
+		blockmixPwxform(x, ctx, r)
+	} else {
+		blockmixSalsa8(x, y, r)
+	}
+}
+
+func integerify(b []uint32, r uint32) uint64 {
+	x := b[(2*r-1)*16:]
+	return uint64(x[13])<<32 | uint64(x[0])
+}
+
+// p2floor returns the largest power of 2 not greater than x.
+func p2floor(x uint64) uint64 {
+	for y := x & (x - 1); y != 0; y = x & (x - 1) {
+		x = y
+	}
+	return x
+}
+
+func wrap(x, i uint64) uint64 {
+	n := p2floor(i)
+	return x&(n-1) + (i - n)
+}
+
+// shuffle copies the block b to x in the SIMD shuffled order.
+func shuffle(x, b []uint32) {
+	for k := 0; k < len(b); k += 16 {
+		for i := range 16 {
+			x[k+i] = b[k+i*5%16]
+		}
+	}
+}
+
+// unshuffle copies the block x, in the SIMD shuffled order, to b.
+func unshuffle(b, x []uint32) {
+	for k := 0; k < len(b); k += 16 {
+		for i := range 16 {
+			b[k+i*5%16] = x[k+i]
+		}
+	}
+}
+
+// smix1 fills v with the n successive blocks computed from b.
+func smix1(b []uint32, r uint32, n uint64, flags uint32, v, xy []uint32, ctx *pwxformCtx) {
+	s := 32 * uint64(r)
+	x, y := xy[:s], xy[s:2*s]
+	shuffle(x, b[:s])
+	for i := uint64(0); i < n; i++ {
+		copy(v[i*s:(i+1)*s], x)
+		if flags&yescryptRW != 0 && i > 1 {
+			j := wrap(integerify(x, r), i)
+			blkxor(x, v[j*s:(j+1)*s])
+		}
+		blockmix(x, y, r, ctx)
+	}
+	unshuffle(b[:s], x)
+}
+
+// smix2 mixes b with nloop blocks of v, updating them with the RW flag.
+func smix2(b []uint32, r uint32, n, nloop uint64, flags uint32, v, xy []uint32, ctx *pwxformCtx) {
+	s := 32 * uint64(r)
+	x, y := xy[:s], xy[s:2*s]
+	shuffle(x, b[:s])
+	for i := uint64(0); i < nloop; i++ {
+		j := integerify(x, r) & (n - 1)
+		blkxor(x, v[j*s:(j+1)*s])
+		if flags&yescryptRW != 0 {
+			copy(v[j*s:(j+1)*s], x)
+		}
+		blockmix(x, y, r, ctx)
+	}
+	unshuffle(b[:s], x)
+}
+
+// smix computes the p blocks of b, updating the prehashed password with the
+// RW flag.
+func smix(b []uint32, r uint32, n uint64, p, t, flags uint32, v, xy []uint32, password []byte) {
+	s := 32 * uint64(r)
+	nchunk := n / uint64(p)
+	nloopAll := nchunk
+	if flags&yescryptRW != 0 {
+		if t <= 1 {
+			if t != 0 {
+				nloopAll *= 2
+			}
+			nloopAll = (nloopAll + 2) / 3
+		} else {
+			nloopAll *= uint64(t) - 1
+		}
+	} else if t != 0 {
+		if t == 1 {
+			nloopAll += (nloopAll + 1) / 2
+		}
+		nloopAll *= uint64(t)
+	}
+	var nloopRW uint64
+	if flags&yescryptRW != 0 {
+		nloopRW = nloopAll / uint64(p)
+	}
+	nchunk &^= 1
+	nloopAll = (nloopAll + 1) &^ 1
+	nloopRW = (nloopRW + 1) &^ 1
+
+	var ctxs []pwxformCtx
+	if flags&yescryptRW != 0 {
+		ctxs = make([]pwxformCtx, p)
+	}
+	var vchunk uint64
+	for i := uint64(0); i < uint64(p); i++ {
+		np := nchunk
+		if i == uint64(p)-1 {
+			np = n - vchunk
+		}
+		bp := b[s*i : s*(i+1)]
+		vp := v[s*vchunk:]
+		var ctx *pwxformCtx
+		if flags&yescryptRW != 0 {
+			ctx = &ctxs[i]
+			ctx.s = make([]uint32, sWords)
+			smix1(bp, 1, sBytes/128, 0, ctx.s, xy, nil)
+			ctx.s2 = 0
+			ctx.s1 = ctx.s2 + (1<<sWidth)*pwxSimple*2
+			ctx.s0 = ctx.s1 + (1<<sWidth)*pwxSimple*2
+			if i == 0 {
+				key := make([]byte, 64)
+				for k, w := range bp[s-16:] {
+					binary.LittleEndian.PutUint32(key[4*k:], w)
+				}
+				copy(password, hmacSHA256(key, password))
+			}
+		}
+		smix1(bp, r, np, flags, vp, xy, ctx)
+		smix2(bp, r, p2floor(np), nloopRW, flags, vp, xy, ctx)
+		vchunk += nchunk
+	}
+	for i := uint64(0); i < uint64(p); i++ {
+		var ctx *pwxformCtx
+		if flags&yescryptRW != 0 {
+			ctx = &ctxs[i]
+		}
+		smix2(b[s*i:s*(i+1)], r, n, nloopAll-nloopRW, flags&^yescryptRW, v, xy, ctx)
+	}
+}
+
+// decode64Uint32 decodes the variable length integer at the start of src,
+// returning the rest of src.
+func decode64Uint32(src string, min uint32) (uint32, string, bool) {
+	if src == "" {
+		return 0, "", false
+	}
+	c := atoi64(src[0])
+	if c > 63 {
+		return 0, "", false
+	}
+	src = src[1:]
+	start, end, chars, shift := uint32(0), uint32(47), 1, uint32(0)
+	v := min
+	for c > end {
+		v += (end + 1 - start) << shift
+		start = end + 1
+		end = start + (62-end)/2
+		chars++
+		shift += 6
+	}
+	v += (c - start) << shift
+	for ; chars > 1; chars-- {
+		if src == "" {
+			return 0, "", false
+		}
+		c := atoi64(src[0])
+		if c > 63 {
+			return 0, "", false
+		}
+		src = src[1:]
+		shift -= 6
+		v += c << shift
+	}
+	return v, src, true
+}
+
+// decode64 decodes the little-endian encoding of the salts.
+func decode64(src string) ([]byte, bool) {
+	var dst []byte
+	for src != "" {
+		var v, n uint32
+		for n < 24 && src != "" {
+			c := atoi64(src[0])
+			if c > 63 {
+				return nil, false
+			}
+			src = src[1:]
+			v |= c << n
+			n += 6
+		}
+		if n < 12 {
+			return nil, false
+		}
+		for ; n >= 8; n -= 8 {
+			dst = append(dst, byte(v))
+			v >>= 8
+		}
+		if v != 0 {
+			return nil, false
+		}
+	}
+	return dst, true
+}
+
+// encode64 encodes the hashes, by groups of three little-endian bytes.
+func encode64(src []byte) string {
+	var out strings.Builder
+	for i := 0; i < len(src); {
+		var v, n uint32
+		for ; n < 24 && i < len(src); n += 8 {
+			v |= uint32(src[i]) << n
+			i++
+		}
+		for ; n > 0; n -= min(n, 6) {
+			out.WriteByte(itoa64[v&0x3f])
+			v >>= 6
+		}
+	}
+	return out.String()
+}
@@ -0,0 +1,115 @@
+//go:build cgo
+
+package pam
+
+//#include <string.h>
+import "C"
+
+import (
+	"sync"
+	"unsafe"
+)
+
+// maxCachedCStrings bounds the number of strings cached by a transaction,
+// so that callers using many distinct names don't grow it without limit.
+const maxCachedCStrings = 64
+
+// cStringCache holds the C copies of the strings a transaction passes to PAM
+// repeatedly, such as the names of the environment variables it reads, so
+// that they are allocated once rather than for each call. The copies are
+// freed when the transaction ends. It also holds the Go copies of the last
+// values read, such as those of the items, returned again while unchanged.
+// A nil cache, as the one of a zero Transaction, caches nothing.
+//
+// It is locked, as the conversation handlers call the transaction from
+// goroutines of their own, rather than relying on the operations they nest
+// in to order them.
+type cStringCache struct {
+	mu      sync.Mutex
+	strings map[string]*C.char
+	values  map[valueKey]string
+}
+
+// valueKey identifies a value read by a transaction: an item, or an
+// environment variable by name.
+type valueKey struct {
+	item Item
+	name string
+}
+
+// get returns the C copy of s and whether it is cached. Copies not cached,
+// once the cache is full, must be freed by the caller.
+func (c *cStringCache) get(s string) (*C.char, bool) {
+	if c == nil {
+		return cString(s), false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.strings[s]; ok {
+		return p, true
+	}
+	p := cString(s)
+	if len(c.strings) >= maxCachedCStrings {
+		return p, false
+	}
+	if c.strings == nil {
+		c.strings = map[string]*C.char{}
+	}
+	c.strings[s] = p
+	return p, true
+}
+
+// value returns the Go copy of the value p read for k, reusing the last
+// copy if it is unchanged, so that reading the same value again does not
+// allocate.
+func (c *cStringCache) value(k valueKey, p *C.char) string {
+	b := unsafe.Slice((*byte)(unsafe.Pointer(p)), C.strlen(p))
+	if c == nil {
+		return string(b)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v, ok := c.values[k]
+	if ok && v == string(b) {
+		return v
+	}
+	v = string(b)
+	if !ok && len(c.values) >= maxCachedCStrings {
+		return v
+	}
+	if c.values == nil {
+		c.values = map[valueKey]string{}
+	}
+	c.values[k] = v
+	return v
+}
+
+// free releases the cached copies.
+func (c *cStringCache) free() {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for s, p := range c.strings {
+		cFree(unsafe.Pointer(p))
+		delete(c.strings, s)
+	}
+	clear(c.values)
+}
+
+// smallString is the size of the buffers holding the C copies of the short
+// strings passed to the C functions not retaining them, see cStringBuf.
+const smallString = 128
+
+// cStringBuf returns a C copy of s held by buf, so that a buffer on the
+// stack saves its allocation, and whether s fits there with its terminating
+// NUL. The copies are only valid for the C functions declared as noescape.
+func cStringBuf(buf []byte, s string) (*C.char, bool) {
+	if len(s) >= len(buf) {
+		return nil, false
+	}
+	n := copy(buf, s)
+	buf[n] = 0
+	return (*C.char)(unsafe.Pointer(&buf[0])), true
+}
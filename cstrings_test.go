@@ -0,0 +1,66 @@
+//go:build cgo
+
+package pam
+
+import (
+	"fmt"
+	"testing"
+	"unsafe"
+)
+
+func TestCStringCache(t *testing.T) {
+	var c cStringCache
+	p, cached := c.get("HOME")
+	if !cached {
+		t.Fatalf("get #error: expected the string to be cached")
+	}
+	if q, _ := c.get("HOME"); q != p {
+		t.Fatalf("get #error: expected the cached copy %p, got %p", p, q)
+	}
+	for i := len(c.strings); i < maxCachedCStrings; i++ {
+		c.get(fmt.Sprintf("VAR%d", i))
+	}
+	p, cached = c.get("UNCACHED")
+	if cached {
+		t.Fatalf("get #error: expected the string not to be cached once full")
+	}
+	cFree(unsafe.Pointer(p))
+	c.free()
+	if len(c.strings) != 0 {
+		t.Fatalf("free #error: expected no cached strings, got %d", len(c.strings))
+	}
+
+	var empty *cStringCache
+	p, cached = empty.get("HOME")
+	if cached {
+		t.Fatalf("get #error: expected a nil cache to cache nothing")
+	}
+	cFree(unsafe.Pointer(p))
+	empty.free()
+}
+
+func TestCStringCache_Value(t *testing.T) {
+	var c cStringCache
+	p := cString("alice")
+	defer cFree(unsafe.Pointer(p))
+	v := c.value(valueKey{item: User}, p)
+	if w := c.value(valueKey{item: User}, p); v != "alice" || unsafe.StringData(w) != unsafe.StringData(v) {
+		t.Fatalf("value #error: expected the cached copy of %q, got %q", v, w)
+	}
+	q := cString("bob")
+	defer cFree(unsafe.Pointer(q))
+	if w := c.value(valueKey{item: User}, q); w != "bob" {
+		t.Fatalf("value #error: expected bob, got %q", w)
+	}
+	if w := c.value(valueKey{name: "USER"}, p); w != "alice" {
+		t.Fatalf("value #error: expected alice, got %q", w)
+	}
+
+	var buf [8]byte
+	if s, ok := cStringBuf(buf[:], "short"); !ok || unsafe.String((*byte)(unsafe.Pointer(s)), 6) != "short\x00" {
+		t.Fatalf("buf #error: expected short in the buffer, got %v", ok)
+	}
+	if _, ok := cStringBuf(buf[:], "too long"); ok {
+		t.Fatalf("buf #error: expected a string not fitting with its NUL")
+	}
+}
@@ -0,0 +1,100 @@
+package pam
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DebugLogEnv is the environment variable enabling the debug log of all the
+// transactions on the standard error, if set to a value other than 0, to
+// diagnose the failures of the stacks without rebuilding the application.
+const DebugLogEnv = "GO_PAM_DEBUG"
+
+// debugLogger writes a line for each PAM call and conversation.
+type debugLogger struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewDebugLogger returns an observer writing a line to w before and after
+// each PAM call and each conversation of the transactions, with their
+// arguments and their status:
+//
+//	pam[1] -> pam_authenticate(user="alice", flags=DisallowNullAuthtok)
+//	pam[1] -> conv(PAM_PROMPT_ECHO_OFF "Password: ")
+//	pam[1] <- conv = PAM_SUCCESS (2.1s)
+//	pam[1] <- pam_authenticate = PAM_AUTH_ERR (2.3s)
+//
+// As the other observers, it never gets the values of the items nor the
+// responses, such as the authentication tokens.
+func NewDebugLogger(w io.Writer) Observer {
+	return &debugLogger{w: w}
+}
+
+// WithDebugLog writes the debug log of the transaction to w, see
+// NewDebugLogger.
+func WithDebugLog(w io.Writer) StartOption {
+	return WithObserver(NewDebugLogger(w))
+}
+
+// envDebugLogger returns the debug logger of the transactions enabled with
+// DebugLogEnv, if any.
+var envDebugLogger = sync.OnceValue(func() Observer {
+	if v := os.Getenv(DebugLogEnv); v == "" || v == "0" {
+		return nil
+	}
+	return NewDebugLogger(os.Stderr)
+})
+
+// Observe writes the line of the event.
+func (l *debugLogger) Observe(e Event) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "pam[%d] ", e.ID)
+	switch e.Kind {
+	case EventCallStart:
+		fmt.Fprintf(&b, "-> pam_%s(%s)", e.Operation, debugArgs(e))
+	case EventConversationStart:
+		b.WriteString("-> conv(")
+		for i, m := range e.Messages {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			b.WriteString(m.Style.String())
+			if m.Style != BinaryPrompt {
+				fmt.Fprintf(&b, " %q", m.Message)
+			}
+		}
+		b.WriteByte(')')
+	default:
+		name := "pam_" + e.Operation
+		if e.Kind == EventConversation {
+			name = e.Operation
+		}
+		fmt.Fprintf(&b, "<- %s = %s (%v)", name, e.Status.String(), e.Duration)
+	}
+	b.WriteByte('\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	io.WriteString(l.w, b.String())
+}
+
+// debugArgs returns the arguments of the call of the event.
+func debugArgs(e Event) string {
+	var args []string
+	if e.Operation == "start" {
+		args = append(args, fmt.Sprintf("service=%q", e.Service))
+	}
+	if e.User != "" {
+		args = append(args, fmt.Sprintf("user=%q", e.User))
+	}
+	if e.Operation == "set_item" || e.Operation == "get_item" {
+		args = append(args, "item="+e.Item.String())
+	}
+	if e.Flags != 0 {
+		args = append(args, "flags="+e.Flags.String())
+	}
+	return strings.Join(args, ", ")
+}
@@ -0,0 +1,48 @@
+package pam
+
+import (
+	"os/user"
+	"strings"
+	"testing"
+)
+
+func TestWithDebugLog(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	var b strings.Builder
+	u, _ := user.Current()
+	tx, err := StartWithOptions("echo-service", WithUser(u.Username),
+		WithConversationHandler(ConversationFunc(func(Style, string) (string, error) {
+			return "", nil
+		})), WithConfDir("test-services"),
+		WithDebugLog(&b), WithRUser("secret"))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err := tx.Authenticate(DisallowNullAuthtok); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+
+	log := b.String()
+	for _, expected := range []string{
+		`-> pam_start(service="echo-service")`,
+		"<- pam_start = PAM_SUCCESS (",
+		`-> pam_set_item(user="` + u.Username + `", item=PAM_RUSER)`,
+		`-> pam_authenticate(user="` + u.Username + `", flags=DisallowNullAuthtok)`,
+		`-> conv(PAM_TEXT_INFO "This is an info message for user ` + u.Username + ` on echo-service")`,
+		"<- conv = PAM_SUCCESS (",
+		"<- pam_authenticate = PAM_SUCCESS (",
+		"<- pam_end = PAM_SUCCESS (",
+	} {
+		if !strings.Contains(log, expected) {
+			t.Fatalf("debug log #error: %q not found in:\n%s", expected, log)
+		}
+	}
+	if strings.Contains(log, "secret") {
+		t.Fatalf("debug log #error: item value logged:\n%s", log)
+	}
+}
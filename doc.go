@@ -0,0 +1,8 @@
+// Package pam provides a wrapper for the PAM application API.
+//
+// Building without cgo, such as when cross-compiling, selects a stub with
+// the same types and constants, using the values of Linux-PAM, whose
+// transactions never start: Start fails with ErrUnavailable. The code
+// gating PAM behind a feature flag can so be built and unit tested on the
+// platforms without libpam.
+package pam
@@ -0,0 +1,44 @@
+package pam
+
+import "errors"
+
+// EndOptions configure EndWithOptions.
+type EndOptions struct {
+	// Silent passes Silent to the operations closing the session and
+	// deleting the credentials.
+	Silent bool
+	// DataSilent passes DataSilent to pam_end, so that the modules
+	// release their data without side effects.
+	DataSilent bool
+	// CloseSession closes the session first, if an operation of the
+	// transaction opened it and it was not closed yet.
+	CloseSession bool
+	// DeleteCred deletes the credentials once the session is closed, if
+	// an operation of the transaction established them and they were not
+	// deleted yet.
+	DeleteCred bool
+}
+
+// EndWithOptions ends the transaction as End does, closing its session and
+// deleting its credentials first if requested, as the applications do
+// before ending their transactions. The transaction is ended even if they
+// fail, and the errors are joined. Transactions which are garbage collected
+// are still ended without those steps, reporting a successful status.
+func (t *Transaction) EndWithOptions(o EndOptions) error {
+	var f Flags
+	if o.Silent {
+		f = Silent
+	}
+	var errs []error
+	if o.CloseSession && t.session.Load() {
+		errs = append(errs, t.CloseSession(f))
+	}
+	if o.DeleteCred && t.cred.Load() {
+		errs = append(errs, t.SetCred(f|DeleteCred))
+	}
+	var endFlags Flags
+	if o.DataSilent {
+		endFlags = DataSilent
+	}
+	return errors.Join(append(errs, t.End(endFlags))...)
+}
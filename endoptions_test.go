@@ -0,0 +1,64 @@
+package pam
+
+import (
+	"fmt"
+	"os/user"
+	"slices"
+	"testing"
+)
+
+func TestEndWithOptions(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	for name, tc := range map[string]struct {
+		session  bool
+		opts     EndOptions
+		expected []string
+	}{
+		"all": {
+			session: true,
+			opts:    EndOptions{Silent: true, DataSilent: true, CloseSession: true, DeleteCred: true},
+			expected: []string{"open_session 0", "setcred EstablishCred",
+				"close_session Silent", "setcred Silent|DeleteCred", "end " + DataSilent.String()},
+		},
+		"kept": {
+			session:  true,
+			opts:     EndOptions{},
+			expected: []string{"open_session 0", "setcred EstablishCred", "end 0"},
+		},
+		"nothing established": {
+			opts:     EndOptions{CloseSession: true, DeleteCred: true},
+			expected: []string{"end 0"},
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			var ops []string
+			tx, err := StartWithOptions("login-service", WithUser(u.Username),
+				WithConfDir("test-services"),
+				WithObserver(ObserverFunc(func(e Event) {
+					if e.Kind == EventOperation || e.Kind == EventEnd {
+						ops = append(ops, fmt.Sprintf("%s %v", e.Operation, e.Flags))
+					}
+				})))
+			if err != nil {
+				t.Fatalf("start #error: %v", err)
+			}
+			if tc.session {
+				if err := tx.OpenSession(0); err != nil {
+					t.Fatalf("opensession #error: %v", err)
+				}
+				if err := tx.SetCred(EstablishCred); err != nil {
+					t.Fatalf("setcred #error: %v", err)
+				}
+			}
+			if err := tx.EndWithOptions(tc.opts); err != nil {
+				t.Fatalf("end #error: %v", err)
+			}
+			if !slices.Equal(ops, tc.expected) {
+				t.Fatalf("end #error: expected %v, got %v", tc.expected, ops)
+			}
+		})
+	}
+}
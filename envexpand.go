@@ -0,0 +1,257 @@
+package pam
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"strings"
+)
+
+// EnvExpander expands the references of the values of pam_env.conf: ${VAR}
+// is the value of a variable of the PAM environment, or of the environment
+// of the process, and @{NAME} is the value of a PAM item, named as in
+// pam_env (PAM_USER, PAM_RHOST...), or the HOME and SHELL of the user.
+// A backslash before a $ or a @ escapes it. The unknown references expand
+// to empty strings.
+type EnvExpander struct {
+	// Env is the PAM environment.
+	Env map[string]string
+	// OSEnv allows the variables that are not in Env to be looked up in
+	// the environment of the process, as pam_env does.
+	OSEnv bool
+	// Items are the values of the @{NAME} references, by name.
+	Items map[string]string
+}
+
+// envItems are the items available to the @{NAME} references and part of
+// the snapshots. The authentication tokens never are.
+var envItems = []Item{Service, User, Tty, Rhost, Ruser, UserPrompt}
+
+// EnvExpander returns an EnvExpander for the current PAM environment and
+// items of the transaction, with the HOME of the user as the system knows
+// it. The expanders can't know their SHELL, which the callers can add to
+// the items.
+func (t *Transaction) EnvExpander() (*EnvExpander, error) {
+	env, err := t.GetEnvList()
+	if err != nil {
+		return nil, err
+	}
+	items, err := t.GetItems(envItems)
+	if err != nil {
+		return nil, err
+	}
+	e := &EnvExpander{Env: env, OSEnv: true, Items: map[string]string{}}
+	for item, value := range items {
+		e.Items[item.String()] = value
+	}
+	if name := items[User]; name != "" {
+		if u, err := user.Lookup(name); err == nil {
+			e.Items["HOME"] = u.HomeDir
+		}
+	}
+	return e, nil
+}
+
+// lookup returns the value of the variable.
+func (e *EnvExpander) lookup(name string) string {
+	if value, ok := e.Env[name]; ok {
+		return value
+	}
+	if e.OSEnv {
+		return os.Getenv(name)
+	}
+	return ""
+}
+
+// Expand expands the references of s. It fails if a reference is not
+// terminated.
+func (e *EnvExpander) Expand(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && (s[i+1] == '$' || s[i+1] == '@'):
+			b.WriteByte(s[i+1])
+			i++
+		case (c == '$' || c == '@') && i+1 < len(s) && s[i+1] == '{':
+			end := strings.IndexByte(s[i+2:], '}')
+			if end < 0 {
+				return "", fmt.Errorf("unterminated reference %q", s[i:])
+			}
+			name := s[i+2 : i+2+end]
+			if c == '$' {
+				b.WriteString(e.lookup(name))
+			} else {
+				b.WriteString(e.Items[name])
+			}
+			i += 2 + end
+		default:
+			// As in pam_env, the $ and @ not followed by a { are kept.
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), nil
+}
+
+// EnvRule is a rule of pam_env.conf, defining a variable.
+type EnvRule struct {
+	Name string
+	// Default is the value of the variable if Override is empty, nil if
+	// not set. An unset Default unsets the variable, unlike an empty one,
+	// written DEFAULT="".
+	Default *string
+	// Override is the value of the variable, unless it expands to an
+	// empty string.
+	Override string
+}
+
+// Value returns the value of the variable, expanded by e, and whether it is
+// set.
+func (r EnvRule) Value(e *EnvExpander) (string, bool, error) {
+	override, err := e.Expand(r.Override)
+	if err != nil || override != "" {
+		return override, err == nil, err
+	}
+	if r.Default == nil {
+		return "", false, nil
+	}
+	value, err := e.Expand(*r.Default)
+	return value, err == nil, err
+}
+
+// ParseEnvConf parses the rules of a pam_env.conf file:
+//
+//	VARIABLE [DEFAULT=[value]] [OVERRIDE=[value]]
+//
+// The values can be quoted with double quotes, and the lines continued by
+// ending them with a backslash. The lines starting with # are comments.
+func ParseEnvConf(r io.Reader) ([]EnvRule, error) {
+	var rules []EnvRule
+	scanner := bufio.NewScanner(r)
+	n, line := 0, ""
+	for scanner.Scan() {
+		n++
+		text := scanner.Text()
+		if strings.HasSuffix(text, "\\") {
+			line += strings.TrimSuffix(text, "\\")
+			continue
+		}
+		line += text
+		rule, ok, err := parseEnvRule(line)
+		line = ""
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		if ok {
+			rules = append(rules, rule)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if line != "" {
+		return nil, errors.New("unterminated line continuation")
+	}
+	return rules, nil
+}
+
+// parseEnvRule parses a line of pam_env.conf, returning false for the
+// empty lines and the comments.
+func parseEnvRule(line string) (EnvRule, bool, error) {
+	fields, err := splitEnvFields(line)
+	if err != nil || len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+		return EnvRule{}, false, err
+	}
+	rule := EnvRule{Name: fields[0]}
+	for _, field := range fields[1:] {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			return EnvRule{}, false, fmt.Errorf("invalid option %q", field)
+		}
+		switch key {
+		case "DEFAULT":
+			if value != "" {
+				value := unquoteEnvValue(value)
+				rule.Default = &value
+			}
+		case "OVERRIDE":
+			rule.Override = unquoteEnvValue(value)
+		default:
+			return EnvRule{}, false, fmt.Errorf("unknown option %q", key)
+		}
+	}
+	return rule, true, nil
+}
+
+// splitEnvFields splits a line on the spaces outside of double quotes.
+func splitEnvFields(line string) ([]string, error) {
+	var fields []string
+	var field strings.Builder
+	quoted, inField := false, false
+	for _, r := range line {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			field.WriteRune(r)
+			inField = true
+		case !quoted && (r == ' ' || r == '\t'):
+			if inField {
+				fields = append(fields, field.String())
+				field.Reset()
+				inField = false
+			}
+		default:
+			field.WriteRune(r)
+			inField = true
+		}
+	}
+	if quoted {
+		return nil, errors.New("unterminated quote")
+	}
+	if inField {
+		fields = append(fields, field.String())
+	}
+	return fields, nil
+}
+
+// unquoteEnvValue removes the double quotes around a value.
+func unquoteEnvValue(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return value[1 : len(value)-1]
+	}
+	return value
+}
+
+// ApplyEnvRules defines the variables of the rules in the PAM environment,
+// in order, as pam_env does with pam_env.conf, expanding their values with
+// e. The variables defined by a rule are available to the following ones,
+// as e is updated with them.
+func (t *Transaction) ApplyEnvRules(rules []EnvRule, e *EnvExpander) error {
+	if e.Env == nil {
+		e.Env = map[string]string{}
+	}
+	for _, r := range rules {
+		value, set, err := r.Value(e)
+		if err != nil {
+			return fmt.Errorf("%s: %w", r.Name, err)
+		}
+		if !set {
+			if _, ok := e.Env[r.Name]; !ok {
+				continue
+			}
+			if err := t.PutEnv(r.Name); err != nil {
+				return err
+			}
+			delete(e.Env, r.Name)
+			continue
+		}
+		if err := t.PutEnv(r.Name + "=" + value); err != nil {
+			return err
+		}
+		e.Env[r.Name] = value
+	}
+	return nil
+}
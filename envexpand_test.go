@@ -0,0 +1,121 @@
+package pam
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEnvExpander_Expand(t *testing.T) {
+	t.Setenv("GO_PAM_OS_VAR", "os")
+	e := &EnvExpander{
+		Env:   map[string]string{"LANG": "C.UTF-8", "GO_PAM_OS_VAR": "pam"},
+		Items: map[string]string{"PAM_USER": "alice", "HOME": "/home/alice"},
+	}
+	tests := []struct {
+		in, want string
+	}{
+		{"plain", "plain"},
+		{"${LANG}", "C.UTF-8"},
+		{"@{HOME}/.local/bin:${PATH}", "/home/alice/.local/bin:"},
+		{"@{PAM_USER}@example.com", "alice@example.com"},
+		{`\${LANG} \@{HOME}`, "${LANG} @{HOME}"},
+		{"$LANG @ $", "$LANG @ $"},
+		{`C:\path`, `C:\path`},
+		{"${GO_PAM_OS_VAR}", "pam"},
+		{"@{PAM_AUTHTOK}", ""},
+	}
+	for _, tc := range tests {
+		got, err := e.Expand(tc.in)
+		if err != nil || got != tc.want {
+			t.Fatalf("expand #error: %q: got %q, %v, expected %q", tc.in, got, err, tc.want)
+		}
+	}
+
+	delete(e.Env, "GO_PAM_OS_VAR")
+	if got, _ := e.Expand("${GO_PAM_OS_VAR}"); got != "" {
+		t.Fatalf("expand #error: got %q without OSEnv", got)
+	}
+	e.OSEnv = true
+	if got, _ := e.Expand("${GO_PAM_OS_VAR}"); got != "os" {
+		t.Fatalf("expand #error: got %q with OSEnv", got)
+	}
+	if _, err := e.Expand("${LANG"); err == nil {
+		t.Fatalf("expand #error: expected an unterminated reference failure")
+	}
+}
+
+func TestParseEnvConf(t *testing.T) {
+	conf := `# comment
+PAGER		DEFAULT=less
+EDITOR		DEFAULT="vi -e" \
+		OVERRIDE=${VISUAL}
+EMPTY		DEFAULT=""
+REMOVED		DEFAULT=
+
+`
+	rules, err := ParseEnvConf(strings.NewReader(conf))
+	if err != nil {
+		t.Fatalf("parse #error: %v", err)
+	}
+	if len(rules) != 4 {
+		t.Fatalf("parse #error: got %d rules", len(rules))
+	}
+	if r := rules[1]; r.Name != "EDITOR" || *r.Default != "vi -e" || r.Override != "${VISUAL}" {
+		t.Fatalf("parse #error: got %+v", r)
+	}
+	if r := rules[2]; r.Default == nil || *r.Default != "" {
+		t.Fatalf("parse #error: got %+v", r)
+	}
+	if r := rules[3]; r.Default != nil {
+		t.Fatalf("parse #error: got %+v", r)
+	}
+
+	for _, bad := range []string{"VAR DEFAULT=\"x", "VAR UNKNOWN=x", "VAR x", "VAR \\"} {
+		if _, err := ParseEnvConf(strings.NewReader(bad)); err == nil {
+			t.Fatalf("parse #error: %q: expected a failure", bad)
+		}
+	}
+}
+
+func TestTransaction_ApplyEnvRules(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	tx, err := StartConfDir("permit-service", "test", Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	if err := tx.PutEnv("REMOVED=1"); err != nil {
+		t.Fatalf("putenv #error: %v", err)
+	}
+	rules, err := ParseEnvConf(strings.NewReader(`
+GREETING	DEFAULT="hello @{PAM_USER}"
+MESSAGE		DEFAULT=${GREETING}! OVERRIDE=${UNSET_GO_PAM_VAR}
+EMPTY		DEFAULT=""
+REMOVED
+`))
+	if err != nil {
+		t.Fatalf("parse #error: %v", err)
+	}
+	e, err := tx.EnvExpander()
+	if err != nil {
+		t.Fatalf("expander #error: %v", err)
+	}
+	if err := tx.ApplyEnvRules(rules, e); err != nil {
+		t.Fatalf("apply #error: %v", err)
+	}
+	env, err := tx.GetEnvList()
+	if err != nil {
+		t.Fatalf("getenvlist #error: %v", err)
+	}
+	want := map[string]string{"GREETING": "hello test", "MESSAGE": "hello test!", "EMPTY": ""}
+	if len(env) != len(want) {
+		t.Fatalf("apply #error: got %q, expected %q", env, want)
+	}
+	for name, value := range want {
+		if got, ok := env[name]; !ok || got != value {
+			t.Fatalf("apply #error: got %q, expected %q", env, want)
+		}
+	}
+}
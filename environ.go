@@ -0,0 +1,128 @@
+package pam
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// GetEnvList returns a copy of the PAM environment as a map.
+func (t *Transaction) GetEnvList() (map[string]string, error) {
+	env := make(map[string]string)
+	err := t.envList(func(name, value string) bool {
+		env[name] = value
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// Env returns an iterator over the variables of the PAM environment,
+// without copying it first. The environment is read again on each
+// iteration; if it cannot be read, the iterator yields nothing, as for an
+// empty environment. The callers needing to tell them apart use GetEnvList,
+// which returns the error.
+func (t *Transaction) Env() iter.Seq2[string, string] {
+	return func(yield func(name, value string) bool) {
+		t.envList(yield)
+	}
+}
+
+// PutEnvs sets the variables of the PAM environment, in the order of their
+// names, with a single call to C rather than one by variable. The
+// variables that can't be set, such as those whose names are empty or
+// contain "=", don't prevent the others from being set, and their failures
+// are joined in the returned error.
+func (t *Transaction) PutEnvs(env map[string]string) error {
+	var errs []error
+	entries := make([]string, 0, len(env))
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		if name == "" || strings.Contains(name, "=") {
+			errs = append(errs, fmt.Errorf("%q: %w", name, ErrBadItem))
+			continue
+		}
+		entries = append(entries, name+"="+env[name])
+	}
+	return errors.Join(append(errs, t.putEnvs(entries))...)
+}
+
+// CopyEnv sets the NAME=value entries of from, such as those of os.Environ,
+// in the PAM environment, as pam_misc_paste_env does, with a single call to
+// C. Only the variables whose names filter accepts are copied, all of them
+// if filter is nil, and the malformed entries are skipped. The failures are
+// joined in the returned error.
+func (t *Transaction) CopyEnv(from []string, filter func(name string) bool) error {
+	entries := make([]string, 0, len(from))
+	for _, entry := range from {
+		name, _, ok := parseEnvEntry(entry)
+		if !ok || (filter != nil && !filter(name)) {
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return t.putEnvs(entries)
+}
+
+// parseEnvEntry splits a NAME=value entry as returned by pam_getenvlist.
+func parseEnvEntry(entry string) (name, value string, ok bool) {
+	name, value, ok = strings.Cut(entry, "=")
+	if !ok || name == "" {
+		return "", "", false
+	}
+	return name, value, true
+}
+
+// Environ returns a copy of the PAM environment as NAME=value entries, in
+// the order pam_getenvlist returns them, as os.Environ does.
+func (t *Transaction) Environ() ([]string, error) {
+	env := []string{}
+	err := t.envList(func(name, value string) bool {
+		env = append(env, name+"="+value)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return env, nil
+}
+
+// ApplyEnv merges the PAM environment into the environment of cmd, such as
+// the session of the user: the PAM variables replace those of cmd with the
+// same names and are appended in order. If cmd.Env is nil, the environment
+// of the process is merged into, as cmd would inherit it. AppContextEnv is
+// never applied, as it is only meant for the modules.
+func (t *Transaction) ApplyEnv(cmd *exec.Cmd) error {
+	env, err := t.Environ()
+	if err != nil {
+		return err
+	}
+	base := cmd.Env
+	if base == nil {
+		base = os.Environ()
+	}
+	names := make(map[string]bool, len(env))
+	pamEnv := env[:0]
+	for _, entry := range env {
+		name, _, _ := strings.Cut(entry, "=")
+		if name == AppContextEnv {
+			continue
+		}
+		names[name] = true
+		pamEnv = append(pamEnv, entry)
+	}
+	merged := make([]string, 0, len(base)+len(pamEnv))
+	for _, entry := range base {
+		if name, _, _ := strings.Cut(entry, "="); !names[name] {
+			merged = append(merged, entry)
+		}
+	}
+	cmd.Env = append(merged, pamEnv...)
+	return nil
+}
@@ -0,0 +1,148 @@
+package pam
+
+import (
+	"errors"
+	"maps"
+	"os/exec"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTransaction_Environ(t *testing.T) {
+	tx, err := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	if env, err := tx.Environ(); err != nil || env == nil || len(env) != 0 {
+		t.Fatalf("environ #error: expected an empty environment, got %v, %v", env, err)
+	}
+	for _, e := range []string{"ZED=1", "ALPHA=2", "EMPTY=", "ZED=3"} {
+		if err := tx.PutEnv(e); err != nil {
+			t.Fatalf("putenv #error: %v", err)
+		}
+	}
+	if err := tx.SetAppContext(&AppContext{RequestID: "42"}); err != nil {
+		t.Fatalf("setappcontext #error: %v", err)
+	}
+	env, err := tx.Environ()
+	if err != nil {
+		t.Fatalf("environ #error: %v", err)
+	}
+	if len(env) != 4 || !slices.Equal(env[:3], []string{"ZED=3", "ALPHA=2", "EMPTY="}) {
+		t.Fatalf("environ #error: unexpected environment %v", env)
+	}
+
+	cmd := exec.Command("true")
+	cmd.Env = []string{"PATH=/bin", "ALPHA=old", "HOME=/home/test"}
+	if err := tx.ApplyEnv(cmd); err != nil {
+		t.Fatalf("applyenv #error: %v", err)
+	}
+	expected := []string{"PATH=/bin", "HOME=/home/test", "ZED=3", "ALPHA=2", "EMPTY="}
+	if !slices.Equal(cmd.Env, expected) {
+		t.Fatalf("applyenv #error: expected %v, got %v", expected, cmd.Env)
+	}
+
+	t.Setenv("ALPHA", "process")
+	cmd = exec.Command("true")
+	if err := tx.ApplyEnv(cmd); err != nil {
+		t.Fatalf("applyenv #error: %v", err)
+	}
+	if n := len(cmd.Env); n < 3 || !slices.Equal(cmd.Env[n-3:], expected[2:]) ||
+		slices.Contains(cmd.Env, "ALPHA=process") {
+		t.Fatalf("applyenv #error: unexpected environment %v", cmd.Env)
+	}
+	tx.Close()
+	if err := tx.ApplyEnv(cmd); err == nil {
+		t.Fatalf("applyenv #error: expected a failure once closed")
+	}
+}
+
+func TestTransaction_PutEnvs(t *testing.T) {
+	tx, err := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	err = tx.PutEnvs(map[string]string{"ZED": "1", "ALPHA": "2", "BAD=NAME": "3", "": "4"})
+	if !errors.Is(err, ErrBadItem) {
+		t.Fatalf("putenvs #error: expected %v, got %v", ErrBadItem, err)
+	}
+	err = tx.CopyEnv([]string{"LANG=C", "HOME=/root", "MALFORMED", "=empty", "LC_ALL=C"}, func(name string) bool {
+		return name == "LANG" || strings.HasPrefix(name, "LC_")
+	})
+	if err != nil {
+		t.Fatalf("copyenv #error: %v", err)
+	}
+	env, err := tx.Environ()
+	if err != nil {
+		t.Fatalf("environ #error: %v", err)
+	}
+	expected := []string{"ALPHA=2", "ZED=1", "LANG=C", "LC_ALL=C"}
+	if !slices.Equal(env, expected) {
+		t.Fatalf("environ #error: expected %v, got %v", expected, env)
+	}
+	if err := tx.CopyEnv([]string{"ALPHA=3"}, nil); err != nil {
+		t.Fatalf("copyenv #error: %v", err)
+	}
+	m := maps.Collect(tx.Env())
+	if len(m) != 4 || m["ALPHA"] != "3" || m["LANG"] != "C" {
+		t.Fatalf("env #error: unexpected environment %v", m)
+	}
+	for range tx.Env() {
+		break
+	}
+
+	tx.Close()
+	if err := tx.PutEnvs(map[string]string{"A": "1"}); !errors.Is(err, ErrTransactionEnded) {
+		t.Fatalf("putenvs #error: expected %v, got %v", ErrTransactionEnded, err)
+	}
+}
+
+func TestTransaction_GetEnvOk(t *testing.T) {
+	tx, err := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	if env, err := tx.GetEnvList(); err != nil || env == nil || len(env) != 0 {
+		t.Fatalf("getenvlist #error: expected an empty environment, got %v, %v", env, err)
+	}
+	if tx.Status() != Success {
+		t.Fatalf("status #error: expected %v, got %v", Success, tx.Status())
+	}
+	for _, e := range []string{"SET=1", "EMPTY="} {
+		if err := tx.PutEnv(e); err != nil {
+			t.Fatalf("putenv #error: %v", err)
+		}
+	}
+	tests := []struct {
+		name  string
+		value string
+		ok    bool
+	}{
+		{"SET", "1", true},
+		{"EMPTY", "", true},
+		{"UNSET", "", false},
+	}
+	for _, tc := range tests {
+		if value, ok := tx.GetEnvOk(tc.name); value != tc.value || ok != tc.ok {
+			t.Fatalf("getenvok #error: expected %q, %v for %s, got %q, %v", tc.value, tc.ok, tc.name, value, ok)
+		}
+	}
+
+	tx.Close()
+	if _, ok := tx.GetEnvOk("SET"); ok {
+		t.Fatalf("getenvok #error: expected no variable once ended")
+	}
+	if _, err := tx.GetEnvList(); !errors.Is(err, ErrTransactionEnded) {
+		t.Fatalf("getenvlist #error: expected %v, got %v", ErrTransactionEnded, err)
+	}
+}
@@ -0,0 +1,118 @@
+package pam
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"runtime"
+	"testing"
+)
+
+var returnTypes = []ReturnType{
+	ErrOpen, ErrSymbol, ErrService, ErrSystem, ErrBuf, ErrPermDenied,
+	ErrAuth, ErrCredInsufficient, ErrAuthinfoUnavail, ErrUserUnknown,
+	ErrMaxtries, ErrNewAuthtokReqd, ErrAcctExpired, ErrSession,
+	ErrCredUnavail, ErrCredExpired, ErrCred, ErrNoModuleData, ErrConv,
+	ErrAuthtok, ErrAuthtokRecovery, ErrAuthtokLockBusy,
+	ErrAuthtokDisableAging, ErrTryAgain, ErrIgnore, ErrAbort,
+	ErrAuthtokExpired, ErrModuleUnknown, ErrBadItem, ErrConvAgain,
+	ErrIncomplete,
+}
+
+func TestErrorsIs(t *testing.T) {
+	for _, r := range returnTypes {
+		errs := map[string]error{
+			"returntype": r,
+			"wrapped":    fmt.Errorf("operation: %w", r),
+			"joined":     errors.Join(errors.New("other"), r),
+		}
+		for name, err := range errs {
+			if !errors.Is(err, r) {
+				t.Fatalf("is #error: %s %v does not match %v", name, err, r)
+			}
+			other := ErrAuth
+			if r == ErrAuth {
+				other = ErrPermDenied
+			}
+			if errors.Is(err, other) {
+				t.Fatalf("is #error: %s %v matches %v", name, err, other)
+			}
+			var as ReturnType
+			if !errors.As(err, &as) || as != r {
+				t.Fatalf("as #error: %s %v is not %v", name, err, r)
+			}
+			if err.Error() == "" {
+				t.Fatalf("error #error: %s %v has no message", name, int(r))
+			}
+		}
+	}
+}
+
+func TestErrorsIs_Transaction(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	tx, err := StartConfDir("deny-service", u.Username, Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	tx.Authenticate(0)
+	var txErr error = tx
+	if !errors.Is(txErr, ErrAuth) || !errors.Is(fmt.Errorf("%w", txErr), ErrAuth) {
+		t.Fatalf("is #error: %v does not match %v", txErr, ErrAuth)
+	}
+	if errors.Is(txErr, ErrPermDenied) || errors.Is(txErr, errors.New(ErrAuth.Error())) {
+		t.Fatalf("is #error: %v matches another error", txErr)
+	}
+	var as ReturnType
+	if !errors.As(fmt.Errorf("%w", txErr), &as) || as != ErrAuth {
+		t.Fatalf("as #error: %v is not %v", txErr, ErrAuth)
+	}
+	if s := StatusOf(txErr); s != ErrAuth {
+		t.Fatalf("statusof #error: expected %v, got %v", ErrAuth, s)
+	}
+}
+
+func TestStatusOf(t *testing.T) {
+	tests := map[string]struct {
+		err      error
+		expected ReturnType
+	}{
+		"nil":        {nil, Success},
+		"returntype": {ErrAuth, ErrAuth},
+		"wrapped":    {fmt.Errorf("operation: %w", ErrBadItem), ErrBadItem},
+		"conv":       {&ConvError{Index: -1, Cause: ErrConvAgain, Status: ErrConv}, ErrConv},
+		"conv cause": {&ConvError{Index: -1, Cause: ErrConvAgain}, ErrConvAgain},
+		"password":   {fmt.Errorf("policy: %w", &PasswordQualityError{Reason: PasswordPalindrome}), ErrAuthtok},
+		"other":      {ErrTransactionEnded, ErrSystem},
+	}
+	for name, tc := range tests {
+		if s := StatusOf(tc.err); s != tc.expected {
+			t.Fatalf("statusof #error: %s: expected %v, got %v", name, tc.expected, s)
+		}
+	}
+}
+
+func TestReturnTypeErr(t *testing.T) {
+	if err := Success.Err(); err != nil {
+		t.Fatalf("err #error: expected nil, got %v", err)
+	}
+	for _, r := range returnTypes {
+		if err := r.Err(); !errors.Is(err, r) || StatusOf(err) != r {
+			t.Fatalf("err #error: %v does not match %v", err, r)
+		}
+	}
+}
+
+func TestCheckPamCapabilities(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Linux-PAM capabilities")
+	}
+	if !CheckPamHasFailDelay() {
+		t.Fatalf("check #error: pam_fail_delay not found")
+	}
+	if !CheckPamHasBinaryProtocol() {
+		t.Fatalf("check #error: binary prompts not supported")
+	}
+}
@@ -0,0 +1,53 @@
+//go:build cgo
+
+package pam
+
+//#include <security/pam_appl.h>
+//#include <stdint.h>
+//void cb_pam_fail_delay(int retval, unsigned usec_delay, void *appdata_ptr);
+import "C"
+
+import (
+	"time"
+	"unsafe"
+)
+
+// SetFailDelayHandler sets the FailDelay item of the transaction, so that
+// the handler is called instead of libpam sleeping once an operation
+// failed, with its status and the delay requested by the modules, such as
+// pam_faildelay. Event loop applications can then delay the next attempt
+// without blocking their thread. The handler is called while the operation
+// is running, and must not use the transaction. If handler is nil, libpam
+// sleeps again.
+//
+// FailDelay is a Linux-PAM extension: the other implementations fail with
+// ErrBadItem.
+func (t *Transaction) SetFailDelayHandler(handler func(status ReturnType, delay time.Duration)) error {
+	if err, ok := diverted(t.thread, func() error { return t.SetFailDelayHandler(handler) }); ok {
+		return err
+	}
+	if err := t.state.enter(); err != nil {
+		return err
+	}
+	defer t.state.leave()
+	var fn unsafe.Pointer
+	if handler != nil {
+		fn = unsafe.Pointer(C.cb_pam_fail_delay)
+	}
+	done := t.callHooks(EventItem, "set_item", FailDelay)
+	status := done(C.pam_set_item(t.handle, C.int(FailDelay), fn))
+	if status == C.PAM_SUCCESS {
+		t.conversation.failDelay = handler
+	}
+	return t.result(status)
+}
+
+// cbPAMFailDelay calls the fail delay handler of the transaction.
+//
+//export cbPAMFailDelay
+func cbPAMFailDelay(status C.int, delay C.uint, c C.uintptr_t) {
+	conv := handle(c).value().(*conversation)
+	if conv.failDelay != nil {
+		conv.failDelay(ReturnType(status), time.Duration(delay)*time.Microsecond)
+	}
+}
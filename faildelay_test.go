@@ -0,0 +1,46 @@
+package pam
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTransaction_SetFailDelayHandler(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	tx, err := StartConfDir("faildelay-service", "test", Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	var status ReturnType
+	var delay time.Duration
+	err = tx.SetFailDelayHandler(func(s ReturnType, d time.Duration) {
+		status, delay = s, d
+	})
+	if errors.Is(err, ErrBadItem) {
+		t.Skip("the FailDelay item is not supported")
+	} else if err != nil {
+		t.Fatalf("setfaildelayhandler #error: %v", err)
+	}
+	start := time.Now()
+	if err := tx.Authenticate(0); !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrAuth, err)
+	}
+	if elapsed := time.Since(start); elapsed >= time.Second {
+		t.Fatalf("authenticate #error: expected no delay, took %v", elapsed)
+	}
+	// Linux-PAM randomizes the delays by up to 25%.
+	if status != ErrAuth || delay < 3*time.Second || delay > 7*time.Second {
+		t.Fatalf("faildelay #error: unexpected status %v, delay %v", status, delay)
+	}
+
+	if err := tx.SetFailDelayHandler(nil); err != nil {
+		t.Fatalf("setfaildelayhandler #error: %v", err)
+	}
+	if _, err := tx.GetItem(FailDelay); !errors.Is(err, ErrBadItem) {
+		t.Fatalf("getitem #error: expected %v, got %v", ErrBadItem, err)
+	}
+}
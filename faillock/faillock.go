@@ -0,0 +1,293 @@
+// Package faillock implements a lockout of the users after repeated
+// authentication failures, as pam_faillock does, for the authentication
+// modules written in Go.
+//
+// The failures of each user are stored in a file of a tally directory,
+// locked while read and updated, so that the processes authenticating the
+// same user at the same time count all the failures. Modules call PreAuth
+// before checking the credentials, then AuthFail or AuthSucc depending on
+// the result:
+//
+//	if msg, err := tally.PreAuth(user); err != nil {
+//		// Send msg as an ErrorMsg message, unless Silent.
+//		return err
+//	}
+package faillock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"path/filepath"
+	"slices"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// DefaultDir is the default directory of the tally files. It is not the
+// one of pam_faillock, whose files have another format.
+const DefaultDir = "/run/go-faillock"
+
+// Failure is an authentication failure.
+type Failure struct {
+	// Time is when the authentication failed.
+	Time time.Time `json:"time"`
+	// Source is where the authentication came from, such as the remote
+	// host or the terminal, if known.
+	Source string `json:"source,omitempty"`
+}
+
+// Status is the lockout status of a user.
+type Status struct {
+	// Failures are the failures within the interval, oldest first.
+	Failures []Failure
+	// Locked is whether the user is locked.
+	Locked bool
+	// Unlock is when the user is unlocked, zero if not locked or if
+	// never unlocked automatically.
+	Unlock time.Time
+}
+
+// Tally counts the authentication failures of the users. Its zero value
+// uses DefaultDir and the defaults of pam_faillock.
+type Tally struct {
+	// Dir is the directory of the tally files, DefaultDir if empty. It is
+	// created if needed.
+	Dir string
+	// Deny is the number of failures locking a user, 3 if not set.
+	Deny int
+	// FailInterval is the time window where failures are counted, 15
+	// minutes if not set.
+	FailInterval time.Duration
+	// UnlockTime is the time after the last failure when a locked user is
+	// unlocked, 10 minutes if not set. Negative values never unlock.
+	UnlockTime time.Duration
+	// EvenDenyRoot locks the root user too, unlocking it after
+	// RootUnlockTime if set, otherwise UnlockTime.
+	EvenDenyRoot   bool
+	RootUnlockTime time.Duration
+	// Now returns the current time, time.Now if not set.
+	Now func() time.Time
+}
+
+func (t *Tally) now() time.Time {
+	if t.Now != nil {
+		return t.Now()
+	}
+	return time.Now()
+}
+
+func (t *Tally) dir() string {
+	if t.Dir == "" {
+		return DefaultDir
+	}
+	return t.Dir
+}
+
+func (t *Tally) deny() int {
+	if t.Deny <= 0 {
+		return 3
+	}
+	return t.Deny
+}
+
+func (t *Tally) interval() time.Duration {
+	if t.FailInterval <= 0 {
+		return 15 * time.Minute
+	}
+	return t.FailInterval
+}
+
+func (t *Tally) unlockTime(root bool) time.Duration {
+	if root && t.RootUnlockTime != 0 {
+		return t.RootUnlockTime
+	}
+	if t.UnlockTime == 0 {
+		return 10 * time.Minute
+	}
+	return t.UnlockTime
+}
+
+// isRoot returns whether the user is the superuser.
+func isRoot(name string) bool {
+	if u, err := user.Lookup(name); err == nil {
+		return u.Uid == "0"
+	}
+	return name == "root"
+}
+
+// path returns the tally file of the user, failing with pam.ErrUserUnknown
+// for the names that are not valid file names.
+func (t *Tally) path(name string) (string, error) {
+	if name == "" || name == "." || name == ".." || strings.ContainsAny(name, "/\x00") {
+		return "", fmt.Errorf("%w: invalid user name %q", pam.ErrUserUnknown, name)
+	}
+	return filepath.Join(t.dir(), name), nil
+}
+
+// update calls f with the recent failures of the user, with its tally file
+// locked, and stores the failures it returns unless they are the same.
+func (t *Tally) update(name string, f func([]Failure) []Failure) ([]Failure, error) {
+	path, err := t.path(name)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(t.dir(), 0700); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return nil, err
+	}
+	// The lock is released when the file is closed.
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+	var stored []Failure
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &stored); err != nil {
+			return nil, fmt.Errorf("tally of %q: %w", name, err)
+		}
+	}
+	now := t.now()
+	var recent []Failure
+	for _, fl := range stored {
+		if now.Sub(fl.Time) < t.interval() {
+			recent = append(recent, fl)
+		}
+	}
+	failures := f(recent)
+	if slices.Equal(failures, stored) {
+		return failures, nil
+	}
+	if data, err = json.Marshal(failures); err != nil {
+		return nil, err
+	}
+	if err := file.Truncate(0); err != nil {
+		return nil, err
+	}
+	if _, err := file.WriteAt(data, 0); err != nil {
+		return nil, err
+	}
+	return failures, nil
+}
+
+// status returns the status of the user with the failures.
+func (t *Tally) status(name string, failures []Failure) Status {
+	st := Status{Failures: failures}
+	root := isRoot(name)
+	if len(failures) < t.deny() || (root && !t.EvenDenyRoot) {
+		return st
+	}
+	unlock := t.unlockTime(root)
+	if unlock < 0 {
+		st.Locked = true
+		return st
+	}
+	last := failures[len(failures)-1].Time
+	if t.now().Sub(last) < unlock {
+		st.Locked, st.Unlock = true, last.Add(unlock)
+	}
+	return st
+}
+
+// Check returns the status of the user.
+func (t *Tally) Check(name string) (Status, error) {
+	failures, err := t.update(name, func(f []Failure) []Failure { return f })
+	if err != nil {
+		return Status{}, err
+	}
+	return t.status(name, failures), nil
+}
+
+// Fail records a failure of the user, from source if not empty, and returns
+// the status of the user.
+func (t *Tally) Fail(name, source string) (Status, error) {
+	failures, err := t.update(name, func(f []Failure) []Failure {
+		return append(f, Failure{Time: t.now(), Source: source})
+	})
+	if err != nil {
+		return Status{}, err
+	}
+	return t.status(name, failures), nil
+}
+
+// Reset clears the failures of the user, unlocking them.
+func (t *Tally) Reset(name string) error {
+	_, err := t.update(name, func([]Failure) []Failure { return nil })
+	return err
+}
+
+// PreAuth checks the user before the authentication: if locked, it returns
+// pam.ErrAuth and the message to send to the user.
+func (t *Tally) PreAuth(name string) (msg string, err error) {
+	st, err := t.Check(name)
+	if err != nil {
+		return "", err
+	}
+	if !st.Locked {
+		return "", nil
+	}
+	return Message(st, t.now()), pam.ErrAuth
+}
+
+// AuthFail records a failed authentication of the user, from source if not
+// empty. It returns pam.ErrAuth, with the message to send to the user if
+// the failure locked them.
+func (t *Tally) AuthFail(name, source string) (msg string, err error) {
+	st, err := t.Fail(name, source)
+	if err != nil {
+		return "", err
+	}
+	if st.Locked {
+		msg = Message(st, t.now())
+	}
+	return msg, pam.ErrAuth
+}
+
+// AuthSucc records a successful authentication of the user, clearing their
+// failures unless they are locked, in which case it returns pam.ErrAuth and
+// the message to send to the user: the failures of other processes may
+// have locked them during the authentication.
+func (t *Tally) AuthSucc(name string) (msg string, err error) {
+	var locked Status
+	_, err = t.update(name, func(f []Failure) []Failure {
+		if locked = t.status(name, f); locked.Locked {
+			return f
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if locked.Locked {
+		return Message(locked, t.now()), pam.ErrAuth
+	}
+	return "", nil
+}
+
+// Message returns the message telling the user that they are locked, as
+// sent by pam_faillock, or an empty string if they are not.
+func Message(st Status, now time.Time) string {
+	if !st.Locked {
+		return ""
+	}
+	msg := fmt.Sprintf("The account is locked due to %d failed logins.", len(st.Failures))
+	if !st.Unlock.IsZero() {
+		left := st.Unlock.Sub(now)
+		minutes := int((left + time.Minute - 1) / time.Minute)
+		msg += fmt.Sprintf("\n(%d minutes left to unlock)", minutes)
+	}
+	return msg
+}
@@ -0,0 +1,120 @@
+package faillock
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+func TestTally(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tally := &Tally{
+		Dir:        t.TempDir(),
+		Deny:       2,
+		UnlockTime: 10 * time.Minute,
+		Now:        func() time.Time { return now },
+	}
+	if msg, err := tally.PreAuth("test"); err != nil || msg != "" {
+		t.Fatalf("preauth #error: %q, %v", msg, err)
+	}
+	if msg, err := tally.AuthFail("test", "tty1"); !errors.Is(err, pam.ErrAuth) || msg != "" {
+		t.Fatalf("authfail #error: %q, %v", msg, err)
+	}
+	msg, err := tally.AuthFail("test", "tty1")
+	if !errors.Is(err, pam.ErrAuth) || !strings.Contains(msg, "locked due to 2 failed logins") {
+		t.Fatalf("authfail #error: %q, %v", msg, err)
+	}
+
+	now = now.Add(time.Minute)
+	reloaded := *tally
+	st, err := reloaded.Check("test")
+	if err != nil || !st.Locked || len(st.Failures) != 2 || st.Failures[0].Source != "tty1" {
+		t.Fatalf("check #error: %+v, %v", st, err)
+	}
+	msg, err = reloaded.PreAuth("test")
+	if !errors.Is(err, pam.ErrAuth) || !strings.Contains(msg, "(9 minutes left to unlock)") {
+		t.Fatalf("preauth #error: %q, %v", msg, err)
+	}
+	if _, err := reloaded.AuthSucc("test"); !errors.Is(err, pam.ErrAuth) {
+		t.Fatalf("authsucc #error: expected the user locked, got %v", err)
+	}
+
+	now = now.Add(10 * time.Minute)
+	if msg, err := tally.PreAuth("test"); err != nil || msg != "" {
+		t.Fatalf("preauth #error: expected unlocked, got %q, %v", msg, err)
+	}
+	if _, err := tally.AuthSucc("test"); err != nil {
+		t.Fatalf("authsucc #error: %v", err)
+	}
+	if st, err := tally.Check("test"); err != nil || len(st.Failures) != 0 {
+		t.Fatalf("check #error: expected no failures, got %+v, %v", st, err)
+	}
+}
+
+func TestTally_Interval(t *testing.T) {
+	now := time.Unix(1000, 0)
+	tally := &Tally{Dir: t.TempDir(), Deny: 2, FailInterval: time.Minute,
+		UnlockTime: -1, Now: func() time.Time { return now }}
+	tally.Fail("test", "")
+	now = now.Add(time.Minute)
+	if st, err := tally.Fail("test", ""); err != nil || st.Locked || len(st.Failures) != 1 {
+		t.Fatalf("fail #error: expected the first failure expired, got %+v, %v", st, err)
+	}
+	st, err := tally.Fail("test", "")
+	if err != nil || !st.Locked || !st.Unlock.IsZero() {
+		t.Fatalf("fail #error: expected locked forever, got %+v, %v", st, err)
+	}
+	if msg := Message(st, now); strings.Contains(msg, "left to unlock") {
+		t.Fatalf("message #error: unexpected unlock time in %q", msg)
+	}
+	if err := tally.Reset("test"); err != nil {
+		t.Fatalf("reset #error: %v", err)
+	}
+	if st, err := tally.Check("test"); err != nil || st.Locked {
+		t.Fatalf("check #error: expected unlocked, got %+v, %v", st, err)
+	}
+}
+
+func TestTally_Root(t *testing.T) {
+	tally := &Tally{Dir: t.TempDir(), Deny: 1}
+	if st, err := tally.Fail("root", ""); err != nil || st.Locked {
+		t.Fatalf("fail #error: expected root not locked, got %+v, %v", st, err)
+	}
+	tally.EvenDenyRoot = true
+	if st, err := tally.Check("root"); err != nil || !st.Locked {
+		t.Fatalf("check #error: expected root locked, got %+v, %v", st, err)
+	}
+}
+
+func TestTally_InvalidUser(t *testing.T) {
+	tally := &Tally{Dir: t.TempDir()}
+	for _, name := range []string{"", "..", "../test", "a/b"} {
+		if _, err := tally.Fail(name, ""); !errors.Is(err, pam.ErrUserUnknown) {
+			t.Fatalf("fail #error: expected ErrUserUnknown for %q, got %v", name, err)
+		}
+	}
+}
+
+func TestTally_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// Separate tallies, as separate processes would use.
+			tally := &Tally{Dir: dir, Deny: 100}
+			if _, err := tally.Fail("test", ""); err != nil {
+				t.Errorf("fail #error: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if st, err := (&Tally{Dir: dir}).Check("test"); err != nil || len(st.Failures) != 20 {
+		t.Fatalf("check #error: expected 20 failures, got %d, %v", len(st.Failures), err)
+	}
+}
@@ -0,0 +1,127 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// RunStep is a step of Transaction.Run.
+type RunStep int
+
+// Steps of Transaction.Run, in the order they are run.
+const (
+	// StepAuthenticate authenticates the user.
+	StepAuthenticate RunStep = iota + 1
+	// StepAcctMgmt validates the account of the user.
+	StepAcctMgmt
+	// StepChangeAuthTok changes the expired authentication token of the
+	// user, only run when the account validation requires it.
+	StepChangeAuthTok
+	// StepSetCred establishes the credentials of the user.
+	StepSetCred
+	// StepOpenSession opens a session for the user.
+	StepOpenSession
+)
+
+// String returns the name of the PAM call of the step.
+func (s RunStep) String() string {
+	switch s {
+	case StepAuthenticate:
+		return "authenticate"
+	case StepAcctMgmt:
+		return "acct_mgmt"
+	case StepChangeAuthTok:
+		return "chauthtok"
+	case StepSetCred:
+		return "setcred"
+	case StepOpenSession:
+		return "open_session"
+	}
+	return fmt.Sprintf("RunStep(%d)", int(s))
+}
+
+// RunOptions are the settings of Transaction.Run.
+type RunOptions struct {
+	// Flags are the flags of the operations, such as Silent. Only
+	// Silent is kept for the credentials and the authentication token
+	// change, which need their own.
+	Flags Flags
+	// KeepExpiredAuthtok fails with the error of the account validation
+	// when it requires the authentication token to be changed, instead
+	// of changing it.
+	KeepExpiredAuthtok bool
+	// NoSession stops once the account is validated, without
+	// establishing the credentials nor opening a session.
+	NoSession bool
+	// After, if not nil, is called once each step succeeded, for example
+	// to log it or to check the items set by the modules. If it fails,
+	// Run fails with its error.
+	After func(ctx context.Context, tx *Transaction, step RunStep) error
+}
+
+// RunError is the failure of a step of Transaction.Run.
+type RunError struct {
+	// Step is the step that failed, or whose After hook failed.
+	Step RunStep
+	// Err is the error of the step or of its hook.
+	Err error
+}
+
+func (e *RunError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Step, e.Err)
+}
+
+func (e *RunError) Unwrap() error {
+	return e.Err
+}
+
+// Run runs the canonical sequence of the PAM applications in the
+// transaction: it authenticates the user, validates their account, changing
+// the authentication token if the account validation requires it, then
+// establishes their credentials and opens a session. Steps failing return a
+// *RunError.
+//
+// Once Run fails, the credentials it established are deleted and the
+// session it opened is closed, but the transaction is left open. Once it
+// succeeds, the returned Login owns the transaction: closing it closes the
+// session, deletes the credentials and closes the transaction.
+//
+// PAM calls can't be interrupted: once ctx is done, the conversations fail,
+// and so do the operations asking for them.
+func (t *Transaction) Run(ctx context.Context, opts RunOptions) (*Login, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	defer t.setContext(ctx)()
+	l := &Login{tx: t, flags: opts.Flags & Silent}
+	if err := opts.run(ctx, l); err != nil {
+		return nil, errors.Join(err, l.release())
+	}
+	return l, nil
+}
+
+// run runs the steps of the options in the transaction of the login, as an
+// Authenticator and Login.OpenSession do.
+func (o RunOptions) run(ctx context.Context, l *Login) error {
+	tx := l.tx
+	step := func(s RunStep, err error) error {
+		// Optional modules may have recovered from failed
+		// conversations.
+		if err == nil {
+			err = ctx.Err()
+		}
+		if err == nil && o.After != nil {
+			err = o.After(ctx, tx, s)
+		}
+		if err != nil {
+			return &RunError{Step: s, Err: err}
+		}
+		return nil
+	}
+	err := authenticate(tx, o.Flags, !o.KeepExpiredAuthtok, step)
+	if err != nil || o.NoSession {
+		return err
+	}
+	return l.openSession(step)
+}
@@ -0,0 +1,139 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/user"
+	"slices"
+	"testing"
+)
+
+func testRunTransaction(t *testing.T, service string) *Transaction {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	tx, err := StartConfDir(service, u.Username, Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	return tx
+}
+
+func TestTransaction_Run(t *testing.T) {
+	tx := testRunTransaction(t, "login-service")
+	var steps []RunStep
+	login, err := tx.Run(context.Background(), RunOptions{
+		After: func(ctx context.Context, tx *Transaction, step RunStep) error {
+			steps = append(steps, step)
+			return nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("run #error: %v", err)
+	}
+	expected := []RunStep{StepAuthenticate, StepAcctMgmt, StepSetCred, StepOpenSession}
+	if !slices.Equal(steps, expected) {
+		t.Fatalf("run #error: expected steps %v, got %v", expected, steps)
+	}
+	if login.Transaction() != tx {
+		t.Fatalf("run #error: unexpected transaction")
+	}
+	if err := login.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+}
+
+func TestTransaction_Run_Operations(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	var ops []string
+	tx, err := StartWithOptions("login-service", WithUser(u.Username),
+		WithConfDir("test-services"),
+		WithObserver(ObserverFunc(func(e Event) {
+			if e.Kind == EventOperation {
+				ops = append(ops, fmt.Sprintf("%s %v", e.Operation, e.Flags))
+			}
+		})))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	login, err := tx.Run(context.Background(), RunOptions{Flags: Silent})
+	if err != nil {
+		t.Fatalf("run #error: %v", err)
+	}
+	if err := login.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+	expected := []string{
+		"authenticate Silent", "acct_mgmt Silent",
+		"setcred Silent|EstablishCred", "open_session Silent",
+		"setcred Silent|ReinitializeCred",
+		"close_session Silent", "setcred Silent|DeleteCred",
+	}
+	if !slices.Equal(ops, expected) {
+		t.Fatalf("run #error: expected %v, got %v", expected, ops)
+	}
+}
+
+func TestTransaction_Run_Failure(t *testing.T) {
+	tx := testRunTransaction(t, "deny-service")
+	defer tx.Close()
+	_, err := tx.Run(context.Background(), RunOptions{})
+	var runErr *RunError
+	if !errors.As(err, &runErr) || runErr.Step != StepAuthenticate || !errors.Is(err, ErrAuth) {
+		t.Fatalf("run #error: expected %v failure, got %v", StepAuthenticate, err)
+	}
+
+	// The stack has no account modules.
+	tx = testRunTransaction(t, "permit-service")
+	defer tx.Close()
+	_, err = tx.Run(context.Background(), RunOptions{})
+	if !errors.As(err, &runErr) || runErr.Step != StepAcctMgmt {
+		t.Fatalf("run #error: expected %v failure, got %v", StepAcctMgmt, err)
+	}
+
+	hookErr := errors.New("hook failure")
+	tx = testRunTransaction(t, "login-service")
+	defer tx.Close()
+	_, err = tx.Run(context.Background(), RunOptions{
+		After: func(ctx context.Context, tx *Transaction, step RunStep) error {
+			if step == StepOpenSession {
+				return hookErr
+			}
+			return nil
+		},
+	})
+	if !errors.As(err, &runErr) || runErr.Step != StepOpenSession || !errors.Is(err, hookErr) {
+		t.Fatalf("run #error: expected %v failure, got %v", hookErr, err)
+	}
+}
+
+func TestTransaction_Run_Context(t *testing.T) {
+	tx := testRunTransaction(t, "login-service")
+	defer tx.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := tx.Run(ctx, RunOptions{}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("run #error: expected %v, got %v", context.Canceled, err)
+	}
+	login, err := tx.Run(context.Background(), RunOptions{NoSession: true})
+	if err != nil {
+		t.Fatalf("run #error: %v", err)
+	}
+	if login.session != nil {
+		t.Fatalf("run #error: unexpected credentials or session")
+	}
+}
+
+func TestRunStep_String(t *testing.T) {
+	if s := StepChangeAuthTok.String(); s != "chauthtok" {
+		t.Fatalf("string #error: expected chauthtok, got %v", s)
+	}
+	if s := RunStep(0).String(); s != "RunStep(0)" {
+		t.Fatalf("string #error: expected RunStep(0), got %v", s)
+	}
+}
@@ -0,0 +1,254 @@
+// Package gdm implements the custom JSON PAM extension of GDM, which lets
+// the modules and the greeters exchange the JSON messages of their own
+// protocols, such as the authentication brokers of authd, through binary
+// prompts.
+//
+// GDM advertises the extensions it supports in the
+// GDM_SUPPORTED_PAM_EXTENSIONS environment variable of its worker process.
+// The messages start with a header made of their size, as a 4 bytes big
+// endian integer, and of their type, the index of their extension in the
+// advertised list. Those of the JSON extension then hold the name and the
+// version of the protocol and the JSON data, as C strings the messages
+// point to rather than contain, as the C structure of GDM does.
+//
+// The modules send their requests with SendJSON, and the applications
+// answer them with a JSONHandler, after calling AdvertiseExtensions.
+package gdm
+
+//#include <stdint.h>
+//#include <stdlib.h>
+//
+//typedef struct {
+//	uint32_t length;
+//	unsigned char type;
+//} GdmPamExtensionMessage;
+//
+//typedef struct {
+//	GdmPamExtensionMessage header;
+//	const char *protocol_name;
+//	unsigned int version;
+//	const char *json;
+//} GdmPamExtensionJSONProtocol;
+import "C"
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"unsafe"
+
+	"github.com/msteinert/pam"
+)
+
+// SupportedExtensionsEnv is the environment variable advertising the
+// extensions supported by the application, separated by spaces.
+const SupportedExtensionsEnv = "GDM_SUPPORTED_PAM_EXTENSIONS"
+
+// JSONExtension is the name of the custom JSON extension.
+const JSONExtension = "org.gnome.DisplayManager.UserVerifier.CustomJSON"
+
+// ErrUnsupported is returned by SendJSON when the application doesn't
+// advertise the JSON extension. It wraps pam.ErrConv, as the conversations
+// with the handlers not supporting the binary prompts do, so that the
+// modules can fall back to text prompts alike.
+var ErrUnsupported = fmt.Errorf("%w: GDM JSON extension not supported", pam.ErrConv)
+
+// ErrNotJSON is returned when decoding a binary message which is not a
+// message of the JSON extension.
+var ErrNotJSON = errors.New("not a GDM JSON extension message")
+
+// AdvertiseExtensions advertises the extensions supported by the
+// application to the modules, in the environment of the process, as GDM
+// does before starting its transactions.
+func AdvertiseExtensions(extensions ...string) error {
+	for _, e := range extensions {
+		if e == "" || strings.ContainsAny(e, " \t\n") {
+			return fmt.Errorf("invalid extension name %q", e)
+		}
+	}
+	return os.Setenv(SupportedExtensionsEnv, strings.Join(extensions, " "))
+}
+
+// extensionType returns the type of the messages of the extension, its
+// index in the advertised extensions.
+func extensionType(extension string) (byte, bool) {
+	i := slices.Index(strings.Fields(os.Getenv(SupportedExtensionsEnv)), extension)
+	if i < 0 || i > 0xff {
+		return 0, false
+	}
+	return byte(i), true
+}
+
+// IsSupported returns whether the application advertises the extension.
+func IsSupported(extension string) bool {
+	_, ok := extensionType(extension)
+	return ok
+}
+
+// JSONMessage is a message of the JSON extension, whose data follows a
+// protocol agreed by the module and the application.
+type JSONMessage struct {
+	// Protocol is the name of the protocol.
+	Protocol string
+	// Version is the version of the protocol.
+	Version uint
+	// JSON is the data of the message.
+	JSON json.RawMessage
+}
+
+// messageSize is the size of the messages of the JSON extension.
+const messageSize = C.sizeof_GdmPamExtensionJSONProtocol
+
+// setHeader sets the header of a message of the JSON extension.
+func setHeader(m *C.GdmPamExtensionJSONProtocol, typ byte) {
+	binary.BigEndian.PutUint32(unsafe.Slice((*byte)(unsafe.Pointer(&m.header.length)), 4), messageSize)
+	m.header._type = C.uchar(typ)
+}
+
+// SendJSON sends the request to the application through conv, as the
+// modules do, and returns the JSON data of its response. It fails with
+// ErrUnsupported if the application doesn't advertise the JSON extension.
+func SendJSON(conv pam.ModuleConversation, req JSONMessage) (json.RawMessage, error) {
+	typ, ok := extensionType(JSONExtension)
+	if !ok {
+		return nil, ErrUnsupported
+	}
+	if !json.Valid(req.JSON) {
+		return nil, fmt.Errorf("invalid JSON request of protocol %q", req.Protocol)
+	}
+	if strings.ContainsRune(req.Protocol, 0) || bytes.IndexByte(req.JSON, 0) >= 0 {
+		return nil, fmt.Errorf("request of protocol %q with NUL characters", req.Protocol)
+	}
+	m := (*C.GdmPamExtensionJSONProtocol)(C.calloc(1, messageSize))
+	defer C.free(unsafe.Pointer(m))
+	setHeader(m, typ)
+	m.protocol_name = C.CString(req.Protocol)
+	defer C.free(unsafe.Pointer(m.protocol_name))
+	m.version = C.uint(req.Version)
+	m.json = (*C.char)(C.CBytes(append(slices.Clip(req.JSON), 0)))
+	defer C.free(unsafe.Pointer(m.json))
+
+	resp, err := conv.BinaryConversation(pam.BinaryPointer(m))
+	if err != nil {
+		return nil, err
+	}
+	if len(resp) < messageSize {
+		return nil, fmt.Errorf("%w: truncated response", ErrNotJSON)
+	}
+	// The response is a copy of the message of the application, whose
+	// JSON data is owned by the module.
+	var r C.GdmPamExtensionJSONProtocol
+	copy(unsafe.Slice((*byte)(unsafe.Pointer(&r)), messageSize), resp)
+	if r.json == nil {
+		return nil, fmt.Errorf("response of protocol %q without data", req.Protocol)
+	}
+	data := json.RawMessage(C.GoString(r.json))
+	C.free(unsafe.Pointer(r.json))
+	if !json.Valid(data) {
+		return nil, fmt.Errorf("invalid JSON response of protocol %q", req.Protocol)
+	}
+	return data, nil
+}
+
+// SendJSONValue sends the JSON encoding of req as a request of the protocol
+// through conv, see SendJSON, and decodes the response into resp.
+func SendJSONValue(conv pam.ModuleConversation, protocol string, version uint, req, resp any) error {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return err
+	}
+	r, err := SendJSON(conv, JSONMessage{protocol, version, data})
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(r, resp)
+}
+
+// decodeHeader returns the message of the JSON extension ptr points to,
+// failing with ErrNotJSON if it's of another extension.
+func decodeHeader(ptr pam.BinaryPointer) (*C.GdmPamExtensionJSONProtocol, error) {
+	if ptr == nil {
+		return nil, ErrNotJSON
+	}
+	m := (*C.GdmPamExtensionJSONProtocol)(unsafe.Pointer(ptr))
+	typ, ok := extensionType(JSONExtension)
+	if !ok || byte(m.header._type) != typ {
+		return nil, ErrNotJSON
+	}
+	size := binary.BigEndian.Uint32(unsafe.Slice((*byte)(unsafe.Pointer(&m.header.length)), 4))
+	if size < messageSize {
+		return nil, fmt.Errorf("%w: truncated message", ErrNotJSON)
+	}
+	return m, nil
+}
+
+// DecodeJSONRequest returns the request of the JSON extension ptr points
+// to, as received by the applications. It returns ErrNotJSON if the message
+// is of another extension, or if the application doesn't advertise the
+// JSON extension.
+func DecodeJSONRequest(ptr pam.BinaryPointer) (*JSONMessage, error) {
+	m, err := decodeHeader(ptr)
+	if err != nil {
+		return nil, err
+	}
+	if m.protocol_name == nil || m.json == nil {
+		return nil, fmt.Errorf("%w: request without protocol or data", ErrNotJSON)
+	}
+	req := &JSONMessage{
+		Protocol: C.GoString(m.protocol_name),
+		Version:  uint(m.version),
+		JSON:     json.RawMessage(C.GoString(m.json)),
+	}
+	if !json.Valid(req.JSON) {
+		return nil, fmt.Errorf("invalid JSON request of protocol %q", req.Protocol)
+	}
+	return req, nil
+}
+
+// EncodeJSONResponse returns the binary response of an application to the
+// request of the JSON extension ptr points to. The JSON data is copied to C
+// memory the module frees.
+func EncodeJSONResponse(ptr pam.BinaryPointer, data json.RawMessage) ([]byte, error) {
+	m, err := decodeHeader(ptr)
+	if err != nil {
+		return nil, err
+	}
+	if !json.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return nil, errors.New("invalid JSON response")
+	}
+	// The response points to the protocol name of the request, which
+	// the module keeps until it has read the response.
+	var r C.GdmPamExtensionJSONProtocol
+	r.header = m.header
+	r.protocol_name = m.protocol_name
+	r.version = m.version
+	r.json = (*C.char)(C.CBytes(append(slices.Clip(data), 0)))
+	return bytes.Clone(unsafe.Slice((*byte)(unsafe.Pointer(&r)), messageSize)), nil
+}
+
+// JSONHandler adds the support of the JSON extension to a conversation
+// handler, for the applications advertising it.
+type JSONHandler struct {
+	pam.ConversationHandler
+	// Respond returns the JSON data of the response to the request.
+	Respond func(req JSONMessage) (json.RawMessage, error)
+}
+
+// RespondPAMBinary responds to the binary prompts of the JSON extension,
+// failing with the others.
+func (h JSONHandler) RespondPAMBinary(ptr pam.BinaryPointer) ([]byte, error) {
+	req, err := DecodeJSONRequest(ptr)
+	if err != nil {
+		return nil, err
+	}
+	data, err := h.Respond(*req)
+	if err != nil {
+		return nil, err
+	}
+	return EncodeJSONResponse(ptr, data)
+}
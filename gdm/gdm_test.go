@@ -0,0 +1,92 @@
+//go:build cgo
+
+package gdm
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/pamtest"
+)
+
+type authRequest struct {
+	Type string `json:"type"`
+}
+
+type authResponse struct {
+	Methods []string `json:"methods"`
+}
+
+func TestJSON(t *testing.T) {
+	t.Setenv(SupportedExtensionsEnv, "")
+	if err := AdvertiseExtensions("org.example.Other", JSONExtension); err != nil {
+		t.Fatalf("advertise #error: %v", err)
+	}
+	if !IsSupported(JSONExtension) || IsSupported("org.example.Missing") {
+		t.Fatalf("advertise #error: unexpected extensions %q", os.Getenv(SupportedExtensionsEnv))
+	}
+	var requests []JSONMessage
+	handler := JSONHandler{
+		ConversationHandler: pamtest.NewScript(),
+		Respond: func(req JSONMessage) (json.RawMessage, error) {
+			requests = append(requests, req)
+			return json.RawMessage(`{"methods":["password","qrcode"]}`), nil
+		},
+	}
+	tx, err := (&pamtest.Service{}).Start("gdm-authd", "alice", handler)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	var resp authResponse
+	if err := SendJSONValue(tx, "com.example.authd", 2, authRequest{"methods"}, &resp); err != nil {
+		t.Fatalf("sendjson #error: %v", err)
+	}
+	if len(resp.Methods) != 2 || resp.Methods[1] != "qrcode" {
+		t.Fatalf("sendjson #error: unexpected response %+v", resp)
+	}
+	if len(requests) != 1 || requests[0].Protocol != "com.example.authd" ||
+		requests[0].Version != 2 || string(requests[0].JSON) != `{"type":"methods"}` {
+		t.Fatalf("respond #error: unexpected requests %+v", requests)
+	}
+
+	if _, err := SendJSON(tx, JSONMessage{"com.example.authd", 1, json.RawMessage("{")}); err == nil {
+		t.Fatalf("sendjson #expected an error")
+	}
+	handler.Respond = func(req JSONMessage) (json.RawMessage, error) {
+		return json.RawMessage("not json"), nil
+	}
+	tx, _ = (&pamtest.Service{}).Start("gdm-authd", "alice", handler)
+	if _, err := SendJSON(tx, JSONMessage{"com.example.authd", 1, json.RawMessage("{}")}); !errors.Is(err, pam.ErrConv) {
+		t.Fatalf("sendjson #error: expected %v, got %v", pam.ErrConv, err)
+	}
+}
+
+func TestJSON_Unsupported(t *testing.T) {
+	t.Setenv(SupportedExtensionsEnv, "org.example.Other")
+	tx, _ := (&pamtest.Service{}).Start("gdm-authd", "alice", pamtest.NewScript())
+	_, err := SendJSON(tx, JSONMessage{"com.example.authd", 1, json.RawMessage("{}")})
+	if !errors.Is(err, ErrUnsupported) || !errors.Is(err, pam.ErrConv) {
+		t.Fatalf("sendjson #error: expected %v, got %v", ErrUnsupported, err)
+	}
+	if _, err := DecodeJSONRequest(nil); !errors.Is(err, ErrNotJSON) {
+		t.Fatalf("decode #error: expected %v, got %v", ErrNotJSON, err)
+	}
+	if err := AdvertiseExtensions("two words"); err == nil {
+		t.Fatalf("advertise #expected an error")
+	}
+}
+
+func TestDecodeJSONRequest_OtherExtension(t *testing.T) {
+	t.Setenv(SupportedExtensionsEnv, JSONExtension)
+	other, err := pam.NewBinaryPrompt(1, make([]byte, messageSize))
+	if err != nil {
+		t.Fatalf("newbinaryprompt #error: %v", err)
+	}
+	defer pam.FreeBinaryPrompt(other)
+	if _, err := DecodeJSONRequest(other); !errors.Is(err, ErrNotJSON) {
+		t.Fatalf("decode #error: expected %v, got %v", ErrNotJSON, err)
+	}
+}
@@ -0,0 +1,51 @@
+package pam
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// handle references a Go value from C memory, like cgo.Handle does. The
+// values are stored in a concurrent map, whose lookups don't lock: the
+// conversation callbacks resolve the handle of their transaction for each
+// conversation, and daemons run many of them concurrently.
+type handle uintptr
+
+var handles struct {
+	last   atomic.Uintptr
+	live   atomic.Int64
+	values sync.Map
+}
+
+// newHandle returns a handle for the value, valid until it is deleted.
+func newHandle(v any) handle {
+	h := handle(handles.last.Add(1))
+	handles.values.Store(h, v)
+	handles.live.Add(1)
+	return h
+}
+
+// value returns the value of the handle. It panics if the handle is not
+// valid.
+func (h handle) value() any {
+	v, ok := handles.values.Load(h)
+	if !ok {
+		panic("pam: misuse of an invalid handle")
+	}
+	return v
+}
+
+// delete invalidates the handle, releasing its value.
+func (h handle) delete() {
+	if _, ok := handles.values.LoadAndDelete(h); !ok {
+		panic("pam: misuse of an invalid handle")
+	}
+	handles.live.Add(-1)
+}
+
+// LiveTransactions returns the number of transactions started and neither
+// ended nor garbage collected yet, each holding a PAM handle, to diagnose
+// the applications leaking them, such as by exporting it as a metric.
+func LiveTransactions() int {
+	return int(handles.live.Load())
+}
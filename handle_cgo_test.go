@@ -0,0 +1,20 @@
+//go:build cgo
+
+package pam
+
+import (
+	"runtime/cgo"
+	"testing"
+)
+
+func BenchmarkHandle_Cgo(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			h := cgo.NewHandle(b)
+			for i := 0; i < 4; i++ {
+				h.Value()
+			}
+			h.Delete()
+		}
+	})
+}
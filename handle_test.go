@@ -0,0 +1,29 @@
+package pam
+
+import "testing"
+
+func TestHandle(t *testing.T) {
+	h := newHandle("value")
+	if v := h.value(); v != "value" {
+		t.Fatalf("value #error: expected value, got %v", v)
+	}
+	h.delete()
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("value #expected a panic")
+		}
+	}()
+	h.value()
+}
+
+func BenchmarkHandle(b *testing.B) {
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			h := newHandle(b)
+			for i := 0; i < 4; i++ {
+				h.value()
+			}
+			h.delete()
+		}
+	})
+}
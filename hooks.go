@@ -0,0 +1,104 @@
+//go:build cgo
+
+package pam
+
+//#include <security/pam_appl.h>
+import "C"
+
+import (
+	"time"
+	"unsafe"
+)
+
+func noHooks(status C.int) C.int {
+	return status
+}
+
+// hooks runs the profiling hooks and notifies the observer for the PAM call
+// op of the transaction, returning the function to call with its status once
+// it returns. The end of the transactions that are garbage collected is
+// observed as well.
+func (t *Transaction) hooks(op string, f Flags) (done func(C.int) C.int) {
+	o := loadObserver(t.subscribers)
+	if o == nil && Profile(profile.Load()) == 0 {
+		return noHooks
+	}
+	end := t.profile(op)
+	if o == nil {
+		return func(status C.int) C.int {
+			end()
+			return status
+		}
+	}
+	e := Event{Kind: EventOperation, Operation: op, Flags: f}
+	switch op {
+	case "start":
+		e.Kind = EventStart
+	case "end":
+		e.Kind = EventEnd
+	}
+	return t.observeCall(o, e, end)
+}
+
+// callHooks notifies the observer, if any, for the PAM call op of the
+// transaction, sent as an event of the kind with the item i, as hooks does
+// for the operations.
+func (t *Transaction) callHooks(kind EventKind, op string, i Item) (done func(C.int) C.int) {
+	o := loadObserver(t.subscribers)
+	if o == nil {
+		return noHooks
+	}
+	return t.observeCall(o, Event{Kind: kind, Operation: op, Item: i}, noProfile)
+}
+
+// observeCall sends the EventCallStart of the call e is the event of, and
+// returns the function sending e once the call returns with its status.
+func (t *Transaction) observeCall(o Observer, e Event, end func()) (done func(C.int) C.int) {
+	e.ID, e.Service = uint64(t.c), t.service
+	// The handle is released by pam_end.
+	e.User = t.user()
+	o.Observe(Event{Kind: EventCallStart, ID: e.ID, Time: time.Now(),
+		Service: e.Service, User: e.User, Operation: e.Operation,
+		Item: e.Item, Flags: e.Flags})
+	e.Time = time.Now()
+	return func(status C.int) C.int {
+		end()
+		e.Duration = time.Since(e.Time)
+		e.Status = ReturnType(status)
+		if e.Kind != EventEnd {
+			e.User = t.user()
+		}
+		o.Observe(e)
+		return status
+	}
+}
+
+// user returns the User item of the transaction, if it has a handle.
+func (t *Transaction) user() string {
+	if t.handle == nil {
+		return ""
+	}
+	var s unsafe.Pointer
+	if C.pam_get_item(t.handle, C.PAM_USER, &s) != C.PAM_SUCCESS {
+		return ""
+	}
+	return C.GoString((*C.char)(s))
+}
+
+// observeConversation notifies the observer o of a conversation started at
+// start, with the kind EventConversationStart or EventConversation.
+func (conv *conversation) observeConversation(o Observer, kind EventKind, start time.Time, msg []*C.struct_pam_message, status C.int) {
+	e := Event{Kind: kind, ID: uint64(conv.id), Time: start,
+		Service: conv.service, Operation: "conv", Status: ReturnType(status)}
+	if kind == EventConversation {
+		e.Duration = time.Since(start)
+	}
+	for _, m := range msg {
+		cm := ConversationMessage{Style: Style(m.msg_style)}
+		if cm.Style != BinaryPrompt {
+			cm.Message = C.GoString(m.msg)
+		}
+		e.Messages = append(e.Messages, cm)
+	}
+	o.Observe(e)
+}
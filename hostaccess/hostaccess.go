@@ -0,0 +1,318 @@
+// Package hostaccess evaluates the remote hosts of the transactions, as set
+// in their Rhost item, against lists of allowed and denied hosts, for the
+// account modules written in Go controlling where the users can log in from.
+//
+//	policy := hostaccess.Policy{
+//		Allow: hostaccess.MustParsePatterns("10.0.0.0/8", ".example.com"),
+//	}
+//	d, err := policy.Evaluate(ctx, rhost)
+//	if err != nil {
+//		return err
+//	}
+//	return d.Err()
+package hostaccess
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/msteinert/pam"
+)
+
+// Host is a remote host.
+type Host struct {
+	// Name is the host name, empty if the host is an address.
+	Name string
+	// Addr is the address of the host, invalid if it is a name.
+	Addr netip.Addr
+}
+
+// Local returns whether the host is the local one, as it is when the Rhost
+// item is not set.
+func (h Host) Local() bool {
+	return h.Name == "" && !h.Addr.IsValid()
+}
+
+func (h Host) String() string {
+	if h.Addr.IsValid() {
+		return h.Addr.String()
+	}
+	return h.Name
+}
+
+// ParseRhost parses a Rhost item, which is a host name or an address, IPv6
+// addresses possibly being between brackets. The empty items are the local
+// host.
+func ParseRhost(rhost string) (Host, error) {
+	rhost = strings.TrimSpace(rhost)
+	if rhost == "" {
+		return Host{}, nil
+	}
+	if strings.HasPrefix(rhost, "[") && strings.HasSuffix(rhost, "]") {
+		rhost = rhost[1 : len(rhost)-1]
+	}
+	if addr, err := netip.ParseAddr(rhost); err == nil {
+		return Host{Addr: addr.Unmap()}, nil
+	}
+	name := strings.ToLower(strings.TrimSuffix(rhost, "."))
+	if name == "" || strings.ContainsAny(name, " \t/@[]") {
+		return Host{}, fmt.Errorf("invalid remote host %q", rhost)
+	}
+	return Host{Name: name}, nil
+}
+
+// Pattern matches the hosts. Its forms are:
+//
+//   - ALL, matching all the hosts, and LOCAL, matching the local host and
+//     the names without dots, as in pam_access;
+//   - an address, or a network in CIDR notation such as 10.0.0.0/8;
+//   - a host name, or a domain starting with a dot such as .example.com,
+//     or with *. such as *.example.com, matching its subdomains.
+type Pattern struct {
+	text   string
+	prefix netip.Prefix
+	name   string
+	domain bool
+}
+
+func (p Pattern) String() string {
+	return p.text
+}
+
+// ParsePattern parses a pattern.
+func ParsePattern(s string) (Pattern, error) {
+	p := Pattern{text: s}
+	switch {
+	case s == "ALL" || s == "LOCAL":
+	case strings.Contains(s, "/"):
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return Pattern{}, fmt.Errorf("invalid pattern %q: %w", s, err)
+		}
+		p.prefix = prefix.Masked()
+	default:
+		if addr, err := netip.ParseAddr(s); err == nil {
+			p.prefix = netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen())
+			break
+		}
+		name := strings.ToLower(strings.TrimSuffix(s, "."))
+		if rest, ok := strings.CutPrefix(name, "*."); ok {
+			name = "." + rest
+		}
+		p.domain = strings.HasPrefix(name, ".")
+		if strings.Trim(name, ".") == "" || strings.ContainsAny(name, " \t/@*[]") {
+			return Pattern{}, fmt.Errorf("invalid pattern %q", s)
+		}
+		p.name = name
+	}
+	return p, nil
+}
+
+// ParsePatterns parses the patterns.
+func ParsePatterns(s ...string) ([]Pattern, error) {
+	patterns := make([]Pattern, 0, len(s))
+	for _, text := range s {
+		p, err := ParsePattern(text)
+		if err != nil {
+			return nil, err
+		}
+		patterns = append(patterns, p)
+	}
+	return patterns, nil
+}
+
+// MustParsePatterns is like ParsePatterns, but panics on failure.
+func MustParsePatterns(s ...string) []Pattern {
+	patterns, err := ParsePatterns(s...)
+	if err != nil {
+		panic(err)
+	}
+	return patterns
+}
+
+// needsAddrs returns whether the pattern matches the addresses.
+func (p Pattern) needsAddrs() bool {
+	return p.prefix.IsValid()
+}
+
+// match returns whether the pattern matches the host, known by its names and
+// addresses.
+func (p Pattern) match(local bool, names []string, addrs []netip.Addr) bool {
+	switch {
+	case p.text == "ALL":
+		return true
+	case p.text == "LOCAL":
+		return local || slices.ContainsFunc(names, func(n string) bool {
+			return !strings.Contains(n, ".")
+		})
+	case p.prefix.IsValid():
+		return slices.ContainsFunc(addrs, p.prefix.Contains)
+	case p.domain:
+		return slices.ContainsFunc(names, func(n string) bool {
+			return strings.HasSuffix(n, p.name)
+		})
+	}
+	return slices.Contains(names, p.name)
+}
+
+// Resolver resolves the names and the addresses of the hosts. It is
+// implemented by net.Resolver.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+	LookupAddr(ctx context.Context, addr string) ([]string, error)
+}
+
+// Result is the result of an evaluation.
+type Result int
+
+// Evaluation results.
+const (
+	// Allowed hosts match an allowed pattern, or no pattern if the allow
+	// list is empty.
+	Allowed Result = iota
+	// Denied hosts match a denied pattern.
+	Denied
+	// NotAllowed hosts match no pattern of a non-empty allow list.
+	NotAllowed
+)
+
+func (r Result) String() string {
+	switch r {
+	case Allowed:
+		return "allowed"
+	case Denied:
+		return "denied"
+	}
+	return "not allowed"
+}
+
+// Decision is the decision of a Policy about a host.
+type Decision struct {
+	Host   Host
+	Result Result
+	// Pattern is the pattern that matched, if any.
+	Pattern string
+}
+
+// Allowed returns whether the host is allowed.
+func (d Decision) Allowed() bool {
+	return d.Result == Allowed
+}
+
+// Err returns nil if the host is allowed, otherwise pam.ErrPermDenied, with
+// the reason.
+func (d Decision) Err() error {
+	switch {
+	case d.Allowed():
+		return nil
+	case d.Pattern != "":
+		return fmt.Errorf("%w: host %s %s by %q", pam.ErrPermDenied, d.Host, d.Result, d.Pattern)
+	}
+	return fmt.Errorf("%w: host %s %s", pam.ErrPermDenied, d.Host, d.Result)
+}
+
+// Policy allows or denies the hosts. The hosts matching a denied pattern
+// are denied, even if they match an allowed pattern too. Otherwise, they
+// are allowed if they match an allowed pattern, or if there are none.
+//
+// Policies with address patterns resolve the host names, and those with
+// name patterns resolve the addresses to names, keeping only the names
+// resolving back to the address, so that the owners of the reverse zones
+// can't claim any name.
+type Policy struct {
+	Allow []Pattern
+	Deny  []Pattern
+	// Resolver resolves the hosts, net.DefaultResolver if nil.
+	Resolver Resolver
+}
+
+// Evaluate evaluates the host of the Rhost item. It fails if the host is
+// invalid or can't be resolved, the hosts that don't exist being resolved
+// to nothing.
+func (p *Policy) Evaluate(ctx context.Context, rhost string) (Decision, error) {
+	host, err := ParseRhost(rhost)
+	if err != nil {
+		return Decision{}, err
+	}
+	names, addrs, err := p.resolve(ctx, host)
+	if err != nil {
+		return Decision{Host: host}, err
+	}
+	local := host.Local()
+	for _, pat := range p.Deny {
+		if pat.match(local, names, addrs) {
+			return Decision{Host: host, Result: Denied, Pattern: pat.text}, nil
+		}
+	}
+	for _, pat := range p.Allow {
+		if pat.match(local, names, addrs) {
+			return Decision{Host: host, Result: Allowed, Pattern: pat.text}, nil
+		}
+	}
+	if len(p.Allow) > 0 {
+		return Decision{Host: host, Result: NotAllowed}, nil
+	}
+	return Decision{Host: host, Result: Allowed}, nil
+}
+
+// resolve returns the names and the addresses of the host, resolving them
+// as needed by the patterns.
+func (p *Policy) resolve(ctx context.Context, host Host) ([]string, []netip.Addr, error) {
+	if host.Local() {
+		return nil, nil, nil
+	}
+	var r Resolver = net.DefaultResolver
+	if p.Resolver != nil {
+		r = p.Resolver
+	}
+	patterns := slices.Concat(p.Allow, p.Deny)
+	if host.Name != "" {
+		names := []string{host.Name}
+		if !slices.ContainsFunc(patterns, Pattern.needsAddrs) {
+			return names, nil, nil
+		}
+		addrs, err := lookupAddrs(ctx, r, host.Name)
+		return names, addrs, err
+	}
+	addrs := []netip.Addr{host.Addr}
+	if !slices.ContainsFunc(patterns, func(pat Pattern) bool { return pat.name != "" || pat.text == "LOCAL" }) {
+		return nil, addrs, nil
+	}
+	candidates, err := r.LookupAddr(ctx, host.Addr.String())
+	if err != nil && !isNotFound(err) {
+		return nil, nil, fmt.Errorf("%w: %w", pam.ErrAuthinfoUnavail, err)
+	}
+	var names []string
+	for _, name := range candidates {
+		name = strings.ToLower(strings.TrimSuffix(name, "."))
+		forward, err := lookupAddrs(ctx, r, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		if slices.Contains(forward, host.Addr) {
+			names = append(names, name)
+		}
+	}
+	return names, addrs, nil
+}
+
+func lookupAddrs(ctx context.Context, r Resolver, name string) ([]netip.Addr, error) {
+	addrs, err := r.LookupNetIP(ctx, "ip", name)
+	if err != nil && !isNotFound(err) {
+		return nil, fmt.Errorf("%w: %w", pam.ErrAuthinfoUnavail, err)
+	}
+	for i, addr := range addrs {
+		addrs[i] = addr.Unmap()
+	}
+	return addrs, nil
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
@@ -0,0 +1,125 @@
+package hostaccess
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/netip"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+type fakeResolver struct {
+	addrs map[string][]netip.Addr
+	names map[string][]string
+	fail  bool
+}
+
+func (r *fakeResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	if r.fail {
+		return nil, &net.DNSError{Err: "server misbehaving", Name: host, IsTemporary: true}
+	}
+	if addrs, ok := r.addrs[host]; ok {
+		return addrs, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+}
+
+func (r *fakeResolver) LookupAddr(ctx context.Context, addr string) ([]string, error) {
+	if names, ok := r.names[addr]; ok {
+		return names, nil
+	}
+	return nil, &net.DNSError{Err: "no such host", Name: addr, IsNotFound: true}
+}
+
+func TestParseRhost(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"", ""},
+		{"Host.Example.COM.", "host.example.com"},
+		{"192.0.2.1", "192.0.2.1"},
+		{"[2001:db8::1]", "2001:db8::1"},
+		{"::ffff:192.0.2.1", "192.0.2.1"},
+	}
+	for _, tc := range tests {
+		h, err := ParseRhost(tc.in)
+		if err != nil || h.String() != tc.want {
+			t.Fatalf("parse #error: %q: got %q, %v, expected %q", tc.in, h, err, tc.want)
+		}
+	}
+	for _, bad := range []string{"user@host", "a b", "10.0.0.0/8"} {
+		if _, err := ParseRhost(bad); err == nil {
+			t.Fatalf("parse #error: %q: expected a failure", bad)
+		}
+	}
+}
+
+func TestParsePattern(t *testing.T) {
+	for _, bad := range []string{"10.0.0.0/33", "*", ".", "a b", "*.*.example.com"} {
+		if _, err := ParsePattern(bad); err == nil {
+			t.Fatalf("parse #error: %q: expected a failure", bad)
+		}
+	}
+}
+
+func TestPolicy(t *testing.T) {
+	r := &fakeResolver{
+		addrs: map[string][]netip.Addr{
+			"host.example.com":  {netip.MustParseAddr("10.1.2.3")},
+			"spoof.example.com": {netip.MustParseAddr("198.51.100.1")},
+			"bad.example.org":   {netip.MustParseAddr("192.0.2.66")},
+		},
+		names: map[string][]string{
+			"10.1.2.3":   {"host.example.com."},
+			"192.0.2.55": {"spoof.example.com."},
+			"192.0.2.66": {"bad.example.org."},
+		},
+	}
+	p := &Policy{
+		Allow:    MustParsePatterns("10.0.0.0/8", "*.example.com", "LOCAL"),
+		Deny:     MustParsePatterns("bad.example.org", "10.9.0.0/16"),
+		Resolver: r,
+	}
+	tests := []struct {
+		rhost   string
+		want    Result
+		pattern string
+	}{
+		{"", Allowed, "LOCAL"},
+		{"10.1.2.3", Allowed, "10.0.0.0/8"},
+		{"host.example.com", Allowed, "10.0.0.0/8"},
+		{"10.9.1.1", Denied, "10.9.0.0/16"},
+		{"192.0.2.66", Denied, "bad.example.org"},
+		{"bad.example.org", Denied, "bad.example.org"},
+		// The reverse name doesn't resolve back to the address.
+		{"192.0.2.55", NotAllowed, ""},
+		{"unknown.example.net", NotAllowed, ""},
+		{"workstation", Allowed, "LOCAL"},
+	}
+	for _, tc := range tests {
+		d, err := p.Evaluate(context.Background(), tc.rhost)
+		if err != nil {
+			t.Fatalf("evaluate #error: %q: %v", tc.rhost, err)
+		}
+		if d.Result != tc.want || d.Pattern != tc.pattern {
+			t.Fatalf("evaluate #error: %q: got %v by %q, expected %v by %q",
+				tc.rhost, d.Result, d.Pattern, tc.want, tc.pattern)
+		}
+		if err := d.Err(); (err == nil) != (tc.want == Allowed) ||
+			(err != nil && !errors.Is(err, pam.ErrPermDenied)) {
+			t.Fatalf("evaluate #error: %q: %v", tc.rhost, err)
+		}
+	}
+
+	r.fail = true
+	if _, err := p.Evaluate(context.Background(), "host.example.com"); !errors.Is(err, pam.ErrAuthinfoUnavail) {
+		t.Fatalf("evaluate #error: %v", err)
+	}
+
+	open := &Policy{Deny: MustParsePatterns(".example.org"), Resolver: r}
+	if d, err := open.Evaluate(context.Background(), "203.0.113.1"); err != nil || !d.Allowed() {
+		t.Fatalf("evaluate #error: %v, %v", d, err)
+	}
+}
@@ -0,0 +1,231 @@
+package pam
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Catalog holds the translations of messages, by locale, as gettext
+// catalogs do: the messages are their own identifiers, and those without a
+// translation are kept as they are. The built-in helpers, such as
+// ChangePassword, translate their messages with DefaultCatalog.
+//
+// A Catalog can be used by multiple goroutines at the same time.
+type Catalog struct {
+	mu       sync.RWMutex
+	messages map[string]map[string]string
+}
+
+// DefaultCatalog is the catalog of the built-in helpers, which module
+// authors can use too.
+var DefaultCatalog = &Catalog{}
+
+// Add adds the translations of the locale, by message, such as "de" or
+// "pt_BR".
+func (c *Catalog) Add(locale string, messages map[string]string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.messages == nil {
+		c.messages = map[string]map[string]string{}
+	}
+	m := c.messages[locale]
+	if m == nil {
+		m = make(map[string]string, len(messages))
+		c.messages[locale] = m
+	}
+	for id, s := range messages {
+		m[id] = s
+	}
+}
+
+// LoadPO adds the translations of a gettext .po file for the locale.
+func (c *Catalog) LoadPO(locale string, r io.Reader) error {
+	messages, err := ParsePO(r)
+	if err != nil {
+		return err
+	}
+	c.Add(locale, messages)
+	return nil
+}
+
+// LoadFS adds the translations of the .po files of the root of fsys, such
+// as an embed.FS, named after their locales: de.po, pt_BR.po...
+func (c *Catalog) LoadFS(fsys fs.FS) error {
+	files, err := fs.Glob(fsys, "*.po")
+	if err != nil {
+		return err
+	}
+	for _, name := range files {
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		err = c.LoadPO(strings.TrimSuffix(path.Base(name), ".po"), f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// Translate returns the translation of msgid for the locale, as returned by
+// LocaleFromEnv, trying the locale without its encoding and modifier, then
+// its language alone: de_AT.UTF-8 uses the translations of de_AT, then of
+// de. It returns msgid if there is none.
+func (c *Catalog) Translate(locale, msgid string) string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, l := range localeFallbacks(locale) {
+		if s, ok := c.messages[l][msgid]; ok {
+			return s
+		}
+	}
+	return msgid
+}
+
+// Sprintf translates format for the locale, then formats it.
+func (c *Catalog) Sprintf(locale, format string, a ...any) string {
+	return fmt.Sprintf(c.Translate(locale, format), a...)
+}
+
+// localeFallbacks returns the locales whose translations apply to locale,
+// from the most specific.
+func localeFallbacks(locale string) []string {
+	if i := strings.IndexAny(locale, ".@"); i >= 0 {
+		locale = locale[:i]
+	}
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return nil
+	}
+	if lang, _, ok := strings.Cut(locale, "_"); ok {
+		return []string{locale, lang}
+	}
+	return []string{locale}
+}
+
+// LocaleFromEnv returns the locale of the messages set by the variables of
+// env, as gettext selects it: LC_ALL, LC_MESSAGES, then LANG, unless the
+// first language of LANGUAGE overrides it. It is empty if none is set.
+func LocaleFromEnv(env map[string]string) string {
+	var locale string
+	for _, name := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if locale = env[name]; locale != "" {
+			break
+		}
+	}
+	if locale == "" || locale == "C" || locale == "POSIX" {
+		return locale
+	}
+	if lang, _, _ := strings.Cut(env["LANGUAGE"], ":"); lang != "" {
+		return lang
+	}
+	return locale
+}
+
+// Locale returns the locale of the messages of the user, as set in the PAM
+// environment, see LocaleFromEnv.
+func (t *Transaction) Locale() string {
+	env, err := t.GetEnvList()
+	if err != nil {
+		return ""
+	}
+	return LocaleFromEnv(env)
+}
+
+// ParsePO parses a gettext .po file, returning the translations by message.
+// The fuzzy translations, the empty ones and the header are skipped; the
+// messages with a context are keyed by the context and the message separated
+// by a \x04 byte, as gettext does, and those with plural forms keep their
+// first one only.
+func ParsePO(r io.Reader) (map[string]string, error) {
+	messages := map[string]string{}
+	var e poEntry
+	// cur is the string continued by the lines starting with a quote.
+	var cur *string
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		switch {
+		case line == "":
+			continue
+		case strings.HasPrefix(line, "#"):
+			if e.hasID {
+				e.add(messages)
+				e, cur = poEntry{}, nil
+			}
+			if strings.HasPrefix(line, "#,") && strings.Contains(line, "fuzzy") {
+				e.fuzzy = true
+			}
+			continue
+		case strings.HasPrefix(line, `"`):
+			s, err := strconv.Unquote(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			if cur != nil {
+				*cur += s
+			}
+			continue
+		}
+		keyword, rest, _ := strings.Cut(line, " ")
+		s, err := strconv.Unquote(strings.TrimSpace(rest))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		switch {
+		case keyword == "msgctxt" || keyword == "msgid":
+			if e.hasID {
+				e.add(messages)
+				e = poEntry{}
+			}
+			if keyword == "msgctxt" {
+				e.ctx, e.hasCtx, cur = s, true, &e.ctx
+			} else {
+				e.id, e.hasID, cur = s, true, &e.id
+			}
+		case keyword == "msgstr" || keyword == "msgstr[0]":
+			if !e.hasID {
+				return nil, fmt.Errorf("line %d: %s without msgid", n, keyword)
+			}
+			e.str, cur = s, &e.str
+		case keyword == "msgid_plural" || strings.HasPrefix(keyword, "msgstr["):
+			// Only the first form is kept.
+			cur = nil
+		default:
+			return nil, fmt.Errorf("line %d: unknown keyword %q", n, keyword)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if e.hasID {
+		e.add(messages)
+	}
+	return messages, nil
+}
+
+// poEntry is an entry of a .po file.
+type poEntry struct {
+	ctx, id, str  string
+	hasCtx, hasID bool
+	fuzzy         bool
+}
+
+// add adds the translation of the entry to messages, if any.
+func (e *poEntry) add(messages map[string]string) {
+	if e.id == "" || e.str == "" || e.fuzzy {
+		return
+	}
+	key := e.id
+	if e.hasCtx {
+		key = e.ctx + "\x04" + key
+	}
+	messages[key] = e.str
+}
@@ -0,0 +1,145 @@
+package pam
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const testPO = `# German translations.
+msgid ""
+msgstr ""
+"Content-Type: text/plain; charset=UTF-8\n"
+
+msgid "Password: "
+msgstr "Passwort: "
+
+#, fuzzy
+msgid "New password: "
+msgstr "Neues Passwort: "
+
+msgctxt "button"
+msgid "Open"
+msgstr "Öffnen"
+
+msgid ""
+"The password is shorter than %d "
+"characters"
+msgstr "Das Passwort ist kürzer als %d Zeichen"
+
+msgid "%d day"
+msgid_plural "%d days"
+msgstr[0] "%d Tag"
+msgstr[1] "%d Tage"
+
+msgid "Untranslated"
+msgstr ""
+`
+
+func TestParsePO(t *testing.T) {
+	messages, err := ParsePO(strings.NewReader(testPO))
+	if err != nil {
+		t.Fatalf("parse #error: %v", err)
+	}
+	expected := map[string]string{
+		"Password: ":     "Passwort: ",
+		"button\x04Open": "Öffnen",
+		"%d day":         "%d Tag",
+		"The password is shorter than %d characters": "Das Passwort ist kürzer als %d Zeichen",
+	}
+	if len(messages) != len(expected) {
+		t.Fatalf("parse #error: expected %q, got %q", expected, messages)
+	}
+	for id, s := range expected {
+		if messages[id] != s {
+			t.Fatalf("parse #error: %q: expected %q, got %q", id, s, messages[id])
+		}
+	}
+
+	for _, bad := range []string{"msgstr \"x\"", "msgid x", "unknown \"x\""} {
+		if _, err := ParsePO(strings.NewReader(bad)); err == nil {
+			t.Fatalf("parse #error: %q: expected a failure", bad)
+		}
+	}
+}
+
+func TestCatalog(t *testing.T) {
+	c := &Catalog{}
+	err := c.LoadFS(fstest.MapFS{
+		"de.po":    {Data: []byte(testPO)},
+		"de_AT.po": {Data: []byte("msgid \"Password: \"\nmsgstr \"Kennwort: \"\n")},
+		"README":   {Data: []byte("not a catalog")},
+	})
+	if err != nil {
+		t.Fatalf("load #error: %v", err)
+	}
+	for _, tt := range []struct{ locale, expected string }{
+		{"de_DE.UTF-8", "Passwort: "},
+		{"de_AT.UTF-8@euro", "Kennwort: "},
+		{"de", "Passwort: "},
+		{"fr_FR.UTF-8", "Password: "},
+		{"C", "Password: "},
+		{"", "Password: "},
+	} {
+		if s := c.Translate(tt.locale, "Password: "); s != tt.expected {
+			t.Fatalf("translate #error: %q: expected %q, got %q", tt.locale, tt.expected, s)
+		}
+	}
+	if s := c.Sprintf("de_DE", "The password is shorter than %d characters", 8); s != "Das Passwort ist kürzer als 8 Zeichen" {
+		t.Fatalf("sprintf #error: got %q", s)
+	}
+}
+
+func TestLocaleFromEnv(t *testing.T) {
+	for _, tt := range []struct {
+		env      map[string]string
+		expected string
+	}{
+		{map[string]string{}, ""},
+		{map[string]string{"LANG": "de_DE.UTF-8"}, "de_DE.UTF-8"},
+		{map[string]string{"LANG": "de_DE.UTF-8", "LC_MESSAGES": "fr_FR"}, "fr_FR"},
+		{map[string]string{"LC_ALL": "it_IT", "LC_MESSAGES": "fr_FR"}, "it_IT"},
+		{map[string]string{"LANG": "de_DE", "LANGUAGE": "pt_BR:pt"}, "pt_BR"},
+		{map[string]string{"LANG": "C", "LANGUAGE": "pt_BR"}, "C"},
+	} {
+		if l := LocaleFromEnv(tt.env); l != tt.expected {
+			t.Fatalf("locale #error: %v: expected %q, got %q", tt.env, tt.expected, l)
+		}
+	}
+}
+
+func TestPasswordChangeHandler_PolicyLocale(t *testing.T) {
+	DefaultCatalog.Add("eo", map[string]string{
+		"The password is shorter than %d characters": "La pasvorto estas pli mallonga ol %d signoj",
+	})
+	ui := &policyUI{passwords: []string{"weak", "N3w-passw0rd"}}
+	h := &passwordChangeHandler{ui: ui, policy: DefaultPasswordPolicy{}, locale: "eo.UTF-8"}
+	if _, err := h.RespondPAM(PromptEchoOff, "New password: "); err != nil {
+		t.Fatalf("respond #error: %v", err)
+	}
+	expected := []string{"La pasvorto estas pli mallonga ol 8 signoj"}
+	if !slices.Equal(ui.messages, expected) {
+		t.Fatalf("respond #error: expected messages %q, got %q", expected, ui.messages)
+	}
+}
+
+func TestTransaction_Locale(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	tx, err := StartConfDir("permit-service", "test", Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	if l := tx.Locale(); l != "" {
+		t.Fatalf("locale #error: expected none, got %q", l)
+	}
+	if err := tx.PutEnv("LANG=de_DE.UTF-8"); err != nil {
+		t.Fatalf("putenv #error: %v", err)
+	}
+	if l := tx.Locale(); l != "de_DE.UTF-8" {
+		t.Fatalf("locale #error: got %q", l)
+	}
+}
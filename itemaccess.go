@@ -0,0 +1,56 @@
+package pam
+
+import (
+	"fmt"
+	"strings"
+)
+
+// The typed item accessors check the items as the raw GetItem and SetItem
+// can't: the values with NUL bytes, which C would silently truncate, fail
+// with ErrBadItem, as do the items the application may not access.
+
+// checkItemValue fails with ErrBadItem for the values C would truncate.
+func checkItemValue(i Item, value string) error {
+	if strings.IndexByte(value, 0) >= 0 {
+		return fmt.Errorf("%v: %w: contains a NUL byte", i, ErrBadItem)
+	}
+	return nil
+}
+
+// setStringItem sets the string item once its value is checked.
+func (t *Transaction) setStringItem(i Item, value string) error {
+	if err := checkItemValue(i, value); err != nil {
+		return err
+	}
+	return t.SetItem(i, value)
+}
+
+// GetUserItem returns the name of the user, as set by Start or by the
+// modules. It is empty if no user is known yet.
+func (t *Transaction) GetUserItem() (string, error) {
+	return t.GetItem(User)
+}
+
+// SetRHost sets the name of the remote host the user connects from.
+func (t *Transaction) SetRHost(host string) error {
+	return t.setStringItem(Rhost, host)
+}
+
+// SetTTY sets the name of the terminal of the user, such as "/dev/tty1",
+// or the X display for graphical logins.
+func (t *Transaction) SetTTY(tty string) error {
+	return t.setStringItem(Tty, tty)
+}
+
+// SetUserPrompt sets the prompt used by the modules asking for the user
+// name.
+func (t *Transaction) SetUserPrompt(prompt string) error {
+	return t.setStringItem(UserPrompt, prompt)
+}
+
+// GetAuthtokItem always fails with ErrBadItem: the authentication token is
+// only readable by the modules. It fails before calling PAM, whatever the
+// implementation, so that the applications relying on it are caught.
+func (t *Transaction) GetAuthtokItem() (string, error) {
+	return "", checkReadableItem(Authtok)
+}
@@ -0,0 +1,133 @@
+//go:build cgo
+
+package pam
+
+//#include <security/pam_appl.h>
+//void set_items(pam_handle_t *pamh, int n, const int *items, const char **values, int *status);
+//void get_items(pam_handle_t *pamh, int n, const int *items, const char **values, int *status);
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// SetItems sets multiple PAM information items at once, as applications
+// usually do for Tty, Rhost, Ruser and UserPrompt. All the items are set
+// with a single call to C; the items that can't be set don't prevent the
+// others from being set, and their failures are joined in the returned
+// error. The C copies of the items are wiped once PAM has copied them.
+func (t *Transaction) SetItems(items map[Item]string) error {
+	if err, ok := diverted(t.thread, func() error { return t.SetItems(items) }); ok {
+		return err
+	}
+	if err := t.state.enter(); err != nil {
+		return err
+	}
+	defer t.state.leave()
+	keys, errs := stringItems(slices.Sorted(maps.Keys(items)))
+	if len(keys) == 0 {
+		return errors.Join(errs...)
+	}
+	ids := make([]C.int, len(keys))
+	values := make([]*C.char, len(keys))
+	status := make([]C.int, len(keys))
+	for i, item := range keys {
+		ids[i] = C.int(item)
+		values[i] = cString(items[item])
+		defer freeSecret(values[i])
+	}
+	dones := make([]func(C.int) C.int, len(keys))
+	for i, item := range keys {
+		dones[i] = t.callHooks(EventItem, "set_item", item)
+	}
+	C.set_items(t.handle, C.int(len(keys)), &ids[0], &values[0], &status[0])
+	for i, done := range dones {
+		done(status[i])
+	}
+	return errors.Join(append(errs, t.itemsResult(keys, status))...)
+}
+
+// GetItems retrieves multiple PAM information items at once. The items
+// that can't be retrieved, such as the authentication tokens, are not in
+// the returned map, and their failures are joined in the returned error.
+func (t *Transaction) GetItems(items []Item) (map[Item]string, error) {
+	if r, err, ok := diverted2(t.thread, func() (map[Item]string, error) { return t.GetItems(items) }); ok {
+		return r, err
+	}
+	if err := t.state.enter(); err != nil {
+		return nil, err
+	}
+	defer t.state.leave()
+	items, errs := readableItems(items)
+	if len(items) == 0 {
+		return map[Item]string{}, errors.Join(errs...)
+	}
+	ids := make([]C.int, len(items))
+	values := make([]*C.char, len(items))
+	status := make([]C.int, len(items))
+	for i, item := range items {
+		ids[i] = C.int(item)
+	}
+	dones := make([]func(C.int) C.int, len(items))
+	for i, item := range items {
+		dones[i] = t.callHooks(EventCall, "get_item", item)
+	}
+	C.get_items(t.handle, C.int(len(items)), &ids[0], &values[0], &status[0])
+	for i, done := range dones {
+		done(status[i])
+	}
+	res := make(map[Item]string, len(items))
+	for i, item := range items {
+		if status[i] == C.PAM_SUCCESS {
+			res[item] = C.GoString(values[i])
+		}
+	}
+	return res, errors.Join(append(errs, t.itemsResult(items, status))...)
+}
+
+// stringItems returns the string items, and the failures of the others.
+func stringItems(items []Item) ([]Item, []error) {
+	var errs []error
+	res := make([]Item, 0, len(items))
+	for _, item := range items {
+		if err := checkStringItem(item); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		res = append(res, item)
+	}
+	return res, errs
+}
+
+// readableItems returns the string items readable by the application, and
+// the failures of the others.
+func readableItems(items []Item) ([]Item, []error) {
+	items, errs := stringItems(items)
+	res := items[:0]
+	for _, item := range items {
+		if err := checkReadableItem(item); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		res = append(res, item)
+	}
+	return res, errs
+}
+
+// itemsResult records the status of the last failed item, or success, and
+// returns the failures of the items.
+func (t *Transaction) itemsResult(items []Item, status []C.int) error {
+	var errs []error
+	last := C.int(C.PAM_SUCCESS)
+	for i, s := range status {
+		if s != C.PAM_SUCCESS {
+			last = s
+			errs = append(errs, fmt.Errorf("%v: %w", items[i], ReturnType(s)))
+		}
+	}
+	t.result(last)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,116 @@
+package pam
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestItems(t *testing.T) {
+	tx, err := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+
+	err = tx.SetItems(map[Item]string{
+		Tty:        "tty1",
+		Rhost:      "localhost",
+		Ruser:      "remote",
+		UserPrompt: "who? ",
+	})
+	if err != nil {
+		t.Fatalf("setitems #error: %v", err)
+	}
+	items, err := tx.GetItems([]Item{Service, User, Tty, Rhost, Ruser, UserPrompt})
+	if err != nil {
+		t.Fatalf("getitems #error: %v", err)
+	}
+	expected := map[Item]string{
+		Service:    "passwd",
+		User:       "test",
+		Tty:        "tty1",
+		Rhost:      "localhost",
+		Ruser:      "remote",
+		UserPrompt: "who? ",
+	}
+	for item, value := range expected {
+		if items[item] != value {
+			t.Fatalf("getitems #error: expected %s %q, got %q", item, value, items[item])
+		}
+	}
+
+	err = tx.SetItems(map[Item]string{Tty: "tty2", Item(-1): "bad"})
+	if !errors.Is(err, ErrBadItem) {
+		t.Fatalf("setitems #error: expected %v, got %v", ErrBadItem, err)
+	}
+	if tx.Status() != ErrBadItem {
+		t.Fatalf("status #error: %v", tx.Status())
+	}
+	items, err = tx.GetItems([]Item{Tty, Item(-1)})
+	if !errors.Is(err, ErrBadItem) {
+		t.Fatalf("getitems #error: expected %v, got %v", ErrBadItem, err)
+	}
+	if items[Tty] != "tty2" {
+		t.Fatalf("getitems #error: expected tty2, got %q", items[Tty])
+	}
+	if _, ok := items[Item(-1)]; ok {
+		t.Fatalf("getitems #error: unexpected value for a bad item")
+	}
+}
+
+func TestItems_Typed(t *testing.T) {
+	tx, err := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+
+	if user, err := tx.GetUserItem(); err != nil || user != "test" {
+		t.Fatalf("getuseritem #error: expected test, got %q, %v", user, err)
+	}
+	if err := tx.SetRHost("localhost"); err != nil {
+		t.Fatalf("setrhost #error: %v", err)
+	}
+	if err := tx.SetTTY("tty1"); err != nil {
+		t.Fatalf("settty #error: %v", err)
+	}
+	if err := tx.SetUserPrompt("who? "); err != nil {
+		t.Fatalf("setuserprompt #error: %v", err)
+	}
+	items, err := tx.GetItems([]Item{Rhost, Tty, UserPrompt})
+	if err != nil {
+		t.Fatalf("getitems #error: %v", err)
+	}
+	if items[Rhost] != "localhost" || items[Tty] != "tty1" || items[UserPrompt] != "who? " {
+		t.Fatalf("getitems #error: unexpected items %v", items)
+	}
+	if err := tx.SetTTY("tty2\x00tty3"); !errors.Is(err, ErrBadItem) {
+		t.Fatalf("settty #error: expected %v, got %v", ErrBadItem, err)
+	}
+	if tty, _ := tx.GetItem(Tty); tty != "tty1" {
+		t.Fatalf("settty #error: expected tty1 to be kept, got %q", tty)
+	}
+
+	if _, err := tx.GetAuthtokItem(); !errors.Is(err, ErrBadItem) {
+		t.Fatalf("getauthtokitem #error: expected %v, got %v", ErrBadItem, err)
+	}
+	for _, item := range []Item{Authtok, Oldauthtok} {
+		if _, err := tx.GetItem(item); !errors.Is(err, ErrBadItem) {
+			t.Fatalf("getitem #error: expected %v for %v, got %v", ErrBadItem, item, err)
+		}
+		if _, err := tx.GetItemSecure(item); !errors.Is(err, ErrBadItem) {
+			t.Fatalf("getitemsecure #error: expected %v for %v, got %v", ErrBadItem, item, err)
+		}
+	}
+	items, err = tx.GetItems([]Item{Tty, Authtok})
+	if !errors.Is(err, ErrBadItem) || items[Tty] != "tty1" {
+		t.Fatalf("getitems #error: expected tty1 and %v, got %v, %v", ErrBadItem, items, err)
+	}
+	if _, ok := items[Authtok]; ok {
+		t.Fatalf("getitems #error: unexpected authentication token")
+	}
+}
@@ -0,0 +1,171 @@
+package pam
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ConversationMiddleware wraps a conversation handler to add a behavior to
+// its responses, such as recording them.
+type ConversationMiddleware func(next ConversationHandler) ConversationHandler
+
+// wrappedHandler is a handler wrapped by middlewares, still responding to
+// the binary prompts with the handler it wraps.
+type wrappedHandler struct {
+	ConversationHandler
+	binary BinaryConversationHandler
+}
+
+// RespondPAMBinary calls the wrapped handler.
+func (h wrappedHandler) RespondPAMBinary(ptr BinaryPointer) ([]byte, error) {
+	return h.binary.RespondPAMBinary(ptr)
+}
+
+// WrapConversation returns the handler wrapped by the middlewares, the
+// first one being the outermost. The middlewares get the text messages one
+// at a time, even if the handler implements ConversationMultiHandler, while
+// the binary prompts go straight to the handler, if it implements
+// BinaryConversationHandler.
+func WrapConversation(handler ConversationHandler, middlewares ...ConversationMiddleware) ConversationHandler {
+	h := handler
+	for _, m := range slices.Backward(middlewares) {
+		h = m(h)
+	}
+	if binary, ok := handler.(BinaryConversationHandler); ok {
+		return wrappedHandler{h, binary}
+	}
+	return h
+}
+
+// ErrPromptTimeout is the failure of the handlers wrapped by PromptTimeout
+// not responding in time.
+var ErrPromptTimeout = errors.New("pam: prompt timed out")
+
+// PromptTimeout returns a middleware failing with ErrPromptTimeout if the
+// handler doesn't respond to a message within d. The handler keeps running
+// in the background until it returns, its response being discarded.
+func PromptTimeout(d time.Duration) ConversationMiddleware {
+	return func(next ConversationHandler) ConversationHandler {
+		return ConversationFunc(func(s Style, msg string) (string, error) {
+			type result struct {
+				resp string
+				err  error
+			}
+			done := make(chan result, 1)
+			go func() {
+				resp, err := next.RespondPAM(s, msg)
+				done <- result{resp, err}
+			}()
+			timer := time.NewTimer(d)
+			defer timer.Stop()
+			select {
+			case r := <-done:
+				return r.resp, r.err
+			case <-timer.C:
+				return "", ErrPromptTimeout
+			}
+		})
+	}
+}
+
+// MeasureConversation returns a middleware calling observe once the handler
+// has responded to each message, with how long it took and its failure, if
+// any, for example to export them as metrics.
+func MeasureConversation(observe func(s Style, d time.Duration, err error)) ConversationMiddleware {
+	return func(next ConversationHandler) ConversationHandler {
+		return ConversationFunc(func(s Style, msg string) (string, error) {
+			start := time.Now()
+			resp, err := next.RespondPAM(s, msg)
+			observe(s, time.Since(start), err)
+			return resp, err
+		})
+	}
+}
+
+// TranscriptEntry is a message of a conversation with its response.
+type TranscriptEntry struct {
+	Style    Style
+	Message  string
+	Response string
+	// Err is the failure of the handler, if any.
+	Err error
+	// Duration is how long the handler took to respond.
+	Duration time.Duration
+}
+
+// Transcript records the conversations of the handlers wrapped by its
+// Record middleware, such as to debug the authentications or to compare
+// them with golden files. It can be used by multiple goroutines at the
+// same time.
+type Transcript struct {
+	// Redact returns the entry as recorded. If nil, the responses to the
+	// PromptEchoOff messages are replaced with "[redacted]".
+	Redact func(TranscriptEntry) TranscriptEntry
+
+	mu      sync.Mutex
+	entries []TranscriptEntry
+}
+
+// redactSecrets is the default redaction of the transcripts.
+func redactSecrets(e TranscriptEntry) TranscriptEntry {
+	if e.Style == PromptEchoOff {
+		e.Response = "[redacted]"
+	}
+	return e
+}
+
+// Record returns a middleware recording the messages and the responses of
+// the handler in the transcript.
+func (t *Transcript) Record() ConversationMiddleware {
+	return func(next ConversationHandler) ConversationHandler {
+		return ConversationFunc(func(s Style, msg string) (string, error) {
+			start := time.Now()
+			resp, err := next.RespondPAM(s, msg)
+			t.add(TranscriptEntry{s, msg, resp, err, time.Since(start)})
+			return resp, err
+		})
+	}
+}
+
+func (t *Transcript) add(e TranscriptEntry) {
+	redact := t.Redact
+	if redact == nil {
+		redact = redactSecrets
+	}
+	e = redact(e)
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.entries = append(t.entries, e)
+}
+
+// Entries returns the entries recorded, in order.
+func (t *Transcript) Entries() []TranscriptEntry {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return slices.Clone(t.entries)
+}
+
+// String returns the entries recorded, one by line, without their
+// durations so that it can be compared with golden files:
+//
+//	PAM_PROMPT_ECHO_ON "login: " = "alice"
+//	PAM_PROMPT_ECHO_OFF "Password: " = "[redacted]"
+//	PAM_TEXT_INFO "Welcome" ! no terminal
+func (t *Transcript) String() string {
+	var b strings.Builder
+	for _, e := range t.Entries() {
+		fmt.Fprintf(&b, "%v %q", e.Style, e.Message)
+		switch {
+		case e.Err != nil:
+			fmt.Fprintf(&b, " ! %v", e.Err)
+		case e.Style == PromptEchoOn || e.Style == PromptEchoOff || e.Style == RadioType:
+			fmt.Fprintf(&b, " = %q", e.Response)
+		}
+		b.WriteByte('\n')
+	}
+	return b.String()
+}
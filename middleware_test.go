@@ -0,0 +1,134 @@
+package pam
+
+import (
+	"errors"
+	"os/user"
+	"testing"
+	"time"
+)
+
+func TestWrapConversation(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	var order []string
+	trace := func(name string) ConversationMiddleware {
+		return func(next ConversationHandler) ConversationHandler {
+			return ConversationFunc(func(s Style, msg string) (string, error) {
+				order = append(order, name)
+				return next.RespondPAM(s, msg)
+			})
+		}
+	}
+	var measured []Style
+	transcript := &Transcript{}
+	base := ConversationFunc(func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	handler := WrapConversation(base, trace("outer"), transcript.Record(),
+		MeasureConversation(func(s Style, d time.Duration, err error) {
+			measured = append(measured, s)
+		}), trace("inner"))
+	tx, err := StartConfDir("echo-service", u.Username, handler, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if len(order) != 2 || order[0] != "outer" || order[1] != "inner" {
+		t.Fatalf("wrap #error: unexpected order %v", order)
+	}
+	if len(measured) != 1 || measured[0] != TextInfo {
+		t.Fatalf("measure #error: unexpected styles %v", measured)
+	}
+	expected := `PAM_TEXT_INFO "This is an info message for user ` + u.Username + ` on echo-service"` + "\n"
+	if s := transcript.String(); s != expected {
+		t.Fatalf("transcript #error: expected %q, got %q", expected, s)
+	}
+}
+
+func TestWrapConversation_Binary(t *testing.T) {
+	if _, ok := WrapConversation(Credentials{}).(BinaryConversationHandler); ok {
+		t.Fatalf("wrap #error: unexpected binary handler")
+	}
+	h, ok := WrapConversation(ChoiceHandler{
+		ConversationHandler: Credentials{},
+		Choose:              func(l ChoiceList) (string, error) { return l.Choices[0].Value, nil },
+	}, PromptTimeout(time.Second)).(BinaryConversationHandler)
+	if !ok {
+		t.Fatalf("wrap #error: expected a binary handler")
+	}
+	req, err := testChoices.EncodeRequest()
+	if err != nil {
+		t.Fatalf("encode #error: %v", err)
+	}
+	if _, err := h.RespondPAMBinary(BinaryPointer(&req[0])); err != nil {
+		t.Fatalf("respondpambinary #error: %v", err)
+	}
+}
+
+func TestTranscript(t *testing.T) {
+	failure := errors.New("no terminal")
+	base := ConversationFunc(func(s Style, msg string) (string, error) {
+		switch s {
+		case PromptEchoOn:
+			return "alice", nil
+		case PromptEchoOff:
+			return "secret", nil
+		case ErrorMsg:
+			return "", failure
+		}
+		return "", nil
+	})
+	transcript := &Transcript{}
+	h := WrapConversation(base, transcript.Record())
+	for _, m := range []ConversationMessage{
+		{PromptEchoOn, "login: "}, {PromptEchoOff, "Password: "},
+		{TextInfo, "Welcome"}, {ErrorMsg, "Denied"},
+	} {
+		h.RespondPAM(m.Style, m.Message)
+	}
+	expected := `PAM_PROMPT_ECHO_ON "login: " = "alice"
+PAM_PROMPT_ECHO_OFF "Password: " = "[redacted]"
+PAM_TEXT_INFO "Welcome"
+PAM_ERROR_MSG "Denied" ! no terminal
+`
+	if s := transcript.String(); s != expected {
+		t.Fatalf("transcript #error: expected %q, got %q", expected, s)
+	}
+	if e := transcript.Entries(); len(e) != 4 || e[3].Err != failure {
+		t.Fatalf("transcript #error: unexpected entries %v", e)
+	}
+
+	transcript = &Transcript{Redact: func(e TranscriptEntry) TranscriptEntry {
+		e.Message, e.Response = "-", "-"
+		return e
+	}}
+	h = WrapConversation(base, transcript.Record())
+	if r, err := h.RespondPAM(PromptEchoOn, "login: "); r != "alice" || err != nil {
+		t.Fatalf("respondpam #error: unexpected response %q, %v", r, err)
+	}
+	if s := transcript.String(); s != "PAM_PROMPT_ECHO_ON \"-\" = \"-\"\n" {
+		t.Fatalf("transcript #error: unexpected transcript %q", s)
+	}
+}
+
+func TestPromptTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	h := WrapConversation(ConversationFunc(func(s Style, msg string) (string, error) {
+		if s == PromptEchoOn {
+			<-release
+		}
+		return "ok", nil
+	}), PromptTimeout(10*time.Millisecond))
+	if _, err := h.RespondPAM(PromptEchoOn, "login: "); !errors.Is(err, ErrPromptTimeout) {
+		t.Fatalf("respondpam #error: expected %v, got %v", ErrPromptTimeout, err)
+	}
+	if r, err := h.RespondPAM(TextInfo, "Welcome"); r != "ok" || err != nil {
+		t.Fatalf("respondpam #error: unexpected response %q, %v", r, err)
+	}
+}
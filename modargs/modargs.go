@@ -0,0 +1,266 @@
+// Package modargs decodes the arguments of the modules written in Go, as
+// given after their name in the PAM service files, into the fields of a
+// struct, rather than splitting them by hand in every module:
+//
+//	type options struct {
+//		Debug        bool
+//		UseFirstPass bool
+//		Retries      int           `pam:"retries,default=1"`
+//		Server       string        `pam:"server,required"`
+//		Timeout      time.Duration `pam:"timeout,default=5s"`
+//	}
+//
+//	var opts options
+//	if err := modargs.Decode(args, &opts); err != nil {
+//		return err
+//	}
+//
+// decodes "debug use_first_pass retries=3 server=ldap.example.com".
+//
+// The arguments are named by the pam tag of the fields, or by their names
+// in snake case, UseFirstPass becoming use_first_pass. The tag options are
+// default=value, the value of the arguments not given, which can't contain
+// commas, and required. Fields tagged "-" and unexported fields are
+// ignored.
+//
+// The boolean arguments can be given without value, which means true. The
+// other fields can be strings, integers, floating point numbers,
+// time.Duration, types implementing encoding.TextUnmarshaler, or slices of
+// them, which the arguments given more than once are appended to.
+package modargs
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/msteinert/pam"
+)
+
+// ErrInvalid is returned for the arguments which can't be decoded, such as
+// the unknown or malformed ones. It wraps pam.ErrService, as the modules
+// usually fail with a misconfigured service.
+var ErrInvalid = fmt.Errorf("%w: invalid module argument", pam.ErrService)
+
+// Decoder decodes the arguments of the modules. Its zero value fails on the
+// unknown arguments.
+type Decoder struct {
+	// Unknown, if not nil, is called with each unknown argument, which
+	// is then ignored, for example to log it as the stock modules do.
+	// Otherwise the unknown arguments fail with ErrInvalid.
+	Unknown func(arg string)
+}
+
+// Decode decodes args into the struct v points to, failing on the unknown
+// arguments.
+func Decode(args []string, v any) error {
+	return Decoder{}.Decode(args, v)
+}
+
+var (
+	durationType        = reflect.TypeFor[time.Duration]()
+	textUnmarshalerType = reflect.TypeFor[encoding.TextUnmarshaler]()
+)
+
+// field is a field of the struct decoded into.
+type field struct {
+	name     string
+	value    reflect.Value
+	def      *string
+	required bool
+	set      bool
+}
+
+// Decode decodes args into the struct v points to. The fields of the
+// arguments not given are set to their default, if any, and left
+// unchanged otherwise.
+func (d Decoder) Decode(args []string, v any) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("modargs: expected a pointer to a struct, got %T", v)
+	}
+	fields, err := structFields(rv.Elem())
+	if err != nil {
+		return err
+	}
+	var errs []error
+	for _, arg := range args {
+		name, value, hasValue := strings.Cut(arg, "=")
+		f, ok := fields[name]
+		if !ok {
+			if d.Unknown != nil {
+				d.Unknown(arg)
+				continue
+			}
+			errs = append(errs, fmt.Errorf("%w: unknown argument %q", ErrInvalid, arg))
+			continue
+		}
+		if !hasValue {
+			if !isBool(f.value) {
+				errs = append(errs, fmt.Errorf("%w: %s: missing value", ErrInvalid, name))
+				continue
+			}
+			value = "true"
+		}
+		// The arguments given more than once replace the previous
+		// ones, unless appended to slices.
+		if f.set && f.value.Kind() != reflect.Slice {
+			f.value.SetZero()
+		}
+		if err := set(f.value, value); err != nil {
+			errs = append(errs, fmt.Errorf("%w: %s: %v", ErrInvalid, name, err))
+			continue
+		}
+		f.set = true
+	}
+	for _, f := range fields {
+		switch {
+		case f.set:
+		case f.required:
+			errs = append(errs, fmt.Errorf("%w: %s: missing required argument", ErrInvalid, f.name))
+		case f.def != nil:
+			if err := set(f.value, *f.def); err != nil {
+				errs = append(errs, fmt.Errorf("modargs: %s: invalid default: %v", f.name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// structFields returns the fields of the struct by argument name.
+func structFields(v reflect.Value) (map[string]*field, error) {
+	fields := make(map[string]*field)
+	t := v.Type()
+	for i := range t.NumField() {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("pam")
+		if !sf.IsExported() || tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = snakeCase(sf.Name)
+		}
+		if !supported(sf.Type) {
+			return nil, fmt.Errorf("modargs: %s: unsupported type %v", sf.Name, sf.Type)
+		}
+		f := &field{name: name, value: v.Field(i)}
+		for opt := range strings.SplitSeq(opts, ",") {
+			switch key, value, _ := strings.Cut(opt, "="); key {
+			case "":
+			case "default":
+				f.def = &value
+			case "required":
+				f.required = true
+			default:
+				return nil, fmt.Errorf("modargs: %s: unknown tag option %q", sf.Name, opt)
+			}
+		}
+		if _, ok := fields[name]; ok {
+			return nil, fmt.Errorf("modargs: %s: duplicate argument %q", sf.Name, name)
+		}
+		fields[name] = f
+	}
+	return fields, nil
+}
+
+// snakeCase converts a Go name to snake case, such as UseFirstPass to
+// use_first_pass or TTYName to tty_name.
+func snakeCase(name string) string {
+	r := []rune(name)
+	var b strings.Builder
+	for i, c := range r {
+		if unicode.IsUpper(c) && i > 0 &&
+			(unicode.IsLower(r[i-1]) || i+1 < len(r) && unicode.IsLower(r[i+1])) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// supported returns whether the arguments can be decoded into t.
+func supported(t reflect.Type) bool {
+	if t.Implements(textUnmarshalerType) || reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return true
+	}
+	switch t.Kind() {
+	case reflect.Slice:
+		return t.Elem().Kind() != reflect.Slice && supported(t.Elem())
+	case reflect.String, reflect.Bool,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+	return false
+}
+
+// isBool returns whether the argument of v can be given without value.
+func isBool(v reflect.Value) bool {
+	k := v.Kind()
+	if k == reflect.Slice {
+		k = v.Type().Elem().Kind()
+	}
+	return k == reflect.Bool
+}
+
+// set decodes s into v, appending it to the slices.
+func set(v reflect.Value, s string) error {
+	if v.Kind() == reflect.Slice && !v.Type().Implements(textUnmarshalerType) &&
+		!reflect.PointerTo(v.Type()).Implements(textUnmarshalerType) {
+		elem := reflect.New(v.Type().Elem()).Elem()
+		if err := set(elem, s); err != nil {
+			return err
+		}
+		v.Set(reflect.Append(v, elem))
+		return nil
+	}
+	if v.CanAddr() {
+		if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(s))
+		}
+	}
+	if v.Type() == durationType {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 0, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(n)
+	}
+	return nil
+}
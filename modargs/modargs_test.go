@@ -0,0 +1,130 @@
+package modargs
+
+import (
+	"errors"
+	"net/netip"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+type options struct {
+	Debug        bool
+	UseFirstPass bool
+	Retries      int           `pam:"retries,default=1"`
+	Server       string        `pam:"server,required"`
+	Timeout      time.Duration `pam:",default=5s"`
+	Mask         uint16        `pam:"umask,default=0022"`
+	Groups       []string      `pam:"group"`
+	Addr         netip.Addr    `pam:"addr,default=127.0.0.1"`
+	TTYName      string
+	Ignored      string `pam:"-"`
+	unexported   string
+}
+
+func TestDecode(t *testing.T) {
+	var opts options
+	err := Decode([]string{"debug", "use_first_pass=false", "retries=3",
+		"server=foo=bar", "group=wheel", "group=adm", "tty_name=tty1",
+		"umask=077", "retries=0x10"}, &opts)
+	if err != nil {
+		t.Fatalf("decode #error: %v", err)
+	}
+	expected := options{
+		Debug:   true,
+		Retries: 16,
+		Server:  "foo=bar",
+		Timeout: 5 * time.Second,
+		Mask:    0o77,
+		Groups:  []string{"wheel", "adm"},
+		Addr:    netip.MustParseAddr("127.0.0.1"),
+		TTYName: "tty1",
+	}
+	if !reflect.DeepEqual(opts, expected) {
+		t.Fatalf("decode #error: expected %+v, got %+v", expected, opts)
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+	}{
+		{"unknown", []string{"server=foo", "nullok"}},
+		{"ignored", []string{"server=foo", "ignored=foo"}},
+		{"unexported", []string{"server=foo", "unexported=foo"}},
+		{"missing value", []string{"server"}},
+		{"missing required", []string{"debug"}},
+		{"invalid int", []string{"server=foo", "retries=many"}},
+		{"overflow", []string{"server=foo", "umask=0200000"}},
+		{"invalid bool", []string{"server=foo", "debug=maybe"}},
+		{"invalid duration", []string{"server=foo", "timeout=5"}},
+		{"invalid text", []string{"server=foo", "addr=localhost"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var opts options
+			err := Decode(tc.args, &opts)
+			if !errors.Is(err, ErrInvalid) || !errors.Is(err, pam.ErrService) {
+				t.Fatalf("decode #error: expected %v, got %v", ErrInvalid, err)
+			}
+		})
+	}
+}
+
+func TestDecoder_Unknown(t *testing.T) {
+	var unknown []string
+	d := Decoder{Unknown: func(arg string) { unknown = append(unknown, arg) }}
+	var opts options
+	if err := d.Decode([]string{"nullok", "server=foo", "try_first_pass=1"}, &opts); err != nil {
+		t.Fatalf("decode #error: %v", err)
+	}
+	if expected := []string{"nullok", "try_first_pass=1"}; !reflect.DeepEqual(unknown, expected) {
+		t.Fatalf("decode #error: expected unknown %v, got %v", expected, unknown)
+	}
+	if opts.Server != "foo" {
+		t.Fatalf("decode #error: unexpected options %+v", opts)
+	}
+}
+
+func TestDecode_InvalidStruct(t *testing.T) {
+	var opts options
+	for _, v := range []any{nil, opts, new(int), (*options)(nil)} {
+		if err := Decode(nil, v); err == nil || errors.Is(err, ErrInvalid) {
+			t.Fatalf("decode #error: %T: unexpected error %v", v, err)
+		}
+	}
+	for _, v := range []any{
+		&struct {
+			A string `pam:"a,optional"`
+		}{},
+		&struct {
+			A string `pam:"a"`
+			B string `pam:"a"`
+		}{},
+		&struct{ C chan int }{},
+		&struct{ S [][]string }{},
+		&struct {
+			N int `pam:"n,default=x"`
+		}{},
+	} {
+		if err := Decode(nil, v); err == nil || errors.Is(err, ErrInvalid) {
+			t.Fatalf("decode #error: %T: unexpected error %v", v, err)
+		}
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	for name, expected := range map[string]string{
+		"Debug":        "debug",
+		"UseFirstPass": "use_first_pass",
+		"TTYName":      "tty_name",
+		"UserID":       "user_id",
+	} {
+		if s := snakeCase(name); s != expected {
+			t.Fatalf("snakecase #error: %s: expected %s, got %s", name, expected, s)
+		}
+	}
+}
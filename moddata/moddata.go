@@ -0,0 +1,131 @@
+// Package moddata serializes the values kept by the modules written in Go,
+// as the data of their transactions or sent to their helper processes, with
+// the name and the version of their schema: the values written by older
+// versions of a module are migrated to the current one when read, rather
+// than failing or being silently misread.
+//
+// The values are encoded as JSON envelopes:
+//
+//	{"schema":"example.com/pam_example/state","version":2,"data":{...}}
+package moddata
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// MaxSize is the maximum size of the framed values read by Decode.
+const MaxSize = 1 << 20
+
+// ErrSchema is returned when decoding a value of another schema.
+var ErrSchema = errors.New("unexpected schema")
+
+// ErrVersion is returned when decoding a value of a version which can't be
+// migrated to the current one, such as a newer one.
+var ErrVersion = errors.New("unsupported schema version")
+
+// Migration upgrades the JSON data of a version to the following one.
+type Migration func(data json.RawMessage) (json.RawMessage, error)
+
+// Codec encodes and decodes the values of T.
+type Codec[T any] struct {
+	// Schema names the schema of the values, such as the import path of
+	// the module followed by the name of the type.
+	Schema string
+	// Version is the current version of the schema, starting from 1.
+	Version int
+	// Migrations upgrade the data of the older versions, by the version
+	// they upgrade from: Migrations[1] upgrades the version 1 to the
+	// version 2. The values of the versions without a chain of migrations
+	// to the current one can't be decoded.
+	Migrations map[int]Migration
+}
+
+type envelope struct {
+	Schema  string          `json:"schema"`
+	Version int             `json:"version"`
+	Data    json.RawMessage `json:"data"`
+}
+
+func (c *Codec[T]) version() int {
+	return max(c.Version, 1)
+}
+
+// Marshal encodes v with the current version of the schema.
+func (c *Codec[T]) Marshal(v T) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(envelope{c.Schema, c.version(), data})
+}
+
+// Unmarshal decodes a value encoded by Marshal, with the current version of
+// the schema or migrated from an older one.
+func (c *Codec[T]) Unmarshal(b []byte) (T, error) {
+	var v T
+	var e envelope
+	if err := json.Unmarshal(b, &e); err != nil {
+		return v, err
+	}
+	if e.Schema != c.Schema {
+		return v, fmt.Errorf("%w %q, expected %q", ErrSchema, e.Schema, c.Schema)
+	}
+	if e.Version < 1 || e.Version > c.version() {
+		return v, fmt.Errorf("%w %d of %q", ErrVersion, e.Version, c.Schema)
+	}
+	data := e.Data
+	for ver := e.Version; ver < c.version(); ver++ {
+		m := c.Migrations[ver]
+		if m == nil {
+			return v, fmt.Errorf("%w %d of %q: no migration to version %d", ErrVersion, ver, c.Schema, ver+1)
+		}
+		var err error
+		if data, err = m(data); err != nil {
+			return v, fmt.Errorf("migrating %q from version %d: %w", c.Schema, ver, err)
+		}
+	}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return v, err
+	}
+	return v, nil
+}
+
+// Encode writes v to w, preceded by its size as 4 bytes big endian, for
+// the streams shared with the helper processes.
+func (c *Codec[T]) Encode(w io.Writer, v T) error {
+	b, err := c.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if len(b) > MaxSize {
+		return fmt.Errorf("value of %d bytes too large", len(b))
+	}
+	frame := binary.BigEndian.AppendUint32(make([]byte, 0, 4+len(b)), uint32(len(b)))
+	_, err = w.Write(append(frame, b...))
+	return err
+}
+
+// Decode reads a value written by Encode from r.
+func (c *Codec[T]) Decode(r io.Reader) (T, error) {
+	var v T
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return v, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > MaxSize {
+		return v, fmt.Errorf("value of %d bytes too large", n)
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return v, err
+	}
+	return c.Unmarshal(b)
+}
@@ -0,0 +1,94 @@
+package moddata
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"testing"
+)
+
+type stateV1 struct {
+	User  string `json:"user"`
+	Tries int    `json:"tries"`
+}
+
+type state struct {
+	User     string `json:"user"`
+	Failures int    `json:"failures"`
+	Locked   bool   `json:"locked"`
+}
+
+var codec = &Codec[state]{
+	Schema:  "example.com/pam_example/state",
+	Version: 2,
+	Migrations: map[int]Migration{
+		1: func(data json.RawMessage) (json.RawMessage, error) {
+			var old stateV1
+			if err := json.Unmarshal(data, &old); err != nil {
+				return nil, err
+			}
+			return json.Marshal(state{User: old.User, Failures: old.Tries, Locked: old.Tries >= 3})
+		},
+	},
+}
+
+func TestCodec(t *testing.T) {
+	s := state{User: "alice", Failures: 1}
+	b, err := codec.Marshal(s)
+	if err != nil {
+		t.Fatalf("marshal #error: %v", err)
+	}
+	if expected := `{"schema":"example.com/pam_example/state","version":2,"data":{"user":"alice","failures":1,"locked":false}}`; string(b) != expected {
+		t.Fatalf("marshal #error: expected %s, got %s", expected, b)
+	}
+	if v, err := codec.Unmarshal(b); err != nil || v != s {
+		t.Fatalf("unmarshal #error: expected %+v, got %+v, %v", s, v, err)
+	}
+
+	old := &Codec[stateV1]{Schema: codec.Schema, Version: 1}
+	b, _ = old.Marshal(stateV1{User: "bob", Tries: 3})
+	if v, err := codec.Unmarshal(b); err != nil || v != (state{User: "bob", Failures: 3, Locked: true}) {
+		t.Fatalf("unmarshal #error: unexpected migration %+v, %v", v, err)
+	}
+
+	for _, tt := range []struct {
+		data string
+		err  error
+	}{
+		{`{"schema":"other","version":1,"data":{}}`, ErrSchema},
+		{`{"schema":"example.com/pam_example/state","version":3,"data":{}}`, ErrVersion},
+		{`{"schema":"example.com/pam_example/state","version":0,"data":{}}`, ErrVersion},
+	} {
+		if _, err := codec.Unmarshal([]byte(tt.data)); !errors.Is(err, tt.err) {
+			t.Fatalf("unmarshal #error: %s: expected %v, got %v", tt.data, tt.err, err)
+		}
+	}
+	noMigration := &Codec[state]{Schema: codec.Schema, Version: 3}
+	if _, err := noMigration.Unmarshal(b); !errors.Is(err, ErrVersion) {
+		t.Fatalf("unmarshal #error: expected %v, got %v", ErrVersion, err)
+	}
+}
+
+func TestCodec_Stream(t *testing.T) {
+	var buf bytes.Buffer
+	for _, s := range []state{{User: "alice"}, {User: "bob", Failures: 2}} {
+		if err := codec.Encode(&buf, s); err != nil {
+			t.Fatalf("encode #error: %v", err)
+		}
+	}
+	for _, expected := range []string{"alice", "bob"} {
+		if v, err := codec.Decode(&buf); err != nil || v.User != expected {
+			t.Fatalf("decode #error: expected %s, got %+v, %v", expected, v, err)
+		}
+	}
+	if _, err := codec.Decode(&buf); err != io.EOF {
+		t.Fatalf("decode #error: expected %v, got %v", io.EOF, err)
+	}
+	if _, err := codec.Decode(bytes.NewReader([]byte{0, 0, 0, 10, '{'})); err != io.ErrUnexpectedEOF {
+		t.Fatalf("decode #error: expected %v, got %v", io.ErrUnexpectedEOF, err)
+	}
+	if _, err := codec.Decode(bytes.NewReader([]byte{0xff, 0, 0, 0})); err == nil {
+		t.Fatalf("decode #error: expected a failure")
+	}
+}
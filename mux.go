@@ -0,0 +1,92 @@
+package pam
+
+import (
+	"fmt"
+	"io"
+	"os"
+)
+
+// BinaryHandler responds to the binary prompts, see
+// BinaryConversationHandler.
+type BinaryHandler interface {
+	RespondPAMBinary(BinaryPointer) ([]byte, error)
+}
+
+// BinaryHandlerFunc is an adapter to allow the use of ordinary functions as
+// binary handlers.
+type BinaryHandlerFunc func(BinaryPointer) ([]byte, error)
+
+// RespondPAMBinary calls f.
+func (f BinaryHandlerFunc) RespondPAMBinary(ptr BinaryPointer) ([]byte, error) {
+	return f(ptr)
+}
+
+// ConversationMux is a conversation handler routing the messages to the
+// handlers registered for their styles, rather than switching over them in
+// a single handler. Its zero value writes the TextInfo messages to the
+// standard output and the ErrorMsg ones to the standard error, and fails
+// the prompts and the binary prompts until their handlers are registered.
+// The handlers must be registered before the mux is used.
+type ConversationMux struct {
+	prompt ConversationHandler
+	info   io.Writer
+	err    io.Writer
+	binary BinaryHandler
+}
+
+// HandlePrompt registers the handler of the prompts: the PromptEchoOff,
+// PromptEchoOn and RadioType messages.
+func (m *ConversationMux) HandlePrompt(h ConversationHandler) {
+	m.prompt = h
+}
+
+// HandleInfo writes the TextInfo messages to w, one by line, discarding
+// them if w is io.Discard.
+func (m *ConversationMux) HandleInfo(w io.Writer) {
+	m.info = w
+}
+
+// HandleError writes the ErrorMsg messages to w, one by line.
+func (m *ConversationMux) HandleError(w io.Writer) {
+	m.err = w
+}
+
+// HandleBinary registers the handler of the binary prompts, such as a
+// ChoiceHandler.
+func (m *ConversationMux) HandleBinary(h BinaryHandler) {
+	m.binary = h
+}
+
+// RespondPAM routes the message to the handler of its style.
+func (m *ConversationMux) RespondPAM(s Style, msg string) (string, error) {
+	switch s {
+	case PromptEchoOff, PromptEchoOn, RadioType:
+		if m.prompt == nil {
+			return "", fmt.Errorf("no handler for the %v messages", s)
+		}
+		return m.prompt.RespondPAM(s, msg)
+	case TextInfo:
+		return "", writeMessage(m.info, os.Stdout, msg)
+	case ErrorMsg:
+		return "", writeMessage(m.err, os.Stderr, msg)
+	default:
+		return "", fmt.Errorf("unexpected message style %v", s)
+	}
+}
+
+// RespondPAMBinary routes the binary prompt to its handler.
+func (m *ConversationMux) RespondPAMBinary(ptr BinaryPointer) ([]byte, error) {
+	if m.binary == nil {
+		return nil, errBinaryUnsupported
+	}
+	return m.binary.RespondPAMBinary(ptr)
+}
+
+// writeMessage writes msg on a line to w, or to def if w is nil.
+func writeMessage(w, def io.Writer, msg string) error {
+	if w == nil {
+		w = def
+	}
+	_, err := fmt.Fprintln(w, msg)
+	return err
+}
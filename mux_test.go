@@ -0,0 +1,102 @@
+package pam
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestConversationMux(t *testing.T) {
+	var m ConversationMux
+	if _, err := m.RespondPAM(PromptEchoOff, "Password: "); err == nil {
+		t.Fatalf("respond #expected an error without prompt handler")
+	}
+	if _, err := m.RespondPAMBinary(nil); !errors.Is(err, errBinaryUnsupported) {
+		t.Fatalf("respond #error: expected %v, got %v", errBinaryUnsupported, err)
+	}
+	var info, errs bytes.Buffer
+	m.HandleInfo(&info)
+	m.HandleError(&errs)
+	m.HandlePrompt(ConversationFunc(func(s Style, msg string) (string, error) {
+		return s.String() + " " + msg, nil
+	}))
+	m.HandleBinary(BinaryHandlerFunc(func(BinaryPointer) ([]byte, error) {
+		return []byte("binary"), nil
+	}))
+	messages := []ConversationMessage{
+		{TextInfo, "Welcome"},
+		{PromptEchoOn, "login:"},
+		{ErrorMsg, "Caps Lock is on"},
+		{PromptEchoOff, "Password:"},
+		{RadioType, "Push?"},
+	}
+	var responses []string
+	for _, msg := range messages {
+		r, err := m.RespondPAM(msg.Style, msg.Message)
+		if err != nil {
+			t.Fatalf("respond #error: %v", err)
+		}
+		responses = append(responses, r)
+	}
+	expected := []string{"", "PAM_PROMPT_ECHO_ON login:", "", "PAM_PROMPT_ECHO_OFF Password:", "PAM_RADIO_TYPE Push?"}
+	for i := range expected {
+		if responses[i] != expected[i] {
+			t.Fatalf("respond #error: expected %q, got %q", expected[i], responses[i])
+		}
+	}
+	if info.String() != "Welcome\n" || errs.String() != "Caps Lock is on\n" {
+		t.Fatalf("respond #error: unexpected messages %q, %q", info.String(), errs.String())
+	}
+	if r, err := m.RespondPAMBinary(nil); err != nil || string(r) != "binary" {
+		t.Fatalf("respond #error: unexpected binary response %q, %v", r, err)
+	}
+	if _, err := m.RespondPAM(BinaryPrompt, ""); err == nil {
+		t.Fatalf("respond #expected an error for a binary prompt as text")
+	}
+	m.HandleInfo(io.Discard)
+	if _, err := m.RespondPAM(TextInfo, "discarded"); err != nil || info.Len() != len("Welcome\n") {
+		t.Fatalf("respond #error: unexpected info %q, %v", info.String(), err)
+	}
+}
+
+func TestConversationMux_Transaction(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	var info bytes.Buffer
+	m := &ConversationMux{}
+	m.HandleInfo(&info)
+	m.HandlePrompt(ConversationFunc(func(s Style, msg string) (string, error) {
+		return "alice", nil
+	}))
+	m.HandleBinary(ChoiceHandler{Choose: func(l ChoiceList) (string, error) {
+		return l.Choices[0].Value, nil
+	}})
+	tx, err := StartConfDir("echo-service", "", m, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	req, err := testChoices.EncodeRequest()
+	if err != nil {
+		t.Fatalf("encode #error: %v", err)
+	}
+	r, err := tx.converse([]ConversationMessage{
+		{TextInfo, "Welcome"},
+		{PromptEchoOn, "login:"},
+		{BinaryPrompt, string(req)},
+	})
+	if err != nil {
+		t.Fatalf("converse #error: %v", err)
+	}
+	if r[1] != "alice" {
+		t.Fatalf("converse #error: unexpected response %q", r[1])
+	}
+	if v, err := testChoices.ParseResponse([]byte(r[2])); err != nil || v != testChoices.Choices[0].Value {
+		t.Fatalf("converse #error: unexpected choice %q, %v", v, err)
+	}
+	if info.String() != "Welcome\n" {
+		t.Fatalf("converse #error: unexpected messages %q", info.String())
+	}
+}
@@ -0,0 +1,350 @@
+//go:build !cgo
+
+package pam
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+	"unsafe"
+)
+
+// The constants have the values of Linux-PAM, see their documentation in
+// the cgo build.
+
+// Coversation handler style types.
+const (
+	PromptEchoOff Style = 1
+	PromptEchoOn  Style = 2
+	ErrorMsg      Style = 3
+	TextInfo      Style = 4
+	RadioType     Style = 5
+	BinaryPrompt  Style = 7
+)
+
+// PAM return types.
+const (
+	Success                ReturnType = 0
+	ErrOpen                ReturnType = 1
+	ErrSymbol              ReturnType = 2
+	ErrService             ReturnType = 3
+	ErrSystem              ReturnType = 4
+	ErrBuf                 ReturnType = 5
+	ErrPermDenied          ReturnType = 6
+	ErrAuth                ReturnType = 7
+	ErrCredInsufficient    ReturnType = 8
+	ErrAuthinfoUnavail     ReturnType = 9
+	ErrUserUnknown         ReturnType = 10
+	ErrMaxtries            ReturnType = 11
+	ErrNewAuthtokReqd      ReturnType = 12
+	ErrAcctExpired         ReturnType = 13
+	ErrSession             ReturnType = 14
+	ErrCredUnavail         ReturnType = 15
+	ErrCredExpired         ReturnType = 16
+	ErrCred                ReturnType = 17
+	ErrNoModuleData        ReturnType = 18
+	ErrConv                ReturnType = 19
+	ErrAuthtok             ReturnType = 20
+	ErrAuthtokRecovery     ReturnType = 21
+	ErrAuthtokLockBusy     ReturnType = 22
+	ErrAuthtokDisableAging ReturnType = 23
+	ErrTryAgain            ReturnType = 24
+	ErrIgnore              ReturnType = 25
+	ErrAbort               ReturnType = 26
+	ErrAuthtokExpired      ReturnType = 27
+	ErrModuleUnknown       ReturnType = 28
+	ErrBadItem             ReturnType = 29
+	ErrConvAgain           ReturnType = 30
+	ErrIncomplete          ReturnType = 31
+)
+
+// returnTypeMessages are the messages of pam_strerror.
+var returnTypeMessages = [...]string{
+	Success:                "Success",
+	ErrOpen:                "Failed to load module",
+	ErrSymbol:              "Symbol not found",
+	ErrService:             "Error in service module",
+	ErrSystem:              "System error",
+	ErrBuf:                 "Memory buffer error",
+	ErrPermDenied:          "Permission denied",
+	ErrAuth:                "Authentication failure",
+	ErrCredInsufficient:    "Insufficient credentials to access authentication data",
+	ErrAuthinfoUnavail:     "Authentication service cannot retrieve authentication info",
+	ErrUserUnknown:         "User not known to the underlying authentication module",
+	ErrMaxtries:            "Have exhausted maximum number of retries for service",
+	ErrNewAuthtokReqd:      "Authentication token is no longer valid; new one required",
+	ErrAcctExpired:         "User account has expired",
+	ErrSession:             "Cannot make/remove an entry for the specified session",
+	ErrCredUnavail:         "Authentication service cannot retrieve user credentials",
+	ErrCredExpired:         "User credentials expired",
+	ErrCred:                "Failure setting user credentials",
+	ErrNoModuleData:        "No module specific data is present",
+	ErrConv:                "Conversation error",
+	ErrAuthtok:             "Authentication token manipulation error",
+	ErrAuthtokRecovery:     "Authentication information cannot be recovered",
+	ErrAuthtokLockBusy:     "Authentication token lock busy",
+	ErrAuthtokDisableAging: "Authentication token aging disabled",
+	ErrTryAgain:            "Failed preliminary check by password service",
+	ErrIgnore:              "The return value should be ignored by PAM dispatch",
+	ErrAbort:               "Critical error - immediate abort",
+	ErrAuthtokExpired:      "Authentication token expired",
+	ErrModuleUnknown:       "Module is unknown",
+	ErrBadItem:             "Bad item passed to pam_*_item()",
+	ErrConvAgain:           "Conversation is waiting for event",
+	ErrIncomplete:          "Application needs to call libpam again",
+}
+
+// Error returns the PAM message of the return type, as Linux-PAM does.
+func (r ReturnType) Error() string {
+	if r < 0 || int(r) >= len(returnTypeMessages) {
+		return "Unknown PAM error"
+	}
+	return returnTypeMessages[r]
+}
+
+// PAM Item types.
+const (
+	Service     Item = 1
+	User        Item = 2
+	Tty         Item = 3
+	Rhost       Item = 4
+	Authtok     Item = 6
+	Oldauthtok  Item = 7
+	Ruser       Item = 8
+	UserPrompt  Item = 9
+	FailDelay   Item = 10
+	XDisplay    Item = 11
+	XAuthData   Item = 12
+	AuthtokType Item = 13
+)
+
+// PAM Flag types.
+const (
+	Silent               Flags = 0x8000
+	DisallowNullAuthtok  Flags = 0x1
+	EstablishCred        Flags = 0x2
+	DeleteCred           Flags = 0x4
+	ReinitializeCred     Flags = 0x8
+	RefreshCred          Flags = 0x10
+	ChangeExpiredAuthtok Flags = 0x20
+	DataSilent           Flags = 0x40000000
+	PrelimCheck          Flags = 0x4000
+	UpdateAuthtok        Flags = 0x2000
+)
+
+// Transaction is the application's handle for a PAM transaction, which
+// never starts without cgo.
+type Transaction struct {
+	// handle is always nil, as in the transactions ended.
+	handle       unsafe.Pointer
+	status       atomic.Int32
+	conversation *conversation
+	state        *transactionState
+	service      string
+	subscribers  *subscribers
+	labels       context.Context
+	session      atomic.Bool
+	cred         atomic.Bool
+	incomplete   *operation
+	// endStatus is always nil, as the transactions never start.
+	endStatus *atomic.Int32
+}
+
+// Start fails with ErrUnavailable.
+func Start(service, user string, handler ConversationHandler) (*Transaction, error) {
+	return nil, ErrUnavailable
+}
+
+// StartFunc fails with ErrUnavailable.
+func StartFunc(service, user string, handler func(Style, string) (string, error)) (*Transaction, error) {
+	return nil, ErrUnavailable
+}
+
+// StartConfDir fails with ErrUnavailable.
+func StartConfDir(service, user string, handler ConversationHandler, confDir string) (*Transaction, error) {
+	return nil, ErrUnavailable
+}
+
+func startConfDir(service string, handler ConversationHandler, o *startOptions) (*Transaction, error) {
+	return start(service, handler, o)
+}
+
+func start(service string, handler ConversationHandler, o *startOptions) (*Transaction, error) {
+	return nil, ErrUnavailable
+}
+
+// End fails with ErrUnavailable.
+func (t *Transaction) End(f Flags) error {
+	return ErrUnavailable
+}
+
+// Error returns the message of the last status of the transaction.
+//
+// Deprecated: the transaction is no longer returned as error, failures
+// return ReturnType values instead. Use Status to get the last status.
+func (t *Transaction) Error() string {
+	return ReturnType(t.status.Load()).Error()
+}
+
+// SetItem fails with ErrUnavailable.
+func (t *Transaction) SetItem(i Item, item string) error {
+	return ErrUnavailable
+}
+
+// GetItem fails with ErrUnavailable.
+func (t *Transaction) GetItem(i Item) (string, error) {
+	return "", ErrUnavailable
+}
+
+// SetItems fails with ErrUnavailable.
+func (t *Transaction) SetItems(items map[Item]string) error {
+	return ErrUnavailable
+}
+
+// GetItems fails with ErrUnavailable.
+func (t *Transaction) GetItems(items []Item) (map[Item]string, error) {
+	return nil, ErrUnavailable
+}
+
+// SetItemSecure fails with ErrUnavailable.
+func (t *Transaction) SetItemSecure(i Item, b *SecureBuffer) error {
+	return ErrUnavailable
+}
+
+// GetItemSecure fails with ErrUnavailable.
+func (t *Transaction) GetItemSecure(i Item) (*SecureBuffer, error) {
+	return nil, ErrUnavailable
+}
+
+// SetXAuthData fails with ErrUnavailable.
+func (t *Transaction) SetXAuthData(x XAuth) error {
+	return ErrUnavailable
+}
+
+// GetXAuthData fails with ErrUnavailable.
+func (t *Transaction) GetXAuthData() (XAuth, error) {
+	return XAuth{}, ErrUnavailable
+}
+
+// Authenticate fails with ErrUnavailable.
+func (t *Transaction) Authenticate(f Flags) error {
+	return ErrUnavailable
+}
+
+// SetCred fails with ErrUnavailable.
+func (t *Transaction) SetCred(f Flags) error {
+	return ErrUnavailable
+}
+
+// AcctMgmt fails with ErrUnavailable.
+func (t *Transaction) AcctMgmt(f Flags) error {
+	return ErrUnavailable
+}
+
+// ChangeAuthTok fails with ErrUnavailable.
+func (t *Transaction) ChangeAuthTok(f Flags) error {
+	return ErrUnavailable
+}
+
+// OpenSession fails with ErrUnavailable.
+func (t *Transaction) OpenSession(f Flags) error {
+	return ErrUnavailable
+}
+
+// CloseSession fails with ErrUnavailable.
+func (t *Transaction) CloseSession(f Flags) error {
+	return ErrUnavailable
+}
+
+// FailDelay fails with ErrUnavailable.
+func (t *Transaction) FailDelay(d time.Duration) error {
+	return ErrUnavailable
+}
+
+// SetFailDelayHandler fails with ErrUnavailable.
+func (t *Transaction) SetFailDelayHandler(handler func(status ReturnType, delay time.Duration)) error {
+	return ErrUnavailable
+}
+
+// PutEnv fails with ErrUnavailable.
+func (t *Transaction) PutEnv(nameval string) error {
+	return ErrUnavailable
+}
+
+// GetEnv returns an empty string.
+func (t *Transaction) GetEnv(name string) string {
+	return ""
+}
+
+// GetEnvOk returns an empty string and false.
+func (t *Transaction) GetEnvOk(name string) (string, bool) {
+	return "", false
+}
+
+func (t *Transaction) envList(yield func(name, value string) bool) error {
+	return ErrUnavailable
+}
+
+func (t *Transaction) putEnvs(entries []string) error {
+	return ErrUnavailable
+}
+
+func (t *Transaction) callConv(styles []Style, messages []unsafe.Pointer) ([]unsafe.Pointer, error) {
+	return nil, ErrUnavailable
+}
+
+// CheckPamHasStartConfdir returns false.
+func CheckPamHasStartConfdir() bool {
+	return false
+}
+
+// CheckPamHasBinaryProtocol returns false.
+func CheckPamHasBinaryProtocol() bool {
+	return false
+}
+
+// CheckPamHasFailDelay returns false.
+func CheckPamHasFailDelay() bool {
+	return false
+}
+
+// abandonedHandlers never run without cgo, as there are no conversations.
+type abandonedHandlers struct{}
+
+func (a *abandonedHandlers) current() bool {
+	return false
+}
+
+// lockedThread is never started without cgo.
+type lockedThread struct{}
+
+func newLockedThread() *lockedThread {
+	return nil
+}
+
+func (t *lockedThread) stop() {}
+
+// The memory of the binary prompts and of the secure buffers is Go memory,
+// not locked, as nothing passes it to C.
+
+func cBytes(b []byte) unsafe.Pointer {
+	p := make([]byte, max(len(b), 1))
+	copy(p, b)
+	return unsafe.Pointer(&p[0])
+}
+
+func freeSecretBytes(p unsafe.Pointer, n int) {
+	clear(unsafe.Slice((*byte)(p), n))
+}
+
+func cFree(p unsafe.Pointer) {}
+
+func freeForeign(p unsafe.Pointer) {}
+
+func secureAlloc(n int) (unsafe.Pointer, error) {
+	return cBytes(make([]byte, n)), nil
+}
+
+func secureFree(p unsafe.Pointer, n int) {
+	clear(unsafe.Slice((*byte)(p), n))
+}
@@ -0,0 +1,53 @@
+//go:build !cgo
+
+package pam
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNoCgo_Start(t *testing.T) {
+	tx, err := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if tx != nil || !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("start #error: expected ErrUnavailable, got %v, %v", tx, err)
+	}
+	if !errors.Is(err, ErrSystem) || StatusOf(err) != ErrSystem {
+		t.Fatalf("start #error: expected ErrSystem, got %v", StatusOf(err))
+	}
+	if _, err := StartConfDir("permit-service", "test", Credentials{}, "test-services"); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("start_confdir #error: expected ErrUnavailable, got %v", err)
+	}
+	if _, err := StartWithOptions("passwd", WithLockedThread(), WithUser("test")); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("start_with_options #error: expected ErrUnavailable, got %v", err)
+	}
+	if CheckPamHasStartConfdir() || CheckPamHasBinaryProtocol() || CheckPamHasFailDelay() {
+		t.Fatalf("check #error: expected no capabilities")
+	}
+}
+
+func TestNoCgo_ReturnType(t *testing.T) {
+	if msg := ErrAuth.Error(); msg != "Authentication failure" {
+		t.Fatalf("error #error: unexpected message %q", msg)
+	}
+	if msg := ReturnType(-1).Error(); msg != "Unknown PAM error" {
+		t.Fatalf("error #error: unexpected message %q", msg)
+	}
+}
+
+func TestNoCgo_SecureBuffer(t *testing.T) {
+	b, err := NewSecureBufferFrom([]byte("secret"))
+	if err != nil {
+		t.Fatalf("new #error: %v", err)
+	}
+	r, err := SecretHandler{Secret: b}.RespondPAM(PromptEchoOff, "Password: ")
+	if err != nil || r != "secret" {
+		t.Fatalf("respond #error: expected secret, got %q, %v", r, err)
+	}
+	b.Destroy()
+	if b.Len() != 0 {
+		t.Fatalf("destroy #error: expected an empty buffer")
+	}
+}
@@ -0,0 +1,195 @@
+package pam
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// EventKind is the kind of an event of a transaction.
+type EventKind int
+
+// Transaction events.
+const (
+	// EventStart is sent once pam_start returns, successfully or not.
+	EventStart EventKind = iota + 1
+	// EventOperation is sent once an operation running the modules of
+	// the stack returns, such as pam_authenticate or pam_open_session.
+	EventOperation
+	// EventConversation is sent once the conversation handler has
+	// responded to the messages of a module.
+	EventConversation
+	// EventEnd is sent once pam_end returns.
+	EventEnd
+	// EventItem is sent once the application has set an item, whose
+	// value is never reported.
+	EventItem
+	// EventConversationStart is sent before the conversation handler
+	// is called with the messages of a module.
+	EventConversationStart
+	// EventCallStart is sent before the PAM calls whose return is sent
+	// as EventStart, EventOperation, EventEnd, EventItem or EventCall,
+	// with the same Operation, Item and Flags, so that the observers can
+	// open spans or audit records around them.
+	EventCallStart
+	// EventCall is sent once another PAM call of the application
+	// returns: get_item, putenv, getenv, getenvlist or fail_delay.
+	EventCall
+)
+
+// Event describes what happened in a transaction.
+type Event struct {
+	Kind EventKind
+	// ID identifies the transaction of the event. It is unique during
+	// the life of the process.
+	ID uint64
+	// Time is when the call started.
+	Time time.Time
+	// Duration is how long the call took.
+	Duration time.Duration
+	// Service is the name of the service of the transaction.
+	Service string
+	// User is the User item of the transaction once the call returned,
+	// or before it was called for EventEnd and EventCallStart. It is
+	// empty for EventConversation.
+	User string
+	// Operation is the name of the PAM call: start, authenticate,
+	// setcred, acct_mgmt, chauthtok, open_session, close_session, end,
+	// set_item, get_item, putenv, getenv, getenvlist, fail_delay or
+	// conv.
+	Operation string
+	// Item is the item set, for EventItem, or retrieved, for the
+	// get_item EventCall.
+	Item Item
+	// Flags are the flags of the operation.
+	Flags Flags
+	// Status is the status of the call, always Success for
+	// EventConversationStart.
+	Status ReturnType
+	// Messages are the messages of the conversation, whose responses are
+	// never reported. The messages of binary prompts are empty.
+	Messages []ConversationMessage
+}
+
+// Observer receives the events of the transactions, for example to audit or
+// measure them. It is called synchronously by the goroutine running the
+// call, and must not use the transaction.
+type Observer interface {
+	Observe(Event)
+}
+
+// ObserverFunc is an adapter to allow the use of ordinary functions as
+// observers.
+type ObserverFunc func(Event)
+
+// Observe calls f.
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
+
+type multiObserver []Observer
+
+func (m multiObserver) Observe(e Event) {
+	for _, o := range m {
+		o.Observe(e)
+	}
+}
+
+// MultiObserver returns an observer notifying all the observers, in order,
+// so that they can be set together with SetObserver.
+func MultiObserver(observers ...Observer) Observer {
+	return multiObserver(slices.Clone(observers))
+}
+
+var observer atomic.Pointer[Observer]
+
+// SetObserver sets the observer of the events of all the transactions, or
+// removes it if o is nil.
+func SetObserver(o Observer) {
+	if o == nil {
+		observer.Store(nil)
+		return
+	}
+	observer.Store(&o)
+}
+
+// subscribers are the observers added with Subscribe, which can be
+// notified while others are added or removed.
+type subscribers struct {
+	mu   sync.Mutex
+	list atomic.Pointer[[]*subscription]
+}
+
+// subscription is a subscribed observer, identified by its pointer as the
+// observers may not be comparable.
+type subscription struct {
+	o Observer
+}
+
+func (s *subscribers) load() []*subscription {
+	if s == nil {
+		return nil
+	}
+	if p := s.list.Load(); p != nil {
+		return *p
+	}
+	return nil
+}
+
+func (s *subscribers) add(o Observer) (remove func()) {
+	sub := &subscription{o}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := append(slices.Clip(s.load()), sub)
+	s.list.Store(&list)
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		list := slices.DeleteFunc(slices.Clone(s.load()), func(x *subscription) bool {
+			return x == sub
+		})
+		s.list.Store(&list)
+	}
+}
+
+var globalSubscribers subscribers
+
+// Subscribe adds an observer of the events of all the transactions,
+// notified after the one of SetObserver, and returns the function removing
+// it. Unlike SetObserver, it lets independent packages, such as those
+// auditing and measuring the transactions, observe them at the same time.
+func Subscribe(o Observer) (unsubscribe func()) {
+	return globalSubscribers.add(o)
+}
+
+// Subscribe adds an observer of the events of the transaction, notified
+// after those of all the transactions, and returns the function removing
+// it. It misses the EventStart event, sent before the transaction is
+// returned. It can be called while an operation runs, for example by the
+// conversation handler.
+func (t *Transaction) Subscribe(o Observer) (unsubscribe func()) {
+	return t.subscribers.add(o)
+}
+
+// loadObserver returns the observer of the events of the transaction with
+// the subscribers, if any: the one of SetObserver, then those of all the
+// transactions and those of the transaction.
+func loadObserver(local *subscribers) Observer {
+	var m multiObserver
+	if o := observer.Load(); o != nil {
+		m = append(m, *o)
+	}
+	for _, list := range [][]*subscription{globalSubscribers.load(), local.load()} {
+		for _, s := range list {
+			m = append(m, s.o)
+		}
+	}
+	switch len(m) {
+	case 0:
+		return nil
+	case 1:
+		return m[0]
+	}
+	return m
+}
@@ -0,0 +1,165 @@
+package pam
+
+import (
+	"os/user"
+	"slices"
+	"sync"
+	"testing"
+)
+
+func TestObserver(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	var mu sync.Mutex
+	var events []Event
+	var n int
+	SetObserver(MultiObserver(ObserverFunc(func(e Event) {
+		mu.Lock()
+		defer mu.Unlock()
+		events = append(events, e)
+	}), ObserverFunc(func(Event) { n++ })))
+	defer SetObserver(nil)
+
+	u, _ := user.Current()
+	tx, err := StartConfDir("echo-service", u.Username, Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err := tx.Authenticate(DisallowNullAuthtok); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+
+	if n != len(events) {
+		t.Fatalf("observe #error: expected %d events, got %d", len(events), n)
+	}
+	var ops, calls []string
+	for _, e := range events {
+		if e.Kind == EventCallStart {
+			calls = append(calls, e.Operation)
+			continue
+		}
+		ops = append(ops, e.Operation)
+		if e.ID == 0 || e.ID != events[0].ID {
+			t.Fatalf("observe #error: unexpected transaction %d", e.ID)
+		}
+		if e.Service != "echo-service" {
+			t.Fatalf("observe #error: unexpected service %q", e.Service)
+		}
+		conv := e.Kind == EventConversation || e.Kind == EventConversationStart
+		if !conv && e.User != u.Username {
+			t.Fatalf("observe #error: unexpected user %q for %v", e.User, e.Operation)
+		}
+	}
+	if expected := []string{"start", "conv", "conv", "authenticate", "end"}; !slices.Equal(ops, expected) {
+		t.Fatalf("observe #error: expected %v, got %v", expected, ops)
+	}
+	if expected := []string{"start", "authenticate", "end"}; !slices.Equal(calls, expected) {
+		t.Fatalf("observe #error: expected calls %v, got %v", expected, calls)
+	}
+	events = slices.DeleteFunc(events, func(e Event) bool { return e.Kind == EventCallStart })
+	if start := events[1]; start.Kind != EventConversationStart || len(start.Messages) != 1 {
+		t.Fatalf("observe #error: unexpected conversation start %+v", start)
+	}
+	if conv := events[2]; conv.Kind != EventConversation || len(conv.Messages) != 1 || conv.Messages[0].Style != TextInfo {
+		t.Fatalf("observe #error: unexpected conversation %+v", conv)
+	}
+	if auth := events[3]; auth.Flags != DisallowNullAuthtok || auth.Status != Success {
+		t.Fatalf("observe #error: unexpected operation %+v", auth)
+	}
+}
+
+func TestSubscribe(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	var global, local []EventKind
+	unsubscribe := Subscribe(ObserverFunc(func(e Event) { global = append(global, e.Kind) }))
+	defer unsubscribe()
+	// A second subscriber, removed at once, is not notified.
+	Subscribe(ObserverFunc(func(Event) { t.Fatalf("observe #error: unsubscribed") }))()
+
+	u, _ := user.Current()
+	tx, err := StartConfDir("echo-service", u.Username, Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	var items []Item
+	tx.Subscribe(ObserverFunc(func(e Event) {
+		local = append(local, e.Kind)
+		if e.Kind == EventItem {
+			items = append(items, e.Item)
+		}
+	}))
+	if err := tx.SetItem(Rhost, "example.com"); err != nil {
+		t.Fatalf("setitem #error: %v", err)
+	}
+	if err := tx.SetItems(map[Item]string{Tty: "tty1", Ruser: "root"}); err != nil {
+		t.Fatalf("setitems #error: %v", err)
+	}
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+
+	expected := []EventKind{EventCallStart, EventItem, EventCallStart, EventCallStart,
+		EventItem, EventItem, EventCallStart, EventConversationStart, EventConversation,
+		EventOperation, EventCallStart, EventEnd}
+	if !slices.Equal(local, expected) {
+		t.Fatalf("subscribe #error: expected %v, got %v", expected, local)
+	}
+	if !slices.Equal(global, append([]EventKind{EventCallStart, EventStart}, expected...)) {
+		t.Fatalf("subscribe #error: unexpected global events %v", global)
+	}
+	if expected := []Item{Rhost, Tty, Ruser}; !slices.Equal(items, expected) {
+		t.Fatalf("subscribe #error: expected items %v, got %v", expected, items)
+	}
+}
+
+func TestWithObserver(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	var events []Event
+	u, _ := user.Current()
+	tx, err := StartWithOptions("echo-service", WithUser(u.Username),
+		WithConversationHandler(Credentials{}), WithConfDir("test-services"),
+		WithObserver(ObserverFunc(func(e Event) { events = append(events, e) })),
+		WithEnv(map[string]string{"LANG": "C"}))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if _, err := tx.GetItem(Tty); err != nil {
+		t.Fatalf("getitem #error: %v", err)
+	}
+	tx.GetEnv("LANG")
+	if err := tx.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+
+	var calls []string
+	for i, e := range events {
+		if e.Kind == EventCallStart {
+			continue
+		}
+		calls = append(calls, e.Operation)
+		// Each call is preceded by its start.
+		before := events[i-1]
+		if before.Kind != EventCallStart || before.Operation != e.Operation ||
+			before.Item != e.Item || before.Time.After(e.Time) {
+			t.Fatalf("observe #error: unexpected start %+v of %+v", before, e)
+		}
+	}
+	expected := []string{"start", "putenv", "get_item", "getenv", "end"}
+	if !slices.Equal(calls, expected) {
+		t.Fatalf("observe #error: expected %v, got %v", expected, calls)
+	}
+	if getItem := events[5]; getItem.Kind != EventCall || getItem.Item != Tty || getItem.Status != Success {
+		t.Fatalf("observe #error: unexpected get_item %+v", getItem)
+	}
+}
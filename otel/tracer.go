@@ -0,0 +1,127 @@
+// Package otel traces the PAM transactions with OpenTelemetry: each
+// transaction is a span, from its start to its end, whose children are the
+// spans of its operations, with the conversations with the users as events.
+// Slow logins can then be followed through the modules, such as those
+// querying LDAP or Kerberos servers.
+//
+// Only the applications importing it link OpenTelemetry:
+//
+//	unsubscribe := pam.Subscribe(pamotel.NewTracer(otel.GetTracerProvider()))
+//	defer unsubscribe()
+//
+// The user names are not recorded, only the first bytes of their SHA-256
+// hashes, enough to tell the users apart.
+package otel
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+
+	"github.com/msteinert/pam"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentation is the name of the instrumentation library.
+const instrumentation = "github.com/msteinert/pam/otel"
+
+// Tracer is a pam.Observer creating the spans of the transactions.
+type Tracer struct {
+	tracer trace.Tracer
+	mu     sync.Mutex
+	// transactions are the transactions started and not ended yet.
+	transactions map[uint64]*transaction
+}
+
+// transaction is the trace state of a transaction.
+type transaction struct {
+	ctx  context.Context
+	span trace.Span
+	// convs are the conversations of the running operation, recorded
+	// as events of its span once it returns.
+	convs []pam.Event
+}
+
+// NewTracer returns a tracer creating the spans with the tracers of tp.
+func NewTracer(tp trace.TracerProvider) *Tracer {
+	return &Tracer{
+		tracer:       tp.Tracer(instrumentation),
+		transactions: map[uint64]*transaction{},
+	}
+}
+
+// userHash returns the hash identifying the user.
+func userHash(user string) string {
+	h := sha256.Sum256([]byte(user))
+	return hex.EncodeToString(h[:8])
+}
+
+// attributes returns the attributes of the span of the event.
+func attributes(e pam.Event) []attribute.KeyValue {
+	attrs := []attribute.KeyValue{attribute.String("pam.service", e.Service)}
+	if e.User != "" {
+		attrs = append(attrs, attribute.String("pam.user.hash", userHash(e.User)))
+	}
+	return attrs
+}
+
+// end ends the span, as the call of the event returned.
+func end(span trace.Span, e pam.Event) {
+	span.SetAttributes(attributes(e)...)
+	span.SetAttributes(attribute.String("pam.status", e.Status.String()))
+	if e.Status != pam.Success {
+		span.SetStatus(codes.Error, e.Status.Error())
+	}
+	span.End(trace.WithTimestamp(e.Time.Add(e.Duration)))
+}
+
+// Observe creates the spans of the event.
+func (t *Tracer) Observe(e pam.Event) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch e.Kind {
+	case pam.EventStart:
+		ctx, span := t.tracer.Start(context.Background(), "pam.transaction",
+			trace.WithTimestamp(e.Time), trace.WithSpanKind(trace.SpanKindClient))
+		if e.Status != pam.Success {
+			end(span, e)
+			return
+		}
+		t.transactions[e.ID] = &transaction{ctx: ctx, span: span}
+	case pam.EventConversation:
+		if tx := t.transactions[e.ID]; tx != nil {
+			tx.convs = append(tx.convs, e)
+		}
+	case pam.EventOperation:
+		tx := t.transactions[e.ID]
+		if tx == nil {
+			return
+		}
+		_, span := t.tracer.Start(tx.ctx, "pam."+e.Operation,
+			trace.WithTimestamp(e.Time),
+			trace.WithAttributes(attribute.String("pam.flags", e.Flags.String())))
+		for _, c := range tx.convs {
+			styles := make([]string, len(c.Messages))
+			for i, m := range c.Messages {
+				styles[i] = m.Style.String()
+			}
+			span.AddEvent("pam.conversation", trace.WithTimestamp(c.Time),
+				trace.WithAttributes(
+					attribute.StringSlice("pam.message.styles", styles),
+					attribute.String("pam.status", c.Status.String()),
+					attribute.Int64("pam.duration_usec", c.Duration.Microseconds())))
+		}
+		tx.convs = nil
+		end(span, e)
+	case pam.EventEnd:
+		tx := t.transactions[e.ID]
+		if tx == nil {
+			return
+		}
+		delete(t.transactions, e.ID)
+		end(tx.span, e)
+	}
+}
@@ -0,0 +1,61 @@
+package otel
+
+import (
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	tracer := NewTracer(tp)
+	now := time.Unix(0, 0)
+	for _, e := range []pam.Event{
+		{Kind: pam.EventStart, ID: 1, Time: now, Service: "login", User: "user", Operation: "start"},
+		{Kind: pam.EventConversation, ID: 1, Time: now, Service: "login", Operation: "conv",
+			Messages: []pam.ConversationMessage{{Style: pam.PromptEchoOff, Message: "Password: "}}},
+		{Kind: pam.EventOperation, ID: 1, Time: now, Duration: time.Second, Service: "login",
+			User: "user", Operation: "authenticate", Status: pam.ErrAuth},
+		{Kind: pam.EventEnd, ID: 1, Time: now.Add(time.Second), Service: "login", User: "user", Operation: "end"},
+		{Kind: pam.EventStart, ID: 2, Time: now, Service: "login", Operation: "start", Status: pam.ErrAbort},
+	} {
+		tracer.Observe(e)
+	}
+	if len(tracer.transactions) != 0 {
+		t.Fatalf("observe #error: transactions not ended %v", tracer.transactions)
+	}
+
+	spans := exporter.GetSpans()
+	var names []string
+	for _, s := range spans {
+		names = append(names, s.Name)
+	}
+	if expected := []string{"pam.authenticate", "pam.transaction", "pam.transaction"}; !slices.Equal(names, expected) {
+		t.Fatalf("spans #error: expected %v, got %v", expected, names)
+	}
+	auth, transaction := spans[0], spans[1]
+	if auth.Parent.SpanID() != transaction.SpanContext.SpanID() {
+		t.Fatalf("spans #error: the operation is not a child of the transaction")
+	}
+	if auth.Status.Code != codes.Error || len(auth.Events) != 1 || auth.Events[0].Name != "pam.conversation" {
+		t.Fatalf("spans #error: unexpected operation span %+v", auth)
+	}
+	if !slices.Contains(auth.Attributes, attribute.String("pam.user.hash", userHash("user"))) {
+		t.Fatalf("spans #error: no user hash in %v", auth.Attributes)
+	}
+	for _, a := range auth.Attributes {
+		if a.Value.AsString() == "user" {
+			t.Fatalf("spans #error: user name recorded in %v", a)
+		}
+	}
+	if spans[2].Status.Code != codes.Error {
+		t.Fatalf("spans #error: expected the failed start to be an error")
+	}
+}
@@ -0,0 +1,255 @@
+// Package otp implements the one time passwords of RFC 4226 (HOTP) and
+// RFC 6238 (TOTP), as used by the authenticator applications, for the
+// authentication modules written in Go: the generation and verification of
+// the codes, with windows for the clocks and counters drifting apart and a
+// hook protecting against their replay, and the URIs provisioning the
+// secrets to the applications.
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// Algorithm is the HMAC hash function of the codes.
+type Algorithm int
+
+// Algorithms.
+const (
+	SHA1 Algorithm = iota
+	SHA256
+	SHA512
+)
+
+func (a Algorithm) String() string {
+	switch a {
+	case SHA256:
+		return "SHA256"
+	case SHA512:
+		return "SHA512"
+	}
+	return "SHA1"
+}
+
+func (a Algorithm) hash() func() hash.Hash {
+	switch a {
+	case SHA256:
+		return sha256.New
+	case SHA512:
+		return sha512.New
+	}
+	return sha1.New
+}
+
+// Key defines the codes of a user.
+type Key struct {
+	// Secret is the secret shared with the user.
+	Secret    []byte
+	Algorithm Algorithm
+	// Digits is the number of digits of the codes, 6 if not set.
+	Digits int
+	// Period is the validity of the TOTP codes, 30 seconds if not set.
+	Period time.Duration
+}
+
+func (k Key) digits() int {
+	if k.Digits <= 0 {
+		return 6
+	}
+	return k.Digits
+}
+
+func (k Key) period() time.Duration {
+	if k.Period <= 0 {
+		return 30 * time.Second
+	}
+	return k.Period
+}
+
+// ErrReplayed is returned when a code was already used. It matches
+// pam.ErrAuth.
+var ErrReplayed = fmt.Errorf("%w: code already used", pam.ErrAuth)
+
+// GenerateSecret returns a new random secret of 20 bytes, the length of
+// the SHA-1 digests recommended by RFC 4226.
+func GenerateSecret() ([]byte, error) {
+	secret := make([]byte, 20)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	return secret, nil
+}
+
+var secretEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// EncodeSecret returns the base32 encoding of the secret, as entered in
+// the authenticator applications.
+func EncodeSecret(secret []byte) string {
+	return secretEncoding.EncodeToString(secret)
+}
+
+// DecodeSecret decodes a base32 secret, ignoring its case, spaces and
+// padding.
+func DecodeSecret(s string) ([]byte, error) {
+	s = strings.ToUpper(strings.TrimRight(strings.ReplaceAll(s, " ", ""), "="))
+	return secretEncoding.DecodeString(s)
+}
+
+// HOTP returns the code of the counter.
+func HOTP(key Key, counter uint64) string {
+	mac := hmac.New(key.Algorithm.hash(), key.Secret)
+	binary.Write(mac, binary.BigEndian, counter)
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+	digits := key.digits()
+	mod := uint32(1)
+	for range min(digits, 9) {
+		mod *= 10
+	}
+	return fmt.Sprintf("%0*d", digits, value%mod)
+}
+
+// Counter returns the TOTP counter of the time.
+func (k Key) Counter(t time.Time) uint64 {
+	return uint64(t.Unix()) / uint64(k.period()/time.Second)
+}
+
+// TOTP returns the code of the time.
+func TOTP(key Key, t time.Time) string {
+	return HOTP(key, key.Counter(t))
+}
+
+// ReplayGuard records the used codes, by their counters, so that they can't
+// be used again. Implementations are usually backed by the storage of the
+// keys and must be safe for concurrent use.
+type ReplayGuard interface {
+	// Use records the counter of a code verified for user, failing with
+	// ErrReplayed if it is not greater than the last one recorded.
+	Use(user string, counter uint64) error
+}
+
+// Verifier verifies the codes of the users.
+type Verifier struct {
+	// Skew is the number of TOTP periods, before and after the current
+	// one, whose codes are accepted, as the clocks drift apart.
+	Skew int
+	// LookAhead is the number of HOTP counters after the expected one
+	// whose codes are accepted, as users may have generated codes
+	// without using them.
+	LookAhead int
+	// Replay, if not nil, records the used codes.
+	Replay ReplayGuard
+}
+
+// VerifyTOTP verifies the TOTP code of user at the given time, returning its
+// counter, or pam.ErrAuth if it doesn't match.
+func (v *Verifier) VerifyTOTP(user string, key Key, code string, t time.Time) (uint64, error) {
+	current := key.Counter(t)
+	skew := uint64(max(v.Skew, 0))
+	first := current - min(skew, current)
+	return v.verify(user, key, code, first, current+skew)
+}
+
+// VerifyHOTP verifies the HOTP code of user, expected to be the one of the
+// counter, returning its counter, which the caller must store incremented
+// as the next expected one, or pam.ErrAuth if it doesn't match.
+func (v *Verifier) VerifyHOTP(user string, key Key, code string, counter uint64) (uint64, error) {
+	return v.verify(user, key, code, counter, counter+uint64(max(v.LookAhead, 0)))
+}
+
+func (v *Verifier) verify(user string, key Key, code string, first, last uint64) (uint64, error) {
+	code = strings.TrimSpace(code)
+	if len(code) != key.digits() {
+		return 0, pam.ErrAuth
+	}
+	matched, found := uint64(0), 0
+	for c := first; c <= last; c++ {
+		// All the counters are checked, in constant time.
+		eq := subtle.ConstantTimeCompare([]byte(HOTP(key, c)), []byte(code))
+		if eq == 1 && found == 0 {
+			matched, found = c, 1
+		}
+	}
+	if found == 0 {
+		return 0, pam.ErrAuth
+	}
+	if v.Replay != nil {
+		if err := v.Replay.Use(user, matched); err != nil {
+			return 0, err
+		}
+	}
+	return matched, nil
+}
+
+// URI returns the otpauth URI provisioning the key as a TOTP key to the
+// authenticator applications, usually shown as a QR code. The issuer is the
+// name of the service, and the account the name of the user.
+func (k Key) URI(issuer, account string) string {
+	return k.uri("totp", issuer, account, url.Values{
+		"period": {strconv.Itoa(int(k.period() / time.Second))},
+	})
+}
+
+// HOTPURI returns the otpauth URI provisioning the key as a HOTP key, whose
+// next code is the one of the counter.
+func (k Key) HOTPURI(issuer, account string, counter uint64) string {
+	return k.uri("hotp", issuer, account, url.Values{
+		"counter": {strconv.FormatUint(counter, 10)},
+	})
+}
+
+func (k Key) uri(typ, issuer, account string, params url.Values) string {
+	label := account
+	if issuer != "" {
+		label = issuer + ":" + account
+		params.Set("issuer", issuer)
+	}
+	params.Set("secret", EncodeSecret(k.Secret))
+	params.Set("algorithm", k.Algorithm.String())
+	params.Set("digits", strconv.Itoa(k.digits()))
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     typ,
+		Path:     "/" + label,
+		RawQuery: params.Encode(),
+	}
+	return u.String()
+}
+
+// MemoryReplayGuard is a ReplayGuard keeping the counters in memory, for
+// the processes verifying all the codes of the users.
+type MemoryReplayGuard struct {
+	mu sync.Mutex
+	// next are the counters following the last ones used.
+	next map[string]uint64
+}
+
+// Use records the counter of a code verified for user.
+func (g *MemoryReplayGuard) Use(user string, counter uint64) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if counter < g.next[user] {
+		return ErrReplayed
+	}
+	if g.next == nil {
+		g.next = map[string]uint64{}
+	}
+	g.next[user] = counter + 1
+	return nil
+}
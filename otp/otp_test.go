@@ -0,0 +1,112 @@
+package otp
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+func TestHOTP(t *testing.T) {
+	// RFC 4226, appendix D.
+	key := Key{Secret: []byte("12345678901234567890")}
+	for i, expected := range []string{"755224", "287082", "359152", "969429",
+		"338314", "254676", "287922", "162583", "399871", "520489"} {
+		if code := HOTP(key, uint64(i)); code != expected {
+			t.Fatalf("hotp #error: counter %d: expected %s, got %s", i, expected, code)
+		}
+	}
+}
+
+func TestTOTP(t *testing.T) {
+	// RFC 6238, appendix B.
+	keys := map[Algorithm]Key{
+		SHA1:   {Secret: []byte("12345678901234567890"), Digits: 8},
+		SHA256: {Secret: []byte("12345678901234567890123456789012"), Algorithm: SHA256, Digits: 8},
+		SHA512: {Secret: []byte("1234567890123456789012345678901234567890123456789012345678901234"), Algorithm: SHA512, Digits: 8},
+	}
+	tests := []struct {
+		time     int64
+		alg      Algorithm
+		expected string
+	}{
+		{59, SHA1, "94287082"},
+		{59, SHA256, "46119246"},
+		{59, SHA512, "90693936"},
+		{1111111109, SHA1, "07081804"},
+		{1111111109, SHA256, "68084774"},
+		{1234567890, SHA512, "93441116"},
+		{20000000000, SHA1, "65353130"},
+	}
+	for _, tt := range tests {
+		if code := TOTP(keys[tt.alg], time.Unix(tt.time, 0)); code != tt.expected {
+			t.Fatalf("totp #error: %v at %d: expected %s, got %s", tt.alg, tt.time, tt.expected, code)
+		}
+	}
+}
+
+func TestVerifier(t *testing.T) {
+	key := Key{Secret: []byte("12345678901234567890")}
+	now := time.Unix(1111111109, 0)
+	v := &Verifier{Skew: 1, LookAhead: 2, Replay: &MemoryReplayGuard{}}
+
+	previous := TOTP(key, now.Add(-30*time.Second))
+	counter, err := v.VerifyTOTP("test", key, previous, now)
+	if err != nil || counter != key.Counter(now)-1 {
+		t.Fatalf("verify #error: expected the previous counter, got %v, %v", counter, err)
+	}
+	if _, err := v.VerifyTOTP("test", key, previous, now); !errors.Is(err, ErrReplayed) || !errors.Is(err, pam.ErrAuth) {
+		t.Fatalf("verify #error: expected ErrReplayed, got %v", err)
+	}
+	if _, err := v.VerifyTOTP("other", key, previous, now); err != nil {
+		t.Fatalf("verify #error: %v", err)
+	}
+	if _, err := v.VerifyTOTP("test", key, TOTP(key, now.Add(time.Minute)), now); !errors.Is(err, pam.ErrAuth) {
+		t.Fatalf("verify #error: expected ErrAuth out of the window, got %v", err)
+	}
+	if _, err := v.VerifyTOTP("test", key, "12345", now); !errors.Is(err, pam.ErrAuth) {
+		t.Fatalf("verify #error: expected ErrAuth for a short code, got %v", err)
+	}
+
+	counter, err = v.VerifyHOTP("hotp", key, "359152", 0)
+	if err != nil || counter != 2 {
+		t.Fatalf("verify #error: expected counter 2, got %v, %v", counter, err)
+	}
+	if _, err := v.VerifyHOTP("hotp", key, "969429", 0); !errors.Is(err, pam.ErrAuth) {
+		t.Fatalf("verify #error: expected ErrAuth beyond the look-ahead, got %v", err)
+	}
+}
+
+func TestSecret(t *testing.T) {
+	secret, err := GenerateSecret()
+	if err != nil || len(secret) != 20 {
+		t.Fatalf("generate #error: %v", err)
+	}
+	decoded, err := DecodeSecret("gezd gnbv gy3t qojq gezd gnbv gy3t qojq")
+	if err != nil || string(decoded) != "12345678901234567890" {
+		t.Fatalf("decode #error: %q, %v", decoded, err)
+	}
+	if s := EncodeSecret(decoded); s != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" {
+		t.Fatalf("encode #error: unexpected %s", s)
+	}
+}
+
+func TestKey_URI(t *testing.T) {
+	key := Key{Secret: []byte("12345678901234567890")}
+	u, err := url.Parse(key.URI("Example Co", "test@example.com"))
+	if err != nil {
+		t.Fatalf("uri #error: %v", err)
+	}
+	q := u.Query()
+	if u.Scheme != "otpauth" || u.Host != "totp" || u.Path != "/Example Co:test@example.com" ||
+		q.Get("secret") != "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ" || q.Get("issuer") != "Example Co" ||
+		q.Get("period") != "30" || q.Get("digits") != "6" || q.Get("algorithm") != "SHA1" {
+		t.Fatalf("uri #error: unexpected %v", u)
+	}
+	u, _ = url.Parse(key.HOTPURI("", "test", 5))
+	if u.Host != "hotp" || u.Path != "/test" || u.Query().Get("counter") != "5" || u.Query().Has("issuer") {
+		t.Fatalf("uri #error: unexpected %v", u)
+	}
+}
@@ -0,0 +1,240 @@
+package pamconf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// Severity is the severity of an Issue.
+type Severity int
+
+// Issue severities.
+const (
+	Warning Severity = iota
+	Error
+)
+
+func (s Severity) String() string {
+	if s == Error {
+		return "error"
+	}
+	return "warning"
+}
+
+// Issue is a problem found in a service file.
+type Issue struct {
+	File     string
+	LineNo   int
+	Severity Severity
+	// Check is the name of the check that found the issue.
+	Check   string
+	Message string
+}
+
+func (i Issue) String() string {
+	return fmt.Sprintf("%s:%d: %v: %s (%s)", i.File, i.LineNo, i.Severity, i.Message, i.Check)
+}
+
+// DefaultModuleDirs are the directories where modules with a relative path
+// are looked up when no other directory is provided.
+var DefaultModuleDirs = []string{
+	"/lib/security",
+	"/lib64/security",
+	"/usr/lib/security",
+	"/usr/lib64/security",
+	"/lib/*/security",
+	"/usr/lib/*/security",
+}
+
+// LintOptions are the options of Lint and LintDir.
+type LintOptions struct {
+	// ModuleDirs are the directories where modules with a relative
+	// path are looked up, they can be glob patterns. DefaultModuleDirs
+	// is used if empty.
+	ModuleDirs []string
+	// SkipModules disables the check for missing modules.
+	SkipModules bool
+	// Services are the other services known, used to check include and
+	// substack lines. Such lines are not checked if nil.
+	Services map[string]bool
+}
+
+// denyResults are the return values of pam_deny for each type.
+var denyResults = map[Type]string{
+	Account:  "auth_err",
+	Auth:     "auth_err",
+	Password: "authtok_err",
+	Session:  "session_err",
+}
+
+func (o LintOptions) moduleExists(module string) bool {
+	if filepath.IsAbs(module) {
+		_, err := os.Stat(module)
+		return err == nil
+	}
+	dirs := o.ModuleDirs
+	if len(dirs) == 0 {
+		dirs = DefaultModuleDirs
+	}
+	for _, dir := range dirs {
+		matches, _ := filepath.Glob(filepath.Join(dir, module))
+		if len(matches) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func isDeny(l Line) bool {
+	return filepath.Base(l.Module) == "pam_deny.so"
+}
+
+// Lint parses the service file read from r and checks it for syntax errors
+// and common mistakes. The file name is only used in the issues.
+func Lint(file string, r io.Reader, opts LintOptions) []Issue {
+	var issues []Issue
+	report := func(n int, sev Severity, check, format string, args ...any) {
+		issues = append(issues, Issue{file, n, sev, check, fmt.Sprintf(format, args...)})
+	}
+
+	lines, err := Parse(r)
+	if err != nil {
+		var errs []error
+		if joined, ok := err.(interface{ Unwrap() []error }); ok {
+			errs = joined.Unwrap()
+		} else {
+			errs = []error{err}
+		}
+		for _, e := range errs {
+			var perr *ParseError
+			if errors.As(e, &perr) {
+				report(perr.LineNo, Error, "syntax", "%v", perr.Err)
+			} else {
+				report(0, Error, "syntax", "%v", e)
+			}
+		}
+	}
+
+	chains := map[Type][]Line{}
+	for _, l := range lines {
+		if l.Type == "" {
+			for _, typ := range []Type{Account, Auth, Password, Session} {
+				chains[typ] = append(chains[typ], l)
+			}
+		} else {
+			chains[l.Type] = append(chains[l.Type], l)
+		}
+		switch {
+		case l.Control == Include || l.Control == Substack:
+			if opts.Services != nil && !opts.Services[l.Module] {
+				report(l.LineNo, Error, "missing-service", "%s service %q not found", l.Control, l.Module)
+			}
+		case !opts.SkipModules && !l.IgnoreMissing && !opts.moduleExists(l.Module):
+			report(l.LineNo, Error, "missing-module", "module %q not found", l.Module)
+		}
+	}
+
+	for _, typ := range []Type{Account, Auth, Password, Session} {
+		lintChain(typ, chains[typ], report)
+	}
+	sort.SliceStable(issues, func(i, j int) bool { return issues[i].LineNo < issues[j].LineNo })
+	return issues
+}
+
+func lintChain(typ Type, chain []Line, report func(int, Severity, string, string, ...any)) {
+	if len(chain) == 0 {
+		return
+	}
+
+	canFail := false
+	reachable := make([]bool, len(chain)+1)
+	reachable[0] = true
+	for i, l := range chain {
+		if l.Control == Include || l.Control == Substack {
+			canFail = true
+		}
+		continues := true
+		for key, action := range l.Actions {
+			if action == ActionBad || action == ActionDie {
+				canFail = true
+			}
+			n, err := strconv.Atoi(action)
+			if err != nil {
+				continue
+			}
+			if i+1+n > len(chain) {
+				report(l.LineNo, Error, "jump-out-of-range",
+					"%s=%s jumps past the end of the %s stack", key, action, typ)
+				continue
+			}
+			if reachable[i] {
+				reachable[i+1+n] = true
+			}
+		}
+		if isDeny(l) {
+			switch l.Action(denyResults[typ]) {
+			case ActionDie, ActionDone:
+				continues = false
+			}
+		}
+		if reachable[i] && continues {
+			reachable[i+1] = true
+		}
+		if !reachable[i] {
+			report(l.LineNo, Warning, "unreachable", "module %q is never reached", l.Module)
+		}
+	}
+
+	if typ != Session && !canFail {
+		report(chain[0].LineNo, Warning, "no-fallback",
+			"%s stack has no required module nor pam_deny.so fallback", typ)
+	}
+
+	for i, l := range chain {
+		if l.Control != Sufficient {
+			continue
+		}
+		for _, next := range chain[i+1:] {
+			if (next.Control == Required || next.Control == Requisite) && !isDeny(next) {
+				report(next.LineNo, Warning, "sufficient-before-required",
+					"%s module %q is skipped when sufficient module %q on line %d succeeds",
+					next.Control, next.Module, l.Module, l.LineNo)
+			}
+		}
+	}
+}
+
+// LintDir checks all the service files in dir, checking include and
+// substack lines against the services in the same directory unless
+// opts.Services is set.
+func LintDir(dir string, opts LintOptions) ([]Issue, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Services == nil {
+		opts.Services = map[string]bool{}
+		for _, e := range entries {
+			opts.Services[e.Name()] = !e.IsDir()
+		}
+	}
+	var issues []Issue
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		path := filepath.Join(dir, e.Name())
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		issues = append(issues, Lint(path, f, opts)...)
+		f.Close()
+	}
+	return issues, nil
+}
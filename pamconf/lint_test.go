@@ -0,0 +1,78 @@
+package pamconf
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func checks(issues []Issue) []string {
+	var s []string
+	for _, i := range issues {
+		s = append(s, i.Check)
+	}
+	return s
+}
+
+func TestLint(t *testing.T) {
+	modules := t.TempDir()
+	for _, m := range []string{"pam_unix.so", "pam_deny.so", "pam_permit.so", "pam_rootok.so"} {
+		os.WriteFile(filepath.Join(modules, m), nil, 0600)
+	}
+	opts := LintOptions{
+		ModuleDirs: []string{modules},
+		Services:   map[string]bool{"common": true},
+	}
+	tests := []struct {
+		name    string
+		service string
+		checks  []string
+	}{
+		{"valid", `
+auth [success=1 default=ignore] pam_unix.so
+auth requisite pam_deny.so
+auth required pam_permit.so
+account include common
+session optional pam_permit.so`, nil},
+		{"syntax", "auth required\n", []string{"syntax"}},
+		{"missing module", "auth required pam_missing.so\n-auth optional pam_other.so", []string{"missing-module"}},
+		{"missing service", "auth include other\nauth substack common", []string{"missing-service"}},
+		{"no fallback", "auth sufficient pam_unix.so\nauth optional pam_permit.so", []string{"no-fallback"}},
+		{"sufficient before required", `
+auth sufficient pam_rootok.so
+auth required pam_unix.so
+auth required pam_deny.so`, []string{"sufficient-before-required"}},
+		{"unreachable", `
+auth required pam_unix.so
+auth requisite pam_deny.so
+auth required pam_permit.so`, []string{"unreachable"}},
+		{"jump out of range", `
+auth [success=2 default=ignore] pam_unix.so
+auth requisite pam_deny.so`, []string{"jump-out-of-range"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			issues := Lint("test", strings.NewReader(tc.service), opts)
+			if !reflect.DeepEqual(checks(issues), tc.checks) {
+				t.Fatalf("lint #error: expected %v, got %v", tc.checks, issues)
+			}
+		})
+	}
+}
+
+func TestLintDir(t *testing.T) {
+	issues, err := LintDir("../test-services", LintOptions{SkipModules: true})
+	if err != nil {
+		t.Fatalf("lint #error: %v", err)
+	}
+	for _, i := range issues {
+		if i.Severity == Error {
+			t.Fatalf("lint #error: %v", i)
+		}
+	}
+	if _, err := LintDir("does-not-exist", LintOptions{}); err == nil {
+		t.Fatalf("lint #expected an error")
+	}
+}
@@ -0,0 +1,270 @@
+// Package pamconf parses PAM service files in the pam.d format used by
+// Linux-PAM, and checks them for common configuration mistakes.
+package pamconf
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Type is the management group of a service line.
+type Type string
+
+// PAM management groups.
+const (
+	Account  Type = "account"
+	Auth     Type = "auth"
+	Password Type = "password"
+	Session  Type = "session"
+)
+
+// Control is the control value of a service line. Values using the
+// bracketed syntax, such as "[success=ok default=bad]", are valid too.
+type Control string
+
+// PAM control values.
+const (
+	Required   Control = "required"
+	Requisite  Control = "requisite"
+	Sufficient Control = "sufficient"
+	Optional   Control = "optional"
+	Include    Control = "include"
+	Substack   Control = "substack"
+)
+
+// Actions of the bracketed control syntax. Jumps are expressed by a
+// positive number of lines to skip.
+const (
+	ActionIgnore = "ignore"
+	ActionBad    = "bad"
+	ActionDie    = "die"
+	ActionOk     = "ok"
+	ActionDone   = "done"
+	ActionReset  = "reset"
+)
+
+// ReturnValues are the names of the PAM return values used as keys in the
+// bracketed control syntax, followed by "default".
+var ReturnValues = []string{
+	"success", "open_err", "symbol_err", "service_err", "system_err",
+	"buf_err", "perm_denied", "auth_err", "cred_insufficient",
+	"authinfo_unavail", "user_unknown", "maxtries", "new_authtok_reqd",
+	"acct_expired", "session_err", "cred_unavail", "cred_expired",
+	"cred_err", "no_module_data", "conv_err", "authtok_err",
+	"authtok_recover_err", "authtok_lock_busy", "authtok_disable_aging",
+	"try_again", "ignore", "abort", "authtok_expired", "module_unknown",
+	"bad_item", "conv_again", "incomplete", "default",
+}
+
+var simpleControls = map[Control]map[string]string{
+	Required:   {"success": ActionOk, "new_authtok_reqd": ActionOk, "ignore": ActionIgnore, "default": ActionBad},
+	Requisite:  {"success": ActionOk, "new_authtok_reqd": ActionOk, "ignore": ActionIgnore, "default": ActionDie},
+	Sufficient: {"success": ActionDone, "new_authtok_reqd": ActionDone, "default": ActionIgnore},
+	Optional:   {"success": ActionOk, "new_authtok_reqd": ActionOk, "default": ActionIgnore},
+	Substack:   {"success": ActionOk, "new_authtok_reqd": ActionOk, "ignore": ActionIgnore, "default": ActionBad},
+}
+
+// Line is a line of a service file.
+type Line struct {
+	// LineNo is the number of the line in the file. Lines continued
+	// with a trailing backslash are reported with the number of their
+	// last line.
+	LineNo int
+	// IgnoreMissing is set for types prefixed with "-": the line is
+	// skipped if the module can't be loaded.
+	IgnoreMissing bool
+	// Type is empty for the "@include" directive supported by Debian,
+	// which includes the lines of all the types of another service.
+	Type    Type
+	Control Control
+	// Actions maps return values to the action to take, as defined by
+	// the control value. It is nil for Include lines.
+	Actions map[string]string
+	// Module is the module path, or the included service for Include
+	// and Substack lines.
+	Module string
+	Args   []string
+}
+
+// Action returns the action for the return value key, falling back to the
+// default action.
+func (l Line) Action(key string) string {
+	if action, ok := l.Actions[key]; ok {
+		return action
+	}
+	if action, ok := l.Actions["default"]; ok {
+		return action
+	}
+	return ActionBad
+}
+
+// ParseError is a syntax error in a service file.
+type ParseError struct {
+	LineNo int
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("line %d: %v", e.LineNo, e.Err)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+func isReturnValue(key string) bool {
+	for _, v := range ReturnValues {
+		if v == key {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseControl returns the actions defined by a control value, which can
+// be a simple control such as Required or a bracketed value.
+func ParseControl(c Control) (map[string]string, error) {
+	if actions, ok := simpleControls[Control(strings.ToLower(string(c)))]; ok {
+		return actions, nil
+	}
+	s := string(c)
+	if !strings.HasPrefix(s, "[") || !strings.HasSuffix(s, "]") {
+		return nil, fmt.Errorf("invalid control %q", s)
+	}
+	actions := map[string]string{}
+	for _, tok := range strings.Fields(s[1 : len(s)-1]) {
+		key, action, ok := strings.Cut(strings.ToLower(tok), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid control value %q", tok)
+		}
+		if !isReturnValue(key) {
+			return nil, fmt.Errorf("unknown return value %q", key)
+		}
+		switch action {
+		case ActionIgnore, ActionBad, ActionDie, ActionOk, ActionDone, ActionReset:
+		default:
+			if n, err := strconv.Atoi(action); err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid control action %q", tok)
+			}
+		}
+		actions[key] = action
+	}
+	return actions, nil
+}
+
+// splitFields splits a service line in fields, keeping bracketed fields
+// together. Brackets are removed, and "\]" is unescaped.
+func splitFields(line string) ([]string, error) {
+	var fields []string
+	for {
+		line = strings.TrimLeftFunc(line, unicode.IsSpace)
+		if line == "" {
+			return fields, nil
+		}
+		if line[0] != '[' {
+			end := strings.IndexFunc(line, unicode.IsSpace)
+			if end < 0 {
+				end = len(line)
+			}
+			fields = append(fields, line[:end])
+			line = line[end:]
+			continue
+		}
+		var b strings.Builder
+		i := 1
+		for ; i < len(line) && line[i] != ']'; i++ {
+			if line[i] == '\\' && i+1 < len(line) && line[i+1] == ']' {
+				i++
+			}
+			b.WriteByte(line[i])
+		}
+		if i == len(line) {
+			return nil, errors.New("unterminated bracket")
+		}
+		fields = append(fields, b.String())
+		line = line[i+1:]
+	}
+}
+
+func parseLine(n int, text string) (*Line, error) {
+	fields, err := splitFields(text)
+	if err != nil || len(fields) == 0 {
+		return nil, err
+	}
+	if fields[0] == "@include" {
+		if len(fields) != 2 || fields[1] == "" {
+			return nil, errors.New("expected a single service to include")
+		}
+		return &Line{LineNo: n, Control: Include, Module: fields[1]}, nil
+	}
+	if len(fields) < 3 || fields[2] == "" {
+		return nil, errors.New("expected type, control and module")
+	}
+	l := &Line{LineNo: n, Module: fields[2], Args: fields[3:]}
+	typ := strings.ToLower(fields[0])
+	l.IgnoreMissing = strings.HasPrefix(typ, "-")
+	l.Type = Type(strings.TrimPrefix(typ, "-"))
+	switch l.Type {
+	case Account, Auth, Password, Session:
+	default:
+		return nil, fmt.Errorf("invalid type %q", fields[0])
+	}
+	l.Control = Control(strings.ToLower(fields[1]))
+	if l.Control == Include {
+		return l, nil
+	}
+	// Bracketed controls have been unwrapped by splitFields.
+	if _, ok := simpleControls[l.Control]; !ok {
+		l.Control = Control("[" + fields[1] + "]")
+	}
+	if l.Actions, err = ParseControl(l.Control); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Parse parses a service file. It returns all the valid lines, and an
+// error joining a *ParseError for each invalid one. A continuation pending
+// at the end of the file ends the last line.
+func Parse(r io.Reader) ([]Line, error) {
+	var lines []Line
+	var errs []error
+	parse := func(n int, text string) {
+		if i := strings.IndexByte(text, '#'); i >= 0 {
+			text = text[:i]
+		}
+		l, err := parseLine(n, text)
+		if err != nil {
+			errs = append(errs, &ParseError{n, err})
+			return
+		}
+		if l != nil {
+			lines = append(lines, *l)
+		}
+	}
+	var cont string
+	n := 0
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		n++
+		text := cont + sc.Text()
+		if strings.HasSuffix(text, "\\") {
+			cont = strings.TrimSuffix(text, "\\") + " "
+			continue
+		}
+		cont = ""
+		parse(n, text)
+	}
+	if cont != "" {
+		parse(n, cont)
+	}
+	if err := sc.Err(); err != nil {
+		errs = append(errs, err)
+	}
+	return lines, errors.Join(errs...)
+}
@@ -0,0 +1,120 @@
+package pamconf
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	lines, err := Parse(strings.NewReader(`
+# comment
+auth	required	pam_env.so
+-Auth [success=1 default=ignore] pam_unix.so nullok [a b\] c] # comment
+auth requisite \
+	pam_deny.so
+session include common-session
+@include common-password
+`))
+	if err != nil {
+		t.Fatalf("parse #error: %v", err)
+	}
+	if len(lines) != 5 {
+		t.Fatalf("parse #error: expected 5 lines, got %v", len(lines))
+	}
+	if l := lines[0]; l.LineNo != 3 || l.Type != Auth || l.Control != Required ||
+		l.Module != "pam_env.so" || len(l.Args) != 0 || l.Action("success") != ActionOk ||
+		l.Action("auth_err") != ActionBad {
+		t.Fatalf("parse #error: unexpected line %+v", l)
+	}
+	if l := lines[1]; !l.IgnoreMissing || l.Control != "[success=1 default=ignore]" ||
+		!reflect.DeepEqual(l.Args, []string{"nullok", "a b] c"}) ||
+		l.Action("success") != "1" || l.Action("auth_err") != ActionIgnore {
+		t.Fatalf("parse #error: unexpected line %+v", l)
+	}
+	if l := lines[2]; l.LineNo != 6 || l.Control != Requisite || l.Module != "pam_deny.so" {
+		t.Fatalf("parse #error: unexpected line %+v", l)
+	}
+	if l := lines[3]; l.Type != Session || l.Control != Include || l.Actions != nil {
+		t.Fatalf("parse #error: unexpected line %+v", l)
+	}
+	if l := lines[4]; l.Type != "" || l.Control != Include || l.Module != "common-password" {
+		t.Fatalf("parse #error: unexpected line %+v", l)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	lines, err := Parse(strings.NewReader(`auth required
+auth required pam_permit.so
+foo required permit.so
+auth [success=ok default] permit.so
+auth [success=foo] permit.so
+auth [success=-1] permit.so
+auth [foo=ok] permit.so
+auth required permit.so [unterminated
+auth bogus permit.so
+auth required []
+@include
+@include a b`))
+	if len(lines) != 1 || lines[0].Module != "pam_permit.so" {
+		t.Fatalf("parse #error: unexpected lines %+v", lines)
+	}
+	var lineNos []int
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var perr *ParseError
+		if !errors.As(e, &perr) {
+			t.Fatalf("parse #error: unexpected error %v", e)
+		}
+		lineNos = append(lineNos, perr.LineNo)
+	}
+	if !reflect.DeepEqual(lineNos, []int{1, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12}) {
+		t.Fatalf("parse #error: unexpected errors %v", err)
+	}
+}
+
+func TestParse_ContinuationAtEOF(t *testing.T) {
+	for _, service := range []string{
+		"auth required pam_permit.so\nauth requisite \\\n\tpam_deny.so \\",
+		"auth required pam_permit.so\nauth requisite \\\n\tpam_deny.so \\\n",
+	} {
+		lines, err := Parse(strings.NewReader(service))
+		if err != nil {
+			t.Fatalf("parse #error: %v", err)
+		}
+		if len(lines) != 2 {
+			t.Fatalf("parse #error: expected 2 lines in %q, got %+v", service, lines)
+		}
+		if l := lines[1]; l.LineNo != 3 || l.Control != Requisite || l.Module != "pam_deny.so" || len(l.Args) != 0 {
+			t.Fatalf("parse #error: unexpected line %+v in %q", l, service)
+		}
+	}
+
+	_, err := Parse(strings.NewReader("auth required pam_permit.so\nauth requisite \\"))
+	var perr *ParseError
+	if !errors.As(err, &perr) || perr.LineNo != 2 {
+		t.Fatalf("parse #error: expected an error at line 2, got %v", err)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	for _, s := range []string{
+		"auth required pam_permit.so",
+		"-auth [success=1 default=ignore] pam_deny.so arg [a b\\] c]",
+		"auth include common\\\n# comment\n",
+		"session [",
+	} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, service string) {
+		lines, _ := Parse(strings.NewReader(service))
+		for _, l := range lines {
+			if l.Module == "" {
+				t.Fatalf("parse #error: empty module in %q", service)
+			}
+			if l.Control != Include && l.Actions == nil {
+				t.Fatalf("parse #error: missing actions in %q", service)
+			}
+		}
+	})
+}
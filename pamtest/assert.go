@@ -0,0 +1,99 @@
+package pamtest
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+// diffMaps returns a diff of the maps, one line per key, with the wanted
+// values prefixed by "-" and the actual values by "+". It returns an empty
+// string if the maps are equal.
+func diffMaps[K comparable](want, got map[K]string, name func(K) string) string {
+	keys := map[string]K{}
+	for k := range want {
+		keys[name(k)] = k
+	}
+	for k := range got {
+		keys[name(k)] = k
+	}
+	names := make([]string, 0, len(keys))
+	for n := range keys {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, n := range names {
+		w, inWant := want[keys[n]]
+		g, inGot := got[keys[n]]
+		if inWant == inGot && w == g {
+			continue
+		}
+		if inWant {
+			fmt.Fprintf(&b, "-%s=%q\n", n, w)
+		}
+		if inGot {
+			fmt.Fprintf(&b, "+%s=%q\n", n, g)
+		}
+	}
+	return b.String()
+}
+
+// AssertEnv fails the test if the transaction environment does not match
+// want exactly, reporting the differences as a diff.
+func AssertEnv(t testing.TB, tx EnvTransaction, want map[string]string) {
+	t.Helper()
+	got, err := tx.GetEnvList()
+	if err != nil {
+		t.Fatalf("getenvlist #error: %v", err)
+	}
+	if diff := diffMaps(want, got, func(s string) string { return s }); diff != "" {
+		t.Errorf("environment mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// AssertItems fails the test if the transaction items in want do not have
+// the wanted values, reporting the differences as a diff. An empty value
+// expects the item to be unset.
+func AssertItems(t testing.TB, tx ItemTransaction, want map[pam.Item]string) {
+	t.Helper()
+	got := map[pam.Item]string{}
+	for i := range want {
+		v, err := tx.GetItem(i)
+		if err != nil {
+			t.Fatalf("getitem #error: %v", err)
+		}
+		got[i] = v
+	}
+	if diff := diffMaps(want, got, pam.Item.String); diff != "" {
+		t.Errorf("items mismatch (-want +got):\n%s", diff)
+	}
+}
+
+// AssertData fails the test if the module data in want do not have the
+// wanted values, compared by their Go syntax representation and reported as
+// a diff. A nil value expects the data to be unset.
+func AssertData(t testing.TB, tx *Transaction, want map[string]any) {
+	t.Helper()
+	wantStr, got := map[string]string{}, map[string]string{}
+	for name, w := range want {
+		if w != nil {
+			wantStr[name] = fmt.Sprintf("%#v", w)
+		}
+		v, err := tx.GetData(name)
+		if errors.Is(err, ErrNoModuleData) {
+			continue
+		}
+		if err != nil {
+			t.Fatalf("getdata #error: %v", err)
+		}
+		got[name] = fmt.Sprintf("%#v", v)
+	}
+	if diff := diffMaps(wantStr, got, func(s string) string { return s }); diff != "" {
+		t.Errorf("module data mismatch (-want +got):\n%s", diff)
+	}
+}
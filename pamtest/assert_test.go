@@ -0,0 +1,35 @@
+package pamtest
+
+import (
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func TestDiffMaps(t *testing.T) {
+	diff := diffMaps(
+		map[string]string{"A": "1", "B": "2", "C": "3"},
+		map[string]string{"A": "1", "B": "x", "D": "4"},
+		func(s string) string { return s })
+	want := "-B=\"2\"\n+B=\"x\"\n-C=\"3\"\n+D=\"4\"\n"
+	if diff != want {
+		t.Fatalf("diff #error: expected %q, got %q", want, diff)
+	}
+	if diff := diffMaps(map[pam.Item]string{pam.User: "a"},
+		map[pam.Item]string{pam.User: "a"}, pam.Item.String); diff != "" {
+		t.Fatalf("diff #error: expected no diff, got %q", diff)
+	}
+}
+
+func TestAssert(t *testing.T) {
+	tx, _ := (&Service{}).StartFunc("login", "test", nil)
+	tx.SetItem(pam.Tty, "tty1")
+	tx.PutEnv("A=B")
+	AssertEnv(t, tx, map[string]string{"A": "B"})
+	AssertItems(t, tx, map[pam.Item]string{
+		pam.Service: "login",
+		pam.User:    "test",
+		pam.Tty:     "tty1",
+		pam.Rhost:   "",
+	})
+}
@@ -0,0 +1,108 @@
+package pamtest
+
+import (
+	"slices"
+
+	"github.com/msteinert/pam"
+)
+
+// PermitModule returns a module succeeding all the operations, as
+// pam_permit does. As pam_permit, it sets the user to "nobody" when
+// authenticating if no user is known yet.
+func PermitModule() *Service {
+	return &Service{
+		Authenticate: func(tx *Transaction, f pam.Flags) error {
+			if tx.items[pam.User] == "" {
+				tx.items[pam.User] = "nobody"
+			}
+			return nil
+		},
+	}
+}
+
+// DenyModule returns a module failing all the operations, with the status
+// pam_deny returns for each.
+func DenyModule() *Service {
+	return &Service{
+		Authenticate:  Fail(ErrAuth),
+		SetCred:       Fail(pam.ErrCred),
+		AcctMgmt:      Fail(ErrAuth),
+		ChangeAuthTok: Fail(pam.ErrAuthtok),
+		OpenSession:   Fail(pam.ErrSession),
+		CloseSession:  Fail(pam.ErrSession),
+	}
+}
+
+// UnixModule returns a module standing for pam_unix, with the passwords of
+// the users in place of the shadow file:
+//
+//   - Authenticate prompts for the user name, if needed, and for the
+//     password, or uses the token of the modules above it with the
+//     try_first_pass and use_first_pass arguments.
+//   - AcctMgmt fails with ErrUserUnknown for the users without a password.
+//   - ChangeAuthTok prompts for the new password twice, and changes it in
+//     passwords.
+//   - SetCred, OpenSession and CloseSession succeed.
+func UnixModule(passwords map[string]string) *Service {
+	return &Service{
+		Authenticate: Sequence(PromptUser("login: "), func(tx *Transaction, f pam.Flags) error {
+			pass, ok := tx.items[pam.Authtok]
+			useFirst := slices.Contains(tx.Args(), "use_first_pass")
+			switch {
+			case !ok && useFirst:
+				return pam.ErrAuthtokRecovery
+			case ok && (useFirst || slices.Contains(tx.Args(), "try_first_pass")):
+				if expected, known := passwords[tx.items[pam.User]]; known && expected == pass {
+					return nil
+				}
+				if useFirst {
+					return ErrAuth
+				}
+			}
+			return CheckPassword(passwords)(tx, f)
+		}),
+		AcctMgmt: func(tx *Transaction, f pam.Flags) error {
+			if _, ok := passwords[tx.items[pam.User]]; !ok {
+				return ErrUserUnknown
+			}
+			return nil
+		},
+		ChangeAuthTok: func(tx *Transaction, f pam.Flags) error {
+			user := tx.items[pam.User]
+			if _, ok := passwords[user]; !ok {
+				return ErrUserUnknown
+			}
+			if tx.ChauthtokPhase(f) == PhasePrelimCheck {
+				return nil
+			}
+			pass, err := tx.Conversation(pam.PromptEchoOff, "New password: ")
+			if err != nil {
+				return err
+			}
+			again, err := tx.Conversation(pam.PromptEchoOff, "Retype new password: ")
+			if err != nil {
+				return err
+			}
+			if pass != again {
+				tx.Errorf("Sorry, passwords do not match.")
+				return pam.ErrAuthtok
+			}
+			passwords[user] = pass
+			tx.items[pam.Authtok] = pass
+			return nil
+		},
+	}
+}
+
+// BuiltinModules returns the simulated modules standing for pam_permit,
+// pam_deny and pam_unix, keyed by their module paths, for a Stack running
+// the service files of the system, such as:
+//
+//	s := NewStack(BuiltinModules(map[string]string{"alice": "secret"}))
+func BuiltinModules(passwords map[string]string) map[string]*Service {
+	return map[string]*Service{
+		"pam_permit.so": PermitModule(),
+		"pam_deny.so":   DenyModule(),
+		"pam_unix.so":   UnixModule(passwords),
+	}
+}
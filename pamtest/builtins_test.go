@@ -0,0 +1,135 @@
+package pamtest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+const unixService = `
+auth	[success=1 default=ignore]	pam_unix.so
+auth	requisite			pam_deny.so
+auth	required			pam_permit.so
+account	required			pam_unix.so
+password	required		pam_unix.so
+session	required			pam_unix.so
+`
+
+func TestBuiltinModules(t *testing.T) {
+	passwords := map[string]string{"alice": "secret"}
+	s := NewStack(BuiltinModules(passwords))
+	if err := s.AddService("login", strings.NewReader(unixService)); err != nil {
+		t.Fatalf("addservice #error: %v", err)
+	}
+	script := NewScript(
+		Step{Style: pam.PromptEchoOn, Message: Exactly("login: "), Response: "alice"},
+		Step{Style: pam.PromptEchoOff, Message: Exactly("Password: "), Response: "secret"},
+		Step{Style: pam.PromptEchoOff, Message: Exactly("New password: "), Response: "changed"},
+		Step{Style: pam.PromptEchoOff, Message: Exactly("Retype new password: "), Response: "changed"},
+	)
+	tx, err := s.Start("login", "", script)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := tx.AcctMgmt(0); err != nil {
+		t.Fatalf("acctmgmt #error: %v", err)
+	}
+	if err := tx.ChangeAuthTok(0); err != nil {
+		t.Fatalf("chauthtok #error: %v", err)
+	}
+	if err := tx.OpenSession(0); err != nil {
+		t.Fatalf("opensession #error: %v", err)
+	}
+	if err := script.Done(); err != nil {
+		t.Fatalf("script #error: %v", err)
+	}
+	if passwords["alice"] != "changed" {
+		t.Fatalf("chauthtok #error: expected the password to be changed, got %q", passwords["alice"])
+	}
+
+	tx, err = s.StartFunc("login", "bob", func(s pam.Style, msg string) (string, error) {
+		return "secret", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err := tx.Authenticate(0); !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrAuth, err)
+	}
+	if err := tx.AcctMgmt(0); !errors.Is(err, ErrUserUnknown) {
+		t.Fatalf("acctmgmt #error: expected %v, got %v", ErrUserUnknown, err)
+	}
+}
+
+func TestBuiltinModules_FirstPass(t *testing.T) {
+	passwords := map[string]string{"alice": "secret"}
+	modules := BuiltinModules(passwords)
+	modules["pam_token.so"] = &Service{Authenticate: func(tx *Transaction, f pam.Flags) error {
+		return tx.SetItem(pam.Authtok, tx.Args()[0])
+	}}
+	tests := []struct {
+		name    string
+		service string
+		prompts int
+		err     error
+	}{
+		{"use_first_pass", `
+auth required pam_token.so secret
+auth required pam_unix.so use_first_pass`, 0, nil},
+		{"use_first_pass wrong", `
+auth required pam_token.so wrong
+auth required pam_unix.so use_first_pass`, 0, ErrAuth},
+		{"use_first_pass without token", `
+auth required pam_unix.so use_first_pass`, 0, pam.ErrAuthtokRecovery},
+		{"try_first_pass wrong", `
+auth required pam_token.so wrong
+auth required pam_unix.so try_first_pass`, 1, nil},
+		{"deny", `
+auth required pam_permit.so
+auth required pam_deny.so`, 0, ErrAuth},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			s := NewStack(modules)
+			if err := s.AddService("login", strings.NewReader(tc.service)); err != nil {
+				t.Fatalf("addservice #error: %v", err)
+			}
+			prompts := 0
+			tx, err := s.StartFunc("login", "alice", func(s pam.Style, msg string) (string, error) {
+				prompts++
+				return "secret", nil
+			})
+			if err != nil {
+				t.Fatalf("start #error: %v", err)
+			}
+			if err := tx.Authenticate(0); !errors.Is(err, tc.err) {
+				t.Fatalf("authenticate #error: expected %v, got %v", tc.err, err)
+			}
+			if prompts != tc.prompts {
+				t.Fatalf("authenticate #error: expected %d prompts, got %d", tc.prompts, prompts)
+			}
+		})
+	}
+}
+
+func TestPermitModule(t *testing.T) {
+	tx, err := PermitModule().Start("login", "", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if user, _ := tx.GetItem(pam.User); user != "nobody" {
+		t.Fatalf("authenticate #error: expected nobody, got %q", user)
+	}
+	tx, _ = DenyModule().Start("login", "alice", nil)
+	if err := tx.ChangeAuthTok(0); !errors.Is(err, pam.ErrAuthtok) {
+		t.Fatalf("chauthtok #error: expected %v, got %v", pam.ErrAuthtok, err)
+	}
+}
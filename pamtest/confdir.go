@@ -0,0 +1,125 @@
+package pamtest
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/pamconf"
+)
+
+// ModuleType is the management group of a PAM service line.
+type ModuleType = pamconf.Type
+
+// PAM management groups.
+const (
+	Account  = pamconf.Account
+	Auth     = pamconf.Auth
+	Password = pamconf.Password
+	Session  = pamconf.Session
+)
+
+// Control is the control value of a PAM service line. Values using the
+// bracketed syntax, such as "[success=ok default=bad]", can be used too.
+type Control = pamconf.Control
+
+// PAM control values.
+const (
+	Required   = pamconf.Required
+	Requisite  = pamconf.Requisite
+	Sufficient = pamconf.Sufficient
+	Optional   = pamconf.Optional
+	Include    = pamconf.Include
+	Substack   = pamconf.Substack
+)
+
+// ServiceLine is a line of a PAM service file.
+type ServiceLine struct {
+	Type    ModuleType
+	Control Control
+	Module  string
+	Args    []string
+}
+
+// String returns the line as it's written in a service file.
+func (l ServiceLine) String() string {
+	fields := []string{string(l.Type), string(l.Control), l.Module}
+	for _, arg := range l.Args {
+		if strings.ContainsAny(arg, " \t") {
+			arg = "[" + strings.ReplaceAll(arg, "]", "\\]") + "]"
+		}
+		fields = append(fields, arg)
+	}
+	return strings.Join(fields, "\t")
+}
+
+// CreateService writes a PAM service file named name into dir, returning
+// its path. The directory can be used as confdir for pam.StartConfDir.
+func CreateService(dir, name string, lines []ServiceLine) (string, error) {
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(l.String())
+		b.WriteByte('\n')
+	}
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// TestSetup manages a temporary PAM configuration directory for a test.
+type TestSetup struct {
+	t       testing.TB
+	workDir string
+}
+
+// NewTestSetup creates a TestSetup whose configuration directory is removed
+// when the test finishes.
+func NewTestSetup(t testing.TB) *TestSetup {
+	t.Helper()
+	return &TestSetup{t: t, workDir: t.TempDir()}
+}
+
+// WorkDir returns the configuration directory, to be used as confdir for
+// pam.StartConfDir.
+func (ts *TestSetup) WorkDir() string {
+	return ts.workDir
+}
+
+// CreateService writes a PAM service file into the configuration directory,
+// failing the test on error. It returns the path of the service file.
+func (ts *TestSetup) CreateService(name string, lines []ServiceLine) string {
+	ts.t.Helper()
+	path, err := CreateService(ts.workDir, name, lines)
+	if err != nil {
+		ts.t.Fatalf("create service #error: %v", err)
+	}
+	return path
+}
+
+// Credentials is a conversation handler answering the user name prompts
+// with User and the password prompts with Password, and ignoring the
+// messages. Unlike a Script, it doesn't check the conversation, for the
+// tests of the stacks rather than of their prompts.
+type Credentials struct {
+	User     string
+	Password string
+}
+
+// RespondPAM handles a conversation message with the credentials.
+func (c Credentials) RespondPAM(style pam.Style, msg string) (string, error) {
+	switch style {
+	case pam.PromptEchoOn:
+		return c.User, nil
+	case pam.PromptEchoOff:
+		return c.Password, nil
+	case pam.TextInfo, pam.ErrorMsg:
+		return "", nil
+	default:
+		return "", fmt.Errorf("%w: unexpected style %v", ErrConv, style)
+	}
+}
@@ -0,0 +1,84 @@
+package pamtest
+
+import (
+	"errors"
+	"os"
+	"os/user"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func TestServiceLine(t *testing.T) {
+	l := ServiceLine{Auth, "[success=ok default=bad]", "pam_echo.so",
+		[]string{"Hello", "a [message]"}}
+	s := l.String()
+	if s != "auth\t[success=ok default=bad]\tpam_echo.so\tHello\t[a [message\\]]" {
+		t.Fatalf("string #error: unexpected line %q", s)
+	}
+}
+
+func TestCreateService(t *testing.T) {
+	ts := NewTestSetup(t)
+	path := ts.CreateService("permit", []ServiceLine{
+		{Auth, Required, "pam_permit.so", nil},
+		{Account, Required, "pam_permit.so", nil},
+	})
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read #error: %v", err)
+	}
+	if string(data) != "auth\trequired\tpam_permit.so\naccount\trequired\tpam_permit.so\n" {
+		t.Fatalf("read #error: unexpected contents %q", data)
+	}
+}
+
+func TestTestSetup(t *testing.T) {
+	if !pam.CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	ts := NewTestSetup(t)
+	ts.CreateService("permit", []ServiceLine{{Auth, Required, "pam_permit.so", nil}})
+	ts.CreateService("deny", []ServiceLine{{Auth, Requisite, "pam_deny.so", nil}})
+
+	tx, err := pam.StartConfDir("permit", u.Username, NewScript(), ts.WorkDir())
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err = tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+
+	tx, err = pam.StartConfDir("deny", u.Username, NewScript(), ts.WorkDir())
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err = tx.Authenticate(0); err == nil {
+		t.Fatalf("authenticate #expected an error")
+	}
+}
+
+func TestCredentials(t *testing.T) {
+	s := &Service{Authenticate: Sequence(Info("Welcome"),
+		CheckPassword(map[string]string{"alice": "secret"}))}
+	for _, tc := range []struct {
+		creds    Credentials
+		expected error
+	}{
+		{Credentials{User: "alice", Password: "secret"}, nil},
+		{Credentials{User: "alice", Password: "wrong"}, ErrAuth},
+		{Credentials{User: "bob", Password: "secret"}, ErrAuth},
+	} {
+		tx, err := s.Start("login", "", tc.creds)
+		if err != nil {
+			t.Fatalf("start #error: %v", err)
+		}
+		if err := tx.Authenticate(0); !errors.Is(err, tc.expected) {
+			t.Fatalf("authenticate #error: %v: expected %v, got %v", tc.creds, tc.expected, err)
+		}
+	}
+	if _, err := (Credentials{}).RespondPAM(pam.BinaryPrompt, ""); !errors.Is(err, ErrConv) {
+		t.Fatalf("respondpam #error: expected %v, got %v", ErrConv, err)
+	}
+}
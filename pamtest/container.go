@@ -0,0 +1,127 @@
+package pamtest
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+// containerEnv is the environment variable used to mark the test running in
+// the container started by RunInContainer.
+const containerEnv = "GO_PAMTEST_CONTAINER"
+
+// ContainerOptions configures RunInContainer.
+type ContainerOptions struct {
+	// Image is the container image, it must provide the go toolchain
+	// or install it through Setup.
+	Image string
+	// Runtime is the container runtime command, docker or podman are
+	// looked up in PATH if not set.
+	Runtime string
+	// Setup are shell commands run in the container before the test,
+	// for example to install the PAM development files and the
+	// modules used by the test.
+	Setup []string
+	// Env are additional environment variables for the test.
+	Env []string
+}
+
+// findModuleRoot returns the directory containing the go.mod file of the
+// package in dir.
+func findModuleRoot(dir string) (string, error) {
+	for d := dir; ; d = filepath.Dir(d) {
+		if _, err := os.Stat(filepath.Join(d, "go.mod")); err == nil {
+			return d, nil
+		}
+		if filepath.Dir(d) == d {
+			return "", errors.New("go.mod not found")
+		}
+	}
+}
+
+// testRunPattern returns a -test.run pattern matching only the test name.
+func testRunPattern(name string) string {
+	var run []string
+	for _, part := range strings.Split(name, "/") {
+		run = append(run, "^"+regexp.QuoteMeta(part)+"$")
+	}
+	return strings.Join(run, "/")
+}
+
+// containerArgs returns the arguments of the runtime to run the test in
+// the container, with the module in root mounted as /src.
+func containerArgs(opts ContainerOptions, root, pkgDir, name string) ([]string, error) {
+	rel, err := filepath.Rel(root, pkgDir)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{"run", "--rm",
+		"-v", root + ":/src",
+		"-w", filepath.ToSlash(filepath.Join("/src", rel)),
+		"-e", containerEnv + "=" + name,
+	}
+	for _, e := range opts.Env {
+		args = append(args, "-e", e)
+	}
+	script := append([]string{}, opts.Setup...)
+	script = append(script, "go test -v -count=1 -run '"+testRunPattern(name)+"' .")
+	args = append(args, opts.Image, "sh", "-ec", strings.Join(script, "\n"))
+	return args, nil
+}
+
+// RunInContainer runs the current test again inside a throwaway container,
+// so that it can be checked against different distributions and Linux-PAM
+// versions. The module containing the test is mounted in the container
+// and the test is built and run there with go test. It returns true in the
+// calling test, after the container has finished, and false in the
+// container, which is then expected to carry on with the test:
+//
+//	if pamtest.RunInContainer(t, pamtest.ContainerOptions{
+//		Image: "golang:bookworm",
+//		Setup: []string{"apt-get update", "apt-get install -y libpam0g-dev"},
+//	}) {
+//		return
+//	}
+//
+// The calling test fails if the test in the container fails, and is
+// skipped if no container runtime is available.
+func RunInContainer(t *testing.T, opts ContainerOptions) bool {
+	t.Helper()
+	if os.Getenv(containerEnv) == t.Name() {
+		return false
+	}
+	runtime := opts.Runtime
+	if runtime == "" {
+		for _, r := range []string{"podman", "docker"} {
+			if _, err := exec.LookPath(r); err == nil {
+				runtime = r
+				break
+			}
+		}
+	}
+	if runtime == "" {
+		t.Skip("no container runtime available")
+	}
+	pkgDir, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("container #error: %v", err)
+	}
+	root, err := findModuleRoot(pkgDir)
+	if err != nil {
+		t.Fatalf("container #error: %v", err)
+	}
+	args, err := containerArgs(opts, root, pkgDir, t.Name())
+	if err != nil {
+		t.Fatalf("container #error: %v", err)
+	}
+	out, err := exec.Command(runtime, args...).CombinedOutput()
+	t.Logf("container output:\n%s", out)
+	if err != nil {
+		t.Fatalf("container %s #error: %v", opts.Image, err)
+	}
+	return true
+}
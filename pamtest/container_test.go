@@ -0,0 +1,47 @@
+package pamtest
+
+import (
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func TestContainerArgs(t *testing.T) {
+	args, err := containerArgs(ContainerOptions{
+		Image: "golang:bookworm",
+		Setup: []string{"apt-get update"},
+		Env:   []string{"A=B"},
+	}, "/home/user/pam", "/home/user/pam/pamtest", "TestFoo/bar.baz")
+	if err != nil {
+		t.Fatalf("args #error: %v", err)
+	}
+	expected := []string{"run", "--rm", "-v", "/home/user/pam:/src", "-w", "/src/pamtest",
+		"-e", containerEnv + "=TestFoo/bar.baz", "-e", "A=B", "golang:bookworm", "sh", "-ec",
+		"apt-get update\ngo test -v -count=1 -run '^TestFoo$/^bar\\.baz$' ."}
+	if !reflect.DeepEqual(args, expected) {
+		t.Fatalf("args #error: expected %q, got %q", expected, args)
+	}
+}
+
+func TestRunInContainer(t *testing.T) {
+	if os.Getenv("GO_PAMTEST_CONTAINER_IMAGE") == "" && os.Getenv(containerEnv) == "" {
+		t.Skip("GO_PAMTEST_CONTAINER_IMAGE is not set")
+	}
+	if RunInContainer(t, ContainerOptions{
+		Image: os.Getenv("GO_PAMTEST_CONTAINER_IMAGE"),
+		Setup: []string{"apt-get update -q", "apt-get install -qy libpam0g-dev"},
+	}) {
+		return
+	}
+	tx, err := pam.StartFunc("", "", func(s pam.Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err := CheckEnvRoundTrip(tx, []EnvVar{{"NAME", "value"}}); err != nil {
+		t.Fatalf("env #error: %v", err)
+	}
+}
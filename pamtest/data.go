@@ -0,0 +1,96 @@
+package pamtest
+
+import (
+	"errors"
+	"maps"
+	"slices"
+
+	"github.com/msteinert/pam"
+)
+
+// ErrNoModuleData is returned by GetData when the module data is not set.
+var ErrNoModuleData = pam.ErrNoModuleData
+
+// ErrDataReplaced is the status passed to the cleanup of module data
+// replaced by SetData, as PAM_DATA_REPLACE is.
+var ErrDataReplaced = errors.New("module data replaced")
+
+// DataCleanup releases module data, as the cleanup functions passed to
+// pam_set_data do. Status is the one of the last operation when the
+// transaction ends, nil if it succeeded, or ErrDataReplaced, and flags
+// are those passed to End, such as pam.DataSilent.
+type DataCleanup func(data any, status error, flags pam.Flags)
+
+// CleanupCall is a call of a DataCleanup recorded by a CleanupRecorder.
+type CleanupCall struct {
+	Data   any
+	Status error
+	Flags  pam.Flags
+}
+
+// CleanupRecorder records the calls of its Cleanup method, passed to
+// SetData, so that tests can check that the module data is released with
+// the expected status: ErrDataReplaced once replaced, or the status of the
+// last operation once the transaction ends.
+type CleanupRecorder struct {
+	Calls []CleanupCall
+}
+
+// Cleanup is a DataCleanup recording its calls.
+func (r *CleanupRecorder) Cleanup(data any, status error, f pam.Flags) {
+	r.Calls = append(r.Calls, CleanupCall{data, status, f})
+}
+
+type moduleData struct {
+	value   any
+	cleanup DataCleanup
+}
+
+// SetData stores module data in the transaction, as pam_set_data does,
+// calling the cleanup of the data it replaces, if any.
+func (t *Transaction) SetData(name string, data any, cleanup DataCleanup) error {
+	if err := t.faults.call("SetData"); err != nil {
+		return err
+	}
+	if name == "" {
+		return ErrBadItem
+	}
+	if old, ok := t.data[name]; ok && old.cleanup != nil {
+		old.cleanup(old.value, ErrDataReplaced, 0)
+	}
+	if t.data == nil {
+		t.data = map[string]moduleData{}
+	}
+	t.data[name] = moduleData{data, cleanup}
+	return nil
+}
+
+// GetData retrieves module data stored by SetData, failing with
+// ErrNoModuleData if not set.
+func (t *Transaction) GetData(name string) (any, error) {
+	if err := t.faults.call("GetData"); err != nil {
+		return nil, err
+	}
+	d, ok := t.data[name]
+	if !ok {
+		return nil, ErrNoModuleData
+	}
+	return d.value, nil
+}
+
+// DataNames returns the sorted names of the module data set in the
+// transaction, none once it has ended, as End releases all of it.
+func (t *Transaction) DataNames() []string {
+	return slices.Sorted(maps.Keys(t.data))
+}
+
+// cleanupData calls the cleanups of the module data, sorted by name to be
+// deterministic, and forgets it.
+func (t *Transaction) cleanupData(status error, f pam.Flags) {
+	for _, name := range slices.Sorted(maps.Keys(t.data)) {
+		if d := t.data[name]; d.cleanup != nil {
+			d.cleanup(d.value, status, f)
+		}
+	}
+	t.data = nil
+}
@@ -0,0 +1,187 @@
+package pamtest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// FailureCounter emulates the persistent failure counting of pam_faillock,
+// to test modules and applications implementing lockout handling. Failures
+// are kept in memory, or in a JSON file if Path is set.
+type FailureCounter struct {
+	// Deny is the number of failures locking a user, 3 if not set.
+	Deny int
+	// Interval is the time window where failures are counted, 15
+	// minutes if not set.
+	Interval time.Duration
+	// UnlockTime is the time after the last failure when a locked user
+	// is unlocked, 10 minutes if not set. Negative values never unlock.
+	UnlockTime time.Duration
+	// Now returns the current time, time.Now if not set.
+	Now func() time.Time
+	// Path is the file where the failures are stored, if set.
+	Path string
+
+	mu       sync.Mutex
+	failures map[string][]time.Time
+}
+
+func (c *FailureCounter) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+func (c *FailureCounter) load() error {
+	if c.Path == "" {
+		if c.failures == nil {
+			c.failures = map[string][]time.Time{}
+		}
+		return nil
+	}
+	c.failures = map[string][]time.Time{}
+	data, err := os.ReadFile(c.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &c.failures)
+}
+
+func (c *FailureCounter) store() error {
+	if c.Path == "" {
+		return nil
+	}
+	data, err := json.Marshal(c.failures)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(c.Path, data, 0600)
+}
+
+// recent returns the failures of the user within Interval.
+func (c *FailureCounter) recent(user string) []time.Time {
+	interval := c.Interval
+	if interval == 0 {
+		interval = 15 * time.Minute
+	}
+	now := c.now()
+	var recent []time.Time
+	for _, t := range c.failures[user] {
+		if now.Sub(t) < interval {
+			recent = append(recent, t)
+		}
+	}
+	return recent
+}
+
+// Fail records an authentication failure of the user.
+func (c *FailureCounter) Fail(user string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.load(); err != nil {
+		return err
+	}
+	c.failures[user] = append(c.recent(user), c.now())
+	return c.store()
+}
+
+// Reset clears the failures of the user.
+func (c *FailureCounter) Reset(user string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.load(); err != nil {
+		return err
+	}
+	delete(c.failures, user)
+	return c.store()
+}
+
+// Failures returns the number of recent failures of the user.
+func (c *FailureCounter) Failures(user string) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.load(); err != nil {
+		return 0, err
+	}
+	return len(c.recent(user)), nil
+}
+
+// Locked returns whether the user is locked.
+func (c *FailureCounter) Locked(user string) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.load(); err != nil {
+		return false, err
+	}
+	deny := c.Deny
+	if deny == 0 {
+		deny = 3
+	}
+	recent := c.recent(user)
+	if len(recent) < deny {
+		return false, nil
+	}
+	unlock := c.UnlockTime
+	if unlock == 0 {
+		unlock = 10 * time.Minute
+	}
+	return unlock < 0 || c.now().Sub(recent[len(recent)-1]) < unlock, nil
+}
+
+// Module returns a simulated module behaving as pam_faillock. In the auth
+// stack it takes the "preauth" argument, to fail if the user is locked,
+// "authfail" to record a failure and "authsucc" to reset the failures. In
+// the account stack it resets the failures.
+func (c *FailureCounter) Module() *Service {
+	return &Service{
+		Authenticate: func(tx *Transaction, f pam.Flags) error {
+			user := tx.items[pam.User]
+			if user == "" {
+				return ErrUserUnknown
+			}
+			for _, arg := range tx.Args() {
+				switch arg {
+				case "preauth":
+					locked, err := c.Locked(user)
+					if err != nil {
+						return err
+					}
+					if !locked {
+						return nil
+					}
+					if f&pam.Silent == 0 {
+						n, err := c.Failures(user)
+						if err != nil {
+							return err
+						}
+						tx.Conversation(pam.ErrorMsg,
+							fmt.Sprintf("The account is locked due to %d failed logins.", n))
+					}
+					return ErrAuth
+				case "authfail":
+					if err := c.Fail(user); err != nil {
+						return err
+					}
+					return ErrAuth
+				case "authsucc":
+					return c.Reset(user)
+				}
+			}
+			return ErrIgnore
+		},
+		AcctMgmt: func(tx *Transaction, f pam.Flags) error {
+			return c.Reset(tx.items[pam.User])
+		},
+	}
+}
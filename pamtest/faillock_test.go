@@ -0,0 +1,92 @@
+package pamtest
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+func TestFailureCounter(t *testing.T) {
+	now := time.Unix(0, 0)
+	c := &FailureCounter{
+		Deny:       2,
+		UnlockTime: time.Minute,
+		Now:        func() time.Time { return now },
+		Path:       filepath.Join(t.TempDir(), "faillock"),
+	}
+	for i := 0; i < 2; i++ {
+		if locked, err := c.Locked("test"); err != nil || locked {
+			t.Fatalf("locked #error: %v, %v", locked, err)
+		}
+		if err := c.Fail("test"); err != nil {
+			t.Fatalf("fail #error: %v", err)
+		}
+	}
+	reloaded := &FailureCounter{Deny: 2, UnlockTime: time.Minute, Now: c.Now, Path: c.Path}
+	if n, err := reloaded.Failures("test"); err != nil || n != 2 {
+		t.Fatalf("failures #error: expected 2, got %v, %v", n, err)
+	}
+	if locked, err := reloaded.Locked("test"); err != nil || !locked {
+		t.Fatalf("locked #error: expected locked, got %v, %v", locked, err)
+	}
+	now = now.Add(time.Minute)
+	if locked, err := c.Locked("test"); err != nil || locked {
+		t.Fatalf("locked #error: expected unlocked, got %v, %v", locked, err)
+	}
+	now = now.Add(time.Hour)
+	if n, err := c.Failures("test"); err != nil || n != 0 {
+		t.Fatalf("failures #error: expected 0, got %v, %v", n, err)
+	}
+}
+
+func TestFailureCounter_Module(t *testing.T) {
+	c := &FailureCounter{}
+	s := NewStack(map[string]*Service{
+		"pam_faillock.so": c.Module(),
+		"pam_unix.so":     {Authenticate: CheckPassword(map[string]string{"test": "secret"})},
+	})
+	if err := s.AddService("login", strings.NewReader(`
+auth required pam_faillock.so preauth
+auth [success=1 default=ignore] pam_unix.so
+auth [default=die] pam_faillock.so authfail
+auth sufficient pam_faillock.so authsucc
+account required pam_faillock.so`)); err != nil {
+		t.Fatalf("addservice #error: %v", err)
+	}
+	login := func(password string) ([]string, error) {
+		var errors []string
+		tx, err := s.StartFunc("login", "test", func(s pam.Style, msg string) (string, error) {
+			if s == pam.ErrorMsg {
+				errors = append(errors, msg)
+			}
+			return password, nil
+		})
+		if err != nil {
+			t.Fatalf("start #error: %v", err)
+		}
+		return errors, tx.Authenticate(0)
+	}
+	if _, err := login("wrong"); !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrAuth, err)
+	}
+	if _, err := login("secret"); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if n, _ := c.Failures("test"); n != 0 {
+		t.Fatalf("failures #error: expected 0, got %v", n)
+	}
+	for i := 0; i < 3; i++ {
+		login("wrong")
+	}
+	msgs, err := login("secret")
+	if !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrAuth, err)
+	}
+	if len(msgs) != 1 || msgs[0] != "The account is locked due to 3 failed logins." {
+		t.Fatalf("conversation #error: unexpected messages %q", msgs)
+	}
+}
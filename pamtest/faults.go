@@ -0,0 +1,38 @@
+package pamtest
+
+// Faults defines failures injected in fake transactions, to test the error
+// paths of applications and simulated modules.
+type Faults struct {
+	// Calls maps the names of Transaction methods, such as
+	// "Authenticate" or "SetItem", to the error they fail with.
+	Calls map[string]error
+	// Conversations maps the 1-based index of a conversation message to
+	// the error returned to the module instead of calling the
+	// application handler.
+	Conversations map[int]error
+	// CorruptResponse, if set, is called with the 1-based index of a
+	// conversation message and the application response, and returns
+	// the response delivered to the module.
+	CorruptResponse func(index int, response string) string
+}
+
+func (f *Faults) call(name string) error {
+	if f == nil {
+		return nil
+	}
+	return f.Calls[name]
+}
+
+func (f *Faults) conversation(index int) error {
+	if f == nil {
+		return nil
+	}
+	return f.Conversations[index]
+}
+
+func (f *Faults) response(index int, response string) string {
+	if f == nil || f.CorruptResponse == nil {
+		return response
+	}
+	return f.CorruptResponse(index, response)
+}
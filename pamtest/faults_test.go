@@ -0,0 +1,77 @@
+package pamtest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func TestFaults(t *testing.T) {
+	failure := errors.New("injected")
+	s := &Service{
+		Authenticate: CheckPassword(map[string]string{"test": "secret"}),
+		Faults: &Faults{
+			Calls: map[string]error{"SetItem": failure, "AcctMgmt": failure},
+		},
+	}
+	tx, _ := s.StartFunc("login", "test", func(s pam.Style, msg string) (string, error) {
+		return "secret", nil
+	})
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := tx.AcctMgmt(0); !errors.Is(err, failure) {
+		t.Fatalf("acct_mgmt #error: expected %v, got %v", failure, err)
+	}
+	if err := tx.SetItem(pam.Tty, "tty1"); !errors.Is(err, failure) {
+		t.Fatalf("setitem #error: expected %v, got %v", failure, err)
+	}
+	if _, err := tx.GetItem(pam.Tty); err != nil {
+		t.Fatalf("getitem #error: %v", err)
+	}
+
+	tx.SetFaults(&Faults{Conversations: map[int]error{2: ErrConv}})
+	if err := tx.Authenticate(0); !errors.Is(err, ErrConv) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrConv, err)
+	}
+	tx.SetFaults(&Faults{
+		CorruptResponse: func(index int, response string) string {
+			return response + "x"
+		},
+	})
+	if err := tx.Authenticate(0); !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrAuth, err)
+	}
+	tx.SetFaults(&Faults{
+		Calls: map[string]error{"PutEnv": failure, "GetEnvList": failure},
+	})
+	if err := tx.PutEnv("A=B"); !errors.Is(err, failure) {
+		t.Fatalf("putenv #error: expected %v, got %v", failure, err)
+	}
+	if _, err := tx.GetEnvList(); !errors.Is(err, failure) {
+		t.Fatalf("getenvlist #error: expected %v, got %v", failure, err)
+	}
+	tx.SetFaults(&Faults{Calls: map[string]error{"Close": failure}})
+	if err := tx.Close(); !errors.Is(err, failure) || tx.Closed() {
+		t.Fatalf("close #error: expected %v, got %v", failure, err)
+	}
+	tx.SetFaults(nil)
+	if err := tx.Close(); err != nil || !tx.Closed() {
+		t.Fatalf("close #error: %v", err)
+	}
+}
+
+func TestFaults_Stack(t *testing.T) {
+	var calls []string
+	s := NewStack(testModules(&calls))
+	s.AddServiceLines("test", []ServiceLine{{Auth, Required, "permit.so", nil}})
+	s.Faults = &Faults{Calls: map[string]error{"Authenticate": ErrAbort}}
+	tx, _ := s.Start("test", "", nil)
+	if err := tx.Authenticate(0); !errors.Is(err, ErrAbort) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrAbort, err)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("authenticate #error: unexpected calls %v", calls)
+	}
+}
@@ -0,0 +1,147 @@
+package pamtest
+
+import "github.com/msteinert/pam"
+
+// ModuleHandler is implemented by the modules under test, one method by PAM
+// operation, receiving the arguments of the module in the service.
+type ModuleHandler interface {
+	Authenticate(tx *Transaction, f pam.Flags, args []string) error
+	SetCred(tx *Transaction, f pam.Flags, args []string) error
+	AcctMgmt(tx *Transaction, f pam.Flags, args []string) error
+	ChangeAuthTok(tx *Transaction, f pam.Flags, args []string) error
+	OpenSession(tx *Transaction, f pam.Flags, args []string) error
+	CloseSession(tx *Transaction, f pam.Flags, args []string) error
+}
+
+// PasswordModule is implemented by the modules handling the two passes of
+// pam_chauthtok in separate methods. HandlerService runs them instead of
+// ChangeAuthTok for the handlers implementing it.
+type PasswordModule interface {
+	// PrelimCheck checks that the authentication token can be changed,
+	// such as whether the password database is reachable. It must not
+	// change anything.
+	PrelimCheck(tx *Transaction, f pam.Flags, args []string) error
+	// UpdateAuthTok changes the authentication token, once all the
+	// modules of the stack passed their preliminary check.
+	UpdateAuthTok(tx *Transaction, f pam.Flags, args []string) error
+}
+
+// Phase is the pass of pam_chauthtok a password module is called in.
+type Phase int
+
+// Passes of pam_chauthtok.
+const (
+	// PhaseUnknown is the phase of the flags with neither pam.PrelimCheck
+	// nor pam.UpdateAuthtok, as those of the fake transactions.
+	PhaseUnknown Phase = iota
+	// PhasePrelimCheck is the first pass, checking that the authentication
+	// token can be changed.
+	PhasePrelimCheck
+	// PhaseUpdateAuthTok is the second pass, changing the authentication
+	// token.
+	PhaseUpdateAuthTok
+)
+
+// String returns the name of the phase.
+func (p Phase) String() string {
+	switch p {
+	case PhasePrelimCheck:
+		return "prelim_check"
+	case PhaseUpdateAuthTok:
+		return "update_authtok"
+	default:
+		return "unknown"
+	}
+}
+
+// ChauthtokPhase returns the pass of pam_chauthtok of the flags a password
+// module is called with.
+func (t *Transaction) ChauthtokPhase(f pam.Flags) Phase {
+	switch {
+	case f&pam.PrelimCheck != 0:
+		return PhasePrelimCheck
+	case f&pam.UpdateAuthtok != 0:
+		return PhaseUpdateAuthTok
+	default:
+		return PhaseUnknown
+	}
+}
+
+// HandlerService returns a service running the operations of the handler,
+// for Service.Start or as a module of a Stack.
+//
+// If the handler is a PasswordModule too, ChangeAuthTok runs its methods
+// according to the phase of the flags. The fake transactions not passing
+// any, both are run in turn, as libpam does.
+func HandlerService(h ModuleHandler) *Service {
+	op := func(m func(*Transaction, pam.Flags, []string) error) OperationFunc {
+		return func(tx *Transaction, f pam.Flags) error {
+			return m(tx, f, tx.Args())
+		}
+	}
+	chauthtok := op(h.ChangeAuthTok)
+	if p, ok := h.(PasswordModule); ok {
+		chauthtok = passwordOperation(p)
+	}
+	return &Service{
+		Authenticate:  op(h.Authenticate),
+		SetCred:       op(h.SetCred),
+		AcctMgmt:      op(h.AcctMgmt),
+		ChangeAuthTok: chauthtok,
+		OpenSession:   op(h.OpenSession),
+		CloseSession:  op(h.CloseSession),
+	}
+}
+
+// passwordOperation returns the ChangeAuthTok operation of a password
+// module.
+func passwordOperation(p PasswordModule) OperationFunc {
+	return func(tx *Transaction, f pam.Flags) error {
+		switch tx.ChauthtokPhase(f) {
+		case PhasePrelimCheck:
+			return p.PrelimCheck(tx, f, tx.Args())
+		case PhaseUpdateAuthTok:
+			return p.UpdateAuthTok(tx, f, tx.Args())
+		}
+		if err := p.PrelimCheck(tx, f|pam.PrelimCheck, tx.Args()); err != nil {
+			return err
+		}
+		return p.UpdateAuthTok(tx, f|pam.UpdateAuthtok, tx.Args())
+	}
+}
+
+// BaseModuleHandler implements the ModuleHandler methods returning
+// ErrIgnore, so that the modules embedding it only implement the
+// operations they handle, as the modules not exporting the functions of a
+// management group.
+type BaseModuleHandler struct{}
+
+// Authenticate returns ErrIgnore.
+func (BaseModuleHandler) Authenticate(tx *Transaction, f pam.Flags, args []string) error {
+	return ErrIgnore
+}
+
+// SetCred returns ErrIgnore.
+func (BaseModuleHandler) SetCred(tx *Transaction, f pam.Flags, args []string) error {
+	return ErrIgnore
+}
+
+// AcctMgmt returns ErrIgnore.
+func (BaseModuleHandler) AcctMgmt(tx *Transaction, f pam.Flags, args []string) error {
+	return ErrIgnore
+}
+
+// ChangeAuthTok returns ErrIgnore.
+func (BaseModuleHandler) ChangeAuthTok(tx *Transaction, f pam.Flags, args []string) error {
+	return ErrIgnore
+}
+
+// OpenSession returns ErrIgnore.
+func (BaseModuleHandler) OpenSession(tx *Transaction, f pam.Flags, args []string) error {
+	return ErrIgnore
+}
+
+// CloseSession returns ErrIgnore.
+func (BaseModuleHandler) CloseSession(tx *Transaction, f pam.Flags, args []string) error {
+	return ErrIgnore
+}
@@ -0,0 +1,275 @@
+package pamtest
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+// counterModule counts the authentications of its transactions in their
+// module data, and greets the user once authenticated.
+type counterModule struct {
+	BaseModuleHandler
+	cleanups []string
+}
+
+func (m *counterModule) cleanup(data any, status error, f pam.Flags) {
+	switch {
+	case errors.Is(status, ErrDataReplaced):
+		m.cleanups = append(m.cleanups, "replaced")
+	case status != nil:
+		m.cleanups = append(m.cleanups, "failed")
+	default:
+		m.cleanups = append(m.cleanups, "ended")
+	}
+}
+
+func (m *counterModule) Authenticate(tx *Transaction, f pam.Flags, args []string) error {
+	n := 0
+	if v, err := tx.GetData("counter"); err == nil {
+		n = v.(int)
+	} else if !errors.Is(err, ErrNoModuleData) {
+		return err
+	}
+	if err := tx.SetData("counter", n+1, m.cleanup); err != nil {
+		return err
+	}
+	if slices.Contains(args, "deny") {
+		return ErrAuth
+	}
+	_, err := tx.Conversation(pam.TextInfo, "Hello "+strings.Join(args, " "))
+	return err
+}
+
+func (m *counterModule) AcctMgmt(tx *Transaction, f pam.Flags, args []string) error {
+	return ErrPermDenied
+}
+
+func TestHandlerService(t *testing.T) {
+	m := &counterModule{}
+	script := NewScript(
+		Step{Style: pam.TextInfo, Message: Exactly("Hello ")},
+		Step{Style: pam.TextInfo, Message: Exactly("Hello ")},
+	)
+	tx, err := HandlerService(m).Start("login", "alice", script)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	AssertData(t, tx, map[string]any{"counter": nil})
+	for range 2 {
+		if err := tx.Authenticate(0); err != nil {
+			t.Fatalf("authenticate #error: %v", err)
+		}
+	}
+	if err := script.Done(); err != nil {
+		t.Fatalf("script #error: %v", err)
+	}
+	AssertData(t, tx, map[string]any{"counter": 2})
+	if err := tx.AcctMgmt(0); !errors.Is(err, ErrPermDenied) {
+		t.Fatalf("acctmgmt #error: expected %v, got %v", ErrPermDenied, err)
+	}
+	if err := tx.OpenSession(0); !errors.Is(err, ErrIgnore) {
+		t.Fatalf("opensession #error: expected %v, got %v", ErrIgnore, err)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+	if expected := []string{"replaced", "failed"}; !slices.Equal(m.cleanups, expected) {
+		t.Fatalf("cleanup #error: expected %v, got %v", expected, m.cleanups)
+	}
+	if _, err := tx.GetData("counter"); !errors.Is(err, ErrNoModuleData) {
+		t.Fatalf("getdata #error: expected %v, got %v", ErrNoModuleData, err)
+	}
+	if err := tx.SetData("", 1, nil); !errors.Is(err, ErrBadItem) {
+		t.Fatalf("setdata #error: expected %v, got %v", ErrBadItem, err)
+	}
+}
+
+func TestHandlerService_Stack(t *testing.T) {
+	m := &counterModule{}
+	s := NewStack(map[string]*Service{"pam_counter.so": HandlerService(m)})
+	if err := s.AddService("login", strings.NewReader(`
+auth optional pam_counter.so deny
+auth required pam_counter.so world`)); err != nil {
+		t.Fatalf("addservice #error: %v", err)
+	}
+	script := NewScript(Step{Style: pam.TextInfo, Message: Exactly("Hello world")})
+	tx, err := s.Start("login", "alice", script)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	AssertData(t, tx, map[string]any{"counter": 2})
+	if err := tx.End(pam.DataSilent); err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+	if expected := []string{"replaced", "ended"}; !slices.Equal(m.cleanups, expected) {
+		t.Fatalf("cleanup #error: expected %v, got %v", expected, m.cleanups)
+	}
+}
+
+func TestTransaction_DataCleanup(t *testing.T) {
+	tx, err := DenyModule().Start("login", "alice", NewScript())
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	var r CleanupRecorder
+	for _, d := range []struct {
+		name  string
+		value int
+	}{{"b", 1}, {"a", 2}, {"b", 3}} {
+		if err := tx.SetData(d.name, d.value, r.Cleanup); err != nil {
+			t.Fatalf("setdata #error: %v", err)
+		}
+	}
+	if names := tx.DataNames(); !slices.Equal(names, []string{"a", "b"}) {
+		t.Fatalf("datanames #error: expected [a b], got %v", names)
+	}
+	if err := tx.Authenticate(0); !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrAuth, err)
+	}
+	if err := tx.End(pam.DataSilent); err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+	expected := []CleanupCall{
+		{1, ErrDataReplaced, 0},
+		{2, ErrAuth, pam.DataSilent},
+		{3, ErrAuth, pam.DataSilent},
+	}
+	if len(r.Calls) != len(expected) {
+		t.Fatalf("cleanup #error: expected %v, got %v", expected, r.Calls)
+	}
+	for i, c := range r.Calls {
+		if c.Data != expected[i].Data || !errors.Is(c.Status, expected[i].Status) || c.Flags != expected[i].Flags {
+			t.Fatalf("cleanup #error: expected %v, got %v", expected[i], c)
+		}
+	}
+	if names := tx.DataNames(); len(names) != 0 {
+		t.Fatalf("datanames #error: data left once ended: %v", names)
+	}
+}
+
+// passwordModule records the phases of its calls, failing the preliminary
+// check with the "busy" argument.
+type passwordModule struct {
+	BaseModuleHandler
+	calls []string
+}
+
+func (m *passwordModule) PrelimCheck(tx *Transaction, f pam.Flags, args []string) error {
+	m.calls = append(m.calls, strings.Join(append([]string{tx.ChauthtokPhase(f).String()}, args...), " "))
+	if slices.Contains(args, "busy") {
+		return pam.ErrAuthtokLockBusy
+	}
+	return nil
+}
+
+func (m *passwordModule) UpdateAuthTok(tx *Transaction, f pam.Flags, args []string) error {
+	m.calls = append(m.calls, strings.Join(append([]string{tx.ChauthtokPhase(f).String()}, args...), " "))
+	return nil
+}
+
+func TestHandlerService_PasswordModule(t *testing.T) {
+	m := &passwordModule{}
+	tx, err := HandlerService(m).Start("passwd", "alice", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if p := tx.ChauthtokPhase(pam.Silent); p != PhaseUnknown {
+		t.Fatalf("phase #error: expected %v, got %v", PhaseUnknown, p)
+	}
+	if err := tx.ChangeAuthTok(0); err != nil {
+		t.Fatalf("chauthtok #error: %v", err)
+	}
+	if err := tx.ChangeAuthTok(pam.UpdateAuthtok); err != nil {
+		t.Fatalf("chauthtok #error: %v", err)
+	}
+	if expected := []string{"prelim_check", "update_authtok", "update_authtok"}; !slices.Equal(m.calls, expected) {
+		t.Fatalf("calls #error: expected %v, got %v", expected, m.calls)
+	}
+}
+
+func TestHandlerService_PasswordStack(t *testing.T) {
+	tests := []struct {
+		name    string
+		service string
+		err     error
+		calls   []string
+	}{
+		{"two passes", `
+password required pam_pw.so first
+password required pam_pw.so second`, nil, []string{
+			"prelim_check first", "prelim_check second",
+			"update_authtok first", "update_authtok second"}},
+		{"failed check", `
+password required pam_pw.so busy
+password required pam_pw.so second`, pam.ErrAuthtokLockBusy, []string{
+			"prelim_check busy", "prelim_check second"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &passwordModule{}
+			s := NewStack(map[string]*Service{"pam_pw.so": HandlerService(m)})
+			if err := s.AddService("passwd", strings.NewReader(tc.service)); err != nil {
+				t.Fatalf("addservice #error: %v", err)
+			}
+			tx, err := s.Start("passwd", "alice", nil)
+			if err != nil {
+				t.Fatalf("start #error: %v", err)
+			}
+			if err := tx.ChangeAuthTok(0); !errors.Is(err, tc.err) {
+				t.Fatalf("chauthtok #error: expected %v, got %v", tc.err, err)
+			}
+			if !slices.Equal(m.calls, tc.calls) {
+				t.Fatalf("calls #error: expected %v, got %v", tc.calls, m.calls)
+			}
+		})
+	}
+}
+
+// greeterModule greets the user and warns about the account expiry.
+type greeterModule struct {
+	BaseModuleHandler
+}
+
+func (greeterModule) Authenticate(tx *Transaction, f pam.Flags, args []string) error {
+	if err := tx.Info("Hello %s", strings.Join(args, " ")); err != nil {
+		return err
+	}
+	return tx.Errorf("Account expires in %d days", 3)
+}
+
+func TestTransaction_InfoErrorf(t *testing.T) {
+	script := NewScript(
+		Step{Style: pam.TextInfo, Message: Exactly("Hello world")},
+		Step{Style: pam.ErrorMsg, Message: Exactly("Account expires in 3 days")},
+	)
+	s := NewStack(map[string]*Service{"pam_greeter.so": HandlerService(greeterModule{})})
+	if err := s.AddService("login", strings.NewReader("auth required pam_greeter.so world")); err != nil {
+		t.Fatalf("addservice #error: %v", err)
+	}
+	tx, err := s.Start("login", "alice", script)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err := tx.Authenticate(pam.Silent); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := script.Done(); err != nil {
+		t.Fatalf("script #error: %v", err)
+	}
+	if err := tx.Info("outside of an operation"); !errors.Is(err, ErrConv) {
+		t.Fatalf("info #error: expected %v, got %v", ErrConv, err)
+	}
+}
@@ -0,0 +1,74 @@
+package pamtest
+
+import (
+	"github.com/msteinert/pam"
+)
+
+// Fail returns an operation that always fails with err.
+func Fail(err error) OperationFunc {
+	return func(*Transaction, pam.Flags) error {
+		return err
+	}
+}
+
+// Sequence returns an operation running all the ops in order, stopping at
+// the first failure.
+func Sequence(ops ...OperationFunc) OperationFunc {
+	return func(tx *Transaction, f pam.Flags) error {
+		for _, op := range ops {
+			if err := tx.run(op, f); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// Info returns an operation sending msg as TextInfo, unless the Silent
+// flag is set.
+func Info(msg string) OperationFunc {
+	return func(tx *Transaction, f pam.Flags) error {
+		if f&pam.Silent != 0 {
+			return nil
+		}
+		_, err := tx.Conversation(pam.TextInfo, msg)
+		return err
+	}
+}
+
+// PromptUser returns an operation prompting for the user name, if it's not
+// already set, in the same way pam_get_user does.
+func PromptUser(prompt string) OperationFunc {
+	return func(tx *Transaction, f pam.Flags) error {
+		if tx.items[pam.User] != "" {
+			return nil
+		}
+		if p := tx.items[pam.UserPrompt]; p != "" {
+			prompt = p
+		}
+		user, err := tx.Conversation(pam.PromptEchoOn, prompt)
+		if err != nil {
+			return err
+		}
+		tx.items[pam.User] = user
+		return nil
+	}
+}
+
+// CheckPassword returns an authentication operation that prompts for the
+// user name (if needed) and for the password, returning ErrAuth if the
+// password does not match the one in the passwords map.
+func CheckPassword(passwords map[string]string) OperationFunc {
+	return Sequence(PromptUser("login: "), func(tx *Transaction, f pam.Flags) error {
+		pass, err := tx.Conversation(pam.PromptEchoOff, "Password: ")
+		if err != nil {
+			return err
+		}
+		expected, ok := passwords[tx.items[pam.User]]
+		if !ok || expected != pass {
+			return ErrAuth
+		}
+		tx.items[pam.Authtok] = pass
+		return nil
+	})
+}
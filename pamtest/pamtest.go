@@ -0,0 +1,404 @@
+// Package pamtest provides fakes for testing code that uses the PAM
+// application API without a PAM stack.
+//
+// A Service describes how a fake PAM service behaves for each operation,
+// and Service.Start returns a Transaction with the same method set as
+// *pam.Transaction. Items and environment variables are kept in memory, and
+// the application's conversation handler is invoked by the scripted
+// operations exactly as a real module would do.
+//
+// A Stack goes further, running pam.d-style service files against
+// simulated modules, so that the behavior of whole stacks can be tested
+// deterministically without libpam, even on the platforms without it or
+// without pam_start_confdir. BuiltinModules stand for pam_permit, pam_deny
+// and pam_unix in the service files of the system.
+//
+// Modules written in Go can be unit tested the same way: HandlerService
+// runs the operations of a ModuleHandler, whose transactions keep the
+// module data of SetData and GetData, and whose conversations are those of
+// a Script, checked with AssertItems, AssertEnv and AssertData, and the
+// cleanups of the module data with a CleanupRecorder.
+//
+// Real stacks, using pam_permit, pam_deny or any other module, can be
+// written by TestSetup into a throwaway directory for pam.StartConfDir,
+// and authenticated through with Credentials.
+package pamtest
+
+import (
+	"errors"
+	"fmt"
+	"iter"
+	"maps"
+	"slices"
+	"strings"
+
+	"github.com/msteinert/pam"
+)
+
+// Errors returned by the fake transactions and by the operation helpers.
+// They are the pam return types, so that fake and real transactions can
+// be checked in the same way.
+var (
+	// ErrAbort is returned when a service can't be started.
+	ErrAbort = pam.ErrAbort
+	// ErrAuth is returned when the provided credentials are not valid.
+	ErrAuth = pam.ErrAuth
+	// ErrBadItem is returned when an item or environment variable is
+	// not valid.
+	ErrBadItem = pam.ErrBadItem
+	// ErrConv is returned when the conversation handler fails.
+	ErrConv = pam.ErrConv
+	// ErrIgnore is returned by modules that should be ignored.
+	ErrIgnore = pam.ErrIgnore
+	// ErrMaxtries is returned when the user can't try again.
+	ErrMaxtries = pam.ErrMaxtries
+	// ErrModuleUnknown is returned when a module is not available.
+	ErrModuleUnknown = pam.ErrModuleUnknown
+	// ErrNewAuthtokReqd is returned when the authentication token must be
+	// changed.
+	ErrNewAuthtokReqd = pam.ErrNewAuthtokReqd
+	// ErrPermDenied is returned when permission is denied.
+	ErrPermDenied = pam.ErrPermDenied
+	// ErrUserUnknown is returned when the user is not known.
+	ErrUserUnknown = pam.ErrUserUnknown
+)
+
+// OperationFunc implements a PAM operation of a fake service.
+type OperationFunc func(tx *Transaction, f pam.Flags) error
+
+// Service describes the behaviour of a fake PAM service. Operations that
+// are not defined always succeed.
+type Service struct {
+	Authenticate  OperationFunc
+	SetCred       OperationFunc
+	AcctMgmt      OperationFunc
+	ChangeAuthTok OperationFunc
+	OpenSession   OperationFunc
+	CloseSession  OperationFunc
+	// Faults are injected in the transactions of the service.
+	Faults *Faults
+}
+
+// Transaction is a fake PAM transaction backed by in-memory state.
+type Transaction struct {
+	service *Service
+	handler pam.ConversationHandler
+	items   map[pam.Item]string
+	env     map[string]string
+	args    []string
+	faults  *Faults
+	convs   int
+	closed  bool
+	data    map[string]moduleData
+	status  error
+	// flags are those of the running operation.
+	flags pam.Flags
+}
+
+// Start initiates a new fake PAM transaction for the service.
+func (s *Service) Start(service, user string, handler pam.ConversationHandler) (*Transaction, error) {
+	tx := &Transaction{
+		service: s,
+		handler: handler,
+		items:   map[pam.Item]string{pam.Service: service},
+		env:     map[string]string{},
+		faults:  s.Faults,
+	}
+	if user != "" {
+		tx.items[pam.User] = user
+	}
+	return tx, nil
+}
+
+// StartFunc registers the handler func as a conversation handler.
+func (s *Service) StartFunc(service, user string, handler func(pam.Style, string) (string, error)) (*Transaction, error) {
+	return s.Start(service, user, pam.ConversationFunc(handler))
+}
+
+// SetItem sets a PAM information item.
+func (t *Transaction) SetItem(i pam.Item, item string) error {
+	if err := t.faults.call("SetItem"); err != nil {
+		return err
+	}
+	if i <= 0 {
+		return ErrBadItem
+	}
+	t.items[i] = item
+	return nil
+}
+
+// GetItem retrieves a PAM information item.
+func (t *Transaction) GetItem(i pam.Item) (string, error) {
+	if err := t.faults.call("GetItem"); err != nil {
+		return "", err
+	}
+	if i <= 0 {
+		return "", ErrBadItem
+	}
+	return t.items[i], nil
+}
+
+// GetUserItem returns the name of the user.
+func (t *Transaction) GetUserItem() (string, error) {
+	return t.GetItem(pam.User)
+}
+
+// SetRHost sets the name of the remote host.
+func (t *Transaction) SetRHost(host string) error {
+	return t.setStringItem(pam.Rhost, host)
+}
+
+// SetTTY sets the name of the terminal.
+func (t *Transaction) SetTTY(tty string) error {
+	return t.setStringItem(pam.Tty, tty)
+}
+
+// SetUserPrompt sets the prompt asking for the user name.
+func (t *Transaction) SetUserPrompt(prompt string) error {
+	return t.setStringItem(pam.UserPrompt, prompt)
+}
+
+// GetAuthtokItem returns the authentication token, as the modules read it.
+// Unlike pam.Transaction, which only the applications use, it doesn't fail
+// with ErrBadItem, so that the modules under test can read it.
+func (t *Transaction) GetAuthtokItem() (string, error) {
+	return t.GetItem(pam.Authtok)
+}
+
+// setStringItem sets the item, failing with ErrBadItem for the values C
+// would truncate, as pam.Transaction does.
+func (t *Transaction) setStringItem(i pam.Item, value string) error {
+	if strings.IndexByte(value, 0) >= 0 {
+		return ErrBadItem
+	}
+	return t.SetItem(i, value)
+}
+
+func (t *Transaction) call(name string, op OperationFunc, f pam.Flags) error {
+	if err := t.faults.call(name); err != nil {
+		return err
+	}
+	t.status = t.run(op, f)
+	return t.status
+}
+
+func (t *Transaction) run(op OperationFunc, f pam.Flags) error {
+	if op == nil {
+		return nil
+	}
+	defer func(flags pam.Flags) { t.flags = flags }(t.flags)
+	t.flags = f
+	return op(t, f)
+}
+
+// Authenticate runs the Authenticate operation of the fake service.
+func (t *Transaction) Authenticate(f pam.Flags) error {
+	return t.call("Authenticate", t.service.Authenticate, f)
+}
+
+// SetCred runs the SetCred operation of the fake service.
+func (t *Transaction) SetCred(f pam.Flags) error {
+	return t.call("SetCred", t.service.SetCred, f)
+}
+
+// AcctMgmt runs the AcctMgmt operation of the fake service.
+func (t *Transaction) AcctMgmt(f pam.Flags) error {
+	return t.call("AcctMgmt", t.service.AcctMgmt, f)
+}
+
+// ChangeAuthTok runs the ChangeAuthTok operation of the fake service.
+func (t *Transaction) ChangeAuthTok(f pam.Flags) error {
+	return t.call("ChangeAuthTok", t.service.ChangeAuthTok, f)
+}
+
+// OpenSession runs the OpenSession operation of the fake service.
+func (t *Transaction) OpenSession(f pam.Flags) error {
+	return t.call("OpenSession", t.service.OpenSession, f)
+}
+
+// CloseSession runs the CloseSession operation of the fake service.
+func (t *Transaction) CloseSession(f pam.Flags) error {
+	return t.call("CloseSession", t.service.CloseSession, f)
+}
+
+// Close terminates the fake transaction, calling the cleanups of the module
+// data with the status of the last operation. Closed reports whether it was
+// called, to check that applications release their transactions.
+func (t *Transaction) Close() error {
+	return t.End(0)
+}
+
+// End terminates the fake transaction as Close does, passing the flags,
+// such as pam.DataSilent, to the cleanups of the module data.
+func (t *Transaction) End(f pam.Flags) error {
+	if err := t.faults.call("Close"); err != nil {
+		return err
+	}
+	if !t.closed {
+		t.cleanupData(t.status, f)
+	}
+	t.closed = true
+	return nil
+}
+
+// Closed returns whether the transaction has been closed.
+func (t *Transaction) Closed() bool {
+	return t.closed
+}
+
+// PutEnv adds or changes the value of PAM environment variables, following
+// the same rules of pam_putenv.
+func (t *Transaction) PutEnv(nameval string) error {
+	if err := t.faults.call("PutEnv"); err != nil {
+		return err
+	}
+	name, value, set := strings.Cut(nameval, "=")
+	if name == "" {
+		return ErrBadItem
+	}
+	if !set {
+		if _, ok := t.env[name]; !ok {
+			return ErrBadItem
+		}
+		delete(t.env, name)
+		return nil
+	}
+	t.env[name] = value
+	return nil
+}
+
+// GetEnv is used to retrieve a PAM environment variable.
+func (t *Transaction) GetEnv(name string) string {
+	return t.env[name]
+}
+
+// GetEnvOk retrieves a PAM environment variable, returning whether it is
+// set.
+func (t *Transaction) GetEnvOk(name string) (string, bool) {
+	value, ok := t.env[name]
+	return value, ok
+}
+
+// GetEnvList returns a copy of the PAM environment as a map.
+func (t *Transaction) GetEnvList() (map[string]string, error) {
+	if err := t.faults.call("GetEnvList"); err != nil {
+		return nil, err
+	}
+	env := make(map[string]string, len(t.env))
+	for k, v := range t.env {
+		env[k] = v
+	}
+	return env, nil
+}
+
+// Env returns an iterator over a copy of the PAM environment, in the order
+// of the names.
+func (t *Transaction) Env() iter.Seq2[string, string] {
+	env := maps.Clone(t.env)
+	return func(yield func(name, value string) bool) {
+		for _, name := range slices.Sorted(maps.Keys(env)) {
+			if !yield(name, env[name]) {
+				return
+			}
+		}
+	}
+}
+
+// PutEnvs sets the variables of the PAM environment, in the order of their
+// names, joining the failures of those that can't be set.
+func (t *Transaction) PutEnvs(env map[string]string) error {
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(env)) {
+		if strings.Contains(name, "=") {
+			errs = append(errs, ErrBadItem)
+			continue
+		}
+		if err := t.PutEnv(name + "=" + env[name]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CopyEnv sets the NAME=value entries of from accepted by filter, all of
+// them if it is nil, in the PAM environment.
+func (t *Transaction) CopyEnv(from []string, filter func(name string) bool) error {
+	var errs []error
+	for _, entry := range from {
+		name, _, ok := strings.Cut(entry, "=")
+		if !ok || name == "" || (filter != nil && !filter(name)) {
+			continue
+		}
+		if err := t.PutEnv(entry); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Args returns the arguments of the module running an operation in a
+// simulated Stack.
+func (t *Transaction) Args() []string {
+	return t.args
+}
+
+// Conversation sends a message to the application conversation handler,
+// as a module would do.
+func (t *Transaction) Conversation(s pam.Style, msg string) (string, error) {
+	t.convs++
+	if err := t.faults.conversation(t.convs); err != nil {
+		return "", err
+	}
+	if t.handler == nil {
+		return "", ErrConv
+	}
+	r, err := t.handler.RespondPAM(s, msg)
+	if err != nil {
+		return "", ErrConv
+	}
+	return t.faults.response(t.convs, r), nil
+}
+
+// Info sends the formatted message as TextInfo, as pam_info does, unless
+// the running operation was called with the Silent flag.
+func (t *Transaction) Info(format string, args ...any) error {
+	return t.message(pam.TextInfo, format, args...)
+}
+
+// Errorf sends the formatted message as ErrorMsg, as pam_error does,
+// unless the running operation was called with the Silent flag.
+func (t *Transaction) Errorf(format string, args ...any) error {
+	return t.message(pam.ErrorMsg, format, args...)
+}
+
+func (t *Transaction) message(s pam.Style, format string, args ...any) error {
+	if t.flags&pam.Silent != 0 {
+		return nil
+	}
+	_, err := t.Conversation(s, fmt.Sprintf(format, args...))
+	return err
+}
+
+// SetFaults replaces the faults injected in the transaction.
+func (t *Transaction) SetFaults(f *Faults) {
+	t.faults = f
+}
+
+// BinaryConversation sends a binary message to the application conversation
+// handler, as a module would do. It fails with ErrConv if the handler is
+// not a pam.BinaryConversationHandler.
+func (t *Transaction) BinaryConversation(ptr pam.BinaryPointer) ([]byte, error) {
+	t.convs++
+	if err := t.faults.conversation(t.convs); err != nil {
+		return nil, err
+	}
+	cb, ok := t.handler.(pam.BinaryConversationHandler)
+	if !ok {
+		return nil, ErrConv
+	}
+	r, err := cb.RespondPAMBinary(ptr)
+	if err != nil {
+		return nil, ErrConv
+	}
+	return r, nil
+}
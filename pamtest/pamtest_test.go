@@ -0,0 +1,202 @@
+package pamtest
+
+import (
+	"errors"
+	"iter"
+	"maps"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+// transaction is the set of methods shared by *pam.Transaction and
+// *Transaction that applications can depend on.
+type transaction interface {
+	SetItem(pam.Item, string) error
+	GetItem(pam.Item) (string, error)
+	GetUserItem() (string, error)
+	SetRHost(string) error
+	SetTTY(string) error
+	SetUserPrompt(string) error
+	Authenticate(pam.Flags) error
+	SetCred(pam.Flags) error
+	AcctMgmt(pam.Flags) error
+	ChangeAuthTok(pam.Flags) error
+	OpenSession(pam.Flags) error
+	CloseSession(pam.Flags) error
+	PutEnv(string) error
+	GetEnv(string) string
+	GetEnvOk(string) (string, bool)
+	GetEnvList() (map[string]string, error)
+	Env() iter.Seq2[string, string]
+	PutEnvs(map[string]string) error
+	CopyEnv([]string, func(string) bool) error
+	Close() error
+	End(pam.Flags) error
+}
+
+var (
+	_ transaction = (*pam.Transaction)(nil)
+	_ transaction = (*Transaction)(nil)
+)
+
+func TestAuthenticate(t *testing.T) {
+	s := &Service{
+		Authenticate: CheckPassword(map[string]string{"test": "secret"}),
+	}
+	tx, err := s.StartFunc("login", "", func(s pam.Style, msg string) (string, error) {
+		switch s {
+		case pam.PromptEchoOn:
+			return "test", nil
+		case pam.PromptEchoOff:
+			return "secret", nil
+		}
+		return "", errors.New("unexpected")
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	user, err := tx.GetItem(pam.User)
+	if err != nil {
+		t.Fatalf("getitem #error: %v", err)
+	}
+	if user != "test" {
+		t.Fatalf("getitem #error: expected test, got %v", user)
+	}
+	service, _ := tx.GetItem(pam.Service)
+	if service != "login" {
+		t.Fatalf("getitem #error: expected login, got %v", service)
+	}
+}
+
+func TestAuthenticate_WrongPassword(t *testing.T) {
+	s := &Service{
+		Authenticate: CheckPassword(map[string]string{"test": "secret"}),
+	}
+	tx, _ := s.StartFunc("login", "test", func(s pam.Style, msg string) (string, error) {
+		return "wrong", nil
+	})
+	err := tx.Authenticate(0)
+	if !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrAuth, err)
+	}
+}
+
+func TestAuthenticate_ConversationError(t *testing.T) {
+	s := &Service{
+		Authenticate: CheckPassword(map[string]string{"test": "secret"}),
+	}
+	tx, _ := s.StartFunc("login", "test", func(s pam.Style, msg string) (string, error) {
+		return "", errors.New("cancelled")
+	})
+	err := tx.Authenticate(0)
+	if !errors.Is(err, ErrConv) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrConv, err)
+	}
+}
+
+func TestOperations(t *testing.T) {
+	var infos []string
+	failure := errors.New("session failure")
+	s := &Service{
+		AcctMgmt:    Sequence(Info("first"), Info("second")),
+		OpenSession: Fail(failure),
+	}
+	tx, _ := s.StartFunc("login", "test", func(s pam.Style, msg string) (string, error) {
+		if s != pam.TextInfo {
+			return "", errors.New("unexpected")
+		}
+		infos = append(infos, msg)
+		return "", nil
+	})
+	if err := tx.AcctMgmt(0); err != nil {
+		t.Fatalf("acct_mgmt #error: %v", err)
+	}
+	if len(infos) != 2 || infos[0] != "first" || infos[1] != "second" {
+		t.Fatalf("acct_mgmt #error: unexpected messages %v", infos)
+	}
+	if err := tx.AcctMgmt(pam.Silent); err != nil {
+		t.Fatalf("acct_mgmt #error: %v", err)
+	}
+	if len(infos) != 2 {
+		t.Fatalf("acct_mgmt #error: unexpected messages %v", infos)
+	}
+	if err := tx.SetCred(pam.EstablishCred); err != nil {
+		t.Fatalf("setcred #error: %v", err)
+	}
+	if err := tx.OpenSession(0); !errors.Is(err, failure) {
+		t.Fatalf("open_session #error: expected %v, got %v", failure, err)
+	}
+}
+
+func TestEnv(t *testing.T) {
+	tx, _ := (&Service{}).StartFunc("", "", nil)
+	for _, s := range []string{"VAL1=1", "VAL2=", "VAL3=3"} {
+		if err := tx.PutEnv(s); err != nil {
+			t.Fatalf("putenv #error: %v", err)
+		}
+	}
+	if err := tx.PutEnv("VAL3"); err != nil {
+		t.Fatalf("putenv #error: %v", err)
+	}
+	if err := tx.PutEnv("VAL4"); err == nil {
+		t.Fatalf("putenv #expected an error")
+	}
+	if err := tx.PutEnv("=value"); err == nil {
+		t.Fatalf("putenv #expected an error")
+	}
+	if s := tx.GetEnv("VAL1"); s != "1" {
+		t.Fatalf("getenv #error: expected 1, got %v", s)
+	}
+	if s, ok := tx.GetEnvOk("VAL2"); !ok || s != "" {
+		t.Fatalf("getenvok #error: expected VAL2 to be set, got %q, %v", s, ok)
+	}
+	if _, ok := tx.GetEnvOk("VAL4"); ok {
+		t.Fatalf("getenvok #error: expected VAL4 to be unset")
+	}
+	m, err := tx.GetEnvList()
+	if err != nil {
+		t.Fatalf("getenvlist #error: %v", err)
+	}
+	if len(m) != 2 || m["VAL1"] != "1" || m["VAL2"] != "" {
+		t.Fatalf("getenvlist #error: unexpected environment %v", m)
+	}
+	if err := tx.PutEnvs(map[string]string{"VAL1": "one", "BAD=": "x"}); !errors.Is(err, ErrBadItem) {
+		t.Fatalf("putenvs #error: expected %v, got %v", ErrBadItem, err)
+	}
+	if err := tx.CopyEnv([]string{"LANG=C", "HOME=/root"}, func(name string) bool { return name == "LANG" }); err != nil {
+		t.Fatalf("copyenv #error: %v", err)
+	}
+	if m := maps.Collect(tx.Env()); len(m) != 3 || m["VAL1"] != "one" || m["LANG"] != "C" {
+		t.Fatalf("env #error: unexpected environment %v", m)
+	}
+}
+
+func TestTypedItems(t *testing.T) {
+	s := &Service{Authenticate: func(tx *Transaction, f pam.Flags) error {
+		if tok, err := tx.GetAuthtokItem(); err != nil || tok != "secret" {
+			t.Fatalf("getauthtokitem #error: expected secret, got %q, %v", tok, err)
+		}
+		return nil
+	}}
+	tx, _ := s.StartFunc("", "alice", nil)
+	if user, err := tx.GetUserItem(); err != nil || user != "alice" {
+		t.Fatalf("getuseritem #error: expected alice, got %q, %v", user, err)
+	}
+	if err := tx.SetRHost("localhost"); err != nil {
+		t.Fatalf("setrhost #error: %v", err)
+	}
+	if err := tx.SetTTY("tty\x001"); !errors.Is(err, ErrBadItem) {
+		t.Fatalf("settty #error: expected %v, got %v", ErrBadItem, err)
+	}
+	if err := tx.SetItem(pam.Authtok, "secret"); err != nil {
+		t.Fatalf("setitem #error: %v", err)
+	}
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+}
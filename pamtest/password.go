@@ -0,0 +1,52 @@
+package pamtest
+
+import (
+	"cmp"
+
+	"github.com/msteinert/pam"
+)
+
+// PasswordOptions define how GetPassword obtains the password. Their
+// fields decode the stock arguments of the modules with modargs, such as
+// try_first_pass, the others being tagged out.
+type PasswordOptions struct {
+	// UseFirstPass only uses the authentication token set by the modules
+	// above, failing with pam.ErrAuthtokRecovery if there is none.
+	UseFirstPass bool
+	// TryFirstPass uses the authentication token set by the modules above,
+	// prompting for the password if there is none.
+	TryFirstPass bool
+	// Prompt is the prompt for the password, "Password: " if empty.
+	Prompt string `pam:"-"`
+	// Store sets the password prompted for as the authentication token,
+	// for the modules below to use it.
+	Store bool `pam:"-"`
+}
+
+// GetPassword returns the password of the user, either the authentication
+// token set by the modules above it or a new one prompted for, according
+// to opts, as the stacked modules pass it on to each other.
+func (t *Transaction) GetPassword(opts PasswordOptions) (string, error) {
+	if opts.UseFirstPass || opts.TryFirstPass {
+		tok, err := t.GetItem(pam.Authtok)
+		if err != nil {
+			return "", err
+		}
+		if tok != "" {
+			return tok, nil
+		}
+		if opts.UseFirstPass {
+			return "", pam.ErrAuthtokRecovery
+		}
+	}
+	pass, err := t.Conversation(pam.PromptEchoOff, cmp.Or(opts.Prompt, "Password: "))
+	if err != nil {
+		return "", err
+	}
+	if opts.Store {
+		if err := t.SetItem(pam.Authtok, pass); err != nil {
+			return "", err
+		}
+	}
+	return pass, nil
+}
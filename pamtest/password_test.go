@@ -0,0 +1,97 @@
+package pamtest
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/modargs"
+)
+
+// passwordChecker checks the password of alice, decoding its options from
+// its arguments.
+type passwordChecker struct {
+	BaseModuleHandler
+	passwords []string
+}
+
+func (m *passwordChecker) Authenticate(tx *Transaction, f pam.Flags, args []string) error {
+	opts := PasswordOptions{Store: true}
+	if err := modargs.Decode(args, &opts); err != nil {
+		return err
+	}
+	pass, err := tx.GetPassword(opts)
+	if err != nil {
+		return err
+	}
+	m.passwords = append(m.passwords, pass)
+	if pass != "secret" {
+		return ErrAuth
+	}
+	return nil
+}
+
+func TestTransaction_GetPassword(t *testing.T) {
+	tests := []struct {
+		name      string
+		service   string
+		prompts   int
+		passwords []string
+		err       error
+	}{
+		{"forwarded", `
+auth required pam_check.so
+auth required pam_check.so use_first_pass
+auth required pam_check.so try_first_pass`, 1, []string{"secret", "secret", "secret"}, nil},
+		{"prompts again", `
+auth required pam_check.so
+auth required pam_check.so`, 2, []string{"secret", "secret"}, nil},
+		{"try without token", `
+auth required pam_check.so try_first_pass`, 1, []string{"secret"}, nil},
+		{"use without token", `
+auth required pam_check.so use_first_pass`, 0, nil, pam.ErrAuthtokRecovery},
+		{"invalid argument", `
+auth required pam_check.so store`, 0, nil, modargs.ErrInvalid},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := &passwordChecker{}
+			s := NewStack(map[string]*Service{"pam_check.so": HandlerService(m)})
+			if err := s.AddService("login", strings.NewReader(tc.service)); err != nil {
+				t.Fatalf("addservice #error: %v", err)
+			}
+			prompts := 0
+			tx, err := s.StartFunc("login", "alice", func(s pam.Style, msg string) (string, error) {
+				if s != pam.PromptEchoOff || msg != "Password: " {
+					return "", errors.New("unexpected message")
+				}
+				prompts++
+				return "secret", nil
+			})
+			if err != nil {
+				t.Fatalf("start #error: %v", err)
+			}
+			if err := tx.Authenticate(0); !errors.Is(err, tc.err) {
+				t.Fatalf("authenticate #error: expected %v, got %v", tc.err, err)
+			}
+			if prompts != tc.prompts || strings.Join(m.passwords, ",") != strings.Join(tc.passwords, ",") {
+				t.Fatalf("authenticate #error: expected %d prompts and %v, got %d and %v",
+					tc.prompts, tc.passwords, prompts, m.passwords)
+			}
+		})
+	}
+}
+
+func TestTransaction_GetPassword_NotStored(t *testing.T) {
+	tx, _ := (&Service{}).StartFunc("login", "alice", func(s pam.Style, msg string) (string, error) {
+		return msg, nil
+	})
+	pass, err := tx.GetPassword(PasswordOptions{Prompt: "PIN: "})
+	if err != nil || pass != "PIN: " {
+		t.Fatalf("getpassword #error: expected the prompt, got %q, %v", pass, err)
+	}
+	if tok, _ := tx.GetAuthtokItem(); tok != "" {
+		t.Fatalf("getpassword #error: unexpected token %q", tok)
+	}
+}
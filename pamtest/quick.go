@@ -0,0 +1,198 @@
+package pamtest
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"strings"
+
+	"github.com/msteinert/pam"
+)
+
+const (
+	nameStart = "ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz_"
+	nameChars = nameStart + "0123456789"
+)
+
+// randomText returns a string of at most size runes without NUL
+// characters, mixing ASCII, separators and multi-byte runes.
+func randomText(r *rand.Rand, size int) string {
+	pool := []rune("abcXYZ019 =:;,./\\\"'$%\t\né€😀")
+	var b strings.Builder
+	for n := r.Intn(size + 1); n > 0; n-- {
+		b.WriteRune(pool[r.Intn(len(pool))])
+	}
+	return b.String()
+}
+
+func randomName(r *rand.Rand, size int) string {
+	var b strings.Builder
+	b.WriteByte(nameStart[r.Intn(len(nameStart))])
+	for n := r.Intn(size + 1); n > 0; n-- {
+		b.WriteByte(nameChars[r.Intn(len(nameChars))])
+	}
+	return b.String()
+}
+
+// EnvVar is a valid PAM environment variable. It implements quick.Generator
+// so that it can be used with testing/quick.
+type EnvVar struct {
+	Name  string
+	Value string
+}
+
+// Generate returns a random EnvVar.
+func (EnvVar) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(EnvVar{randomName(r, size), randomText(r, size)})
+}
+
+// EnvTransaction is the environment API of a transaction.
+type EnvTransaction interface {
+	PutEnv(nameval string) error
+	GetEnv(name string) string
+	GetEnvList() (map[string]string, error)
+}
+
+// CheckEnvRoundTrip sets the variables in the transaction environment and
+// checks that GetEnv and GetEnvList return them unchanged. Later variables
+// override earlier ones with the same name.
+func CheckEnvRoundTrip(tx EnvTransaction, vars []EnvVar) error {
+	expected := map[string]string{}
+	for _, v := range vars {
+		if err := tx.PutEnv(v.Name + "=" + v.Value); err != nil {
+			return fmt.Errorf("putenv %q: %w", v.Name, err)
+		}
+		expected[v.Name] = v.Value
+	}
+	for name, value := range expected {
+		if got := tx.GetEnv(name); got != value {
+			return fmt.Errorf("getenv %q: expected %q, got %q", name, value, got)
+		}
+	}
+	env, err := tx.GetEnvList()
+	if err != nil {
+		return fmt.Errorf("getenvlist: %w", err)
+	}
+	for name, value := range expected {
+		if got, ok := env[name]; !ok || got != value {
+			return fmt.Errorf("getenvlist %q: expected %q, got %q", name, value, got)
+		}
+	}
+	return nil
+}
+
+// ItemValue is a value for an item that applications can both set and
+// get. It implements quick.Generator so that it can be used with
+// testing/quick.
+type ItemValue struct {
+	Item  pam.Item
+	Value string
+}
+
+var roundTripItems = []pam.Item{pam.User, pam.Tty, pam.Rhost, pam.Ruser, pam.UserPrompt}
+
+// Generate returns a random ItemValue.
+func (ItemValue) Generate(r *rand.Rand, size int) reflect.Value {
+	return reflect.ValueOf(ItemValue{
+		roundTripItems[r.Intn(len(roundTripItems))],
+		randomText(r, size),
+	})
+}
+
+// ItemTransaction is the items API of a transaction.
+type ItemTransaction interface {
+	SetItem(i pam.Item, item string) error
+	GetItem(i pam.Item) (string, error)
+}
+
+// CheckItemRoundTrip sets the items in the transaction and checks that
+// GetItem returns them unchanged. Later values override earlier ones for
+// the same item.
+func CheckItemRoundTrip(tx ItemTransaction, items []ItemValue) error {
+	expected := map[pam.Item]string{}
+	for _, i := range items {
+		if err := tx.SetItem(i.Item, i.Value); err != nil {
+			return fmt.Errorf("setitem %d: %w", i.Item, err)
+		}
+		expected[i.Item] = i.Value
+	}
+	for item, value := range expected {
+		got, err := tx.GetItem(item)
+		if err != nil {
+			return fmt.Errorf("getitem %d: %w", item, err)
+		}
+		if got != value {
+			return fmt.Errorf("getitem %d: expected %q, got %q", item, value, got)
+		}
+	}
+	return nil
+}
+
+// Exchange is a conversation message sent by a module and the expected
+// response of the application.
+type Exchange struct {
+	Style    pam.Style
+	Message  string
+	Response string
+}
+
+// Exchanges is a sequence of conversation messages. It implements
+// quick.Generator so that random conversations can be used with
+// testing/quick.
+type Exchanges []Exchange
+
+var textStyles = []pam.Style{pam.PromptEchoOff, pam.PromptEchoOn, pam.ErrorMsg, pam.TextInfo}
+
+// Generate returns random Exchanges.
+func (Exchanges) Generate(r *rand.Rand, size int) reflect.Value {
+	exchanges := make(Exchanges, r.Intn(size+1))
+	for i := range exchanges {
+		e := Exchange{
+			Style:   textStyles[r.Intn(len(textStyles))],
+			Message: randomText(r, size),
+		}
+		if e.Style == pam.PromptEchoOff || e.Style == pam.PromptEchoOn {
+			e.Response = randomText(r, size)
+		}
+		exchanges[i] = e
+	}
+	return reflect.ValueOf(exchanges)
+}
+
+// Script returns a Strict Script answering to the exchanges.
+func (e Exchanges) Script() *Script {
+	steps := make([]Step, len(e))
+	for i, x := range e {
+		steps[i] = Step{Style: x.Style, Message: Exactly(x.Message), Response: x.Response}
+	}
+	return NewScript(steps...)
+}
+
+// Operation returns an operation sending the exchanges messages in order,
+// as a module would do, and failing with ErrConv if a response doesn't
+// match the expected one.
+func (e Exchanges) Operation() OperationFunc {
+	return func(tx *Transaction, f pam.Flags) error {
+		for i, x := range e {
+			r, err := tx.Conversation(x.Style, x.Message)
+			if err != nil {
+				return err
+			}
+			if r != x.Response {
+				return fmt.Errorf("exchange %d: expected %q, got %q: %w", i, x.Response, r, ErrConv)
+			}
+		}
+		return nil
+	}
+}
+
+// CheckConversationRoundTrip checks that the messages of a conversation
+// are delivered to handler unchanged, and that the expected responses are
+// returned to the module.
+func CheckConversationRoundTrip(handler pam.ConversationHandler, exchanges Exchanges) error {
+	tx, err := (&Service{Authenticate: exchanges.Operation()}).Start("", "", handler)
+	if err != nil {
+		return err
+	}
+	return tx.Authenticate(0)
+}
@@ -0,0 +1,81 @@
+package pamtest
+
+import (
+	"testing"
+	"testing/quick"
+
+	"github.com/msteinert/pam"
+)
+
+func TestEnvRoundTrip(t *testing.T) {
+	f := func(vars []EnvVar) bool {
+		tx, _ := (&Service{}).Start("", "", nil)
+		if err := CheckEnvRoundTrip(tx, vars); err != nil {
+			t.Log(err)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatalf("env #error: %v", err)
+	}
+}
+
+func TestEnvRoundTrip_PAM(t *testing.T) {
+	f := func(vars []EnvVar) bool {
+		tx, err := pam.StartFunc("", "", func(s pam.Style, msg string) (string, error) {
+			return "", nil
+		})
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		if err := CheckEnvRoundTrip(tx, vars); err != nil {
+			t.Log(err)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatalf("env #error: %v", err)
+	}
+}
+
+func TestItemRoundTrip(t *testing.T) {
+	f := func(items []ItemValue) bool {
+		tx, _ := (&Service{}).Start("", "", nil)
+		if err := CheckItemRoundTrip(tx, items); err != nil {
+			t.Log(err)
+			return false
+		}
+		ptx, err := pam.StartFunc("", "", func(s pam.Style, msg string) (string, error) {
+			return "", nil
+		})
+		if err != nil {
+			t.Log(err)
+			return false
+		}
+		if err := CheckItemRoundTrip(ptx, items); err != nil {
+			t.Log(err)
+			return false
+		}
+		return true
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatalf("item #error: %v", err)
+	}
+}
+
+func TestConversationRoundTrip(t *testing.T) {
+	f := func(exchanges Exchanges) bool {
+		script := exchanges.Script()
+		if err := CheckConversationRoundTrip(script, exchanges); err != nil {
+			t.Log(err)
+			return false
+		}
+		return script.Done() == nil
+	}
+	if err := quick.Check(f, nil); err != nil {
+		t.Fatalf("conversation #error: %v", err)
+	}
+}
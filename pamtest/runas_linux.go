@@ -0,0 +1,118 @@
+package pamtest
+
+import (
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+// runAsEnv is the environment variable used to mark the subprocess started
+// by RunAs.
+const runAsEnv = "GO_PAMTEST_RUNAS"
+
+// RunAsOptions defines the credentials used by RunAs.
+type RunAsOptions struct {
+	// UID is the user ID of the subprocess.
+	UID uint32
+	// GID is the group ID of the subprocess.
+	GID uint32
+	// Groups are the supplementary groups of the subprocess.
+	Groups []uint32
+	// UserNamespace runs the subprocess in a new user namespace where
+	// UID and GID are mapped to the current user, so that no privileges
+	// are needed to start it.
+	UserNamespace bool
+	// Env are additional environment variables for the subprocess.
+	Env []string
+}
+
+// RunAs runs the current test again in a subprocess using the credentials
+// defined by opts. It returns true in the calling test, after the
+// subprocess has finished, and false in the subprocess, which is then
+// expected to carry on with the test:
+//
+//	if pamtest.RunAs(t, pamtest.RunAsOptions{UID: 65534, GID: 65534}) {
+//		return
+//	}
+//	// Code running as the nobody user.
+//
+// The calling test fails if the subprocess fails. Unless a user namespace
+// is used, the test binary is copied to a temporary directory readable by
+// any user, while the working directory is kept: it must be accessible to
+// the target user if the test relies on relative paths.
+func RunAs(t *testing.T, opts RunAsOptions) bool {
+	t.Helper()
+	if os.Getenv(runAsEnv) == t.Name() {
+		return false
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("run as #error: %v", err)
+	}
+	if !opts.UserNamespace {
+		// The test binary is usually in a directory that is only
+		// accessible to the current user.
+		exe = copyExecutable(t, exe)
+	}
+	cmd := exec.Command(exe, "-test.run="+testRunPattern(t.Name()), "-test.v")
+	cmd.Env = append(os.Environ(), runAsEnv+"="+t.Name())
+	cmd.Env = append(cmd.Env, opts.Env...)
+	cmd.SysProcAttr = &syscall.SysProcAttr{}
+	if opts.UserNamespace {
+		cmd.SysProcAttr.Cloneflags = syscall.CLONE_NEWUSER
+		cmd.SysProcAttr.UidMappings = []syscall.SysProcIDMap{
+			{ContainerID: int(opts.UID), HostID: os.Getuid(), Size: 1},
+		}
+		cmd.SysProcAttr.GidMappings = []syscall.SysProcIDMap{
+			{ContainerID: int(opts.GID), HostID: os.Getgid(), Size: 1},
+		}
+	} else {
+		cmd.SysProcAttr.Credential = &syscall.Credential{
+			Uid:    opts.UID,
+			Gid:    opts.GID,
+			Groups: opts.Groups,
+		}
+	}
+	out, err := cmd.CombinedOutput()
+	t.Logf("subprocess output:\n%s", out)
+	if err != nil {
+		t.Fatalf("run as %d:%d #error: %v", opts.UID, opts.GID, err)
+	}
+	return true
+}
+
+// copyExecutable copies the executable to a directory accessible to any
+// user, which is removed when the test finishes.
+func copyExecutable(t *testing.T, exe string) string {
+	t.Helper()
+	dir, err := os.MkdirTemp("", "pamtest-runas-")
+	if err != nil {
+		t.Fatalf("run as #error: %v", err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	if err := os.Chmod(dir, 0755); err != nil {
+		t.Fatalf("run as #error: %v", err)
+	}
+	src, err := os.Open(exe)
+	if err != nil {
+		t.Fatalf("run as #error: %v", err)
+	}
+	defer src.Close()
+	dst := filepath.Join(dir, filepath.Base(exe))
+	f, err := os.OpenFile(dst, os.O_CREATE|os.O_WRONLY, 0755)
+	if err != nil {
+		t.Fatalf("run as #error: %v", err)
+	}
+	if _, err := io.Copy(f, src); err != nil {
+		f.Close()
+		t.Fatalf("run as #error: %v", err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatalf("run as #error: %v", err)
+	}
+	return dst
+}
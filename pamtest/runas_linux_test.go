@@ -0,0 +1,37 @@
+package pamtest
+
+import (
+	"os"
+	"testing"
+)
+
+func TestRunAs(t *testing.T) {
+	if os.Getuid() != 0 && os.Getenv(runAsEnv) == "" {
+		t.Skip("run this test as root")
+	}
+	if RunAs(t, RunAsOptions{UID: 65534, GID: 65534}) {
+		return
+	}
+	if os.Getuid() != 65534 || os.Getgid() != 65534 {
+		t.Fatalf("run as #error: running as %d:%d", os.Getuid(), os.Getgid())
+	}
+}
+
+func TestRunAs_UserNamespace(t *testing.T) {
+	if _, err := os.Stat("/proc/self/ns/user"); err != nil {
+		t.Skip("user namespaces are not supported")
+	}
+	if os.Getenv(runAsEnv) == "" {
+		if data, err := os.ReadFile("/proc/sys/kernel/unprivileged_userns_clone"); err == nil && string(data) == "0\n" {
+			t.Skip("unprivileged user namespaces are disabled")
+		}
+	}
+	t.Run("subtest", func(t *testing.T) {
+		if RunAs(t, RunAsOptions{UID: 0, GID: 0, UserNamespace: true}) {
+			return
+		}
+		if os.Getuid() != 0 {
+			t.Fatalf("run as #error: running as %d", os.Getuid())
+		}
+	})
+}
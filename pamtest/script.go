@@ -0,0 +1,175 @@
+package pamtest
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/msteinert/pam"
+)
+
+// Matcher reports whether a conversation message is the expected one.
+type Matcher func(msg string) bool
+
+// Any matches any message.
+func Any() Matcher {
+	return func(string) bool { return true }
+}
+
+// Exactly matches a message equal to s.
+func Exactly(s string) Matcher {
+	return func(msg string) bool { return msg == s }
+}
+
+// Contains matches a message containing s.
+func Contains(s string) Matcher {
+	return func(msg string) bool { return strings.Contains(msg, s) }
+}
+
+// Regexp matches a message matching the regular expression expr.
+func Regexp(expr string) Matcher {
+	re := regexp.MustCompile(expr)
+	return re.MatchString
+}
+
+// BinaryMatcher reports whether a binary conversation message is the
+// expected one.
+type BinaryMatcher func(ptr pam.BinaryPointer) bool
+
+// Step is a message expected by a Script and the response to it.
+type Step struct {
+	// Style is the expected message style.
+	Style pam.Style
+	// Message matches the expected message, nil matches any message.
+	Message Matcher
+	// Response is returned to the module when the step is matched.
+	Response string
+	// Binary matches the expected message of BinaryPrompt steps, nil
+	// matches any message.
+	Binary BinaryMatcher
+	// BinaryResponse is returned to the module when a BinaryPrompt step is
+	// matched.
+	BinaryResponse []byte
+	// Err, if set, is returned to the module instead of the response.
+	Err error
+}
+
+// Mode defines how a Script handles messages that don't match its next
+// step.
+type Mode int
+
+const (
+	// Strict makes any unexpected message a failure.
+	Strict Mode = iota
+	// Loose ignores unexpected messages that don't require a response
+	// (TextInfo and ErrorMsg), while unexpected prompts are still
+	// failures.
+	Loose
+)
+
+// ErrUnexpectedMessage is wrapped by the failures of the scripts receiving
+// a message that doesn't match their next step.
+var ErrUnexpectedMessage = errors.New("unexpected message")
+
+// Script is a conversation handler replying to an ordered sequence of
+// expected messages, such as those of the tests or of the automated su
+// and sudo flows. A message that doesn't match the next step makes the
+// conversation fail, and the mismatch is reported by Err, describing both
+// the expected and the received messages.
+type Script struct {
+	Mode  Mode
+	Steps []Step
+
+	mu  sync.Mutex
+	pos int
+	err error
+}
+
+// NewScript creates a Strict script for the steps.
+func NewScript(steps ...Step) *Script {
+	return &Script{Steps: steps}
+}
+
+// RespondPAM handles a conversation message following the script.
+func (s *Script) RespondPAM(style pam.Style, msg string) (string, error) {
+	step, err := s.next(style, fmt.Sprintf("%q", msg), func(step Step) bool {
+		return step.Message == nil || step.Message(msg)
+	})
+	if err != nil {
+		return "", err
+	}
+	return step.Response, nil
+}
+
+func (s *Script) next(style pam.Style, desc string, match func(Step) bool) (Step, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return Step{}, s.err
+	}
+	if s.pos < len(s.Steps) {
+		step := s.Steps[s.pos]
+		if step.Style == style && match(step) {
+			s.pos++
+			return step, step.Err
+		}
+	}
+	if s.Mode == Loose && (style == pam.TextInfo || style == pam.ErrorMsg) {
+		return Step{}, nil
+	}
+	switch {
+	case s.pos >= len(s.Steps):
+		s.err = fmt.Errorf("%w after the end of the script: %v %s", ErrUnexpectedMessage, style, desc)
+	case s.Steps[s.pos].Style != style:
+		s.err = fmt.Errorf("%w at step %d: expected %v, got %v %s", ErrUnexpectedMessage,
+			s.pos, s.Steps[s.pos].Style, style, desc)
+	default:
+		s.err = fmt.Errorf("%w at step %d: %v %s not matched", ErrUnexpectedMessage, s.pos, style, desc)
+	}
+	return Step{}, s.err
+}
+
+// Err returns the first mismatch found by the script, if any.
+func (s *Script) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Done returns an error if the script failed or not all its steps have been
+// matched.
+func (s *Script) Done() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err != nil {
+		return s.err
+	}
+	if s.pos < len(s.Steps) {
+		return fmt.Errorf("%d script steps not reached", len(s.Steps)-s.pos)
+	}
+	return nil
+}
+
+// BinaryScript is a Script that also handles BinaryPrompt messages.
+type BinaryScript struct {
+	Script
+}
+
+// NewBinaryScript creates a Strict binary script for the steps.
+func NewBinaryScript(steps ...Step) *BinaryScript {
+	return &BinaryScript{Script{Steps: steps}}
+}
+
+// RespondPAMBinary handles a binary conversation message following the
+// script.
+func (s *BinaryScript) RespondPAMBinary(ptr pam.BinaryPointer) ([]byte, error) {
+	step, err := s.next(pam.BinaryPrompt, "binary message", func(step Step) bool {
+		return step.Binary == nil || step.Binary(ptr)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return step.BinaryResponse, nil
+}
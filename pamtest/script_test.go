@@ -0,0 +1,153 @@
+package pamtest
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func TestScript(t *testing.T) {
+	s := &Service{
+		Authenticate: Sequence(Info("Welcome"),
+			CheckPassword(map[string]string{"test": "secret"})),
+	}
+	script := NewScript(
+		Step{Style: pam.TextInfo, Message: Exactly("Welcome")},
+		Step{Style: pam.PromptEchoOn, Message: Contains("login"), Response: "test"},
+		Step{Style: pam.PromptEchoOff, Message: Regexp("^Password"), Response: "secret"},
+	)
+	tx, _ := s.Start("login", "", script)
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := script.Done(); err != nil {
+		t.Fatalf("script #error: %v", err)
+	}
+}
+
+func TestScript_Modes(t *testing.T) {
+	steps := []Step{
+		{Style: pam.PromptEchoOn, Response: "test"},
+		{Style: pam.PromptEchoOff, Message: Any(), Response: "secret"},
+	}
+	s := &Service{
+		Authenticate: Sequence(Info("Welcome"),
+			CheckPassword(map[string]string{"test": "secret"})),
+	}
+
+	strict := &Script{Mode: Strict, Steps: steps}
+	tx, _ := s.Start("login", "", strict)
+	if err := tx.Authenticate(0); err == nil {
+		t.Fatalf("authenticate #expected an error")
+	}
+	if strict.Err() == nil {
+		t.Fatalf("script #expected an error")
+	}
+
+	loose := &Script{Mode: Loose, Steps: steps}
+	tx, _ = s.Start("login", "", loose)
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := loose.Done(); err != nil {
+		t.Fatalf("script #error: %v", err)
+	}
+}
+
+func TestScript_OutOfOrder(t *testing.T) {
+	script := &Script{Mode: Loose, Steps: []Step{
+		{Style: pam.PromptEchoOff, Response: "secret"},
+		{Style: pam.PromptEchoOn, Response: "test"},
+	}}
+	s := &Service{Authenticate: CheckPassword(map[string]string{"test": "secret"})}
+	tx, _ := s.Start("login", "", script)
+	if err := tx.Authenticate(0); err == nil {
+		t.Fatalf("authenticate #expected an error")
+	}
+	expected := `unexpected message at step 0: expected PAM_PROMPT_ECHO_OFF, got PAM_PROMPT_ECHO_ON "login: "`
+	if err := script.Err(); !errors.Is(err, ErrUnexpectedMessage) || err.Error() != expected {
+		t.Fatalf("script #error: expected %q, got %v", expected, err)
+	}
+	if err := script.Done(); err == nil {
+		t.Fatalf("script #expected an error")
+	}
+}
+
+func TestScript_Mismatch(t *testing.T) {
+	script := NewScript(Step{Style: pam.PromptEchoOn, Message: Exactly("login: ")})
+	_, err := script.RespondPAM(pam.PromptEchoOn, "Username: ")
+	expected := `unexpected message at step 0: PAM_PROMPT_ECHO_ON "Username: " not matched`
+	if !errors.Is(err, ErrUnexpectedMessage) || err.Error() != expected {
+		t.Fatalf("respond #error: expected %q, got %v", expected, err)
+	}
+	script = NewScript()
+	_, err = script.RespondPAM(pam.TextInfo, "Welcome")
+	expected = `unexpected message after the end of the script: PAM_TEXT_INFO "Welcome"`
+	if !errors.Is(err, ErrUnexpectedMessage) || err.Error() != expected {
+		t.Fatalf("respond #error: expected %q, got %v", expected, err)
+	}
+}
+
+func TestScript_StepError(t *testing.T) {
+	cancelled := errors.New("cancelled")
+	script := NewScript(Step{Style: pam.PromptEchoOn, Err: cancelled})
+	if _, err := script.RespondPAM(pam.PromptEchoOn, "login: "); !errors.Is(err, cancelled) {
+		t.Fatalf("respond #error: expected %v, got %v", cancelled, err)
+	}
+	if err := script.Done(); err != nil {
+		t.Fatalf("script #error: %v", err)
+	}
+	if _, err := script.RespondPAM(pam.TextInfo, "extra"); err == nil {
+		t.Fatalf("respond #expected an error")
+	}
+}
+
+func TestBinaryScript(t *testing.T) {
+	request := []byte{0x01, 0x02}
+	script := NewBinaryScript(
+		Step{Style: pam.TextInfo},
+		Step{
+			Style: pam.BinaryPrompt,
+			Binary: func(ptr pam.BinaryPointer) bool {
+				return *(*byte)(ptr) == 0x01
+			},
+			BinaryResponse: []byte{0x03},
+		},
+	)
+	s := &Service{Authenticate: Sequence(Info("binary"),
+		func(tx *Transaction, f pam.Flags) error {
+			r, err := tx.BinaryConversation(pam.BinaryPointer(&request[0]))
+			if err != nil {
+				return err
+			}
+			if len(r) != 1 || r[0] != 0x03 {
+				return ErrAuth
+			}
+			return nil
+		})}
+	tx, _ := s.Start("login", "test", script)
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := script.Done(); err != nil {
+		t.Fatalf("script #error: %v", err)
+	}
+
+	request[0] = 0x02
+	script = NewBinaryScript(Step{Style: pam.BinaryPrompt,
+		Binary: func(ptr pam.BinaryPointer) bool {
+			return *(*byte)(ptr) == 0x01
+		}})
+	tx, _ = s.Start("login", "test", &script.Script)
+	if err := tx.Authenticate(pam.Silent); !errors.Is(err, ErrConv) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrConv, err)
+	}
+	tx, _ = s.Start("login", "test", script)
+	if err := tx.Authenticate(pam.Silent); !errors.Is(err, ErrConv) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrConv, err)
+	}
+	if script.Err() == nil {
+		t.Fatalf("script #expected an error")
+	}
+}
@@ -0,0 +1,247 @@
+package pamtest
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/msteinert/pam"
+	"github.com/msteinert/pam/pamconf"
+)
+
+// Stack simulates a PAM stack entirely in-process: service files in the
+// pam.d format are parsed with pamconf and their lines are run against the
+// simulated modules, honoring the control values as Linux-PAM does.
+//
+// Simulated modules are Services, keyed by module path; OperationFunc
+// errors are mapped to PAM return values through the errors defined by
+// this package (nil is success, ErrIgnore makes the module ignored), while
+// any other error only matches the "default" bracketed control value.
+// Lines whose type is prefixed by "-" are skipped if the module is missing,
+// otherwise a missing module fails with ErrModuleUnknown.
+type Stack struct {
+	// Modules are the simulated modules, keyed by module path.
+	Modules map[string]*Service
+	// Faults are injected in the transactions of the stack.
+	Faults   *Faults
+	services map[string][]pamconf.Line
+}
+
+// maxIncludeDepth limits the nesting of include and substack lines.
+const maxIncludeDepth = 32
+
+// statusKey returns the name of the PAM return value of err used in
+// bracketed control values. Errors that are not pam return types are
+// handled as "default".
+func statusKey(err error) string {
+	if err == nil {
+		return "success"
+	}
+	var r pam.ReturnType
+	if errors.As(err, &r) && r >= 0 && int(r) < len(pamconf.ReturnValues)-1 {
+		return pamconf.ReturnValues[r]
+	}
+	return "default"
+}
+
+// NewStack creates a simulated stack using the modules.
+func NewStack(modules map[string]*Service) *Stack {
+	return &Stack{Modules: modules, services: map[string][]pamconf.Line{}}
+}
+
+// AddService parses a service file from r and adds it to the stack.
+func (s *Stack) AddService(name string, r io.Reader) error {
+	lines, err := pamconf.Parse(r)
+	if err != nil {
+		return fmt.Errorf("service %s: %w", name, err)
+	}
+	if s.services == nil {
+		s.services = map[string][]pamconf.Line{}
+	}
+	s.services[name] = lines
+	return nil
+}
+
+// AddServiceLines adds a service to the stack.
+func (s *Stack) AddServiceLines(name string, lines []ServiceLine) error {
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(l.String())
+		b.WriteByte('\n')
+	}
+	return s.AddService(name, strings.NewReader(b.String()))
+}
+
+// LoadServices adds all the service files in dir to the stack.
+func (s *Stack) LoadServices(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		f, err := os.Open(filepath.Join(dir, e.Name()))
+		if err != nil {
+			return err
+		}
+		err = s.AddService(e.Name(), f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Start initiates a new transaction running the service through the
+// simulated stack. As Linux-PAM does, the "other" service is used if the
+// service is not defined, and ErrAbort is returned if neither exists.
+func (s *Stack) Start(service, user string, handler pam.ConversationHandler) (*Transaction, error) {
+	name := service
+	if _, ok := s.services[name]; !ok {
+		name = "other"
+		if _, ok := s.services[name]; !ok {
+			return nil, ErrAbort
+		}
+	}
+	op := func(typ ModuleType, get func(*Service) OperationFunc) OperationFunc {
+		return func(tx *Transaction, f pam.Flags) error {
+			lines, err := s.chain(name, typ, 0)
+			if err != nil {
+				return err
+			}
+			return s.evaluate(tx, lines, get, f, 0)
+		}
+	}
+	svc := &Service{
+		Authenticate:  op(Auth, func(m *Service) OperationFunc { return m.Authenticate }),
+		SetCred:       op(Auth, func(m *Service) OperationFunc { return m.SetCred }),
+		AcctMgmt:      op(Account, func(m *Service) OperationFunc { return m.AcctMgmt }),
+		ChangeAuthTok: chauthtok(op(Password, func(m *Service) OperationFunc { return m.ChangeAuthTok })),
+		OpenSession:   op(Session, func(m *Service) OperationFunc { return m.OpenSession }),
+		CloseSession:  op(Session, func(m *Service) OperationFunc { return m.CloseSession }),
+		Faults:        s.Faults,
+	}
+	return svc.Start(service, user, handler)
+}
+
+// chauthtok runs the password stack twice, as pam_chauthtok does: first
+// with pam.PrelimCheck, then with pam.UpdateAuthtok if all the modules
+// passed the check.
+func chauthtok(op OperationFunc) OperationFunc {
+	return func(tx *Transaction, f pam.Flags) error {
+		if err := op(tx, f|pam.PrelimCheck); err != nil {
+			return err
+		}
+		return op(tx, f|pam.UpdateAuthtok)
+	}
+}
+
+// StartFunc registers the handler func as a conversation handler.
+func (s *Stack) StartFunc(service, user string, handler func(pam.Style, string) (string, error)) (*Transaction, error) {
+	return s.Start(service, user, pam.ConversationFunc(handler))
+}
+
+// chain returns the lines of type typ of the service, expanding includes.
+func (s *Stack) chain(service string, typ ModuleType, depth int) ([]pamconf.Line, error) {
+	if depth > maxIncludeDepth {
+		return nil, fmt.Errorf("service %s: %w", service, ErrAbort)
+	}
+	lines, ok := s.services[service]
+	if !ok {
+		return nil, fmt.Errorf("service %s: %w", service, ErrAbort)
+	}
+	var chain []pamconf.Line
+	for _, l := range lines {
+		if l.Type != typ && l.Type != "" {
+			continue
+		}
+		if l.Control == Include {
+			included, err := s.chain(l.Module, typ, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			chain = append(chain, included...)
+			continue
+		}
+		chain = append(chain, l)
+	}
+	return chain, nil
+}
+
+type impression int
+
+const (
+	undefined impression = iota
+	positive
+	negative
+)
+
+// evaluate runs the lines as _pam_dispatch_aux does in Linux-PAM.
+func (s *Stack) evaluate(tx *Transaction, lines []pamconf.Line, get func(*Service) OperationFunc, f pam.Flags, depth int) error {
+	imp := undefined
+	var status error = ErrPermDenied
+	for i := 0; i < len(lines); i++ {
+		l := lines[i]
+		var err error
+		if l.Control == Substack {
+			sub, serr := s.chain(l.Module, l.Type, depth+1)
+			if serr == nil {
+				serr = s.evaluate(tx, sub, get, f, depth+1)
+			}
+			err = serr
+		} else if m, ok := s.Modules[l.Module]; ok {
+			tx.args = l.Args
+			err = tx.run(get(m), f)
+			tx.args = nil
+		} else if l.IgnoreMissing {
+			continue
+		} else {
+			err = ErrModuleUnknown
+		}
+
+		key := statusKey(err)
+		switch action := l.Action(key); action {
+		case pamconf.ActionIgnore:
+		case pamconf.ActionReset:
+			imp = undefined
+			status = ErrPermDenied
+		case pamconf.ActionOk, pamconf.ActionDone:
+			if imp == undefined || (imp == positive && status == nil) {
+				if key != "ignore" {
+					imp = positive
+					status = err
+				}
+			}
+			if imp != negative && action == pamconf.ActionDone {
+				return status
+			}
+		case pamconf.ActionBad, pamconf.ActionDie:
+			if imp != negative {
+				imp = negative
+				status = err
+				if key == "ignore" {
+					status = ErrPermDenied
+				}
+			}
+			if action == pamconf.ActionDie {
+				return status
+			}
+		default:
+			// Jumps only skip the lines, leaving the result to the
+			// others.
+			jump, _ := strconv.Atoi(action)
+			i += jump
+		}
+	}
+	if status == nil && imp != positive {
+		return ErrPermDenied
+	}
+	return status
+}
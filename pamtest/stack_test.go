@@ -0,0 +1,183 @@
+package pamtest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func testModules(calls *[]string) map[string]*Service {
+	record := func(name string, err error) *Service {
+		return &Service{Authenticate: func(tx *Transaction, f pam.Flags) error {
+			*calls = append(*calls, strings.Join(append([]string{name}, tx.Args()...), " "))
+			return err
+		}}
+	}
+	return map[string]*Service{
+		"permit.so":  record("permit", nil),
+		"deny.so":    record("deny", ErrAuth),
+		"ignore.so":  record("ignore", ErrIgnore),
+		"unknown.so": record("unknown", ErrUserUnknown),
+	}
+}
+
+func TestStack(t *testing.T) {
+	tests := []struct {
+		name    string
+		service string
+		err     error
+		calls   []string
+	}{
+		{"required", `
+auth required permit.so
+auth required deny.so
+auth required permit.so`, ErrAuth, []string{"permit", "deny", "permit"}},
+		{"requisite", `
+auth requisite deny.so
+auth required permit.so`, ErrAuth, []string{"deny"}},
+		{"sufficient", `
+auth sufficient permit.so
+auth required deny.so`, nil, []string{"permit"}},
+		{"sufficient after failure", `
+auth required deny.so
+auth sufficient permit.so
+auth required unknown.so`, ErrAuth, []string{"deny", "permit", "unknown"}},
+		{"optional", `
+auth optional deny.so
+auth required permit.so`, nil, []string{"deny", "permit"}},
+		{"only ignored", `
+auth required ignore.so`, ErrPermDenied, []string{"ignore"}},
+		{"first failure wins", `
+auth required unknown.so
+auth required deny.so`, ErrUserUnknown, []string{"unknown", "deny"}},
+		{"brackets", `
+auth [success=1 default=ignore] deny.so
+auth [success=ok auth_err=die default=bad] unknown.so # comment
+auth required permit.so`, ErrUserUnknown, []string{"deny", "unknown", "permit"}},
+		{"jump", `
+auth [success=1 default=ignore] permit.so
+auth requisite deny.so
+auth required permit.so arg1 [arg 2]`, nil, []string{"permit", "permit arg1 arg 2"}},
+		{"jump only", `
+auth [success=1 default=ignore] permit.so
+auth requisite deny.so`, ErrPermDenied, []string{"permit"}},
+		{"jump over failure", `
+auth [success=ok default=1] deny.so
+auth requisite unknown.so
+auth required permit.so`, nil, []string{"deny", "permit"}},
+		{"reset", `
+auth required deny.so
+auth [success=ok default=reset] unknown.so
+auth required permit.so`, nil, []string{"deny", "unknown", "permit"}},
+		{"continuation", `
+auth required \
+    permit.so arg`, nil, []string{"permit arg"}},
+		{"missing module", `
+auth required missing.so
+auth required permit.so`, ErrModuleUnknown, []string{"permit"}},
+		{"optional missing module", `
+-auth required missing.so
+auth required permit.so`, nil, []string{"permit"}},
+		{"include", `
+auth include common
+auth required permit.so`, ErrAuth, []string{"deny"}},
+		{"@include", `
+@include common
+auth required permit.so`, ErrAuth, []string{"deny"}},
+		{"substack", `
+auth substack common
+auth required permit.so`, ErrAuth, []string{"deny", "permit"}},
+		{"substack done", `
+auth substack common-sufficient
+auth required deny.so`, ErrAuth, []string{"permit", "deny"}},
+		{"other session type", `
+session required deny.so
+auth required permit.so`, nil, []string{"permit"}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var calls []string
+			s := NewStack(testModules(&calls))
+			if err := s.AddService("test", strings.NewReader(tc.service)); err != nil {
+				t.Fatalf("add service #error: %v", err)
+			}
+			s.AddService("common", strings.NewReader("auth requisite deny.so\nauth required permit.so"))
+			s.AddService("common-sufficient", strings.NewReader("auth sufficient permit.so\nauth required deny.so"))
+			tx, err := s.Start("test", "user", NewScript())
+			if err != nil {
+				t.Fatalf("start #error: %v", err)
+			}
+			err = tx.Authenticate(0)
+			if !errors.Is(err, tc.err) || (tc.err == nil && err != nil) {
+				t.Fatalf("authenticate #error: expected %v, got %v", tc.err, err)
+			}
+			if strings.Join(calls, ",") != strings.Join(tc.calls, ",") {
+				t.Fatalf("authenticate #error: expected calls %v, got %v", tc.calls, calls)
+			}
+		})
+	}
+}
+
+func TestStack_Other(t *testing.T) {
+	var calls []string
+	s := NewStack(testModules(&calls))
+	if _, err := s.Start("missing", "", nil); !errors.Is(err, ErrAbort) {
+		t.Fatalf("start #error: expected %v, got %v", ErrAbort, err)
+	}
+	s.AddServiceLines("other", []ServiceLine{{Auth, Required, "deny.so", nil}})
+	tx, err := s.Start("missing", "", nil)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	if err := tx.Authenticate(0); !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrAuth, err)
+	}
+	if s, _ := tx.GetItem(pam.Service); s != "missing" {
+		t.Fatalf("getitem #error: expected missing, got %v", s)
+	}
+}
+
+func TestStack_Conversation(t *testing.T) {
+	s := NewStack(map[string]*Service{
+		"pam_unix.so": {
+			Authenticate: CheckPassword(map[string]string{"test": "secret"}),
+		},
+	})
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "login"), []byte("auth required pam_unix.so\n"), 0600)
+	if err := s.LoadServices(dir); err != nil {
+		t.Fatalf("load #error: %v", err)
+	}
+	script := NewScript(
+		Step{Style: pam.PromptEchoOn, Response: "test"},
+		Step{Style: pam.PromptEchoOff, Response: "secret"},
+	)
+	tx, _ := s.Start("login", "", script)
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := script.Done(); err != nil {
+		t.Fatalf("script #error: %v", err)
+	}
+}
+
+func TestStack_ParseErrors(t *testing.T) {
+	for _, service := range []string{
+		"auth required",
+		"foo required permit.so",
+		"auth [success=ok default] permit.so",
+		"auth [success=foo] permit.so",
+		"auth [success=-1] permit.so",
+		"auth required permit.so [unterminated",
+		"auth bogus permit.so",
+		"auth required []",
+	} {
+		if err := NewStack(nil).AddService("test", strings.NewReader(service)); err == nil {
+			t.Fatalf("add service #expected an error for %q", service)
+		}
+	}
+}
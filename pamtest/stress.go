@@ -0,0 +1,148 @@
+package pamtest
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// StressOptions configures Stress.
+type StressOptions struct {
+	// Transactions is the total number of transactions to run, 100 if
+	// not set.
+	Transactions int
+	// Concurrency is the number of transactions running at the same
+	// time, runtime.GOMAXPROCS(0) if not set.
+	Concurrency int
+	// Start starts a transaction using the handler. It is required.
+	Start func(handler pam.ConversationHandler) (*pam.Transaction, error)
+	// Run runs the operations on a transaction, Authenticate if not set.
+	Run func(tx *pam.Transaction) error
+	// Respond answers the conversation messages of a transaction. The
+	// default handler answers prompts with empty strings. In both
+	// cases, the transaction items are read from the handler, to
+	// exercise calls re-entering the package during a conversation.
+	Respond func(s pam.Style, msg string) (string, error)
+	// CheckLeaks makes Stress fail if the conversation handlers of the
+	// finished transactions are not garbage collected, which happens
+	// when their transactions are not released on Close, or if the run
+	// leaves goroutines behind.
+	CheckLeaks bool
+}
+
+// leakCanary is referenced by a conversation handler to detect whether it
+// has been garbage collected. It has a pointer field so that it is not
+// batched with other tiny allocations, which would delay its finalizer.
+type leakCanary struct {
+	_ *byte
+	i int
+}
+
+// waitFor runs the garbage collector until cond is true, for about a
+// second at most. It returns the last value of cond.
+func waitFor(cond func() bool) bool {
+	for i := 0; i < 100; i++ {
+		if cond() {
+			return true
+		}
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	return cond()
+}
+
+// Stress runs many transactions concurrently, to be used under the race
+// detector to validate the thread-safety of the package and of the code
+// using it. It returns the errors of all the failed transactions.
+func Stress(opts StressOptions) error {
+	if opts.Start == nil {
+		return errors.New("no start function provided")
+	}
+	if opts.Transactions <= 0 {
+		opts.Transactions = 100
+	}
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = runtime.GOMAXPROCS(0)
+	}
+	if opts.Run == nil {
+		opts.Run = func(tx *pam.Transaction) error {
+			return tx.Authenticate(0)
+		}
+	}
+	if opts.Respond == nil {
+		opts.Respond = func(pam.Style, string) (string, error) {
+			return "", nil
+		}
+	}
+
+	goroutines := runtime.NumGoroutine()
+	var live atomic.Int64
+
+	var mu sync.Mutex
+	var errs []error
+	fail := func(i int, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		errs = append(errs, fmt.Errorf("transaction %d: %w", i, err))
+	}
+
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				var tx *pam.Transaction
+				canary := &leakCanary{i: i}
+				if opts.CheckLeaks {
+					live.Add(1)
+					runtime.SetFinalizer(canary, func(*leakCanary) { live.Add(-1) })
+				}
+				handler := pam.ConversationFunc(func(s pam.Style, msg string) (string, error) {
+					runtime.KeepAlive(canary)
+					if tx != nil {
+						if _, err := tx.GetItem(pam.Service); err != nil {
+							return "", err
+						}
+					}
+					return opts.Respond(s, msg)
+				})
+				var err error
+				if tx, err = opts.Start(handler); err != nil {
+					fail(i, err)
+					continue
+				}
+				if err := opts.Run(tx); err != nil {
+					fail(i, err)
+				}
+				// The handler references the transaction, so it
+				// can only be released explicitly.
+				if err := tx.Close(); err != nil {
+					fail(i, err)
+				}
+			}
+		}()
+	}
+	for i := 0; i < opts.Transactions; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	if opts.CheckLeaks {
+		if !waitFor(func() bool { return live.Load() == 0 }) {
+			errs = append(errs, fmt.Errorf("%d conversation handlers leaked", live.Load()))
+		}
+		if !waitFor(func() bool { return runtime.NumGoroutine() <= goroutines }) {
+			errs = append(errs, fmt.Errorf("%d goroutines leaked",
+				runtime.NumGoroutine()-goroutines))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,87 @@
+package pamtest
+
+import (
+	"errors"
+	"os/user"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func TestStress(t *testing.T) {
+	if !pam.CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	ts := NewTestSetup(t)
+	ts.CreateService("stress", []ServiceLine{
+		{Auth, Optional, "pam_echo.so", []string{"Hello %u"}},
+		{Auth, Required, "pam_permit.so", nil},
+	})
+	var messages atomic.Int64
+	err := Stress(StressOptions{
+		Transactions: 200,
+		Concurrency:  16,
+		CheckLeaks:   true,
+		Start: func(handler pam.ConversationHandler) (*pam.Transaction, error) {
+			return pam.StartConfDir("stress", u.Username, handler, ts.WorkDir())
+		},
+		Run: func(tx *pam.Transaction) error {
+			if err := tx.PutEnv("STRESS=1"); err != nil {
+				return err
+			}
+			if err := tx.Authenticate(0); err != nil {
+				return err
+			}
+			if tx.GetEnv("STRESS") != "1" {
+				return errors.New("unexpected environment")
+			}
+			return nil
+		},
+		Respond: func(s pam.Style, msg string) (string, error) {
+			if s != pam.TextInfo || msg != "Hello "+u.Username {
+				return "", errors.New("unexpected message")
+			}
+			messages.Add(1)
+			return "", nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("stress #error: %v", err)
+	}
+	if messages.Load() != 200 {
+		t.Fatalf("stress #error: expected 200 messages, got %d", messages.Load())
+	}
+}
+
+func TestStress_Errors(t *testing.T) {
+	if err := Stress(StressOptions{}); err == nil {
+		t.Fatalf("stress #expected an error")
+	}
+	failure := errors.New("failure")
+	err := Stress(StressOptions{
+		Transactions: 3,
+		Start: func(handler pam.ConversationHandler) (*pam.Transaction, error) {
+			return nil, failure
+		},
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("stress #error: expected %v, got %v", failure, err)
+	}
+	var leaked []pam.ConversationHandler
+	err = Stress(StressOptions{
+		Transactions: 3,
+		CheckLeaks:   true,
+		Start: func(handler pam.ConversationHandler) (*pam.Transaction, error) {
+			leaked = append(leaked, handler)
+			return nil, failure
+		},
+	})
+	if err == nil || !strings.Contains(err.Error(), "3 conversation handlers leaked") {
+		t.Fatalf("stress #error: expected a leak, got %v", err)
+	}
+	runtime.KeepAlive(leaked)
+}
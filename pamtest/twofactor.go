@@ -0,0 +1,97 @@
+package pamtest
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// CodeOptions defines the one time code asked by CheckCode.
+type CodeOptions struct {
+	// Prompt is the prompt of the code, "Verification code: " if empty.
+	Prompt string
+	// Send returns a new code for the user, as if sent to their device.
+	Send func(user string) string
+	// Expiry is the validity of the codes, announced to the user when
+	// sent. The codes don't expire if it's 0.
+	Expiry time.Duration
+	// Resends is the number of new codes the user can ask for, by
+	// responding to the prompt with an empty code.
+	Resends int
+	// Now returns the current time, time.Now if not set.
+	Now func() time.Time
+}
+
+func (o CodeOptions) now() time.Time {
+	if o.Now != nil {
+		return o.Now()
+	}
+	return time.Now()
+}
+
+// sent returns the message announcing a code.
+func (o CodeOptions) sent(resent bool) string {
+	msg := "A code has been sent."
+	if resent {
+		msg = "A new code has been sent."
+	}
+	if o.Expiry > 0 {
+		msg = fmt.Sprintf("%s It expires in %v.", msg, o.Expiry)
+	}
+	return msg
+}
+
+// CheckCode returns an authentication operation sending a one time code to
+// the user, announced with a TextInfo message, and prompting for it with the
+// echo off. The messages are not sent if the Silent flag is set. Empty
+// responses ask for a new code, as long as resends are
+// left. It returns ErrAuth if the code does not match or has expired, after
+// an ErrorMsg message explaining why, and ErrMaxtries once the resends are
+// exhausted.
+func CheckCode(opts CodeOptions) OperationFunc {
+	prompt := opts.Prompt
+	if prompt == "" {
+		prompt = "Verification code: "
+	}
+	return func(tx *Transaction, f pam.Flags) error {
+		user := tx.items[pam.User]
+		notify := func(s pam.Style, msg string) error {
+			if f&pam.Silent != 0 {
+				return nil
+			}
+			_, err := tx.Conversation(s, msg)
+			return err
+		}
+		for resends := 0; ; resends++ {
+			code, sent := opts.Send(user), opts.now()
+			if err := notify(pam.TextInfo, opts.sent(resends > 0)); err != nil {
+				return err
+			}
+			r, err := tx.Conversation(pam.PromptEchoOff, prompt)
+			if err != nil {
+				return err
+			}
+			switch {
+			case r == "" && resends < opts.Resends:
+				continue
+			case r == "":
+				notify(pam.ErrorMsg, "No more codes can be sent.")
+				return ErrMaxtries
+			case opts.Expiry > 0 && opts.now().Sub(sent) > opts.Expiry:
+				notify(pam.ErrorMsg, "The code has expired.")
+				return ErrAuth
+			case r != code:
+				notify(pam.ErrorMsg, "The code is not valid.")
+				return ErrAuth
+			}
+			return nil
+		}
+	}
+}
+
+// TwoFactor returns an authentication operation checking the password of
+// the user, as CheckPassword does, then a one time code, as CheckCode does.
+func TwoFactor(passwords map[string]string, opts CodeOptions) OperationFunc {
+	return Sequence(CheckPassword(passwords), CheckCode(opts))
+}
@@ -0,0 +1,66 @@
+package pamtest
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+func TestTwoFactor(t *testing.T) {
+	now := time.Unix(0, 0)
+	var sent int
+	opts := CodeOptions{
+		Send: func(user string) string {
+			sent++
+			return user + "-code"
+		},
+		Expiry:  time.Minute,
+		Resends: 1,
+		Now:     func() time.Time { return now },
+	}
+	s := &Service{Authenticate: TwoFactor(map[string]string{"user": "secret"}, opts)}
+	start := func(codes ...string) *Transaction {
+		tx, _ := s.Start("2fa", "", &pam.TwoFactorHandler{
+			User:     "user",
+			Password: func(string) (string, error) { return "secret", nil },
+			Code: func(string) (string, error) {
+				code := codes[0]
+				codes = codes[1:]
+				return code, nil
+			},
+		})
+		return tx
+	}
+
+	if err := start("user-code").Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	sent = 0
+	if err := start("", "user-code").Authenticate(0); err != nil || sent != 2 {
+		t.Fatalf("authenticate #error: expected 2 codes sent, got %d (%v)", sent, err)
+	}
+	if err := start("", "", "user-code").Authenticate(0); !errors.Is(err, ErrMaxtries) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrMaxtries, err)
+	}
+	if err := start("wrong").Authenticate(0); !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrAuth, err)
+	}
+
+	var expired bool
+	tx, _ := s.Start("2fa", "user", &pam.TwoFactorHandler{
+		Password: func(string) (string, error) { return "secret", nil },
+		Code: func(string) (string, error) {
+			now = now.Add(2 * time.Minute)
+			return "user-code", nil
+		},
+		Message: func(s pam.Style, msg string) error {
+			expired = s == pam.ErrorMsg && msg == "The code has expired."
+			return nil
+		},
+	})
+	if err := tx.Authenticate(0); !errors.Is(err, ErrAuth) || !expired {
+		t.Fatalf("authenticate #error: expected an expired code, got %v", err)
+	}
+}
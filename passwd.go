@@ -0,0 +1,207 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// PasswordPrompt is the kind of a prompt sent while changing a password.
+type PasswordPrompt int
+
+// Password change prompts.
+const (
+	// PromptCurrentPassword asks for the current password.
+	PromptCurrentPassword PasswordPrompt = iota
+	// PromptNewPassword asks for the new password.
+	PromptNewPassword
+	// PromptConfirmPassword asks to type the new password again.
+	PromptConfirmPassword
+	// PromptOther is any other prompt, such as one asking for the user
+	// name with the text echoed.
+	PromptOther
+)
+
+// PasswordChangeUI is the user interface of ChangePassword.
+type PasswordChangeUI interface {
+	// Prompt returns the response to a prompt of the modules. The kind
+	// is guessed from its style and message, which the UI can still use
+	// as is.
+	Prompt(kind PasswordPrompt, prompt string) (string, error)
+	// Message shows an ErrorMsg or TextInfo message of the modules.
+	Message(s Style, msg string) error
+	// Retry returns whether to attempt the change again after the
+	// attempt with the given number, starting from 1, failed with err,
+	// once the modules sent messages, such as the reasons for refusing
+	// the new password. It is only called for the failures that may
+	// succeed with other passwords.
+	Retry(attempt int, err error, messages []ConversationMessage) bool
+}
+
+// PasswordChangeResult describes the password change made by
+// ChangePassword.
+type PasswordChangeResult struct {
+	// Attempts is the number of attempts made.
+	Attempts int
+	// Messages are the ErrorMsg and TextInfo messages sent by the
+	// modules during the last attempt.
+	Messages []ConversationMessage
+}
+
+// maxPolicyRefusals is the number of new passwords refused by the policy
+// of ChangePassword before the conversation fails.
+const maxPolicyRefusals = 3
+
+// PasswordChangeOption configures ChangePassword.
+type PasswordChangeOption func(*passwordChangeHandler)
+
+// WithPasswordPolicy checks the new passwords with policy before they are
+// given to the modules. The refused ones are reported to the UI as ErrorMsg
+// messages, with the reason translated by DefaultCatalog for the Locale of
+// the transaction, and asked again; after 3 of them, the conversation fails
+// with the error of the policy.
+func WithPasswordPolicy(policy PasswordPolicy) PasswordChangeOption {
+	return func(h *passwordChangeHandler) {
+		h.policy = policy
+	}
+}
+
+// WithPasswordChangeFlags passes f to the authentication token changes, for
+// example Silent, or ChangeExpiredAuthtok to only change the expired
+// tokens, once the account validation required it. They are 0 by default.
+func WithPasswordChangeFlags(f Flags) PasswordChangeOption {
+	return func(h *passwordChangeHandler) {
+		h.flags = f
+	}
+}
+
+// ChangePassword changes the authentication token of the user of tx,
+// asking ui for the passwords: the current one, if the modules require it,
+// then the new one and its confirmation. If the modules refuse the
+// passwords with ErrAuthtok, for example as they don't match or the new one
+// is too weak, or fail their preliminary checks with ErrTryAgain, ui decides
+// whether to attempt the change again.
+//
+// The conversations of tx are handled by ui until ChangePassword returns,
+// and fail once ctx is done.
+func ChangePassword(ctx context.Context, tx *Transaction, ui PasswordChangeUI, opts ...PasswordChangeOption) (PasswordChangeResult, error) {
+	var result PasswordChangeResult
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	h := &passwordChangeHandler{ui: ui}
+	for _, opt := range opts {
+		opt(h)
+	}
+	if h.policy != nil {
+		h.user, _ = tx.GetItem(User)
+		h.locale = tx.Locale()
+	}
+	defer tx.useHandler(h)()
+	defer tx.setContext(ctx)()
+	for {
+		result.Attempts++
+		h.messages, h.old = nil, ""
+		err := tx.ChangeAuthTok(h.flags)
+		result.Messages = h.messages
+		if err == nil {
+			return result, nil
+		}
+		if !isAny(err, ErrAuthtok, ErrTryAgain, ErrAuthtokLockBusy) ||
+			ctx.Err() != nil || !ui.Retry(result.Attempts, err, result.Messages) {
+			return result, err
+		}
+	}
+}
+
+// passwordChangeHandler is the conversation handler of ChangePassword.
+type passwordChangeHandler struct {
+	ui     PasswordChangeUI
+	policy PasswordPolicy
+	flags  Flags
+	user   string
+	locale string
+	// old is the current password given in the current attempt, for the
+	// policy.
+	old string
+	// messages are the messages of the current attempt.
+	messages []ConversationMessage
+}
+
+func (h *passwordChangeHandler) RespondPAM(s Style, msg string) (string, error) {
+	switch s {
+	case PromptEchoOff, PromptEchoOn:
+		kind := passwordPromptKind(s, msg)
+		resp, err := h.ui.Prompt(kind, msg)
+		if err != nil || h.policy == nil {
+			return resp, err
+		}
+		switch kind {
+		case PromptCurrentPassword:
+			h.old = resp
+		case PromptNewPassword:
+			return h.checkPolicy(kind, msg, resp)
+		}
+		return resp, nil
+	case ErrorMsg, TextInfo:
+		h.messages = append(h.messages, ConversationMessage{s, msg})
+		return "", h.ui.Message(s, msg)
+	}
+	return "", fmt.Errorf("unexpected message style %v", s)
+}
+
+// checkPolicy returns the new password resp if the policy accepts it,
+// otherwise it reports the reason and asks for another one.
+func (h *passwordChangeHandler) checkPolicy(kind PasswordPrompt, prompt, resp string) (string, error) {
+	for refusals := 1; ; refusals++ {
+		err := h.policy.Check(h.old, resp, h.user)
+		if err == nil {
+			return resp, nil
+		}
+		msg := err.Error()
+		var qe *PasswordQualityError
+		if errors.As(err, &qe) {
+			msg = qe.Translate(DefaultCatalog, h.locale)
+		}
+		h.messages = append(h.messages, ConversationMessage{ErrorMsg, msg})
+		if err := h.ui.Message(ErrorMsg, msg); err != nil {
+			return "", err
+		}
+		if refusals >= maxPolicyRefusals {
+			return "", err
+		}
+		if resp, err = h.ui.Prompt(kind, prompt); err != nil {
+			return "", err
+		}
+	}
+}
+
+// passwordPromptKind guesses the kind of a prompt from its message, as the
+// modules use prompts such as "Current password: ", "New password: " and
+// "Retype new password: ".
+func passwordPromptKind(s Style, msg string) PasswordPrompt {
+	if s != PromptEchoOff {
+		return PromptOther
+	}
+	msg = strings.ToLower(msg)
+	for _, w := range []string{"retype", "again", "repeat", "confirm", "re-enter", "reenter"} {
+		if strings.Contains(msg, w) {
+			return PromptConfirmPassword
+		}
+	}
+	if strings.Contains(msg, "new") {
+		return PromptNewPassword
+	}
+	return PromptCurrentPassword
+}
+
+// useHandler sets the handler of the conversations of the transaction until
+// the returned function is called.
+func (t *Transaction) useHandler(h ConversationHandler) (restore func()) {
+	prev := t.conversation.handler
+	t.conversation.setHandler(h)
+	return func() {
+		t.conversation.setHandler(prev)
+	}
+}
@@ -0,0 +1,117 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"os/user"
+	"testing"
+)
+
+func TestPasswordPromptKind(t *testing.T) {
+	tests := []struct {
+		style  Style
+		prompt string
+		want   PasswordPrompt
+	}{
+		{PromptEchoOff, "Current password: ", PromptCurrentPassword},
+		{PromptEchoOff, "(current) UNIX password: ", PromptCurrentPassword},
+		{PromptEchoOff, "New password: ", PromptNewPassword},
+		{PromptEchoOff, "Retype new password: ", PromptConfirmPassword},
+		{PromptEchoOff, "Enter new password again: ", PromptConfirmPassword},
+		{PromptEchoOn, "login: ", PromptOther},
+	}
+	for _, tc := range tests {
+		if got := passwordPromptKind(tc.style, tc.prompt); got != tc.want {
+			t.Errorf("passwordpromptkind #error: %q: expected %v, got %v", tc.prompt, tc.want, got)
+		}
+	}
+}
+
+// passwordUI is a PasswordChangeUI allowing a number of attempts.
+type passwordUI struct {
+	attempts int
+	retries  []error
+}
+
+func (ui *passwordUI) Prompt(kind PasswordPrompt, prompt string) (string, error) {
+	return "secret", nil
+}
+
+func (ui *passwordUI) Message(s Style, msg string) error {
+	return nil
+}
+
+func (ui *passwordUI) Retry(attempt int, err error, messages []ConversationMessage) bool {
+	ui.retries = append(ui.retries, err)
+	return attempt < ui.attempts
+}
+
+func passwordStart(t *testing.T, service string) *Transaction {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	tx, err := StartConfDir(service, u.Username, Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	t.Cleanup(func() { tx.Close() })
+	return tx
+}
+
+func TestChangePassword(t *testing.T) {
+	tx := passwordStart(t, "login-service")
+	ui := &passwordUI{attempts: 3}
+	result, err := ChangePassword(context.Background(), tx, ui)
+	if err != nil {
+		t.Fatalf("changepassword #error: %v", err)
+	}
+	if result.Attempts != 1 || len(ui.retries) != 0 {
+		t.Fatalf("changepassword #error: expected 1 attempt, got %v", result)
+	}
+}
+
+func TestChangePassword_Flags(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	var flags []Flags
+	tx, err := StartWithOptions("login-service", WithUser(u.Username),
+		WithConfDir("test-services"),
+		WithObserver(ObserverFunc(func(e Event) {
+			if e.Kind == EventOperation && e.Operation == "chauthtok" {
+				flags = append(flags, e.Flags)
+			}
+		})))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	ui := &passwordUI{attempts: 3}
+	f := Silent | ChangeExpiredAuthtok
+	if _, err := ChangePassword(context.Background(), tx, ui, WithPasswordChangeFlags(f)); err != nil {
+		t.Fatalf("changepassword #error: %v", err)
+	}
+	if len(flags) != 1 || flags[0] != f {
+		t.Fatalf("changepassword #error: expected %v, got %v", f, flags)
+	}
+}
+
+func TestChangePassword_Retry(t *testing.T) {
+	tx := passwordStart(t, "deny-service")
+	ui := &passwordUI{attempts: 3}
+	result, err := ChangePassword(context.Background(), tx, ui)
+	if !errors.Is(err, ErrAuthtok) {
+		t.Fatalf("changepassword #error: expected %v, got %v", ErrAuthtok, err)
+	}
+	if result.Attempts != 3 || len(ui.retries) != 3 {
+		t.Fatalf("changepassword #error: expected 3 attempts, got %v", result)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := ChangePassword(ctx, tx, ui); !errors.Is(err, context.Canceled) {
+		t.Fatalf("changepassword #error: expected %v, got %v", context.Canceled, err)
+	}
+}
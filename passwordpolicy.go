@@ -0,0 +1,162 @@
+package pam
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// PasswordPolicy checks the quality of the new passwords.
+type PasswordPolicy interface {
+	// Check returns a *PasswordQualityError if the new password of user
+	// is refused. The old password is empty if not known.
+	Check(old, new, user string) error
+}
+
+// PasswordQualityReason is the reason of the refusal of a password.
+type PasswordQualityReason int
+
+// Password quality reasons.
+const (
+	// PasswordTooShort is a password shorter than the minimum length.
+	PasswordTooShort PasswordQualityReason = iota
+	// PasswordTooFewClasses is a password with too few character classes:
+	// lower case and upper case letters, digits and other characters.
+	PasswordTooFewClasses
+	// PasswordInDictionary is a password based on a dictionary word.
+	PasswordInDictionary
+	// PasswordSameAsOld is a password equal to the old one.
+	PasswordSameAsOld
+	// PasswordCaseChangesOnly is a password only differing from the old
+	// one by the case of its letters.
+	PasswordCaseChangesOnly
+	// PasswordPalindrome is a password reading the same backwards.
+	PasswordPalindrome
+	// PasswordContainsUser is a password containing the user name.
+	PasswordContainsUser
+)
+
+// PasswordQualityError is the error of the passwords refused by a
+// PasswordPolicy. Its message is meant to be shown to the user.
+type PasswordQualityError struct {
+	Reason PasswordQualityReason
+	// Min is the minimum of the length or of the classes, for the
+	// reasons about them.
+	Min int
+}
+
+func (e *PasswordQualityError) Error() string {
+	return e.Translate(DefaultCatalog, "")
+}
+
+// Unwrap returns ErrAuthtok, the status of the modules refusing the
+// passwords, such as pam_pwquality, so that errors.Is and StatusOf match
+// it as those.
+func (e *PasswordQualityError) Unwrap() error {
+	return ErrAuthtok
+}
+
+// Translate returns the message of the error translated by c for the
+// locale.
+func (e *PasswordQualityError) Translate(c *Catalog, locale string) string {
+	switch e.Reason {
+	case PasswordTooShort:
+		return c.Sprintf(locale, "The password is shorter than %d characters", e.Min)
+	case PasswordTooFewClasses:
+		return c.Sprintf(locale, "The password contains less than %d character classes", e.Min)
+	case PasswordInDictionary:
+		return c.Translate(locale, "The password fails the dictionary check")
+	case PasswordSameAsOld:
+		return c.Translate(locale, "The password is the same as the old one")
+	case PasswordCaseChangesOnly:
+		return c.Translate(locale, "The password differs with case changes only")
+	case PasswordPalindrome:
+		return c.Translate(locale, "The password is a palindrome")
+	case PasswordContainsUser:
+		return c.Translate(locale, "The password contains the user name in some form")
+	}
+	return c.Translate(locale, "The password fails the quality checks")
+}
+
+// DefaultPasswordPolicy is a PasswordPolicy checking the length, the
+// character classes and the similarity of the passwords with the old ones,
+// the user names and the words of a dictionary.
+type DefaultPasswordPolicy struct {
+	// MinLength is the minimum number of characters, 8 if not set.
+	MinLength int
+	// MinClasses is the minimum number of character classes, 1 if not
+	// set.
+	MinClasses int
+	// Words is the dictionary of the refused words. The passwords made
+	// of one of them, in any case, reversed or surrounded by digits and
+	// symbols, are refused.
+	Words []string
+}
+
+// Check checks the new password.
+func (p DefaultPasswordPolicy) Check(old, new, user string) error {
+	minLength := p.MinLength
+	if minLength <= 0 {
+		minLength = 8
+	}
+	minClasses := max(p.MinClasses, 1)
+
+	if old != "" && new == old {
+		return &PasswordQualityError{Reason: PasswordSameAsOld}
+	}
+	lower := strings.ToLower(new)
+	if old != "" && lower == strings.ToLower(old) {
+		return &PasswordQualityError{Reason: PasswordCaseChangesOnly}
+	}
+	if utf8.RuneCountInString(new) < minLength {
+		return &PasswordQualityError{Reason: PasswordTooShort, Min: minLength}
+	}
+	if passwordClasses(new) < minClasses {
+		return &PasswordQualityError{Reason: PasswordTooFewClasses, Min: minClasses}
+	}
+	if reversed := reverse(lower); reversed == lower {
+		return &PasswordQualityError{Reason: PasswordPalindrome}
+	}
+	if u := strings.ToLower(user); len(u) >= 3 &&
+		(strings.Contains(lower, u) || strings.Contains(lower, reverse(u))) {
+		return &PasswordQualityError{Reason: PasswordContainsUser}
+	}
+	if len(p.Words) > 0 {
+		core := strings.TrimFunc(lower, func(r rune) bool {
+			return !unicode.IsLetter(r)
+		})
+		for _, w := range p.Words {
+			w = strings.ToLower(w)
+			if w != "" && (core == w || core == reverse(w)) {
+				return &PasswordQualityError{Reason: PasswordInDictionary}
+			}
+		}
+	}
+	return nil
+}
+
+// passwordClasses returns the number of character classes of s.
+func passwordClasses(s string) int {
+	var lower, upper, digit, other int
+	for _, r := range s {
+		switch {
+		case unicode.IsLower(r):
+			lower = 1
+		case unicode.IsUpper(r):
+			upper = 1
+		case unicode.IsDigit(r):
+			digit = 1
+		default:
+			other = 1
+		}
+	}
+	return lower + upper + digit + other
+}
+
+func reverse(s string) string {
+	r := []rune(s)
+	for i, j := 0, len(r)-1; i < j; i, j = i+1, j-1 {
+		r[i], r[j] = r[j], r[i]
+	}
+	return string(r)
+}
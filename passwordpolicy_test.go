@@ -0,0 +1,92 @@
+package pam
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestDefaultPasswordPolicy(t *testing.T) {
+	p := DefaultPasswordPolicy{MinClasses: 3, Words: []string{"dragon"}}
+	tests := []struct {
+		old, new string
+		reason   PasswordQualityReason
+		ok       bool
+	}{
+		{"", "Corr3ct-horse", 0, true},
+		{"Corr3ct-horse", "Corr3ct-horse", PasswordSameAsOld, false},
+		{"Corr3ct-horse", "cORR3CT-HORSE", PasswordCaseChangesOnly, false},
+		{"", "Sh0rt!", PasswordTooShort, false},
+		{"", "alllowercase", PasswordTooFewClasses, false},
+		{"", "Ab1-xyzzyx-1bA", PasswordPalindrome, false},
+		{"", "Test-user-2024", PasswordContainsUser, false},
+		{"", "Resu-tset-2024", PasswordContainsUser, false},
+		{"", "12Dragon!!", PasswordInDictionary, false},
+		{"", "12NOGARD!!", PasswordInDictionary, false},
+	}
+	for _, tt := range tests {
+		err := p.Check(tt.old, tt.new, "test-user")
+		if tt.ok {
+			if err != nil {
+				t.Fatalf("check #error: %q: %v", tt.new, err)
+			}
+			continue
+		}
+		var qe *PasswordQualityError
+		if !errors.As(err, &qe) || qe.Reason != tt.reason {
+			t.Fatalf("check #error: %q: expected reason %v, got %v", tt.new, tt.reason, err)
+		}
+	}
+	err := DefaultPasswordPolicy{}.Check("", "short", "")
+	if err == nil || err.Error() != "The password is shorter than 8 characters" {
+		t.Fatalf("check #error: unexpected error %v", err)
+	}
+}
+
+// policyUI is a PasswordChangeUI answering with a list of passwords.
+type policyUI struct {
+	passwords []string
+	messages  []string
+}
+
+func (ui *policyUI) Prompt(kind PasswordPrompt, prompt string) (string, error) {
+	p := ui.passwords[0]
+	ui.passwords = ui.passwords[1:]
+	return p, nil
+}
+
+func (ui *policyUI) Message(s Style, msg string) error {
+	ui.messages = append(ui.messages, msg)
+	return nil
+}
+
+func (ui *policyUI) Retry(int, error, []ConversationMessage) bool {
+	return false
+}
+
+func TestPasswordChangeHandler_Policy(t *testing.T) {
+	ui := &policyUI{passwords: []string{"Old-passw0rd", "Old-passw0rd", "weak", "N3w-passw0rd", "N3w-passw0rd"}}
+	h := &passwordChangeHandler{ui: ui}
+	WithPasswordPolicy(DefaultPasswordPolicy{})(h)
+	for _, tt := range []struct{ prompt, expected string }{
+		{"Current password: ", "Old-passw0rd"},
+		{"New password: ", "N3w-passw0rd"},
+		{"Retype new password: ", "N3w-passw0rd"},
+	} {
+		r, err := h.RespondPAM(PromptEchoOff, tt.prompt)
+		if err != nil || r != tt.expected {
+			t.Fatalf("respond #error: %q: expected %q, got %q, %v", tt.prompt, tt.expected, r, err)
+		}
+	}
+	expected := []string{"The password is the same as the old one", "The password is shorter than 8 characters"}
+	if !slices.Equal(ui.messages, expected) {
+		t.Fatalf("respond #error: expected messages %q, got %q", expected, ui.messages)
+	}
+
+	ui = &policyUI{passwords: []string{"a", "b", "c"}}
+	h = &passwordChangeHandler{ui: ui, policy: DefaultPasswordPolicy{}}
+	var qe *PasswordQualityError
+	if _, err := h.RespondPAM(PromptEchoOff, "New password: "); !errors.As(err, &qe) || len(ui.messages) != 3 {
+		t.Fatalf("respond #error: expected a quality error after 3 refusals, got %v, %q", err, ui.messages)
+	}
+}
@@ -0,0 +1,71 @@
+package pam
+
+import (
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+	"sync/atomic"
+)
+
+// Profile selects the profiling hooks run around the PAM operations, the
+// calls running the modules of the stack.
+type Profile int
+
+// Profiling hooks.
+const (
+	// ProfileLabels adds the pam.service and pam.operation pprof labels
+	// to the goroutine running an operation, so that CPU profiles
+	// attribute the time spent in the modules to it.
+	ProfileLabels Profile = 1 << iota
+	// ProfileTrace runs the operations in runtime/trace regions named
+	// after them, such as pam.authenticate, when tracing is enabled.
+	ProfileTrace
+)
+
+var profile atomic.Int32
+
+// SetProfile enables the profiling hooks of p, or disables them all if p
+// is 0. They are disabled by default, as they allocate for each operation.
+func SetProfile(p Profile) {
+	profile.Store(int32(p))
+}
+
+// SetLabelContext sets the context whose pprof labels are extended with
+// those of the operations, when ProfileLabels is enabled. The goroutine
+// labels are reset to those of the context once an operation returns, so
+// callers running with their own labels should set the context carrying
+// them. It defaults to context.Background.
+func (t *Transaction) SetLabelContext(ctx context.Context) {
+	t.labels = ctx
+}
+
+func noProfile() {}
+
+// profile runs the enabled profiling hooks for the operation op of the
+// transaction, returning the function to call once it returns.
+func (t *Transaction) profile(op string) (end func()) {
+	p := Profile(profile.Load())
+	if p == 0 {
+		return noProfile
+	}
+	ctx := t.labels
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var region *trace.Region
+	if p&ProfileLabels != 0 {
+		pprof.SetGoroutineLabels(pprof.WithLabels(ctx,
+			pprof.Labels("pam.service", t.service, "pam.operation", op)))
+	}
+	if p&ProfileTrace != 0 {
+		region = trace.StartRegion(ctx, "pam."+op)
+	}
+	return func() {
+		if region != nil {
+			region.End()
+		}
+		if p&ProfileLabels != 0 {
+			pprof.SetGoroutineLabels(ctx)
+		}
+	}
+}
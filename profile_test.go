@@ -0,0 +1,33 @@
+package pam
+
+import (
+	"bytes"
+	"context"
+	"runtime/pprof"
+	"runtime/trace"
+	"testing"
+)
+
+func TestProfile(t *testing.T) {
+	SetProfile(ProfileLabels | ProfileTrace)
+	defer SetProfile(0)
+	var buf bytes.Buffer
+	if err := trace.Start(&buf); err != nil {
+		t.Skipf("trace #error: %v", err)
+	}
+	defer trace.Stop()
+
+	tx := conversationStart(t, Credentials{})
+	ctx := pprof.WithLabels(context.Background(), pprof.Labels("test", "profile"))
+	tx.SetLabelContext(ctx)
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+	trace.Stop()
+	if buf.Len() == 0 {
+		t.Fatalf("trace #error: expected trace data")
+	}
+}
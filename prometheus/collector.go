@@ -0,0 +1,123 @@
+// Package prometheus exports metrics of the PAM transactions to Prometheus:
+// the authentications by service and result, the latency of the operations
+// and the conversations with the users.
+//
+// Only the applications importing it link the Prometheus client. A single
+// call registers the collector and observes the transactions:
+//
+//	if _, err := pamprom.Register(prometheus.DefaultRegisterer); err != nil {
+//		return err
+//	}
+package prometheus
+
+import (
+	"github.com/msteinert/pam"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Collector is a prometheus.Collector of the metrics of the PAM
+// transactions, which it gets as pam.Observer.
+type Collector struct {
+	transactions    *prometheus.GaugeVec
+	authentications *prometheus.CounterVec
+	operations      *prometheus.HistogramVec
+	conversations   *prometheus.HistogramVec
+	messages        *prometheus.CounterVec
+	unsubscribe     func()
+}
+
+// NewCollector returns a collector of the metrics of the PAM transactions.
+func NewCollector() *Collector {
+	return &Collector{
+		transactions: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Name: "pam_transactions",
+			Help: "Number of PAM transactions started and not ended yet.",
+		}, []string{"service"}),
+		authentications: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pam_authentications_total",
+			Help: "Number of PAM authentications, by status.",
+		}, []string{"service", "result", "status"}),
+		operations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "pam_operation_duration_seconds",
+			Help:    "Duration of the PAM calls, including the conversations.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 8),
+		}, []string{"service", "operation", "result"}),
+		conversations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "pam_conversation_duration_seconds",
+			Help:    "Duration of the conversations of the modules with the users.",
+			Buckets: prometheus.ExponentialBuckets(0.001, 4, 10),
+		}, []string{"service", "result"}),
+		messages: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "pam_conversation_messages_total",
+			Help: "Number of messages sent by the modules in conversations, by style.",
+		}, []string{"service", "style"}),
+	}
+}
+
+// Register registers a new collector with r and subscribes it to the
+// events of the PAM transactions, alongside the other observers, until
+// Unsubscribe is called.
+func Register(r prometheus.Registerer) (*Collector, error) {
+	c := NewCollector()
+	if err := r.Register(c); err != nil {
+		return nil, err
+	}
+	c.unsubscribe = pam.Subscribe(c)
+	return c, nil
+}
+
+// Unsubscribe stops the collector returned by Register from observing the
+// PAM transactions. Its metrics stay registered.
+func (c *Collector) Unsubscribe() {
+	if c.unsubscribe != nil {
+		c.unsubscribe()
+	}
+}
+
+func (c *Collector) metrics() []prometheus.Collector {
+	return []prometheus.Collector{c.transactions, c.authentications,
+		c.operations, c.conversations, c.messages}
+}
+
+// Describe sends the descriptors of the metrics.
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range c.metrics() {
+		m.Describe(ch)
+	}
+}
+
+// Collect sends the metrics.
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	for _, m := range c.metrics() {
+		m.Collect(ch)
+	}
+}
+
+// Observe updates the metrics with the event.
+func (c *Collector) Observe(e pam.Event) {
+	result := "success"
+	if e.Status != pam.Success {
+		result = "failure"
+	}
+	switch e.Kind {
+	case pam.EventCallStart:
+		// The calls are measured once they return.
+		return
+	case pam.EventStart:
+		if e.Status == pam.Success {
+			c.transactions.WithLabelValues(e.Service).Inc()
+		}
+	case pam.EventEnd:
+		c.transactions.WithLabelValues(e.Service).Dec()
+	case pam.EventConversation:
+		c.conversations.WithLabelValues(e.Service, result).Observe(e.Duration.Seconds())
+		for _, m := range e.Messages {
+			c.messages.WithLabelValues(e.Service, m.Style.String()).Inc()
+		}
+		return
+	}
+	if e.Operation == "authenticate" {
+		c.authentications.WithLabelValues(e.Service, result, e.Status.String()).Inc()
+	}
+	c.operations.WithLabelValues(e.Service, e.Operation, result).Observe(e.Duration.Seconds())
+}
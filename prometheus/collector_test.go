@@ -0,0 +1,51 @@
+package prometheus
+
+import (
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCollector(t *testing.T) {
+	c := NewCollector()
+	r := prometheus.NewPedanticRegistry()
+	if err := r.Register(c); err != nil {
+		t.Fatalf("register #error: %v", err)
+	}
+	for _, e := range []pam.Event{
+		{Kind: pam.EventStart, Service: "login", Operation: "start"},
+		{Kind: pam.EventConversation, Service: "login", Operation: "conv", Duration: time.Second,
+			Messages: []pam.ConversationMessage{{Style: pam.PromptEchoOff, Message: "Password: "}}},
+		{Kind: pam.EventCallStart, Service: "login", Operation: "authenticate"},
+		{Kind: pam.EventOperation, Service: "login", Operation: "authenticate", Status: pam.ErrAuth},
+		{Kind: pam.EventOperation, Service: "login", Operation: "authenticate"},
+		{Kind: pam.EventOperation, Service: "login", Operation: "acct_mgmt"},
+	} {
+		c.Observe(e)
+	}
+	if v := testutil.ToFloat64(c.transactions.WithLabelValues("login")); v != 1 {
+		t.Fatalf("transactions #error: expected 1, got %v", v)
+	}
+	if v := testutil.ToFloat64(c.authentications.WithLabelValues("login", "failure", "PAM_AUTH_ERR")); v != 1 {
+		t.Fatalf("authentications #error: expected 1 failure, got %v", v)
+	}
+	if v := testutil.ToFloat64(c.authentications.WithLabelValues("login", "success", "PAM_SUCCESS")); v != 1 {
+		t.Fatalf("authentications #error: expected 1 success, got %v", v)
+	}
+	if v := testutil.ToFloat64(c.messages.WithLabelValues("login", "PAM_PROMPT_ECHO_OFF")); v != 1 {
+		t.Fatalf("messages #error: expected 1, got %v", v)
+	}
+	if n := testutil.CollectAndCount(c, "pam_operation_duration_seconds"); n != 4 {
+		t.Fatalf("operations #error: expected 4 series, got %d", n)
+	}
+	c.Observe(pam.Event{Kind: pam.EventEnd, Service: "login", Operation: "end"})
+	if v := testutil.ToFloat64(c.transactions.WithLabelValues("login")); v != 0 {
+		t.Fatalf("transactions #error: expected 0, got %v", v)
+	}
+	if problems, err := testutil.GatherAndLint(r); err != nil || len(problems) != 0 {
+		t.Fatalf("lint #error: %v %v", problems, err)
+	}
+}
@@ -0,0 +1,50 @@
+//go:build cgo
+
+package pam
+
+//#include <security/pam_appl.h>
+//void put_envs(pam_handle_t *pamh, int n, const char **entries, int *status);
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"unsafe"
+)
+
+// putEnvs sets the NAME=value entries with a single call to C, joining the
+// failures of the entries that can't be set.
+func (t *Transaction) putEnvs(entries []string) error {
+	if err, ok := diverted(t.thread, func() error { return t.putEnvs(entries) }); ok {
+		return err
+	}
+	if err := t.state.enter(); err != nil {
+		return err
+	}
+	defer t.state.leave()
+	if len(entries) == 0 {
+		return nil
+	}
+	values := make([]*C.char, len(entries))
+	status := make([]C.int, len(entries))
+	for i, entry := range entries {
+		values[i] = cString(entry)
+		defer cFree(unsafe.Pointer(values[i]))
+	}
+	dones := make([]func(C.int) C.int, len(entries))
+	for i := range entries {
+		dones[i] = t.callHooks(EventCall, "putenv", 0)
+	}
+	C.put_envs(t.handle, C.int(len(entries)), &values[0], &status[0])
+	var errs []error
+	last := C.int(C.PAM_SUCCESS)
+	for i, done := range dones {
+		if s := done(status[i]); s != C.PAM_SUCCESS {
+			last = s
+			name, _, _ := parseEnvEntry(entries[i])
+			errs = append(errs, fmt.Errorf("%s: %w", name, ReturnType(s)))
+		}
+	}
+	t.result(last)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,589 @@
+// Package qrcode renders QR codes as text, for the modules enrolling their
+// users from a terminal login: the otpauth URIs provisioning the keys of the
+// authenticator applications, or the links registering passkeys, are shown
+// with the UTF-8 half blocks in TextInfo messages that fit the limits of the
+// conversations.
+//
+// The codes are encoded in byte mode, with the smallest version holding the
+// data at the error correction level.
+package qrcode
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/msteinert/pam"
+)
+
+// ErrTooLong is returned when the data does not fit a QR code of version 40
+// at the error correction level.
+var ErrTooLong = errors.New("data too long for a QR code")
+
+// Level is the error correction level of a code.
+type Level int
+
+// Error correction levels, recovering about 7%, 15%, 25% and 30% of the
+// codewords.
+const (
+	Low Level = iota
+	Medium
+	Quartile
+	High
+)
+
+// formatBits returns the bits of the level in the format information.
+func (l Level) formatBits() int {
+	return [...]int{1, 0, 3, 2}[l]
+}
+
+// The error correction codewords per block and the number of blocks, by
+// level and version, index 0 being unused.
+var (
+	eccCodewordsPerBlock = [4][41]int{
+		{0, 7, 10, 15, 20, 26, 18, 20, 24, 30, 18, 20, 24, 26, 30, 22, 24, 28, 30, 28, 28, 28, 28, 30, 30, 26, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+		{0, 10, 16, 26, 18, 24, 16, 18, 22, 22, 26, 30, 22, 22, 24, 24, 28, 28, 26, 26, 26, 26, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28, 28},
+		{0, 13, 22, 18, 26, 18, 24, 18, 22, 20, 24, 28, 26, 24, 20, 30, 24, 28, 28, 26, 30, 28, 30, 30, 30, 30, 28, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+		{0, 17, 28, 22, 16, 22, 28, 26, 26, 24, 28, 24, 28, 22, 24, 24, 30, 28, 28, 26, 28, 30, 24, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30, 30},
+	}
+	eccBlocks = [4][41]int{
+		{0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 4, 4, 4, 4, 4, 6, 6, 6, 6, 7, 8, 8, 9, 9, 10, 12, 12, 12, 13, 14, 15, 16, 17, 18, 19, 19, 20, 21, 22, 24, 25},
+		{0, 1, 1, 1, 2, 2, 4, 4, 4, 5, 5, 5, 8, 9, 9, 10, 10, 11, 13, 14, 16, 17, 17, 18, 20, 21, 23, 25, 26, 28, 29, 31, 33, 35, 37, 38, 40, 43, 45, 47, 49},
+		{0, 1, 1, 2, 2, 4, 4, 6, 6, 8, 8, 8, 10, 12, 16, 12, 17, 16, 18, 21, 20, 23, 23, 25, 27, 29, 34, 34, 35, 38, 40, 43, 45, 48, 51, 53, 56, 59, 62, 65, 68},
+		{0, 1, 1, 2, 4, 4, 4, 5, 6, 8, 8, 11, 11, 16, 16, 18, 16, 19, 21, 25, 25, 25, 34, 30, 32, 35, 37, 40, 42, 45, 48, 51, 54, 57, 60, 63, 66, 70, 74, 77, 81},
+	}
+)
+
+// Code is a QR code.
+type Code struct {
+	Version int
+	Level   Level
+	// Size is the number of modules of a side, 17 + 4 * Version.
+	Size int
+
+	modules  [][]bool
+	function [][]bool
+}
+
+// Encode encodes data as a QR code, with the smallest version holding it at
+// the level.
+func Encode(data string, level Level) (*Code, error) {
+	version := 0
+	for v := 1; v <= 40; v++ {
+		if 4+countBits(v)+8*len(data) <= 8*dataCodewords(v, level) {
+			version = v
+			break
+		}
+	}
+	if version == 0 {
+		return nil, ErrTooLong
+	}
+
+	var bits bitBuffer
+	bits.append(4, 4) // Byte mode.
+	bits.append(len(data), countBits(version))
+	for i := 0; i < len(data); i++ {
+		bits.append(int(data[i]), 8)
+	}
+	capacity := 8 * dataCodewords(version, level)
+	bits.append(0, min(4, capacity-len(bits)))
+	bits.append(0, (8-len(bits)%8)%8)
+	for pad := 0xec; len(bits) < capacity; pad ^= 0xec ^ 0x11 {
+		bits.append(pad, 8)
+	}
+
+	c := &Code{Version: version, Level: level, Size: 17 + 4*version}
+	c.modules = newGrid(c.Size)
+	c.function = newGrid(c.Size)
+	c.drawFunctionPatterns()
+	c.drawCodewords(c.addECCAndInterleave(bits.bytes()))
+
+	mask, best := 0, -1
+	for m := 0; m < 8; m++ {
+		c.applyMask(m)
+		c.drawFormatBits(m)
+		if p := c.penalty(); best < 0 || p < best {
+			mask, best = m, p
+		}
+		c.applyMask(m) // Undo it.
+	}
+	c.applyMask(mask)
+	c.drawFormatBits(mask)
+	return c, nil
+}
+
+// Dark returns whether the module at the column x and the row y is dark,
+// the modules out of the code being light.
+func (c *Code) Dark(x, y int) bool {
+	return x >= 0 && y >= 0 && x < c.Size && y < c.Size && c.modules[y][x]
+}
+
+// Render renders the code with the UTF-8 half blocks, two rows of modules
+// per line, surrounded by a quiet zone of light modules. If invert is true,
+// the light modules are drawn rather than the dark ones, for the terminals
+// writing light characters on a dark background.
+func (c *Code) Render(quiet int, invert bool) string {
+	filled := func(x, y int) bool {
+		if y >= c.Size+quiet {
+			// The half line below the code is left to the background.
+			return false
+		}
+		return c.Dark(x, y) != invert
+	}
+	var b strings.Builder
+	for y := -quiet; y < c.Size+quiet; y += 2 {
+		for x := -quiet; x < c.Size+quiet; x++ {
+			switch top, bottom := filled(x, y), filled(x, y+1); {
+			case top && bottom:
+				b.WriteString("█")
+			case top:
+				b.WriteString("▀")
+			case bottom:
+				b.WriteString("▄")
+			default:
+				b.WriteString(" ")
+			}
+		}
+		b.WriteString("\n")
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// MaxMessageSize is the maximum size of the messages of a conversation, in
+// bytes: PAM_MAX_MSG_SIZE less the terminating NUL.
+const MaxMessageSize = 511
+
+// Messages splits text into messages of at most MaxMessageSize bytes, at the
+// ends of its lines, so that the conversations showing them one per line
+// show the text unchanged. The lines too long for a message are split.
+func Messages(text string) []string {
+	var messages []string
+	var cur strings.Builder
+	flush := func() {
+		messages = append(messages, cur.String())
+		cur.Reset()
+	}
+	for _, line := range strings.Split(text, "\n") {
+		for len(line) > MaxMessageSize {
+			if cur.Len() > 0 {
+				flush()
+			}
+			n := MaxMessageSize
+			for n > 0 && !utf8.RuneStart(line[n]) {
+				n--
+			}
+			cur.WriteString(line[:n])
+			flush()
+			line = line[n:]
+		}
+		if cur.Len() > 0 && cur.Len()+1+len(line) > MaxMessageSize {
+			flush()
+		} else if cur.Len() > 0 {
+			cur.WriteString("\n")
+		}
+		cur.WriteString(line)
+	}
+	flush()
+	return messages
+}
+
+// Show shows uri as a QR code of Medium level, inverted for the terminals
+// with a dark background, in TextInfo messages.
+func Show(conv pam.ConversationHandler, uri string) error {
+	c, err := Encode(uri, Medium)
+	if err != nil {
+		return err
+	}
+	for _, msg := range Messages(c.Render(2, true)) {
+		if _, err := conv.RespondPAM(pam.TextInfo, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// countBits returns the size of the character count of the byte mode.
+func countBits(version int) int {
+	if version < 10 {
+		return 8
+	}
+	return 16
+}
+
+// rawDataModules returns the number of modules of the version holding data
+// and error correction codewords, and the remainder bits.
+func rawDataModules(version int) int {
+	n := (16*version+128)*version + 64
+	if version >= 2 {
+		align := version/7 + 2
+		n -= (25*align-10)*align - 55
+		if version >= 7 {
+			n -= 36
+		}
+	}
+	return n
+}
+
+// dataCodewords returns the number of data codewords of the version at the
+// level.
+func dataCodewords(version int, level Level) int {
+	return rawDataModules(version)/8 -
+		eccCodewordsPerBlock[level][version]*eccBlocks[level][version]
+}
+
+type bitBuffer []bool
+
+func (b *bitBuffer) append(v, n int) {
+	for i := n - 1; i >= 0; i-- {
+		*b = append(*b, v>>i&1 != 0)
+	}
+}
+
+func (b bitBuffer) bytes() []byte {
+	data := make([]byte, len(b)/8)
+	for i, bit := range b {
+		if bit {
+			data[i/8] |= 1 << (7 - i%8)
+		}
+	}
+	return data
+}
+
+func newGrid(size int) [][]bool {
+	grid := make([][]bool, size)
+	for i := range grid {
+		grid[i] = make([]bool, size)
+	}
+	return grid
+}
+
+// set sets a module of a function pattern.
+func (c *Code) set(x, y int, dark bool) {
+	c.modules[y][x] = dark
+	c.function[y][x] = true
+}
+
+func (c *Code) drawFunctionPatterns() {
+	for i := 0; i < c.Size; i++ {
+		c.set(6, i, i%2 == 0)
+		c.set(i, 6, i%2 == 0)
+	}
+	c.drawFinder(3, 3)
+	c.drawFinder(c.Size-4, 3)
+	c.drawFinder(3, c.Size-4)
+
+	pos := alignmentPositions(c.Version)
+	last := len(pos) - 1
+	for i, x := range pos {
+		for j, y := range pos {
+			// Skip the corners of the finder patterns.
+			if i == 0 && j == 0 || i == 0 && j == last || i == last && j == 0 {
+				continue
+			}
+			for dy := -2; dy <= 2; dy++ {
+				for dx := -2; dx <= 2; dx++ {
+					c.set(x+dx, y+dy, max(abs(dx), abs(dy)) != 1)
+				}
+			}
+		}
+	}
+
+	// Reserve the format information, drawn with the mask.
+	c.drawFormatBits(0)
+	c.drawVersion()
+}
+
+// drawFinder draws a finder pattern centered on x, y, with its separator.
+func (c *Code) drawFinder(x, y int) {
+	for dy := -4; dy <= 4; dy++ {
+		for dx := -4; dx <= 4; dx++ {
+			xx, yy := x+dx, y+dy
+			if xx < 0 || yy < 0 || xx >= c.Size || yy >= c.Size {
+				continue
+			}
+			d := max(abs(dx), abs(dy))
+			c.set(xx, yy, d != 2 && d != 4)
+		}
+	}
+}
+
+// alignmentPositions returns the coordinates of the centers of the
+// alignment patterns, in both directions.
+func alignmentPositions(version int) []int {
+	if version == 1 {
+		return nil
+	}
+	n := version/7 + 2
+	step := (version*8 + n*3 + 5) / (n*4 - 4) * 2
+	pos := make([]int, n)
+	pos[0] = 6
+	for i, p := n-1, 17+4*version-7; i > 0; i, p = i-1, p-step {
+		pos[i] = p
+	}
+	return pos
+}
+
+// formatInfo returns the 15 bits of the format information of the level and
+// the mask.
+func formatInfo(level Level, mask int) int {
+	data := level.formatBits()<<3 | mask
+	rem := data
+	for i := 0; i < 10; i++ {
+		rem = rem<<1 ^ (rem>>9)*0x537
+	}
+	return (data<<10 | rem) ^ 0x5412
+}
+
+func (c *Code) drawFormatBits(mask int) {
+	bits := formatInfo(c.Level, mask)
+	bit := func(i int) bool { return bits>>i&1 != 0 }
+	for i := 0; i <= 5; i++ {
+		c.set(8, i, bit(i))
+	}
+	c.set(8, 7, bit(6))
+	c.set(8, 8, bit(7))
+	c.set(7, 8, bit(8))
+	for i := 9; i < 15; i++ {
+		c.set(14-i, 8, bit(i))
+	}
+	for i := 0; i < 8; i++ {
+		c.set(c.Size-1-i, 8, bit(i))
+	}
+	for i := 8; i < 15; i++ {
+		c.set(8, c.Size-15+i, bit(i))
+	}
+	c.set(8, c.Size-8, true) // The dark module.
+}
+
+// versionInfo returns the 18 bits of the version information.
+func versionInfo(version int) int {
+	rem := version
+	for i := 0; i < 12; i++ {
+		rem = rem<<1 ^ (rem>>11)*0x1f25
+	}
+	return version<<12 | rem
+}
+
+func (c *Code) drawVersion() {
+	if c.Version < 7 {
+		return
+	}
+	bits := versionInfo(c.Version)
+	for i := 0; i < 18; i++ {
+		dark := bits>>i&1 != 0
+		a, b := c.Size-11+i%3, i/3
+		c.set(a, b, dark)
+		c.set(b, a, dark)
+	}
+}
+
+// addECCAndInterleave splits the data codewords into blocks, adds their
+// error correction codewords and interleaves them.
+func (c *Code) addECCAndInterleave(data []byte) []byte {
+	nblocks := eccBlocks[c.Level][c.Version]
+	eccLen := eccCodewordsPerBlock[c.Level][c.Version]
+	raw := rawDataModules(c.Version) / 8
+	nshort := nblocks - raw%nblocks
+	shortLen := raw / nblocks
+
+	divisor := rsDivisor(eccLen)
+	blocks := make([][]byte, nblocks)
+	for i, k := 0, 0; i < nblocks; i++ {
+		n := shortLen - eccLen
+		if i >= nshort {
+			n++
+		}
+		block := make([]byte, 0, shortLen+1)
+		block = append(block, data[k:k+n]...)
+		k += n
+		ecc := rsRemainder(block, divisor)
+		if i < nshort {
+			// Padding aligning the short blocks, skipped below.
+			block = append(block, 0)
+		}
+		blocks[i] = append(block, ecc...)
+	}
+
+	result := make([]byte, 0, raw)
+	for i := 0; i <= shortLen; i++ {
+		for j, block := range blocks {
+			if i != shortLen-eccLen || j >= nshort {
+				result = append(result, block[i])
+			}
+		}
+	}
+	return result
+}
+
+// drawCodewords draws the codewords in the zigzag of the modules which are
+// not part of the function patterns.
+func (c *Code) drawCodewords(data []byte) {
+	i := 0
+	for right := c.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			// Skip the vertical timing pattern.
+			right = 5
+		}
+		for vert := 0; vert < c.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x := right - j
+				y := vert
+				if (right+1)&2 == 0 {
+					// Upwards.
+					y = c.Size - 1 - vert
+				}
+				if !c.function[y][x] && i < len(data)*8 {
+					c.modules[y][x] = data[i/8]>>(7-i%8)&1 != 0
+					i++
+				}
+			}
+		}
+	}
+}
+
+// applyMask inverts the modules selected by the mask, but those of the
+// function patterns: applying it twice undoes it.
+func (c *Code) applyMask(mask int) {
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			var invert bool
+			switch mask {
+			case 0:
+				invert = (x+y)%2 == 0
+			case 1:
+				invert = y%2 == 0
+			case 2:
+				invert = x%3 == 0
+			case 3:
+				invert = (x+y)%3 == 0
+			case 4:
+				invert = (x/3+y/2)%2 == 0
+			case 5:
+				invert = x*y%2+x*y%3 == 0
+			case 6:
+				invert = (x*y%2+x*y%3)%2 == 0
+			case 7:
+				invert = ((x+y)%2+x*y%3)%2 == 0
+			}
+			if invert && !c.function[y][x] {
+				c.modules[y][x] = !c.modules[y][x]
+			}
+		}
+	}
+}
+
+// finderLike are the patterns looking like the finder patterns, penalized.
+var finderLike = [2][11]bool{
+	{true, false, true, true, true, false, true, false, false, false, false},
+	{false, false, false, false, true, false, true, true, true, false, true},
+}
+
+// penalty returns the penalty of the code as masked, the lowest being the
+// easiest to scan.
+func (c *Code) penalty() int {
+	p := 0
+	// The rows and the columns.
+	for _, transpose := range []bool{false, true} {
+		at := func(i, j int) bool {
+			if transpose {
+				return c.Dark(i, j)
+			}
+			return c.Dark(j, i)
+		}
+		for i := 0; i < c.Size; i++ {
+			run := 0
+			for j := 0; j < c.Size; j++ {
+				if j > 0 && at(i, j) == at(i, j-1) {
+					run++
+				} else {
+					run = 1
+				}
+				if run == 5 {
+					p += 3
+				} else if run > 5 {
+					p++
+				}
+			}
+			for j := -4; j < c.Size; j++ {
+				for _, pattern := range finderLike {
+					match := true
+					for k, dark := range pattern {
+						if at(i, j+k) != dark {
+							match = false
+							break
+						}
+					}
+					if match {
+						p += 40
+					}
+				}
+			}
+		}
+	}
+	// The 2x2 blocks of the same color.
+	dark := 0
+	for y := 0; y < c.Size; y++ {
+		for x := 0; x < c.Size; x++ {
+			d := c.modules[y][x]
+			if d {
+				dark++
+			}
+			if x > 0 && y > 0 && d == c.modules[y][x-1] && d == c.modules[y-1][x] && d == c.modules[y-1][x-1] {
+				p += 3
+			}
+		}
+	}
+	// The balance of the dark and light modules.
+	total := c.Size * c.Size
+	k := (abs(dark*20-total*10)+total-1)/total - 1
+	return p + k*10
+}
+
+// rsDivisor returns the generator polynomial of the Reed-Solomon codes of
+// degree n, without its leading term.
+func rsDivisor(n int) []byte {
+	result := make([]byte, n)
+	result[n-1] = 1
+	root := byte(1)
+	for i := 0; i < n; i++ {
+		for j := range result {
+			result[j] = gfMul(result[j], root)
+			if j+1 < n {
+				result[j] ^= result[j+1]
+			}
+		}
+		root = gfMul(root, 2)
+	}
+	return result
+}
+
+// rsRemainder returns the error correction codewords of data.
+func rsRemainder(data, divisor []byte) []byte {
+	result := make([]byte, len(divisor))
+	for _, b := range data {
+		factor := b ^ result[0]
+		copy(result, result[1:])
+		result[len(result)-1] = 0
+		for i, coef := range divisor {
+			result[i] ^= gfMul(coef, factor)
+		}
+	}
+	return result
+}
+
+// gfMul multiplies in GF(2^8) modulo x^8 + x^4 + x^3 + x^2 + 1.
+func gfMul(x, y byte) byte {
+	z := 0
+	for i := 7; i >= 0; i-- {
+		z = z<<1 ^ (z>>7)*0x11d
+		z ^= int(y>>i&1) * int(x)
+	}
+	return byte(z)
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
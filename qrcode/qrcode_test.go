@@ -0,0 +1,264 @@
+package qrcode
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/msteinert/pam"
+)
+
+func TestFormatAndVersionInfo(t *testing.T) {
+	if f := formatInfo(Medium, 0); f != 0b101010000010010 {
+		t.Fatalf("format #error: got %015b", f)
+	}
+	if f := formatInfo(Low, 0); f != 0b111011111000100 {
+		t.Fatalf("format #error: got %015b", f)
+	}
+	if f := formatInfo(High, 7); f != 0b000100000111011 {
+		t.Fatalf("format #error: got %015b", f)
+	}
+	if v := versionInfo(7); v != 0b000111110010010100 {
+		t.Fatalf("version #error: got %018b", v)
+	}
+	if v := versionInfo(40); v != 0b101000110001101001 {
+		t.Fatalf("version #error: got %018b", v)
+	}
+}
+
+func TestDataCodewords(t *testing.T) {
+	for _, tt := range []struct {
+		version  int
+		level    Level
+		expected int
+	}{
+		{1, Low, 19}, {1, Medium, 16}, {1, Quartile, 13}, {1, High, 9},
+		{5, Quartile, 62}, {10, Medium, 216}, {40, Low, 2956}, {40, High, 1276},
+	} {
+		if n := dataCodewords(tt.version, tt.level); n != tt.expected {
+			t.Fatalf("codewords #error: %d-%d: expected %d, got %d", tt.version, tt.level, tt.expected, n)
+		}
+	}
+}
+
+func TestAlignmentPositions(t *testing.T) {
+	for version, expected := range map[int][]int{
+		1:  nil,
+		2:  {6, 18},
+		7:  {6, 22, 38},
+		32: {6, 34, 60, 86, 112, 138},
+		40: {6, 30, 58, 86, 114, 142, 170},
+	} {
+		if pos := alignmentPositions(version); !slices.Equal(pos, expected) {
+			t.Fatalf("alignment #error: %d: expected %v, got %v", version, expected, pos)
+		}
+	}
+}
+
+// decode reads back the data of a code, checking its error correction
+// codewords.
+func decode(t *testing.T, c *Code) string {
+	t.Helper()
+	var format int
+	for i := 14; i >= 9; i-- {
+		format = format<<1 | btoi(c.Dark(14-i, 8))
+	}
+	format = format<<1 | btoi(c.Dark(7, 8))
+	format = format<<1 | btoi(c.Dark(8, 8))
+	format = format<<1 | btoi(c.Dark(8, 7))
+	for i := 5; i >= 0; i-- {
+		format = format<<1 | btoi(c.Dark(8, i))
+	}
+	mask := -1
+	for m := 0; m < 8; m++ {
+		if formatInfo(c.Level, m) == format {
+			mask = m
+		}
+	}
+	if mask < 0 {
+		t.Fatalf("decode #error: bad format information %015b", format)
+	}
+
+	u := *c
+	u.modules = newGrid(c.Size)
+	for y := range u.modules {
+		copy(u.modules[y], c.modules[y])
+	}
+	u.applyMask(mask)
+	var bits bitBuffer
+	for right := u.Size - 1; right >= 1; right -= 2 {
+		if right == 6 {
+			right = 5
+		}
+		for vert := 0; vert < u.Size; vert++ {
+			for j := 0; j < 2; j++ {
+				x, y := right-j, vert
+				if (right+1)&2 == 0 {
+					y = u.Size - 1 - vert
+				}
+				if !u.function[y][x] {
+					bits = append(bits, u.modules[y][x])
+				}
+			}
+		}
+	}
+	codewords := bits.bytes()[:rawDataModules(c.Version)/8]
+
+	nblocks := eccBlocks[c.Level][c.Version]
+	eccLen := eccCodewordsPerBlock[c.Level][c.Version]
+	blocks := make([][]byte, nblocks)
+	nshort := nblocks - len(codewords)%nblocks
+	dataLen := len(codewords)/nblocks - eccLen
+	k := 0
+	for i := 0; i <= dataLen; i++ {
+		for j := range blocks {
+			if i < dataLen || j >= nshort {
+				blocks[j] = append(blocks[j], codewords[k])
+				k++
+			}
+		}
+	}
+	for i := 0; i < eccLen; i++ {
+		for j := range blocks {
+			blocks[j] = append(blocks[j], codewords[k])
+			k++
+		}
+	}
+	var data []byte
+	for _, block := range blocks {
+		root := byte(1)
+		for i := 0; i < eccLen; i++ {
+			var s byte
+			for _, b := range block {
+				s = gfMul(s, root) ^ b
+			}
+			if s != 0 {
+				t.Fatalf("decode #error: syndrome %d is %d", i, s)
+			}
+			root = gfMul(root, 2)
+		}
+		data = append(data, block[:len(block)-eccLen]...)
+	}
+
+	if data[0]>>4 != 4 {
+		t.Fatalf("decode #error: mode %d", data[0]>>4)
+	}
+	var n, offset int
+	if c.Version < 10 {
+		n, offset = int(data[0]&0xf)<<4|int(data[1]>>4), 1
+	} else {
+		n, offset = int(data[0]&0xf)<<12|int(data[1])<<4|int(data[2]>>4), 2
+	}
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = data[offset+i]<<4 | data[offset+i+1]>>4
+	}
+	return string(out)
+}
+
+func btoi(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func TestEncode(t *testing.T) {
+	uri := "otpauth://totp/Example%20Co:alice@example.com?algorithm=SHA1&digits=6&issuer=Example+Co&period=30&secret=JBSWY3DPEHPK3PXP"
+	for _, tt := range []struct {
+		data    string
+		level   Level
+		version int
+	}{
+		{"", Low, 1},
+		{"hello", High, 1},
+		{"https://example.com", Medium, 2},
+		{uri, Medium, 7},
+		{uri, High, 11},
+		{strings.Repeat("0123456789", 30), Quartile, 16},
+		{strings.Repeat("x", 2953), Low, 40},
+	} {
+		c, err := Encode(tt.data, tt.level)
+		if err != nil {
+			t.Fatalf("encode #error: %v", err)
+		}
+		if c.Version != tt.version || c.Size != 17+4*tt.version {
+			t.Fatalf("encode #error: %d bytes at %d: expected version %d, got %d", len(tt.data), tt.level, tt.version, c.Version)
+		}
+		if s := decode(t, c); s != tt.data {
+			t.Fatalf("encode #error: expected %q, got %q", tt.data, s)
+		}
+	}
+	if _, err := Encode(strings.Repeat("x", 2954), Low); !errors.Is(err, ErrTooLong) {
+		t.Fatalf("encode #error: expected %v, got %v", ErrTooLong, err)
+	}
+}
+
+func TestRender(t *testing.T) {
+	c, err := Encode("hello", Low)
+	if err != nil {
+		t.Fatalf("encode #error: %v", err)
+	}
+	lines := strings.Split(c.Render(2, false), "\n")
+	// 21 modules and the quiet zones, two rows per line.
+	if len(lines) != 13 {
+		t.Fatalf("render #error: expected 13 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if n := utf8.RuneCountInString(line); n != 25 {
+			t.Fatalf("render #error: expected 25 columns, got %d", n)
+		}
+	}
+	// The top of the finder pattern in the top left corner.
+	if lines[1] != "  █▀▀▀▀▀█"+lines[1][len("  █▀▀▀▀▀█"):] {
+		t.Fatalf("render #error: unexpected line %q", lines[1])
+	}
+	inverted := strings.Split(c.Render(2, true), "\n")
+	if inverted[0] != strings.Repeat("█", 25) || inverted[12] != strings.Repeat("▀", 25) {
+		t.Fatalf("render #error: unexpected quiet zone %q, %q", inverted[0], inverted[12])
+	}
+}
+
+func TestMessages(t *testing.T) {
+	line := strings.Repeat("█", 45)
+	text := strings.Repeat(line+"\n", 10) + line
+	messages := Messages(text)
+	if len(messages) != 4 {
+		t.Fatalf("messages #error: expected 4 messages, got %d", len(messages))
+	}
+	for _, msg := range messages {
+		if len(msg) > MaxMessageSize {
+			t.Fatalf("messages #error: %d bytes", len(msg))
+		}
+	}
+	if s := strings.Join(messages, "\n"); s != text {
+		t.Fatalf("messages #error: expected %q, got %q", text, s)
+	}
+
+	long := strings.Repeat("é", 300)
+	messages = Messages("a\n" + long)
+	if len(messages) != 3 || messages[0] != "a" || messages[1]+messages[2] != long || !utf8.ValidString(messages[1]) {
+		t.Fatalf("messages #error: got %q", messages)
+	}
+}
+
+func TestShow(t *testing.T) {
+	var shown []string
+	conv := pam.ConversationFunc(func(s pam.Style, msg string) (string, error) {
+		if s != pam.TextInfo {
+			t.Fatalf("show #error: unexpected style %v", s)
+		}
+		shown = append(shown, msg)
+		return "", nil
+	})
+	uri := "otpauth://totp/alice?secret=JBSWY3DPEHPK3PXP"
+	if err := Show(conv, uri); err != nil {
+		t.Fatalf("show #error: %v", err)
+	}
+	c, _ := Encode(uri, Medium)
+	if s := strings.Join(shown, "\n"); s != c.Render(2, true) || len(shown) < 2 {
+		t.Fatalf("show #error: got %d messages %q", len(shown), shown)
+	}
+}
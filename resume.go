@@ -0,0 +1,74 @@
+package pam
+
+import "errors"
+
+// operation is a PAM operation of a transaction, with its flags.
+type operation struct {
+	name string
+	f    Flags
+}
+
+// errNotIncomplete is the failure of Resume when the last operation wasn't
+// suspended.
+var errNotIncomplete = errors.New("no incomplete operation to resume")
+
+// resumable records the operation to be resumed if it was suspended, or
+// the session and the credentials it established or removed if it
+// succeeded, for EndWithOptions, and returns its error. Its status is
+// checked with StatusOf, as its conversation error may be caused by
+// ErrConvAgain when the modules not supporting it fail.
+func (t *Transaction) resumable(name string, f Flags, err error) error {
+	t.incomplete = nil
+	if s := StatusOf(err); s == ErrIncomplete || s == ErrConvAgain {
+		t.incomplete = &operation{name, f}
+	}
+	if err != nil {
+		return err
+	}
+	switch {
+	case name == "open_session":
+		t.session.Store(true)
+	case name == "close_session":
+		t.session.Store(false)
+	case name == "setcred" && f&DeleteCred != 0:
+		t.cred.Store(false)
+	case name == "setcred" && f&(EstablishCred|ReinitializeCred) != 0:
+		t.cred.Store(true)
+	}
+	return nil
+}
+
+// Resume calls the last operation of the transaction again, with the same
+// flags, once it was suspended, returning ErrIncomplete or ErrConvAgain.
+//
+// Event driven applications can't block in their conversation handlers
+// waiting for the user: their handlers can return ErrConvAgain instead, so
+// that the conversation returns PAM_CONV_AGAIN and the modules supporting
+// it suspend the operation. Linux-PAM then returns ErrIncomplete, or
+// ErrConvAgain for the user name prompts of pam_get_user. Once the response
+// is available, Resume runs the stack again, from the suspended module for
+// ErrIncomplete, which converses again. The modules not supporting it fail
+// instead, usually with ErrConv.
+func (t *Transaction) Resume() error {
+	op := t.incomplete
+	if op == nil {
+		if t.state.ended() {
+			return ErrTransactionEnded
+		}
+		return errNotIncomplete
+	}
+	switch op.name {
+	case "authenticate":
+		return t.Authenticate(op.f)
+	case "setcred":
+		return t.SetCred(op.f)
+	case "acct_mgmt":
+		return t.AcctMgmt(op.f)
+	case "chauthtok":
+		return t.ChangeAuthTok(op.f)
+	case "open_session":
+		return t.OpenSession(op.f)
+	default:
+		return t.CloseSession(op.f)
+	}
+}
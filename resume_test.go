@@ -0,0 +1,47 @@
+package pam
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTransaction_Resume(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	var prompts int
+	pending := true
+	tx, err := StartConfDir("succeed-if-user-test", "", ConversationFunc(
+		func(s Style, msg string) (string, error) {
+			prompts++
+			if pending {
+				return "", ErrConvAgain
+			}
+			return "testuser", nil
+		}), "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	if err := tx.Resume(); !errors.Is(err, errNotIncomplete) {
+		t.Fatalf("resume #error: expected %v, got %v", errNotIncomplete, err)
+	}
+	// pam_get_user returns PAM_CONV_AGAIN rather than PAM_INCOMPLETE.
+	if err := tx.Authenticate(0); !errors.Is(err, ErrConvAgain) || tx.Status() != ErrConvAgain {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrConvAgain, err)
+	}
+	pending = false
+	if err := tx.Resume(); err != nil {
+		t.Fatalf("resume #error: %v", err)
+	}
+	if user, err := tx.GetItem(User); err != nil || user != "testuser" || prompts != 2 {
+		t.Fatalf("resume #error: unexpected user %q, %v after %d prompts", user, err, prompts)
+	}
+	if err := tx.Resume(); !errors.Is(err, errNotIncomplete) {
+		t.Fatalf("resume #error: expected %v, got %v", errNotIncomplete, err)
+	}
+	tx.Close()
+	if err := tx.Resume(); !errors.Is(err, ErrTransactionEnded) {
+		t.Fatalf("resume #error: expected %v, got %v", ErrTransactionEnded, err)
+	}
+}
@@ -0,0 +1,124 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"syscall"
+)
+
+// RunAsOptions defines how RunAsUser runs the command.
+type RunAsOptions struct {
+	// User is the name of the user running the command. If empty, it is
+	// the User item of the transaction, as modules may have changed it.
+	User string
+	// Flags are the flags of the credentials and session calls, such as
+	// Silent.
+	Flags Flags
+	// KeepCredentials runs the command with the credentials of the
+	// process, for example when set in cmd.SysProcAttr by the caller.
+	KeepCredentials bool
+}
+
+// RunAsUser runs cmd as the user of an authenticated transaction, in a
+// PAM session: it establishes the user credentials and opens a session, as
+// Transaction.StartSession does, then starts cmd with the PAM environment merged into cmd.Env by ApplyEnv,
+// the home directory of the user as working directory unless cmd.Dir is
+// set, and the user and group IDs of the user, including the supplementary
+// groups. Once cmd exits, or is killed as ctx is done, it closes the
+// session and deletes the credentials, in the reverse order.
+//
+// If cmd.Env is nil, the command gets the HOME, USER, LOGNAME and PATH
+// variables of the user, not the environment of the process. The
+// error of the command, such as an *exec.ExitError, is joined with those
+// of the PAM calls closing the session.
+func RunAsUser(ctx context.Context, tx *Transaction, cmd *exec.Cmd, opts RunAsOptions) error {
+	name := opts.User
+	if name == "" {
+		var err error
+		if name, err = tx.GetItem(User); err != nil {
+			return err
+		}
+	}
+	u, err := user.Lookup(name)
+	if err != nil {
+		return err
+	}
+	cred, err := credential(u)
+	if err != nil {
+		return err
+	}
+
+	s, err := tx.StartSession(opts.Flags)
+	if err != nil {
+		return err
+	}
+	return errors.Join(runAs(ctx, tx, cmd, u, cred, opts), s.Close())
+}
+
+// credential returns the credentials of the user.
+func credential(u *user.User) (*syscall.Credential, error) {
+	uid, err := strconv.ParseUint(u.Uid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	gid, err := strconv.ParseUint(u.Gid, 10, 32)
+	if err != nil {
+		return nil, err
+	}
+	cred := &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid)}
+	groups, err := u.GroupIds()
+	if err != nil {
+		return nil, err
+	}
+	for _, g := range groups {
+		if id, err := strconv.ParseUint(g, 10, 32); err == nil {
+			cred.Groups = append(cred.Groups, uint32(id))
+		}
+	}
+	return cred, nil
+}
+
+// runAs runs cmd with the environment and credentials of the user, until it
+// exits or ctx is done.
+func runAs(ctx context.Context, tx *Transaction, cmd *exec.Cmd, u *user.User, cred *syscall.Credential, opts RunAsOptions) error {
+	if cmd.Env == nil {
+		cmd.Env = []string{
+			"HOME=" + u.HomeDir,
+			"USER=" + u.Username,
+			"LOGNAME=" + u.Username,
+			"PATH=/usr/local/bin:/usr/bin:/bin",
+		}
+	}
+	if err := tx.ApplyEnv(cmd); err != nil {
+		return err
+	}
+	if cmd.Dir == "" {
+		cmd.Dir = u.HomeDir
+	}
+	// Unprivileged processes can only run commands as themselves, and
+	// can't set their groups.
+	if !opts.KeepCredentials && int(cred.Uid) != os.Getuid() {
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.Credential = cred
+	}
+
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		cmd.Process.Kill()
+		<-done
+		return ctx.Err()
+	}
+}
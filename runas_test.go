@@ -0,0 +1,57 @@
+package pam
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os/exec"
+	"os/user"
+	"testing"
+	"time"
+)
+
+func runAsStart(t *testing.T) *Transaction {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	tx, err := StartConfDir("login-service", u.Username, Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	t.Cleanup(func() { tx.Close() })
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	return tx
+}
+
+func TestRunAsUser(t *testing.T) {
+	tx := runAsStart(t)
+	if err := tx.PutEnv("RUNAS=session"); err != nil {
+		t.Fatalf("putenv #error: %v", err)
+	}
+	u, _ := user.Current()
+	var out bytes.Buffer
+	cmd := exec.Command("/bin/sh", "-c", `echo "$USER $RUNAS $PWD"; exit 3`)
+	cmd.Stdout = &out
+	err := RunAsUser(context.Background(), tx, cmd, RunAsOptions{})
+	var exit *exec.ExitError
+	if !errors.As(err, &exit) || exit.ExitCode() != 3 {
+		t.Fatalf("runasuser #error: expected exit status 3, got %v", err)
+	}
+	if expected := u.Username + " session " + u.HomeDir + "\n"; out.String() != expected {
+		t.Fatalf("runasuser #error: expected %q, got %q", expected, out.String())
+	}
+}
+
+func TestRunAsUser_Context(t *testing.T) {
+	tx := runAsStart(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	cmd := exec.Command("/bin/sh", "-c", "sleep 10")
+	err := RunAsUser(ctx, tx, cmd, RunAsOptions{})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("runasuser #error: expected %v, got %v", context.DeadlineExceeded, err)
+	}
+}
@@ -0,0 +1,74 @@
+//go:build cgo
+
+package pam
+
+//#define _DEFAULT_SOURCE
+//#include <stdlib.h>
+//#include <string.h>
+//#include <sys/mman.h>
+//
+//static void *secure_map(size_t n)
+//{
+//	void *p = mmap(NULL, n, PROT_READ | PROT_WRITE,
+//		       MAP_PRIVATE | MAP_ANONYMOUS, -1, 0);
+//	if (p == MAP_FAILED)
+//		return NULL;
+//#ifdef MADV_DONTDUMP
+//	madvise(p, n, MADV_DONTDUMP);
+//#endif
+//	return p;
+//}
+import "C"
+
+import (
+	"os"
+	"unsafe"
+)
+
+// freeSecret wipes the C string at p before freeing it, so that secrets such
+// as the authentication tokens don't linger in freed memory.
+func freeSecret(p *C.char) {
+	s := unsafe.Slice((*byte)(unsafe.Pointer(p)), C.strlen(p))
+	clear(s)
+	checkWiped(s)
+	cFree(unsafe.Pointer(p))
+}
+
+// freeSecretBytes wipes the n bytes at p before freeing them, for secrets
+// that may not be NUL terminated, such as the binary responses.
+func freeSecretBytes(p unsafe.Pointer, n int) {
+	s := unsafe.Slice((*byte)(p), n)
+	clear(s)
+	checkWiped(s)
+	cFree(p)
+}
+
+// secureAlloc allocates n zeroed bytes locked in memory, for the secure
+// buffers. Each buffer has pages of its own, which no other allocation
+// shares, so that they can be locked and unlocked independently, and which
+// are left out of the core dumps where supported.
+func secureAlloc(n int) (unsafe.Pointer, error) {
+	size := securePages(n)
+	p, err := C.secure_map(size)
+	if p == nil {
+		return nil, err
+	}
+	if r, err := C.mlock(p, size); r != 0 {
+		C.munmap(p, size)
+		return nil, err
+	}
+	return p, nil
+}
+
+// secureFree wipes and unmaps the n bytes at p allocated by secureAlloc,
+// which also unlocks them.
+func secureFree(p unsafe.Pointer, n int) {
+	clear(unsafe.Slice((*byte)(p), n))
+	C.munmap(p, securePages(n))
+}
+
+// securePages returns the size of the pages holding n bytes.
+func securePages(n int) C.size_t {
+	page := os.Getpagesize()
+	return C.size_t((max(n, 1) + page - 1) / page * page)
+}
@@ -0,0 +1,19 @@
+//go:build pam_debugsecrets
+
+package pam
+
+import "sync/atomic"
+
+// wipedSecrets counts the secrets wiped by freeSecret, so that tests can
+// check that the secrets they pass are not freed without being wiped.
+var wipedSecrets atomic.Int64
+
+// checkWiped panics if the secret has not been wiped.
+func checkWiped(s []byte) {
+	for _, b := range s {
+		if b != 0 {
+			panic("pam: secret freed without being wiped")
+		}
+	}
+	wipedSecrets.Add(1)
+}
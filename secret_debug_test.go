@@ -0,0 +1,31 @@
+//go:build pam_debugsecrets
+
+package pam
+
+import (
+	"os/user"
+	"testing"
+)
+
+func TestSecretsWiped(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	tx, err := StartConfDir("permit-service", u.Username, Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	// Linux-PAM refuses the tokens from applications, but they must be
+	// wiped anyway.
+	for _, i := range []Item{Tty, Authtok, Oldauthtok} {
+		wiped := wipedSecrets.Load()
+		err = tx.SetItem(i, "secret")
+		if i == Tty && err != nil {
+			t.Fatalf("setitem #error: %v", err)
+		}
+		if wipedSecrets.Load() != wiped+1 {
+			t.Fatalf("setitem #error: item %v not wiped", i)
+		}
+	}
+}
@@ -0,0 +1,6 @@
+//go:build !pam_debugsecrets
+
+package pam
+
+// checkWiped is only implemented in builds with the pam_debugsecrets tag.
+func checkWiped(s []byte) {}
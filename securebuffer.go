@@ -0,0 +1,158 @@
+package pam
+
+import (
+	"errors"
+	"log/slog"
+	"runtime"
+	"unsafe"
+)
+
+// SecureBuffer holds a secret, such as a password, in memory that is not
+// managed by the Go runtime: it is never moved or copied by the garbage
+// collector, it is locked so that it is not swapped out, and it is wiped
+// when destroyed. It is always followed by a NUL byte, so that it can be
+// passed to PAM without copies. A BytesConversationHandler can answer the
+// prompts with the Bytes of a buffer, which are copied straight to the C
+// memory of the response.
+//
+// Buffers should be explicitly destroyed once not needed; those that are
+// garbage collected are destroyed too, but the secret may stay in memory
+// until then.
+type SecureBuffer struct {
+	mem     *secureMemory
+	cleanup runtime.Cleanup
+}
+
+// secureMemory is the memory of a SecureBuffer, kept apart so that the
+// cleanup releasing it does not reference the buffer.
+type secureMemory struct {
+	p unsafe.Pointer
+	n int
+}
+
+func (m *secureMemory) release() {
+	if m.p == nil {
+		return
+	}
+	secureFree(m.p, m.n+1)
+	m.p = nil
+}
+
+// NewSecureBuffer returns a zeroed buffer of the given size. It fails if the
+// memory cannot be locked, for example because of RLIMIT_MEMLOCK.
+func NewSecureBuffer(size int) (*SecureBuffer, error) {
+	if size < 0 {
+		return nil, errors.New("negative SecureBuffer size")
+	}
+	p, err := secureAlloc(size + 1)
+	if err != nil {
+		return nil, err
+	}
+	m := &secureMemory{p, size}
+	b := &SecureBuffer{mem: m}
+	b.cleanup = runtime.AddCleanup(b, (*secureMemory).release, m)
+	return b, nil
+}
+
+// NewSecureBufferFrom returns a buffer holding a copy of data, which is then
+// wiped.
+func NewSecureBufferFrom(data []byte) (*SecureBuffer, error) {
+	defer clear(data)
+	b, err := NewSecureBuffer(len(data))
+	if err != nil {
+		return nil, err
+	}
+	copy(b.Bytes(), data)
+	return b, nil
+}
+
+// Bytes returns the content of the buffer, which can be modified. The slice
+// is only valid until the buffer is destroyed, and nil after that.
+func (b *SecureBuffer) Bytes() []byte {
+	if b.mem.p == nil {
+		return nil
+	}
+	return unsafe.Slice((*byte)(b.mem.p), b.mem.n)
+}
+
+// Len returns the size of the buffer.
+func (b *SecureBuffer) Len() int {
+	if b.mem.p == nil {
+		return 0
+	}
+	return b.mem.n
+}
+
+// Destroy wipes and releases the buffer. Destroying a buffer again has no
+// effect.
+func (b *SecureBuffer) Destroy() {
+	b.cleanup.Stop()
+	b.mem.release()
+}
+
+// String returns a placeholder, never the content of the buffer, so that
+// it can't be printed or logged by mistake.
+func (b *SecureBuffer) String() string {
+	return "[redacted]"
+}
+
+// GoString returns a placeholder, as String does, for the %#v verb.
+func (b *SecureBuffer) GoString() string {
+	return "pam.SecureBuffer{[redacted]}"
+}
+
+// LogValue returns a placeholder, as String does, for log/slog.
+func (b *SecureBuffer) LogValue() slog.Value {
+	return slog.StringValue(b.String())
+}
+
+// SecretHandler is a BytesConversationHandler answering the prompts with the
+// echo off with the content of Secret, copied straight to the C memory of
+// the responses without going through Go strings, and the other messages
+// with Handler.
+type SecretHandler struct {
+	// Handler handles the messages other than PromptEchoOff. If nil,
+	// the prompts with the echo on fail and the other messages are
+	// ignored.
+	Handler ConversationHandler
+	// Secret is the response to the prompts with the echo off, such as
+	// the password of the user.
+	Secret *SecureBuffer
+}
+
+// errSecretDestroyed is the failure of the prompts answered by a
+// SecretHandler whose secret has been destroyed, and of SetItemSecure.
+var errSecretDestroyed = errors.New("secret destroyed")
+
+// RespondPAMBytes responds to the prompts with the echo off with the
+// secret, and passes the other messages to the handler.
+func (h SecretHandler) RespondPAMBytes(s Style, msg []byte) ([]byte, error) {
+	if s == PromptEchoOff {
+		if h.Secret == nil || h.Secret.mem.p == nil {
+			return nil, errSecretDestroyed
+		}
+		return h.Secret.Bytes(), nil
+	}
+	r, err := h.respond(s, string(msg))
+	return []byte(r), err
+}
+
+// RespondPAM is RespondPAMBytes for the callers needing strings, which copy
+// the secret to Go memory.
+func (h SecretHandler) RespondPAM(s Style, msg string) (string, error) {
+	if s == PromptEchoOff {
+		r, err := h.RespondPAMBytes(s, nil)
+		return string(r), err
+	}
+	return h.respond(s, msg)
+}
+
+func (h SecretHandler) respond(s Style, msg string) (string, error) {
+	if h.Handler != nil {
+		return h.Handler.RespondPAM(s, msg)
+	}
+	if s == PromptEchoOn {
+		return "", errors.New("unexpected prompt with the echo on")
+	}
+	return "", nil
+}
@@ -0,0 +1,150 @@
+package pam
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/user"
+	"strings"
+	"testing"
+)
+
+func TestSecureBuffer(t *testing.T) {
+	data := []byte("secret")
+	b, err := NewSecureBufferFrom(data)
+	if err != nil {
+		t.Fatalf("newsecurebuffer #error: %v", err)
+	}
+	if !bytes.Equal(data, make([]byte, len(data))) {
+		t.Fatalf("newsecurebuffer #error: source not wiped: %q", data)
+	}
+	if b.Len() != 6 || string(b.Bytes()) != "secret" {
+		t.Fatalf("bytes #error: unexpected content %q", b.Bytes())
+	}
+	b.Destroy()
+	if b.Len() != 0 || b.Bytes() != nil {
+		t.Fatalf("destroy #error: buffer not released")
+	}
+	b.Destroy()
+
+	if _, err := NewSecureBuffer(-1); err == nil {
+		t.Fatalf("newsecurebuffer #expected an error")
+	}
+}
+
+func TestSecureBuffer_Pages(t *testing.T) {
+	page := uintptr(os.Getpagesize())
+	var buffers []*SecureBuffer
+	for _, size := range []int{0, 1, 16, int(page) - 1, int(page)} {
+		b, err := NewSecureBuffer(size)
+		if err != nil {
+			t.Fatalf("newsecurebuffer #error: %v", err)
+		}
+		defer b.Destroy()
+		if p := uintptr(b.mem.p); p%page != 0 {
+			t.Fatalf("newsecurebuffer #error: buffer of %d bytes at %#x not page aligned", size, p)
+		}
+		buffers = append(buffers, b)
+	}
+	if buffers[0].mem.p == buffers[1].mem.p {
+		t.Fatalf("newsecurebuffer #error: buffers sharing a page")
+	}
+}
+
+func TestSecureBuffer_Item(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	tx, err := StartConfDir("permit-service", u.Username, Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	b, err := NewSecureBufferFrom([]byte("tty1"))
+	if err != nil {
+		t.Fatalf("newsecurebuffer #error: %v", err)
+	}
+	defer b.Destroy()
+	err = tx.SetItemSecure(Tty, b)
+	if err != nil {
+		t.Fatalf("setitemsecure #error: %v", err)
+	}
+	s, err := tx.GetItem(Tty)
+	if err != nil || s != "tty1" {
+		t.Fatalf("getitem #error: expected tty1, got %q, %v", s, err)
+	}
+	r, err := tx.GetItemSecure(Tty)
+	if err != nil {
+		t.Fatalf("getitemsecure #error: %v", err)
+	}
+	defer r.Destroy()
+	if string(r.Bytes()) != "tty1" {
+		t.Fatalf("getitemsecure #error: expected tty1, got %q", r.Bytes())
+	}
+	r, err = tx.GetItemSecure(Rhost)
+	if err != nil || r.Len() != 0 {
+		t.Fatalf("getitemsecure #error: expected an empty item, got %q, %v", r.Bytes(), err)
+	}
+	r.Destroy()
+
+	if err := tx.SetItemSecure(Tty, nil); !errors.Is(err, errSecretDestroyed) {
+		t.Fatalf("setitemsecure #error: expected errSecretDestroyed, got %v", err)
+	}
+	if err := tx.SetItemSecure(Tty, r); !errors.Is(err, errSecretDestroyed) {
+		t.Fatalf("setitemsecure #error: expected errSecretDestroyed, got %v", err)
+	}
+	if s, _ := tx.GetItem(Tty); s != "tty1" {
+		t.Fatalf("getitem #error: expected tty1, got %q", s)
+	}
+}
+
+func TestSecureBuffer_Redacted(t *testing.T) {
+	b, err := NewSecureBufferFrom([]byte("secret"))
+	if err != nil {
+		t.Fatalf("newsecurebuffer #error: %v", err)
+	}
+	defer b.Destroy()
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "%v %s %#v %q %x %+v", b, b, b, b, b, struct{ B *SecureBuffer }{b})
+	slog.New(slog.NewTextHandler(&out, nil)).Info("login", "password", b)
+	if strings.Contains(out.String(), "secret") || strings.Contains(out.String(), "736563726574") {
+		t.Fatalf("format #error: secret leaked in %q", out.String())
+	}
+}
+
+func TestSecretHandler(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	b, err := NewSecureBufferFrom([]byte("secret"))
+	if err != nil {
+		t.Fatalf("newsecurebuffer #error: %v", err)
+	}
+	defer b.Destroy()
+	u, _ := user.Current()
+	tx, err := StartConfDir("permit-service", u.Username, SecretHandler{Secret: b}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	r, err := tx.converse([]ConversationMessage{{TextInfo, "Welcome"}, {PromptEchoOff, "Password:"}})
+	if err != nil {
+		t.Fatalf("converse #error: %v", err)
+	}
+	if r[1] != "secret" {
+		t.Fatalf("converse #error: expected secret, got %q", r[1])
+	}
+	if _, err := tx.converse([]ConversationMessage{{PromptEchoOn, "login:"}}); !errors.Is(err, ErrConv) {
+		t.Fatalf("converse #error: expected %v, got %v", ErrConv, err)
+	}
+	b.Destroy()
+	_, err = tx.converse([]ConversationMessage{{PromptEchoOff, "Password:"}})
+	if !errors.Is(err, errSecretDestroyed) {
+		t.Fatalf("converse #error: expected %v, got %v", errSecretDestroyed, err)
+	}
+	if err := tx.SetItemSecure(XAuthData, b); !errors.Is(err, ErrBadItem) {
+		t.Fatalf("setitemsecure #error: expected %v, got %v", ErrBadItem, err)
+	}
+}
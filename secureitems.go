@@ -0,0 +1,76 @@
+//go:build cgo
+
+package pam
+
+//#include <security/pam_appl.h>
+//#include <string.h>
+import "C"
+
+import (
+	"fmt"
+	"unsafe"
+)
+
+// cString returns the buffer as a C string, truncated at the first NUL byte.
+func (b *SecureBuffer) cString() *C.char {
+	return (*C.char)(b.mem.p)
+}
+
+// SetItemSecure sets a PAM information item from a secure buffer, without
+// copying it to Go memory. It is meant for the authentication tokens. It
+// fails if the buffer is nil or has been destroyed, rather than unsetting
+// the item.
+func (t *Transaction) SetItemSecure(i Item, b *SecureBuffer) error {
+	if err, ok := diverted(t.thread, func() error { return t.SetItemSecure(i, b) }); ok {
+		return err
+	}
+	if err := t.state.enter(); err != nil {
+		return err
+	}
+	defer t.state.leave()
+	if err := checkStringItem(i); err != nil {
+		return err
+	}
+	if b == nil || b.mem.p == nil {
+		return fmt.Errorf("%v: %w", i, errSecretDestroyed)
+	}
+	done := t.callHooks(EventItem, "set_item", i)
+	status := done(C.pam_set_item(t.handle, C.int(i), unsafe.Pointer(b.cString())))
+	return t.result(status)
+}
+
+// GetItemSecure retrieves a PAM information item into a secure buffer,
+// without copying it to Go memory. As GetItem, it fails with ErrBadItem for
+// the authentication tokens, which only the modules may read.
+func (t *Transaction) GetItemSecure(i Item) (*SecureBuffer, error) {
+	if r, err, ok := diverted2(t.thread, func() (*SecureBuffer, error) { return t.GetItemSecure(i) }); ok {
+		return r, err
+	}
+	if err := t.state.enter(); err != nil {
+		return nil, err
+	}
+	defer t.state.leave()
+	if err := checkStringItem(i); err != nil {
+		return nil, err
+	}
+	if err := checkReadableItem(i); err != nil {
+		return nil, err
+	}
+	var s unsafe.Pointer
+	done := t.callHooks(EventCall, "get_item", i)
+	if err := t.result(done(C.pam_get_item(t.handle, C.int(i), &s))); err != nil {
+		return nil, err
+	}
+	var n C.size_t
+	if s != nil {
+		n = C.strlen((*C.char)(s))
+	}
+	b, err := NewSecureBuffer(int(n))
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		C.memcpy(b.mem.p, s, n)
+	}
+	return b, nil
+}
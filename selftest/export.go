@@ -0,0 +1,45 @@
+package selftest
+
+import "C"
+
+import (
+	"context"
+	"os"
+	"syscall"
+
+	"github.com/msteinert/pam"
+)
+
+// pam_go_selftest runs the checks, writing their results to fd, which is
+// left open. See the package documentation.
+//
+//export pam_go_selftest
+func pam_go_selftest(fd C.int) C.int {
+	// The results are written to a copy of fd, closed once done.
+	dup, err := syscall.Dup(int(fd))
+	if err != nil {
+		return C.int(pam.ErrSystem)
+	}
+	f := os.NewFile(uintptr(dup), "selftest")
+	defer f.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+	return C.int(Report(f, Run(ctx)))
+}
+
+// pam_go_module_info writes the build information of the module to fd,
+// which is left open. See ModuleInfo.
+//
+//export pam_go_module_info
+func pam_go_module_info(fd C.int) C.int {
+	dup, err := syscall.Dup(int(fd))
+	if err != nil {
+		return C.int(pam.ErrSystem)
+	}
+	f := os.NewFile(uintptr(dup), "info")
+	defer f.Close()
+	if err := WriteInfo(f); err != nil {
+		return C.int(pam.ErrSystem)
+	}
+	return C.int(pam.Success)
+}
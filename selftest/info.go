@@ -0,0 +1,60 @@
+package selftest
+
+import (
+	"encoding/json"
+	"io"
+	"runtime/debug"
+)
+
+// Version is the version of the module, empty unless set when it is built,
+// so that the packages can record it:
+//
+//	go build -buildmode=c-shared \
+//	    -ldflags "-X github.com/msteinert/pam/selftest.Version=1.2.0" \
+//	    -o pam_example.so
+var Version string
+
+// ModuleInfo is the build information of a module, written by
+// pam_go_module_info.
+type ModuleInfo struct {
+	// Version is Version, or the version of the main module if not set,
+	// as for the modules built with go install.
+	Version string `json:"version,omitempty"`
+	// Path is the path of the main package of the module.
+	Path string `json:"path,omitempty"`
+	// GoVersion is the version of the Go toolchain building the module.
+	GoVersion string `json:"go_version,omitempty"`
+	// Revision is the version control revision the module was built
+	// from, if known, and Modified whether it had local changes.
+	Revision string `json:"revision,omitempty"`
+	Modified bool   `json:"modified,omitempty"`
+}
+
+// Info returns the build information of the module.
+func Info() ModuleInfo {
+	info := ModuleInfo{Version: Version}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return info
+	}
+	info.Path = bi.Path
+	info.GoVersion = bi.GoVersion
+	if info.Version == "" && bi.Main.Version != "(devel)" {
+		info.Version = bi.Main.Version
+	}
+	for _, s := range bi.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			info.Revision = s.Value
+		case "vcs.modified":
+			info.Modified = s.Value == "true"
+		}
+	}
+	return info
+}
+
+// WriteInfo writes the build information of the module to w, as a JSON
+// object on a line.
+func WriteInfo(w io.Writer) error {
+	return json.NewEncoder(w).Encode(Info())
+}
@@ -0,0 +1,118 @@
+// Package selftest lets the deployments of the modules written in Go check
+// their configuration, such as whether their keys can be read and their
+// backends reached, without attempting a real login.
+//
+// The modules register their checks, usually from their init functions,
+// and the libraries built with -buildmode=c-shared export them with the
+// pam_go_selftest symbol, run by pam-tester:
+//
+//	pam-tester selftest /usr/lib/security/pam_example.so
+//
+// The symbol has the C signature int pam_go_selftest(int fd): it writes a
+// line per check to fd, holding the JSON encoding of its Result, and returns
+// PAM_SUCCESS if all the checks passed, PAM_SERVICE_ERR if any failed and
+// PAM_IGNORE if there are none.
+//
+// The libraries export their build information too, such as their Version,
+// with the pam_go_module_info symbol, of the same signature, writing the
+// JSON encoding of their ModuleInfo:
+//
+//	pam-tester info /usr/lib/security/pam_example.so
+package selftest
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// DefaultTimeout is the time the checks are given by pam_go_selftest.
+const DefaultTimeout = 30 * time.Second
+
+// HealthChecker is implemented by the module handlers checking their
+// configuration.
+type HealthChecker interface {
+	// HealthCheck returns why the module can't work, if so.
+	HealthCheck(ctx context.Context) error
+}
+
+// HealthCheckFunc is an adapter to allow the use of ordinary functions as
+// health checkers.
+type HealthCheckFunc func(ctx context.Context) error
+
+// HealthCheck calls f.
+func (f HealthCheckFunc) HealthCheck(ctx context.Context) error {
+	return f(ctx)
+}
+
+type check struct {
+	name    string
+	checker HealthChecker
+}
+
+var (
+	mu     sync.Mutex
+	checks []check
+)
+
+// Register adds a check, run with the others in the order of their
+// registration. The name identifies it in the results, such as "ldap".
+func Register(name string, c HealthChecker) {
+	mu.Lock()
+	defer mu.Unlock()
+	checks = append(checks, check{name, c})
+}
+
+// RegisterFunc adds a check function, see Register.
+func RegisterFunc(name string, f func(ctx context.Context) error) {
+	Register(name, HealthCheckFunc(f))
+}
+
+// Result is the result of a check.
+type Result struct {
+	Name     string        `json:"name"`
+	OK       bool          `json:"ok"`
+	Error    string        `json:"error,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// Run runs the checks registered, in order, returning their results.
+func Run(ctx context.Context) []Result {
+	mu.Lock()
+	cs := checks
+	mu.Unlock()
+	results := make([]Result, 0, len(cs))
+	for _, c := range cs {
+		start := time.Now()
+		err := c.checker.HealthCheck(ctx)
+		r := Result{Name: c.name, OK: err == nil, Duration: time.Since(start)}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// Report writes the results to w, one JSON object per line, returning the
+// status of pam_go_selftest.
+func Report(w io.Writer, results []Result) pam.ReturnType {
+	if len(results) == 0 {
+		return pam.ErrIgnore
+	}
+	status := pam.Success
+	enc := json.NewEncoder(w)
+	for _, r := range results {
+		if !r.OK {
+			status = pam.ErrService
+		}
+		if err := enc.Encode(r); err != nil {
+			status = pam.ErrService
+		}
+	}
+	return status
+}
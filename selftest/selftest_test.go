@@ -0,0 +1,53 @@
+package selftest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+func TestRun(t *testing.T) {
+	if status := Report(&bytes.Buffer{}, Run(context.Background())); status != pam.ErrIgnore {
+		t.Fatalf("report #error: expected %v, got %v", pam.ErrIgnore, status)
+	}
+	RegisterFunc("keys", func(context.Context) error { return nil })
+	results := Run(context.Background())
+	var out bytes.Buffer
+	if status := Report(&out, results); status != pam.Success {
+		t.Fatalf("report #error: expected %v, got %v", pam.Success, status)
+	}
+	RegisterFunc("backend", func(context.Context) error { return errors.New("connection refused") })
+	results = Run(context.Background())
+	if len(results) != 2 || !results[0].OK || results[1].OK || results[1].Error != "connection refused" {
+		t.Fatalf("run #error: unexpected results %+v", results)
+	}
+	out.Reset()
+	if status := Report(&out, results); status != pam.ErrService {
+		t.Fatalf("report #error: expected %v, got %v", pam.ErrService, status)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) != 2 || !strings.HasPrefix(lines[1], `{"name":"backend","ok":false,"error":"connection refused"`) {
+		t.Fatalf("report #error: unexpected report %q", out.String())
+	}
+}
+
+func TestInfo(t *testing.T) {
+	Version = "1.2.0"
+	defer func() { Version = "" }()
+	var out bytes.Buffer
+	if err := WriteInfo(&out); err != nil {
+		t.Fatalf("writeinfo #error: %v", err)
+	}
+	var info ModuleInfo
+	if err := json.Unmarshal(out.Bytes(), &info); err != nil {
+		t.Fatalf("json #error: %v", err)
+	}
+	if info.Version != "1.2.0" || info.GoVersion == "" || !strings.HasSuffix(out.String(), "}\n") {
+		t.Fatalf("writeinfo #error: unexpected information %q", out.String())
+	}
+}
@@ -0,0 +1,156 @@
+package pam
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Session is a session opened by Transaction.StartSession, with the
+// credentials established for it. It is closed once, by Close, which the
+// long-running services holding it can defer so that the session is not
+// leaked when they fail, even by panicking.
+//
+// As a Transaction, a Session must not be used by multiple goroutines at
+// the same time, but its refreshes run in the background: the other calls
+// of its transaction go through Do while it is refreshed.
+type Session struct {
+	tx *Transaction
+	f  Flags
+	// mu serializes the calls of the transaction.
+	mu     sync.Mutex
+	closed bool
+	err    error
+	// stop, if not nil, stops the refreshes, and done is closed once
+	// they are stopped.
+	stop chan struct{}
+	done chan struct{}
+	once sync.Once
+}
+
+// StartSession establishes the credentials of the user and opens a session,
+// then reinitializes the credentials, as some modules set them per session.
+// Only Silent is kept of the flags. Once it fails, the credentials it
+// established are deleted.
+func (t *Transaction) StartSession(f Flags) (*Session, error) {
+	return t.startSession(f, func(_ RunStep, err error) error { return err })
+}
+
+// startSession is StartSession calling after with the result of each step,
+// the reinitialization of the credentials being part of StepOpenSession.
+// after returns the error failing the step, which is then undone.
+func (t *Transaction) startSession(f Flags, after func(RunStep, error) error) (*Session, error) {
+	f &= Silent
+	if err := t.SetCred(f | EstablishCred); err != nil {
+		return nil, after(StepSetCred, err)
+	}
+	if err := after(StepSetCred, nil); err != nil {
+		return nil, errors.Join(err, t.SetCred(f|DeleteCred))
+	}
+	if err := t.OpenSession(f); err != nil {
+		return nil, errors.Join(after(StepOpenSession, err), t.SetCred(f|DeleteCred))
+	}
+	s := &Session{tx: t, f: f}
+	if err := after(StepOpenSession, t.SetCred(f|ReinitializeCred)); err != nil {
+		return nil, errors.Join(err, s.Close())
+	}
+	return s, nil
+}
+
+// Do calls f with the transaction of the session, once no refresh is
+// running, failing with ErrTransactionEnded once the session is closed.
+func (s *Session) Do(f func(tx *Transaction) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrTransactionEnded
+	}
+	return f(s.tx)
+}
+
+// Refresh refreshes the credentials of the session every interval in the
+// background, for the modules whose credentials expire, such as the
+// Kerberos tickets, until the session is closed. It replaces the interval
+// of the previous call, and stops the refreshes if not positive. The
+// refreshes failing are reported by Err, and keep being attempted.
+func (s *Session) Refresh(interval time.Duration) {
+	s.stopRefresh()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed || interval <= 0 {
+		return
+	}
+	stop, done := make(chan struct{}), make(chan struct{})
+	s.stop, s.done = stop, done
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if !s.refresh() {
+					return
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// refresh refreshes the credentials, returning whether to carry on. The
+// panics stop the refreshes, rather than the process before the session is
+// closed.
+func (s *Session) refresh() (ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	defer func() {
+		if p := recover(); p != nil {
+			s.err, ok = fmt.Errorf("refresh panicked: %v", p), false
+		}
+	}()
+	if s.closed {
+		return false
+	}
+	s.err = s.tx.SetCred(s.f | RefreshCred)
+	return true
+}
+
+// stopRefresh stops the refreshes, if any, waiting for the running one.
+func (s *Session) stopRefresh() {
+	s.mu.Lock()
+	stop, done := s.stop, s.done
+	s.stop, s.done = nil, nil
+	s.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+}
+
+// Err returns the error of the last refresh, nil if it succeeded.
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close stops the refreshes, closes the session and deletes the
+// credentials, even if closing the session fails or panics, and joins their
+// errors. Only the first call closes the session, the others return nil.
+// The transaction is left open.
+func (s *Session) Close() (err error) {
+	s.once.Do(func() {
+		s.stopRefresh()
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.closed = true
+		defer func() {
+			err = errors.Join(err, s.tx.SetCred(s.f|DeleteCred))
+		}()
+		err = s.tx.CloseSession(s.f)
+	})
+	return err
+}
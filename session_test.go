@@ -0,0 +1,113 @@
+package pam
+
+import (
+	"errors"
+	"fmt"
+	"os/user"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestSession(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	var mu sync.Mutex
+	var ops []string
+	panicking := ""
+	tx, err := StartWithOptions("login-service", WithUser(u.Username),
+		WithConfDir("test-services"),
+		WithObserver(ObserverFunc(func(e Event) {
+			if e.Kind != EventOperation {
+				return
+			}
+			op := fmt.Sprintf("%s %v", e.Operation, e.Flags)
+			mu.Lock()
+			ops = append(ops, op)
+			p := panicking == op
+			mu.Unlock()
+			if p {
+				panic(op)
+			}
+		})))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	count := func(op string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		n := 0
+		for _, o := range ops {
+			if o == op {
+				n++
+			}
+		}
+		return n
+	}
+
+	s, err := tx.StartSession(Silent | DisallowNullAuthtok)
+	if err != nil {
+		t.Fatalf("startsession #error: %v", err)
+	}
+	s.Refresh(10 * time.Millisecond)
+	for deadline := time.Now().Add(5 * time.Second); count("setcred Silent|RefreshCred") < 2; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("refresh #error: expected the credentials to be refreshed")
+		}
+	}
+	if err := s.Err(); err != nil {
+		t.Fatalf("refresh #error: %v", err)
+	}
+	if err := s.Do(func(tx *Transaction) error {
+		return tx.PutEnv("SESSION=1")
+	}); err != nil {
+		t.Fatalf("do #error: %v", err)
+	}
+
+	mu.Lock()
+	panicking = "setcred Silent|RefreshCred"
+	mu.Unlock()
+	for deadline := time.Now().Add(5 * time.Second); s.Err() == nil; time.Sleep(5 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("refresh #error: expected the panic to be reported")
+		}
+	}
+	if err := s.Err(); !strings.Contains(err.Error(), "panicked") {
+		t.Fatalf("refresh #error: unexpected error %v", err)
+	}
+
+	mu.Lock()
+	panicking = "close_session Silent"
+	mu.Unlock()
+	func() {
+		defer func() {
+			if p := recover(); p == nil {
+				t.Fatalf("close #error: expected the panic of the observer")
+			}
+		}()
+		s.Close()
+	}()
+	if err := s.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+	if n := count("close_session Silent"); n != 1 {
+		t.Fatalf("close #error: expected the session to be closed once, got %d", n)
+	}
+	if n := count("setcred Silent|DeleteCred"); n != 1 {
+		t.Fatalf("close #error: expected the credentials to be deleted once, got %d", n)
+	}
+	if err := s.Do(func(*Transaction) error { return nil }); !errors.Is(err, ErrTransactionEnded) {
+		t.Fatalf("do #error: expected %v, got %v", ErrTransactionEnded, err)
+	}
+	mu.Lock()
+	expected := []string{"setcred Silent|EstablishCred", "open_session Silent", "setcred Silent|ReinitializeCred"}
+	if !slices.Equal(ops[:3], expected) {
+		t.Fatalf("startsession #error: expected %v, got %v", expected, ops[:3])
+	}
+	mu.Unlock()
+}
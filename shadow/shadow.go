@@ -0,0 +1,277 @@
+// Package shadow reads the user databases of the shadow suite, /etc/passwd
+// and /etc/shadow, into typed entries, and evaluates the password aging of
+// the users as pam_unix does, for the account and authentication modules
+// written in Go.
+//
+// Only the files are read, not the other sources of the name service
+// switch. Reading /etc/shadow requires privileges: its lookups then fail
+// with an error matching fs.ErrPermission, which modules usually report as
+// pam.ErrAuthinfoUnavail.
+package shadow
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// The database files.
+const (
+	PasswdFile = "/etc/passwd"
+	ShadowFile = "/etc/shadow"
+)
+
+// maxLine is the maximum length of the lines of the databases.
+const maxLine = 64 * 1024
+
+// Passwd is an entry of /etc/passwd.
+type Passwd struct {
+	Name string
+	// Password is "x" when the password is in /etc/shadow.
+	Password string
+	UID      uint32
+	GID      uint32
+	Gecos    string
+	Home     string
+	Shell    string
+}
+
+// Shadow is an entry of /etc/shadow. Its dates are days since the epoch,
+// and the fields left empty in the file are -1.
+type Shadow struct {
+	Name string
+	// Password is the crypt(3) hash of the password, which can be
+	// checked with the crypt package.
+	Password string
+	// LastChange is the date of the last password change. 0 requires the
+	// user to change the password at the next login.
+	LastChange int
+	// Min and Max are the minimum and maximum ages of the password, in
+	// days.
+	Min int
+	Max int
+	// Warn is the number of days before the password expires when the
+	// user is warned.
+	Warn int
+	// Inactive is the number of days after the password expires when it
+	// is still accepted, to change it.
+	Inactive int
+	// Expire is the date of the expiration of the account.
+	Expire int
+}
+
+// ParsePasswd parses a line of /etc/passwd.
+func ParsePasswd(line string) (Passwd, error) {
+	f := strings.Split(line, ":")
+	if len(f) != 7 {
+		return Passwd{}, errors.New("shadow: invalid passwd entry")
+	}
+	uid, err := strconv.ParseUint(f[2], 10, 32)
+	if err != nil {
+		return Passwd{}, fmt.Errorf("shadow: invalid UID of %q", f[0])
+	}
+	gid, err := strconv.ParseUint(f[3], 10, 32)
+	if err != nil {
+		return Passwd{}, fmt.Errorf("shadow: invalid GID of %q", f[0])
+	}
+	return Passwd{
+		Name:     f[0],
+		Password: f[1],
+		UID:      uint32(uid),
+		GID:      uint32(gid),
+		Gecos:    f[4],
+		Home:     f[5],
+		Shell:    f[6],
+	}, nil
+}
+
+// ParseShadow parses a line of /etc/shadow. Its errors never include the
+// password.
+func ParseShadow(line string) (Shadow, error) {
+	f := strings.Split(line, ":")
+	if len(f) != 9 {
+		return Shadow{}, errors.New("shadow: invalid shadow entry")
+	}
+	s := Shadow{Name: f[0], Password: f[1]}
+	for i, v := range []*int{&s.LastChange, &s.Min, &s.Max, &s.Warn, &s.Inactive, &s.Expire} {
+		field := f[2+i]
+		if field == "" {
+			*v = -1
+			continue
+		}
+		n, err := strconv.Atoi(field)
+		if err != nil || n < -1 {
+			return Shadow{}, fmt.Errorf("shadow: invalid field %d of %q", 3+i, f[0])
+		}
+		*v = n
+	}
+	return s, nil
+}
+
+// scan calls f with each entry line of r, skipping the comments and the
+// compat entries of the name service switch, until it returns false.
+func scan(r io.Reader, f func(line string) (bool, error)) error {
+	s := bufio.NewScanner(r)
+	s.Buffer(nil, maxLine)
+	for s.Scan() {
+		line := s.Text()
+		if line == "" || line[0] == '#' || line[0] == '+' || line[0] == '-' {
+			continue
+		}
+		if more, err := f(line); err != nil || !more {
+			return err
+		}
+	}
+	return s.Err()
+}
+
+// ReadPasswd reads the entries of a file in the format of /etc/passwd.
+func ReadPasswd(r io.Reader) ([]Passwd, error) {
+	var entries []Passwd
+	err := scan(r, func(line string) (bool, error) {
+		e, err := ParsePasswd(line)
+		entries = append(entries, e)
+		return true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// ReadShadow reads the entries of a file in the format of /etc/shadow.
+func ReadShadow(r io.Reader) ([]Shadow, error) {
+	var entries []Shadow
+	err := scan(r, func(line string) (bool, error) {
+		e, err := ParseShadow(line)
+		entries = append(entries, e)
+		return true, err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// lookup returns the entry of user in the file, failing with
+// pam.ErrUserUnknown if there is none. Only the entry of the user is
+// parsed, so that the malformed entries of others don't matter.
+func lookup[E any](path, user string, parse func(string) (E, error)) (E, error) {
+	var entry E
+	if user == "" || strings.ContainsAny(user, ":\n") {
+		return entry, fmt.Errorf("%w: invalid user name %q", pam.ErrUserUnknown, user)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return entry, err
+	}
+	defer f.Close()
+	found := false
+	err = scan(f, func(line string) (bool, error) {
+		if !strings.HasPrefix(line, user+":") {
+			return true, nil
+		}
+		found = true
+		entry, err = parse(line)
+		return false, err
+	})
+	if err != nil {
+		return entry, err
+	}
+	if !found {
+		return entry, fmt.Errorf("%w: %q", pam.ErrUserUnknown, user)
+	}
+	return entry, nil
+}
+
+// LookupPasswd returns the entry of user in /etc/passwd.
+func LookupPasswd(user string) (Passwd, error) {
+	return lookup(PasswdFile, user, ParsePasswd)
+}
+
+// LookupShadow returns the entry of user in /etc/shadow.
+func LookupShadow(user string) (Shadow, error) {
+	return lookup(ShadowFile, user, ParseShadow)
+}
+
+// Day returns the day since the epoch of t, as used by the dates of the
+// entries.
+func Day(t time.Time) int {
+	return int(t.Unix() / (24 * 60 * 60))
+}
+
+// Aging is the state of the password aging of a user.
+type Aging struct {
+	// Warn is whether the password expires soon, in DaysLeft days.
+	Warn     bool
+	DaysLeft int
+	// Enforced is whether the administrator requires the password to be
+	// changed, rather than it having expired.
+	Enforced bool
+	// TooRecent is whether the password was changed too recently to be
+	// changed again.
+	TooRecent bool
+}
+
+// Check evaluates the aging of the entry at the given time, as the account
+// management of pam_unix does: it fails with pam.ErrAcctExpired if the
+// account expired, pam.ErrNewAuthtokReqd if the password must be changed
+// and pam.ErrAuthtokExpired if it expired for too long to be changed.
+func (s Shadow) Check(now time.Time) (Aging, error) {
+	var a Aging
+	day := Day(now)
+	if s.Expire >= 0 && day >= s.Expire {
+		return a, pam.ErrAcctExpired
+	}
+	if s.LastChange == 0 {
+		a.Enforced = true
+		return a, pam.ErrNewAuthtokReqd
+	}
+	if s.LastChange < 0 || day < s.LastChange {
+		// Aging is disabled, or the password was changed in the
+		// future, as the clock changed.
+		return a, nil
+	}
+	passed := day - s.LastChange
+	if s.Max >= 0 {
+		if s.Inactive >= 0 && passed >= s.Max+s.Inactive {
+			return a, pam.ErrAuthtokExpired
+		}
+		if passed >= s.Max {
+			return a, pam.ErrNewAuthtokReqd
+		}
+		if s.Warn > 0 && s.Warn <= s.Max && passed >= s.Max-s.Warn {
+			a.Warn, a.DaysLeft = true, s.Max-passed
+		}
+	}
+	a.TooRecent = s.Min >= 0 && passed < s.Min
+	return a, nil
+}
+
+// Message returns the message telling the user about the aging and the
+// error of Check, as sent by pam_unix, or an empty string if there is
+// nothing to tell.
+func (a Aging) Message(err error) string {
+	switch {
+	case errors.Is(err, pam.ErrAcctExpired):
+		return "Your account has expired; please contact your system administrator."
+	case errors.Is(err, pam.ErrAuthtokExpired):
+		return "Your password has expired; please contact your system administrator."
+	case errors.Is(err, pam.ErrNewAuthtokReqd) && a.Enforced:
+		return "You are required to change your password immediately (administrator enforced)."
+	case errors.Is(err, pam.ErrNewAuthtokReqd):
+		return "You are required to change your password immediately (password expired)."
+	case err == nil && a.Warn && a.DaysLeft == 1:
+		return "Warning: your password will expire in 1 day."
+	case err == nil && a.Warn:
+		return fmt.Sprintf("Warning: your password will expire in %d days.", a.DaysLeft)
+	}
+	return ""
+}
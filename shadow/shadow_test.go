@@ -0,0 +1,110 @@
+package shadow
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+func TestReadPasswd(t *testing.T) {
+	entries, err := ReadPasswd(strings.NewReader(`# comment
+root:x:0:0:root:/root:/bin/bash
++nis
+
+test:x:1000:1000:Test User,,,:/home/test:/bin/sh
+`))
+	if err != nil {
+		t.Fatalf("read #error: %v", err)
+	}
+	expected := Passwd{"test", "x", 1000, 1000, "Test User,,,", "/home/test", "/bin/sh"}
+	if len(entries) != 2 || entries[1] != expected {
+		t.Fatalf("read #error: unexpected entries %+v", entries)
+	}
+	if _, err := ReadPasswd(strings.NewReader("test:x:a:0:::\n")); err == nil {
+		t.Fatalf("read #error: expected an invalid UID")
+	}
+}
+
+func TestReadShadow(t *testing.T) {
+	entries, err := ReadShadow(strings.NewReader(`root:*:19000:0:99999:7:::
+test:$6$salt$hash:19500::90:7:30:20000:
+`))
+	if err != nil {
+		t.Fatalf("read #error: %v", err)
+	}
+	expected := Shadow{"test", "$6$salt$hash", 19500, -1, 90, 7, 30, 20000}
+	if len(entries) != 2 || entries[1] != expected {
+		t.Fatalf("read #error: unexpected entries %+v", entries)
+	}
+	_, err = ReadShadow(strings.NewReader("test:$6$secret:x:0:0:0:::\n"))
+	if err == nil || strings.Contains(err.Error(), "secret") {
+		t.Fatalf("read #error: expected an error without the password, got %v", err)
+	}
+}
+
+func TestLookup(t *testing.T) {
+	p, err := LookupPasswd("root")
+	if err != nil || p.UID != 0 {
+		t.Fatalf("lookup #error: %+v, %v", p, err)
+	}
+	if _, err := LookupPasswd("nonexistent-user"); !errors.Is(err, pam.ErrUserUnknown) {
+		t.Fatalf("lookup #error: expected ErrUserUnknown, got %v", err)
+	}
+	if _, err := LookupPasswd("root:x"); !errors.Is(err, pam.ErrUserUnknown) {
+		t.Fatalf("lookup #error: expected ErrUserUnknown, got %v", err)
+	}
+	s, err := LookupShadow("root")
+	if os.Getuid() != 0 {
+		if !errors.Is(err, fs.ErrPermission) {
+			t.Fatalf("lookup #error: expected ErrPermission, got %v", err)
+		}
+		return
+	}
+	if err != nil || s.Name != "root" {
+		t.Fatalf("lookup #error: %+v, %v", s, err)
+	}
+}
+
+func TestShadow_Check(t *testing.T) {
+	now := time.Unix(int64(20000*24*60*60+3600), 0)
+	tests := []struct {
+		name    string
+		entry   Shadow
+		aging   Aging
+		err     error
+		message string
+	}{
+		{"no aging", Shadow{LastChange: -1, Min: -1, Max: -1, Warn: -1, Inactive: -1, Expire: -1},
+			Aging{}, nil, ""},
+		{"account expired", Shadow{LastChange: 19990, Min: -1, Max: -1, Warn: -1, Inactive: -1, Expire: 20000},
+			Aging{}, pam.ErrAcctExpired, "Your account has expired; please contact your system administrator."},
+		{"enforced", Shadow{LastChange: 0, Min: -1, Max: -1, Warn: -1, Inactive: -1, Expire: -1},
+			Aging{Enforced: true}, pam.ErrNewAuthtokReqd, "You are required to change your password immediately (administrator enforced)."},
+		{"expired", Shadow{LastChange: 19900, Min: 0, Max: 90, Warn: 7, Inactive: 30, Expire: -1},
+			Aging{}, pam.ErrNewAuthtokReqd, "You are required to change your password immediately (password expired)."},
+		{"inactive", Shadow{LastChange: 19800, Min: 0, Max: 90, Warn: 7, Inactive: 30, Expire: -1},
+			Aging{}, pam.ErrAuthtokExpired, "Your password has expired; please contact your system administrator."},
+		{"warning", Shadow{LastChange: 19915, Min: 0, Max: 90, Warn: 7, Inactive: -1, Expire: -1},
+			Aging{Warn: true, DaysLeft: 5}, nil, "Warning: your password will expire in 5 days."},
+		{"too recent", Shadow{LastChange: 19999, Min: 2, Max: 90, Warn: 7, Inactive: -1, Expire: -1},
+			Aging{TooRecent: true}, nil, ""},
+		{"future", Shadow{LastChange: 20001, Min: 2, Max: 0, Warn: -1, Inactive: -1, Expire: -1},
+			Aging{}, nil, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			aging, err := tt.entry.Check(now)
+			if !errors.Is(err, tt.err) || (tt.err == nil && err != nil) || aging != tt.aging {
+				t.Fatalf("check #error: expected %+v, %v, got %+v, %v", tt.aging, tt.err, aging, err)
+			}
+			if msg := aging.Message(err); msg != tt.message {
+				t.Fatalf("message #error: expected %q, got %q", tt.message, msg)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package sharedstate
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+// DefaultDir is the default directory of a FileStore, cleared on boot.
+const DefaultDir = "/run/go-pam-state"
+
+// FileStore is a Store keeping each value in a file of its directory,
+// locked while it is read or updated. The files of the deleted values are
+// emptied rather than removed, the directory being meant to be cleared on
+// boot. The zero value uses DefaultDir.
+type FileStore struct {
+	// Dir is the directory of the files, DefaultDir if empty. It is
+	// created if needed, readable by its owner only.
+	Dir string
+	// Now returns the current time, time.Now if not set.
+	Now func() time.Time
+}
+
+func (s *FileStore) now() time.Time {
+	if s.Now != nil {
+		return s.Now()
+	}
+	return time.Now()
+}
+
+func (s *FileStore) dir() string {
+	if s.Dir == "" {
+		return DefaultDir
+	}
+	return s.Dir
+}
+
+// path returns the file of key, named after its hash so that any key can
+// be used.
+func (s *FileStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir(), hex.EncodeToString(sum[:]))
+}
+
+// read reads the entry of a locked file, nil if empty.
+func read(file *os.File, key string) (*entry, error) {
+	data, err := io.ReadAll(file)
+	if err != nil || len(data) == 0 {
+		return nil, err
+	}
+	var e entry
+	if err := json.Unmarshal(data, &e); err != nil {
+		return nil, fmt.Errorf("state of %q: %w", key, err)
+	}
+	return &e, nil
+}
+
+// Get returns the value of key.
+func (s *FileStore) Get(ctx context.Context, key string) ([]byte, error) {
+	file, err := os.Open(s.path(key))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_SH); err != nil {
+		return nil, err
+	}
+	// The lock is released when the file is closed.
+	e, err := read(file, key)
+	if err != nil || !e.valid(s.now()) {
+		return nil, err
+	}
+	return e.Value, nil
+}
+
+// Update updates the value of key, with its file locked.
+func (s *FileStore) Update(ctx context.Context, key string, f func([]byte) ([]byte, time.Duration, error)) error {
+	if err := os.MkdirAll(s.dir(), 0700); err != nil {
+		return err
+	}
+	path := s.path(key)
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		return err
+	}
+	// The lock is released when the file is closed.
+	e, err := read(file, key)
+	if err != nil {
+		return err
+	}
+	now := s.now()
+	var cur []byte
+	if e.valid(now) {
+		cur = e.Value
+	}
+	next, ttl, err := f(cur)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		// Emptied rather than removed, as other processes may be
+		// waiting for its lock.
+		return file.Truncate(0)
+	}
+	data, err := json.Marshal(entry{Value: next, Expires: expiry(now, ttl)})
+	if err != nil {
+		return err
+	}
+	if err := file.Truncate(0); err != nil {
+		return err
+	}
+	_, err = file.WriteAt(data, 0)
+	return err
+}
@@ -0,0 +1,153 @@
+// Package sharedstate keeps the state the modules written in Go share
+// between the processes running them, such as sshd, login and sudo: the
+// counters, the nonces and the caches which must be seen by all of them.
+//
+// A Store holds values by key, updated atomically with regard to the other
+// processes. FileStore keeps them in the files of a directory, locked while
+// updated, and Client in the memory of a Server listening on a unix socket,
+// such as a daemon run by the module.
+package sharedstate
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrExists is returned by Claim when the key already has a value.
+var ErrExists = errors.New("key already exists")
+
+// Store holds values by key, shared between processes.
+type Store interface {
+	// Get returns the value of key, nil if it has none or it expired.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Update calls f with the value of key, nil if none, then stores the
+	// value it returns for ttl, or forever if 0, or deletes the key if
+	// it returns nil. Nothing is stored if f fails, and Update returns
+	// its error. The updates of a key are atomic, but f may be called
+	// again if another process updated the key meanwhile, so it must not
+	// have side effects.
+	Update(ctx context.Context, key string, f func(cur []byte) (next []byte, ttl time.Duration, err error)) error
+}
+
+// Increment adds delta to the counter of key, starting from 0, and returns
+// its new value, valid for ttl, or forever if 0, from now on.
+func Increment(ctx context.Context, s Store, key string, delta int64, ttl time.Duration) (int64, error) {
+	var n int64
+	err := s.Update(ctx, key, func(cur []byte) ([]byte, time.Duration, error) {
+		n = 0
+		if cur != nil {
+			var err error
+			if n, err = strconv.ParseInt(string(cur), 10, 64); err != nil {
+				return nil, 0, err
+			}
+		}
+		n += delta
+		return strconv.AppendInt(nil, n, 10), ttl, nil
+	})
+	return n, err
+}
+
+// Claim sets the value of key for ttl, or forever if 0, failing with
+// ErrExists if it already has one, for example to use nonces once.
+func Claim(ctx context.Context, s Store, key string, value []byte, ttl time.Duration) error {
+	if value == nil {
+		value = []byte{}
+	}
+	return s.Update(ctx, key, func(cur []byte) ([]byte, time.Duration, error) {
+		if cur != nil {
+			return nil, 0, ErrExists
+		}
+		return value, ttl, nil
+	})
+}
+
+// Delete deletes the value of key.
+func Delete(ctx context.Context, s Store, key string) error {
+	return s.Update(ctx, key, func([]byte) ([]byte, time.Duration, error) {
+		return nil, 0, nil
+	})
+}
+
+// entry is a stored value.
+type entry struct {
+	Value   []byte    `json:"value"`
+	Expires time.Time `json:"expires,omitzero"`
+}
+
+func (e *entry) valid(now time.Time) bool {
+	return e != nil && (e.Expires.IsZero() || now.Before(e.Expires))
+}
+
+// expiry returns the expiration time of the values stored at now for ttl.
+func expiry(now time.Time, ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return now.Add(ttl)
+}
+
+// MemoryStore is a Store keeping the values in memory, shared by the
+// goroutines of a process only, such as those of a Server.
+type MemoryStore struct {
+	// Now returns the current time, time.Now if not set.
+	Now func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+}
+
+func (m *MemoryStore) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+// Get returns the value of key.
+func (m *MemoryStore) Get(ctx context.Context, key string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if e := m.entries[key]; e.valid(m.now()) {
+		return e.Value, nil
+	}
+	return nil, nil
+}
+
+// Update updates the value of key.
+func (m *MemoryStore) Update(ctx context.Context, key string, f func([]byte) ([]byte, time.Duration, error)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	var cur []byte
+	if e := m.entries[key]; e.valid(now) {
+		cur = e.Value
+	}
+	next, ttl, err := f(cur)
+	if err != nil {
+		return err
+	}
+	if next == nil {
+		delete(m.entries, key)
+		return nil
+	}
+	if m.entries == nil {
+		m.entries = map[string]*entry{}
+	}
+	m.entries[key] = &entry{Value: next, Expires: expiry(now, ttl)}
+	return nil
+}
+
+// Purge deletes the expired values.
+func (m *MemoryStore) Purge() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := m.now()
+	for k, e := range m.entries {
+		if !e.valid(now) {
+			delete(m.entries, k)
+		}
+	}
+}
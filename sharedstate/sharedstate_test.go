@@ -0,0 +1,153 @@
+package sharedstate
+
+import (
+	"context"
+	"errors"
+	"net"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *clock) advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+func testStore(t *testing.T, s Store, c *clock) {
+	ctx := context.Background()
+	if v, err := s.Get(ctx, "missing"); err != nil || v != nil {
+		t.Fatalf("get #error: expected nil, got %q, %v", v, err)
+	}
+	for i := int64(1); i <= 3; i++ {
+		if n, err := Increment(ctx, s, "failures:alice", 1, time.Minute); err != nil || n != i {
+			t.Fatalf("increment #error: expected %d, got %d, %v", i, n, err)
+		}
+	}
+	if v, err := s.Get(ctx, "failures:alice"); err != nil || string(v) != "3" {
+		t.Fatalf("get #error: expected 3, got %q, %v", v, err)
+	}
+	c.advance(2 * time.Minute)
+	if n, err := Increment(ctx, s, "failures:alice", 1, time.Minute); err != nil || n != 1 {
+		t.Fatalf("increment #error: expected an expired counter, got %d, %v", n, err)
+	}
+
+	if err := Claim(ctx, s, "nonce:abc", nil, time.Minute); err != nil {
+		t.Fatalf("claim #error: %v", err)
+	}
+	if v, err := s.Get(ctx, "nonce:abc"); err != nil || v == nil || len(v) != 0 {
+		t.Fatalf("get #error: expected an empty value, got %q, %v", v, err)
+	}
+	if err := Claim(ctx, s, "nonce:abc", nil, time.Minute); !errors.Is(err, ErrExists) {
+		t.Fatalf("claim #error: expected %v, got %v", ErrExists, err)
+	}
+	c.advance(2 * time.Minute)
+	if err := Claim(ctx, s, "nonce:abc", []byte("x"), 0); err != nil {
+		t.Fatalf("claim #error: expected an expired nonce, got %v", err)
+	}
+	c.advance(24 * time.Hour)
+	if v, err := s.Get(ctx, "nonce:abc"); err != nil || string(v) != "x" {
+		t.Fatalf("get #error: expected a value without expiration, got %q, %v", v, err)
+	}
+	if err := Delete(ctx, s, "nonce:abc"); err != nil {
+		t.Fatalf("delete #error: %v", err)
+	}
+	if v, err := s.Get(ctx, "nonce:abc"); err != nil || v != nil {
+		t.Fatalf("get #error: expected a deleted value, got %q, %v", v, err)
+	}
+
+	failure := errors.New("failure")
+	Increment(ctx, s, "failures:bob", 1, 0)
+	err := s.Update(ctx, "failures:bob", func(cur []byte) ([]byte, time.Duration, error) {
+		return []byte("42"), 0, failure
+	})
+	if !errors.Is(err, failure) {
+		t.Fatalf("update #error: expected %v, got %v", failure, err)
+	}
+	if v, _ := s.Get(ctx, "failures:bob"); string(v) != "1" {
+		t.Fatalf("update #error: expected an unchanged value, got %q", v)
+	}
+}
+
+func testConcurrent(t *testing.T, s Store) {
+	ctx := context.Background()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range 25 {
+				if _, err := Increment(ctx, s, "counter", 1, 0); err != nil {
+					t.Errorf("increment #error: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if v, err := s.Get(ctx, "counter"); err != nil || string(v) != "200" {
+		t.Fatalf("increment #error: expected 200, got %q, %v", v, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	s := &MemoryStore{Now: c.Now}
+	testStore(t, s, c)
+	testConcurrent(t, s)
+	Claim(context.Background(), s, "short", nil, time.Second)
+	c.advance(time.Minute)
+	s.Purge()
+	if _, ok := s.entries["short"]; ok {
+		t.Fatalf("purge #error: expected the expired value to be deleted")
+	}
+}
+
+func TestFileStore(t *testing.T) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	dir := filepath.Join(t.TempDir(), "state")
+	testStore(t, &FileStore{Dir: dir, Now: c.Now}, c)
+	testConcurrent(t, &FileStore{Dir: dir})
+}
+
+func TestClient(t *testing.T) {
+	c := &clock{now: time.Unix(1700000000, 0)}
+	path := filepath.Join(t.TempDir(), "state.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatalf("listen #error: %v", err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- (&Server{Store: &MemoryStore{Now: c.Now}}).Serve(l)
+	}()
+	client := &Client{Path: path}
+	testStore(t, client, c)
+	testConcurrent(t, client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := client.Get(ctx, "counter"); !errors.Is(err, context.Canceled) {
+		t.Fatalf("get #error: expected %v, got %v", context.Canceled, err)
+	}
+	l.Close()
+	if err := <-done; err != nil {
+		t.Fatalf("serve #error: %v", err)
+	}
+	if _, err := client.Get(context.Background(), "counter"); err == nil {
+		t.Fatalf("get #error: expected a failure without server")
+	}
+}
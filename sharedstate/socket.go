@@ -0,0 +1,238 @@
+package sharedstate
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"time"
+)
+
+// DefaultSocket is the default path of the socket of a Server.
+const DefaultSocket = "/run/go-pam-state.sock"
+
+// MaxAttempts is how many times Client.Update tries to update a key
+// updated concurrently by other processes.
+const MaxAttempts = 100
+
+// ErrConflict is returned by Client.Update when the key kept being updated
+// by other processes.
+var ErrConflict = errors.New("concurrent updates")
+
+// request is sent by the clients, one JSON object by line. The swap
+// requests set the value of the key to Value, deleting it if null, if it
+// is still Old, or still unset if not Found.
+type request struct {
+	Op    string        `json:"op"`
+	Key   string        `json:"key"`
+	Old   []byte        `json:"old,omitempty"`
+	Found bool          `json:"found,omitempty"`
+	Value []byte        `json:"value"`
+	TTL   time.Duration `json:"ttl,omitempty"`
+}
+
+type response struct {
+	Value    []byte `json:"value,omitempty"`
+	Found    bool   `json:"found,omitempty"`
+	Conflict bool   `json:"conflict,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+var errConflict = errors.New("conflict")
+
+// Server serves a Store to the Clients connecting to its socket, usually
+// a MemoryStore kept by a daemon. Access is controlled by the permissions
+// of the socket.
+type Server struct {
+	// Store holds the values, a MemoryStore if nil.
+	Store Store
+}
+
+// Serve serves the connections accepted by l until it is closed.
+func (s *Server) Serve(l net.Listener) error {
+	store := s.Store
+	if store == nil {
+		store = &MemoryStore{}
+	}
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return nil
+			}
+			return err
+		}
+		go serve(store, conn)
+	}
+}
+
+func serve(store Store, conn net.Conn) {
+	defer conn.Close()
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+	for {
+		var req request
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+		if err := enc.Encode(handle(store, &req)); err != nil {
+			return
+		}
+	}
+}
+
+func handle(store Store, req *request) response {
+	ctx := context.Background()
+	var resp response
+	var err error
+	switch req.Op {
+	case "get":
+		resp.Value, err = store.Get(ctx, req.Key)
+		resp.Found = resp.Value != nil
+	case "swap":
+		err = store.Update(ctx, req.Key, func(cur []byte) ([]byte, time.Duration, error) {
+			if (cur != nil) != req.Found || !bytes.Equal(cur, req.Old) {
+				return nil, 0, errConflict
+			}
+			return req.Value, req.TTL, nil
+		})
+		resp.Conflict = errors.Is(err, errConflict)
+		if resp.Conflict {
+			err = nil
+		}
+	default:
+		err = fmt.Errorf("unknown operation %q", req.Op)
+	}
+	if err != nil {
+		resp.Error = err.Error()
+	}
+	return resp
+}
+
+// Client is a Store whose values are kept by a Server. Its updates read the
+// value of the key, then set it if no other process updated it meanwhile,
+// trying again otherwise. The zero value connects to DefaultSocket.
+type Client struct {
+	// Path is the path of the socket of the server, DefaultSocket if
+	// empty.
+	Path string
+}
+
+func (c *Client) path() string {
+	if c.Path == "" {
+		return DefaultSocket
+	}
+	return c.Path
+}
+
+// conn is a connection of a client to its server.
+type conn struct {
+	ctx  context.Context
+	conn net.Conn
+	dec  *json.Decoder
+	stop func() bool
+}
+
+// dial connects to the server, until ctx is done.
+func (c *Client) dial(ctx context.Context) (*conn, error) {
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "unix", c.path())
+	if err != nil {
+		return nil, err
+	}
+	stop := context.AfterFunc(ctx, func() {
+		nc.SetDeadline(time.Now())
+	})
+	return &conn{ctx, nc, json.NewDecoder(bufio.NewReader(nc)), stop}, nil
+}
+
+func (c *conn) Close() error {
+	c.stop()
+	return c.conn.Close()
+}
+
+// roundTrip sends req to the server and returns its response.
+func (c *conn) roundTrip(req *request) (*response, error) {
+	b, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := c.conn.Write(append(b, '\n')); err != nil {
+		return nil, errors.Join(c.ctx.Err(), err)
+	}
+	var resp response
+	if err := c.dec.Decode(&resp); err != nil {
+		return nil, errors.Join(c.ctx.Err(), err)
+	}
+	if resp.Error != "" {
+		return nil, fmt.Errorf("shared state of %q: %s", req.Key, resp.Error)
+	}
+	return &resp, nil
+}
+
+// get returns the value of key, told apart from an empty one if none.
+func (c *conn) get(key string) ([]byte, error) {
+	resp, err := c.roundTrip(&request{Op: "get", Key: key})
+	if err != nil || !resp.Found {
+		return nil, err
+	}
+	if resp.Value == nil {
+		return []byte{}, nil
+	}
+	return resp.Value, nil
+}
+
+// Get returns the value of key.
+func (c *Client) Get(ctx context.Context, key string) ([]byte, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	return conn.get(key)
+}
+
+// Update updates the value of key, waiting a random delay growing with
+// each attempt after a conflict, and failing with ErrConflict after
+// MaxAttempts attempts.
+func (c *Client) Update(ctx context.Context, key string, f func([]byte) ([]byte, time.Duration, error)) error {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	for attempt := range MaxAttempts {
+		if attempt > 0 {
+			backoff := time.Duration(rand.Int64N(int64(attempt)*int64(time.Millisecond) + 1))
+			select {
+			case <-time.After(backoff):
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		cur, err := conn.get(key)
+		if err != nil {
+			return err
+		}
+		next, ttl, err := f(cur)
+		if err != nil {
+			return err
+		}
+		resp, err := conn.roundTrip(&request{
+			Op: "swap", Key: key,
+			Old: cur, Found: cur != nil,
+			Value: next, TTL: ttl,
+		})
+		if err != nil {
+			return err
+		}
+		if !resp.Conflict {
+			return nil
+		}
+	}
+	return fmt.Errorf("shared state of %q: %w", key, ErrConflict)
+}
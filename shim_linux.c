@@ -0,0 +1,35 @@
+//go:build linux
+
+// Linux-PAM shims: the recent functions are weak symbols, so that the
+// package still links with the versions of libpam lacking them.
+
+#include <security/pam_appl.h>
+#include <stddef.h>
+
+// pam_start_confdir is a recent PAM api to declare a confdir (mostly for tests)
+// weaken the linking dependency to detect if it’s present.
+int pam_start_confdir(const char *service_name, const char *user, const struct pam_conv *pam_conversation, const char *confdir, pam_handle_t **pamh) __attribute__ ((weak));
+
+int check_pam_start_confdir(void) {
+	if (pam_start_confdir == NULL)
+		return 1;
+	return 0;
+}
+
+int call_pam_start_confdir(const char *service_name, const char *user,
+	const struct pam_conv *pam_conversation, const char *confdir,
+	pam_handle_t **pamh)
+{
+	if (pam_start_confdir == NULL)
+		return PAM_SYMBOL_ERR;
+	return pam_start_confdir(service_name, user, pam_conversation, confdir, pamh);
+}
+
+int check_pam_fail_delay(void) {
+	return 0;
+}
+
+int call_pam_fail_delay(pam_handle_t *pamh, unsigned int usec)
+{
+	return pam_fail_delay(pamh, usec);
+}
@@ -0,0 +1,54 @@
+//go:build !linux
+
+// OpenPAM (FreeBSD, macOS) and Solaris shims: the Linux-PAM extensions are
+// looked up at run time, as the linkers of those systems reject the weak
+// undefined symbols.
+
+#include <security/pam_appl.h>
+#include <dlfcn.h>
+#include <stddef.h>
+
+typedef int (*pam_start_confdir_fn)(const char *, const char *,
+	const struct pam_conv *, const char *, pam_handle_t **);
+typedef int (*pam_fail_delay_fn)(pam_handle_t *, unsigned int);
+
+// lookup returns the address of the libpam function, NULL if not found.
+static void *lookup(const char *name)
+{
+	void *self = dlopen(NULL, RTLD_LAZY);
+	if (self == NULL)
+		return NULL;
+	void *sym = dlsym(self, name);
+	dlclose(self);
+	return sym;
+}
+
+int check_pam_start_confdir(void) {
+	if (lookup("pam_start_confdir") == NULL)
+		return 1;
+	return 0;
+}
+
+int call_pam_start_confdir(const char *service_name, const char *user,
+	const struct pam_conv *pam_conversation, const char *confdir,
+	pam_handle_t **pamh)
+{
+	pam_start_confdir_fn f = (pam_start_confdir_fn)lookup("pam_start_confdir");
+	if (f == NULL)
+		return PAM_SYMBOL_ERR;
+	return f(service_name, user, pam_conversation, confdir, pamh);
+}
+
+int check_pam_fail_delay(void) {
+	if (lookup("pam_fail_delay") == NULL)
+		return 1;
+	return 0;
+}
+
+int call_pam_fail_delay(pam_handle_t *pamh, unsigned int usec)
+{
+	pam_fail_delay_fn f = (pam_fail_delay_fn)lookup("pam_fail_delay");
+	if (f == NULL)
+		return PAM_SYMBOL_ERR;
+	return f(pamh, usec);
+}
@@ -0,0 +1,189 @@
+// Package shutdown stops the goroutines and releases the resources started by
+// the modules written in Go once the host application is done with them.
+//
+// The modules built with -buildmode=c-shared can't be unloaded by the
+// applications, and their goroutines would otherwise keep running, and
+// their sockets open, until the process exits. They register them with a
+// Group instead, usually Default, which is shut down when the process
+// exits, by the destructor of the library, or earlier by the modules
+// themselves, such as when their last transaction ends.
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"io"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ErrShutdown is returned when registering with a group already shut down.
+var ErrShutdown = errors.New("shut down")
+
+// Group is a set of goroutines and resources stopped together. The zero
+// value is ready to use, and its methods can be used by multiple goroutines
+// at the same time.
+type Group struct {
+	mu      sync.Mutex
+	ctx     context.Context
+	cancel  context.CancelFunc
+	wg      sync.WaitGroup
+	closers []io.Closer
+	done    bool
+}
+
+func (g *Group) init() {
+	if g.ctx == nil {
+		g.ctx, g.cancel = context.WithCancel(context.Background())
+	}
+}
+
+// Context returns the context of the group, done once it is shut down.
+func (g *Group) Context() context.Context {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.init()
+	return g.ctx
+}
+
+// Go runs f in a goroutine, with a context done once the group is shut
+// down, when f is expected to return. It fails with ErrShutdown if the
+// group is already shut down.
+func (g *Group) Go(f func(ctx context.Context)) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.done {
+		return ErrShutdown
+	}
+	g.init()
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		f(g.ctx)
+	}()
+	return nil
+}
+
+// Register adds a resource closed when the group is shut down, such as a
+// socket, once its goroutines have returned. It fails with ErrShutdown,
+// closing c at once, if the group is already shut down.
+func (g *Group) Register(c io.Closer) error {
+	g.mu.Lock()
+	if g.done {
+		g.mu.Unlock()
+		c.Close()
+		return ErrShutdown
+	}
+	defer g.mu.Unlock()
+	g.closers = append(g.closers, c)
+	return nil
+}
+
+// RegisterFunc adds a function called when the group is shut down, see
+// Register.
+func (g *Group) RegisterFunc(f func() error) error {
+	return g.Register(closerFunc(f))
+}
+
+// ModuleCleanup is implemented by the module handlers releasing their state
+// on shutdown, such as by flushing their caches, closing their audit sinks
+// and wiping the secrets they keep.
+type ModuleCleanup interface {
+	Cleanup() error
+}
+
+// RegisterCleanup adds a handler whose Cleanup method is called when the
+// group is shut down, see Register.
+func (g *Group) RegisterCleanup(h ModuleCleanup) error {
+	return g.RegisterFunc(h.Cleanup)
+}
+
+type closerFunc func() error
+
+func (f closerFunc) Close() error {
+	return f()
+}
+
+// Shutdown cancels the context of the goroutines of the group and waits for
+// them to return, until ctx is done, then closes its resources in the
+// reverse order of their registration. It returns the errors of the
+// resources joined with the one of ctx, if the goroutines didn't return in
+// time. Shutting down a group again has no effect.
+func (g *Group) Shutdown(ctx context.Context) error {
+	g.mu.Lock()
+	if g.done {
+		g.mu.Unlock()
+		return nil
+	}
+	g.done = true
+	g.init()
+	g.cancel()
+	closers := g.closers
+	g.closers = nil
+	g.mu.Unlock()
+
+	var errs []error
+	wait := make(chan struct{})
+	go func() {
+		g.wg.Wait()
+		close(wait)
+	}()
+	select {
+	case <-wait:
+	case <-ctx.Done():
+		errs = append(errs, ctx.Err())
+	}
+	for _, c := range slices.Backward(closers) {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Default is the group shut down when the library of a module is
+// unloaded, or when the process exits.
+var Default Group
+
+// UnloadTimeout is how long the goroutines of Default are waited for when
+// the library is unloaded.
+const UnloadTimeout = 2 * time.Second
+
+// Go runs f in a goroutine of Default, see Group.Go.
+func Go(f func(ctx context.Context)) error {
+	return Default.Go(f)
+}
+
+// Register adds a resource to Default, see Group.Register.
+func Register(c io.Closer) error {
+	return Default.Register(c)
+}
+
+// RegisterFunc adds a function to Default, see Group.RegisterFunc.
+func RegisterFunc(f func() error) error {
+	return Default.RegisterFunc(f)
+}
+
+// RegisterCleanup adds a handler to Default, see Group.RegisterCleanup.
+func RegisterCleanup(h ModuleCleanup) error {
+	return Default.RegisterCleanup(h)
+}
+
+// Shutdown shuts Default down, see Group.Shutdown.
+func Shutdown(ctx context.Context) error {
+	return Default.Shutdown(ctx)
+}
+
+// unload shuts Default down, called by the destructor of the library.
+func unload() {
+	Default.mu.Lock()
+	idle := Default.ctx == nil && len(Default.closers) == 0
+	Default.mu.Unlock()
+	if idle {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), UnloadTimeout)
+	defer cancel()
+	Default.Shutdown(ctx)
+}
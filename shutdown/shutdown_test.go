@@ -0,0 +1,88 @@
+package shutdown
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestGroup(t *testing.T) {
+	var g Group
+	var closed []string
+	stopped := make(chan struct{})
+	if err := g.Go(func(ctx context.Context) {
+		<-ctx.Done()
+		closed = append(closed, "goroutine")
+		close(stopped)
+	}); err != nil {
+		t.Fatalf("go #error: %v", err)
+	}
+	failure := errors.New("failure")
+	g.RegisterFunc(func() error { closed = append(closed, "first"); return failure })
+	g.RegisterFunc(func() error { closed = append(closed, "second"); return nil })
+
+	if err := g.Shutdown(context.Background()); !errors.Is(err, failure) {
+		t.Fatalf("shutdown #error: expected %v, got %v", failure, err)
+	}
+	<-stopped
+	if expected := []string{"goroutine", "second", "first"}; !slices.Equal(closed, expected) {
+		t.Fatalf("shutdown #error: expected %v, got %v", expected, closed)
+	}
+	if g.Context().Err() == nil {
+		t.Fatalf("shutdown #error: context not done")
+	}
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown #error: %v", err)
+	}
+
+	if err := g.Go(func(context.Context) {}); !errors.Is(err, ErrShutdown) {
+		t.Fatalf("go #error: expected %v, got %v", ErrShutdown, err)
+	}
+	late := false
+	if err := g.RegisterFunc(func() error { late = true; return nil }); !errors.Is(err, ErrShutdown) || !late {
+		t.Fatalf("register #error: expected %v and a closed resource, got %v", ErrShutdown, err)
+	}
+}
+
+type cacheHandler struct {
+	secrets map[string][]byte
+}
+
+func (h *cacheHandler) Cleanup() error {
+	for _, s := range h.secrets {
+		clear(s)
+	}
+	clear(h.secrets)
+	return nil
+}
+
+func TestGroup_RegisterCleanup(t *testing.T) {
+	var g Group
+	secret := []byte("secret")
+	h := &cacheHandler{secrets: map[string][]byte{"user": secret}}
+	if err := g.RegisterCleanup(h); err != nil {
+		t.Fatalf("register #error: %v", err)
+	}
+	if err := g.Shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown #error: %v", err)
+	}
+	if len(h.secrets) != 0 || string(secret) != "\x00\x00\x00\x00\x00\x00" {
+		t.Fatalf("cleanup #error: got %q, %q", h.secrets, secret)
+	}
+}
+
+func TestGroup_Timeout(t *testing.T) {
+	var g Group
+	release := make(chan struct{})
+	defer close(release)
+	g.Go(func(context.Context) { <-release })
+	closed := false
+	g.RegisterFunc(func() error { closed = true; return nil })
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := g.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) || !closed {
+		t.Fatalf("shutdown #error: expected %v and a closed resource, got %v", context.DeadlineExceeded, err)
+	}
+}
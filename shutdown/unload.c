@@ -0,0 +1,10 @@
+#include "_cgo_export.h"
+
+// The destructor of the library runs when the process exits, the Go
+// libraries not being unloaded, but not when the Go programs exit, as they
+// don't run the destructors.
+__attribute__((destructor))
+static void go_pam_shutdown_unload(void)
+{
+	goPamShutdownUnload();
+}
@@ -0,0 +1,11 @@
+package shutdown
+
+import "C"
+
+// goPamShutdownUnload is called by the destructor of the library, see
+// unload.c.
+//
+//export goPamShutdownUnload
+func goPamShutdownUnload() {
+	unload()
+}
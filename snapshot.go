@@ -0,0 +1,134 @@
+package pam
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"slices"
+)
+
+// Snapshot is the PAM environment and items of a transaction at a point in
+// time, which can be restored later, for example by the brokers resuming
+// the sessions they suspended, or compared with another snapshot to audit
+// what the modules changed. The authentication tokens are never part of a
+// snapshot.
+type Snapshot struct {
+	Env   map[string]string
+	Items map[Item]string
+}
+
+// Snapshot takes a snapshot of the PAM environment and items.
+func (t *Transaction) Snapshot() (*Snapshot, error) {
+	env, err := t.GetEnvList()
+	if err != nil {
+		return nil, err
+	}
+	items, err := t.GetItems(envItems)
+	if err != nil {
+		return nil, err
+	}
+	return &Snapshot{Env: env, Items: items}, nil
+}
+
+// Restore restores the PAM environment and items of the snapshot: the
+// variables that are not in the snapshot are removed, and the items that
+// are not in the snapshot are kept.
+func (t *Transaction) Restore(s *Snapshot) error {
+	current, err := t.GetEnvList()
+	if err != nil {
+		return err
+	}
+	for _, c := range diffEnv(current, s.Env) {
+		nameval := c.Name
+		if c.Op != SnapshotRemoved {
+			nameval += "=" + c.New
+		}
+		if err := t.PutEnv(nameval); err != nil {
+			return err
+		}
+	}
+	return t.SetItems(s.Items)
+}
+
+// SnapshotOp is the kind of a SnapshotChange.
+type SnapshotOp int
+
+// Snapshot change kinds.
+const (
+	SnapshotAdded SnapshotOp = iota
+	SnapshotRemoved
+	SnapshotChanged
+)
+
+// SnapshotChange is a difference between two snapshots.
+type SnapshotChange struct {
+	Op SnapshotOp
+	// Item is the changed item, 0 for the environment variables.
+	Item Item
+	// Name is the name of the changed variable or item.
+	Name string
+	// Old and New are the values before and after the change, empty if
+	// added or removed.
+	Old, New string
+}
+
+func (c SnapshotChange) String() string {
+	switch c.Op {
+	case SnapshotAdded:
+		return fmt.Sprintf("+%s=%s", c.Name, c.New)
+	case SnapshotRemoved:
+		return fmt.Sprintf("-%s=%s", c.Name, c.Old)
+	}
+	return fmt.Sprintf("~%s=%s (was %s)", c.Name, c.New, c.Old)
+}
+
+// Diff returns the changes from s to other: those of the items, then those
+// of the environment, each in the order of their names.
+func (s *Snapshot) Diff(other *Snapshot) []SnapshotChange {
+	var changes []SnapshotChange
+	for _, item := range slices.Sorted(maps.Keys(mergeKeys(s.Items, other.Items))) {
+		old, hadOld := s.Items[item]
+		new, hasNew := other.Items[item]
+		if c, ok := change(item.String(), old, new, hadOld, hasNew); ok {
+			c.Item = item
+			changes = append(changes, c)
+		}
+	}
+	return append(changes, diffEnv(s.Env, other.Env)...)
+}
+
+func diffEnv(from, to map[string]string) []SnapshotChange {
+	var changes []SnapshotChange
+	for _, name := range slices.Sorted(maps.Keys(mergeKeys(from, to))) {
+		old, hadOld := from[name]
+		new, hasNew := to[name]
+		if c, ok := change(name, old, new, hadOld, hasNew); ok {
+			changes = append(changes, c)
+		}
+	}
+	return changes
+}
+
+func change(name, old, new string, hadOld, hasNew bool) (SnapshotChange, bool) {
+	switch {
+	case !hadOld && hasNew:
+		return SnapshotChange{Op: SnapshotAdded, Name: name, New: new}, true
+	case hadOld && !hasNew:
+		return SnapshotChange{Op: SnapshotRemoved, Name: name, Old: old}, true
+	case old != new:
+		return SnapshotChange{Op: SnapshotChanged, Name: name, Old: old, New: new}, true
+	}
+	return SnapshotChange{}, false
+}
+
+// mergeKeys returns the set of the keys of a and b.
+func mergeKeys[K cmp.Ordered, V any](a, b map[K]V) map[K]struct{} {
+	keys := make(map[K]struct{}, len(a)+len(b))
+	for k := range a {
+		keys[k] = struct{}{}
+	}
+	for k := range b {
+		keys[k] = struct{}{}
+	}
+	return keys
+}
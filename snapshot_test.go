@@ -0,0 +1,75 @@
+package pam
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSnapshot_Diff(t *testing.T) {
+	a := &Snapshot{
+		Env:   map[string]string{"KEEP": "1", "CHANGE": "old", "REMOVE": "x"},
+		Items: map[Item]string{User: "alice", Tty: "tty1"},
+	}
+	b := &Snapshot{
+		Env:   map[string]string{"KEEP": "1", "CHANGE": "new", "ADD": "y"},
+		Items: map[Item]string{User: "alice", Tty: "pts/0", Rhost: "example.com"},
+	}
+	got := fmt.Sprint(a.Diff(b))
+	want := "[~PAM_TTY=pts/0 (was tty1) +PAM_RHOST=example.com +ADD=y ~CHANGE=new (was old) -REMOVE=x]"
+	if got != want {
+		t.Fatalf("diff #error: got %s, expected %s", got, want)
+	}
+	if changes := a.Diff(a); len(changes) != 0 {
+		t.Fatalf("diff #error: got %v", changes)
+	}
+}
+
+func TestTransaction_Snapshot(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	tx, err := StartConfDir("permit-service", "test", Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	for _, nameval := range []string{"KEEP=1", "CHANGE=old", "REMOVE=x"} {
+		if err := tx.PutEnv(nameval); err != nil {
+			t.Fatalf("putenv #error: %v", err)
+		}
+	}
+	if err := tx.SetItem(Tty, "tty1"); err != nil {
+		t.Fatalf("setitem #error: %v", err)
+	}
+	before, err := tx.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot #error: %v", err)
+	}
+
+	for _, nameval := range []string{"CHANGE=new", "REMOVE", "ADD=y"} {
+		if err := tx.PutEnv(nameval); err != nil {
+			t.Fatalf("putenv #error: %v", err)
+		}
+	}
+	if err := tx.SetItem(Tty, "pts/0"); err != nil {
+		t.Fatalf("setitem #error: %v", err)
+	}
+	after, err := tx.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot #error: %v", err)
+	}
+	if changes := before.Diff(after); len(changes) != 4 {
+		t.Fatalf("diff #error: got %v", changes)
+	}
+
+	if err := tx.Restore(before); err != nil {
+		t.Fatalf("restore #error: %v", err)
+	}
+	restored, err := tx.Snapshot()
+	if err != nil {
+		t.Fatalf("snapshot #error: %v", err)
+	}
+	if changes := before.Diff(restored); len(changes) != 0 {
+		t.Fatalf("restore #error: got %v", changes)
+	}
+}
@@ -0,0 +1,200 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"slices"
+	"time"
+)
+
+// StartOption configures StartWithOptions. The AuthOption values are
+// start options too, such as WithConfDir and WithItems.
+type StartOption interface {
+	applyStart(o *startOptions)
+}
+
+// startOptions are the settings of StartWithOptions.
+type startOptions struct {
+	user    string
+	handler ConversationHandler
+	confDir string
+	items   map[Item]string
+	env     map[string]string
+	setups  []func(ctx context.Context, tx *Transaction) error
+	locked  bool
+	// thread is the locked thread started if locked is set.
+	thread      *lockedThread
+	observers   []Observer
+	convTimeout time.Duration
+	convLimits  ConvLimits
+}
+
+type startOptionFunc func(o *startOptions)
+
+func (f startOptionFunc) applyStart(o *startOptions) {
+	f(o)
+}
+
+// applyStart applies the settings of the authentication option that are
+// relevant to the transactions: the directory of the services, the handler
+// and the setup, run once the transaction is started.
+func (f AuthOption) applyStart(o *startOptions) {
+	a := &Authenticator{ConfDir: o.confDir, Handler: o.handler}
+	f(a)
+	o.confDir, o.handler = a.ConfDir, a.Handler
+	if a.Setup != nil {
+		o.setups = append(o.setups, a.Setup)
+	}
+}
+
+// WithUser sets the name of the user of the transaction. If not set, the
+// PAM stack asks for it.
+func WithUser(user string) StartOption {
+	return startOptionFunc(func(o *startOptions) {
+		o.user = user
+	})
+}
+
+// WithConversationHandler sets the conversation handler of the transaction.
+// If not set, the conversations fail.
+func WithConversationHandler(handler ConversationHandler) StartOption {
+	return startOptionFunc(func(o *startOptions) {
+		o.handler = handler
+	})
+}
+
+// WithItem sets an item of the transaction once it is started.
+func WithItem(item Item, value string) StartOption {
+	return startOptionFunc(func(o *startOptions) {
+		if o.items == nil {
+			o.items = map[Item]string{}
+		}
+		o.items[item] = value
+	})
+}
+
+// WithRHost sets the Rhost item of the transaction, the remote host the
+// user connects from.
+func WithRHost(host string) StartOption {
+	return WithItem(Rhost, host)
+}
+
+// WithTTY sets the Tty item of the transaction, the terminal of the user.
+func WithTTY(tty string) StartOption {
+	return WithItem(Tty, tty)
+}
+
+// WithRUser sets the Ruser item of the transaction, the remote user
+// requesting the authentication.
+func WithRUser(user string) StartOption {
+	return WithItem(Ruser, user)
+}
+
+// WithEnv sets variables of the PAM environment of the transaction once it
+// is started.
+func WithEnv(env map[string]string) StartOption {
+	return startOptionFunc(func(o *startOptions) {
+		if o.env == nil {
+			o.env = map[string]string{}
+		}
+		maps.Copy(o.env, env)
+	})
+}
+
+// WithLockedThread runs all the calls to libpam of the transaction, and so
+// its conversations, on a dedicated OS thread, for the modules keeping a
+// per-thread state, such as pam_krb5 with its credentials cache or
+// pam_systemd, which break when the Go scheduler moves the calls of a
+// transaction to other threads. The thread exits once the transaction
+// ends.
+//
+// The calls made by the conversation handler run on the thread as usual,
+// while those made by other goroutines wait for the running one to return:
+// a handler must not wait for other goroutines using the transaction. The
+// handler runs on the thread too, so Interrupt only fails its
+// conversation once it returns, unless the operation has a context or the
+// transaction WithConvTimeout.
+func WithLockedThread() StartOption {
+	return startOptionFunc(func(o *startOptions) {
+		o.locked = true
+	})
+}
+
+// WithConvTimeout fails the conversations whose handler doesn't respond
+// within d, as Interrupt does, with ErrPromptTimeout as their ConvError.
+// The handler keeps running in the background until it returns, its
+// responses being discarded; the calls it makes on the transaction meanwhile
+// fail with ErrTransactionEnded, unless it was started WithLockedThread.
+func WithConvTimeout(d time.Duration) StartOption {
+	return startOptionFunc(func(o *startOptions) {
+		o.convTimeout = d
+	})
+}
+
+// WithObserver adds an observer of the events of the transaction, as
+// Transaction.Subscribe does, notified of its start too. It can be used
+// more than once.
+func WithObserver(observer Observer) StartOption {
+	return startOptionFunc(func(o *startOptions) {
+		o.observers = append(o.observers, observer)
+	})
+}
+
+// errNoHandler is the failure of the conversations of the transactions
+// started without handler.
+var errNoHandler = errors.New("no conversation handler")
+
+// StartWithOptions initiates a new PAM transaction for the service, as
+// Start does, then sets its items and its environment. The transaction is
+// closed if they can't be set.
+func StartWithOptions(service string, opts ...StartOption) (*Transaction, error) {
+	o := &startOptions{}
+	for _, opt := range opts {
+		opt.applyStart(o)
+	}
+	handler := o.handler
+	if handler == nil {
+		handler = ConversationFunc(func(Style, string) (string, error) {
+			return "", errNoHandler
+		})
+	}
+	if o.locked {
+		o.thread = newLockedThread()
+	}
+	var tx *Transaction
+	var err error
+	if o.confDir != "" {
+		tx, err = startConfDir(service, handler, o)
+	} else {
+		tx, err = start(service, handler, o)
+	}
+	if err != nil {
+		o.thread.stop()
+		return nil, err
+	}
+	if err := o.setup(tx); err != nil {
+		tx.Close()
+		return nil, err
+	}
+	return tx, nil
+}
+
+// setup sets the items and the environment of the transaction, then runs
+// the setups of the authentication options.
+func (o *startOptions) setup(tx *Transaction) error {
+	if err := tx.SetItems(o.items); err != nil {
+		return err
+	}
+	for _, name := range slices.Sorted(maps.Keys(o.env)) {
+		if err := tx.PutEnv(name + "=" + o.env[name]); err != nil {
+			return err
+		}
+	}
+	for _, setup := range o.setups {
+		if err := setup(context.Background(), tx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package pam
+
+import (
+	"errors"
+	"os/user"
+	"testing"
+)
+
+func TestStartWithOptions(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	tx, err := StartWithOptions("login-service",
+		WithUser(u.Username),
+		WithConversationHandler(Credentials{}),
+		WithConfDir("test-services"),
+		WithRHost("192.0.2.1"),
+		WithTTY("pts/1"),
+		WithRUser("bob"),
+		WithItems(map[Item]string{UserPrompt: "Login: "}),
+		WithEnv(map[string]string{"LANG": "C.UTF-8", "EMPTY": ""}),
+	)
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	items, err := tx.GetItems([]Item{User, Rhost, Tty, Ruser, UserPrompt})
+	if err != nil {
+		t.Fatalf("getitems #error: %v", err)
+	}
+	expected := map[Item]string{User: u.Username, Rhost: "192.0.2.1", Tty: "pts/1",
+		Ruser: "bob", UserPrompt: "Login: "}
+	for item, value := range expected {
+		if items[item] != value {
+			t.Fatalf("getitems #error: %v: expected %q, got %q", item, value, items[item])
+		}
+	}
+	env, err := tx.GetEnvList()
+	if err != nil || env["LANG"] != "C.UTF-8" || env["EMPTY"] != "" || len(env) != 2 {
+		t.Fatalf("getenvlist #error: unexpected environment %v, %v", env, err)
+	}
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+}
+
+func TestStartWithOptions_NoHandler(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	tx, err := StartWithOptions("echo-service", WithUser(u.Username), WithConfDir("test-services"))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	if err := tx.Authenticate(0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if err := tx.ConversationError(); !errors.Is(err, errNoHandler) {
+		t.Fatalf("authenticate #error: expected %v, got %v", errNoHandler, err)
+	}
+
+	_, err = StartWithOptions("login-service", WithConfDir("test-services"),
+		WithItem(Item(-1), "invalid"))
+	if !errors.Is(err, ErrBadItem) {
+		t.Fatalf("start #error: expected %v, got %v", ErrBadItem, err)
+	}
+}
@@ -0,0 +1,84 @@
+package pam
+
+import (
+	"errors"
+	"sync/atomic"
+)
+
+// ErrTransactionEnded is returned by the calls made on a transaction that
+// has been closed, including those racing with Close, and by those of the
+// conversation handlers abandoned by a transaction without a locked thread,
+// which could otherwise run along the calls of the application.
+var ErrTransactionEnded = errors.New("pam: transaction ended")
+
+// ErrTransactionActive is returned by Close when an operation of the
+// transaction is still running, for example if it is called by the
+// conversation handler: the transaction can only be closed once it is
+// done.
+var ErrTransactionActive = errors.New("pam: transaction active")
+
+// stateEnded is the bit of the state set once the transaction has ended.
+const stateEnded = 1 << 30
+
+// transactionState is the state of a transaction, shared with its
+// conversation: it is created once started, active while any of its calls
+// runs and ended once closed. The state value is the number of calls
+// running, or stateEnded. A nil state is always created, as the one of a
+// zero Transaction.
+type transactionState struct {
+	v atomic.Int32
+	// abandoned are the conversation handlers abandoned meanwhile,
+	// whose calls fail.
+	abandoned abandonedHandlers
+}
+
+// enter marks a call of the transaction as running, unless it has ended or
+// is made by an abandoned conversation handler. Calls made by the
+// conversation handler nest in the running operation.
+func (s *transactionState) enter() error {
+	if s == nil {
+		return nil
+	}
+	if s.abandoned.current() {
+		return ErrTransactionEnded
+	}
+	for {
+		v := s.v.Load()
+		if v == stateEnded {
+			return ErrTransactionEnded
+		}
+		if s.v.CompareAndSwap(v, v+1) {
+			return nil
+		}
+	}
+}
+
+// leave marks a call of the transaction as done.
+func (s *transactionState) leave() {
+	if s != nil {
+		s.v.Add(-1)
+	}
+}
+
+// end moves the transaction to the ended state, returning false if it had
+// already ended.
+func (s *transactionState) end() (bool, error) {
+	if s == nil {
+		return true, nil
+	}
+	for {
+		switch v := s.v.Load(); {
+		case v == stateEnded:
+			return false, nil
+		case v > 0:
+			return false, ErrTransactionActive
+		case s.v.CompareAndSwap(v, stateEnded):
+			return true, nil
+		}
+	}
+}
+
+// ended returns whether the transaction has ended.
+func (s *transactionState) ended() bool {
+	return s != nil && s.v.Load() == stateEnded
+}
@@ -0,0 +1,73 @@
+package pam
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestTransactionState(t *testing.T) {
+	var s transactionState
+	if err := s.enter(); err != nil {
+		t.Fatalf("enter #error: %v", err)
+	}
+	if err := s.enter(); err != nil {
+		t.Fatalf("enter #error: %v", err)
+	}
+	if _, err := s.end(); !errors.Is(err, ErrTransactionActive) {
+		t.Fatalf("end #error: expected %v, got %v", ErrTransactionActive, err)
+	}
+	s.leave()
+	s.leave()
+	if ended, err := s.end(); !ended || err != nil {
+		t.Fatalf("end #error: %v %v", ended, err)
+	}
+	if !s.ended() {
+		t.Fatalf("ended #error: expected the state to be ended")
+	}
+	if ended, err := s.end(); ended || err != nil {
+		t.Fatalf("end #error: %v %v", ended, err)
+	}
+	if err := s.enter(); !errors.Is(err, ErrTransactionEnded) {
+		t.Fatalf("enter #error: expected %v, got %v", ErrTransactionEnded, err)
+	}
+}
+
+func TestPAM_Ended(t *testing.T) {
+	var closeErr error
+	var tx *Transaction
+	tx = conversationStart(t, ConversationFunc(func(s Style, msg string) (string, error) {
+		closeErr = tx.Close()
+		return "", nil
+	}))
+	if _, err := tx.converse(conversationMessages[:1]); err != nil {
+		t.Fatalf("converse #error: %v", err)
+	}
+	if !errors.Is(closeErr, ErrTransactionActive) {
+		t.Fatalf("close #error: expected %v, got %v", ErrTransactionActive, closeErr)
+	}
+	if err := tx.End(DataSilent); err != nil {
+		t.Fatalf("end #error: %v", err)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+
+	if err := tx.Authenticate(0); !errors.Is(err, ErrTransactionEnded) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrTransactionEnded, err)
+	}
+	if _, err := tx.GetItem(User); !errors.Is(err, ErrTransactionEnded) {
+		t.Fatalf("getitem #error: expected %v, got %v", ErrTransactionEnded, err)
+	}
+	if err := tx.SetItems(map[Item]string{Tty: "tty1"}); !errors.Is(err, ErrTransactionEnded) {
+		t.Fatalf("setitems #error: expected %v, got %v", ErrTransactionEnded, err)
+	}
+	if err := tx.PutEnv("A=B"); !errors.Is(err, ErrTransactionEnded) {
+		t.Fatalf("putenv #error: expected %v, got %v", ErrTransactionEnded, err)
+	}
+	if _, err := tx.GetEnvList(); !errors.Is(err, ErrTransactionEnded) {
+		t.Fatalf("getenvlist #error: expected %v, got %v", ErrTransactionEnded, err)
+	}
+	if v := tx.GetEnv("A"); v != "" {
+		t.Fatalf("getenv #error: unexpected value %q", v)
+	}
+}
@@ -0,0 +1,292 @@
+// Package statestore stores the per-user records of the stateful modules
+// written in Go, such as their counters or their enrollments, in the files
+// of a directory, usually /var/lib/<module>.
+//
+// The records are updated atomically with regard to the other processes
+// running the module: they are locked while read and updated, and written
+// to a temporary file synced then renamed over the previous one, so that a
+// crash never leaves a partial record. The records that can't be decoded
+// anyway are moved aside and read as zero values, rather than locking the
+// users out.
+//
+//	store := statestore.New[Enrollment]("pam_example")
+//	e, err := store.Update(user, func(e *Enrollment) error {
+//		e.Uses++
+//		return nil
+//	})
+package statestore
+
+import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/msteinert/pam"
+)
+
+// BaseDir is the directory of the directories of the modules.
+const BaseDir = "/var/lib"
+
+// ErrCorrupt is passed to Store.OnCorrupt with the decoding error of the
+// records moved aside.
+var ErrCorrupt = errors.New("corrupt record")
+
+// ErrInsecure is returned when the directory of the records can be written
+// by other users than the one of the process.
+var ErrInsecure = errors.New("insecure state directory")
+
+// Format is the encoding of the records.
+type Format int
+
+const (
+	// JSON encodes the records as JSON, the default.
+	JSON Format = iota
+	// Gob encodes the records with encoding/gob.
+	Gob
+)
+
+func (f Format) ext() string {
+	if f == Gob {
+		return ".gob"
+	}
+	return ".json"
+}
+
+func (f Format) marshal(v any) ([]byte, error) {
+	if f == Gob {
+		var buf bytes.Buffer
+		err := gob.NewEncoder(&buf).Encode(v)
+		return buf.Bytes(), err
+	}
+	return json.Marshal(v)
+}
+
+func (f Format) unmarshal(data []byte, v any) error {
+	if f == Gob {
+		return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+	}
+	return json.Unmarshal(data, v)
+}
+
+// Store stores records of T by user name.
+type Store[T any] struct {
+	// Dir is the directory of the records. It is created if needed,
+	// accessible by the user of the process only, and must not be
+	// writable by other users.
+	Dir string
+	// Format is the encoding of the records, JSON if not set.
+	Format Format
+	// Perm is the permissions of the records, 0600 if not set.
+	Perm os.FileMode
+	// OnCorrupt is called, if set, when a record can't be decoded, with
+	// an error wrapping ErrCorrupt, such as to log it. The record is
+	// moved aside, with the .corrupt suffix, once updated.
+	OnCorrupt func(name string, err error)
+}
+
+// New returns a store of records in the directory of module under
+// BaseDir.
+func New[T any](module string) *Store[T] {
+	return &Store[T]{Dir: filepath.Join(BaseDir, module)}
+}
+
+func (s *Store[T]) perm() os.FileMode {
+	if s.Perm == 0 {
+		return 0600
+	}
+	return s.Perm
+}
+
+// path returns the record file of the user, failing with pam.ErrUserUnknown
+// for the names that are not valid file names, or hidden ones, which are
+// used by the temporary files.
+func (s *Store[T]) path(name string) (string, error) {
+	if name == "" || strings.HasPrefix(name, ".") || strings.ContainsAny(name, "/\x00") {
+		return "", fmt.Errorf("%w: invalid user name %q", pam.ErrUserUnknown, name)
+	}
+	return filepath.Join(s.Dir, name+s.Format.ext()), nil
+}
+
+// checkDir creates the directory if needed, and checks it can only be
+// written by the user of the process.
+func (s *Store[T]) checkDir() error {
+	if s.Dir == "" {
+		return fmt.Errorf("%w: no directory", ErrInsecure)
+	}
+	if err := os.MkdirAll(s.Dir, 0700); err != nil {
+		return err
+	}
+	var st syscall.Stat_t
+	if err := syscall.Lstat(s.Dir, &st); err != nil {
+		return &os.PathError{Op: "lstat", Path: s.Dir, Err: err}
+	}
+	switch {
+	case st.Mode&syscall.S_IFMT != syscall.S_IFDIR:
+		return fmt.Errorf("%w: %s is not a directory", ErrInsecure, s.Dir)
+	case int(st.Uid) != os.Geteuid():
+		return fmt.Errorf("%w: %s is owned by uid %d", ErrInsecure, s.Dir, st.Uid)
+	case st.Mode&0022 != 0:
+		return fmt.Errorf("%w: %s is writable by other users", ErrInsecure, s.Dir)
+	}
+	return nil
+}
+
+// lock locks the records of the user, shared or exclusive, with a lock file
+// rather than the record itself, which is replaced when written. It is
+// unlocked when the file returned is closed.
+func (s *Store[T]) lock(path string, how int) (*os.File, error) {
+	file, err := os.OpenFile(strings.TrimSuffix(path, s.Format.ext())+".lock",
+		os.O_RDWR|os.O_CREATE|syscall.O_NOFOLLOW, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), how); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+// read reads the record of the user, locked, returning whether it is
+// corrupt.
+func (s *Store[T]) read(name, path string) (v T, corrupt bool, err error) {
+	file, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NOFOLLOW, 0)
+	if os.IsNotExist(err) {
+		return v, false, nil
+	}
+	if err != nil {
+		return v, false, err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return v, false, err
+	}
+	if err := s.Format.unmarshal(data, &v); err != nil {
+		var zero T
+		if s.OnCorrupt != nil {
+			s.OnCorrupt(name, fmt.Errorf("%w of %q: %v", ErrCorrupt, name, err))
+		}
+		return zero, true, nil
+	}
+	return v, false, nil
+}
+
+// Load returns the record of the user, the zero value of T if none.
+func (s *Store[T]) Load(name string) (T, error) {
+	var v T
+	path, err := s.path(name)
+	if err != nil {
+		return v, err
+	}
+	if err := s.checkDir(); err != nil {
+		return v, err
+	}
+	lock, err := s.lock(path, syscall.LOCK_SH)
+	if err != nil {
+		return v, err
+	}
+	defer lock.Close()
+	v, _, err = s.read(name, path)
+	return v, err
+}
+
+// Update calls f with the record of the user, the zero value of T if none,
+// with the record locked, and stores it as modified by f, unless f fails.
+// It returns the record stored.
+func (s *Store[T]) Update(name string, f func(v *T) error) (T, error) {
+	var v T
+	path, err := s.path(name)
+	if err != nil {
+		return v, err
+	}
+	if err := s.checkDir(); err != nil {
+		return v, err
+	}
+	lock, err := s.lock(path, syscall.LOCK_EX)
+	if err != nil {
+		return v, err
+	}
+	defer lock.Close()
+	v, corrupt, err := s.read(name, path)
+	if err != nil {
+		return v, err
+	}
+	if corrupt {
+		if err := os.Rename(path, path+".corrupt"); err != nil {
+			return v, err
+		}
+	}
+	if err := f(&v); err != nil {
+		return v, err
+	}
+	data, err := s.Format.marshal(&v)
+	if err != nil {
+		return v, err
+	}
+	return v, s.write(path, data)
+}
+
+// write replaces the file at path with data, synced.
+func (s *Store[T]) write(path string, data []byte) error {
+	tmp, err := os.CreateTemp(s.Dir, "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if err := tmp.Chmod(s.perm()); err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	return syncDir(s.Dir)
+}
+
+// syncDir syncs the directory, so that the renaming of its files is
+// durable.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// Delete deletes the record of the user.
+func (s *Store[T]) Delete(name string) error {
+	path, err := s.path(name)
+	if err != nil {
+		return err
+	}
+	if err := s.checkDir(); err != nil {
+		return err
+	}
+	lock, err := s.lock(path, syscall.LOCK_EX)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return syncDir(s.Dir)
+}
@@ -0,0 +1,158 @@
+package statestore
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/msteinert/pam"
+)
+
+type record struct {
+	Uses    int
+	Devices []string
+}
+
+func TestStore(t *testing.T) {
+	for _, format := range []Format{JSON, Gob} {
+		s := &Store[record]{Dir: filepath.Join(t.TempDir(), "pam_example"), Format: format}
+		if r, err := s.Load("alice"); err != nil || r.Uses != 0 {
+			t.Fatalf("load #error: expected an empty record, got %+v, %v", r, err)
+		}
+		for i := 1; i <= 2; i++ {
+			r, err := s.Update("alice", func(r *record) error {
+				r.Uses++
+				r.Devices = append(r.Devices, "key")
+				return nil
+			})
+			if err != nil || r.Uses != i || len(r.Devices) != i {
+				t.Fatalf("update #error: expected %d uses, got %+v, %v", i, r, err)
+			}
+		}
+		if r, err := s.Load("alice"); err != nil || r.Uses != 2 || len(r.Devices) != 2 {
+			t.Fatalf("load #error: unexpected record %+v, %v", r, err)
+		}
+		fi, err := os.Stat(filepath.Join(s.Dir, "alice"+format.ext()))
+		if err != nil || fi.Mode().Perm() != 0600 {
+			t.Fatalf("update #error: unexpected record file %v, %v", fi, err)
+		}
+		if fi, err := os.Stat(s.Dir); err != nil || fi.Mode().Perm() != 0700 {
+			t.Fatalf("update #error: unexpected directory %v, %v", fi, err)
+		}
+
+		failure := errors.New("failure")
+		_, err = s.Update("alice", func(r *record) error {
+			r.Uses = 100
+			return failure
+		})
+		if !errors.Is(err, failure) {
+			t.Fatalf("update #error: expected %v, got %v", failure, err)
+		}
+		if r, _ := s.Load("alice"); r.Uses != 2 {
+			t.Fatalf("update #error: expected an unchanged record, got %+v", r)
+		}
+
+		if err := s.Delete("alice"); err != nil {
+			t.Fatalf("delete #error: %v", err)
+		}
+		if err := s.Delete("alice"); err != nil {
+			t.Fatalf("delete #error: %v", err)
+		}
+		if r, err := s.Load("alice"); err != nil || r.Uses != 0 {
+			t.Fatalf("load #error: expected a deleted record, got %+v, %v", r, err)
+		}
+		entries, _ := os.ReadDir(s.Dir)
+		for _, e := range entries {
+			if e.Name()[0] == '.' {
+				t.Fatalf("update #error: temporary file %s left", e.Name())
+			}
+		}
+	}
+}
+
+func TestStore_Corrupt(t *testing.T) {
+	var corrupt []string
+	s := &Store[record]{
+		Dir: t.TempDir(),
+		OnCorrupt: func(name string, err error) {
+			if !errors.Is(err, ErrCorrupt) {
+				t.Fatalf("corrupt #error: expected %v, got %v", ErrCorrupt, err)
+			}
+			corrupt = append(corrupt, name)
+		},
+	}
+	path := filepath.Join(s.Dir, "bob.json")
+	if err := os.WriteFile(path, []byte(`{"Uses": 3`), 0600); err != nil {
+		t.Fatalf("write #error: %v", err)
+	}
+	if r, err := s.Load("bob"); err != nil || r.Uses != 0 {
+		t.Fatalf("load #error: expected an empty record, got %+v, %v", r, err)
+	}
+	r, err := s.Update("bob", func(r *record) error {
+		r.Uses++
+		return nil
+	})
+	if err != nil || r.Uses != 1 {
+		t.Fatalf("update #error: expected a recovered record, got %+v, %v", r, err)
+	}
+	if data, err := os.ReadFile(path + ".corrupt"); err != nil || string(data) != `{"Uses": 3` {
+		t.Fatalf("update #error: expected the corrupt record moved aside, got %q, %v", data, err)
+	}
+	if len(corrupt) != 2 || corrupt[0] != "bob" {
+		t.Fatalf("corrupt #error: unexpected calls %v", corrupt)
+	}
+}
+
+func TestStore_Invalid(t *testing.T) {
+	s := &Store[record]{Dir: t.TempDir()}
+	for _, name := range []string{"", ".", "..", ".hidden", "a/b", "a\x00b"} {
+		if _, err := s.Load(name); !errors.Is(err, pam.ErrUserUnknown) {
+			t.Fatalf("load #error: %q: expected %v, got %v", name, pam.ErrUserUnknown, err)
+		}
+	}
+	if err := os.Chmod(s.Dir, 0777); err != nil {
+		t.Fatalf("chmod #error: %v", err)
+	}
+	if _, err := s.Update("alice", func(*record) error { return nil }); !errors.Is(err, ErrInsecure) {
+		t.Fatalf("update #error: expected %v, got %v", ErrInsecure, err)
+	}
+	link := filepath.Join(t.TempDir(), "link")
+	os.Symlink(t.TempDir(), link)
+	s.Dir = link
+	if _, err := s.Load("alice"); !errors.Is(err, ErrInsecure) {
+		t.Fatalf("load #error: expected %v, got %v", ErrInsecure, err)
+	}
+	if _, err := (&Store[record]{}).Load("alice"); !errors.Is(err, ErrInsecure) {
+		t.Fatalf("load #error: expected %v, got %v", ErrInsecure, err)
+	}
+	if s := New[record]("pam_example"); s.Dir != "/var/lib/pam_example" {
+		t.Fatalf("new #error: unexpected directory %s", s.Dir)
+	}
+}
+
+func TestStore_Concurrent(t *testing.T) {
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s := &Store[record]{Dir: dir}
+			for range 20 {
+				if _, err := s.Update("alice", func(r *record) error {
+					r.Uses++
+					return nil
+				}); err != nil {
+					t.Errorf("update #error: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if r, err := (&Store[record]{Dir: dir}).Load("alice"); err != nil || r.Uses != 160 {
+		t.Fatalf("update #error: expected 160 uses, got %+v, %v", r, err)
+	}
+}
@@ -0,0 +1,140 @@
+package pam
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Style is the type of message that the conversation handler should display.
+type Style int
+
+// ReturnType is a status returned by PAM. All the errors returned by PAM
+// calls are of this type, and can be compared with the constants below.
+type ReturnType int
+
+// Item is a an PAM information type.
+type Item int
+
+// checkStringItem fails with ErrBadItem for the items which are not strings,
+// so that they are never misread or set to a string.
+func checkStringItem(i Item) error {
+	if i == FailDelay || i == XAuthData {
+		return fmt.Errorf("%v: %w: not a string", i, ErrBadItem)
+	}
+	return nil
+}
+
+// checkReadableItem fails with ErrBadItem for the authentication tokens,
+// which only the modules may read, as Linux-PAM does, rather than depending
+// on the implementation to reject them.
+func checkReadableItem(i Item) error {
+	if i == Authtok || i == Oldauthtok {
+		return fmt.Errorf("%v: %w: only readable by the modules", i, ErrBadItem)
+	}
+	return nil
+}
+
+// Flags are inputs to various PAM functions than be combined with a bitwise
+// or. Refer to the official PAM documentation for which flags are accepted
+// by which functions.
+type Flags int
+
+// Close terminates the transaction, releasing the PAM handle and the
+// conversation handler. Transactions not closed are terminated once they are
+// garbage collected, but long running applications should close them as soon
+// as they are done. Closing a transaction again has no effect, while the
+// other calls return ErrTransactionEnded. It returns ErrTransactionActive if
+// an operation of the transaction is running. It is End without flags.
+func (t *Transaction) Close() error {
+	return t.End(0)
+}
+
+// ConversationError returns the failure of the last conversation of the
+// last operation, if any, even if the module that started it recovered.
+func (t *Transaction) ConversationError() error {
+	if t.conversation == nil || t.conversation.err == nil {
+		return nil
+	}
+	return t.conversation.err
+}
+
+// Is reports whether the last status of the transaction matches target, so
+// that code still using the transaction as error can compare it with the
+// ReturnType values.
+func (t *Transaction) Is(target error) bool {
+	r, ok := target.(ReturnType)
+	return ok && r == ReturnType(t.status.Load())
+}
+
+// As sets target to the last status of the transaction if it is a
+// *ReturnType, as Is does, so that StatusOf and errors.As handle the
+// transactions still used as error as the ReturnType values.
+func (t *Transaction) As(target any) bool {
+	r, ok := target.(*ReturnType)
+	if ok {
+		*r = ReturnType(t.status.Load())
+	}
+	return ok
+}
+
+// Status returns the status of the last PAM call of the transaction.
+//
+// Deprecated: the last call may not be the one of the caller, such as when
+// the conversation handler or other goroutines make calls meanwhile. Use
+// StatusOf with the error returned by the call instead.
+func (t *Transaction) Status() ReturnType {
+	return ReturnType(t.status.Load())
+}
+
+// setStatus records s as the last status of the transaction, which the
+// cleanup passes to pam_end too.
+func (t *Transaction) setStatus(s ReturnType) {
+	t.status.Store(int32(s))
+	if t.endStatus != nil {
+		t.endStatus.Store(int32(s))
+	}
+}
+
+// StatusOf returns the status of the call that returned err: Success if err
+// is nil, the Status of a *ConvError rather than the one of its cause, the
+// ReturnType err wraps otherwise, or ErrSystem for the failures not coming
+// from PAM, such as ErrTransactionEnded.
+func StatusOf(err error) ReturnType {
+	if err == nil {
+		return Success
+	}
+	var convErr *ConvError
+	if errors.As(err, &convErr) && convErr.Status != Success {
+		return convErr.Status
+	}
+	var status ReturnType
+	if errors.As(err, &status) {
+		return status
+	}
+	return ErrSystem
+}
+
+// Err returns r as error, nil if r is Success, for the code turning the
+// statuses back into errors, such as the module handlers.
+func (r ReturnType) Err() error {
+	if r == Success {
+		return nil
+	}
+	return r
+}
+
+// ErrUnavailable is returned by Start and by the calls to PAM of the builds
+// without cgo, which have no libpam to call, see the package documentation.
+// It wraps ErrSystem.
+var ErrUnavailable = fmt.Errorf("%w: built without cgo", ErrSystem)
+
+// XAuth is the X authentication data of the XAuthData item, which the
+// display managers forward to the modules, such as pam_xauth.
+type XAuth struct {
+	// Name is the name of the authorization protocol, such as
+	// "MIT-MAGIC-COOKIE-1".
+	Name string
+	// Data is the authorization data, such as the cookie. It is binary,
+	// not NUL terminated text.
+	Data []byte
+}
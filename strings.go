@@ -0,0 +1,124 @@
+package pam
+
+import (
+	"fmt"
+	"strings"
+)
+
+var styleNames = map[Style]string{
+	PromptEchoOff: "PAM_PROMPT_ECHO_OFF",
+	PromptEchoOn:  "PAM_PROMPT_ECHO_ON",
+	ErrorMsg:      "PAM_ERROR_MSG",
+	TextInfo:      "PAM_TEXT_INFO",
+	BinaryPrompt:  "PAM_BINARY_PROMPT",
+	RadioType:     "PAM_RADIO_TYPE",
+}
+
+// String returns the name of the PAM constant of the style.
+func (s Style) String() string {
+	if name, ok := styleNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("Style(%d)", int(s))
+}
+
+var itemNames = map[Item]string{
+	Service:     "PAM_SERVICE",
+	User:        "PAM_USER",
+	Tty:         "PAM_TTY",
+	Rhost:       "PAM_RHOST",
+	Authtok:     "PAM_AUTHTOK",
+	Oldauthtok:  "PAM_OLDAUTHTOK",
+	Ruser:       "PAM_RUSER",
+	UserPrompt:  "PAM_USER_PROMPT",
+	FailDelay:   "PAM_FAIL_DELAY",
+	XDisplay:    "PAM_XDISPLAY",
+	XAuthData:   "PAM_XAUTHDATA",
+	AuthtokType: "PAM_AUTHTOK_TYPE",
+}
+
+// String returns the name of the PAM constant of the item.
+func (i Item) String() string {
+	if name, ok := itemNames[i]; ok {
+		return name
+	}
+	return fmt.Sprintf("Item(%d)", int(i))
+}
+
+var flagNames = []struct {
+	flag Flags
+	name string
+}{
+	{Silent, "Silent"},
+	{DisallowNullAuthtok, "DisallowNullAuthtok"},
+	{EstablishCred, "EstablishCred"},
+	{DeleteCred, "DeleteCred"},
+	{ReinitializeCred, "ReinitializeCred"},
+	{RefreshCred, "RefreshCred"},
+	{ChangeExpiredAuthtok, "ChangeExpiredAuthtok"},
+	{PrelimCheck, "PrelimCheck"},
+	{UpdateAuthtok, "UpdateAuthtok"},
+}
+
+// String returns the names of the flags separated by "|", such as
+// "Silent|DisallowNullAuthtok". Unknown bits are shown in hexadecimal.
+func (f Flags) String() string {
+	if f == 0 {
+		return "0"
+	}
+	var names []string
+	for _, n := range flagNames {
+		if f&n.flag != 0 {
+			names = append(names, n.name)
+			f &^= n.flag
+		}
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("0x%x", int(f)))
+	}
+	return strings.Join(names, "|")
+}
+
+var returnTypeNames = map[ReturnType]string{
+	Success:                "PAM_SUCCESS",
+	ErrOpen:                "PAM_OPEN_ERR",
+	ErrSymbol:              "PAM_SYMBOL_ERR",
+	ErrService:             "PAM_SERVICE_ERR",
+	ErrSystem:              "PAM_SYSTEM_ERR",
+	ErrBuf:                 "PAM_BUF_ERR",
+	ErrPermDenied:          "PAM_PERM_DENIED",
+	ErrAuth:                "PAM_AUTH_ERR",
+	ErrCredInsufficient:    "PAM_CRED_INSUFFICIENT",
+	ErrAuthinfoUnavail:     "PAM_AUTHINFO_UNAVAIL",
+	ErrUserUnknown:         "PAM_USER_UNKNOWN",
+	ErrMaxtries:            "PAM_MAXTRIES",
+	ErrNewAuthtokReqd:      "PAM_NEW_AUTHTOK_REQD",
+	ErrAcctExpired:         "PAM_ACCT_EXPIRED",
+	ErrSession:             "PAM_SESSION_ERR",
+	ErrCredUnavail:         "PAM_CRED_UNAVAIL",
+	ErrCredExpired:         "PAM_CRED_EXPIRED",
+	ErrCred:                "PAM_CRED_ERR",
+	ErrNoModuleData:        "PAM_NO_MODULE_DATA",
+	ErrConv:                "PAM_CONV_ERR",
+	ErrAuthtok:             "PAM_AUTHTOK_ERR",
+	ErrAuthtokRecovery:     "PAM_AUTHTOK_RECOVERY_ERR",
+	ErrAuthtokLockBusy:     "PAM_AUTHTOK_LOCK_BUSY",
+	ErrAuthtokDisableAging: "PAM_AUTHTOK_DISABLE_AGING",
+	ErrTryAgain:            "PAM_TRY_AGAIN",
+	ErrIgnore:              "PAM_IGNORE",
+	ErrAbort:               "PAM_ABORT",
+	ErrAuthtokExpired:      "PAM_AUTHTOK_EXPIRED",
+	ErrModuleUnknown:       "PAM_MODULE_UNKNOWN",
+	ErrBadItem:             "PAM_BAD_ITEM",
+	ErrConvAgain:           "PAM_CONV_AGAIN",
+	ErrIncomplete:          "PAM_INCOMPLETE",
+}
+
+// String returns the name of the PAM constant of the return type, while
+// Error returns its message.
+func (r ReturnType) String() string {
+	if name, ok := returnTypeNames[r]; ok {
+		return name
+	}
+	return fmt.Sprintf("ReturnType(%d)", int(r))
+}
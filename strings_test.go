@@ -0,0 +1,39 @@
+package pam
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestString(t *testing.T) {
+	tests := []struct {
+		value fmt.Stringer
+		want  string
+	}{
+		{PromptEchoOff, "PAM_PROMPT_ECHO_OFF"},
+		{TextInfo, "PAM_TEXT_INFO"},
+		{RadioType, "PAM_RADIO_TYPE"},
+		{Style(1234), "Style(1234)"},
+		{Tty, "PAM_TTY"},
+		{UserPrompt, "PAM_USER_PROMPT"},
+		{Item(1234), "Item(1234)"},
+		{Flags(0), "0"},
+		{Silent | DisallowNullAuthtok, "Silent|DisallowNullAuthtok"},
+		{EstablishCred, "EstablishCred"},
+		{Silent | 0x100000, "Silent|0x100000"},
+		{PrelimCheck, "PrelimCheck"},
+		{Success, "PAM_SUCCESS"},
+		{ErrNewAuthtokReqd, "PAM_NEW_AUTHTOK_REQD"},
+		{ReturnType(1234), "ReturnType(1234)"},
+	}
+	for _, tt := range tests {
+		if got := tt.value.String(); got != tt.want {
+			t.Fatalf("string #error: expected %q, got %q", tt.want, got)
+		}
+	}
+	for _, r := range returnTypes {
+		if _, ok := returnTypeNames[r]; !ok {
+			t.Fatalf("string #error: no name for %d", int(r))
+		}
+	}
+}
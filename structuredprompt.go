@@ -0,0 +1,205 @@
+package pam
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// The structured prompts are a convention for the modules asking for more
+// than a line of text, such as a list of fields or a choice, letting the
+// applications with a rich interface show them as forms while the others
+// still show plain text prompts.
+//
+// A structured prompt is a conversation message made of its plain text,
+// shown as is by the applications not knowing the convention, followed by
+// a line starting with StructuredPromptPrefix and holding the JSON encoding
+// of a StructuredPrompt:
+//
+//	Select the second factor
+//	pam-json:{"fields":[{"name":"method","kind":"choice","choices":[...]}]}
+//
+// The applications knowing the convention respond with StructuredPromptPrefix
+// followed by the JSON object of the values of the fields, by name, and the
+// others with a plain line of text, which is the value of the first field.
+// Since the JSON line is shown to the users of the latter, modules should
+// send structured prompts only to the applications setting the
+// StructuredPromptsEnv variable of the PAM environment.
+
+// StructuredPromptPrefix starts the JSON lines of the structured prompts and
+// of their responses.
+const StructuredPromptPrefix = "pam-json:"
+
+// StructuredPromptsEnv is the PAM environment variable the applications
+// supporting the structured prompts set to 1.
+const StructuredPromptsEnv = "PAM_STRUCTURED_PROMPTS"
+
+// ErrNotStructured is returned when decoding a message which is not a
+// structured prompt.
+var ErrNotStructured = errors.New("not a structured prompt")
+
+// FieldKind is the kind of the value of a field.
+type FieldKind string
+
+// Field kinds.
+const (
+	// FieldText is a line of text, shown as it is typed.
+	FieldText FieldKind = "text"
+	// FieldSecret is a line of text, hidden as it is typed.
+	FieldSecret FieldKind = "secret"
+	// FieldChoice is one of the values of the choices of the field.
+	FieldChoice FieldKind = "choice"
+)
+
+// StructuredPrompt is the structured request of a prompt.
+type StructuredPrompt struct {
+	// Fields are the values requested, at least one.
+	Fields []PromptField `json:"fields"`
+	// Hint is an additional explanation of the request, such as where to
+	// find the code asked for.
+	Hint string `json:"hint,omitempty"`
+}
+
+// PromptField is a value requested by a structured prompt.
+type PromptField struct {
+	Name  string `json:"name"`
+	Label string `json:"label,omitempty"`
+	// Kind is the kind of value, FieldText if empty.
+	Kind    FieldKind      `json:"kind,omitempty"`
+	Choices []PromptChoice `json:"choices,omitempty"`
+	Hint    string         `json:"hint,omitempty"`
+	// Optional is whether the value can be empty.
+	Optional bool `json:"optional,omitempty"`
+}
+
+// PromptChoice is one of the choices of a FieldChoice field.
+type PromptChoice struct {
+	Value string `json:"value"`
+	Label string `json:"label,omitempty"`
+}
+
+// validate checks the prompt is well formed.
+func (p *StructuredPrompt) validate() error {
+	if len(p.Fields) == 0 {
+		return errors.New("structured prompt without fields")
+	}
+	names := map[string]bool{}
+	for _, f := range p.Fields {
+		if f.Name == "" || names[f.Name] {
+			return fmt.Errorf("structured prompt with an empty or repeated field name %q", f.Name)
+		}
+		names[f.Name] = true
+		switch f.Kind {
+		case "", FieldText, FieldSecret:
+		case FieldChoice:
+			if len(f.Choices) == 0 {
+				return fmt.Errorf("choice field %q without choices", f.Name)
+			}
+		default:
+			return fmt.Errorf("field %q of unknown kind %q", f.Name, f.Kind)
+		}
+	}
+	return nil
+}
+
+// EncodeStructuredPrompt returns the message of the structured prompt p,
+// whose plain text is text, as sent by the modules.
+func EncodeStructuredPrompt(text string, p StructuredPrompt) (string, error) {
+	if err := p.validate(); err != nil {
+		return "", err
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return text + "\n" + StructuredPromptPrefix + string(data), nil
+}
+
+// IsStructuredPrompt returns whether msg is a structured prompt.
+func IsStructuredPrompt(msg string) bool {
+	_, line := splitStructured(msg)
+	return strings.HasPrefix(line, StructuredPromptPrefix)
+}
+
+// DecodeStructuredPrompt returns the plain text and the request of the
+// structured prompt msg, as received by the applications. It returns
+// ErrNotStructured if msg is a plain prompt, to be shown as it is.
+func DecodeStructuredPrompt(msg string) (string, *StructuredPrompt, error) {
+	text, line := splitStructured(msg)
+	data, ok := strings.CutPrefix(line, StructuredPromptPrefix)
+	if !ok {
+		return "", nil, ErrNotStructured
+	}
+	var p StructuredPrompt
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		return "", nil, fmt.Errorf("invalid structured prompt: %w", err)
+	}
+	if err := p.validate(); err != nil {
+		return "", nil, err
+	}
+	return text, &p, nil
+}
+
+// splitStructured splits msg at the start of its last line.
+func splitStructured(msg string) (text, line string) {
+	i := strings.LastIndexByte(msg, '\n')
+	if i < 0 {
+		return "", msg
+	}
+	return msg[:i], msg[i+1:]
+}
+
+// EncodeStructuredResponse returns the response of an application to a
+// structured prompt, given the values of its fields by name.
+func EncodeStructuredResponse(values map[string]string) (string, error) {
+	data, err := json.Marshal(values)
+	if err != nil {
+		return "", err
+	}
+	return StructuredPromptPrefix + string(data), nil
+}
+
+// DecodeStructuredResponse returns the values of the fields of p, by name,
+// given the response resp of the application, as received by the modules.
+// A plain response is the value of the first field, the others being empty.
+// The values of the choice fields can be the labels of the choices, and the
+// values missing from the response are empty: the response is rejected if
+// any is not valid for its field.
+func DecodeStructuredResponse(p StructuredPrompt, resp string) (map[string]string, error) {
+	values := map[string]string{}
+	if data, ok := strings.CutPrefix(resp, StructuredPromptPrefix); ok {
+		if err := json.Unmarshal([]byte(data), &values); err != nil {
+			return nil, fmt.Errorf("invalid structured response: %w", err)
+		}
+	} else if len(p.Fields) > 0 {
+		values[p.Fields[0].Name] = resp
+	}
+	for name := range values {
+		if !slices.ContainsFunc(p.Fields, func(f PromptField) bool { return f.Name == name }) {
+			return nil, fmt.Errorf("unknown field %q in the response", name)
+		}
+	}
+	for _, f := range p.Fields {
+		v := values[f.Name]
+		values[f.Name] = v
+		if v == "" {
+			if !f.Optional {
+				return nil, fmt.Errorf("missing value of field %q", f.Name)
+			}
+			continue
+		}
+		if f.Kind != FieldChoice {
+			continue
+		}
+		i := slices.IndexFunc(f.Choices, func(c PromptChoice) bool {
+			return c.Value == v || c.Label != "" && strings.EqualFold(c.Label, v)
+		})
+		if i < 0 {
+			return nil, fmt.Errorf("invalid choice %q of field %q", v, f.Name)
+		}
+		values[f.Name] = f.Choices[i].Value
+	}
+	return values, nil
+}
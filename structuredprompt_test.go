@@ -0,0 +1,85 @@
+package pam
+
+import (
+	"errors"
+	"maps"
+	"testing"
+)
+
+var testStructuredPrompt = StructuredPrompt{
+	Fields: []PromptField{
+		{Name: "method", Label: "Method", Kind: FieldChoice, Choices: []PromptChoice{
+			{Value: "totp", Label: "Authenticator app"},
+			{Value: "sms", Label: "Text message"},
+		}},
+		{Name: "remember", Label: "Remember this device", Optional: true},
+	},
+	Hint: "The code expires in 5 minutes",
+}
+
+func TestStructuredPrompt(t *testing.T) {
+	msg, err := EncodeStructuredPrompt("Second factor: ", testStructuredPrompt)
+	if err != nil {
+		t.Fatalf("encode #error: %v", err)
+	}
+	if !IsStructuredPrompt(msg) || IsStructuredPrompt("Password: ") {
+		t.Fatalf("detect #error: %q", msg)
+	}
+	text, p, err := DecodeStructuredPrompt(msg)
+	if err != nil {
+		t.Fatalf("decode #error: %v", err)
+	}
+	if text != "Second factor: " || len(p.Fields) != 2 || p.Fields[0].Choices[1].Value != "sms" ||
+		!p.Fields[1].Optional || p.Hint != testStructuredPrompt.Hint {
+		t.Fatalf("decode #error: got %q, %+v", text, p)
+	}
+
+	if _, _, err := DecodeStructuredPrompt("Password: "); !errors.Is(err, ErrNotStructured) {
+		t.Fatalf("decode #error: expected %v, got %v", ErrNotStructured, err)
+	}
+	for _, bad := range []string{
+		"x\n" + StructuredPromptPrefix + "{",
+		"x\n" + StructuredPromptPrefix + `{"fields":[]}`,
+		"x\n" + StructuredPromptPrefix + `{"fields":[{"name":"a"},{"name":"a"}]}`,
+		"x\n" + StructuredPromptPrefix + `{"fields":[{"name":"a","kind":"choice"}]}`,
+		"x\n" + StructuredPromptPrefix + `{"fields":[{"name":"a","kind":"slider"}]}`,
+	} {
+		if _, _, err := DecodeStructuredPrompt(bad); err == nil {
+			t.Fatalf("decode #error: %q: expected a failure", bad)
+		}
+	}
+	if _, err := EncodeStructuredPrompt("x", StructuredPrompt{}); err == nil {
+		t.Fatalf("encode #error: expected a failure")
+	}
+}
+
+func TestStructuredResponse(t *testing.T) {
+	resp, err := EncodeStructuredResponse(map[string]string{"method": "sms", "remember": "yes"})
+	if err != nil {
+		t.Fatalf("encode #error: %v", err)
+	}
+	for _, tt := range []struct {
+		resp     string
+		expected map[string]string
+	}{
+		{resp, map[string]string{"method": "sms", "remember": "yes"}},
+		{"totp", map[string]string{"method": "totp", "remember": ""}},
+		{"text message", map[string]string{"method": "sms", "remember": ""}},
+	} {
+		values, err := DecodeStructuredResponse(testStructuredPrompt, tt.resp)
+		if err != nil || !maps.Equal(values, tt.expected) {
+			t.Fatalf("decode #error: %q: expected %v, got %v, %v", tt.resp, tt.expected, values, err)
+		}
+	}
+	for _, bad := range []string{
+		"",
+		"email",
+		StructuredPromptPrefix + `{"method":"sms","other":"x"}`,
+		StructuredPromptPrefix + `{"remember":"yes"}`,
+		StructuredPromptPrefix + `[]`,
+	} {
+		if _, err := DecodeStructuredResponse(testStructuredPrompt, bad); err == nil {
+			t.Fatalf("decode #error: %q: expected a failure", bad)
+		}
+	}
+}
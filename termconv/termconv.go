@@ -0,0 +1,384 @@
+// Package termconv is a conversation handler for the applications using a
+// terminal, such as the command line tools authenticating their users, with
+// a theme defining how the prompts and the messages look: their prefixes,
+// colors and templates, the character echoed for the hidden responses and
+// the width the messages are wrapped at.
+//
+// It is the equivalent of misc_conv of libpam_misc, which can also fail the
+// prompts not answered in time or interrupted by SIGINT.
+package termconv
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/msteinert/pam"
+	"golang.org/x/sys/unix"
+	"golang.org/x/term"
+)
+
+// ErrInterrupted is returned when the user interrupts a hidden prompt with
+// Ctrl-C, or any prompt if the Handler catches SIGINT.
+var ErrInterrupted = errors.New("interrupted")
+
+// ErrTimeout is returned when the user does not respond to a prompt before
+// the timeout of the Handler.
+var ErrTimeout = errors.New("timed out waiting for the response")
+
+// pollInterval is how often the interruptions are checked while waiting for
+// the input.
+const pollInterval = 100 * time.Millisecond
+
+// ColorMode defines when the colors of a theme are used.
+type ColorMode int
+
+// Color modes.
+const (
+	// ColorAuto uses the colors if the output is a terminal and the
+	// NO_COLOR variable is not set.
+	ColorAuto ColorMode = iota
+	ColorAlways
+	ColorNever
+)
+
+// StyleTheme is the theme of the messages of a style.
+type StyleTheme struct {
+	// Prefix is written before the messages, such as "error: ".
+	Prefix string
+	// Color is the SGR parameters of the messages, such as "1;31" for
+	// bold red, none if empty.
+	Color string
+}
+
+// Theme defines how a Handler shows the prompts and the messages.
+type Theme struct {
+	// PromptEchoOn is also the theme of the RadioType questions.
+	PromptEchoOn, PromptEchoOff StyleTheme
+	ErrorMsg, TextInfo          StyleTheme
+	// Prompt, if not nil, formats the messages of the prompts, given
+	// a PromptData, before their prefix is added.
+	Prompt *template.Template
+	// Mask is echoed for each character typed at the prompts with the
+	// echo off, nothing if 0.
+	Mask rune
+	// Width is the width the ErrorMsg and TextInfo messages are wrapped
+	// at, in characters: the width of the terminal if 0, no wrapping if
+	// negative.
+	Width int
+	Color ColorMode
+}
+
+// PromptData is the data of the Prompt template of a Theme.
+type PromptData struct {
+	Style   pam.Style
+	Message string
+	// Echo is whether the response is echoed.
+	Echo bool
+}
+
+// Handler is a conversation handler reading the responses from a terminal.
+// Its zero value uses the standard input and outputs, with no theme. When
+// the input is not a terminal, the responses are read from its lines.
+type Handler struct {
+	// In is the input, os.Stdin if nil.
+	In *os.File
+	// Out receives the prompts and the TextInfo messages, os.Stdout if
+	// nil, and Err the ErrorMsg messages, os.Stderr if nil.
+	Out, Err io.Writer
+	Theme    Theme
+	// Timeout is the maximum time waited for the response to each
+	// prompt, none if 0. The prompts timing out fail with ErrTimeout.
+	Timeout time.Duration
+	// CatchInterrupt fails the prompts with ErrInterrupted when the
+	// process receives SIGINT while waiting for their response, as when
+	// the user presses Ctrl-C at a prompt with the echo on, instead of
+	// terminating the process.
+	CatchInterrupt bool
+
+	once   sync.Once
+	reader *bufio.Reader
+	// deadline and interrupt, if set, end the reads of the current
+	// prompt.
+	deadline  time.Time
+	interrupt chan os.Signal
+}
+
+// input reads the input of a handler, once it is readable before the end of
+// the current prompt.
+type input struct {
+	h *Handler
+}
+
+func (in input) Read(p []byte) (int, error) {
+	if err := in.h.wait(); err != nil {
+		return 0, err
+	}
+	return in.h.In.Read(p)
+}
+
+// wait waits for the input to be readable, failing once the deadline of the
+// prompt is reached or once it is interrupted.
+func (h *Handler) wait() error {
+	if h.deadline.IsZero() && h.interrupt == nil {
+		return nil
+	}
+	fds := []unix.PollFd{{Fd: int32(h.In.Fd()), Events: unix.POLLIN}}
+	for {
+		select {
+		case <-h.interrupt:
+			return ErrInterrupted
+		default:
+		}
+		// Poll blocks until the input is readable if negative.
+		timeout := time.Duration(-1)
+		if !h.deadline.IsZero() {
+			timeout = time.Until(h.deadline)
+			if timeout <= 0 {
+				return ErrTimeout
+			}
+		}
+		if h.interrupt != nil && (timeout < 0 || timeout > pollInterval) {
+			timeout = pollInterval
+		}
+		ms := -1
+		if timeout > 0 {
+			// Round up, so that the deadline is reached once poll
+			// returns.
+			ms = int((timeout + time.Millisecond - 1) / time.Millisecond)
+		}
+		n, err := unix.Poll(fds, ms)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			return nil
+		}
+	}
+}
+
+// watch sets the deadline of the prompt and catches SIGINT during it, as
+// configured, until the returned function is called.
+func (h *Handler) watch() (done func()) {
+	if h.Timeout > 0 {
+		h.deadline = time.Now().Add(h.Timeout)
+	}
+	if h.CatchInterrupt {
+		h.interrupt = make(chan os.Signal, 1)
+		signal.Notify(h.interrupt, os.Interrupt)
+	}
+	return func() {
+		if h.interrupt != nil {
+			signal.Stop(h.interrupt)
+		}
+		h.deadline, h.interrupt = time.Time{}, nil
+	}
+}
+
+func (h *Handler) init() {
+	h.once.Do(func() {
+		if h.In == nil {
+			h.In = os.Stdin
+		}
+		if h.Out == nil {
+			h.Out = os.Stdout
+		}
+		if h.Err == nil {
+			h.Err = os.Stderr
+		}
+		h.reader = bufio.NewReader(input{h})
+	})
+}
+
+// RespondPAM shows the messages and reads the responses to the prompts.
+func (h *Handler) RespondPAM(s pam.Style, msg string) (string, error) {
+	h.init()
+	switch s {
+	case pam.PromptEchoOn, pam.PromptEchoOff, pam.RadioType:
+		echo := s != pam.PromptEchoOff
+		st := h.Theme.PromptEchoOff
+		if echo {
+			st = h.Theme.PromptEchoOn
+		}
+		if h.Theme.Prompt != nil {
+			var b strings.Builder
+			if err := h.Theme.Prompt.Execute(&b, PromptData{s, msg, echo}); err != nil {
+				return "", err
+			}
+			msg = b.String()
+		}
+		if _, err := io.WriteString(h.Out, h.paint(h.Out, st, st.Prefix+msg)); err != nil {
+			return "", err
+		}
+		defer h.watch()()
+		fd := int(h.In.Fd())
+		if echo || !term.IsTerminal(fd) {
+			return h.readLine()
+		}
+		state, err := term.MakeRaw(fd)
+		if err != nil {
+			return "", err
+		}
+		defer term.Restore(fd, state)
+		return readHidden(h.reader, h.Out, h.Theme.Mask)
+	case pam.ErrorMsg:
+		return "", h.message(h.Err, h.Theme.ErrorMsg, msg)
+	case pam.TextInfo:
+		return "", h.message(h.Out, h.Theme.TextInfo, msg)
+	}
+	return "", fmt.Errorf("unexpected message style %v", s)
+}
+
+// readLine reads a line of the input, without its end.
+func (h *Handler) readLine() (string, error) {
+	line, err := h.reader.ReadString('\n')
+	if err != nil && (err != io.EOF || line == "") {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// message writes a message, wrapped and themed.
+func (h *Handler) message(w io.Writer, st StyleTheme, msg string) error {
+	width := h.Theme.Width
+	if width == 0 {
+		width = -1
+		if f, ok := w.(*os.File); ok {
+			if cols, _, err := term.GetSize(int(f.Fd())); err == nil {
+				width = cols
+			}
+		}
+	}
+	text := wrap(msg, width, st.Prefix)
+	_, err := io.WriteString(w, h.paint(w, st, text)+"\n")
+	return err
+}
+
+// paint colors text with the color of the theme of the style, if enabled
+// for w.
+func (h *Handler) paint(w io.Writer, st StyleTheme, text string) string {
+	if st.Color == "" || !h.colors(w) {
+		return text
+	}
+	return "\x1b[" + st.Color + "m" + text + "\x1b[0m"
+}
+
+func (h *Handler) colors(w io.Writer) bool {
+	switch h.Theme.Color {
+	case ColorAlways:
+		return true
+	case ColorNever:
+		return false
+	}
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	f, ok := w.(*os.File)
+	return ok && term.IsTerminal(int(f.Fd()))
+}
+
+// wrap wraps the lines of text at the width, in runes, after prefixing
+// it, indenting the following lines by the width of the prefix. The words
+// longer than a line are split.
+func wrap(text string, width int, prefix string) string {
+	if width <= 0 {
+		return prefix + text
+	}
+	indent := strings.Repeat(" ", utf8.RuneCountInString(prefix))
+	avail := max(width-len(indent), 1)
+	var b strings.Builder
+	for i, line := range strings.Split(text, "\n") {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		lead := prefix
+		if i > 0 {
+			lead = indent
+		}
+		col := 0
+		b.WriteString(lead)
+		for _, word := range strings.Fields(line) {
+			n := utf8.RuneCountInString(word)
+			if col > 0 && col+1+n > avail {
+				b.WriteString("\n" + indent)
+				col = 0
+			} else if col > 0 {
+				b.WriteString(" ")
+				col++
+			}
+			for n > avail-col {
+				// Split the word at the end of the line.
+				k := avail - col
+				head := string([]rune(word)[:k])
+				b.WriteString(head + "\n" + indent)
+				word, n, col = word[len(head):], n-k, 0
+			}
+			b.WriteString(word)
+			col += n
+		}
+	}
+	return b.String()
+}
+
+// readHidden reads a response from a terminal in raw mode, echoing mask for
+// each character if not 0. Backspace erases a character, Ctrl-U the whole
+// response and Ctrl-C interrupts the prompt.
+func readHidden(r io.RuneReader, w io.Writer, mask rune) (string, error) {
+	// The capacity avoids copies of the response left behind when growing.
+	buf := make([]rune, 0, 256)
+	defer func() { clear(buf[:cap(buf)]) }()
+	echo := func(s string) {
+		if mask != 0 {
+			io.WriteString(w, s)
+		}
+	}
+	const erase = "\b \b"
+	for {
+		c, _, err := r.ReadRune()
+		if err != nil {
+			io.WriteString(w, "\r\n")
+			if err == io.EOF && len(buf) > 0 {
+				return string(buf), nil
+			}
+			return "", err
+		}
+		switch c {
+		case '\r', '\n':
+			io.WriteString(w, "\r\n")
+			return string(buf), nil
+		case 3: // Ctrl-C
+			io.WriteString(w, "\r\n")
+			return "", ErrInterrupted
+		case 4: // Ctrl-D
+			if len(buf) == 0 {
+				io.WriteString(w, "\r\n")
+				return "", io.EOF
+			}
+		case 8, 127: // Backspace
+			if len(buf) > 0 {
+				buf = buf[:len(buf)-1]
+				echo(erase)
+			}
+		case 21: // Ctrl-U
+			echo(strings.Repeat(erase, len(buf)))
+			clear(buf)
+			buf = buf[:0]
+		default:
+			if c >= ' ' {
+				buf = append(buf, c)
+				echo(string(mask))
+			}
+		}
+	}
+}
@@ -0,0 +1,147 @@
+package termconv
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"syscall"
+	"testing"
+	"text/template"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+func TestWrap(t *testing.T) {
+	for _, tt := range []struct {
+		text, prefix string
+		width        int
+		expected     string
+	}{
+		{"short", "", 10, "short"},
+		{"the quick brown fox", "", 10, "the quick\nbrown fox"},
+		{"the quick brown fox", "> ", 12, "> the quick\n  brown fox"},
+		{"abcdefghijkl", "", 5, "abcde\nfghij\nkl"},
+		{"one\ntwo three", "! ", 8, "! one\n  two\n  three"},
+		{"no wrapping at all", "", -1, "no wrapping at all"},
+		{"àèìòù àèìòù", "", 5, "àèìòù\nàèìòù"},
+	} {
+		if s := wrap(tt.text, tt.width, tt.prefix); s != tt.expected {
+			t.Fatalf("wrap #error: %q at %d: expected %q, got %q", tt.text, tt.width, tt.expected, s)
+		}
+	}
+}
+
+func TestReadHidden(t *testing.T) {
+	for _, tt := range []struct {
+		input    string
+		mask     rune
+		expected string
+		echo     string
+		err      error
+	}{
+		{"secret\r", 0, "secret", "\r\n", nil},
+		{"secret\r", '*', "secret", "******\r\n", nil},
+		{"secx\x7fret\n", '*', "secret", "****\b \b***\r\n", nil},
+		{"wrong\x15ok\r", '•', "ok", "•••••" + strings.Repeat("\b \b", 5) + "••\r\n", nil},
+		{"sec\x03", 0, "", "\r\n", ErrInterrupted},
+		{"\x04", 0, "", "\r\n", io.EOF},
+	} {
+		var out bytes.Buffer
+		s, err := readHidden(strings.NewReader(tt.input), &out, tt.mask)
+		if s != tt.expected || !errors.Is(err, tt.err) || out.String() != tt.echo {
+			t.Fatalf("read #error: %q: expected %q, %v, echo %q, got %q, %v, echo %q",
+				tt.input, tt.expected, tt.err, tt.echo, s, err, out.String())
+		}
+	}
+}
+
+func TestHandler(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe #error: %v", err)
+	}
+	defer r.Close()
+	io.WriteString(w, "alice\nsecret\r\n")
+	w.Close()
+
+	var out, errOut bytes.Buffer
+	h := &Handler{
+		In:  r,
+		Out: &out,
+		Err: &errOut,
+		Theme: Theme{
+			PromptEchoOn: StyleTheme{Color: "1"},
+			ErrorMsg:     StyleTheme{Prefix: "error: ", Color: "31"},
+			TextInfo:     StyleTheme{Prefix: "acme: "},
+			Prompt:       template.Must(template.New("").Parse("[acme] {{.Message}}")),
+			Width:        22,
+			Color:        ColorAlways,
+		},
+	}
+	for _, tt := range []struct {
+		style    pam.Style
+		msg      string
+		expected string
+	}{
+		{pam.PromptEchoOn, "login: ", "alice"},
+		{pam.PromptEchoOff, "Password: ", "secret"},
+		{pam.TextInfo, "Welcome to the acme server", ""},
+		{pam.ErrorMsg, "Authentication failure", ""},
+	} {
+		resp, err := h.RespondPAM(tt.style, tt.msg)
+		if err != nil || resp != tt.expected {
+			t.Fatalf("respond #error: %q: expected %q, got %q, %v", tt.msg, tt.expected, resp, err)
+		}
+	}
+	expected := "\x1b[1m[acme] login: \x1b[0m[acme] Password: acme: Welcome to the\n      acme server\n"
+	if out.String() != expected {
+		t.Fatalf("respond #error: expected output %q, got %q", expected, out.String())
+	}
+	expected = "\x1b[31merror: Authentication\n       failure\x1b[0m\n"
+	if errOut.String() != expected {
+		t.Fatalf("respond #error: expected error output %q, got %q", expected, errOut.String())
+	}
+	if _, err := h.RespondPAM(pam.PromptEchoOn, "more: "); err != io.EOF {
+		t.Fatalf("respond #error: expected %v, got %v", io.EOF, err)
+	}
+}
+
+func TestHandler_Timeout(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe #error: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+	h := &Handler{In: r, Out: io.Discard, Timeout: 50 * time.Millisecond}
+	if _, err := h.RespondPAM(pam.PromptEchoOn, "login: "); !errors.Is(err, ErrTimeout) {
+		t.Fatalf("respond #error: expected %v, got %v", ErrTimeout, err)
+	}
+	io.WriteString(w, "alice\nyes\n")
+	if resp, err := h.RespondPAM(pam.PromptEchoOn, "login: "); err != nil || resp != "alice" {
+		t.Fatalf("respond #error: expected alice, got %q, %v", resp, err)
+	}
+	if resp, err := h.RespondPAM(pam.RadioType, "Trust this device? (yes/no) "); err != nil || resp != "yes" {
+		t.Fatalf("respond #error: expected yes, got %q, %v", resp, err)
+	}
+}
+
+func TestHandler_CatchInterrupt(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatalf("pipe #error: %v", err)
+	}
+	defer r.Close()
+	defer w.Close()
+	h := &Handler{In: r, Out: io.Discard, CatchInterrupt: true}
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		syscall.Kill(os.Getpid(), syscall.SIGINT)
+	}()
+	if _, err := h.RespondPAM(pam.PromptEchoOn, "login: "); !errors.Is(err, ErrInterrupted) {
+		t.Fatalf("respond #error: expected %v, got %v", ErrInterrupted, err)
+	}
+}
@@ -0,0 +1,243 @@
+//go:build cgo
+
+package pam
+
+//#include <pthread.h>
+import "C"
+
+import (
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// lockedThread is a goroutine locked to its OS thread, which runs the calls
+// to libpam of the transactions started WithLockedThread, and so their
+// conversations too.
+type lockedThread struct {
+	id    C.pthread_t
+	calls chan func()
+	quit  chan struct{}
+	once  sync.Once
+	// handler is the thread of the conversation handler the thread waits
+	// for, if any, see runHandler.
+	handler atomic.Pointer[handlerThread]
+}
+
+// handlerThread is the OS thread a conversation handler runs on, in a
+// goroutine, while the locked thread waits for it in the conversation: the
+// locked thread runs the calls the handler makes in the meantime, as it
+// does for the handlers running on it, rather than queuing them after the
+// operation waiting for the handler.
+type handlerThread struct {
+	id    C.pthread_t
+	calls chan func()
+	// done is closed once the locked thread stopped waiting for the
+	// handler.
+	done chan struct{}
+}
+
+// newLockedThread starts a locked thread. It runs until stopped, then its OS
+// thread exits with it rather than being reused with the state the modules
+// left.
+func newLockedThread() *lockedThread {
+	t := &lockedThread{calls: make(chan func()), quit: make(chan struct{})}
+	ready := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		t.id = C.pthread_self()
+		close(ready)
+		for {
+			select {
+			case f := <-t.calls:
+				f()
+			case <-t.quit:
+				return
+			}
+		}
+	}()
+	<-ready
+	return t
+}
+
+// current returns whether the caller runs on the thread, as the
+// conversation handlers do.
+func (t *lockedThread) current() bool {
+	return C.pthread_equal(C.pthread_self(), t.id) != 0
+}
+
+// divert runs f on the thread, waiting for the call running there, if any,
+// and returns true. It returns false without running f if t is nil, if the
+// caller already runs on the thread, or if the thread is stopped, for the
+// caller to run f itself. Panics are raised again in the caller.
+func (t *lockedThread) divert(f func()) bool {
+	if t == nil || t.current() {
+		return false
+	}
+	done := make(chan any, 1)
+	call := func() {
+		defer func() {
+			done <- recover()
+		}()
+		f()
+	}
+	if !t.send(call) {
+		return false
+	}
+	if p := <-done; p != nil {
+		panic(p)
+	}
+	return true
+}
+
+// send sends call to the thread, returning false if it is stopped. The
+// calls of the handler the thread waits for are run at once, and those of
+// the other goroutines once the running call returns.
+func (t *lockedThread) send(call func()) bool {
+	if h := t.handler.Load(); h != nil && C.pthread_equal(C.pthread_self(), h.id) != 0 {
+		select {
+		case h.calls <- call:
+			return true
+		case <-h.done:
+			// The handler was abandoned, as when its conversation
+			// timed out: its calls wait as the others.
+		}
+	}
+	select {
+	case t.calls <- call:
+		return true
+	case <-t.quit:
+		return false
+	}
+}
+
+// runHandler runs the conversation handler f in a goroutine locked to its
+// OS thread, so that its calls are told from those of the other goroutines.
+// Until stop is called, once the thread stops waiting for f, they are sent
+// to calls, for the thread to run them.
+func (t *lockedThread) runHandler(f func()) (calls <-chan func(), stop func()) {
+	h := &handlerThread{calls: make(chan func()), done: make(chan struct{})}
+	ready, registered := make(chan struct{}), make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		h.id = C.pthread_self()
+		close(ready)
+		<-registered
+		f()
+	}()
+	<-ready
+	// The handlers of nested conversations are restored once done.
+	prev := t.handler.Swap(h)
+	close(registered)
+	return h.calls, func() {
+		t.handler.Store(prev)
+		close(h.done)
+	}
+}
+
+// diverted runs f on the thread as divert does, returning its result. The
+// calls on the hot paths check that there is a thread first, as the closures
+// passed escape to the heap even when there is none.
+func diverted[T any](t *lockedThread, f func() T) (T, bool) {
+	var r T
+	ok := t.divert(func() { r = f() })
+	return r, ok
+}
+
+// diverted2 is diverted for the functions returning an error too.
+func diverted2[T any](t *lockedThread, f func() (T, error)) (T, error, bool) {
+	var r T
+	var err error
+	ok := t.divert(func() { r, err = f() })
+	return r, err, ok
+}
+
+// run runs f on the thread, if any, or in the caller otherwise.
+func (t *lockedThread) run(f func()) {
+	if !t.divert(f) {
+		f()
+	}
+}
+
+// stop stops the thread once the call running there, if any, returns.
+// Stopping it again has no effect.
+func (t *lockedThread) stop() {
+	if t != nil {
+		t.once.Do(func() {
+			close(t.quit)
+		})
+	}
+}
+
+// abandonedHandlers are the OS threads of the conversation handlers still
+// running once abandoned by the conversations of a transaction without a
+// locked thread. Nothing orders their calls with those of the application
+// and of the modules, so they fail.
+type abandonedHandlers struct {
+	// n is the number of threads, so that the calls don't lock mu
+	// while there are none.
+	n   atomic.Int32
+	mu  sync.Mutex
+	ids []C.pthread_t
+}
+
+// runHandler runs the conversation handler f in a goroutine locked to its
+// OS thread, so that its calls can be told from the others once abandon is
+// called, until f returns.
+func (a *abandonedHandlers) runHandler(f func()) (abandon func()) {
+	var id C.pthread_t
+	var abandoned, returned bool
+	ready := make(chan struct{})
+	go func() {
+		runtime.LockOSThread()
+		defer runtime.UnlockOSThread()
+		id = C.pthread_self()
+		close(ready)
+		f()
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		returned = true
+		if abandoned {
+			i := slices.IndexFunc(a.ids, func(t C.pthread_t) bool {
+				return C.pthread_equal(t, id) != 0
+			})
+			a.ids = slices.Delete(a.ids, i, i+1)
+			a.n.Add(-1)
+		}
+	}()
+	<-ready
+	return func() {
+		a.mu.Lock()
+		defer a.mu.Unlock()
+		if !returned {
+			abandoned = true
+			a.ids = append(a.ids, id)
+			a.n.Add(1)
+		}
+	}
+}
+
+// current returns whether the caller runs in an abandoned handler.
+func (a *abandonedHandlers) current() bool {
+	if a.n.Load() == 0 {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	self := C.pthread_self()
+	return slices.ContainsFunc(a.ids, func(id C.pthread_t) bool {
+		return C.pthread_equal(id, self) != 0
+	})
+}
+
+// runHandler runs the conversation handler f as abandonedHandlers.runHandler
+// does, or just in a goroutine if s is nil.
+func (s *transactionState) runHandler(f func()) (abandon func()) {
+	if s == nil {
+		go f()
+		return func() {}
+	}
+	return s.abandoned.runHandler(f)
+}
@@ -0,0 +1,119 @@
+//go:build cgo
+
+package pam
+
+import (
+	"context"
+	"errors"
+	"os/user"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestWithLockedThread(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	var tx *Transaction
+	var calls int
+	handler := ConversationFunc(func(s Style, msg string) (string, error) {
+		calls++
+		if !tx.thread.current() {
+			return "", errors.New("conversation not on the locked thread")
+		}
+		// The calls of the handler nest in the running operation.
+		if _, err := tx.GetItem(User); err != nil {
+			return "", err
+		}
+		return "", nil
+	})
+	tx, err := StartWithOptions("echo-service", WithUser(u.Username),
+		WithConversationHandler(handler), WithConfDir("test-services"),
+		WithLockedThread(), WithTTY("pts/1"))
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	thread := tx.thread
+	if thread == nil || thread.current() {
+		t.Fatalf("start #error: no locked thread")
+	}
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := tx.Authenticate(0); err != nil {
+				t.Errorf("authenticate #error: %v", err)
+			}
+			if tty, err := tx.GetItem(Tty); err != nil || tty != "pts/1" {
+				t.Errorf("getitem #error: unexpected tty %q, %v", tty, err)
+			}
+		}()
+	}
+	wg.Wait()
+	if calls == 0 {
+		t.Fatalf("authenticate #error: the handler was not called")
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+	select {
+	case <-thread.quit:
+	default:
+		t.Fatalf("close #error: the locked thread is still running")
+	}
+	if err := tx.PutEnv("A=B"); !errors.Is(err, ErrTransactionEnded) {
+		t.Fatalf("putenv #error: expected %v, got %v", ErrTransactionEnded, err)
+	}
+}
+
+func TestLockedThread_Panic(t *testing.T) {
+	thread := newLockedThread()
+	defer thread.stop()
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Fatalf("divert #error: unexpected panic %v", p)
+		}
+	}()
+	thread.divert(func() { panic("boom") })
+}
+
+func TestWithLockedThread_Context(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	var tx *Transaction
+	var user string
+	handler := ConversationFunc(func(s Style, msg string) (string, error) {
+		// The handler runs in a goroutine, out of the locked thread,
+		// which runs its calls while waiting for it.
+		var err error
+		user, err = tx.GetItem(User)
+		return "", err
+	})
+	tx, err := StartWithOptions("echo-service", WithUser(u.Username),
+		WithConversationHandler(handler), WithConfDir("test-services"),
+		WithLockedThread())
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := tx.AuthenticateContext(ctx, 0); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Fatalf("authenticate #error: blocked for %v", d)
+	}
+	if err := tx.ConversationError(); err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if user != u.Username {
+		t.Fatalf("getitem #error: expected %q, got %q", u.Username, user)
+	}
+}
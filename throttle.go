@@ -0,0 +1,142 @@
+package pam
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// maxThrottleKeys is the number of keys above which a PromptThrottle drops
+// those whose failures are forgotten.
+const maxThrottleKeys = 4096
+
+// PromptThrottle limits how frequently the prompts are sent after failures,
+// by key, such as the user and the remote host of the transactions: the
+// delay before the next prompt doubles with each consecutive failure. It
+// defends the modules against the applications looping over their
+// conversations to guess the passwords faster than the failures allow.
+//
+// A PromptThrottle can be used by multiple goroutines at the same time.
+type PromptThrottle struct {
+	// Delay is the delay after the first failure, 1 second if not set.
+	Delay time.Duration
+	// MaxDelay is the maximum delay, 1 minute if not set.
+	MaxDelay time.Duration
+	// Reset is the time after the last failure when the failures of a
+	// key are forgotten, 15 minutes if not set.
+	Reset time.Duration
+	// Now returns the current time, time.Now if not set.
+	Now func() time.Time
+
+	mu   sync.Mutex
+	keys map[string]*throttleState
+}
+
+// throttleState are the failures of a key.
+type throttleState struct {
+	failures int
+	last     time.Time
+	delay    time.Duration
+}
+
+// ThrottleKey returns the key of the prompts of user from rhost.
+func ThrottleKey(user, rhost string) string {
+	return user + "\x00" + rhost
+}
+
+func (t *PromptThrottle) now() time.Time {
+	if t.Now != nil {
+		return t.Now()
+	}
+	return time.Now()
+}
+
+func (t *PromptThrottle) reset() time.Duration {
+	if t.Reset <= 0 {
+		return 15 * time.Minute
+	}
+	return t.Reset
+}
+
+// state returns the failures of key, nil if there are none or they are
+// forgotten.
+func (t *PromptThrottle) state(key string, now time.Time) *throttleState {
+	s := t.keys[key]
+	if s != nil && now.Sub(s.last) >= t.reset() {
+		delete(t.keys, key)
+		return nil
+	}
+	return s
+}
+
+// Failure records a failure for key and returns the delay before its next
+// prompt, which modules can also request with FailDelay.
+func (t *PromptThrottle) Failure(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	if t.keys == nil {
+		t.keys = map[string]*throttleState{}
+	}
+	s := t.state(key, now)
+	if s == nil {
+		if len(t.keys) >= maxThrottleKeys {
+			for k := range t.keys {
+				t.state(k, now)
+			}
+		}
+		s = &throttleState{}
+		t.keys[key] = s
+	}
+	delay, maxDelay := t.Delay, t.MaxDelay
+	if delay <= 0 {
+		delay = time.Second
+	}
+	if maxDelay <= 0 {
+		maxDelay = time.Minute
+	}
+	for i := 0; i < s.failures && delay < maxDelay; i++ {
+		delay *= 2
+	}
+	s.failures++
+	s.last, s.delay = now, min(delay, maxDelay)
+	return s.delay
+}
+
+// Success forgets the failures of key.
+func (t *PromptThrottle) Success(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.keys, key)
+}
+
+// Remaining returns the time left before a prompt is allowed for key.
+func (t *PromptThrottle) Remaining(key string) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	now := t.now()
+	s := t.state(key, now)
+	if s == nil {
+		return 0
+	}
+	return max(s.last.Add(s.delay).Sub(now), 0)
+}
+
+// Wait waits until a prompt is allowed for key, unless ctx is done before.
+func (t *PromptThrottle) Wait(ctx context.Context, key string) error {
+	return sleep(ctx, t.Remaining(key))
+}
+
+// Handler returns a conversation handler sending the prompts to h once they
+// are allowed for key, or failing once ctx is done. The other messages are
+// sent without delay.
+func (t *PromptThrottle) Handler(ctx context.Context, key string, h ConversationHandler) ConversationHandler {
+	return ConversationFunc(func(s Style, msg string) (string, error) {
+		if s == PromptEchoOff || s == PromptEchoOn || s == RadioType {
+			if err := t.Wait(ctx, key); err != nil {
+				return "", err
+			}
+		}
+		return h.RespondPAM(s, msg)
+	})
+}
@@ -0,0 +1,90 @@
+package pam
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestPromptThrottle(t *testing.T) {
+	now := time.Unix(0, 0)
+	th := &PromptThrottle{MaxDelay: 5 * time.Second, Now: func() time.Time { return now }}
+	key := ThrottleKey("test", "example.com")
+	for _, expected := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second} {
+		if d := th.Failure(key); d != expected {
+			t.Fatalf("failure #error: expected %v, got %v", expected, d)
+		}
+	}
+	if d := th.Remaining(ThrottleKey("test", "other")); d != 0 {
+		t.Fatalf("remaining #error: expected no delay for another host, got %v", d)
+	}
+	now = now.Add(2 * time.Second)
+	if d := th.Remaining(key); d != 3*time.Second {
+		t.Fatalf("remaining #error: expected 3s, got %v", d)
+	}
+	now = now.Add(15 * time.Minute)
+	if d := th.Failure(key); d != time.Second {
+		t.Fatalf("failure #error: expected the failures forgotten, got %v", d)
+	}
+	th.Success(key)
+	if d := th.Remaining(key); d != 0 {
+		t.Fatalf("remaining #error: expected no delay after a success, got %v", d)
+	}
+}
+
+func TestPromptThrottle_Handler(t *testing.T) {
+	th := &PromptThrottle{Delay: 50 * time.Millisecond}
+	prompts := 0
+	h := th.Handler(context.Background(), "test", ConversationFunc(func(s Style, msg string) (string, error) {
+		prompts++
+		return "secret", nil
+	}))
+	th.Failure("test")
+	start := time.Now()
+	if _, err := h.RespondPAM(TextInfo, "info"); err != nil || time.Since(start) >= 50*time.Millisecond {
+		t.Fatalf("respond #error: expected no delay for messages, got %v", err)
+	}
+	if _, err := h.RespondPAM(PromptEchoOff, "Password: "); err != nil || time.Since(start) < 40*time.Millisecond {
+		t.Fatalf("respond #error: expected a delayed prompt, got %v after %v", err, time.Since(start))
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	th.Failure("test")
+	h = th.Handler(ctx, "test", ConversationFunc(func(s Style, msg string) (string, error) {
+		prompts++
+		return "secret", nil
+	}))
+	if _, err := h.RespondPAM(PromptEchoOff, "Password: "); !errors.Is(err, context.Canceled) {
+		t.Fatalf("respond #error: expected %v, got %v", context.Canceled, err)
+	}
+	if prompts != 2 {
+		t.Fatalf("respond #error: expected 2 messages, got %d", prompts)
+	}
+}
+
+func TestTransaction_FailDelay(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	if !CheckPamHasFailDelay() {
+		t.Skip("pam_fail_delay is not available")
+	}
+	tx, err := StartConfDir("deny-service", "test", Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	if err := tx.FailDelay(400 * time.Millisecond); err != nil {
+		t.Fatalf("faildelay #error: %v", err)
+	}
+	start := time.Now()
+	if err := tx.Authenticate(0); !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrAuth, err)
+	}
+	// libpam randomizes the delay around the requested one.
+	if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+		t.Fatalf("authenticate #error: expected a delay, got %v", elapsed)
+	}
+}
@@ -0,0 +1,259 @@
+// Package timeaccess restricts the times the users can log in at, as
+// pam_time does, for the account modules written in Go: rules select the
+// transactions by service, terminal and user, and allow them within time
+// windows only.
+//
+//	policy := timeaccess.Policy{Rules: []timeaccess.Rule{{
+//		Services: []string{"sshd"},
+//		Windows:  timeaccess.MustParseWindows("Wk0800-1800"),
+//	}}}
+//	if msg, err := policy.Check(service, tty, user); err != nil {
+//		// Send msg as an ErrorMsg message, unless Silent.
+//		return err
+//	}
+package timeaccess
+
+import (
+	"fmt"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// Days is a set of days of the week.
+type Days uint8
+
+// Has returns whether d includes the day.
+func (d Days) Has(day time.Weekday) bool {
+	return d&(1<<day) != 0
+}
+
+// Day sets.
+const (
+	Weekdays Days = 1<<time.Monday | 1<<time.Tuesday | 1<<time.Wednesday |
+		1<<time.Thursday | 1<<time.Friday
+	Weekend Days = 1<<time.Saturday | 1<<time.Sunday
+	AllDays      = Weekdays | Weekend
+)
+
+// dayCodes are the codes of the days in the windows, as in pam_time.
+var dayCodes = []string{"Su", "Mo", "Tu", "We", "Th", "Fr", "Sa"}
+
+func (d Days) String() string {
+	switch d {
+	case AllDays:
+		return "Al"
+	case Weekdays:
+		return "Wk"
+	case Weekend:
+		return "Wd"
+	}
+	var b strings.Builder
+	for day := time.Monday; day <= time.Saturday+1; day++ {
+		if d.Has(day % 7) {
+			b.WriteString(dayCodes[day%7])
+		}
+	}
+	return b.String()
+}
+
+// Window is a time range of some days of the week. The windows ending
+// before they start span midnight, ending on the next day.
+type Window struct {
+	Days Days
+	// Start and End are the times of the day the window starts and ends
+	// at, since midnight. The windows whose Start and End are equal
+	// cover the whole days.
+	Start, End time.Duration
+}
+
+// ParseWindow parses a window in the syntax of pam_time: day codes (Mo, Tu,
+// We, Th, Fr, Sa, Su, Wk for the weekdays, Wd for the weekend and Al for all
+// days) followed by a range of times, such as MoTuWe0800-1730 or
+// Fr2200-0200. Repeating a code removes its days, so AlFr is every day but
+// Friday, as in pam_time.
+func ParseWindow(s string) (Window, error) {
+	var w Window
+	rest := s
+	for len(rest) >= 2 && !isDigit(rest[0]) {
+		var days Days
+		switch code := rest[:2]; code {
+		case "Al":
+			days = AllDays
+		case "Wk":
+			days = Weekdays
+		case "Wd":
+			days = Weekend
+		default:
+			i := slices.Index(dayCodes, code)
+			if i < 0 {
+				return Window{}, fmt.Errorf("invalid day %q in window %q", code, s)
+			}
+			days = 1 << i
+		}
+		w.Days ^= days
+		rest = rest[2:]
+	}
+	if w.Days == 0 {
+		return Window{}, fmt.Errorf("no days in window %q", s)
+	}
+	start, end, ok := strings.Cut(rest, "-")
+	if !ok {
+		return Window{}, fmt.Errorf("invalid time range in window %q", s)
+	}
+	var err error
+	if w.Start, err = parseTime(start); err != nil {
+		return Window{}, fmt.Errorf("window %q: %w", s, err)
+	}
+	if w.End, err = parseTime(end); err != nil {
+		return Window{}, fmt.Errorf("window %q: %w", s, err)
+	}
+	return w, nil
+}
+
+// ParseWindows parses the windows.
+func ParseWindows(s ...string) ([]Window, error) {
+	windows := make([]Window, 0, len(s))
+	for _, text := range s {
+		w, err := ParseWindow(text)
+		if err != nil {
+			return nil, err
+		}
+		windows = append(windows, w)
+	}
+	return windows, nil
+}
+
+// MustParseWindows is like ParseWindows, but panics on failure.
+func MustParseWindows(s ...string) []Window {
+	windows, err := ParseWindows(s...)
+	if err != nil {
+		panic(err)
+	}
+	return windows
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// parseTime parses a HHMM time.
+func parseTime(s string) (time.Duration, error) {
+	if len(s) != 4 || !isDigit(s[0]) || !isDigit(s[1]) || !isDigit(s[2]) || !isDigit(s[3]) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	h := int(s[0]-'0')*10 + int(s[1]-'0')
+	m := int(s[2]-'0')*10 + int(s[3]-'0')
+	if h > 24 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+func (w Window) String() string {
+	format := func(d time.Duration) string {
+		return fmt.Sprintf("%02d%02d", int(d/time.Hour), int(d%time.Hour/time.Minute))
+	}
+	return w.Days.String() + format(w.Start) + "-" + format(w.End)
+}
+
+// Contains returns whether the window contains the time, in its location.
+func (w Window) Contains(t time.Time) bool {
+	h, m, s := t.Clock()
+	tod := time.Duration(h)*time.Hour + time.Duration(m)*time.Minute + time.Duration(s)*time.Second
+	day, yesterday := t.Weekday(), (t.Weekday()+6)%7
+	switch {
+	case w.Start == w.End:
+		return w.Days.Has(day)
+	case w.Start < w.End:
+		return w.Days.Has(day) && tod >= w.Start && tod < w.End
+	}
+	return (w.Days.Has(day) && tod >= w.Start) || (w.Days.Has(yesterday) && tod < w.End)
+}
+
+// Rule allows the transactions it selects within its windows only.
+type Rule struct {
+	// Services, Ttys and Users are the patterns, as in path.Match, of the
+	// services, terminals and users of the transactions the rule selects.
+	// Empty lists select all of them.
+	Services, Ttys, Users []string
+	// Windows are the windows of the allowed times. A rule without
+	// windows denies the transactions it selects.
+	Windows []Window
+	// Location is the time zone of the windows, the local one if nil.
+	Location *time.Location
+}
+
+func matchAny(patterns []string, s string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+	return slices.ContainsFunc(patterns, func(p string) bool {
+		ok, _ := path.Match(p, s)
+		return ok
+	})
+}
+
+// Selects returns whether the rule selects the transaction.
+func (r *Rule) Selects(service, tty, user string) bool {
+	return matchAny(r.Services, service) && matchAny(r.Ttys, tty) && matchAny(r.Users, user)
+}
+
+// Allows returns whether the rule allows the time.
+func (r *Rule) Allows(t time.Time) bool {
+	if r.Location != nil {
+		t = t.In(r.Location)
+	} else {
+		t = t.Local()
+	}
+	return slices.ContainsFunc(r.Windows, func(w Window) bool {
+		return w.Contains(t)
+	})
+}
+
+// Message returns the message explaining to the users when the rule allows
+// them to log in.
+func (r *Rule) Message() string {
+	if len(r.Windows) == 0 {
+		return "Login is not allowed."
+	}
+	windows := make([]string, len(r.Windows))
+	for i, w := range r.Windows {
+		windows[i] = w.String()
+	}
+	zone := time.Local.String()
+	if r.Location != nil {
+		zone = r.Location.String()
+	}
+	return fmt.Sprintf("Login is not allowed at this time. Allowed times: %s (%s).",
+		strings.Join(windows, ", "), zone)
+}
+
+// Policy restricts the login times with its rules: the transactions are
+// allowed if all the rules selecting them allow the current time.
+type Policy struct {
+	Rules []Rule
+	// Now returns the current time, time.Now if not set.
+	Now func() time.Time
+}
+
+// Check checks the transaction of user on the service and the terminal
+// tty. If a rule denies it, it returns pam.ErrPermDenied and the message to
+// send to the user.
+func (p *Policy) Check(service, tty, user string) (msg string, err error) {
+	now := time.Now()
+	if p.Now != nil {
+		now = p.Now()
+	}
+	for i := range p.Rules {
+		r := &p.Rules[i]
+		if r.Selects(service, tty, user) && !r.Allows(now) {
+			return r.Message(), fmt.Errorf("%w: login time restricted for %q on %q",
+				pam.ErrPermDenied, user, service)
+		}
+	}
+	return "", nil
+}
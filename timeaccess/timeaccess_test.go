@@ -0,0 +1,98 @@
+package timeaccess
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+func TestParseWindow(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Wk0800-1800", "Wk0800-1800"},
+		{"MoTuWeThFr0800-1800", "Wk0800-1800"},
+		{"AlFr0000-2400", "MoTuWeThSaSu0000-2400"},
+		{"SaSu2200-0600", "Wd2200-0600"},
+		{"Th0930-1015", "Th0930-1015"},
+	}
+	for _, tc := range tests {
+		w, err := ParseWindow(tc.in)
+		if err != nil || w.String() != tc.want {
+			t.Fatalf("parse #error: %q: got %q, %v, expected %q", tc.in, w, err, tc.want)
+		}
+	}
+	for _, bad := range []string{"", "0800-1800", "Xx0800-1800", "Mo0800", "Mo2500-0100", "Mo0860-0900", "Mo800-900", "MoMo0800-0900"} {
+		if _, err := ParseWindow(bad); err == nil {
+			t.Fatalf("parse #error: %q: expected a failure", bad)
+		}
+	}
+}
+
+func TestWindow_Contains(t *testing.T) {
+	// 2024-01-05 is a Friday.
+	at := func(day int, hhmm string) time.Time {
+		tod, _ := parseTime(hhmm)
+		return time.Date(2024, 1, day, 0, 0, 0, 0, time.UTC).Add(tod)
+	}
+	tests := []struct {
+		window string
+		t      time.Time
+		want   bool
+	}{
+		{"Wk0800-1800", at(5, "0800"), true},
+		{"Wk0800-1800", at(5, "1800"), false},
+		{"Wk0800-1800", at(6, "1000"), false},
+		{"Fr2200-0200", at(5, "2300"), true},
+		{"Fr2200-0200", at(6, "0100"), true},
+		{"Fr2200-0200", at(6, "0200"), false},
+		{"Fr2200-0200", at(5, "0100"), false},
+		{"Sa0000-0000", at(6, "2359"), true},
+	}
+	for _, tc := range tests {
+		w, err := ParseWindow(tc.window)
+		if err != nil {
+			t.Fatalf("parse #error: %v", err)
+		}
+		if got := w.Contains(tc.t); got != tc.want {
+			t.Fatalf("contains #error: %s at %v: got %v", tc.window, tc.t, got)
+		}
+	}
+}
+
+func TestPolicy_Check(t *testing.T) {
+	rome, err := time.LoadLocation("Europe/Rome")
+	if err != nil {
+		t.Skipf("time zone data not available: %v", err)
+	}
+	// 07:30 UTC is 08:30 in Rome, on a Friday.
+	now := time.Date(2024, 1, 5, 7, 30, 0, 0, time.UTC)
+	p := &Policy{
+		Now: func() time.Time { return now },
+		Rules: []Rule{
+			{Services: []string{"sshd"}, Users: []string{"*"}, Windows: MustParseWindows("Wk0800-1800"), Location: rome},
+			{Ttys: []string{"tty*"}, Users: []string{"guest"}},
+		},
+	}
+	if msg, err := p.Check("sshd", "ssh", "alice"); err != nil {
+		t.Fatalf("check #error: %v, %q", err, msg)
+	}
+	if msg, err := p.Check("login", "tty1", "guest"); !errors.Is(err, pam.ErrPermDenied) || msg != "Login is not allowed." {
+		t.Fatalf("check #error: %v, %q", err, msg)
+	}
+
+	now = now.Add(10 * time.Hour)
+	msg, err := p.Check("sshd", "ssh", "alice")
+	if !errors.Is(err, pam.ErrPermDenied) {
+		t.Fatalf("check #error: %v", err)
+	}
+	if !strings.Contains(msg, "Wk0800-1800 (Europe/Rome)") {
+		t.Fatalf("check #error: message %q", msg)
+	}
+	if _, err := p.Check("login", "tty1", "alice"); err != nil {
+		t.Fatalf("check #error: %v", err)
+	}
+}
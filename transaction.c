@@ -9,41 +9,46 @@
 #define PAM_CONST const
 #endif
 
+// OpenPAM and Solaris may not define it.
+#ifndef PAM_MAX_NUM_MSG
+#define PAM_MAX_NUM_MSG 32
+#endif
+
 int cb_pam_conv(
 	int num_msg,
 	PAM_CONST struct pam_message **msg,
 	struct pam_response **resp,
 	void *appdata_ptr)
 {
-	*resp = calloc(num_msg, sizeof **resp);
 	if (num_msg <= 0 || num_msg > PAM_MAX_NUM_MSG) {
+		cbPAMConvInvalid(num_msg, (uintptr_t)appdata_ptr);
+		*resp = NULL;
 		return PAM_CONV_ERR;
 	}
+	*resp = calloc(num_msg, sizeof **resp);
 	if (!*resp) {
 		return PAM_BUF_ERR;
 	}
-	for (size_t i = 0; i < num_msg; ++i) {
-		struct cbPAMConv_return result = cbPAMConv(
-				msg[i]->msg_style,
-				(char *)msg[i]->msg,
-				(uintptr_t)appdata_ptr);
-		if (result.r1 != PAM_SUCCESS) {
-			goto error;
-		}
-		(*resp)[i].resp = result.r0;
-	}
-	return PAM_SUCCESS;
-error:
-	for (size_t i = 0; i < num_msg; ++i) {
-		if ((*resp)[i].resp) {
-			memset((*resp)[i].resp, 0, strlen((*resp)[i].resp));
-			free((*resp)[i].resp);
-		}
+	// On failure, the responses have already been wiped and released.
+	int ret = cbPAMConv(num_msg, (struct pam_message **)msg, *resp,
+			(uintptr_t)appdata_ptr);
+	if (ret != PAM_SUCCESS) {
+		free(*resp);
+		*resp = NULL;
 	}
-	memset(*resp, 0, num_msg * sizeof *resp);
-	free(*resp);
-	*resp = NULL;
-	return PAM_CONV_ERR;
+	return ret;
+}
+
+int call_pam_conv(const struct pam_conv *conv, int num_msg,
+	struct pam_message **msg, struct pam_response **resp)
+{
+	return conv->conv(num_msg, (PAM_CONST struct pam_message **)msg, resp,
+			conv->appdata_ptr);
+}
+
+void cb_pam_fail_delay(int retval, unsigned usec_delay, void *appdata_ptr)
+{
+	cbPAMFailDelay(retval, usec_delay, (uintptr_t)appdata_ptr);
 }
 
 void init_pam_conv(struct pam_conv *conv, uintptr_t appdata)
@@ -52,11 +57,25 @@ void init_pam_conv(struct pam_conv *conv, uintptr_t appdata)
 	conv->appdata_ptr = (void *)appdata;
 }
 
-// pam_start_confdir is a recent PAM api to declare a confdir (mostly for tests)
-// weaken the linking dependency to detect if it’s present.
-int pam_start_confdir(const char *service_name, const char *user, const struct pam_conv *pam_conversation, const char *confdir, pam_handle_t **pamh) __attribute__ ((weak));
-int check_pam_start_confdir(void) {
-	if (pam_start_confdir == NULL)
-		return 1;
-	return 0;
+void set_items(pam_handle_t *pamh, int n, const int *items,
+	const char **values, int *status)
+{
+	for (int i = 0; i < n; ++i) {
+		status[i] = pam_set_item(pamh, items[i], values[i]);
+	}
+}
+
+void get_items(pam_handle_t *pamh, int n, const int *items,
+	const char **values, int *status)
+{
+	for (int i = 0; i < n; ++i) {
+		status[i] = pam_get_item(pamh, items[i], (PAM_CONST void **)&values[i]);
+	}
+}
+
+void put_envs(pam_handle_t *pamh, int n, const char **entries, int *status)
+{
+	for (int i = 0; i < n; ++i) {
+		status[i] = pam_putenv(pamh, entries[i]);
+	}
 }
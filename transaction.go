@@ -1,35 +1,89 @@
-// Package pam provides a wrapper for the PAM application API.
+//go:build cgo
+
 package pam
 
 //#include <security/pam_appl.h>
+//#include <limits.h>
 //#include <stdlib.h>
 //#include <stdint.h>
+//#include <string.h>
 //#cgo CFLAGS: -Wall -std=c99
 //#cgo LDFLAGS: -lpam
 //void init_pam_conv(struct pam_conv *conv, uintptr_t);
-//int pam_start_confdir(const char *service_name, const char *user, const struct pam_conv *pam_conversation, const char *confdir, pam_handle_t **pamh) __attribute__ ((weak));
+//int call_pam_start_confdir(const char *service_name, const char *user, const struct pam_conv *pam_conversation, const char *confdir, pam_handle_t **pamh);
 //int check_pam_start_confdir(void);
+//int call_pam_fail_delay(pam_handle_t *pamh, unsigned int usec);
+//int check_pam_fail_delay(void);
+//int call_pam_conv(const struct pam_conv *conv, int num_msg, struct pam_message **msg, struct pam_response **resp);
 //
 //#ifdef PAM_BINARY_PROMPT
 //#define BINARY_PROMPT_IS_SUPPORTED 1
 //#else
-//#include <limits.h>
 //#define PAM_BINARY_PROMPT INT_MAX
 //#define BINARY_PROMPT_IS_SUPPORTED 0
 //#endif
+//
+//#ifndef PAM_RADIO_TYPE
+//#define PAM_RADIO_TYPE (INT_MAX - 1)
+//#endif
+//
+//// OpenPAM and Solaris may not define it.
+//#ifndef PAM_MAX_NUM_MSG
+//#define PAM_MAX_NUM_MSG 32
+//#endif
+//
+//// Linux-PAM extensions, never returned by other implementations.
+//#ifndef PAM_CONV_AGAIN
+//#define PAM_CONV_AGAIN (INT_MAX - 1)
+//#endif
+//#ifndef PAM_INCOMPLETE
+//#define PAM_INCOMPLETE (INT_MAX - 2)
+//#endif
+//#ifndef PAM_DATA_SILENT
+//#define PAM_DATA_SILENT 0
+//#endif
+//#ifndef PAM_PRELIM_CHECK
+//#define PAM_PRELIM_CHECK 0x4000
+//#endif
+//#ifndef PAM_UPDATE_AUTHTOK
+//#define PAM_UPDATE_AUTHTOK 0x2000
+//#endif
+//
+//// Linux-PAM items, rejected by the other implementations.
+//#ifndef PAM_FAIL_DELAY
+//#define PAM_FAIL_DELAY (INT_MAX - 1)
+//#endif
+//#ifndef PAM_XDISPLAY
+//#define PAM_XDISPLAY (INT_MAX - 2)
+//#endif
+//#ifndef PAM_XAUTHDATA
+//#define PAM_XAUTHDATA (INT_MAX - 3)
+//#endif
+//#ifndef PAM_AUTHTOK_TYPE
+//#define PAM_AUTHTOK_TYPE (INT_MAX - 4)
+//#endif
+//
+//// They neither retain their arguments nor call the conversation, so the Go
+//// memory passed to them can stay on the stack.
+//#cgo noescape pam_get_item
+//#cgo nocallback pam_get_item
+//#cgo noescape pam_getenv
+//#cgo nocallback pam_getenv
+//#cgo noescape pam_putenv
+//#cgo nocallback pam_putenv
 import "C"
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"math"
 	"runtime"
-	"runtime/cgo"
-	"strings"
+	"sync/atomic"
+	"time"
 	"unsafe"
 )
 
-// Style is the type of message that the conversation handler should display.
-type Style int
-
 // Coversation handler style types.
 const (
 	// PromptEchoOff indicates the conversation handler should obtain a
@@ -37,89 +91,368 @@ const (
 	PromptEchoOff Style = C.PAM_PROMPT_ECHO_OFF
 	// PromptEchoOn indicates the conversation handler should obtain a
 	// string while echoing text.
-	PromptEchoOn = C.PAM_PROMPT_ECHO_ON
+	PromptEchoOn Style = C.PAM_PROMPT_ECHO_ON
 	// ErrorMsg indicates the conversation handler should display an
 	// error message.
-	ErrorMsg = C.PAM_ERROR_MSG
+	ErrorMsg Style = C.PAM_ERROR_MSG
 	// TextInfo indicates the conversation handler should display some
 	// text.
-	TextInfo = C.PAM_TEXT_INFO
+	TextInfo Style = C.PAM_TEXT_INFO
+	// BinaryPrompt indicates the conversation handler should handle a
+	// binary message, whose format depends on the protocol in use. This is
+	// a Linux-PAM extension.
+	BinaryPrompt Style = C.PAM_BINARY_PROMPT
+	// RadioType indicates the conversation handler should obtain the
+	// answer to a question offering a few choices, listed in the
+	// message, such as yes or no. The response is the text of the
+	// choice. This is a Linux-PAM extension.
+	RadioType Style = C.PAM_RADIO_TYPE
 )
 
-// ConversationHandler is an interface for objects that can be used as
-// conversation callbacks during PAM authentication.
-type ConversationHandler interface {
-	// RespondPAM receives a message style and a message string. If the
-	// message Style is PromptEchoOff or PromptEchoOn then the function
-	// should return a response string.
-	RespondPAM(Style, string) (string, error)
+// cStringBytes returns a C copy of b, terminated by a NUL byte, that PAM
+// frees once done.
+func cStringBytes(b []byte) *C.char {
+	p := (*C.char)(cMalloc(C.size_t(len(b) + 1)))
+	c := unsafe.Slice((*byte)(unsafe.Pointer(p)), len(b)+1)
+	copy(c, b)
+	c[len(b)] = 0
+	return p
 }
 
-// BinaryPointer exposes the type used for the data in a binary conversation
-// it represents a pointer to data that is produced by the module and that
-// must be parsed depending on the protocol in use
-type BinaryPointer unsafe.Pointer
+// cbPAMConvInvalid records the failure of a conversation with an invalid
+// number of messages.
+//
+//export cbPAMConvInvalid
+func cbPAMConvInvalid(n C.int, c C.uintptr_t) {
+	handle(c).value().(*conversation).err = &ConvError{Index: -1, Cause: fmt.Errorf(
+		"invalid number of messages: %d, expected 1 to %d", n, C.PAM_MAX_NUM_MSG)}
+}
 
-type BinaryConversationHandler interface {
-	ConversationHandler
-	// Respond receives a pointer to the binary message. It's up to the
-	// receiver to parse it according to the protocol specifications.
-	// The function can return a byte array that will passed as pointer back
-	// to the module.
-	RespondPAMBinary(BinaryPointer) ([]byte, error)
+// cbPAMConv is a wrapper for the conversation callback function. The
+// responses are owned by the package until all the messages have been
+// handled: if any of them fails, those already built are wiped and released
+// here, otherwise they are handed over to PAM at once.
+//
+//export cbPAMConv
+func cbPAMConv(n C.int, msg **C.struct_pam_message, resp *C.struct_pam_response, c C.uintptr_t) (status C.int) {
+	conv := handle(c).value().(*conversation)
+	if o := loadObserver(conv.subscribers); o != nil {
+		start := time.Now()
+		conv.observeConversation(o, EventConversationStart, start, unsafe.Slice(msg, n), C.PAM_SUCCESS)
+		defer func() { conv.observeConversation(o, EventConversation, start, unsafe.Slice(msg, n), status) }()
+	}
+	if conv.state.ended() {
+		// Modules may converse while their data is cleaned up by
+		// pam_end, once the transaction can't be used anymore.
+		conv.err = &ConvError{Index: -1, Cause: ErrTransactionEnded}
+		return C.PAM_CONV_ERR
+	}
+	if err := conv.limits.checkMessages(int(n)); err != nil {
+		conv.err = &ConvError{Index: -1, Cause: err}
+		return C.PAM_CONV_ERR
+	}
+	if conv.ctx != nil && conv.ctx.Err() != nil {
+		conv.err = &ConvError{Index: -1, Cause: conv.ctx.Err()}
+		return C.PAM_CONV_ERR
+	}
+	if err := context.Cause(conv.interrupted); err != nil {
+		conv.err = &ConvError{Index: -1, Cause: err}
+		return C.PAM_CONV_ERR
+	}
+	if conv.messages != nil {
+		conv.collect(unsafe.Slice(msg, n))
+	}
+	responses := unsafe.Slice(resp, n)
+	// The number of messages is bounded, keep their sizes on the stack.
+	var sizesBuf [C.PAM_MAX_NUM_MSG]int
+	sizes := sizesBuf[:n]
+	var err error
+	switch {
+	case hasBinaryPrompt(msg, n):
+		err = conv.respondEach(unsafe.Slice(msg, n), responses, sizes)
+	case conv.thread != nil && (conv.ctx == nil || conv.ctx.Done() == nil) && conv.timeout == 0:
+		err = conv.respondText(unsafe.Slice(msg, n), responses, sizes)
+	default:
+		err = conv.respondContext(conv.ctx, unsafe.Slice(msg, n), responses, sizes)
+	}
+	if err != nil {
+		for i, r := range responses {
+			if r.resp != nil {
+				freeSecretBytes(unsafe.Pointer(r.resp), sizes[i])
+				responses[i].resp = nil
+			}
+		}
+		if errors.Is(err, ErrConvAgain) {
+			return C.PAM_CONV_AGAIN
+		}
+		return C.PAM_CONV_ERR
+	}
+	for _, r := range responses {
+		cHandOver(unsafe.Pointer(r.resp))
+	}
+	return C.PAM_SUCCESS
 }
 
-// ConversationFunc is an adapter to allow the use of ordinary functions as
-// conversation callbacks.
-type ConversationFunc func(Style, string) (string, error)
+// collect appends the ErrorMsg and TextInfo messages to those collected.
+func (conv *conversation) collect(msg []*C.struct_pam_message) {
+	for _, m := range msg {
+		if s := Style(m.msg_style); s == ErrorMsg || s == TextInfo {
+			*conv.messages = append(*conv.messages, ConversationMessage{s, C.GoString(m.msg)})
+		}
+	}
+}
 
-// RespondPAM is a conversation callback adapter.
-func (f ConversationFunc) RespondPAM(s Style, msg string) (string, error) {
-	return f(s, msg)
+// hasBinaryPrompt returns whether any of the messages is a binary prompt,
+// which multiple messages handlers can't handle.
+func hasBinaryPrompt(msg **C.struct_pam_message, n C.int) bool {
+	for _, m := range unsafe.Slice(msg, n) {
+		if m.msg_style == C.PAM_BINARY_PROMPT {
+			return true
+		}
+	}
+	return false
 }
 
-// cbPAMConv is a wrapper for the conversation callback function.
-//export cbPAMConv
-func cbPAMConv(s C.int, msg *C.char, c C.uintptr_t) (*C.char, C.int) {
-	var r string
-	var err error
-	v := cgo.Handle(c).Value()
-	switch cb := v.(type) {
-	case ConversationHandler:
-		if s == C.PAM_BINARY_PROMPT {
-			return nil, C.PAM_AUTHINFO_UNAVAIL
+// respondText sends the text messages to the handler, all at once if it
+// supports it.
+func (conv *conversation) respondText(msg []*C.struct_pam_message, resp []C.struct_pam_response, sizes []int) error {
+	if conv.multi != nil {
+		return conv.respondMulti(conv.multi, msg, resp, sizes)
+	}
+	return conv.respondEach(msg, resp, sizes)
+}
+
+// respondContext sends the text messages to the handler in a goroutine,
+// returning once it has responded, or once ctx, if not nil, is done, the
+// transaction is interrupted or the conversation timed out, whichever comes
+// first, so that handlers blocked waiting for the user don't block the
+// operation. The goroutine works on copies of the messages, which the
+// module may release once the conversation failed, and the responses it
+// returns late are wiped and released. On a locked thread, the calls the
+// handler makes meanwhile run there, as those of the handlers running on
+// it; otherwise, those it makes once abandoned fail, as they would run
+// along the calls of the application.
+func (conv *conversation) respondContext(ctx context.Context, msg []*C.struct_pam_message, resp []C.struct_pam_response, sizes []int) error {
+	copies := make([]C.struct_pam_message, len(msg))
+	ptrs := make([]*C.struct_pam_message, len(msg))
+	// The copies are Go memory, as only the handlers read them, and their
+	// texts share a single buffer.
+	var lensBuf [C.PAM_MAX_NUM_MSG]int
+	lens := lensBuf[:len(msg)]
+	total := 0
+	for i, m := range msg {
+		if m.msg != nil {
+			lens[i] = int(C.strlen(m.msg))
 		}
-		r, err = cb.RespondPAM(Style(s), C.GoString(msg))
-	case BinaryConversationHandler:
-		if s == C.PAM_BINARY_PROMPT {
-			bytes, err := cb.RespondPAMBinary(BinaryPointer(msg))
-			if err != nil {
-				return nil, C.PAM_CONV_ERR
+		total += lens[i] + 1
+	}
+	text := make([]byte, total)
+	for i, m := range msg {
+		copy(text, unsafe.Slice((*byte)(unsafe.Pointer(m.msg)), lens[i]))
+		copies[i] = C.struct_pam_message{msg_style: m.msg_style, msg: (*C.char)(unsafe.Pointer(&text[0]))}
+		ptrs[i] = &copies[i]
+		text = text[lens[i]+1:]
+	}
+	local := *conv
+	r := make([]C.struct_pam_response, len(msg))
+	s := make([]int, len(msg))
+	done := make(chan error, 1)
+	handler := func() {
+		done <- local.respondText(ptrs, r, s)
+	}
+	var calls <-chan func()
+	stop, abandon := func() {}, func() {}
+	if conv.thread != nil {
+		calls, stop = conv.thread.runHandler(handler)
+	} else {
+		abandon = conv.state.runHandler(handler)
+	}
+	defer stop()
+	var ctxDone <-chan struct{}
+	if ctx != nil {
+		ctxDone = ctx.Done()
+	}
+	var timeout <-chan time.Time
+	if conv.timeout > 0 {
+		timer := time.NewTimer(conv.timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	var cause error
+	for cause == nil {
+		select {
+		case call := <-calls:
+			call()
+		case err := <-done:
+			copy(resp, r)
+			copy(sizes, s)
+			conv.err = local.err
+			return err
+		case <-ctxDone:
+			cause = ctx.Err()
+		case <-conv.interrupted.Done():
+			cause = context.Cause(conv.interrupted)
+		case <-timeout:
+			cause = ErrPromptTimeout
+		}
+	}
+	abandon()
+	go func() {
+		<-done
+		for i := range r {
+			if r[i].resp != nil {
+				freeSecretBytes(unsafe.Pointer(r[i].resp), s[i])
 			}
-			return (*C.char)(C.CBytes(bytes)), C.PAM_SUCCESS
-		} else {
-			r, err = cb.RespondPAM(Style(s), C.GoString(msg))
 		}
+	}()
+	conv.err = &ConvError{Index: -1, Cause: cause}
+	return cause
+}
+
+// respondMulti sends all the messages to the handler at once.
+func (conv *conversation) respondMulti(cb ConversationMultiHandler, msg []*C.struct_pam_message, resp []C.struct_pam_response, sizes []int) error {
+	messages := make([]ConversationMessage, len(msg))
+	for i, m := range msg {
+		messages[i] = ConversationMessage{Style(m.msg_style), C.GoString(m.msg)}
+	}
+	r, err := cb.RespondPAMMulti(messages)
+	if err == nil && len(r) != len(messages) {
+		err = fmt.Errorf("handler returned %d responses for %d messages", len(r), len(messages))
+	}
+	if err != nil {
+		conv.err = &ConvError{Index: -1, Cause: err}
+		return err
+	}
+	for i := range r {
+		if err := conv.limits.checkResponseString(r[i]); err != nil {
+			conv.err = &ConvError{Index: i, Style: messages[i].Style, Prompt: messages[i].Message, Cause: err}
+			return err
+		}
+	}
+	for i := range resp {
+		resp[i].resp = cString(r[i])
+		sizes[i] = len(r[i])
+	}
+	return nil
+}
+
+// respondEach sends the messages to the handler one by one.
+func (conv *conversation) respondEach(msg []*C.struct_pam_message, resp []C.struct_pam_response, sizes []int) error {
+	for i, m := range msg {
+		p, size, err := conv.respond(m.msg_style, m.msg)
+		if err != nil {
+			conv.err = &ConvError{Index: i, Style: Style(m.msg_style), Cause: err}
+			if m.msg_style != C.PAM_BINARY_PROMPT {
+				conv.err.Prompt = C.GoString(m.msg)
+			}
+			return err
+		}
+		resp[i].resp = (*C.char)(p)
+		sizes[i] = size
+	}
+	return nil
+}
+
+// respond returns the C response of the handler to a message, with its
+// size. The response is still owned by the package.
+func (conv *conversation) respond(s C.int, msg *C.char) (unsafe.Pointer, int, error) {
+	if s == C.PAM_BINARY_PROMPT {
+		if conv.binary == nil {
+			return nil, 0, errBinaryUnsupported
+		}
+		bytes, err := conv.binary.RespondPAMBinary(BinaryPointer(msg))
+		if err != nil {
+			return nil, 0, err
+		}
+		return cBytes(bytes), len(bytes), nil
+	}
+	if conv.bytes != nil && conv.binary == nil {
+		var m []byte
+		if msg != nil {
+			m = unsafe.Slice((*byte)(unsafe.Pointer(msg)), C.strlen(msg))
+		}
+		r, err := conv.bytes.RespondPAMBytes(Style(s), m)
+		if err == nil {
+			err = conv.limits.checkResponse(r)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		return unsafe.Pointer(cStringBytes(r)), len(r), nil
+	}
+	r, err := conv.handler.RespondPAM(Style(s), C.GoString(msg))
+	if err == nil {
+		err = conv.limits.checkResponseString(r)
 	}
 	if err != nil {
-		return nil, C.PAM_CONV_ERR
+		return nil, 0, err
 	}
-	return C.CString(r), C.PAM_SUCCESS
+	return unsafe.Pointer(cString(r)), len(r), nil
 }
 
 // Transaction is the application's handle for a PAM transaction.
+//
+// As the PAM handles it wraps, a Transaction must not be used by multiple
+// goroutines at the same time: callers sharing it have to serialize its
+// calls. Distinct transactions can be used concurrently. Calls made by the
+// conversation handler while an operation runs are allowed, and the error
+// returned by each call only depends on that call, see StatusOf: Status, Is
+// and ConversationError report the last call completed, whichever it is.
 type Transaction struct {
 	handle *C.pam_handle_t
-	conv   *C.struct_pam_conv
-	status C.int
-	c      cgo.Handle
+	// conv is the conversation of the transaction, which PAM copies.
+	conv         C.struct_pam_conv
+	status       atomic.Int32
+	c            handle
+	conversation *conversation
+	state        *transactionState
+	strings      *cStringCache
+	service      string
+	subscribers  *subscribers
+	labels       context.Context
+	cleanup      runtime.Cleanup
+	// thread runs the calls to libpam, if started WithLockedThread.
+	thread *lockedThread
+	// endStatus is the copy of the last status the cleanup passes to
+	// pam_end, as it must not reference the transaction.
+	endStatus *atomic.Int32
+	// session and cred are whether the operations opened a session and
+	// established credentials not removed yet.
+	session atomic.Bool
+	cred    atomic.Bool
+	// incomplete is the last operation, if it was suspended, see Resume.
+	incomplete *operation
 }
 
-// transactionFinalizer cleans up the PAM handle and deletes the callback
-// function.
-func transactionFinalizer(t *Transaction) {
-	C.pam_end(t.handle, t.status)
-	t.c.Delete()
+// transactionResources are the resources released when a transaction is
+// garbage collected. They are copied out of the transaction, as the cleanup
+// must not reference it.
+type transactionResources struct {
+	handle      *C.pam_handle_t
+	c           handle
+	strings     *cStringCache
+	service     string
+	subscribers *subscribers
+	thread      *lockedThread
+	status      *atomic.Int32
+}
+
+// release ends the PAM handle of a transaction that has not been closed,
+// reporting its last status to the modules, as End does, and deletes the
+// callback function, the cached C strings and the locked thread.
+func (r transactionResources) release() {
+	if r.handle != nil {
+		// The observer still gets the end of the transaction.
+		t := &Transaction{handle: r.handle, c: r.c, service: r.service,
+			subscribers: r.subscribers}
+		r.thread.run(func() {
+			done := t.hooks("end", 0)
+			done(C.pam_end(r.handle, C.int(r.status.Load())))
+		})
+	}
+	r.thread.stop()
+	r.c.delete()
+	r.strings.free()
 }
 
 // Start initiates a new PAM transaction. Service is treated identically to
@@ -128,7 +461,7 @@ func transactionFinalizer(t *Transaction) {
 // All application calls to PAM begin with Start*. The returned
 // transaction provides an interface to the remainder of the API.
 func Start(service, user string, handler ConversationHandler) (*Transaction, error) {
-	return start(service, user, handler, "")
+	return start(service, handler, &startOptions{user: user})
 }
 
 // StartFunc registers the handler func as a conversation handler.
@@ -144,131 +477,361 @@ func StartFunc(service, user string, handler func(Style, string) (string, error)
 // All application calls to PAM begin with Start*. The returned
 // transaction provides an interface to the remainder of the API.
 func StartConfDir(service, user string, handler ConversationHandler, confDir string) (*Transaction, error) {
+	return startConfDir(service, handler, &startOptions{user: user, confDir: confDir})
+}
+
+func startConfDir(service string, handler ConversationHandler, o *startOptions) (*Transaction, error) {
 	if !CheckPamHasStartConfdir() {
 		return nil, errors.New("StartConfDir() was used, but the pam version on the system is not recent enough")
 	}
 
-	return start(service, user, handler, confDir)
+	return start(service, handler, o)
 }
 
-func start(service, user string, handler ConversationHandler, confDir string) (*Transaction, error) {
+// start starts the transaction with the user, the directory of the services,
+// the thread and the observers of o, running pam_start on the thread if any.
+func start(service string, handler ConversationHandler, o *startOptions) (*Transaction, error) {
+	if t, err, ok := diverted2(o.thread, func() (*Transaction, error) {
+		return start(service, handler, o)
+	}); ok {
+		return t, err
+	}
 	switch handler.(type) {
 	case BinaryConversationHandler:
 		if C.BINARY_PROMPT_IS_SUPPORTED == 0 {
 			return nil, errors.New("BinaryConversationHandler() was used, but it is not supported by this platform")
 		}
 	}
+	state := &transactionState{}
+	conv := newConversation(handler, state, service)
 	t := &Transaction{
-		conv: &C.struct_pam_conv{},
-		c:    cgo.NewHandle(handler),
+		c:            newHandle(conv),
+		conversation: conv,
+		state:        state,
+		strings:      &cStringCache{},
+		service:      service,
+		subscribers:  &subscribers{},
+		thread:       o.thread,
+		endStatus:    &atomic.Int32{},
+	}
+	if debug := envDebugLogger(); debug != nil {
+		t.subscribers.add(debug)
+	}
+	for _, obs := range o.observers {
+		t.subscribers.add(obs)
 	}
-	C.init_pam_conv(t.conv, C.uintptr_t(t.c))
-	runtime.SetFinalizer(t, transactionFinalizer)
-	s := C.CString(service)
-	defer C.free(unsafe.Pointer(s))
+	conv.id, conv.subscribers = t.c, t.subscribers
+	conv.timeout, conv.thread = o.convTimeout, o.thread
+	conv.limits = o.convLimits
+	C.init_pam_conv(&t.conv, C.uintptr_t(t.c))
+	s := cString(service)
+	defer cFree(unsafe.Pointer(s))
 	var u *C.char
-	if len(user) != 0 {
-		u = C.CString(user)
-		defer C.free(unsafe.Pointer(u))
+	if len(o.user) != 0 {
+		u = cString(o.user)
+		defer cFree(unsafe.Pointer(u))
 	}
-	if confDir == "" {
-		t.status = C.pam_start(s, u, t.conv, &t.handle)
+	done := t.hooks("start", 0)
+	if o.confDir == "" {
+		t.status.Store(int32(done(C.pam_start(s, u, &t.conv, &t.handle))))
 	} else {
-		c := C.CString(confDir)
-		defer C.free(unsafe.Pointer(c))
-		t.status = C.pam_start_confdir(s, u, t.conv, c, &t.handle)
+		c := cString(o.confDir)
+		defer cFree(unsafe.Pointer(c))
+		t.status.Store(int32(done(C.call_pam_start_confdir(s, u, &t.conv, c, &t.handle))))
 	}
-	if t.status != C.PAM_SUCCESS {
-		return nil, t
+	t.cleanup = runtime.AddCleanup(t, transactionResources.release,
+		transactionResources{t.handle, t.c, t.strings, t.service, t.subscribers, t.thread, t.endStatus})
+	if status := ReturnType(t.status.Load()); status != Success {
+		return nil, status
 	}
 	return t, nil
 }
 
+// End terminates the transaction as Close does, calling pam_end with the
+// last status of the transaction and the flags, such as DataSilent. See
+// EndWithOptions to close the session and delete the credentials first.
+//
+// Valid flags: DataSilent
+func (t *Transaction) End(f Flags) error {
+	if ended, err := t.state.end(); !ended || t.handle == nil {
+		return err
+	}
+	t.cleanup.Stop()
+	var status C.int
+	t.thread.run(func() {
+		done := t.hooks("end", f)
+		status = done(C.pam_end(t.handle, C.int(t.status.Load())|C.int(f)))
+	})
+	t.thread.stop()
+	t.handle = nil
+	t.c.delete()
+	t.strings.free()
+	reportAllocations()
+	return t.result(status)
+}
+
+// Error returns the message of the last status of the transaction.
+//
+// Deprecated: the transaction is no longer returned as error, failures
+// return ReturnType values instead. Use Status to get the last status.
 func (t *Transaction) Error() string {
-	return C.GoString(C.pam_strerror(t.handle, C.int(t.status)))
+	return C.GoString(C.pam_strerror(t.handle, C.int(t.status.Load())))
+}
+
+// operationResult is result for operations that may converse: if the
+// operation failed after a conversation failure, the error is the
+// *ConvError.
+func (t *Transaction) operationResult(status C.int) error {
+	err := t.result(status)
+	if err == nil {
+		return nil
+	}
+	if t.conversation != nil && t.conversation.err != nil {
+		t.conversation.err.Status = ReturnType(status)
+		return t.conversation.err
+	}
+	return err
+}
+
+// result records status as the last status of the transaction and returns
+// it as error, if any. The error is built from the status of the call and
+// not from the transaction, so that it can't be replaced by the status of
+// the calls made by the conversation handler in the meantime.
+func (t *Transaction) result(status C.int) error {
+	t.setStatus(ReturnType(status))
+	if status != C.PAM_SUCCESS {
+		return ReturnType(status)
+	}
+	return nil
 }
 
-// Item is a an PAM information type.
-type Item int
+// PAM return types.
+const (
+	// Success is the successful status, never returned as error.
+	Success ReturnType = C.PAM_SUCCESS
+	// ErrOpen is returned when a module cannot be loaded.
+	ErrOpen ReturnType = C.PAM_OPEN_ERR
+	// ErrSymbol is returned when a symbol is not found.
+	ErrSymbol ReturnType = C.PAM_SYMBOL_ERR
+	// ErrService is returned on an error in a service module.
+	ErrService ReturnType = C.PAM_SERVICE_ERR
+	// ErrSystem is returned on a system error.
+	ErrSystem ReturnType = C.PAM_SYSTEM_ERR
+	// ErrBuf is returned on a memory buffer error.
+	ErrBuf ReturnType = C.PAM_BUF_ERR
+	// ErrPermDenied is returned when permission is denied.
+	ErrPermDenied ReturnType = C.PAM_PERM_DENIED
+	// ErrAuth is returned on an authentication failure.
+	ErrAuth ReturnType = C.PAM_AUTH_ERR
+	// ErrCredInsufficient is returned when the credentials are not
+	// sufficient to access the authentication data.
+	ErrCredInsufficient ReturnType = C.PAM_CRED_INSUFFICIENT
+	// ErrAuthinfoUnavail is returned when the authentication service
+	// cannot retrieve the authentication information.
+	ErrAuthinfoUnavail ReturnType = C.PAM_AUTHINFO_UNAVAIL
+	// ErrUserUnknown is returned when the user is not known to the
+	// authentication module.
+	ErrUserUnknown ReturnType = C.PAM_USER_UNKNOWN
+	// ErrMaxtries is returned when the maximum number of retries has
+	// been reached.
+	ErrMaxtries ReturnType = C.PAM_MAXTRIES
+	// ErrNewAuthtokReqd is returned when the authentication token is no
+	// longer valid and a new one is required.
+	ErrNewAuthtokReqd ReturnType = C.PAM_NEW_AUTHTOK_REQD
+	// ErrAcctExpired is returned when the user account has expired.
+	ErrAcctExpired ReturnType = C.PAM_ACCT_EXPIRED
+	// ErrSession is returned when a session cannot be made or removed.
+	ErrSession ReturnType = C.PAM_SESSION_ERR
+	// ErrCredUnavail is returned when the credentials cannot be
+	// retrieved.
+	ErrCredUnavail ReturnType = C.PAM_CRED_UNAVAIL
+	// ErrCredExpired is returned when the credentials have expired.
+	ErrCredExpired ReturnType = C.PAM_CRED_EXPIRED
+	// ErrCred is returned on a failure setting the credentials.
+	ErrCred ReturnType = C.PAM_CRED_ERR
+	// ErrNoModuleData is returned when no module specific data is
+	// present.
+	ErrNoModuleData ReturnType = C.PAM_NO_MODULE_DATA
+	// ErrConv is returned on a conversation error.
+	ErrConv ReturnType = C.PAM_CONV_ERR
+	// ErrAuthtok is returned on an authentication token manipulation
+	// error.
+	ErrAuthtok ReturnType = C.PAM_AUTHTOK_ERR
+	// ErrAuthtokRecovery is returned when the authentication
+	// information cannot be recovered.
+	ErrAuthtokRecovery ReturnType = C.PAM_AUTHTOK_RECOVERY_ERR
+	// ErrAuthtokLockBusy is returned when the authentication token lock
+	// is busy.
+	ErrAuthtokLockBusy ReturnType = C.PAM_AUTHTOK_LOCK_BUSY
+	// ErrAuthtokDisableAging is returned when the authentication token
+	// aging is disabled.
+	ErrAuthtokDisableAging ReturnType = C.PAM_AUTHTOK_DISABLE_AGING
+	// ErrTryAgain is returned when the preliminary check by the password
+	// service failed.
+	ErrTryAgain ReturnType = C.PAM_TRY_AGAIN
+	// ErrIgnore is returned when the module should be ignored.
+	ErrIgnore ReturnType = C.PAM_IGNORE
+	// ErrAbort is returned on a critical error requiring an immediate
+	// abort.
+	ErrAbort ReturnType = C.PAM_ABORT
+	// ErrAuthtokExpired is returned when the authentication token has
+	// expired.
+	ErrAuthtokExpired ReturnType = C.PAM_AUTHTOK_EXPIRED
+	// ErrModuleUnknown is returned when the module is not known.
+	ErrModuleUnknown ReturnType = C.PAM_MODULE_UNKNOWN
+	// ErrBadItem is returned when a bad item is passed to SetItem or
+	// GetItem.
+	ErrBadItem ReturnType = C.PAM_BAD_ITEM
+	// ErrConvAgain is returned by a conversation that will complete
+	// later. Conversation handlers return it to suspend the operation
+	// until the response is available, see Resume. It is a Linux-PAM
+	// extension.
+	ErrConvAgain ReturnType = C.PAM_CONV_AGAIN
+	// ErrIncomplete is returned when the operation has to be called
+	// again to complete, after an ErrConvAgain conversation. It is a
+	// Linux-PAM extension.
+	ErrIncomplete ReturnType = C.PAM_INCOMPLETE
+)
+
+// Error returns the PAM message of the return type.
+func (r ReturnType) Error() string {
+	return C.GoString(C.pam_strerror(nil, C.int(r)))
+}
 
 // PAM Item types.
 const (
 	// Service is the name which identifies the PAM stack.
 	Service Item = C.PAM_SERVICE
 	// User identifies the username identity used by a service.
-	User = C.PAM_USER
+	User Item = C.PAM_USER
 	// Tty is the terminal name.
-	Tty = C.PAM_TTY
+	Tty Item = C.PAM_TTY
 	// Rhost is the requesting host name.
-	Rhost = C.PAM_RHOST
+	Rhost Item = C.PAM_RHOST
 	// Authtok is the currently active authentication token.
-	Authtok = C.PAM_AUTHTOK
+	Authtok Item = C.PAM_AUTHTOK
 	// Oldauthtok is the old authentication token.
-	Oldauthtok = C.PAM_OLDAUTHTOK
+	Oldauthtok Item = C.PAM_OLDAUTHTOK
 	// Ruser is the requesting user name.
-	Ruser = C.PAM_RUSER
+	Ruser Item = C.PAM_RUSER
 	// UserPrompt is the string use to prompt for a username.
-	UserPrompt = C.PAM_USER_PROMPT
+	UserPrompt Item = C.PAM_USER_PROMPT
+	// FailDelay is the function called instead of delaying the failed
+	// operations. It is not a string. It is a Linux-PAM extension.
+	FailDelay Item = C.PAM_FAIL_DELAY
+	// XDisplay is the name of the X display of the user, such as ":0".
+	// It is a Linux-PAM extension.
+	XDisplay Item = C.PAM_XDISPLAY
+	// XAuthData is the X authentication data of the user, see
+	// SetXAuthData. It is not a string. It is a Linux-PAM extension.
+	XAuthData Item = C.PAM_XAUTHDATA
+	// AuthtokType is the type of the authentication token in the
+	// password prompts, such as "UNIX" in "New UNIX password: ". It is
+	// a Linux-PAM extension.
+	AuthtokType Item = C.PAM_AUTHTOK_TYPE
 )
 
-// SetItem sets a PAM information item.
+// SetItem sets a PAM information item. The C copy of the item is wiped
+// once PAM has copied it, as it may be an authentication token.
 func (t *Transaction) SetItem(i Item, item string) error {
-	cs := unsafe.Pointer(C.CString(item))
-	defer C.free(cs)
-	t.status = C.pam_set_item(t.handle, C.int(i), cs)
-	if t.status != C.PAM_SUCCESS {
-		return t
+	if t.thread != nil {
+		if err, ok := diverted(t.thread, func() error { return t.SetItem(i, item) }); ok {
+			return err
+		}
 	}
-	return nil
+	if err := t.state.enter(); err != nil {
+		return err
+	}
+	defer t.state.leave()
+	if err := checkStringItem(i); err != nil {
+		return err
+	}
+	cs := cString(item)
+	defer freeSecret(cs)
+	done := t.callHooks(EventItem, "set_item", i)
+	status := done(C.pam_set_item(t.handle, C.int(i), unsafe.Pointer(cs)))
+	return t.result(status)
 }
 
-// GetItem retrieves a PAM information item.
+// GetItem retrieves a PAM information item. The authentication tokens are
+// only readable by the modules, and fail with ErrBadItem.
 func (t *Transaction) GetItem(i Item) (string, error) {
+	if t.thread != nil {
+		if r, err, ok := diverted2(t.thread, func() (string, error) { return t.GetItem(i) }); ok {
+			return r, err
+		}
+	}
+	if err := t.state.enter(); err != nil {
+		return "", err
+	}
+	defer t.state.leave()
+	if err := checkStringItem(i); err != nil {
+		return "", err
+	}
+	if err := checkReadableItem(i); err != nil {
+		return "", err
+	}
 	var s unsafe.Pointer
-	t.status = C.pam_get_item(t.handle, C.int(i), &s)
-	if t.status != C.PAM_SUCCESS {
-		return "", t
+	done := t.callHooks(EventCall, "get_item", i)
+	if err := t.result(done(C.pam_get_item(t.handle, C.int(i), &s))); err != nil {
+		return "", err
+	}
+	if s == nil {
+		return "", nil
 	}
-	return C.GoString((*C.char)(s)), nil
+	return t.strings.value(valueKey{item: i}, (*C.char)(s)), nil
 }
 
-// Flags are inputs to various PAM functions than be combined with a bitwise
-// or. Refer to the official PAM documentation for which flags are accepted
-// by which functions.
-type Flags int
-
 // PAM Flag types.
 const (
 	// Silent indicates that no messages should be emitted.
 	Silent Flags = C.PAM_SILENT
 	// DisallowNullAuthtok indicates that authorization should fail
 	// if the user does not have a registered authentication token.
-	DisallowNullAuthtok = C.PAM_DISALLOW_NULL_AUTHTOK
+	DisallowNullAuthtok Flags = C.PAM_DISALLOW_NULL_AUTHTOK
 	// EstablishCred indicates that credentials should be established
 	// for the user.
-	EstablishCred = C.PAM_ESTABLISH_CRED
+	EstablishCred Flags = C.PAM_ESTABLISH_CRED
 	// DeleteCred inidicates that credentials should be deleted.
-	DeleteCred = C.PAM_DELETE_CRED
+	DeleteCred Flags = C.PAM_DELETE_CRED
 	// ReinitializeCred indicates that credentials should be fully
 	// reinitialized.
-	ReinitializeCred = C.PAM_REINITIALIZE_CRED
+	ReinitializeCred Flags = C.PAM_REINITIALIZE_CRED
 	// RefreshCred indicates that the lifetime of existing credentials
 	// should be extended.
-	RefreshCred = C.PAM_REFRESH_CRED
+	RefreshCred Flags = C.PAM_REFRESH_CRED
 	// ChangeExpiredAuthtok indicates that the authentication token
 	// should be changed if it has expired.
-	ChangeExpiredAuthtok = C.PAM_CHANGE_EXPIRED_AUTHTOK
+	ChangeExpiredAuthtok Flags = C.PAM_CHANGE_EXPIRED_AUTHTOK
+	// DataSilent indicates that the modules should release their data
+	// without side effects, such as when a forked process ends its copy
+	// of the transaction while the parent keeps using it. It is a
+	// Linux-PAM extension, ignored by the other implementations.
+	DataSilent Flags = C.PAM_DATA_SILENT
+	// PrelimCheck is passed by libpam to the password modules in the
+	// first pass of pam_chauthtok, checking that the authentication token
+	// can be changed. Applications must not pass it.
+	PrelimCheck Flags = C.PAM_PRELIM_CHECK
+	// UpdateAuthtok is passed by libpam to the password modules in the
+	// second pass of pam_chauthtok, changing the authentication token.
+	// Applications must not pass it.
+	UpdateAuthtok Flags = C.PAM_UPDATE_AUTHTOK
 )
 
 // Authenticate is used to authenticate the user.
 //
 // Valid flags: Silent, DisallowNullAuthtok
 func (t *Transaction) Authenticate(f Flags) error {
-	t.status = C.pam_authenticate(t.handle, C.int(f))
-	if t.status != C.PAM_SUCCESS {
-		return t
+	if err, ok := diverted(t.thread, func() error { return t.Authenticate(f) }); ok {
+		return err
 	}
-	return nil
+	if err := t.state.enter(); err != nil {
+		return err
+	}
+	defer t.state.leave()
+	t.conversation.reset()
+	done := t.hooks("authenticate", f)
+	return t.resumable("authenticate", f, t.operationResult(done(C.pam_authenticate(t.handle, C.int(f)))))
 }
 
 // SetCred is used to establish, maintain and delete the credentials of a
@@ -276,55 +839,100 @@ func (t *Transaction) Authenticate(f Flags) error {
 //
 // Valid flags: EstablishCred, DeleteCred, ReinitializeCred, RefreshCred
 func (t *Transaction) SetCred(f Flags) error {
-	t.status = C.pam_setcred(t.handle, C.int(f))
-	if t.status != C.PAM_SUCCESS {
-		return t
+	if err, ok := diverted(t.thread, func() error { return t.SetCred(f) }); ok {
+		return err
 	}
-	return nil
+	if err := t.state.enter(); err != nil {
+		return err
+	}
+	defer t.state.leave()
+	t.conversation.reset()
+	done := t.hooks("setcred", f)
+	return t.resumable("setcred", f, t.operationResult(done(C.pam_setcred(t.handle, C.int(f)))))
 }
 
 // AcctMgmt is used to determine if the user's account is valid.
 //
 // Valid flags: Silent, DisallowNullAuthtok
 func (t *Transaction) AcctMgmt(f Flags) error {
-	t.status = C.pam_acct_mgmt(t.handle, C.int(f))
-	if t.status != C.PAM_SUCCESS {
-		return t
+	if err, ok := diverted(t.thread, func() error { return t.AcctMgmt(f) }); ok {
+		return err
 	}
-	return nil
+	if err := t.state.enter(); err != nil {
+		return err
+	}
+	defer t.state.leave()
+	t.conversation.reset()
+	done := t.hooks("acct_mgmt", f)
+	return t.resumable("acct_mgmt", f, t.operationResult(done(C.pam_acct_mgmt(t.handle, C.int(f)))))
 }
 
 // ChangeAuthTok is used to change the authentication token.
 //
 // Valid flags: Silent, ChangeExpiredAuthtok
 func (t *Transaction) ChangeAuthTok(f Flags) error {
-	t.status = C.pam_chauthtok(t.handle, C.int(f))
-	if t.status != C.PAM_SUCCESS {
-		return t
+	if err, ok := diverted(t.thread, func() error { return t.ChangeAuthTok(f) }); ok {
+		return err
 	}
-	return nil
+	if err := t.state.enter(); err != nil {
+		return err
+	}
+	defer t.state.leave()
+	t.conversation.reset()
+	done := t.hooks("chauthtok", f)
+	return t.resumable("chauthtok", f, t.operationResult(done(C.pam_chauthtok(t.handle, C.int(f)))))
 }
 
 // OpenSession sets up a user session for an authenticated user.
 //
 // Valid flags: Slient
 func (t *Transaction) OpenSession(f Flags) error {
-	t.status = C.pam_open_session(t.handle, C.int(f))
-	if t.status != C.PAM_SUCCESS {
-		return t
+	if err, ok := diverted(t.thread, func() error { return t.OpenSession(f) }); ok {
+		return err
 	}
-	return nil
+	if err := t.state.enter(); err != nil {
+		return err
+	}
+	defer t.state.leave()
+	t.conversation.reset()
+	done := t.hooks("open_session", f)
+	return t.resumable("open_session", f, t.operationResult(done(C.pam_open_session(t.handle, C.int(f)))))
 }
 
 // CloseSession closes a previously opened session.
 //
 // Valid flags: Silent
 func (t *Transaction) CloseSession(f Flags) error {
-	t.status = C.pam_close_session(t.handle, C.int(f))
-	if t.status != C.PAM_SUCCESS {
-		return t
+	if err, ok := diverted(t.thread, func() error { return t.CloseSession(f) }); ok {
+		return err
 	}
-	return nil
+	if err := t.state.enter(); err != nil {
+		return err
+	}
+	defer t.state.leave()
+	t.conversation.reset()
+	done := t.hooks("close_session", f)
+	return t.resumable("close_session", f, t.operationResult(done(C.pam_close_session(t.handle, C.int(f)))))
+}
+
+// FailDelay requests a minimum delay before the failed operations return,
+// which libpam applies once, using the longest delay requested by the
+// application and the modules. Delays longer than about 71 minutes are
+// truncated.
+//
+// It is a Linux-PAM extension: the other implementations, such as OpenPAM,
+// fail with ErrSymbol, see CheckPamHasFailDelay.
+func (t *Transaction) FailDelay(d time.Duration) error {
+	if err, ok := diverted(t.thread, func() error { return t.FailDelay(d) }); ok {
+		return err
+	}
+	if err := t.state.enter(); err != nil {
+		return err
+	}
+	defer t.state.leave()
+	usec := min(d.Microseconds(), math.MaxUint32)
+	done := t.callHooks(EventCall, "fail_delay", 0)
+	return t.result(done(C.call_pam_fail_delay(t.handle, C.uint(max(usec, 0)))))
 }
 
 // PutEnv adds or changes the value of PAM environment variables.
@@ -333,50 +941,128 @@ func (t *Transaction) CloseSession(f Flags) error {
 // NAME= will set a variable to an empty value.
 // NAME (without an "=") will delete a variable.
 func (t *Transaction) PutEnv(nameval string) error {
-	cs := C.CString(nameval)
-	defer C.free(unsafe.Pointer(cs))
-	t.status = C.pam_putenv(t.handle, cs)
-	if t.status != C.PAM_SUCCESS {
-		return t
+	if t.thread != nil {
+		if err, ok := diverted(t.thread, func() error { return t.PutEnv(nameval) }); ok {
+			return err
+		}
 	}
-	return nil
+	if err := t.state.enter(); err != nil {
+		return err
+	}
+	defer t.state.leave()
+	var buf [smallString]byte
+	cs, small := cStringBuf(buf[:], nameval)
+	if !small {
+		// Not reusing cs, which would move buf to the heap too.
+		c := cString(nameval)
+		defer cFree(unsafe.Pointer(c))
+		cs = c
+	}
+	done := t.callHooks(EventCall, "putenv", 0)
+	return t.result(done(C.pam_putenv(t.handle, cs)))
 }
 
-// GetEnv is used to retrieve a PAM environment variable.
+// GetEnv is used to retrieve a PAM environment variable. It returns an
+// empty string for the variables not set, see GetEnvOk.
 func (t *Transaction) GetEnv(name string) string {
-	cs := C.CString(name)
-	defer C.free(unsafe.Pointer(cs))
+	value, _ := t.GetEnvOk(name)
+	return value
+}
+
+// GetEnvOk retrieves a PAM environment variable, returning whether it is
+// set, as os.LookupEnv does, so that the variables set to an empty value
+// can be told from those not set.
+func (t *Transaction) GetEnvOk(name string) (string, bool) {
+	type result struct {
+		value string
+		ok    bool
+	}
+	if t.thread != nil {
+		if r, ok := diverted(t.thread, func() result {
+			value, ok := t.GetEnvOk(name)
+			return result{value, ok}
+		}); ok {
+			return r.value, r.ok
+		}
+	}
+	if t.state.enter() != nil {
+		return "", false
+	}
+	defer t.state.leave()
+	var buf [smallString]byte
+	cs, small := cStringBuf(buf[:], name)
+	if !small {
+		c, cached := t.strings.get(name)
+		if !cached {
+			defer cFree(unsafe.Pointer(c))
+		}
+		cs = c
+	}
+	done := t.callHooks(EventCall, "getenv", 0)
 	value := C.pam_getenv(t.handle, cs)
+	// An unset variable is not a failure.
+	done(C.PAM_SUCCESS)
 	if value == nil {
-		return ""
+		return "", false
 	}
-	return C.GoString(value)
+	return t.strings.value(valueKey{name: name}, value), true
 }
 
 func next(p **C.char) **C.char {
 	return (**C.char)(unsafe.Pointer(uintptr(unsafe.Pointer(p)) + unsafe.Sizeof(p)))
 }
 
-// GetEnvList returns a copy of the PAM environment as a map.
-func (t *Transaction) GetEnvList() (map[string]string, error) {
-	env := make(map[string]string)
+// envList calls yield for each variable of the PAM environment until it
+// returns false, freeing the entries as it goes.
+func (t *Transaction) envList(yield func(name, value string) bool) error {
+	if err, ok := diverted(t.thread, func() error { return t.envList(yield) }); ok {
+		return err
+	}
+	if err := t.state.enter(); err != nil {
+		return err
+	}
+	defer t.state.leave()
+	done := t.callHooks(EventCall, "getenvlist", 0)
 	p := C.pam_getenvlist(t.handle)
 	if p == nil {
-		t.status = C.PAM_BUF_ERR
-		return nil, t
+		return t.result(done(C.PAM_BUF_ERR))
 	}
-	for q := p; *q != nil; q = next(q) {
-		chunks := strings.SplitN(C.GoString(*q), "=", 2)
-		if len(chunks) == 2 {
-			env[chunks[0]] = chunks[1]
+	done(C.PAM_SUCCESS)
+	q := p
+	defer func() {
+		for ; *q != nil; q = next(q) {
+			C.free(unsafe.Pointer(*q))
 		}
+		C.free(unsafe.Pointer(p))
+	}()
+	for *q != nil {
+		entry := C.GoString(*q)
 		C.free(unsafe.Pointer(*q))
+		q = next(q)
+		if name, value, ok := parseEnvEntry(entry); ok && !yield(name, value) {
+			break
+		}
 	}
-	C.free(unsafe.Pointer(p))
-	return env, nil
+	return nil
 }
 
 // CheckPamHasStartConfdir return if pam on system supports pam_system_confdir
+//
+// Building with the pam_nostartconfdir tag makes it always return false, to
+// test the code handling the lack of StartConfDir support on any system.
 func CheckPamHasStartConfdir() bool {
-	return C.check_pam_start_confdir() == 0
+	return !noStartConfdir && C.check_pam_start_confdir() == 0
+}
+
+// CheckPamHasBinaryProtocol returns whether the PAM implementation supports
+// the binary prompts, which Linux-PAM does while OpenPAM doesn't, see
+// BinaryConversationHandler.
+func CheckPamHasBinaryProtocol() bool {
+	return C.BINARY_PROMPT_IS_SUPPORTED != 0
+}
+
+// CheckPamHasFailDelay returns whether the PAM implementation has
+// pam_fail_delay, see FailDelay.
+func CheckPamHasFailDelay() bool {
+	return C.check_pam_fail_delay() == 0
 }
@@ -2,8 +2,14 @@ package pam
 
 import (
 	"errors"
+	"fmt"
 	"os/user"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 )
 
 func TestPAM_001(t *testing.T) {
@@ -189,6 +195,99 @@ func TestPAM_ConfDir(t *testing.T) {
 	}
 }
 
+func TestPAM_Close(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	tx, err := StartConfDir("permit-service", u.Username, Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	err = tx.Close()
+	if err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+	if tx.handle != nil {
+		t.Fatalf("close #error: handle not released")
+	}
+	err = tx.Close()
+	if err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if err == nil {
+		t.Fatalf("authenticate #expected an error")
+	}
+}
+
+func TestPAM_Cleanup(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	var collected atomic.Bool
+	handler := &Credentials{}
+	runtime.AddCleanup(handler, func(b *atomic.Bool) { b.Store(true) }, &collected)
+	_, err := StartConfDir("permit-service", u.Username, handler, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	handler = nil
+	for i := 0; i < 100 && !collected.Load(); i++ {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !collected.Load() {
+		t.Fatalf("cleanup #error: handler of an unreachable transaction not released")
+	}
+}
+
+func TestPAM_CleanupStatus(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	tx, err := StartConfDir("deny-service", u.Username, Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	if err := tx.Authenticate(0); err == nil {
+		t.Fatalf("authenticate #expected an error")
+	}
+	if s := ReturnType(tx.endStatus.Load()); s != ErrAuth {
+		t.Fatalf("cleanup #error: expected %v, got %v", ErrAuth, s)
+	}
+}
+
+func TestLiveTransactions(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	tx, err := StartConfDir("permit-service", u.Username, Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	// The transactions of the other tests may be garbage collected
+	// meanwhile, but never started.
+	live := LiveTransactions()
+	if live < 1 {
+		t.Fatalf("live #error: expected the transaction, got %d", live)
+	}
+	if err := tx.Close(); err != nil {
+		t.Fatalf("close #error: %v", err)
+	}
+	if n := LiveTransactions(); n > live-1 {
+		t.Fatalf("live #error: expected at most %d, got %d", live-1, n)
+	}
+}
+
 func TestPAM_ConfDir_FailNoServiceOrUnsupported(t *testing.T) {
 	u, _ := user.Current()
 	c := Credentials{
@@ -216,6 +315,13 @@ func TestPAM_ConfDir_InfoMessage(t *testing.T) {
 			}
 			return "", errors.New("unexpected")
 		}), "test-services")
+	if !CheckPamHasStartConfdir() {
+		if err == nil {
+			t.Fatalf("start should have errored out as pam_start_confdir is not available: %v", err)
+		}
+		// nothing else we do, we don't support it.
+		return
+	}
 	if err != nil {
 		t.Fatalf("start #error: %v", err)
 	}
@@ -231,6 +337,13 @@ func TestPAM_ConfDir_InfoMessage(t *testing.T) {
 func TestPAM_ConfDir_Deny(t *testing.T) {
 	u, _ := user.Current()
 	tx, err := StartConfDir("deny-service", u.Username, Credentials{}, "test-services")
+	if !CheckPamHasStartConfdir() {
+		if err == nil {
+			t.Fatalf("start should have errored out as pam_start_confdir is not available: %v", err)
+		}
+		// nothing else we do, we don't support it.
+		return
+	}
 	if err != nil {
 		t.Fatalf("start #error: %v", err)
 	}
@@ -244,6 +357,36 @@ func TestPAM_ConfDir_Deny(t *testing.T) {
 	}
 }
 
+func TestPAM_ConfDir_ReturnType(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	tx, err := StartConfDir("deny-service", u.Username, Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticate #error: expected %v, got %v", ErrAuth, err)
+	}
+	if tx.Status() != ErrAuth {
+		t.Fatalf("status #error: expected %v, got %v", ErrAuth, tx.Status())
+	}
+	_, err = tx.GetItem(Item(-1))
+	var r ReturnType
+	if !errors.As(err, &r) || r != ErrBadItem {
+		t.Fatalf("getitem #error: expected %v, got %v", ErrBadItem, err)
+	}
+	if err.Error() != tx.Error() || err.Error() == "" {
+		t.Fatalf("error #error: unexpected message %q", err.Error())
+	}
+	err = tx.SetItem(Tty, "tty1")
+	if err != nil || tx.Status() != Success {
+		t.Fatalf("setitem #error: %v", err)
+	}
+}
+
 func TestPAM_ConfDir_PromptForUserName(t *testing.T) {
 	c := Credentials{
 		User: "testuser",
@@ -267,6 +410,47 @@ func TestPAM_ConfDir_PromptForUserName(t *testing.T) {
 	}
 }
 
+func TestPAM_ConfDir_Bytes(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	var messages []string
+	response := []byte("testuser")
+	tx, err := StartConfDir("succeed-if-user-test", "",
+		BytesConversationFunc(func(s Style, msg []byte) ([]byte, error) {
+			messages = append(messages, string(msg))
+			if s == PromptEchoOn {
+				return response, nil
+			}
+			return nil, nil
+		}), "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	// The response is copied, so the buffer can be wiped at once.
+	copy(response, "xxxxxxxx")
+	response = []byte("testuser")
+	err = tx.Authenticate(0)
+	if err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if len(messages) == 0 || messages[0] == "" {
+		t.Fatalf("conversation #error: unexpected messages %q", messages)
+	}
+
+	tx, err = StartConfDir("succeed-if-user-test", "",
+		BytesConversationFunc(func(s Style, msg []byte) ([]byte, error) {
+			return nil, errors.New("failure")
+		}), "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	err = tx.Authenticate(0)
+	if err == nil {
+		t.Fatalf("authenticate #expected an error")
+	}
+}
+
 func TestPAM_ConfDir_WrongUserName(t *testing.T) {
 	c := Credentials{
 		User: "wronguser",
@@ -290,6 +474,71 @@ func TestPAM_ConfDir_WrongUserName(t *testing.T) {
 	}
 }
 
+func TestPAM_ReentrantStatus(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	var tx *Transaction
+	var itemErr error
+	tx, err := StartConfDir("succeed-if-user-test", "",
+		ConversationFunc(func(s Style, msg string) (string, error) {
+			// The failure of this call must not leak into the result of
+			// the operation running the conversation.
+			_, itemErr = tx.GetItem(Item(-1))
+			return "testuser", nil
+		}), "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	err = tx.Authenticate(0)
+	if err != nil {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+	if !errors.Is(itemErr, ErrBadItem) {
+		t.Fatalf("getitem #error: expected %v, got %v", ErrBadItem, itemErr)
+	}
+	if tx.Status() != Success {
+		t.Fatalf("status #error: %v", tx.Status())
+	}
+}
+
+func TestPAM_Concurrent(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	var wg sync.WaitGroup
+	errs := make(chan error, 16)
+	for i := 0; i < cap(errs); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			service := "permit-service"
+			if i%2 == 1 {
+				service = "deny-service"
+			}
+			tx, err := StartConfDir(service, u.Username, Credentials{}, "test-services")
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer tx.Close()
+			err = tx.Authenticate(0)
+			if service == "permit-service" && err != nil {
+				errs <- fmt.Errorf("%s: %w", service, err)
+			} else if service == "deny-service" && !errors.Is(err, ErrAuth) {
+				errs <- fmt.Errorf("%s: unexpected result %v", service, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Errorf("authenticate #error: %v", err)
+	}
+}
+
 func TestItem(t *testing.T) {
 	tx, _ := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
 		return "", nil
@@ -390,6 +639,48 @@ func TestEnv(t *testing.T) {
 	}
 }
 
+func TestEnv_Iterator(t *testing.T) {
+	u, _ := user.Current()
+	if u.Uid != "0" {
+		t.Skip("run this test as root")
+	}
+	tx, err := StartFunc("", "", func(s Style, msg string) (string, error) {
+		return "", errors.New("unexpected")
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	for _, s := range []string{"VAL1=1", "VAL2=2", "VAL3=3"} {
+		err = tx.PutEnv(s)
+		if err != nil {
+			t.Fatalf("putenv #error: %v", err)
+		}
+	}
+	m := map[string]string{}
+	for name, value := range tx.Env() {
+		m[name] = value
+	}
+	if len(m) != 3 || m["VAL1"] != "1" || m["VAL2"] != "2" || m["VAL3"] != "3" {
+		t.Fatalf("env #error: unexpected environment %v", m)
+	}
+	n := 0
+	for range tx.Env() {
+		n++
+		break
+	}
+	if n != 1 {
+		t.Fatalf("env #error: expected 1 item, got %v", n)
+	}
+
+	empty := Transaction{}
+	for name := range empty.Env() {
+		t.Fatalf("env #error: unexpected variable %v", name)
+	}
+	if _, err := empty.GetEnvList(); err == nil {
+		t.Fatalf("getenvlist #expected an error")
+	}
+}
+
 func TestFailure_001(t *testing.T) {
 	tx := Transaction{}
 	_, err := tx.GetEnvList()
@@ -461,3 +752,318 @@ func TestFailure_009(t *testing.T) {
 		t.Fatalf("getenvlist #expected an error")
 	}
 }
+
+func FuzzParseEnvEntry(f *testing.F) {
+	for _, s := range []string{"VAL=1", "VAL=", "VAL", "=value", "A=B=C", ""} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, entry string) {
+		name, value, ok := parseEnvEntry(entry)
+		if !ok {
+			if name != "" || value != "" {
+				t.Fatalf("parse #error: unexpected %q=%q for invalid %q", name, value, entry)
+			}
+			return
+		}
+		if name == "" || strings.Contains(name, "=") {
+			t.Fatalf("parse #error: invalid name %q for %q", name, entry)
+		}
+		if name+"="+value != entry {
+			t.Fatalf("parse #error: %q=%q does not match %q", name, value, entry)
+		}
+	})
+}
+
+func FuzzEnv(f *testing.F) {
+	for _, s := range []string{"VAL=1", "VAL=", "VAL", "=value", "A=B=C"} {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, nameval string) {
+		if strings.IndexByte(nameval, 0) >= 0 {
+			t.Skip("C strings can't contain NUL")
+		}
+		tx, err := StartFunc("", "", func(s Style, msg string) (string, error) {
+			return "", nil
+		})
+		if err != nil {
+			t.Fatalf("start #error: %v", err)
+		}
+		if err := tx.PutEnv(nameval); err != nil {
+			return
+		}
+		if _, err := tx.GetEnvList(); err != nil {
+			t.Fatalf("getenvlist #error: %v", err)
+		}
+	})
+}
+
+func benchmarkStart(b *testing.B, service string, handler ConversationHandler) *Transaction {
+	u, _ := user.Current()
+	tx, err := StartConfDir(service, u.Username, handler, "test-services")
+	if err != nil {
+		b.Skipf("start #error: %v", err)
+	}
+	return tx
+}
+
+func BenchmarkStart(b *testing.B) {
+	if !CheckPamHasStartConfdir() {
+		b.Skip("pam_start_confdir is not available")
+	}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		benchmarkStart(b, "permit-service", Credentials{})
+	}
+}
+
+func BenchmarkStartParallel(b *testing.B) {
+	if !CheckPamHasStartConfdir() {
+		b.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			tx, err := StartConfDir("echo-service", u.Username, Credentials{}, "test-services")
+			if err != nil {
+				b.Fatalf("start #error: %v", err)
+			}
+			if err := tx.Authenticate(0); err != nil {
+				b.Fatalf("authenticate #error: %v", err)
+			}
+			if err := tx.Close(); err != nil {
+				b.Fatalf("close #error: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkAuthenticate(b *testing.B) {
+	if !CheckPamHasStartConfdir() {
+		b.Skip("pam_start_confdir is not available")
+	}
+	tx := benchmarkStart(b, "permit-service", Credentials{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tx.Authenticate(0); err != nil {
+			b.Fatalf("authenticate #error: %v", err)
+		}
+	}
+}
+
+func BenchmarkConversation(b *testing.B) {
+	if !CheckPamHasStartConfdir() {
+		b.Skip("pam_start_confdir is not available")
+	}
+	tx := benchmarkStart(b, "echo-service", ConversationFunc(func(s Style, msg string) (string, error) {
+		return "", nil
+	}))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tx.Authenticate(0); err != nil {
+			b.Fatalf("authenticate #error: %v", err)
+		}
+	}
+}
+
+func BenchmarkConversationParallel(b *testing.B) {
+	if !CheckPamHasStartConfdir() {
+		b.Skip("pam_start_confdir is not available")
+	}
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		tx := benchmarkStart(b, "echo-service", ConversationFunc(func(s Style, msg string) (string, error) {
+			return "", nil
+		}))
+		defer tx.Close()
+		for pb.Next() {
+			if err := tx.Authenticate(0); err != nil {
+				b.Fatalf("authenticate #error: %v", err)
+			}
+		}
+	})
+}
+
+func BenchmarkConversationBytes(b *testing.B) {
+	if !CheckPamHasStartConfdir() {
+		b.Skip("pam_start_confdir is not available")
+	}
+	tx := benchmarkStart(b, "echo-service", BytesConversationFunc(func(s Style, msg []byte) ([]byte, error) {
+		return nil, nil
+	}))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tx.Authenticate(0); err != nil {
+			b.Fatalf("authenticate #error: %v", err)
+		}
+	}
+}
+
+func BenchmarkItem(b *testing.B) {
+	if !CheckPamHasStartConfdir() {
+		b.Skip("pam_start_confdir is not available")
+	}
+	tx := benchmarkStart(b, "permit-service", Credentials{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tx.SetItem(Tty, "tty1"); err != nil {
+			b.Fatalf("setitem #error: %v", err)
+		}
+		if _, err := tx.GetItem(Tty); err != nil {
+			b.Fatalf("getitem #error: %v", err)
+		}
+	}
+}
+
+func BenchmarkEnv(b *testing.B) {
+	if !CheckPamHasStartConfdir() {
+		b.Skip("pam_start_confdir is not available")
+	}
+	tx := benchmarkStart(b, "permit-service", Credentials{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tx.PutEnv("VAL=1"); err != nil {
+			b.Fatalf("putenv #error: %v", err)
+		}
+		if tx.GetEnv("VAL") != "1" {
+			b.Fatalf("getenv #error: unexpected value")
+		}
+	}
+}
+
+// The calls of the hot paths don't allocate once their values are cached.
+// Before, on an amd64 machine:
+//
+//	BenchmarkGetItem    378.2 ns/op    128 B/op    6 allocs/op
+//	BenchmarkGetEnv     269.8 ns/op     89 B/op    4 allocs/op
+//	BenchmarkPutEnv     414.1 ns/op     80 B/op    3 allocs/op
+//
+// After:
+//
+//	BenchmarkGetItem    151.7 ns/op      0 B/op    0 allocs/op
+//	BenchmarkGetEnv     196.0 ns/op      0 B/op    0 allocs/op
+//	BenchmarkPutEnv     191.3 ns/op      0 B/op    0 allocs/op
+func BenchmarkGetItem(b *testing.B) {
+	if !CheckPamHasStartConfdir() {
+		b.Skip("pam_start_confdir is not available")
+	}
+	tx := benchmarkStart(b, "permit-service", Credentials{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tx.GetItem(Service); err != nil {
+			b.Fatalf("getitem #error: %v", err)
+		}
+	}
+}
+
+func BenchmarkGetEnv(b *testing.B) {
+	if !CheckPamHasStartConfdir() {
+		b.Skip("pam_start_confdir is not available")
+	}
+	tx := benchmarkStart(b, "permit-service", Credentials{})
+	if err := tx.PutEnv("VAL=1"); err != nil {
+		b.Fatalf("putenv #error: %v", err)
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if tx.GetEnv("VAL") != "1" {
+			b.Fatalf("getenv #error: unexpected value")
+		}
+	}
+}
+
+func BenchmarkPutEnv(b *testing.B) {
+	if !CheckPamHasStartConfdir() {
+		b.Skip("pam_start_confdir is not available")
+	}
+	tx := benchmarkStart(b, "permit-service", Credentials{})
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := tx.PutEnv("VAL=1"); err != nil {
+			b.Fatalf("putenv #error: %v", err)
+		}
+	}
+}
+
+func TestTransaction_HotPathAllocs(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	tx, err := StartConfDir("permit-service", "user", Credentials{}, "test-services")
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+	long := "LONG=" + strings.Repeat("x", 1024)
+	for _, tt := range []struct {
+		name string
+		call func()
+	}{
+		{"getitem", func() { tx.GetItem(User) }},
+		{"getenv", func() { tx.GetEnv("VAL") }},
+		{"putenv", func() { tx.PutEnv("VAL=1") }},
+	} {
+		tt.call()
+		if n := testing.AllocsPerRun(100, tt.call); n != 0 {
+			t.Fatalf("%s #error: expected no allocations, got %v", tt.name, n)
+		}
+	}
+	// The values longer than the buffers on the stack are still passed.
+	if err := tx.PutEnv(long); err != nil {
+		t.Fatalf("putenv #error: %v", err)
+	}
+	if v := tx.GetEnv("LONG"); v != long[len("LONG="):] {
+		t.Fatalf("getenv #error: unexpected value %q", v)
+	}
+	if err := tx.SetItem(User, "other"); err != nil {
+		t.Fatalf("setitem #error: %v", err)
+	}
+	if v, err := tx.GetItem(User); err != nil || v != "other" {
+		t.Fatalf("getitem #error: unexpected value %q, %v", v, err)
+	}
+}
+
+func BenchmarkGetEnvList(b *testing.B) {
+	if !CheckPamHasStartConfdir() {
+		b.Skip("pam_start_confdir is not available")
+	}
+	tx := benchmarkStart(b, "permit-service", Credentials{})
+	for i := 0; i < 32; i++ {
+		if err := tx.PutEnv(fmt.Sprintf("VAL%d=%d", i, i)); err != nil {
+			b.Fatalf("putenv #error: %v", err)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := tx.GetEnvList(); err != nil {
+			b.Fatalf("getenvlist #error: %v", err)
+		}
+	}
+}
+
+func BenchmarkEnv_Iterator(b *testing.B) {
+	if !CheckPamHasStartConfdir() {
+		b.Skip("pam_start_confdir is not available")
+	}
+	tx := benchmarkStart(b, "permit-service", Credentials{})
+	for i := 0; i < 32; i++ {
+		if err := tx.PutEnv(fmt.Sprintf("VAL%d=%d", i, i)); err != nil {
+			b.Fatalf("putenv #error: %v", err)
+		}
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for range tx.Env() {
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package pam
+
+import "fmt"
+
+// TwoFactorHandler is a conversation handler for the stacks asking for a
+// password, then for a one time code, telling the prompts apart from their
+// order: the first prompt with the echo off asks for the password, and the
+// following prompts ask for the code. A TwoFactorHandler keeps track of the
+// prompts, so each transaction needs its own.
+type TwoFactorHandler struct {
+	// User is the response to the prompts with the echo on sent before
+	// the password, which ask for the user name.
+	User string
+	// Password returns the response to the password prompt.
+	Password func(prompt string) (string, error)
+	// Code returns the response to the code prompts. Stacks allowing it
+	// send a new code if the response is empty.
+	Code func(prompt string) (string, error)
+	// Message shows the ErrorMsg and TextInfo messages, such as those
+	// announcing the codes and their expiry. They are ignored if nil.
+	Message func(s Style, msg string) error
+
+	password bool
+}
+
+// RespondPAM responds to the messages of the modules.
+func (h *TwoFactorHandler) RespondPAM(s Style, msg string) (string, error) {
+	switch s {
+	case PromptEchoOn:
+		if !h.password {
+			return h.User, nil
+		}
+		return h.Code(msg)
+	case PromptEchoOff:
+		if !h.password {
+			h.password = true
+			return h.Password(msg)
+		}
+		return h.Code(msg)
+	case ErrorMsg, TextInfo:
+		if h.Message == nil {
+			return "", nil
+		}
+		return "", h.Message(s, msg)
+	}
+	return "", fmt.Errorf("unexpected message style %v", s)
+}
@@ -0,0 +1,38 @@
+package pam
+
+import "testing"
+
+func TestTwoFactorHandler(t *testing.T) {
+	var messages []string
+	h := &TwoFactorHandler{
+		User:     "user",
+		Password: func(string) (string, error) { return "secret", nil },
+		Code:     func(string) (string, error) { return "1234", nil },
+		Message: func(s Style, msg string) error {
+			messages = append(messages, msg)
+			return nil
+		},
+	}
+	tests := []struct {
+		style Style
+		want  string
+	}{
+		{PromptEchoOn, "user"},
+		{PromptEchoOff, "secret"},
+		{TextInfo, ""},
+		{PromptEchoOff, "1234"},
+		{PromptEchoOn, "1234"},
+	}
+	for i, tc := range tests {
+		r, err := h.RespondPAM(tc.style, "message")
+		if err != nil || r != tc.want {
+			t.Fatalf("respondpam #error: message %d: expected %q, got %q (%v)", i, tc.want, r, err)
+		}
+	}
+	if len(messages) != 1 {
+		t.Fatalf("respondpam #error: expected 1 message, got %v", messages)
+	}
+	if _, err := h.RespondPAM(BinaryPrompt, ""); err == nil {
+		t.Fatalf("respondpam #expected an error")
+	}
+}
@@ -0,0 +1,85 @@
+package pam
+
+import (
+	"context"
+	"errors"
+)
+
+// AuthOption configures AuthenticateUserPassword.
+type AuthOption func(*Authenticator)
+
+// WithConfDir uses the PAM services of dir, see StartConfDir.
+func WithConfDir(dir string) AuthOption {
+	return func(a *Authenticator) {
+		a.ConfDir = dir
+	}
+}
+
+// WithFlags sets the flags of the authentication and of the account
+// validation.
+func WithFlags(f Flags) AuthOption {
+	return func(a *Authenticator) {
+		a.Flags = f
+	}
+}
+
+// WithItems sets the items of the transaction before authenticating, such
+// as the Rhost the user connects from.
+func WithItems(items map[Item]string) AuthOption {
+	return func(a *Authenticator) {
+		a.Setup = func(ctx context.Context, tx *Transaction) error {
+			return tx.SetItems(items)
+		}
+	}
+}
+
+// AuthenticateUserPassword checks the password of user with the PAM service,
+// authenticating them and validating their account, for the services that
+// only need to know whether the credentials are valid. The modules asking
+// for a password get it, those asking for the user name get user, and the
+// messages are ignored.
+//
+// The copies of the password made by the package are wiped, as are the
+// ones PAM keeps once the transaction ends, but the password string itself
+// can't be.
+func AuthenticateUserPassword(service, user, password string, opts ...AuthOption) error {
+	creds := &staticCredentials{user: user, password: []byte(password)}
+	defer clear(creds.password)
+	a := &Authenticator{Service: service, Handler: creds}
+	for _, opt := range opts {
+		opt(a)
+	}
+	login, err := a.Authenticate(context.Background(), user)
+	if err != nil {
+		return err
+	}
+	return login.Close()
+}
+
+// errUnexpectedStyle is the failure of the static credentials for the
+// messages they can't respond to.
+var errUnexpectedStyle = errors.New("unexpected message style")
+
+// staticCredentials is a conversation handler responding with a user name
+// and a password.
+type staticCredentials struct {
+	user     string
+	password []byte
+}
+
+func (c *staticCredentials) RespondPAM(s Style, msg string) (string, error) {
+	r, err := c.RespondPAMBytes(s, []byte(msg))
+	return string(r), err
+}
+
+func (c *staticCredentials) RespondPAMBytes(s Style, msg []byte) ([]byte, error) {
+	switch s {
+	case PromptEchoOn:
+		return []byte(c.user), nil
+	case PromptEchoOff:
+		return c.password, nil
+	case ErrorMsg, TextInfo:
+		return nil, nil
+	}
+	return nil, errUnexpectedStyle
+}
@@ -0,0 +1,45 @@
+package pam
+
+import (
+	"errors"
+	"os/user"
+	"testing"
+)
+
+func TestAuthenticateUserPassword(t *testing.T) {
+	if !CheckPamHasStartConfdir() {
+		t.Skip("pam_start_confdir is not available")
+	}
+	u, _ := user.Current()
+	err := AuthenticateUserPassword("login-service", u.Username, "secret",
+		WithConfDir("test-services"), WithFlags(Silent),
+		WithItems(map[Item]string{Rhost: "localhost"}))
+	if err != nil {
+		t.Fatalf("authenticateuserpassword #error: %v", err)
+	}
+	err = AuthenticateUserPassword("deny-service", u.Username, "secret",
+		WithConfDir("test-services"))
+	if !errors.Is(err, ErrAuth) {
+		t.Fatalf("authenticateuserpassword #error: expected %v, got %v", ErrAuth, err)
+	}
+}
+
+func TestStaticCredentials(t *testing.T) {
+	c := &staticCredentials{user: "user", password: []byte("secret")}
+	tests := []struct {
+		style Style
+		want  string
+		err   error
+	}{
+		{PromptEchoOn, "user", nil},
+		{PromptEchoOff, "secret", nil},
+		{TextInfo, "", nil},
+		{BinaryPrompt, "", errUnexpectedStyle},
+	}
+	for _, tc := range tests {
+		r, err := c.RespondPAM(tc.style, "prompt")
+		if r != tc.want || !errors.Is(err, tc.err) {
+			t.Errorf("respondpam #error: %v: expected %q (%v), got %q (%v)", tc.style, tc.want, tc.err, r, err)
+		}
+	}
+}
@@ -0,0 +1,193 @@
+package verifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/msteinert/pam"
+)
+
+// maxResponseSize is the maximum size of the responses read by HTTPVerifier.
+const maxResponseSize = 64 * 1024
+
+// OfflineCache keeps the credentials verified by a remote service, to verify
+// them while it is unavailable. The implementations should only store the
+// hashes of the passwords, and decide how long they are valid for.
+type OfflineCache interface {
+	// CredentialVerifier verifies the credentials while the service is
+	// unavailable.
+	CredentialVerifier
+	// StorePassword records the password of user verified by the
+	// service. The password is wiped once the method returns.
+	StorePassword(ctx context.Context, user string, password []byte)
+	// StoreUserInfo records the account of user returned by the service.
+	StoreUserInfo(ctx context.Context, user string, info *UserInfo)
+}
+
+// HTTPVerifier is a CredentialVerifier calling an identity service over
+// HTTP, through its Client. The service implements:
+//
+//	POST /verify/password  {"user": "...", "password": "..."}
+//	POST /verify/token     {"user": "...", "token": "..."}
+//	GET  /users/<user>     the UserInfo, as JSON
+//
+// The successful calls return a 2xx status, those with the wrong
+// credentials 401 or 403, and those of unknown users 404. The other
+// statuses of 4xx fail with pam.ErrAuthinfoUnavail, and those of 5xx and 429
+// are retried.
+type HTTPVerifier struct {
+	Client *Client
+	// HTTP is the client sending the requests, http.DefaultClient if nil.
+	HTTP *http.Client
+	// Header is added to the requests, such as the Authorization of the
+	// module to the service.
+	Header http.Header
+	// Cache, if not nil, verifies the credentials when the service is
+	// unavailable.
+	Cache OfflineCache
+}
+
+// VerifyPassword verifies the password of user.
+func (v *HTTPVerifier) VerifyPassword(ctx context.Context, user string, password []byte) error {
+	// The password is encoded by hand so that the body can be wiped: its
+	// capacity fits the longest encoding, so it is never reallocated.
+	body := make([]byte, 0, 6*(len(user)+len(password))+32)
+	body = append(body, `{"user":`...)
+	body = appendJSONString(body, []byte(user))
+	body = append(body, `,"password":`...)
+	body = appendJSONString(body, password)
+	body = append(body, '}')
+	defer clear(body)
+	err := v.Client.Do(ctx, func(ctx context.Context, endpoint string) error {
+		return v.do(ctx, http.MethodPost, join(endpoint, "verify/password"), body, nil)
+	})
+	switch {
+	case err == nil && v.Cache != nil:
+		v.Cache.StorePassword(ctx, user, password)
+	case errors.Is(err, ErrUnavailable) && v.Cache != nil:
+		return v.Cache.VerifyPassword(ctx, user, password)
+	}
+	return err
+}
+
+// VerifyToken verifies a token of user.
+func (v *HTTPVerifier) VerifyToken(ctx context.Context, user, token string) error {
+	body, err := json.Marshal(struct {
+		User  string `json:"user"`
+		Token string `json:"token"`
+	}{user, token})
+	if err != nil {
+		return err
+	}
+	err = v.Client.Do(ctx, func(ctx context.Context, endpoint string) error {
+		return v.do(ctx, http.MethodPost, join(endpoint, "verify/token"), body, nil)
+	})
+	if errors.Is(err, ErrUnavailable) && v.Cache != nil {
+		return v.Cache.VerifyToken(ctx, user, token)
+	}
+	return err
+}
+
+// UserInfo returns the account of user.
+func (v *HTTPVerifier) UserInfo(ctx context.Context, user string) (*UserInfo, error) {
+	var info *UserInfo
+	err := v.Client.Do(ctx, func(ctx context.Context, endpoint string) error {
+		info = &UserInfo{}
+		return v.do(ctx, http.MethodGet, join(endpoint, "users/"+url.PathEscape(user)), nil, info)
+	})
+	switch {
+	case err == nil && v.Cache != nil:
+		v.Cache.StoreUserInfo(ctx, user, info)
+	case errors.Is(err, ErrUnavailable) && v.Cache != nil:
+		return v.Cache.UserInfo(ctx, user)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// do sends a request, decoding the response in out if not nil.
+func (v *HTTPVerifier) do(ctx context.Context, method, u string, body []byte, out any) error {
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, u, r)
+	if err != nil {
+		return err
+	}
+	for k, vs := range v.Header {
+		req.Header[k] = vs
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Accept", "application/json")
+	client := v.HTTP
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	switch code := resp.StatusCode; {
+	case code >= 200 && code < 300:
+		if out == nil {
+			return nil
+		}
+		if err := json.Unmarshal(data, out); err != nil {
+			return fmt.Errorf("%w: invalid response: %w", pam.ErrAuthinfoUnavail, err)
+		}
+		return nil
+	case code == http.StatusUnauthorized || code == http.StatusForbidden:
+		return pam.ErrAuth
+	case code == http.StatusNotFound:
+		return pam.ErrUserUnknown
+	case code == http.StatusTooManyRequests || code >= 500:
+		return fmt.Errorf("%s: %s", u, resp.Status)
+	}
+	return fmt.Errorf("%w: %s: %s", pam.ErrAuthinfoUnavail, u, resp.Status)
+}
+
+// join returns the URL of path on the endpoint.
+func join(endpoint, path string) string {
+	return strings.TrimSuffix(endpoint, "/") + "/" + path
+}
+
+// appendJSONString appends s to dst as a JSON string, replacing its invalid
+// UTF-8 sequences.
+func appendJSONString(dst, s []byte) []byte {
+	const hex = "0123456789abcdef"
+	dst = append(dst, '"')
+	for len(s) > 0 {
+		r, size := utf8.DecodeRune(s)
+		switch {
+		case r == utf8.RuneError && size == 1:
+			dst = append(dst, `\ufffd`...)
+		case r == '"' || r == '\\':
+			dst = append(dst, '\\', byte(r))
+		case r < 0x20:
+			dst = append(dst, `\u00`...)
+			dst = append(dst, hex[r>>4], hex[r&0xf])
+		default:
+			dst = append(dst, s[:size]...)
+		}
+		s = s[size:]
+	}
+	return append(dst, '"')
+}
@@ -0,0 +1,155 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// ErrUnavailable is returned when none of the endpoints of a Client could
+// be reached. It matches pam.ErrAuthinfoUnavail.
+var ErrUnavailable = fmt.Errorf("%w: service unavailable", pam.ErrAuthinfoUnavail)
+
+// Client calls a remote service, such as an identity service over HTTP or
+// gRPC, from the modules, which must not block the applications for long:
+// each call has a timeout and is retried, failing over to the next
+// endpoints, and the endpoints failing repeatedly are skipped for a while,
+// as a circuit breaker does.
+//
+// The calls failing with a pam.ReturnType error, such as pam.ErrAuth, got
+// an answer from the service and are neither retried nor counted as
+// failures of the endpoint.
+//
+// A Client can be used by multiple goroutines at the same time.
+type Client struct {
+	// Endpoints are the addresses of the service, tried in order.
+	Endpoints []string
+	// Timeout is the maximum duration of each call, 5 seconds if not
+	// set.
+	Timeout time.Duration
+	// Attempts is the number of attempts of each endpoint, 1 if not set.
+	Attempts int
+	// Delay is the time waited before attempting an endpoint again.
+	Delay time.Duration
+	// Threshold is the number of consecutive failures after which an
+	// endpoint is skipped, 3 if not set.
+	Threshold int
+	// Cooldown is the time an endpoint is skipped for, 30 seconds if not
+	// set. The first call after it is attempted again.
+	Cooldown time.Duration
+	// Now returns the current time, time.Now if not set.
+	Now func() time.Time
+
+	mu       sync.Mutex
+	breakers map[string]*breaker
+}
+
+// breaker are the failures of an endpoint.
+type breaker struct {
+	failures int
+	open     time.Time
+}
+
+func (c *Client) now() time.Time {
+	if c.Now != nil {
+		return c.Now()
+	}
+	return time.Now()
+}
+
+// available returns whether the endpoint may be called.
+func (c *Client) available(endpoint string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	b := c.breakers[endpoint]
+	if b == nil || b.open.IsZero() {
+		return true
+	}
+	cooldown := c.Cooldown
+	if cooldown <= 0 {
+		cooldown = 30 * time.Second
+	}
+	return !c.now().Before(b.open.Add(cooldown))
+}
+
+// record records the result of a call of the endpoint.
+func (c *Client) record(endpoint string, failed bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !failed {
+		delete(c.breakers, endpoint)
+		return
+	}
+	if c.breakers == nil {
+		c.breakers = map[string]*breaker{}
+	}
+	b := c.breakers[endpoint]
+	if b == nil {
+		b = &breaker{}
+		c.breakers[endpoint] = b
+	}
+	b.failures++
+	threshold := c.Threshold
+	if threshold <= 0 {
+		threshold = 3
+	}
+	if b.failures >= threshold {
+		b.open = c.now()
+	}
+}
+
+// Do calls the service with call, which receives the endpoint to use, until
+// it succeeds or fails with a pam.ReturnType error. It returns
+// ErrUnavailable, wrapping the last error, if all the attempts failed.
+func (c *Client) Do(ctx context.Context, call func(ctx context.Context, endpoint string) error) error {
+	timeout := c.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	attempts := max(c.Attempts, 1)
+	var last error
+	for _, endpoint := range c.Endpoints {
+		for i := 0; i < attempts && c.available(endpoint); i++ {
+			if i > 0 {
+				if err := wait(ctx, c.Delay); err != nil {
+					return err
+				}
+			}
+			callCtx, cancel := context.WithTimeout(ctx, timeout)
+			err := call(callCtx, endpoint)
+			cancel()
+			var rt pam.ReturnType
+			if err == nil || errors.As(err, &rt) {
+				c.record(endpoint, false)
+				return err
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			c.record(endpoint, true)
+			last = err
+		}
+	}
+	if last == nil {
+		return ErrUnavailable
+	}
+	return fmt.Errorf("%w: %w", ErrUnavailable, last)
+}
+
+func wait(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
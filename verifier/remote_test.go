@@ -0,0 +1,186 @@
+package verifier
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+func TestClientFailover(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	c := &Client{
+		Endpoints: []string{"a", "b"},
+		Attempts:  2,
+		Threshold: 2,
+		Cooldown:  time.Minute,
+		Now:       func() time.Time { return now },
+	}
+	var calls []string
+	call := func(ctx context.Context, endpoint string) error {
+		calls = append(calls, endpoint)
+		if endpoint == "a" {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+	if err := c.Do(context.Background(), call); err != nil {
+		t.Fatalf("do #error: %v", err)
+	}
+	if want := []string{"a", "a", "b"}; !slices.Equal(calls, want) {
+		t.Fatalf("do #error: calls %q, expected %q", calls, want)
+	}
+
+	// a is skipped until its cooldown ends.
+	calls = nil
+	if err := c.Do(context.Background(), call); err != nil || !slices.Equal(calls, []string{"b"}) {
+		t.Fatalf("do #error: %v, calls %q", err, calls)
+	}
+	now = now.Add(time.Minute)
+	calls = nil
+	if err := c.Do(context.Background(), call); err != nil || !slices.Equal(calls, []string{"a", "b"}) {
+		t.Fatalf("do #error: %v, calls %q", err, calls)
+	}
+}
+
+func TestClientAnswers(t *testing.T) {
+	c := &Client{Endpoints: []string{"a", "b"}, Attempts: 3}
+	calls := 0
+	err := c.Do(context.Background(), func(ctx context.Context, endpoint string) error {
+		calls++
+		return pam.ErrAuth
+	})
+	if !errors.Is(err, pam.ErrAuth) || calls != 1 {
+		t.Fatalf("do #error: %v, %d calls", err, calls)
+	}
+
+	err = c.Do(context.Background(), func(ctx context.Context, endpoint string) error {
+		return errors.New("connection refused")
+	})
+	if !errors.Is(err, ErrUnavailable) || !errors.Is(err, pam.ErrAuthinfoUnavail) {
+		t.Fatalf("do #error: %v", err)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	c := &Client{Endpoints: []string{"a"}, Timeout: 10 * time.Millisecond}
+	err := c.Do(context.Background(), func(ctx context.Context, endpoint string) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	if !errors.Is(err, ErrUnavailable) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("do #error: %v", err)
+	}
+}
+
+type memoryCache struct {
+	passwords map[string]string
+	infos     map[string]*UserInfo
+}
+
+func (c *memoryCache) VerifyPassword(ctx context.Context, user string, password []byte) error {
+	if p, ok := c.passwords[user]; !ok || p != string(password) {
+		return pam.ErrAuth
+	}
+	return nil
+}
+
+func (c *memoryCache) VerifyToken(ctx context.Context, user, token string) error {
+	return pam.ErrAuthinfoUnavail
+}
+
+func (c *memoryCache) UserInfo(ctx context.Context, user string) (*UserInfo, error) {
+	if info, ok := c.infos[user]; ok {
+		return info, nil
+	}
+	return nil, pam.ErrUserUnknown
+}
+
+func (c *memoryCache) StorePassword(ctx context.Context, user string, password []byte) {
+	c.passwords[user] = string(password)
+}
+
+func (c *memoryCache) StoreUserInfo(ctx context.Context, user string, info *UserInfo) {
+	c.infos[user] = info
+}
+
+func TestHTTPVerifier(t *testing.T) {
+	down := false
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /verify/password", func(w http.ResponseWriter, r *http.Request) {
+		var req struct{ User, Password string }
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.User != "alice" || req.Password != "s\"e\\cret\n" {
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	})
+	mux.HandleFunc("GET /users/{user}", func(w http.ResponseWriter, r *http.Request) {
+		if r.PathValue("user") != "alice" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(&UserInfo{Name: "alice", Token: true})
+	})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if down {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	defer srv.Close()
+
+	cache := &memoryCache{passwords: map[string]string{}, infos: map[string]*UserInfo{}}
+	v := &HTTPVerifier{Client: &Client{Endpoints: []string{srv.URL}}, Cache: cache}
+	ctx := context.Background()
+
+	if err := v.VerifyPassword(ctx, "alice", []byte("s\"e\\cret\n")); err != nil {
+		t.Fatalf("verify #error: %v", err)
+	}
+	if err := v.VerifyPassword(ctx, "alice", []byte("wrong")); !errors.Is(err, pam.ErrAuth) {
+		t.Fatalf("verify #error: %v", err)
+	}
+	info, err := v.UserInfo(ctx, "alice")
+	if err != nil || info.Name != "alice" || !info.Token {
+		t.Fatalf("user info #error: %v, %+v", err, info)
+	}
+	if _, err := v.UserInfo(ctx, "bob"); !errors.Is(err, pam.ErrUserUnknown) {
+		t.Fatalf("user info #error: %v", err)
+	}
+
+	down = true
+	if err := v.VerifyPassword(ctx, "alice", []byte("s\"e\\cret\n")); err != nil {
+		t.Fatalf("cached verify #error: %v", err)
+	}
+	if _, err := v.UserInfo(ctx, "alice"); err != nil {
+		t.Fatalf("cached user info #error: %v", err)
+	}
+	v.Cache = nil
+	if err := v.VerifyPassword(ctx, "alice", []byte("s\"e\\cret\n")); !errors.Is(err, ErrUnavailable) {
+		t.Fatalf("verify #error: %v", err)
+	}
+}
+
+func TestAppendJSONString(t *testing.T) {
+	for _, s := range []string{"", "plain", "q\"b\\", "\x00\x1f\t", "héllo", "\xff"} {
+		var got string
+		if err := json.Unmarshal(appendJSONString(nil, []byte(s)), &got); err != nil {
+			t.Fatalf("append #error: %q: %v", s, err)
+		}
+		want, _ := json.Marshal(s)
+		var w string
+		json.Unmarshal(want, &w)
+		if got != w {
+			t.Fatalf("append #error: %q, expected %q", got, w)
+		}
+	}
+}
@@ -0,0 +1,162 @@
+// Package verifier adapts the backends verifying the credentials of the
+// users, such as LDAP directories, REST services or databases, to the
+// operations of the PAM modules: the backends implement CredentialVerifier,
+// and Module handles the conversations and the return values as the
+// standard modules do.
+package verifier
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// CredentialVerifier is a backend verifying the credentials of the users.
+//
+// The methods return pam.ErrAuth for the wrong credentials and
+// pam.ErrUserUnknown for the unknown users. The other errors, which are not
+// of type pam.ReturnType, are those of the backend itself, such as a
+// directory that can't be reached, and are returned as
+// pam.ErrAuthinfoUnavail.
+type CredentialVerifier interface {
+	// VerifyPassword verifies the password of user. The password is
+	// wiped once the method returns.
+	VerifyPassword(ctx context.Context, user string, password []byte) error
+	// VerifyToken verifies a token of user, such as a one time code.
+	VerifyToken(ctx context.Context, user, token string) error
+	// UserInfo returns the account of user.
+	UserInfo(ctx context.Context, user string) (*UserInfo, error)
+}
+
+// UserInfo is an account known to a CredentialVerifier.
+type UserInfo struct {
+	// Name is the name of the user.
+	Name string `json:"name"`
+	// Disabled is set for the disabled accounts, which can't log in.
+	Disabled bool `json:"disabled,omitempty"`
+	// Expires is when the account expires, never if zero.
+	Expires time.Time `json:"expires,omitzero"`
+	// PasswordExpired is set when the password must be changed.
+	PasswordExpired bool `json:"password_expired,omitempty"`
+	// Token is set when a token must be verified after the password.
+	Token bool `json:"token,omitempty"`
+}
+
+// Module implements the operations of a module with a CredentialVerifier.
+type Module struct {
+	Verifier CredentialVerifier
+	// UserPrompt is the prompt asking for the user name, "login: " if
+	// not set.
+	UserPrompt string
+	// PasswordPrompt is the prompt asking for the password, "Password: "
+	// if not set.
+	PasswordPrompt string
+	// TokenPrompt is the prompt asking for the token, "Verification code: "
+	// if not set.
+	TokenPrompt string
+	// Now returns the current time, time.Now if not set.
+	Now func() time.Time
+}
+
+func (m *Module) now() time.Time {
+	if m.Now != nil {
+		return m.Now()
+	}
+	return time.Now()
+}
+
+func prompt(p, def string) string {
+	if p == "" {
+		return def
+	}
+	return p
+}
+
+// backendError returns err as a PAM error: the errors of the backend are
+// wrapped in pam.ErrAuthinfoUnavail.
+func backendError(err error) error {
+	var rt pam.ReturnType
+	if err == nil || errors.As(err, &rt) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", pam.ErrAuthinfoUnavail, err)
+}
+
+// Authenticate authenticates user, asking for them through conv if empty,
+// then asking for the password and, if the account requires one, a token.
+// It returns the name of the authenticated user.
+//
+// The password is asked for even if the user is unknown, so that the
+// unknown users can't be told apart from the others.
+func (m *Module) Authenticate(ctx context.Context, conv pam.ConversationHandler, user string, f pam.Flags) (string, error) {
+	if user == "" {
+		var err error
+		user, err = conv.RespondPAM(pam.PromptEchoOn, prompt(m.UserPrompt, "login: "))
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", pam.ErrConv, err)
+		}
+		if user == "" {
+			return "", pam.ErrUserUnknown
+		}
+	}
+	info, infoErr := m.Verifier.UserInfo(ctx, user)
+	if infoErr != nil && !errors.Is(infoErr, pam.ErrUserUnknown) {
+		return "", backendError(infoErr)
+	}
+	password, err := respondBytes(conv, pam.PromptEchoOff, prompt(m.PasswordPrompt, "Password: "))
+	defer clear(password)
+	if err != nil {
+		return "", fmt.Errorf("%w: %w", pam.ErrConv, err)
+	}
+	if infoErr != nil {
+		return "", infoErr
+	}
+	if err := m.Verifier.VerifyPassword(ctx, user, password); err != nil {
+		return "", backendError(err)
+	}
+	if info.Token {
+		token, err := conv.RespondPAM(pam.PromptEchoOff, prompt(m.TokenPrompt, "Verification code: "))
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", pam.ErrConv, err)
+		}
+		if err := m.Verifier.VerifyToken(ctx, user, token); err != nil {
+			return "", backendError(err)
+		}
+	}
+	if info.Name != "" {
+		user = info.Name
+	}
+	return user, nil
+}
+
+// AcctMgmt validates the account of user: it fails with pam.ErrPermDenied
+// if it is disabled, pam.ErrAcctExpired if it expired, and
+// pam.ErrNewAuthtokReqd if the password must be changed.
+func (m *Module) AcctMgmt(ctx context.Context, user string, f pam.Flags) error {
+	info, err := m.Verifier.UserInfo(ctx, user)
+	if err != nil {
+		return backendError(err)
+	}
+	switch {
+	case info.Disabled:
+		return pam.ErrPermDenied
+	case !info.Expires.IsZero() && !m.now().Before(info.Expires):
+		return pam.ErrAcctExpired
+	case info.PasswordExpired:
+		return pam.ErrNewAuthtokReqd
+	}
+	return nil
+}
+
+// respondBytes sends a message through conv, as bytes if it supports them.
+func respondBytes(conv pam.ConversationHandler, s pam.Style, msg string) ([]byte, error) {
+	if b, ok := conv.(pam.BytesConversationHandler); ok {
+		r, err := b.RespondPAMBytes(s, []byte(msg))
+		return append([]byte(nil), r...), err
+	}
+	r, err := conv.RespondPAM(s, msg)
+	return []byte(r), err
+}
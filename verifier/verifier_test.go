@@ -0,0 +1,121 @@
+package verifier
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+type fakeBackend struct {
+	users map[string]*UserInfo
+	down  bool
+}
+
+func (b *fakeBackend) VerifyPassword(ctx context.Context, user string, password []byte) error {
+	if b.down {
+		return errors.New("connection refused")
+	}
+	if string(password) != "secret" {
+		return pam.ErrAuth
+	}
+	return nil
+}
+
+func (b *fakeBackend) VerifyToken(ctx context.Context, user, token string) error {
+	if token != "123456" {
+		return pam.ErrAuth
+	}
+	return nil
+}
+
+func (b *fakeBackend) UserInfo(ctx context.Context, user string) (*UserInfo, error) {
+	info, ok := b.users[user]
+	if !ok {
+		return nil, pam.ErrUserUnknown
+	}
+	return info, nil
+}
+
+func respond(responses map[string]string, prompts *[]string) pam.ConversationHandler {
+	return pam.ConversationFunc(func(s pam.Style, msg string) (string, error) {
+		*prompts = append(*prompts, msg)
+		return responses[msg], nil
+	})
+}
+
+func TestAuthenticate(t *testing.T) {
+	b := &fakeBackend{users: map[string]*UserInfo{
+		"alice": {Name: "alice"},
+		"bob":   {Name: "bob", Token: true},
+	}}
+	m := &Module{Verifier: b}
+	ctx := context.Background()
+
+	tests := []struct {
+		user, password, token string
+		want                  error
+		prompts               int
+	}{
+		{user: "alice", password: "secret", prompts: 1},
+		{user: "alice", password: "wrong", want: pam.ErrAuth, prompts: 1},
+		{user: "bob", password: "secret", token: "123456", prompts: 2},
+		{user: "bob", password: "secret", token: "000000", want: pam.ErrAuth, prompts: 2},
+		{user: "mallory", password: "secret", want: pam.ErrUserUnknown, prompts: 1},
+	}
+	for _, tc := range tests {
+		var prompts []string
+		conv := respond(map[string]string{
+			"Password: ":          tc.password,
+			"Verification code: ": tc.token,
+		}, &prompts)
+		_, err := m.Authenticate(ctx, conv, tc.user, 0)
+		if !errors.Is(err, tc.want) {
+			t.Fatalf("authenticate #error: %s: %v, expected %v", tc.user, err, tc.want)
+		}
+		if len(prompts) != tc.prompts {
+			t.Fatalf("authenticate #error: %s: prompts %q", tc.user, prompts)
+		}
+	}
+
+	var prompts []string
+	conv := respond(map[string]string{"login: ": "alice", "Password: ": "secret"}, &prompts)
+	user, err := m.Authenticate(ctx, conv, "", 0)
+	if err != nil || user != "alice" {
+		t.Fatalf("authenticate #error: %q, %v", user, err)
+	}
+
+	b.down = true
+	_, err = m.Authenticate(ctx, conv, "alice", 0)
+	if !errors.Is(err, pam.ErrAuthinfoUnavail) {
+		t.Fatalf("authenticate #error: %v", err)
+	}
+}
+
+func TestAcctMgmt(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	b := &fakeBackend{users: map[string]*UserInfo{
+		"alice":   {},
+		"disable": {Disabled: true},
+		"expired": {Expires: now.Add(-time.Hour)},
+		"later":   {Expires: now.Add(time.Hour)},
+		"change":  {PasswordExpired: true},
+	}}
+	m := &Module{Verifier: b, Now: func() time.Time { return now }}
+	tests := map[string]error{
+		"alice":   nil,
+		"disable": pam.ErrPermDenied,
+		"expired": pam.ErrAcctExpired,
+		"later":   nil,
+		"change":  pam.ErrNewAuthtokReqd,
+		"nobody":  pam.ErrUserUnknown,
+	}
+	for user, want := range tests {
+		err := m.AcctMgmt(context.Background(), user, 0)
+		if !errors.Is(err, want) {
+			t.Fatalf("acct mgmt #error: %s: %v, expected %v", user, err, want)
+		}
+	}
+}
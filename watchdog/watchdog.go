@@ -0,0 +1,139 @@
+// Package watchdog bounds the time spent by the modules written in Go in
+// their handlers, so that a stuck backend, such as an unresponsive
+// directory server, fails the authentications rather than hanging login or
+// sshd indefinitely.
+//
+// Modules opt in by running their handlers with a Watchdog:
+//
+//	var wd = &watchdog.Watchdog{Timeout: 10 * time.Second}
+//
+//	err := wd.Run(ctx, "authenticate", func(ctx context.Context) error {
+//		return authenticate(ctx, user)
+//	})
+//
+// Once the deadline expires, the stacks of the goroutines are logged to
+// syslog, to diagnose where the handler is stuck, and the handler fails
+// with ErrTimeout, which wraps pam.ErrAuthinfoUnavail so that the stack
+// carries on. Go can't stop goroutines: the handler keeps running in the
+// background until it returns, its result being dropped, so it should use
+// its context to give up.
+package watchdog
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/syslog"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+// DefaultTimeout is the default deadline of the handlers.
+const DefaultTimeout = 30 * time.Second
+
+// MaxGoroutines is the maximum number of goroutines whose stacks are logged.
+const MaxGoroutines = 64
+
+// ErrTimeout is returned when a handler didn't return before its deadline.
+var ErrTimeout = fmt.Errorf("%w: handler timed out", pam.ErrAuthinfoUnavail)
+
+// Watchdog runs handlers with a deadline. Its zero value uses
+// DefaultTimeout and logs to syslog.
+type Watchdog struct {
+	// Timeout is the deadline of the handlers, DefaultTimeout if not set.
+	Timeout time.Duration
+	// Tag is the syslog tag of the messages, the name of the program if
+	// empty.
+	Tag string
+	// Log logs the messages of the expired handlers, one by goroutine
+	// stack. If nil, they are sent to syslog with the authpriv facility,
+	// or to stderr if it is not available.
+	Log func(msg string)
+}
+
+func (w *Watchdog) timeout() time.Duration {
+	if w.Timeout <= 0 {
+		return DefaultTimeout
+	}
+	return w.Timeout
+}
+
+// Run calls f with a context whose deadline is the one of the watchdog,
+// and returns its error. If f doesn't return in time, it logs the stacks
+// of the goroutines and returns ErrTimeout, or an error wrapping
+// pam.ErrAuthinfoUnavail and the cause of ctx if it is done first, without
+// logging.
+func (w *Watchdog) Run(ctx context.Context, name string, f func(ctx context.Context) error) error {
+	timeout := w.timeout()
+	fctx, cancel := context.WithTimeout(ctx, timeout)
+	done := make(chan error, 1)
+	go func() {
+		defer cancel()
+		done <- f(fctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-fctx.Done():
+	}
+	// f may have returned meanwhile.
+	select {
+	case err := <-done:
+		return err
+	default:
+	}
+	if ctx.Err() != nil {
+		return fmt.Errorf("%w: %s: %w", pam.ErrAuthinfoUnavail, name, context.Cause(ctx))
+	}
+	w.dump(fmt.Sprintf("%s: handler still running after %v", name, timeout))
+	return fmt.Errorf("%w: %s after %v", ErrTimeout, name, timeout)
+}
+
+// Wrap returns f run by the watchdog, see Run.
+func (w *Watchdog) Wrap(name string, f func(ctx context.Context) error) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		return w.Run(ctx, name, f)
+	}
+}
+
+// dump logs msg followed by the stacks of the goroutines.
+func (w *Watchdog) dump(msg string) {
+	log := w.Log
+	if log == nil {
+		logger, err := syslog.New(syslog.LOG_AUTHPRIV|syslog.LOG_ERR, w.Tag)
+		if err != nil {
+			log = func(msg string) {
+				fmt.Fprintln(os.Stderr, msg)
+			}
+		} else {
+			defer logger.Close()
+			log = func(msg string) {
+				logger.Err(msg)
+			}
+		}
+	}
+	log(msg)
+	stacks := bytes.Split(bytes.TrimSpace(stack()), []byte("\n\n"))
+	for i, s := range stacks {
+		if i == MaxGoroutines {
+			log(fmt.Sprintf("%d more goroutines", len(stacks)-i))
+			break
+		}
+		log(string(s))
+	}
+}
+
+// stack returns the stacks of all the goroutines.
+func stack() []byte {
+	buf := make([]byte, 64<<10)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) || len(buf) >= 16<<20 {
+			return buf[:n]
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+}
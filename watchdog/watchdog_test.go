@@ -0,0 +1,76 @@
+package watchdog
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/msteinert/pam"
+)
+
+func stuckBackend(ctx context.Context, release chan struct{}) error {
+	<-release
+	return nil
+}
+
+func TestWatchdog(t *testing.T) {
+	var mu sync.Mutex
+	var logged []string
+	w := &Watchdog{
+		Timeout: 50 * time.Millisecond,
+		Log: func(msg string) {
+			mu.Lock()
+			defer mu.Unlock()
+			logged = append(logged, msg)
+		},
+	}
+
+	failure := errors.New("failure")
+	if err := w.Run(context.Background(), "authenticate", func(ctx context.Context) error {
+		if _, ok := ctx.Deadline(); !ok {
+			t.Errorf("run #error: expected a deadline")
+		}
+		return failure
+	}); err != failure {
+		t.Fatalf("run #error: expected %v, got %v", failure, err)
+	}
+	if len(logged) != 0 {
+		t.Fatalf("run #error: unexpected messages %v", logged)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	err := w.Wrap("authenticate", func(ctx context.Context) error {
+		return stuckBackend(ctx, release)
+	})(context.Background())
+	if !errors.Is(err, ErrTimeout) || !errors.Is(err, pam.ErrAuthinfoUnavail) {
+		t.Fatalf("run #error: expected %v, got %v", ErrTimeout, err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if len(logged) < 2 || !strings.HasPrefix(logged[0], "authenticate: handler still running after 50ms") {
+		t.Fatalf("run #error: unexpected messages %v", logged)
+	}
+	if !strings.Contains(strings.Join(logged[1:], "\n"), "stuckBackend") {
+		t.Fatalf("run #error: expected the stack of the stuck handler, got %v", logged[1:])
+	}
+}
+
+func TestWatchdog_Canceled(t *testing.T) {
+	w := &Watchdog{Log: func(msg string) {
+		t.Errorf("run #error: unexpected message %s", msg)
+	}}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := w.Run(ctx, "authenticate", func(ctx context.Context) error {
+		<-ctx.Done()
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	if errors.Is(err, ErrTimeout) || !errors.Is(err, pam.ErrAuthinfoUnavail) || !errors.Is(err, context.Canceled) {
+		t.Fatalf("run #error: expected %v, got %v", context.Canceled, err)
+	}
+}
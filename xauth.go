@@ -0,0 +1,76 @@
+//go:build cgo
+
+package pam
+
+//#include <security/pam_appl.h>
+//#include <limits.h>
+//
+//#ifndef PAM_XAUTHDATA
+//struct pam_xauth_data {
+//	int namelen;
+//	char *name;
+//	int datalen;
+//	char *data;
+//};
+//#endif
+import "C"
+
+import (
+	"fmt"
+	"math"
+	"unsafe"
+)
+
+// SetXAuthData sets the XAuthData item. The C copy of the data is wiped
+// once PAM has copied it.
+func (t *Transaction) SetXAuthData(x XAuth) error {
+	if err, ok := diverted(t.thread, func() error { return t.SetXAuthData(x) }); ok {
+		return err
+	}
+	if err := t.state.enter(); err != nil {
+		return err
+	}
+	defer t.state.leave()
+	if len(x.Name) > math.MaxInt32 || len(x.Data) > math.MaxInt32 {
+		return fmt.Errorf("%v: %w: too long", XAuthData, ErrBadItem)
+	}
+	// The structure holds no Go pointers, so it can be passed to C.
+	var d C.struct_pam_xauth_data
+	d.namelen = C.int(len(x.Name))
+	d.name = cString(x.Name)
+	defer cFree(unsafe.Pointer(d.name))
+	d.datalen = C.int(len(x.Data))
+	d.data = (*C.char)(cBytes(x.Data))
+	defer freeSecretBytes(unsafe.Pointer(d.data), len(x.Data))
+	done := t.callHooks(EventItem, "set_item", XAuthData)
+	status := done(C.pam_set_item(t.handle, C.int(XAuthData), unsafe.Pointer(&d)))
+	return t.result(status)
+}
+
+// GetXAuthData retrieves the XAuthData item, empty if not set.
+func (t *Transaction) GetXAuthData() (XAuth, error) {
+	if r, err, ok := diverted2(t.thread, func() (XAuth, error) { return t.GetXAuthData() }); ok {
+		return r, err
+	}
+	if err := t.state.enter(); err != nil {
+		return XAuth{}, err
+	}
+	defer t.state.leave()
+	var p unsafe.Pointer
+	done := t.callHooks(EventCall, "get_item", XAuthData)
+	if err := t.result(done(C.pam_get_item(t.handle, C.int(XAuthData), &p))); err != nil {
+		return XAuth{}, err
+	}
+	if p == nil {
+		return XAuth{}, nil
+	}
+	d := (*C.struct_pam_xauth_data)(p)
+	var x XAuth
+	if d.name != nil && d.namelen > 0 {
+		x.Name = C.GoStringN(d.name, d.namelen)
+	}
+	if d.data != nil && d.datalen > 0 {
+		x.Data = C.GoBytes(unsafe.Pointer(d.data), d.datalen)
+	}
+	return x, nil
+}
@@ -0,0 +1,59 @@
+package pam
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestLinuxItems(t *testing.T) {
+	tx, err := StartFunc("passwd", "test", func(s Style, msg string) (string, error) {
+		return "", nil
+	})
+	if err != nil {
+		t.Fatalf("start #error: %v", err)
+	}
+	defer tx.Close()
+
+	for _, item := range []Item{FailDelay, XAuthData} {
+		if err := tx.SetItem(item, "string"); !errors.Is(err, ErrBadItem) {
+			t.Fatalf("setitem #error: %v: expected %v, got %v", item, ErrBadItem, err)
+		}
+		if _, err := tx.GetItem(item); !errors.Is(err, ErrBadItem) {
+			t.Fatalf("getitem #error: %v: expected %v, got %v", item, ErrBadItem, err)
+		}
+	}
+	err = tx.SetItems(map[Item]string{Tty: "tty1", XAuthData: "string"})
+	if !errors.Is(err, ErrBadItem) {
+		t.Fatalf("setitems #error: expected %v, got %v", ErrBadItem, err)
+	}
+	items, err := tx.GetItems([]Item{Tty, FailDelay})
+	if !errors.Is(err, ErrBadItem) || items[Tty] != "tty1" || len(items) != 1 {
+		t.Fatalf("getitems #error: unexpected items %v, %v", items, err)
+	}
+
+	if err := tx.SetItem(XDisplay, ":0"); errors.Is(err, ErrBadItem) {
+		t.Skip("the Linux-PAM items are not supported")
+	} else if err != nil {
+		t.Fatalf("setitem #error: %v", err)
+	}
+	if err := tx.SetItem(AuthtokType, "UNIX"); err != nil {
+		t.Fatalf("setitem #error: %v", err)
+	}
+	items, err = tx.GetItems([]Item{XDisplay, AuthtokType})
+	if err != nil || items[XDisplay] != ":0" || items[AuthtokType] != "UNIX" {
+		t.Fatalf("getitems #error: unexpected items %v, %v", items, err)
+	}
+
+	if x, err := tx.GetXAuthData(); err != nil || x.Name != "" || x.Data != nil {
+		t.Fatalf("getxauthdata #error: expected no data, got %v, %v", x, err)
+	}
+	expected := XAuth{Name: "MIT-MAGIC-COOKIE-1", Data: []byte{0, 1, 0xfe, 0, 0xff}}
+	if err := tx.SetXAuthData(expected); err != nil {
+		t.Fatalf("setxauthdata #error: %v", err)
+	}
+	x, err := tx.GetXAuthData()
+	if err != nil || x.Name != expected.Name || !bytes.Equal(x.Data, expected.Data) {
+		t.Fatalf("getxauthdata #error: expected %v, got %v, %v", expected, x, err)
+	}
+}